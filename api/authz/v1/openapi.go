@@ -0,0 +1,9 @@
+package authzv1
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI v2 description of the REST gateway, generated from
+// authz.proto with protoc-gen-openapiv2
+//
+//go:embed authz.swagger.json
+var OpenAPI []byte
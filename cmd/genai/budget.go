@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// Pack modes of a file
+const (
+	modeFull      = "full"
+	modeSummary   = "summary"
+	modeTruncated = "truncated"
+)
+
+// estimateTokens approximates how many tokens a model reads text as, at
+// about four bytes a token for source code
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// summarize shortens a file to its outline: for Go, the package, imports,
+// declarations and function signatures without bodies; for anything else,
+// as many leading lines as fit maxTokens
+func summarize(rel, content string, maxTokens int) (string, string) {
+	if strings.HasSuffix(rel, ".go") {
+		if outline, ok := goOutline(content); ok {
+			if maxTokens <= 0 || estimateTokens(outline) <= maxTokens {
+				return outline, modeSummary
+			}
+			content = outline
+		}
+	}
+	return truncate(content, maxTokens), modeTruncated
+}
+
+// goOutline prints a Go file without function bodies
+func goOutline(content string) (string, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return "", false
+	}
+
+	// Comments inside the dropped bodies would be printed out of place
+	var bodies []*ast.BlockStmt
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			bodies = append(bodies, fn.Body)
+			fn.Body = nil
+		}
+	}
+	var comments []*ast.CommentGroup
+	for _, group := range file.Comments {
+		if !inBody(bodies, group) {
+			comments = append(comments, group)
+		}
+	}
+	file.Comments = comments
+
+	var buf bytes.Buffer
+	buf.WriteString("// Outline: function bodies omitted to fit the token budget\n")
+	if err := printer.Fprint(&buf, fset, file); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+func inBody(bodies []*ast.BlockStmt, group *ast.CommentGroup) bool {
+	for _, body := range bodies {
+		if group.Pos() >= body.Pos() && group.End() <= body.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate keeps the leading lines of content that fit maxTokens
+func truncate(content string, maxTokens int) string {
+	const marker = "\n... truncated to fit the token budget"
+	if maxTokens <= 0 || estimateTokens(content) <= maxTokens {
+		return content
+	}
+
+	limit := maxTokens*4 - len(marker)
+	if limit <= 0 {
+		return strings.TrimPrefix(marker, "\n")
+	}
+	cut := content[:limit]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + marker
+}
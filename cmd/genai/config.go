@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read from the scanned directory when -config isn't
+// given
+const defaultConfigFile = ".genai.yml"
+
+// Config selects the files in a context pack and bounds its size
+type Config struct {
+	// Include lists globs of files to pack, relative to the scanned
+	// directory; ** matches any number of directories
+	Include []string `yaml:"include"`
+	// Exclude lists globs of files to leave out even when included
+	Exclude []string `yaml:"exclude"`
+	// Priorities ranks directories: files under a higher priority
+	// directory are packed first, so they are the last to be cut when the
+	// budget runs out. The longest matching directory wins; others are 0.
+	Priorities map[string]int `yaml:"priorities"`
+	// Redact replaces API keys, passwords in DSNs and other secrets with
+	// a placeholder; on by default
+	Redact *bool `yaml:"redact"`
+	// RedactPatterns are extra regular expressions whose matches are
+	// redacted
+	RedactPatterns []string `yaml:"redact_patterns"`
+	// Budget bounds the pack's size
+	Budget Budget `yaml:"budget"`
+
+	include, exclude []*regexp.Regexp
+	redactors        []*regexp.Regexp
+}
+
+// Budget bounds a context pack, in estimated tokens; zero is unlimited
+type Budget struct {
+	// MaxTokens bounds the whole pack. Files that don't fit are
+	// summarized, or left out when even the summary doesn't fit.
+	MaxTokens int `yaml:"max_tokens"`
+	// MaxFileTokens bounds each file; larger ones are summarized
+	MaxFileTokens int `yaml:"max_file_tokens"`
+}
+
+// DefaultConfig packs the service's source, as the tool always has
+func DefaultConfig() *Config {
+	return &Config{
+		Include: []string{
+			"cmd/api/**",
+			"internal/**",
+			"db/**",
+			"templates/**",
+			"permissions/**",
+		},
+		Exclude: []string{
+			"**/node_modules/**",
+			"**/.next/**",
+			"**/package-lock.json",
+			"**/yarn.lock",
+		},
+	}
+}
+
+// scannedExtensions are the file types packed
+var scannedExtensions = []string{".go", ".json", ".tsx", ".ts", ".jsx", ".js", ".yml", ".perm", ".tmpl"}
+
+// LoadConfig reads a config file over defaults, which it fills in. A
+// missing file is only an error when required is set.
+func LoadConfig(file string, required bool, defaults *Config) (*Config, error) {
+	cfg := defaults
+
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !required:
+	case err != nil:
+		return nil, fmt.Errorf("reading config: %w", err)
+	default:
+		// Lists in the file replace the defaults rather than adding to them
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", file, err)
+		}
+	}
+
+	if err := cfg.compile(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) compile() error {
+	var err error
+	if c.include, err = compileGlobs(c.Include); err != nil {
+		return err
+	}
+	if c.exclude, err = compileGlobs(c.Exclude); err != nil {
+		return err
+	}
+	if c.Budget.MaxTokens < 0 || c.Budget.MaxFileTokens < 0 {
+		return errors.New("budget limits must not be negative")
+	}
+
+	if c.Redact == nil || *c.Redact {
+		c.redactors = append(c.redactors, defaultRedactors...)
+	}
+	for _, pattern := range c.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		c.redactors = append(c.redactors, re)
+	}
+	return nil
+}
+
+// Selected reports whether a file, by its slash-separated path relative to
+// the scanned directory, belongs in the pack
+func (c *Config) Selected(rel string) bool {
+	if !hasScannedExtension(rel) {
+		return false
+	}
+	return matchAny(c.include, rel) && !matchAny(c.exclude, rel)
+}
+
+// Priority is the priority of the longest directory in Priorities that
+// contains a file
+func (c *Config) Priority(rel string) int {
+	best, priority := -1, 0
+	for dir, p := range c.Priorities {
+		dir = strings.Trim(dir, "/")
+		if (dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/")) && len(dir) > best {
+			best, priority = len(dir), p
+		}
+	}
+	return priority
+}
+
+func hasScannedExtension(rel string) bool {
+	ext := path.Ext(rel)
+	for _, scanned := range scannedExtensions {
+		if ext == scanned {
+			return true
+		}
+	}
+	return false
+}
+
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		re, err := globRegexp(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchAny(globs []*regexp.Regexp, rel string) bool {
+	for _, re := range globs {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp translates a glob to a regular expression: * and ? match
+// within a path segment, ** matches any number of segments and a trailing
+// slash matches everything under a directory
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	glob = strings.TrimPrefix(glob, "./")
+	if strings.HasSuffix(glob, "/") {
+		glob += "**"
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case ch == '*':
+			b.WriteString("[^/]*")
+		case ch == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// modeSymbols marks files cut down to the declarations a symbol needs
+const modeSymbols = "symbols"
+
+// DependencyScanner packs the Go code a target depends on instead of whole
+// directories. A package target, like ./internal/handler, packs the
+// packages it imports from this module, transitively. A symbol target,
+// like ./internal/service.UserService or
+// ./internal/service.UserService.VerifyEmail, packs only the declarations
+// it refers to, transitively. Dependencies outside the module, and test
+// files, are left out; the config's Exclude globs still apply, its Include
+// globs don't.
+type DependencyScanner struct {
+	rootPath string
+	config   *Config
+	targets  []string
+}
+
+// NewDependencyScanner creates a scanner for targets, relative to rootPath
+func NewDependencyScanner(rootPath string, config *Config, targets []string) *DependencyScanner {
+	return &DependencyScanner{
+		rootPath: rootPath,
+		config:   config,
+		targets:  targets,
+	}
+}
+
+// Scan packs the targets' dependencies
+func (ds *DependencyScanner) Scan() error {
+	var packagePatterns []string
+	var symbols []symbolTarget
+	for _, target := range ds.targets {
+		if symbol, ok := parseSymbolTarget(target); ok {
+			symbols = append(symbols, symbol)
+		} else {
+			packagePatterns = append(packagePatterns, target)
+		}
+	}
+
+	files := map[string]*packedFile{}
+	if len(packagePatterns) > 0 {
+		if err := ds.collectPackages(packagePatterns, files); err != nil {
+			return err
+		}
+	}
+	if len(symbols) > 0 {
+		if err := ds.collectSymbols(symbols, files); err != nil {
+			return err
+		}
+	}
+
+	packed := make([]*packedFile, 0, len(files))
+	for _, f := range files {
+		f.content, f.redacted = redact(f.content, ds.config.redactors)
+		packed = append(packed, f)
+	}
+	sort.Slice(packed, func(i, j int) bool { return packed[i].relPath < packed[j].relPath })
+	writePack(ds.config, packed)
+	return nil
+}
+
+// symbolTarget is a declaration to pack what it refers to: a package-level
+// name, or a method as Type.Method
+type symbolTarget struct {
+	pkg, name, method string
+}
+
+// parseSymbolTarget splits pkg.Name and pkg.Type.Method targets; the
+// symbol follows the first dot of the last path element
+func parseSymbolTarget(target string) (symbolTarget, bool) {
+	slash := strings.LastIndex(target, "/")
+	last := target[slash+1:]
+	dot := strings.Index(last, ".")
+	if dot <= 0 || strings.Trim(last, ".") == "" {
+		return symbolTarget{}, false
+	}
+
+	t := symbolTarget{pkg: target[:slash+1] + last[:dot], name: last[dot+1:]}
+	if name, method, ok := strings.Cut(t.name, "."); ok {
+		t.name, t.method = name, method
+	}
+	return t, t.name != ""
+}
+
+func (ds *DependencyScanner) load(mode packages.LoadMode, patterns []string) ([]*packages.Package, error) {
+	cfg := &packages.Config{Mode: mode | packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedModule, Dir: ds.rootPath}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", strings.Join(patterns, ", "), err)
+	}
+	var errs []string
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, e := range pkg.Errors {
+			errs = append(errs, e.Error())
+		}
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("loading %s: %s", strings.Join(patterns, ", "), strings.Join(errs, "; "))
+	}
+	return pkgs, nil
+}
+
+// inModule reports whether a package belongs to the module being packed
+func inModule(pkg *packages.Package) bool {
+	return pkg.Module != nil && pkg.Module.Main
+}
+
+// relPath returns a file's slash-separated path relative to the root, and
+// whether the config leaves it out
+func (ds *DependencyScanner) relPath(file string) (string, bool) {
+	rel, err := filepath.Rel(ds.rootPath, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	return rel, !matchAny(ds.config.exclude, rel)
+}
+
+// collectPackages adds the files of the packages matching patterns and of
+// the module's packages they import, nearest first
+func (ds *DependencyScanner) collectPackages(patterns []string, files map[string]*packedFile) error {
+	pkgs, err := ds.load(0, patterns)
+	if err != nil {
+		return err
+	}
+
+	// Breadth first, so each package gets its shortest import depth
+	depth := map[string]int{}
+	queue := make([]*packages.Package, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		depth[pkg.PkgPath] = 0
+		queue = append(queue, pkg)
+	}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if !inModule(pkg) {
+			continue
+		}
+
+		for _, file := range pkg.GoFiles {
+			rel, ok := ds.relPath(file)
+			if !ok {
+				continue
+			}
+			content, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Printf("<!-- Error reading %s: %s -->\n", rel, err)
+				continue
+			}
+			files[rel] = &packedFile{
+				relPath:  rel,
+				content:  string(content),
+				mode:     modeFull,
+				priority: ds.config.Priority(rel),
+				depth:    depth[pkg.PkgPath],
+			}
+		}
+
+		for _, imp := range pkg.Imports {
+			if _, seen := depth[imp.PkgPath]; !seen {
+				depth[imp.PkgPath] = depth[pkg.PkgPath] + 1
+				queue = append(queue, imp)
+			}
+		}
+	}
+	return nil
+}
+
+// declaration is a top-level declaration in the module
+type declaration struct {
+	pkg  *packages.Package
+	file *ast.File
+	decl ast.Decl
+}
+
+// collectSymbols adds the declarations the symbols refer to, transitively,
+// grouped by the files they are in
+func (ds *DependencyScanner) collectSymbols(symbols []symbolTarget, files map[string]*packedFile) error {
+	patterns := make([]string, 0, len(symbols))
+	for _, s := range symbols {
+		patterns = append(patterns, s.pkg)
+	}
+	pkgs, err := ds.load(packages.NeedSyntax|packages.NeedTypes|packages.NeedTypesInfo, patterns)
+	if err != nil {
+		return err
+	}
+
+	// Index where every object in the module is declared
+	decls := map[types.Object]declaration{}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !inModule(pkg) {
+			return
+		}
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				for _, name := range declaredNames(decl) {
+					if obj := pkg.TypesInfo.Defs[name]; obj != nil {
+						decls[obj] = declaration{pkg: pkg, file: file, decl: decl}
+					}
+				}
+			}
+		}
+	})
+
+	var queue []types.Object
+	for _, s := range symbols {
+		pkg := ds.targetPackage(pkgs, s.pkg)
+		if pkg == nil {
+			return fmt.Errorf("package %s not found", s.pkg)
+		}
+		obj, err := lookupSymbol(pkg, s)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, obj)
+		// A type is wanted with its methods and constructors
+		if named, ok := obj.Type().(*types.Named); ok && s.method == "" && obj == named.Obj() {
+			for j := 0; j < named.NumMethods(); j++ {
+				queue = append(queue, named.Method(j))
+			}
+			queue = append(queue, constructors(pkg.Types, named)...)
+		}
+	}
+
+	// Walk references from the targets, breadth first
+	depth := map[types.Object]int{}
+	for _, obj := range queue {
+		depth[obj] = 0
+	}
+	needed := map[ast.Decl]int{}
+	for len(queue) > 0 {
+		obj := queue[0]
+		queue = queue[1:]
+		d, ok := decls[obj]
+		if !ok {
+			continue
+		}
+		if _, seen := needed[d.decl]; seen {
+			continue
+		}
+		needed[d.decl] = depth[obj]
+
+		for _, ref := range references(d.pkg.TypesInfo, d.decl) {
+			if _, seen := depth[ref]; !seen {
+				depth[ref] = depth[obj] + 1
+				queue = append(queue, ref)
+			}
+		}
+	}
+
+	// Add each file with its needed declarations in source order
+	pkgOf := map[*ast.File]*packages.Package{}
+	for _, d := range decls {
+		if _, ok := needed[d.decl]; ok {
+			pkgOf[d.file] = d.pkg
+		}
+	}
+	for file, pkg := range pkgOf {
+		var fileDecls []ast.Decl
+		for _, decl := range file.Decls {
+			if _, ok := needed[decl]; ok {
+				fileDecls = append(fileDecls, decl)
+			}
+		}
+		if err := ds.addDeclarations(pkg, file, fileDecls, needed, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetPackage finds the loaded package a pattern named, by import path or
+// by directory
+func (ds *DependencyScanner) targetPackage(pkgs []*packages.Package, pattern string) *packages.Package {
+	dir := filepath.Join(ds.rootPath, filepath.FromSlash(pattern))
+	for _, pkg := range pkgs {
+		if pkg.PkgPath == pattern || (len(pkg.GoFiles) > 0 && filepath.Dir(pkg.GoFiles[0]) == dir) {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// addDeclarations adds the file holding decls, cut down to its package
+// clause, imports and decls with their doc comments
+func (ds *DependencyScanner) addDeclarations(pkg *packages.Package, file *ast.File, decls []ast.Decl, needed map[ast.Decl]int, files map[string]*packedFile) error {
+	filename := pkg.Fset.File(file.Pos()).Name()
+	rel, ok := ds.relPath(filename)
+	if !ok {
+		return nil
+	}
+	// A package target already packs the whole file
+	if f, ok := files[rel]; ok && f.mode == modeFull {
+		return nil
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", rel, err)
+	}
+	offset := func(pos token.Pos) int { return pkg.Fset.Position(pos).Offset }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n", file.Name.Name)
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			fmt.Fprintf(&b, "\n%s\n", src[offset(gen.Pos()):offset(gen.End())])
+		}
+	}
+
+	depth := -1
+	for _, decl := range decls {
+		start := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			start = doc.Pos()
+		}
+		fmt.Fprintf(&b, "\n%s\n", src[offset(start):offset(decl.End())])
+		if depth < 0 || needed[decl] < depth {
+			depth = needed[decl]
+		}
+	}
+
+	files[rel] = &packedFile{
+		relPath:  rel,
+		content:  b.String(),
+		mode:     modeSymbols,
+		priority: ds.config.Priority(rel),
+		depth:    depth,
+	}
+	return nil
+}
+
+// lookupSymbol finds a target in its package
+func lookupSymbol(pkg *packages.Package, s symbolTarget) (types.Object, error) {
+	obj := pkg.Types.Scope().Lookup(s.name)
+	if obj == nil {
+		return nil, fmt.Errorf("%s has no %s", pkg.PkgPath, s.name)
+	}
+	if s.method == "" {
+		return obj, nil
+	}
+
+	method, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg.Types, s.method)
+	if _, ok := method.(*types.Func); !ok {
+		return nil, fmt.Errorf("%s.%s has no method %s", pkg.PkgPath, s.name, s.method)
+	}
+	return method, nil
+}
+
+// constructors returns the package's functions that return a named type
+func constructors(pkg *types.Package, named *types.Named) []types.Object {
+	var funcs []types.Object
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		fn, ok := scope.Lookup(name).(*types.Func)
+		if !ok {
+			continue
+		}
+		results := fn.Type().(*types.Signature).Results()
+		for i := 0; i < results.Len(); i++ {
+			if namedType(results.At(i).Type()) == named {
+				funcs = append(funcs, fn)
+				break
+			}
+		}
+	}
+	return funcs
+}
+
+// declaredNames returns the names a top-level declaration declares
+func declaredNames(decl ast.Decl) []*ast.Ident {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return []*ast.Ident{d.Name}
+	case *ast.GenDecl:
+		var names []*ast.Ident
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, s.Name)
+			case *ast.ValueSpec:
+				names = append(names, s.Names...)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// references returns the objects a declaration uses: the names it refers
+// to, the types whose fields and methods it selects, and for a method, its
+// receiver's type
+func references(info *types.Info, decl ast.Decl) []types.Object {
+	var refs []types.Object
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if obj := info.Uses[n]; obj != nil {
+				refs = append(refs, obj)
+			}
+		case *ast.SelectorExpr:
+			if sel := info.Selections[n]; sel != nil {
+				if named := namedType(sel.Recv()); named != nil {
+					refs = append(refs, named.Obj())
+				}
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+func namedType(t types.Type) *types.Named {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, _ := t.(*types.Named)
+	return named
+}
+
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+	return nil
+}
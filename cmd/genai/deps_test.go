@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSymbolTarget(t *testing.T) {
+	for target, want := range map[string]symbolTarget{
+		"./internal/service.UserService":             {pkg: "./internal/service", name: "UserService"},
+		"./internal/service.UserService.VerifyEmail": {pkg: "./internal/service", name: "UserService", method: "VerifyEmail"},
+		"github.com/acme/app/pkg.Run":                {pkg: "github.com/acme/app/pkg", name: "Run"},
+	} {
+		if got, ok := parseSymbolTarget(target); !ok || got != want {
+			t.Errorf("parseSymbolTarget(%q) = %+v, %v, want %+v", target, got, ok, want)
+		}
+	}
+	for _, target := range []string{"./internal/service", "./...", "github.com/acme/app", "."} {
+		if got, ok := parseSymbolTarget(target); ok {
+			t.Errorf("Expected %q to be a package, got %+v", target, got)
+		}
+	}
+}
+
+func TestDependencyScannerSymbols(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.22\n")
+	write("store/store.go", `package store
+
+// Record is stored
+type Record struct{ ID string }
+
+// Unused isn't referred to
+func Unused() {}
+
+func Find(id string) Record { return Record{ID: id} }
+`)
+	write("api/api.go", `package api
+
+import "example.com/app/store"
+
+type Handler struct{}
+
+// NewHandler creates a Handler
+func NewHandler() *Handler { return &Handler{} }
+
+func (h *Handler) Get(id string) string { return store.Find(id).ID }
+
+func Other() {}
+`)
+
+	cfg := DefaultConfig()
+	if err := cfg.compile(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*packedFile{}
+	ds := NewDependencyScanner(root, cfg, nil)
+	if err := ds.collectSymbols([]symbolTarget{{pkg: "./api", name: "Handler"}}, files); err != nil {
+		t.Fatal(err)
+	}
+
+	api, store := files["api/api.go"], files["store/store.go"]
+	if api == nil || store == nil {
+		t.Fatalf("Expected both files, got %v", files)
+	}
+	for _, want := range []string{"func NewHandler", "func (h *Handler) Get"} {
+		if !strings.Contains(api.content, want) {
+			t.Errorf("Expected %q in:\n%s", want, api.content)
+		}
+	}
+	for _, want := range []string{"// Record is stored", "func Find"} {
+		if !strings.Contains(store.content, want) {
+			t.Errorf("Expected %q in:\n%s", want, store.content)
+		}
+	}
+	if strings.Contains(api.content, "func Other") || strings.Contains(store.content, "func Unused") {
+		t.Errorf("Expected unreferenced declarations to be left out:\n%s\n%s", api.content, store.content)
+	}
+	if api.depth != 0 || store.depth == 0 {
+		t.Errorf("Expected the target nearer than its dependency, got %d and %d", api.depth, store.depth)
+	}
+}
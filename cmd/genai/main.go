@@ -3,117 +3,163 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 )
 
-var scanDir string
-
-// Paths to scan in the Rails application
-var scanPaths = []string{
-	"cmd/api",
-	"internal",
-	"db",
-	"templates",
-	"permissions",
-}
+var (
+	scanDir    string
+	configFile string
+	maxTokens  int
+	targets    string
+)
 
-// DirectoryScanner handles scanning of Rails directories
+// DirectoryScanner packs the files a config selects
 type DirectoryScanner struct {
 	rootPath string
+	config   *Config
 }
 
 // NewDirectoryScanner creates a new scanner instance
-func NewDirectoryScanner(rootPath string) *DirectoryScanner {
+func NewDirectoryScanner(rootPath string, config *Config) *DirectoryScanner {
 	return &DirectoryScanner{
 		rootPath: rootPath,
+		config:   config,
 	}
 }
 
-// ScanDirectories processes all configured paths
+// packedFile is a file as it goes into the pack
+type packedFile struct {
+	relPath  string
+	content  string
+	mode     string
+	priority int
+	// depth is how many imports away from the target a dependency is
+	depth    int
+	redacted int
+}
+
+// ScanDirectories packs the selected files
 func (ds *DirectoryScanner) ScanDirectories() error {
-	if scanDir != "." {
-		fullPath := filepath.Join(ds.rootPath)
-		if _, err := os.Stat(fullPath); err == nil {
-			if err := ds.scanDirectory(fullPath); err != nil {
-				return fmt.Errorf("error scanning directory %s: %w", fullPath, err)
-			}
-		}
-		return nil
+	files, err := ds.collect()
+	if err != nil {
+		return err
 	}
+	writePack(ds.config, files)
+	return nil
+}
 
-	for _, path := range scanPaths {
-		fullPath := filepath.Join(ds.rootPath, path)
+// writePack prints files, highest priority and nearest dependencies first,
+// while they fit the budget, in path order
+func writePack(config *Config, files []*packedFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].priority != files[j].priority {
+			return files[i].priority > files[j].priority
+		}
+		return files[i].depth < files[j].depth
+	})
 
-		if _, err := os.Stat(fullPath); err == nil {
-			if err := ds.scanDirectory(fullPath); err != nil {
-				return fmt.Errorf("error scanning directory %s: %w", fullPath, err)
-			}
+	budget := config.Budget
+	used, redactions := 0, 0
+	var packed []*packedFile
+	var omitted []string
+	for _, f := range files {
+		if budget.MaxFileTokens > 0 && estimateTokens(f.content) > budget.MaxFileTokens {
+			f.content, f.mode = summarize(f.relPath, f.content, budget.MaxFileTokens)
 		}
+		if budget.MaxTokens > 0 && used+estimateTokens(f.content) > budget.MaxTokens && f.mode != modeSummary && f.mode != modeTruncated {
+			f.content, f.mode = summarize(f.relPath, f.content, 0)
+		}
+		if budget.MaxTokens > 0 && used+estimateTokens(f.content) > budget.MaxTokens {
+			omitted = append(omitted, f.relPath)
+			continue
+		}
+
+		used += estimateTokens(f.content)
+		redactions += f.redacted
+		packed = append(packed, f)
+	}
+
+	sort.Slice(packed, func(i, j int) bool { return packed[i].relPath < packed[j].relPath })
+	for _, f := range packed {
+		if f.mode == modeFull {
+			fmt.Printf("<file filename=\"%s\">\n", f.relPath)
+		} else {
+			fmt.Printf("<file filename=\"%s\" mode=\"%s\">\n", f.relPath, f.mode)
+		}
+		fmt.Printf("%s\n", strings.TrimSpace(f.content))
+		fmt.Printf("</file>\n\n")
+	}
+
+	if len(omitted) > 0 {
+		sort.Strings(omitted)
+		fmt.Printf("<!-- Omitted to fit the token budget: %s -->\n", strings.Join(omitted, ", "))
+	}
+	if budget.MaxTokens > 0 {
+		fmt.Printf("<!-- About %d of %d tokens used -->\n", used, budget.MaxTokens)
+	}
+	if redactions > 0 {
+		fmt.Printf("<!-- %d secrets redacted -->\n", redactions)
 	}
-	return nil
 }
 
-// scanDirectory processes a single directory and its subdirectories
-func (ds *DirectoryScanner) scanDirectory(path string) error {
-	var files []string
+// collect reads and redacts the files the config selects
+func (ds *DirectoryScanner) collect() ([]*packedFile, error) {
+	var files []*packedFile
 
-	// Finds all .rb files in the directory and subdirectories
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+	err := filepath.WalkDir(ds.rootPath, func(filePath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-
-		if info.IsDir() && (strings.Contains(info.Name(), "node_modules") || strings.Contains(info.Name(), ".next")) {
-			return filepath.SkipDir
-		}
-
-		if !info.IsDir() && (strings.Contains(info.Name(), "package-lock.json") || strings.Contains(info.Name(), "yarn.lock")) {
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		if !info.IsDir() && (strings.HasSuffix(filePath, ".go") || strings.HasSuffix(filePath, ".json") || strings.HasSuffix(filePath, ".tsx") || strings.HasSuffix(filePath, ".ts") || strings.HasSuffix(filePath, ".jsx") || strings.HasSuffix(filePath, ".js") || strings.HasSuffix(filePath, ".yml") || strings.HasSuffix(filePath, ".perm") || strings.HasSuffix(filePath, ".tmpl")) {
-			files = append(files, filePath)
-		}
-		return nil
-	})
-	if err != nil {
-		return fmt.Errorf("error walking directory %s: %w", path, err)
-	}
-
-	// Sorts files for consistent output
-	sort.Strings(files)
-
-	// Processes each file
-	for _, file := range files {
-		content, err := os.ReadFile(file)
+		relPath, err := filepath.Rel(ds.rootPath, filePath)
 		if err != nil {
-			fmt.Printf("<!-- Error reading %s: %s -->\n", file, err)
-			continue
+			fmt.Printf("<!-- Error getting relative path for %s: %s -->\n", filePath, err)
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+		if !ds.config.Selected(relPath) {
+			return nil
 		}
 
-		relPath, err := filepath.Rel(ds.rootPath, file)
+		content, err := os.ReadFile(filePath)
 		if err != nil {
-			fmt.Printf("<!-- Error getting relative path for %s: %s -->\n", file, err)
-			continue
+			fmt.Printf("<!-- Error reading %s: %s -->\n", relPath, err)
+			return nil
 		}
 
-		fmt.Printf("<file filename=\"%s\">\n", relPath)
-		fmt.Printf("%s\n", strings.TrimSpace(string(content)))
-		fmt.Printf("</file>\n\n")
+		f := &packedFile{relPath: relPath, mode: modeFull, priority: ds.config.Priority(relPath)}
+		f.content, f.redacted = redact(string(content), ds.config.redactors)
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory %s: %w", ds.rootPath, err)
 	}
 
-	return nil
+	// Walk visits files in lexical order, so equal priorities keep it
+	return files, nil
 }
 
 func init() {
 	flag.StringVar(&scanDir, "dir", ".", "Directory to scan")
-	flag.Parse()
+	flag.StringVar(&configFile, "config", "", "Config file of include/exclude globs, priorities, redaction and budget (default <dir>/"+defaultConfigFile+")")
+	flag.IntVar(&maxTokens, "max-tokens", 0, "Token budget for the whole pack, overriding the config's")
+	flag.StringVar(&targets, "target", "", "Comma-separated packages (./internal/handler) or symbols (./internal/service.UserService) to pack the Go dependencies of, instead of scanning directories")
 }
 
 func main() {
+	flag.Parse()
+
 	// Gets the current working directory
 	currentDir, err := os.Getwd()
 	if err != nil {
@@ -125,7 +171,37 @@ func main() {
 		currentDir = scanDir
 	}
 
-	scanner := NewDirectoryScanner(currentDir)
+	file, required := configFile, configFile != ""
+	if !required {
+		file = filepath.Join(currentDir, defaultConfigFile)
+	}
+	defaults := DefaultConfig()
+	if scanDir != "." {
+		// A directory named with -dir is packed whole unless configured
+		defaults.Include = []string{"**"}
+	}
+	config, err := LoadConfig(file, required, defaults)
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err)
+		os.Exit(1)
+	}
+	if maxTokens > 0 {
+		config.Budget.MaxTokens = maxTokens
+	}
+
+	if targets != "" {
+		scanner := NewDependencyScanner(currentDir, config, strings.Split(targets, ","))
+
+		fmt.Printf("<!-- Generated Go Dependencies of %s -->\n", targets)
+		if err := scanner.Scan(); err != nil {
+			fmt.Printf("Error scanning dependencies: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("<!-- End of Go Dependencies -->")
+		return
+	}
+
+	scanner := NewDirectoryScanner(currentDir, config)
 
 	fmt.Println("<!-- Generated Go Directory Structure -->")
 	if err := scanner.ScanDirectories(); err != nil {
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/dangerclosesec/supra/internal/cli"
+
+func main() {
+	cli.Execute()
+}
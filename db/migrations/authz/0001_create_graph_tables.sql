@@ -0,0 +1,52 @@
+-- +goose Up
+-- Core identity graph. IF NOT EXISTS lets databases bootstrapped before
+-- versioned migrations adopt this history without changes.
+CREATE TABLE IF NOT EXISTS entity_types (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS entities (
+    id SERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    properties JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(type, external_id)
+);
+
+CREATE TABLE IF NOT EXISTS relations (
+    id BIGSERIAL PRIMARY KEY,
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    object_type TEXT NOT NULL,
+    object_id TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(subject_type, subject_id, relation, object_type, object_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_relations_subject ON relations(subject_type, subject_id);
+CREATE INDEX IF NOT EXISTS idx_relations_object ON relations(object_type, object_id);
+CREATE INDEX IF NOT EXISTS idx_relations_relation ON relations(relation);
+CREATE INDEX IF NOT EXISTS idx_entities_properties ON entities USING GIN (properties);
+
+CREATE TABLE IF NOT EXISTS permission_definitions (
+    id SERIAL PRIMARY KEY,
+    entity_type TEXT NOT NULL,
+    permission_name TEXT NOT NULL,
+    condition_expression TEXT NOT NULL,
+    description TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(entity_type, permission_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_entity_type_name ON permission_definitions(entity_type);
+
+-- +goose Down
+DROP TABLE IF EXISTS permission_definitions;
+DROP TABLE IF EXISTS relations;
+DROP TABLE IF EXISTS entities;
+DROP TABLE IF EXISTS entity_types;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Reusable rules referenced from permission conditions
+CREATE TABLE IF NOT EXISTS rule_definitions (
+    id SERIAL PRIMARY KEY,
+    rule_name TEXT NOT NULL UNIQUE,
+    parameters JSONB NOT NULL,
+    expression TEXT NOT NULL,
+    description TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS rule_definitions;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- History of permission models applied with the permify tool
+CREATE TABLE IF NOT EXISTS permission_versions (
+    id SERIAL PRIMARY KEY,
+    version INT NOT NULL,
+    description TEXT,
+    source_file TEXT,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS migration_history (
+    id SERIAL PRIMARY KEY,
+    version INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    success BOOLEAN NOT NULL,
+    errors TEXT,
+    diff TEXT
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS migration_history;
+DROP TABLE IF EXISTS permission_versions;
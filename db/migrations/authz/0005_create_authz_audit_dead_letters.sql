@@ -0,0 +1,12 @@
+-- +goose Up
+-- Audit entries the database rejected, kept for inspection instead of being
+-- retried forever
+CREATE TABLE IF NOT EXISTS authz_audit_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    payload JSONB NOT NULL,
+    error TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS authz_audit_dead_letters;
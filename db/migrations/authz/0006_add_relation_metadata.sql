@@ -0,0 +1,6 @@
+-- +goose Up
+-- Provenance for each grant (granted_by, reason, ticket, source system)
+ALTER TABLE relations ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE relations DROP COLUMN IF EXISTS metadata;
@@ -0,0 +1,70 @@
+-- +goose Up
+-- Every value an entity attribute has held, with the range it was valid for.
+-- Rows are written by a trigger on entities so no writer can bypass it;
+-- valid_to is NULL for the current value.
+CREATE TABLE IF NOT EXISTS entity_attribute_history (
+    id BIGSERIAL PRIMARY KEY,
+    entity_type TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    attribute TEXT NOT NULL,
+    value JSONB NOT NULL,
+    valid_from TIMESTAMPTZ NOT NULL,
+    valid_to TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_entity_attribute_history_lookup
+    ON entity_attribute_history(entity_type, entity_id, attribute, valid_from DESC);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_entity_attribute_history() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO entity_attribute_history (entity_type, entity_id, attribute, value, valid_from)
+        SELECT NEW.type, NEW.external_id, p.key, p.value, now()
+        FROM jsonb_each(NEW.properties) p;
+        RETURN NEW;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        UPDATE entity_attribute_history
+        SET valid_to = now()
+        WHERE entity_type = OLD.type AND entity_id = OLD.external_id AND valid_to IS NULL;
+        RETURN OLD;
+    END IF;
+
+    -- UPDATE: close the ranges of changed or removed attributes, then open
+    -- ranges for the new values
+    UPDATE entity_attribute_history h
+    SET valid_to = now()
+    WHERE h.entity_type = OLD.type AND h.entity_id = OLD.external_id AND h.valid_to IS NULL
+      AND (NEW.properties -> h.attribute IS DISTINCT FROM h.value
+           OR NEW.type <> OLD.type OR NEW.external_id <> OLD.external_id);
+
+    INSERT INTO entity_attribute_history (entity_type, entity_id, attribute, value, valid_from)
+    SELECT NEW.type, NEW.external_id, p.key, p.value, now()
+    FROM jsonb_each(NEW.properties) p
+    WHERE OLD.properties -> p.key IS DISTINCT FROM p.value
+       OR NEW.type <> OLD.type OR NEW.external_id <> OLD.external_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS entities_attribute_history ON entities;
+CREATE TRIGGER entities_attribute_history
+    AFTER INSERT OR UPDATE OF type, external_id, properties OR DELETE ON entities
+    FOR EACH ROW EXECUTE FUNCTION record_entity_attribute_history();
+
+-- Existing attributes start their history at the entity's last update
+INSERT INTO entity_attribute_history (entity_type, entity_id, attribute, value, valid_from)
+SELECT e.type, e.external_id, p.key, p.value, e.updated_at
+FROM entities e, jsonb_each(e.properties) p
+WHERE NOT EXISTS (
+    SELECT 1 FROM entity_attribute_history h
+    WHERE h.entity_type = e.type AND h.entity_id = e.external_id AND h.attribute = p.key
+);
+
+-- +goose Down
+DROP TRIGGER IF EXISTS entities_attribute_history ON entities;
+DROP FUNCTION IF EXISTS record_entity_attribute_history();
+DROP TABLE IF EXISTS entity_attribute_history;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Replicas of the authz service register and heartbeat here so they can see
+-- each other
+CREATE TABLE IF NOT EXISTS authz_cluster_members (
+    id TEXT PRIMARY KEY,
+    hostname TEXT NOT NULL,
+    listen_addr TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Named leases elect the single replica that runs a background job; a lease
+-- whose holder stops renewing it expires and can be taken over
+CREATE TABLE IF NOT EXISTS authz_cluster_leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS authz_cluster_leases;
+DROP TABLE IF EXISTS authz_cluster_members;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Relations implied by an entity's attributes, declared in the schema as
+-- "relation viewer @user:* when public". Checks evaluate them on the fly, so
+-- no tuples are written and they follow attribute changes immediately.
+CREATE TABLE IF NOT EXISTS derived_relations (
+    id BIGSERIAL PRIMARY KEY,
+    entity_type TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    attribute TEXT NOT NULL,
+    -- NULL when the attribute only has to be truthy
+    value JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (entity_type, relation, subject_type, attribute)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS derived_relations;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Chains audit rows so tampering is detectable: each row's hash covers its
+-- contents, its position and the previous row's hash. Rows written before
+-- this migration stay unchained.
+ALTER TABLE authz_audit_logs ADD COLUMN IF NOT EXISTS chain_seq BIGINT;
+ALTER TABLE authz_audit_logs ADD COLUMN IF NOT EXISTS prev_hash TEXT;
+ALTER TABLE authz_audit_logs ADD COLUMN IF NOT EXISTS hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_authz_audit_logs_chain_seq ON authz_audit_logs (chain_seq);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_authz_audit_logs_chain_seq;
+ALTER TABLE authz_audit_logs DROP COLUMN IF EXISTS hash;
+ALTER TABLE authz_audit_logs DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE authz_audit_logs DROP COLUMN IF EXISTS chain_seq;
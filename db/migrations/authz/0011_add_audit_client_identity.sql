@@ -0,0 +1,10 @@
+-- +goose Up
+-- client_ip holds the client resolved through trusted proxies; remote_addr
+-- keeps the address the connection came from, usually the load balancer,
+-- and client_cert who a verified TLS client certificate names
+ALTER TABLE authz_audit_logs ADD COLUMN IF NOT EXISTS remote_addr TEXT;
+ALTER TABLE authz_audit_logs ADD COLUMN IF NOT EXISTS client_cert TEXT;
+
+-- +goose Down
+ALTER TABLE authz_audit_logs DROP COLUMN IF EXISTS client_cert;
+ALTER TABLE authz_audit_logs DROP COLUMN IF EXISTS remote_addr;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Background jobs submitted to the authz service. Any replica may run a
+-- queued job; the one running it heartbeats so others can take over a job
+-- whose replica stopped.
+CREATE TABLE IF NOT EXISTS authz_jobs (
+    id UUID PRIMARY KEY,
+    kind TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    params JSONB NOT NULL DEFAULT '{}',
+    progress_done BIGINT NOT NULL DEFAULT 0,
+    progress_total BIGINT NOT NULL DEFAULT 0,
+    result BYTEA,
+    result_type TEXT,
+    result_filename TEXT,
+    error TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    worker TEXT,
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    heartbeat_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_authz_jobs_status_created ON authz_jobs (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_authz_jobs_finished ON authz_jobs (finished_at) WHERE finished_at IS NOT NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS authz_jobs;
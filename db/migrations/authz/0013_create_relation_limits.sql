@@ -0,0 +1,14 @@
+-- +goose Up
+-- Caps on how many subjects may hold a relation on one entity, declared in
+-- the schema as "relation owner @user max 1" and enforced when relations
+-- are written
+CREATE TABLE IF NOT EXISTS relation_limits (
+    entity_type TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    max_subjects INT NOT NULL CHECK (max_subjects > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (entity_type, relation)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS relation_limits;
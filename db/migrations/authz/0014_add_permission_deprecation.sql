@@ -0,0 +1,16 @@
+-- +goose Up
+-- Permissions marked @deprecated in the schema keep working; the column
+-- holds the annotation's message, empty when it has none, and is NULL for
+-- permissions that aren't deprecated
+ALTER TABLE permission_definitions ADD COLUMN IF NOT EXISTS deprecated TEXT;
+
+-- Checks of deprecated permissions are always recorded, so the callers
+-- still relying on one can be found before it is removed
+ALTER TABLE authz_audit_logs ADD COLUMN IF NOT EXISTS deprecated BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_authz_audit_logs_deprecated
+    ON authz_audit_logs (entity_type, permission, timestamp) WHERE deprecated;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_authz_audit_logs_deprecated;
+ALTER TABLE authz_audit_logs DROP COLUMN IF EXISTS deprecated;
+ALTER TABLE permission_definitions DROP COLUMN IF EXISTS deprecated;
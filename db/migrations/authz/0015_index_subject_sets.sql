@@ -0,0 +1,10 @@
+-- +goose Up
+-- A relation's subject may be a subject set, written type:id#relation with
+-- the "id#relation" part in subject_id, e.g. (group, eng#member, viewer,
+-- document, d1) for the members of group eng. Checks look up the sets
+-- granted a relation on an object whenever no tuple names the subject.
+CREATE INDEX IF NOT EXISTS idx_relations_subject_sets
+    ON relations (object_type, object_id, relation) WHERE subject_id LIKE '%#%';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_relations_subject_sets;
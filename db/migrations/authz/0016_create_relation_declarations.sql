@@ -0,0 +1,14 @@
+-- +goose Up
+-- The relations the schema declares on each entity type and the subject
+-- types they take, e.g. (document, viewer, user) for
+-- "relation viewer @user". Relation writes are validated against them.
+CREATE TABLE IF NOT EXISTS relation_declarations (
+    entity_type TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (entity_type, relation, subject_type)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS relation_declarations;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- The attributes the schema declares on each entity type and their data
+-- types, e.g. (document, public, boolean) for "attribute public boolean".
+CREATE TABLE IF NOT EXISTS attribute_declarations (
+    entity_type TEXT NOT NULL,
+    attribute TEXT NOT NULL,
+    data_type TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (entity_type, attribute)
+);
+
+-- Declared attributes of entities, kept apart from the untyped properties.
+-- Exactly the column of the attribute's data type is set; arrays are
+-- stored as JSON arrays whose elements are checked when written.
+CREATE TABLE IF NOT EXISTS entity_attributes (
+    entity_type TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    attribute TEXT NOT NULL,
+    data_type TEXT NOT NULL CHECK (data_type IN (
+        'boolean', 'boolean[]', 'string', 'string[]',
+        'integer', 'integer[]', 'double', 'double[]')),
+    bool_value BOOLEAN,
+    int_value BIGINT,
+    double_value DOUBLE PRECISION,
+    string_value TEXT,
+    array_value JSONB CHECK (jsonb_typeof(array_value) = 'array'),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (entity_type, entity_id, attribute),
+    FOREIGN KEY (entity_type, entity_id) REFERENCES entities(type, external_id)
+        ON UPDATE CASCADE ON DELETE CASCADE,
+    CHECK (num_nonnulls(bool_value, int_value, double_value, string_value, array_value) = 1),
+    CHECK ((data_type = 'boolean') = (bool_value IS NOT NULL)),
+    CHECK ((data_type = 'integer') = (int_value IS NOT NULL)),
+    CHECK ((data_type = 'double') = (double_value IS NOT NULL)),
+    CHECK ((data_type = 'string') = (string_value IS NOT NULL))
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS entity_attributes;
+DROP TABLE IF EXISTS attribute_declarations;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Rules a tenant defines for its own entities. A tenant rule is used in
+-- place of the schema's rule of the same name when the object of a check
+-- belongs to the tenant, and is never seen by other tenants.
+CREATE TABLE IF NOT EXISTS tenant_rules (
+    tenant_id TEXT NOT NULL,
+    rule_name TEXT NOT NULL,
+    parameters JSONB NOT NULL,
+    expression TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, rule_name)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS tenant_rules;
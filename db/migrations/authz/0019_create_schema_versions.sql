@@ -0,0 +1,14 @@
+-- +goose Up
+-- Immutable snapshots of the permission model: the permission definitions
+-- and rules as they stood after each change. Checks pinned to a version
+-- evaluate against its snapshot instead of the live tables.
+CREATE TABLE IF NOT EXISTS schema_versions (
+    version INT PRIMARY KEY,
+    permissions JSONB NOT NULL,
+    rules JSONB NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS schema_versions;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- The schema version each migration left the database at, so a permission
+-- model version can be restored from its snapshot. Versions recorded before
+-- this column have no snapshot and can't be rolled back to.
+ALTER TABLE permission_versions ADD COLUMN IF NOT EXISTS schema_version INT REFERENCES schema_versions (version);
+
+-- +goose Down
+ALTER TABLE permission_versions DROP COLUMN IF EXISTS schema_version;
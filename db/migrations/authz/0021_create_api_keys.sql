@@ -0,0 +1,25 @@
+-- +goose Up
+-- API keys issued through /api/api-keys. Only a SHA-256 hash of each key is
+-- kept; prefix is its first characters, to tell keys apart in listings. A
+-- revoked key's name can be issued again.
+CREATE TABLE IF NOT EXISTS authz_api_keys (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    scope TEXT NOT NULL CHECK (scope IN ('read', 'write', 'admin')),
+    key_hash TEXT NOT NULL UNIQUE,
+    prefix TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_authz_api_keys_active_name
+    ON authz_api_keys (name) WHERE revoked_at IS NULL;
+
+-- api_key names the key each audited request authenticated with
+ALTER TABLE authz_audit_logs ADD COLUMN IF NOT EXISTS api_key TEXT;
+
+-- +goose Down
+ALTER TABLE authz_audit_logs DROP COLUMN IF EXISTS api_key;
+DROP TABLE IF EXISTS authz_api_keys;
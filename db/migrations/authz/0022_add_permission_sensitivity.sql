@@ -0,0 +1,9 @@
+-- +goose Up
+-- Permissions marked @sensitive in the schema, such as break-glass access,
+-- notify the configured webhook or SIEM log whenever a check allows them;
+-- the column holds the annotation's label, empty when it has none, and is
+-- NULL for permissions that aren't sensitive
+ALTER TABLE permission_definitions ADD COLUMN IF NOT EXISTS sensitive TEXT;
+
+-- +goose Down
+ALTER TABLE permission_definitions DROP COLUMN IF EXISTS sensitive;
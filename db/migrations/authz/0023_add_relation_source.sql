@@ -0,0 +1,10 @@
+-- +goose Up
+-- What wrote each relation: manual for API calls that don't say, or a
+-- system such as scim, entity-sync or import:batch-42. Indexed so a bad
+-- import or a decommissioned integration can be listed and revoked at once.
+ALTER TABLE relations ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'manual';
+CREATE INDEX IF NOT EXISTS idx_relations_source ON relations(source, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_relations_source;
+ALTER TABLE relations DROP COLUMN IF EXISTS source;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Users own their own profile (user#owner@user), which /factors checks as
+-- manage_profile. Entity sync writes the relation for users it syncs from
+-- now on; this adds it for the users already in the graph, tagged as entity
+-- sync's like the rest. Users not yet synced get it on the next reconcile.
+INSERT INTO relations (subject_type, subject_id, relation, object_type, object_id, source)
+SELECT 'user', external_id, 'owner', 'user', external_id, 'entity-sync'
+FROM entities
+WHERE type = 'user'
+ON CONFLICT DO NOTHING;
+
+-- +goose Down
+-- The relations are left in place: entity sync writes them for every user
+-- regardless, so removing them would only revoke access until it ran again.
@@ -0,0 +1,31 @@
+// Package migrations embeds the versioned SQL migrations for the supra
+// databases so they ship inside the binaries.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed postgres/*.sql authz/*.sql
+var files embed.FS
+
+// API returns the migrations for the application database (users,
+// organizations, factors and related tables)
+func API() fs.FS {
+	return mustSub("postgres")
+}
+
+// Authz returns the migrations for the authorization graph database (entities,
+// relations, permission and rule definitions, audit logs)
+func Authz() fs.FS {
+	return mustSub("authz")
+}
+
+func mustSub(dir string) fs.FS {
+	sub, err := fs.Sub(files, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
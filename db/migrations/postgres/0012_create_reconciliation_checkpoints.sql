@@ -0,0 +1,13 @@
+-- +goose Up
+-- Tracks reconciliation progress per entity type so interrupted runs can resume
+CREATE TABLE reconciliation_checkpoints (
+    entity_type TEXT PRIMARY KEY,
+    last_id UUID NOT NULL,
+    processed BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS reconciliation_checkpoints;
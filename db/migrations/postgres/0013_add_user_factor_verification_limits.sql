@@ -0,0 +1,10 @@
+-- +goose Up
+-- Verification factors expire and lock after too many invalid attempts
+ALTER TABLE user_factors
+    ADD COLUMN expires_at TIMESTAMP,
+    ADD COLUMN failed_attempts INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE user_factors
+    DROP COLUMN IF EXISTS failed_attempts,
+    DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,356 @@
+// Package apiserver implements the identity API: signup, login, factors and
+// organization management.
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/database"
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/dangerclosesec/supra/internal/email"
+	"github.com/dangerclosesec/supra/internal/handler"
+	"github.com/dangerclosesec/supra/internal/lifecycle"
+	"github.com/dangerclosesec/supra/internal/middleware"
+	"github.com/dangerclosesec/supra/internal/migrate"
+	"github.com/dangerclosesec/supra/internal/repository"
+	"github.com/dangerclosesec/supra/internal/secrets"
+	"github.com/dangerclosesec/supra/internal/service"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+)
+
+// Run starts the API server with an already loaded and validated configuration
+// and serves until ctx is cancelled
+func Run(ctx context.Context, cfg *config.Config, secretManager *secrets.Manager, logger *slog.Logger) error {
+	// Initialize database; /metrics reports its queries by route
+	queries := dbtrace.New(dbtrace.Options{
+		Database:      "api",
+		SlowThreshold: cfg.Database.SlowQueryThreshold.Std(),
+		LogQueries:    cfg.Database.LogQueries,
+	})
+	db, err := database.Open(cfg, secretManager, queries)
+	if err != nil {
+		return fmt.Errorf("setting up database: %w", err)
+	}
+
+	// Initialize repositories
+	userRepo := repository.NewUserRepository(db)
+	factorRepo := repository.NewUserFactorRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+	auditLogRepo := repository.NewAuthzAuditLogRepository(db)
+
+	// Initialize auth services
+	passwordHasher := auth.NewPasswordHasher()
+	tokenManager := auth.NewTokenManager(cfg.JWT.Secret, cfg.JWT.ExpiryPeriod.Std())
+
+	// Verification links are signed with their own secret when one is set
+	verificationSecret, verificationSecretName := cfg.Verification.Secret, config.SecretVerification
+	if verificationSecret == "" {
+		verificationSecret, verificationSecretName = cfg.JWT.Secret, config.SecretJWT
+	}
+	verificationTokens := auth.NewVerificationTokenManager(verificationSecret, cfg.Verification.TokenTTL.Std())
+
+	// Initialize email service
+	emailService, err := email.NewEmailService(cfg, email.ProviderSendgrid)
+	if err != nil {
+		return fmt.Errorf("initializing email service: %w", err)
+	}
+
+	// Apply rotated signing and email credentials without a restart
+	secretManager.OnRotate(config.SecretJWT, tokenManager.Rotate)
+	secretManager.OnRotate(verificationSecretName, verificationTokens.Rotate)
+	secretManager.OnRotate(config.SecretSendgridAPIKey, emailService.SetSendgridAPIKey)
+
+	// Initialize cache service
+	config := service.CacheConfig{
+		TTL:         5 * time.Minute,
+		CleanupFreq: 1 * time.Minute,
+	}
+	cacheService := service.NewCacheService(config)
+	defer cacheService.Close()
+
+	// Initialize factor service
+	userFactorService := service.NewUserFactorService(factorRepo)
+
+	// Initialize audit log service
+	auditLogService := service.NewAuthzAuditLogService(auditLogRepo)
+
+	// Initialize permission and entity sync services
+	supraService, err := auth.NewSupraService(
+		cfg.Supra.Host,
+		auth.WithAuditLogger(auditLogService),
+	)
+	if err != nil {
+		return fmt.Errorf("initializing supra service: %w", err)
+	}
+
+	// Initialize entity sync service
+	entitySyncService := service.NewEntitySyncService(supraService)
+
+	// Sync registered models to the permission graph automatically on write
+	syncQueue := service.NewSyncQueue(entitySyncService, service.DefaultSyncQueueConfig(), logger)
+	syncQueue.Start()
+	defer syncQueue.Stop()
+
+	if err := db.Use(service.NewSyncPlugin(syncQueue, logger)); err != nil {
+		return fmt.Errorf("registering entity sync plugin: %w", err)
+	}
+
+	// Initialize and start reconciliation service
+	reconciliationService := service.NewEntityReconciliationService(
+		userRepo,
+		orgRepo,
+		entitySyncService,
+		60*time.Minute, // Run reconciliation every hour
+		logger,
+	)
+	reconciliationService.SetCheckpointStore(repository.NewReconciliationCheckpointRepository(db))
+	reconciliationService.Start()
+	defer reconciliationService.Stop()
+
+	// Initialize user service
+	userService := service.NewUserService(
+		userRepo,
+		factorRepo,
+		orgRepo,
+		passwordHasher,
+		tokenManager,
+		verificationTokens,
+		emailService,
+		userFactorService,
+		cacheService,
+		cfg,
+	)
+
+	// Initialize handlers
+	authHandler := handler.NewAuthHandler(userService, cacheService)
+	userFactorHandler := handler.NewUserFactorHandler(userFactorService)
+	organizationHandler := handler.NewOrganizationHandler(service.NewOrganizationService(orgRepo))
+	tokenExchangeHandler := handler.NewTokenExchangeHandler(
+		service.NewTokenExchangeService(orgRepo, supraService, tokenManager, cfg.JWT.OrgTokenExpiryPeriod.Std()),
+	)
+
+	// Create router
+	r := chi.NewRouter()
+
+	// Basic middleware stack
+	r.Use(chimw.RequestID)
+	r.Use(chimw.RealIP)
+	r.Use(queryLabelMiddleware)
+	r.Use(loggingMiddleware(logger))
+	r.Use(recoveryMiddleware(logger))
+	r.Use(chimw.Timeout(30 * time.Second))
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", middleware.IdempotencyKeyHeader},
+		ExposedHeaders:   []string{"Link", middleware.IdempotentReplayedHeader},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	// Health check endpoint; it fails once shutdown begins so traffic
+	// drains away first
+	var drain lifecycle.Drainer
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if drain.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"draining"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"healthy"}`))
+	})
+
+	// Build and migration version, for platform tooling
+	r.Method(http.MethodGet, "/version", lifecycle.VersionHandler("api", func(ctx context.Context, info *lifecycle.Info) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		info.DatabaseVersion, err = migrate.CurrentVersion(ctx, sqlDB, migrate.TargetAPI)
+		return err
+	}))
+
+	// Database queries by route and the verification funnel, for Prometheus
+	r.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		queries.WriteMetrics(w)
+		userService.VerificationMetrics().WriteMetrics(w)
+	})
+
+	// API routes
+	r.Route("/api", func(r chi.Router) {
+		// Public routes
+		r.Route("/auth", func(r chi.Router) {
+			r.With(middleware.ValidateQuery[service.VerifyInput]()).
+				Get("/signup/verify", authHandler.VerifyHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(chimw.AllowContentType("application/json"))
+
+				// Auth routes
+				// Signups can be retried with an Idempotency-Key, and both
+				// signups and logins take a single-use nonce from the GET
+				r.Get("/signup", authHandler.SignupHandler)
+				r.With(
+					middleware.Idempotency(cacheService),
+					middleware.ValidateQuery[handler.SignupQuery](),
+					middleware.ValidateJSON[service.SignupInput](),
+				).Post("/signup", authHandler.SignupHandler)
+				r.Get("/login", authHandler.LoginHandler)
+				r.With(middleware.ValidateQuery[handler.LoginQuery](), middleware.ValidateJSON[service.LoginInput]()).
+					Post("/login", authHandler.LoginHandler)
+				r.With(middleware.ValidateJSON[service.ResendVerificationInput]()).
+					Post("/verify/resend", authHandler.ResendVerificationHandler)
+
+				// Trade a user token for one scoped to an organization
+				r.With(middleware.AuthMiddleware(tokenManager), middleware.ValidateJSON[service.TokenExchangeInput]()).
+					Post("/token/exchange", tokenExchangeHandler.Exchange)
+			})
+
+		})
+
+		// Protected routes; org-scoped tokens only reach the routes of
+		// their organization
+		r.Group(func(r chi.Router) {
+			r.Use(chimw.AllowContentType("application/json"))
+			r.Use(middleware.DecisionCacheMiddleware)
+
+			// User factor routes
+			r.Route("/factors", func(r chi.Router) {
+				r.Use(middleware.AuthMiddleware(tokenManager))
+				r.Use(middleware.RequirePermission(supraService, "manage_profile", middleware.CurrentUserObject))
+
+				r.Get("/", userFactorHandler.ListFactors)
+				r.With(middleware.ValidateJSON[handler.CreateFactorRequest]()).
+					Post("/", userFactorHandler.CreateFactor)
+				r.With(middleware.ValidateJSON[handler.VerifyFactorRequest]()).
+					Post("/{id}/verify", userFactorHandler.VerifyFactor)
+				r.Delete("/{id}", userFactorHandler.RemoveFactor)
+			})
+
+			// Organization management routes
+			r.Route("/organizations/{orgID}", func(r chi.Router) {
+				r.Use(middleware.AuthMiddleware(tokenManager, middleware.AllowOrganizationTokens("orgID")))
+				orgObject := middleware.URLParamObject("organization", "orgID")
+
+				r.With(middleware.RequirePermission(supraService, "view", orgObject)).
+					Get("/", organizationHandler.GetOrganization)
+				r.With(middleware.RequirePermission(supraService, "manage_users", orgObject)).
+					Get("/members", organizationHandler.ListMembers)
+			})
+		})
+	})
+
+	// Create server
+	srv := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           r,
+		ReadTimeout:       cfg.Server.ReadTimeout.Std(),
+		WriteTimeout:      cfg.Server.WriteTimeout.Std(),
+		IdleTimeout:       120 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Server error channel
+	serverErrors := make(chan error, 1)
+
+	// Start server
+	go func() {
+		logger.Info("server starting", "port", cfg.Server.Port)
+		serverErrors <- srv.ListenAndServe()
+	}()
+
+	// Wait for shutdown or error
+	select {
+	case err := <-serverErrors:
+		return fmt.Errorf("server error: %w", err)
+
+	case <-ctx.Done():
+		logger.Info("shutdown started", "drain", cfg.Shutdown.Delay.Std(), "timeout", cfg.Shutdown.Timeout.Std())
+
+		// Keep serving while load balancers notice the failing health
+		// check, then give outstanding requests a deadline for completion
+		if err := drain.Shutdown(cfg.Shutdown.Delay.Std(), cfg.Shutdown.Timeout.Std(), srv.Shutdown); err != nil {
+			// If shutdown times out, forcefully close
+			srv.Close()
+			return fmt.Errorf("could not stop server gracefully: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// queryLabelMiddleware attributes the database queries of a request to its
+// method and route pattern, e.g. GET /api/organizations/{orgID}/members. The
+// pattern is read when a query runs, since chi completes it while routing.
+func queryLabelMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := dbtrace.WithLabelFunc(r.Context(), func() string {
+			rctx := chi.RouteContext(r.Context())
+			if rctx == nil || rctx.RoutePattern() == "" {
+				return ""
+			}
+			return r.Method + " " + rctx.RoutePattern()
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func loggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				logger.Info("request completed",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"duration", time.Since(start),
+					"status", ww.Status(),
+					"size", ww.BytesWritten(),
+					"requestID", chimw.GetReqID(r.Context()),
+				)
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+func recoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rvr := recover(); rvr != nil {
+					err := errors.New("panic recovered")
+					logger.Error("panic recovered",
+						"error", err,
+						"panic", rvr,
+						"stack", string(debug.Stack()),
+						"requestID", chimw.GetReqID(r.Context()),
+					)
+
+					// http.Error(w, map[string], http.StatusInternalServerError)
+					w.Write([]byte("{\"error\":\"error encountered\"}"))
+					return
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -4,6 +4,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -12,6 +13,10 @@ import (
 	"github.com/dangerclosesec/supra/sdk/client"
 )
 
+// relationSource tags the relations the services write as users and
+// organizations change, so they can be told apart from manual grants
+const relationSource = "entity-sync"
+
 // Entity represents a permission entity
 type Entity struct {
 	Type string
@@ -96,7 +101,7 @@ func (s *SupraService) WriteEntityAttributes(ctx context.Context, entityType, en
 		Properties: attributes,
 	}
 
-	_, err := s.client.CreateEntity(ctx, req)
+	_, err := s.client.UpsertEntity(ctx, req)
 
 	// Log the operation
 	if err == nil {
@@ -106,7 +111,33 @@ func (s *SupraService) WriteEntityAttributes(ctx context.Context, entityType, en
 	return err
 }
 
-// WriteRelationship creates a relationship between two entities
+// EntityAttributes returns an entity's attributes in the permission system,
+// reporting false when the entity isn't there
+func (s *SupraService) EntityAttributes(ctx context.Context, entityType, entityID string) (map[string]interface{}, bool, error) {
+	entity, err := s.client.GetEntity(ctx, entityType, entityID)
+	if err != nil {
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return entity.Properties, true, nil
+}
+
+// SyncedRelations returns the relations on object that the services wrote,
+// leaving out grants made by hand or by other sources
+func (s *SupraService) SyncedRelations(ctx context.Context, object Entity) ([]client.RelationResponse, error) {
+	return s.client.ListRelations(ctx, &client.ListRelationsRequest{
+		ObjectType: object.Type,
+		ObjectID:   object.ID,
+		Source:     relationSource,
+	})
+}
+
+// WriteRelationship creates a relationship between two entities. Writing
+// one that exists succeeds without changing it.
 func (s *SupraService) WriteRelationship(object Entity, relation string, subject Subject) error {
 	ctx := context.Background()
 	req := &client.CreateRelationRequest{
@@ -115,12 +146,13 @@ func (s *SupraService) WriteRelationship(object Entity, relation string, subject
 		Relation:    relation,
 		SubjectType: subject.Type,
 		SubjectID:   subject.ID,
+		Source:      relationSource,
 	}
 
-	_, err := s.client.CreateRelation(ctx, req)
+	resp, err := s.client.UpsertRelation(ctx, req)
 
 	// Log the operation
-	if err == nil {
+	if err == nil && resp.Status != client.WriteExisting {
 		modelObj := model.Entity{Type: object.Type, ID: object.ID}
 		modelSubj := model.Subject{Type: subject.Type, ID: subject.ID}
 		_ = s.auditLogger.LogRelationCreate(ctx, modelObj, relation, modelSubj, s.httpRequest)
@@ -152,6 +184,74 @@ func (s *SupraService) DeleteRelationship(object Entity, relation string, subjec
 	return err
 }
 
+// RelationshipWrite creates, or with Delete set deletes, one relationship in
+// a WriteRelationships batch
+type RelationshipWrite struct {
+	Delete   bool
+	Object   Entity
+	Relation string
+	Subject  Subject
+}
+
+// maxRelationshipWrites is the most writes the service applies in one request
+const maxRelationshipWrites = 1000
+
+// WriteRelationships applies relationship creates and deletes through the
+// batch API, each on its own so one failure doesn't stop the rest. It
+// returns the error of each write by index, nil for the ones applied;
+// creating a relationship that exists succeeds without changing it. The
+// error returned is for a request that failed as a whole.
+func (s *SupraService) WriteRelationships(ctx context.Context, writes []RelationshipWrite) ([]error, error) {
+	errs := make([]error, len(writes))
+	for start := 0; start < len(writes); start += maxRelationshipWrites {
+		end := min(start+maxRelationshipWrites, len(writes))
+
+		ops := make([]client.RelationWrite, 0, end-start)
+		for _, write := range writes[start:end] {
+			op := client.RelationWrite{
+				Op:          client.RelationshipCreate,
+				SubjectType: write.Subject.Type,
+				SubjectID:   write.Subject.ID,
+				Relation:    write.Relation,
+				ObjectType:  write.Object.Type,
+				ObjectID:    write.Object.ID,
+				Source:      relationSource,
+			}
+			if write.Delete {
+				op.Op = client.RelationshipDelete
+				op.Source = ""
+			}
+			ops = append(ops, op)
+		}
+
+		resp, err := s.client.WriteRelations(ctx, ops)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Results) != len(ops) {
+			return nil, fmt.Errorf("relation batch returned %d results for %d writes", len(resp.Results), len(ops))
+		}
+
+		for i, result := range resp.Results {
+			write := writes[start+i]
+			switch {
+			case result.Code == "relation_exists" && !write.Delete:
+			case result.Code != "" || result.Error != "":
+				errs[start+i] = &client.BatchItemError{Index: start + i, Code: result.Code, Message: result.Error}
+			case result.Relation != nil:
+				modelObj := model.Entity{Type: write.Object.Type, ID: write.Object.ID}
+				modelSubj := model.Subject{Type: write.Subject.Type, ID: write.Subject.ID}
+				if write.Delete {
+					_ = s.auditLogger.LogRelationDelete(ctx, modelObj, write.Relation, modelSubj, s.httpRequest)
+				} else {
+					_ = s.auditLogger.LogRelationCreate(ctx, modelObj, write.Relation, modelSubj, s.httpRequest)
+				}
+			}
+		}
+	}
+	return errs, nil
+}
+
 // CheckPermission checks if a subject has permission on an object
 func (s *SupraService) CheckPermission(ctx context.Context, subject Subject, permission string, object Entity, contextData map[string]interface{}) (bool, error) {
 	req := &client.CheckPermissionRequest{
@@ -194,9 +294,10 @@ func (s *SupraService) TestRelationship(ctx context.Context, subject Subject, re
 	return resp.HasRelation, nil
 }
 
-// DeleteEntity deletes an entity from the permission system
+// DeleteEntity deletes an entity from the permission system along with the
+// relations it appears in, so none are left orphaned
 func (s *SupraService) DeleteEntity(ctx context.Context, entityType string, entityID string) error {
-	err := s.client.DeleteEntity(ctx, entityType, entityID)
+	err := s.client.DeleteEntityCascade(ctx, entityType, entityID)
 
 	// Log the operation
 	if err == nil {
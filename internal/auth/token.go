@@ -3,13 +3,16 @@ package auth
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type TokenManager struct {
+	mu           sync.RWMutex
 	secret       []byte
+	previous     []byte // still accepted for validation after a rotation
 	expiryPeriod time.Duration
 }
 
@@ -20,12 +23,43 @@ func NewTokenManager(secret string, expiryPeriod time.Duration) *TokenManager {
 	}
 }
 
+// Rotate switches to a new signing secret. Tokens signed with the secret being
+// replaced remain valid until they expire.
+func (tm *TokenManager) Rotate(secret string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if string(tm.secret) == secret {
+		return
+	}
+	tm.previous = tm.secret
+	tm.secret = []byte(secret)
+}
+
+func (tm *TokenManager) secrets() (current, previous []byte) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.secret, tm.previous
+}
+
 type Claims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
+	// Roles are the user's roles in the organization an org-scoped token is
+	// for, whose ID is the token's audience
+	Roles []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Organization returns the organization an org-scoped token is for, or ""
+// for a user token
+func (c *Claims) Organization() string {
+	if len(c.Audience) != 1 {
+		return ""
+	}
+	return c.Audience[0]
+}
+
 func (tm *TokenManager) Generate(userID, email string) (string, error) {
 	claims := Claims{
 		UserID: userID,
@@ -36,16 +70,53 @@ func (tm *TokenManager) Generate(userID, email string) (string, error) {
 		},
 	}
 
+	secret, _ := tm.secrets()
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(tm.secret)
+	return token.SignedString(secret)
+}
+
+// GenerateForOrganization issues a token scoped to one organization: its
+// audience is the organization's ID and it carries the user's roles there,
+// as of now, so it is short-lived
+func (tm *TokenManager) GenerateForOrganization(userID, email, orgID string, roles []string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := Claims{
+		UserID: userID,
+		Email:  email,
+		Roles:  roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{orgID},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	secret, _ := tm.secrets()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(secret)
+	return signed, expiresAt, err
 }
 
 func (tm *TokenManager) Validate(tokenString string) (*Claims, error) {
+	current, previous := tm.secrets()
+
+	claims, err := parseClaims(tokenString, current)
+	if err != nil && previous != nil {
+		claims, err = parseClaims(tokenString, previous)
+	}
+	return claims, err
+}
+
+func parseClaims(tokenString string, secret []byte) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return tm.secret, nil
+		return secret, nil
 	})
 
 	if err != nil {
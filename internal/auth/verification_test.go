@@ -0,0 +1,73 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerificationTokens(t *testing.T) {
+	tokens := auth.NewVerificationTokenManager("first-secret", time.Hour)
+	userID := uuid.New()
+
+	issued, err := tokens.Generate(userID)
+	require.NoError(t, err)
+	assert.NotContains(t, issued.Token, userID.String())
+
+	t.Run("validates a token it signed", func(t *testing.T) {
+		got, err := tokens.Validate(issued.Token)
+		require.NoError(t, err)
+		assert.Equal(t, userID, got.UserID)
+		assert.True(t, got.MatchesNonce(issued.Nonce))
+		assert.WithinDuration(t, time.Now().Add(time.Hour), got.ExpiresAt, time.Second)
+	})
+
+	t.Run("rejects tampered and foreign tokens", func(t *testing.T) {
+		// Change a character of the user ID
+		flipped := "A"
+		if issued.Token[10] == 'A' {
+			flipped = "B"
+		}
+		_, err := tokens.Validate(issued.Token[:10] + flipped + issued.Token[11:])
+		assert.ErrorIs(t, err, auth.ErrInvalidVerificationToken)
+
+		other, err := auth.NewVerificationTokenManager("other-secret", time.Hour).Generate(userID)
+		require.NoError(t, err)
+		_, err = tokens.Validate(other.Token)
+		assert.ErrorIs(t, err, auth.ErrInvalidVerificationToken)
+
+		_, err = tokens.Validate("not-a-token")
+		assert.ErrorIs(t, err, auth.ErrInvalidVerificationToken)
+	})
+
+	t.Run("keeps accepting tokens across one rotation", func(t *testing.T) {
+		tokens.Rotate("second-secret")
+		_, err := tokens.Validate(issued.Token)
+		assert.NoError(t, err)
+
+		tokens.Rotate("third-secret")
+		_, err = tokens.Validate(issued.Token)
+		assert.ErrorIs(t, err, auth.ErrInvalidVerificationToken)
+	})
+
+	t.Run("reports expired tokens with their user", func(t *testing.T) {
+		expired, err := auth.NewVerificationTokenManager("secret", -time.Minute).Generate(userID)
+		require.NoError(t, err)
+		got, err := auth.NewVerificationTokenManager("secret", time.Hour).Validate(expired.Token)
+		assert.ErrorIs(t, err, auth.ErrVerificationTokenExpired)
+		require.NotNil(t, got)
+		assert.Equal(t, userID, got.UserID)
+	})
+
+	t.Run("issues distinct URL-safe tokens", func(t *testing.T) {
+		again, err := tokens.Generate(userID)
+		require.NoError(t, err)
+		assert.NotEqual(t, issued.Token, again.Token)
+		assert.False(t, strings.ContainsAny(again.Token, "+/="))
+	})
+}
@@ -0,0 +1,247 @@
+package authzserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// Delegated administration is modelled in the graph itself: a principal
+// administers everything an admin_scope entity covers when it holds the admin
+// relation to it, e.g. user:alice admin admin_scope:acme-docs. The scope's
+// properties narrow what it covers:
+//
+//	{"tenant": "acme", "entity_types": ["document", "folder"]}
+//
+// tenant "*" covers every tenant and an empty entity_types covers every type.
+const (
+	// principalHeader names the subject a delegated admin request acts as,
+	// as type:id. Callers that set it must be trusted to authenticate users.
+	principalHeader = "X-Supra-Principal"
+
+	adminScopeType     = "admin_scope"
+	adminScopeRelation = "admin"
+
+	// tenantEntityType is the entity type that represents a tenant
+	tenantEntityType = graph.TenantEntityType
+	// tenantProperty is the entity property holding an entity's tenant
+	tenantProperty = graph.TenantProperty
+
+	allTenants = "*"
+)
+
+// adminScope is one grant of delegated administration
+type adminScope struct {
+	ID          string   `json:"-"`
+	Tenant      string   `json:"tenant"`
+	EntityTypes []string `json:"entity_types"`
+}
+
+// adminTarget describes what a write touches
+type adminTarget struct {
+	// Type and ID identify the entity written, or a relation's object
+	Type string
+	ID   string
+	// Properties are the properties of an entity being created, whose
+	// tenant can't be looked up yet
+	Properties map[string]interface{}
+	// Subject is set for relation writes
+	Subject *model.Subject
+}
+
+// tenantCheck reports whether an entity belongs to a tenant
+type tenantCheck func(ctx context.Context, entityType, entityID, tenant string) (bool, error)
+
+func (sc adminScope) coversType(entityType string) bool {
+	if len(sc.EntityTypes) == 0 {
+		return true
+	}
+	for _, t := range sc.EntityTypes {
+		if t == entityType {
+			return true
+		}
+	}
+	return false
+}
+
+// permits reports whether the scope covers target. Only a relation's object
+// has to sit inside the tenant; its subject just needs a covered type, so a
+// tenant admin can add outside users to their tenant.
+func (sc adminScope) permits(ctx context.Context, target adminTarget, inTenant tenantCheck) (bool, error) {
+	if !sc.coversType(target.Type) {
+		return false, nil
+	}
+	if target.Subject != nil && !sc.coversType(target.Subject.Type) {
+		return false, nil
+	}
+	if sc.Tenant == allTenants {
+		return true, nil
+	}
+	if sc.Tenant == "" {
+		return false, nil
+	}
+
+	if target.Properties != nil {
+		tenant, _ := target.Properties[tenantProperty].(string)
+		return tenant == sc.Tenant, nil
+	}
+	return inTenant(ctx, target.Type, target.ID, sc.Tenant)
+}
+
+// SetAdminScopes turns on delegated administration. While on, writes need the
+// admin token or a principal whose admin scopes cover the change; while off,
+// writes are unrestricted as before.
+func (s *AuthzService) SetAdminScopes(enabled bool) {
+	s.enforceAdminScopes = enabled
+}
+
+// adminError is a write the caller isn't allowed to make, with the API
+// error it is reported as
+type adminError struct {
+	code    string
+	message string
+	details string
+	status  int
+}
+
+func (e *adminError) Error() string {
+	return e.message + ": " + e.details
+}
+
+// authorizeAdmin checks a write against the caller's admin scopes, writing an
+// error response and returning false when it is not allowed. A nil target
+// means the change is global (schema definitions, scope grants) and needs the
+// admin token.
+func (s *AuthzService) authorizeAdmin(w http.ResponseWriter, r *http.Request, target *adminTarget) bool {
+	err := s.checkAdmin(r, target)
+	if err == nil {
+		return true
+	}
+	if err.status == http.StatusUnauthorized {
+		// Lets the dashboard's browser session retry with its credentials
+		w.Header().Set("WWW-Authenticate", `Basic realm="supra authz"`)
+	}
+	standardErrorResponse(w, err.code, err.message, err.details, err.status)
+	return false
+}
+
+// checkAdmin is authorizeAdmin without the response, for callers that report
+// errors their own way
+func (s *AuthzService) checkAdmin(r *http.Request, target *adminTarget) *adminError {
+	if !s.enforceAdminScopes || hasAdminKey(r) {
+		return nil
+	}
+
+	if s.adminToken != nil {
+		if expected := s.adminToken(); expected != "" && validAdminToken(r, expected) {
+			return nil
+		}
+	}
+
+	principal, err := parsePrincipal(r.Header.Get(principalHeader))
+	if err != nil {
+		return &adminError{"admin_credentials_required", "Admin credentials required",
+			fmt.Sprintf("Send the admin token or a %s header: %v", principalHeader, err), http.StatusUnauthorized}
+	}
+
+	if target == nil || target.Type == adminScopeType ||
+		(target.Subject != nil && target.Subject.Type == adminScopeType) {
+		return &adminError{"admin_token_required", "Admin token required",
+			"Only the admin token may change permission definitions or admin scopes", http.StatusForbidden}
+	}
+
+	ctx := r.Context()
+	scopes, err := s.adminScopes(ctx, principal)
+	if err != nil {
+		log.Printf("Error loading admin scopes for %s:%s: %v", principal.Type, principal.ID, err)
+		return &adminError{"internal_error", "Failed to load admin scopes", err.Error(), http.StatusInternalServerError}
+	}
+
+	for _, scope := range scopes {
+		ok, err := scope.permits(ctx, *target, s.entityInTenant)
+		if err != nil {
+			log.Printf("Error evaluating admin scope %s: %v", scope.ID, err)
+			return &adminError{"internal_error", "Failed to evaluate admin scope", err.Error(), http.StatusInternalServerError}
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	return &adminError{"outside_admin_scope", "Outside admin scope",
+		fmt.Sprintf("%s:%s does not administer %s:%s", principal.Type, principal.ID, target.Type, target.ID),
+		http.StatusForbidden}
+}
+
+// parsePrincipal parses a type:id principal header
+func parsePrincipal(value string) (model.Subject, error) {
+	if value == "" {
+		return model.Subject{}, errors.New("no principal given")
+	}
+	entityType, id, ok := strings.Cut(value, ":")
+	if !ok || entityType == "" || id == "" {
+		return model.Subject{}, fmt.Errorf("principal %q is not in type:id form", value)
+	}
+	return model.Subject{Type: entityType, ID: id}, nil
+}
+
+// adminScopes loads the scopes principal administers from the graph
+func (s *AuthzService) adminScopes(ctx context.Context, principal model.Subject) ([]adminScope, error) {
+	rows, err := s.graph.Pool.Query(ctx, `
+		SELECT e.external_id, e.properties
+		FROM relations r
+		JOIN entities e ON e.type = r.object_type AND e.external_id = r.object_id
+		WHERE r.subject_type = $1 AND r.subject_id = $2
+		  AND r.relation = $3 AND r.object_type = $4
+	`, principal.Type, principal.ID, adminScopeRelation, adminScopeType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query admin scopes: %w", err)
+	}
+	defer rows.Close()
+
+	var scopes []adminScope
+	for rows.Next() {
+		var scope adminScope
+		var properties []byte
+		if err := rows.Scan(&scope.ID, &properties); err != nil {
+			return nil, fmt.Errorf("failed to scan admin scope: %w", err)
+		}
+		if err := json.Unmarshal(properties, &scope); err != nil {
+			log.Printf("Ignoring admin scope %s with invalid properties: %v", scope.ID, err)
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, rows.Err()
+}
+
+// entityInTenant reports whether an entity is the tenant itself, carries the
+// tenant property, or is directly related to the tenant's entity
+func (s *AuthzService) entityInTenant(ctx context.Context, entityType, entityID, tenant string) (bool, error) {
+	if entityType == tenantEntityType {
+		return entityID == tenant, nil
+	}
+
+	var inTenant bool
+	err := s.graph.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM entities
+			WHERE type = $1 AND external_id = $2 AND properties->>$3 = $4
+		) OR EXISTS (
+			SELECT 1 FROM relations
+			WHERE (subject_type = $1 AND subject_id = $2 AND object_type = $5 AND object_id = $4)
+			   OR (object_type = $1 AND object_id = $2 AND subject_type = $5 AND subject_id = $4)
+		)
+	`, entityType, entityID, tenantProperty, tenant, tenantEntityType).Scan(&inTenant)
+	if err != nil {
+		return false, fmt.Errorf("failed to check tenant membership: %w", err)
+	}
+	return inTenant, nil
+}
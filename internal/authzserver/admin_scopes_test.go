@@ -0,0 +1,91 @@
+package authzserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminScopePermits(t *testing.T) {
+	// document:plan is in acme, document:roadmap is in globex
+	inTenant := func(ctx context.Context, entityType, entityID, tenant string) (bool, error) {
+		tenants := map[string]string{"document:plan": "acme", "document:roadmap": "globex"}
+		return tenants[entityType+":"+entityID] == tenant, nil
+	}
+
+	acmeDocs := adminScope{ID: "acme-docs", Tenant: "acme", EntityTypes: []string{"document", "user"}}
+	acmeAll := adminScope{ID: "acme", Tenant: "acme"}
+	global := adminScope{ID: "global-docs", Tenant: allTenants, EntityTypes: []string{"document"}}
+
+	tests := []struct {
+		name   string
+		scope  adminScope
+		target adminTarget
+		want   bool
+	}{
+		{"entity in tenant", acmeDocs, adminTarget{Type: "document", ID: "plan"}, true},
+		{"entity in other tenant", acmeDocs, adminTarget{Type: "document", ID: "roadmap"}, false},
+		{"type outside scope", acmeDocs, adminTarget{Type: "folder", ID: "plan"}, false},
+		{"new entity tagged with tenant", acmeDocs, adminTarget{Type: "document", ID: "new",
+			Properties: map[string]interface{}{"tenant": "acme"}}, true},
+		{"new entity without tenant", acmeDocs, adminTarget{Type: "document", ID: "new",
+			Properties: map[string]interface{}{}}, false},
+		{"relation from covered subject", acmeDocs, adminTarget{Type: "document", ID: "plan",
+			Subject: &model.Subject{Type: "user", ID: "bob"}}, true},
+		{"relation from uncovered subject type", acmeDocs, adminTarget{Type: "document", ID: "plan",
+			Subject: &model.Subject{Type: "team", ID: "eng"}}, false},
+		{"every type in tenant", acmeAll, adminTarget{Type: "document", ID: "plan"}, true},
+		{"every tenant", global, adminTarget{Type: "document", ID: "roadmap"}, true},
+		{"missing tenant covers nothing", adminScope{ID: "broken"}, adminTarget{Type: "document", ID: "plan"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.scope.permits(context.Background(), tt.target, inTenant)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuthorizeAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		enforce bool
+		headers map[string]string
+		target  *adminTarget
+		status  int
+	}{
+		{"scopes disabled", false, nil, nil, http.StatusOK},
+		{"admin token", true, map[string]string{"Authorization": "Bearer s3cret"}, nil, http.StatusOK},
+		{"no credentials", true, nil, &adminTarget{Type: "document", ID: "plan"}, http.StatusUnauthorized},
+		{"malformed principal", true, map[string]string{principalHeader: "alice"}, &adminTarget{Type: "document", ID: "plan"}, http.StatusUnauthorized},
+		{"principal changing schema", true, map[string]string{principalHeader: "user:alice"}, nil, http.StatusForbidden},
+		{"principal granting scopes", true, map[string]string{principalHeader: "user:alice"},
+			&adminTarget{Type: adminScopeType, ID: "acme"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AuthzService{}
+			s.SetAdminToken(func() string { return "s3cret" })
+			s.SetAdminScopes(tt.enforce)
+
+			req := httptest.NewRequest(http.MethodPost, "/entity", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			if s.authorizeAdmin(rec, req, tt.target) {
+				rec.WriteHeader(http.StatusOK)
+			}
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package authzserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/cluster"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// apiKeyHeader carries the caller's API key. A bearer token or basic auth
+// password is read as one too, so the dashboard keeps working.
+const apiKeyHeader = "X-API-Key"
+
+// issuedKeyPrefix starts every key /api/api-keys issues, which is how
+// they're told apart from configured keys and found in leaked text
+const issuedKeyPrefix = "supra_"
+
+// apiKeyCacheTTL is how long a replica trusts a lookup of an issued key;
+// revocations reach other replicas sooner through the cluster
+const apiKeyCacheTTL = 30 * time.Second
+
+// apiKeyUseResolution is how stale a key's last_used_at may get before a
+// lookup moves it on, so busy keys aren't written on every cache miss
+const apiKeyUseResolution = 10 * time.Minute
+
+// adminTokenKeyName is the key name the admin token is audited under
+const adminTokenKeyName = "admin_token"
+
+// modelRoutes change the permission model, so writing to them takes an
+// admin key like the admin routes do
+var modelRoutes = []string{
+	"/permission",
+	"/v1/permission",
+	"/api/permission-definitions",
+	"/api/rule-definitions",
+	"/api/rules",
+	"/api/tenant-rules",
+	"/api/schema/versions",
+}
+
+// apiKeyIdentity is the key a request authenticated with
+type apiKeyIdentity struct {
+	Name  string
+	Scope string
+}
+
+type apiKeyContextKey struct{}
+
+func withAPIKey(ctx context.Context, key apiKeyIdentity) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// apiKeyFromContext returns the key apiKeyAuth authenticated the request with
+func apiKeyFromContext(ctx context.Context) (apiKeyIdentity, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(apiKeyIdentity)
+	return key, ok
+}
+
+// scopeCovers reports whether a key with the granted scope may make a
+// request that needs the required one
+func scopeCovers(granted, required string) bool {
+	return scopeRank(granted) >= scopeRank(required) && scopeRank(required) >= 0
+}
+
+func scopeRank(scope string) int {
+	for i, s := range config.Scopes {
+		if s == scope {
+			return i
+		}
+	}
+	return -1
+}
+
+// requiredScope is the narrowest scope that allows r
+func requiredScope(r *http.Request) string {
+	switch {
+	case isAdminRoute(r.URL.Path), isWrite(r) && hasRoutePrefix(r.URL.Path, modelRoutes):
+		return config.ScopeAdmin
+	case isWrite(r):
+		return config.ScopeWrite
+	default:
+		return config.ScopeRead
+	}
+}
+
+func hasRoutePrefix(p string, routes []string) bool {
+	for _, route := range routes {
+		if p == route || strings.HasPrefix(p, route+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hashAPIKey is how keys are stored and compared
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedAPIKey is a lookup that found an issued key. Unknown keys aren't
+// cached: callers choose them, so they'd grow the cache without bound.
+type cachedAPIKey struct {
+	key     *apiKeyIdentity
+	expires time.Time
+}
+
+// apiKeyRegistry holds the configured keys, by hash, and caches lookups of
+// issued ones
+type apiKeyRegistry struct {
+	mu         sync.RWMutex
+	required   bool
+	configured map[string]apiKeyIdentity
+	cache      map[string]cachedAPIKey
+	// lookup finds an issued key by hash, returning nil for unknown,
+	// expired and revoked keys
+	lookup func(ctx context.Context, hash string) (*apiKeyIdentity, error)
+	// hits and misses count lookups of issued keys in cache
+	hits, misses atomic.Int64
+}
+
+// enforced reports whether requests need an API key
+func (k *apiKeyRegistry) enforced() bool {
+	if k == nil {
+		return false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.required || len(k.configured) > 0
+}
+
+func (k *apiKeyRegistry) setConfigured(keys []config.APIKey) {
+	configured := make(map[string]apiKeyIdentity, len(keys))
+	for _, key := range keys {
+		configured[hashAPIKey(key.Key)] = apiKeyIdentity{Name: key.Name, Scope: key.Scope}
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.configured = configured
+}
+
+// configuredNamed returns the configured key called name
+func (k *apiKeyRegistry) configuredNamed(name string) (apiKeyIdentity, bool) {
+	if k == nil {
+		return apiKeyIdentity{}, false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.configured {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return apiKeyIdentity{}, false
+}
+
+// find returns the key secret names, or nil if it names none
+func (k *apiKeyRegistry) find(ctx context.Context, secret string) (*apiKeyIdentity, error) {
+	if k == nil {
+		return nil, nil
+	}
+	hash := hashAPIKey(secret)
+
+	k.mu.RLock()
+	key, ok := k.configured[hash]
+	cached, hit := k.cache[hash]
+	k.mu.RUnlock()
+	if ok {
+		return &key, nil
+	}
+	if !strings.HasPrefix(secret, issuedKeyPrefix) || k.lookup == nil {
+		return nil, nil
+	}
+	if hit && time.Now().Before(cached.expires) {
+		k.hits.Add(1)
+		return cached.key, nil
+	}
+	k.misses.Add(1)
+
+	issued, err := k.lookup(ctx, hash)
+	if err != nil || issued == nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	if k.cache == nil {
+		k.cache = make(map[string]cachedAPIKey)
+	}
+	k.cache[hash] = cachedAPIKey{key: issued, expires: time.Now().Add(apiKeyCacheTTL)}
+	k.mu.Unlock()
+	return issued, nil
+}
+
+// cacheStats returns the lookups of issued keys that were cached
+func (k *apiKeyRegistry) cacheStats() graph.CacheStats {
+	stats := graph.CacheStats{Cache: cacheAPIKeys}
+	if k != nil {
+		stats.Hits, stats.Misses = k.hits.Load(), k.misses.Load()
+	}
+	return stats
+}
+
+// invalidate forgets every lookup of an issued key
+func (k *apiKeyRegistry) invalidate() {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.cache = nil
+}
+
+// SetAPIKeys sets the keys from the configuration, replacing any set
+// before, and whether issued keys are enforced without them
+func (s *AuthzService) SetAPIKeys(keys []config.APIKey, required bool) {
+	if s.apiKeys == nil {
+		s.apiKeys = &apiKeyRegistry{}
+		if s.graph != nil {
+			s.apiKeys.lookup = s.lookupIssuedAPIKey
+		}
+	}
+	s.apiKeys.setConfigured(keys)
+	s.apiKeys.mu.Lock()
+	s.apiKeys.required = required
+	s.apiKeys.mu.Unlock()
+}
+
+// apiKeySecret is the key r was sent with
+func apiKeySecret(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// authenticateAPIKey returns the key secret names, treating the admin token
+// as an admin key, or nil if it names none
+func (s *AuthzService) authenticateAPIKey(ctx context.Context, secret string) (*apiKeyIdentity, error) {
+	if secret == "" {
+		return nil, nil
+	}
+	if s.adminToken != nil {
+		if expected := s.adminToken(); expected != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1 {
+			return &apiKeyIdentity{Name: adminTokenKeyName, Scope: config.ScopeAdmin}, nil
+		}
+	}
+	return s.apiKeys.find(ctx, secret)
+}
+
+// apiKeyAuth rejects requests without a key whose scope covers them, while
+// keys are enforced, and records the key for the audit log
+func (s *AuthzService) apiKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || r.URL.Path == "/health" || !s.apiKeys.enforced() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := s.authenticateAPIKey(r.Context(), apiKeySecret(r))
+		if err != nil {
+			log.Printf("Error looking up API key: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to check the API key", "", http.StatusInternalServerError)
+			return
+		}
+		if key == nil {
+			if isAdminRoute(r.URL.Path) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="supra authz"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="supra authz"`)
+			}
+			standardErrorResponse(w, "invalid_api_key", "A valid API key is required",
+				fmt.Sprintf("Send the key in the %s header or as a bearer token", apiKeyHeader), http.StatusUnauthorized)
+			return
+		}
+
+		if required := requiredScope(r); !scopeCovers(key.Scope, required) {
+			standardErrorResponse(w, "insufficient_scope", "API key scope does not allow this request",
+				fmt.Sprintf("API key %s has %s scope; %s %s needs %s", key.Name, key.Scope, r.Method, r.URL.Path, required),
+				http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withAPIKey(r.Context(), *key)))
+	})
+}
+
+// hasAdminKey reports whether r authenticated with an admin-scoped key
+func hasAdminKey(r *http.Request) bool {
+	key, ok := apiKeyFromContext(r.Context())
+	return ok && key.Scope == config.ScopeAdmin
+}
+
+// APIKeyRequest issues an API key. ExpiresIn is a duration such as "720h";
+// without one the key lasts until it's revoked.
+type APIKeyRequest struct {
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+// APIKeyInfo describes an API key. Key is only returned when the key is
+// issued; Source is "config" for keys from the configuration and "issued"
+// for the rest.
+type APIKeyInfo struct {
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Source     string     `json:"source"`
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// addAPIKeyEndpoints serves issuing, listing and revoking API keys
+func (s *AuthzService) addAPIKeyEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.listAPIKeys(w, r)
+		case http.MethodPost:
+			s.issueAPIKey(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/api-keys/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.revokeAPIKey(w, r, strings.TrimPrefix(r.URL.Path, "/api/api-keys/"))
+	})
+}
+
+func (s *AuthzService) issueAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || strings.ContainsAny(req.Name, ":,/") {
+		standardErrorResponse(w, "invalid_request", "Invalid API key name",
+			"name must be set and can't contain ':', ',' or '/'", http.StatusBadRequest)
+		return
+	}
+	if !config.ValidScope(req.Scope) {
+		standardErrorResponse(w, "invalid_request", "Invalid API key scope",
+			fmt.Sprintf("scope must be one of %s", strings.Join(config.Scopes, ", ")), http.StatusBadRequest)
+		return
+	}
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			standardErrorResponse(w, "invalid_request", "Invalid expires_in", "expires_in must be a positive duration such as 720h", http.StatusBadRequest)
+			return
+		}
+		t := time.Now().UTC().Add(d)
+		expiresAt = &t
+	}
+	if _, ok := s.apiKeys.configuredNamed(req.Name); ok {
+		standardErrorResponse(w, "conflict", "API key name in use", req.Name+" is a configured key", http.StatusConflict)
+		return
+	}
+
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		standardErrorResponse(w, "internal_error", "Failed to generate an API key", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	info := APIKeyInfo{
+		Name:      req.Name,
+		Scope:     req.Scope,
+		Source:    "issued",
+		Key:       secret,
+		Prefix:    secret[:len(issuedKeyPrefix)+6],
+		ExpiresAt: expiresAt,
+	}
+
+	var createdAt time.Time
+	err = s.graph.Pool.QueryRow(r.Context(), `
+		INSERT INTO authz_api_keys (id, name, scope, key_hash, prefix, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`, uuid.New(), info.Name, info.Scope, hashAPIKey(secret), info.Prefix, expiresAt).Scan(&createdAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		standardErrorResponse(w, "conflict", "API key name in use", req.Name+" names an active key", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error issuing API key %s: %v", req.Name, err)
+		standardErrorResponse(w, "internal_error", "Failed to issue the API key", "", http.StatusInternalServerError)
+		return
+	}
+	info.CreatedAt = &createdAt
+
+	// Drop cached misses, here and on the other replicas, so the key works
+	// right away
+	s.apiKeys.invalidate()
+	s.broadcast(r.Context(), cluster.EventCacheInvalidated, InvalidateCacheRequest{Cache: cacheAPIKeys})
+
+	log.Printf("Issued %s API key %s", info.Scope, info.Name)
+	jsonResponse(w, info, http.StatusCreated)
+}
+
+func (s *AuthzService) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys := []APIKeyInfo{}
+	if s.apiKeys != nil {
+		s.apiKeys.mu.RLock()
+		for _, key := range s.apiKeys.configured {
+			keys = append(keys, APIKeyInfo{Name: key.Name, Scope: key.Scope, Source: "config"})
+		}
+		s.apiKeys.mu.RUnlock()
+	}
+
+	rows, err := s.graph.Pool.Query(r.Context(), `
+		SELECT name, scope, prefix, created_at, expires_at, last_used_at
+		FROM authz_api_keys
+		WHERE revoked_at IS NULL
+		ORDER BY name
+	`)
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to list API keys", "", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		info := APIKeyInfo{Source: "issued"}
+		var createdAt time.Time
+		if err := rows.Scan(&info.Name, &info.Scope, &info.Prefix, &createdAt, &info.ExpiresAt, &info.LastUsedAt); err != nil {
+			log.Printf("Error scanning API key: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to list API keys", "", http.StatusInternalServerError)
+			return
+		}
+		info.CreatedAt = &createdAt
+		keys = append(keys, info)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to list API keys", "", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, keys, http.StatusOK)
+}
+
+func (s *AuthzService) revokeAPIKey(w http.ResponseWriter, r *http.Request, name string) {
+	if _, ok := s.apiKeys.configuredNamed(name); ok {
+		standardErrorResponse(w, "invalid_request", "Configured keys can't be revoked here",
+			"Remove "+name+" from AUTHZ_API_KEYS instead", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := s.graph.Pool.Exec(r.Context(), `
+		UPDATE authz_api_keys SET revoked_at = NOW()
+		WHERE name = $1 AND revoked_at IS NULL
+	`, name)
+	if err != nil {
+		log.Printf("Error revoking API key %s: %v", name, err)
+		standardErrorResponse(w, "internal_error", "Failed to revoke the API key", "", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		standardErrorResponse(w, "not_found", "API key not found", name, http.StatusNotFound)
+		return
+	}
+
+	s.apiKeys.invalidate()
+	s.broadcast(r.Context(), cluster.EventCacheInvalidated, InvalidateCacheRequest{Cache: cacheAPIKeys})
+
+	log.Printf("Revoked API key %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupIssuedAPIKey finds a live issued key by hash, noting when it was
+// last used. The note is best effort, so keys keep working while the
+// database is read-only.
+func (s *AuthzService) lookupIssuedAPIKey(ctx context.Context, hash string) (*apiKeyIdentity, error) {
+	var key apiKeyIdentity
+	var lastUsed *time.Time
+	err := s.graph.Pool.QueryRow(ctx, `
+		SELECT name, scope, last_used_at FROM authz_api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, hash).Scan(&key.Name, &key.Scope, &lastUsed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	if lastUsed != nil && time.Since(*lastUsed) < apiKeyUseResolution {
+		return &key, nil
+	}
+	if _, err := s.graph.Pool.Exec(ctx, `UPDATE authz_api_keys SET last_used_at = NOW() WHERE key_hash = $1`, hash); err != nil {
+		log.Printf("Failed to note use of API key %s: %v", key.Name, err)
+	}
+	return &key, nil
+}
+
+// newAPIKeySecret generates a key: the issued prefix and 32 random bytes
+func newAPIKeySecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return issuedKeyPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,184 @@
+package authzserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	authzv1 "github.com/dangerclosesec/supra/api/authz/v1"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	readKey  = "read-0123456789abcdef0123456789"
+	writeKey = "write-0123456789abcdef012345678"
+	adminKey = "admin-0123456789abcdef012345678"
+)
+
+func apiKeyService() *AuthzService {
+	s := &AuthzService{}
+	s.SetAdminToken(func() string { return "s3cret" })
+	s.SetAPIKeys([]config.APIKey{
+		{Name: "billing", Scope: config.ScopeRead, Key: readKey},
+		{Name: "provisioner", Scope: config.ScopeWrite, Key: writeKey},
+		{Name: "ops", Scope: config.ScopeAdmin, Key: adminKey},
+	}, false)
+	return s
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	s := apiKeyService()
+	var seen apiKeyIdentity
+	handler := s.apiKeyAuth(s.adminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = apiKeyFromContext(r.Context())
+	})))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		status int
+		as     string
+	}{
+		{"health stays open", http.MethodGet, "/health", "", http.StatusOK, ""},
+		{"missing key", http.MethodPost, "/check", "", http.StatusUnauthorized, ""},
+		{"unknown key", http.MethodPost, "/check", "read-nope", http.StatusUnauthorized, ""},
+		{"read key checks", http.MethodPost, "/check", readKey, http.StatusOK, "billing"},
+		{"read key can't write", http.MethodPost, "/relation", readKey, http.StatusForbidden, ""},
+		{"write key writes", http.MethodPost, "/relation", writeKey, http.StatusOK, "provisioner"},
+		{"write key can't change the schema", http.MethodPost, "/permission", writeKey, http.StatusForbidden, ""},
+		{"write key reads rules", http.MethodGet, "/api/rules/is_owner", writeKey, http.StatusOK, "provisioner"},
+		{"write key can't use admin routes", http.MethodGet, "/api/graph", writeKey, http.StatusForbidden, ""},
+		{"admin key changes the schema", http.MethodPut, "/api/tenant-rules", adminKey, http.StatusOK, "ops"},
+		{"admin key passes admin auth", http.MethodGet, "/api/audit/logs", adminKey, http.StatusOK, "ops"},
+		{"admin token is an admin key", http.MethodGet, "/api/graph", "s3cret", http.StatusOK, adminTokenKeyName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = apiKeyIdentity{}
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(apiKeyHeader, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Equal(t, tt.as, seen.Name)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard/", nil)
+	req.SetBasicAuth("admin", "s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, "the dashboard's basic auth should still work")
+
+	req = httptest.NewRequest(http.MethodPost, "/check", nil)
+	req.Header.Set("Authorization", "Bearer "+readKey)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, "bearer keys should be accepted")
+}
+
+func TestAPIKeysNotEnforced(t *testing.T) {
+	s := &AuthzService{}
+	called := false
+	s.apiKeyAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/relation", nil))
+	assert.True(t, called, "without keys configured requests pass through")
+
+	s.SetAPIKeys(nil, true)
+	rec := httptest.NewRecorder()
+	s.apiKeyAuth(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/check", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "required keys are enforced without configured ones")
+}
+
+func TestAPIKeyCORSPreflight(t *testing.T) {
+	s := apiKeyService()
+	req := httptest.NewRequest(http.MethodOptions, "/check", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Headers", "x-api-key")
+	rec := httptest.NewRecorder()
+	corsMiddleware(s.apiKeyAuth(http.NotFoundHandler())).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code, "preflights are answered before the key is checked")
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), apiKeyHeader)
+}
+
+func TestIssuedAPIKeyCache(t *testing.T) {
+	lookups := 0
+	keys := &apiKeyRegistry{lookup: func(ctx context.Context, hash string) (*apiKeyIdentity, error) {
+		lookups++
+		if hash == hashAPIKey("supra_live") {
+			return &apiKeyIdentity{Name: "ci", Scope: config.ScopeWrite}, nil
+		}
+		return nil, nil
+	}}
+	ctx := context.Background()
+
+	key, err := keys.find(ctx, "supra_live")
+	require.NoError(t, err)
+	require.NotNil(t, key)
+	assert.Equal(t, "ci", key.Name)
+
+	_, _ = keys.find(ctx, "supra_live")
+	missing, _ := keys.find(ctx, "supra_gone")
+	_, _ = keys.find(ctx, "supra_gone")
+	assert.Nil(t, missing)
+	assert.Equal(t, 3, lookups, "hits should be cached and misses looked up again")
+	assert.Len(t, keys.cache, 1, "unknown keys shouldn't be cached")
+
+	keys.invalidate()
+	_, _ = keys.find(ctx, "supra_live")
+	assert.Equal(t, 4, lookups)
+
+	_, _ = keys.find(ctx, "not-issued-by-us")
+	assert.Equal(t, 4, lookups, "keys without the issued prefix shouldn't reach the database")
+	assert.Equal(t, graph.CacheStats{Cache: cacheAPIKeys, Hits: 1, Misses: 4}, keys.cacheStats())
+}
+
+func TestAPIKeyAudited(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/check", nil)
+	req = req.WithContext(withAPIKey(req.Context(), apiKeyIdentity{Name: "billing", Scope: config.ScopeRead}))
+	entry := newAuditEntry("permission_check", req, nil)
+	assert.Equal(t, "billing", entry.APIKey)
+
+	hash, err := auditChainHash(1, "", entry)
+	require.NoError(t, err)
+	entry.APIKey = ""
+	unkeyed, err := auditChainHash(1, "", entry)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, unkeyed, "the key should be covered by the chain hash")
+}
+
+func TestGRPCAPIKeys(t *testing.T) {
+	client := grpcClient(t, apiKeyService())
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), strings.ToLower(apiKeyHeader), key)
+	}
+
+	_, err := client.Check(context.Background(), &authzv1.CheckRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.CreateEntity(withKey(readKey), &authzv1.CreateEntityRequest{Type: "user"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.WritePermission(withKey(writeKey), &authzv1.WritePermissionRequest{EntityType: "document"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Past authentication the request fails validation
+	_, err = client.CreateEntity(withKey(writeKey), &authzv1.CreateEntityRequest{Type: "user"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
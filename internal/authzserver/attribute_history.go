@@ -0,0 +1,52 @@
+package authzserver
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// AttributeHistoryResponse lists the values an entity's attributes have held
+type AttributeHistoryResponse struct {
+	Type       string                   `json:"type"`
+	ExternalID string                   `json:"external_id"`
+	Versions   []graph.AttributeVersion `json:"versions"`
+}
+
+// attributeHistoryHandler serves GET /entity/attributes/history?type=&id=,
+// optionally narrowed to one attribute with &attribute=
+func (s *AuthzService) attributeHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		standardErrorResponse(w, "method_not_allowed", "Method not allowed",
+			"Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	entityType := query.Get("type")
+	externalID := query.Get("id")
+	if entityType == "" || externalID == "" {
+		standardErrorResponse(w, "missing_parameters", "Missing query parameters",
+			"Type and id query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	versions, err := s.graph.GetAttributeHistory(ctx, entityType, externalID, query.Get("attribute"))
+	if err != nil {
+		log.Printf("Error retrieving attribute history: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to retrieve attribute history",
+			err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, AttributeHistoryResponse{
+		Type:       entityType,
+		ExternalID: externalID,
+		Versions:   versions,
+	}, http.StatusOK)
+}
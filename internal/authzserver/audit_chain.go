@@ -0,0 +1,418 @@
+package authzserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// auditChainLock is the advisory lock held while rows are appended to the
+// audit hash chain, so replicas writing at once still build a single chain
+const auditChainLock = 0x5a7a_a0d1
+
+// Audit exports are read in pages of at most maxAuditExport rows
+const (
+	defaultAuditExport = 10000
+	maxAuditExport     = 100000
+)
+
+// auditExportAlgorithm names how export manifests are signed
+const auditExportAlgorithm = "ed25519"
+
+// chainedAuditEntry is an audit row with its place in the hash chain. Each
+// row's hash covers its contents, its sequence number and the previous
+// row's hash, so editing, reordering or deleting a row breaks every hash
+// after it.
+type chainedAuditEntry struct {
+	Seq      int64  `json:"seq"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+	auditEntry
+}
+
+// auditChainRecord is what a row's hash is computed over. Timestamps are
+// kept to the microsecond PostgreSQL stores and the context is re-encoded
+// with sorted keys, so a row read back from the database hashes the same as
+// when it was written.
+type auditChainRecord struct {
+	Seq         int64           `json:"seq"`
+	ID          string          `json:"id"`
+	Timestamp   string          `json:"timestamp"`
+	ActionType  string          `json:"action_type"`
+	Result      *bool           `json:"result"`
+	EntityType  string          `json:"entity_type"`
+	EntityID    string          `json:"entity_id"`
+	SubjectType string          `json:"subject_type"`
+	SubjectID   string          `json:"subject_id"`
+	Relation    string          `json:"relation"`
+	Permission  string          `json:"permission"`
+	Context     json.RawMessage `json:"context,omitempty"`
+	RequestID   string          `json:"request_id"`
+	ClientIP    string          `json:"client_ip"`
+	UserAgent   string          `json:"user_agent"`
+	// Omitted when empty, so rows from before they were recorded still
+	// verify
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	ClientCert string `json:"client_cert,omitempty"`
+	Deprecated bool   `json:"deprecated,omitempty"`
+	APIKey     string `json:"api_key,omitempty"`
+}
+
+// auditChainHash returns the hash of the entry stored at seq after a row
+// hashed prevHash; the first row of the chain follows an empty hash
+func auditChainHash(seq int64, prevHash string, e auditEntry) (string, error) {
+	record := auditChainRecord{
+		Seq:         seq,
+		ID:          e.ID.String(),
+		Timestamp:   e.Timestamp.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		ActionType:  e.ActionType,
+		Result:      e.Result,
+		EntityType:  e.EntityType,
+		EntityID:    e.EntityID,
+		SubjectType: e.SubjectType,
+		SubjectID:   e.SubjectID,
+		Relation:    e.Relation,
+		Permission:  e.Permission,
+		RequestID:   e.RequestID,
+		ClientIP:    e.ClientIP,
+		UserAgent:   e.UserAgent,
+		RemoteAddr:  e.RemoteAddr,
+		ClientCert:  e.ClientCert,
+		Deprecated:  e.Deprecated,
+		APIKey:      e.APIKey,
+	}
+	if len(e.Context) > 0 {
+		var context interface{}
+		if err := json.Unmarshal(e.Context, &context); err != nil {
+			return "", fmt.Errorf("context is not valid JSON: %w", err)
+		}
+		canonical, err := json.Marshal(context)
+		if err != nil {
+			return "", err
+		}
+		record.Context = canonical
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	sum.Write([]byte(prevHash))
+	sum.Write([]byte{'\n'})
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// AuditChainBreak is the first row where the chain doesn't hold
+type AuditChainBreak struct {
+	Seq    int64  `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+// verifyAuditChain checks that entries continue a chain whose last row was
+// prevSeq, hashed prevHash, and returns the first break
+func verifyAuditChain(prevSeq int64, prevHash string, entries []chainedAuditEntry) *AuditChainBreak {
+	for _, e := range entries {
+		if e.Seq != prevSeq+1 {
+			return &AuditChainBreak{Seq: prevSeq + 1, Reason: fmt.Sprintf("row missing: next row is %d", e.Seq)}
+		}
+		if e.PrevHash != prevHash {
+			return &AuditChainBreak{Seq: e.Seq, Reason: "previous hash doesn't match the row before it"}
+		}
+		hash, err := auditChainHash(e.Seq, e.PrevHash, e.auditEntry)
+		if err != nil {
+			return &AuditChainBreak{Seq: e.Seq, Reason: err.Error()}
+		}
+		if hash != e.Hash {
+			return &AuditChainBreak{Seq: e.Seq, Reason: "contents don't match the row's hash"}
+		}
+		prevSeq, prevHash = e.Seq, e.Hash
+	}
+	return nil
+}
+
+// AuditExportManifest describes a range of the audit chain. Its signature
+// commits to the hashes at both ends and to the exported rows, so a later
+// export or the live table can be checked against it.
+type AuditExportManifest struct {
+	FromSeq  int64  `json:"from_seq"`
+	ToSeq    int64  `json:"to_seq"`
+	Count    int    `json:"count"`
+	PrevHash string `json:"prev_hash"`
+	LastHash string `json:"last_hash"`
+	// EntriesSHA256 is the SHA-256 of the JSON-encoded entries array
+	EntriesSHA256 string    `json:"entries_sha256"`
+	ExportedAt    time.Time `json:"exported_at"`
+	Algorithm     string    `json:"algorithm,omitempty"`
+	// PublicKey is the base64 Ed25519 key the manifest was signed with;
+	// verifiers should compare it with the key they trust
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// AuditExport is a signed page of the audit chain
+type AuditExport struct {
+	Manifest AuditExportManifest `json:"manifest"`
+	// Signature is the base64 Ed25519 signature of the JSON-encoded
+	// manifest; empty when no signing key is configured
+	Signature string              `json:"signature,omitempty"`
+	Entries   []chainedAuditEntry `json:"entries"`
+}
+
+// SetAuditSigningKey signs audit export manifests with key
+func (s *AuthzService) SetAuditSigningKey(key ed25519.PrivateKey) {
+	s.auditSigningKey = key
+}
+
+// ParseAuditSigningKey decodes a base64 Ed25519 private key, given either
+// as its 32-byte seed or as the 64-byte key
+func ParseAuditSigningKey(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("audit signing key is not base64: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("audit signing key must be a %d-byte Ed25519 seed or %d-byte key, got %d bytes",
+			ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+// newAuditExport builds the manifest for entries, which follow a row
+// hashed prevHash, and signs it when key is set
+func newAuditExport(fromSeq int64, prevHash string, entries []chainedAuditEntry, key ed25519.PrivateKey) (*AuditExport, error) {
+	if entries == nil {
+		entries = []chainedAuditEntry{}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+
+	manifest := AuditExportManifest{
+		FromSeq:       fromSeq,
+		ToSeq:         fromSeq - 1,
+		Count:         len(entries),
+		PrevHash:      prevHash,
+		LastHash:      prevHash,
+		EntriesSHA256: hex.EncodeToString(sum[:]),
+		ExportedAt:    time.Now().UTC(),
+	}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		manifest.ToSeq, manifest.LastHash = last.Seq, last.Hash
+	}
+
+	export := &AuditExport{Manifest: manifest, Entries: entries}
+	if key == nil {
+		return export, nil
+	}
+	export.Manifest.Algorithm = auditExportAlgorithm
+	export.Manifest.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	signed, err := json.Marshal(export.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	export.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, signed))
+	return export, nil
+}
+
+// VerifyAuditExport checks an export produced by /api/audit/export: that
+// its manifest is signed by publicKey, that the entries are the ones the
+// manifest describes, and that they form an unbroken chain. A nil
+// publicKey skips the signature, checking only the chain.
+func VerifyAuditExport(data []byte, publicKey ed25519.PublicKey) (*AuditExportManifest, error) {
+	var export AuditExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to decode audit export: %w", err)
+	}
+	m := &export.Manifest
+
+	if publicKey != nil {
+		if export.Signature == "" {
+			return nil, errors.New("export is not signed")
+		}
+		signature, err := base64.StdEncoding.DecodeString(export.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("signature is not base64: %w", err)
+		}
+		signed, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		if !ed25519.Verify(publicKey, signed, signature) {
+			return nil, errors.New("manifest signature is invalid")
+		}
+	}
+
+	entries, err := json.Marshal(export.Entries)
+	if err != nil {
+		return nil, err
+	}
+	if export.Entries == nil {
+		entries = []byte("[]")
+	}
+	if sum := sha256.Sum256(entries); hex.EncodeToString(sum[:]) != m.EntriesSHA256 {
+		return nil, errors.New("entries don't match the manifest")
+	}
+	if len(export.Entries) != m.Count {
+		return nil, fmt.Errorf("manifest lists %d entries, export has %d", m.Count, len(export.Entries))
+	}
+
+	if brk := verifyAuditChain(m.FromSeq-1, m.PrevHash, export.Entries); brk != nil {
+		return nil, fmt.Errorf("audit chain broken at row %d: %s", brk.Seq, brk.Reason)
+	}
+	if len(export.Entries) > 0 && export.Entries[len(export.Entries)-1].Hash != m.LastHash {
+		return nil, errors.New("last hash doesn't match the manifest")
+	}
+	return m, nil
+}
+
+// loadAuditChain reads up to limit chained rows starting at fromSeq, with
+// the hash of the row before them
+func (s *AuthzService) loadAuditChain(ctx context.Context, fromSeq int64, limit int) (string, []chainedAuditEntry, error) {
+	var prevHash string
+	if fromSeq > 1 {
+		err := s.graph.Pool.QueryRow(ctx, `
+			SELECT hash FROM authz_audit_logs WHERE chain_seq = $1
+		`, fromSeq-1).Scan(&prevHash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil, fmt.Errorf("audit row %d not found", fromSeq-1)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to load audit row %d: %w", fromSeq-1, err)
+		}
+	}
+
+	rows, err := s.graph.Pool.Query(ctx, `
+		SELECT chain_seq, prev_hash, hash, id, timestamp, action_type, result,
+			COALESCE(entity_type, ''), COALESCE(entity_id, ''),
+			COALESCE(subject_type, ''), COALESCE(subject_id, ''),
+			COALESCE(relation, ''), COALESCE(permission, ''), context,
+			COALESCE(request_id, ''), COALESCE(client_ip, ''), COALESCE(user_agent, ''),
+			COALESCE(remote_addr, ''), COALESCE(client_cert, ''), deprecated, COALESCE(api_key, '')
+		FROM authz_audit_logs
+		WHERE chain_seq >= $1
+		ORDER BY chain_seq
+		LIMIT $2
+	`, fromSeq, limit)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load audit chain: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []chainedAuditEntry
+	for rows.Next() {
+		var e chainedAuditEntry
+		var context []byte
+		if err := rows.Scan(&e.Seq, &e.PrevHash, &e.Hash, &e.ID, &e.Timestamp, &e.ActionType, &e.Result,
+			&e.EntityType, &e.EntityID, &e.SubjectType, &e.SubjectID, &e.Relation, &e.Permission, &context,
+			&e.RequestID, &e.ClientIP, &e.UserAgent, &e.RemoteAddr, &e.ClientCert, &e.Deprecated, &e.APIKey); err != nil {
+			return "", nil, fmt.Errorf("failed to scan audit row: %w", err)
+		}
+		e.Timestamp = e.Timestamp.UTC()
+		e.Context = context
+		entries = append(entries, e)
+	}
+	return prevHash, entries, rows.Err()
+}
+
+// AuditVerifyResponse reports whether a range of the audit chain is intact
+type AuditVerifyResponse struct {
+	Valid   bool             `json:"valid"`
+	FromSeq int64            `json:"from_seq"`
+	Checked int              `json:"checked"`
+	Break   *AuditChainBreak `json:"break,omitempty"`
+}
+
+// auditRange reads the from and limit query parameters
+func auditRange(r *http.Request) (int64, int, error) {
+	fromSeq := int64(1)
+	if v := r.URL.Query().Get("from"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("from must be a row number of at least 1, got %q", v)
+		}
+		fromSeq = n
+	}
+	limit := defaultAuditExport
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditExport {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d, got %q", maxAuditExport, v)
+		}
+		limit = n
+	}
+	return fromSeq, limit, nil
+}
+
+// addAuditChainEndpoints serves chain verification and signed exports.
+// Verification only sees the rows still in the table; removing rows from
+// the end is caught by comparing with an earlier signed export.
+func (s *AuthzService) addAuditChainEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/audit/verify", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fromSeq, limit, err := auditRange(r)
+		if err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid audit range", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prevHash, entries, err := s.loadAuditChain(r.Context(), fromSeq, limit)
+		if err != nil {
+			standardErrorResponse(w, "internal_error", "Failed to load audit chain", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		brk := verifyAuditChain(fromSeq-1, prevHash, entries)
+		jsonResponse(w, AuditVerifyResponse{
+			Valid:   brk == nil,
+			FromSeq: fromSeq,
+			Checked: len(entries),
+			Break:   brk,
+		}, http.StatusOK)
+	})
+
+	mux.HandleFunc("/api/audit/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fromSeq, limit, err := auditRange(r)
+		if err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid audit range", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prevHash, entries, err := s.loadAuditChain(r.Context(), fromSeq, limit)
+		if err != nil {
+			standardErrorResponse(w, "internal_error", "Failed to load audit chain", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		export, err := newAuditExport(fromSeq, prevHash, entries, s.auditSigningKey)
+		if err != nil {
+			standardErrorResponse(w, "internal_error", "Failed to sign audit export", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="authz-audit-%d-%d.json"`, export.Manifest.FromSeq, export.Manifest.ToSeq))
+		jsonResponse(w, export, http.StatusOK)
+	})
+}
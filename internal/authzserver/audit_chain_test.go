@@ -0,0 +1,110 @@
+package authzserver
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAuditChain chains n permission checks the way pgAuditStore does
+func testAuditChain(t *testing.T, n int) []chainedAuditEntry {
+	t.Helper()
+	var entries []chainedAuditEntry
+	prevHash := ""
+	for i := 1; i <= n; i++ {
+		allowed := i%2 == 0
+		e := auditEntry{
+			ID:         uuid.New(),
+			Timestamp:  time.Date(2026, 3, 1, 12, 0, i, 123456789, time.UTC),
+			ActionType: "permission_check",
+			Result:     &allowed,
+			EntityType: "document",
+			EntityID:   "1",
+			Context:    json.RawMessage(`{"b": 1, "a": {"ip": "10.0.0.1"}}`),
+		}
+		hash, err := auditChainHash(int64(i), prevHash, e)
+		require.NoError(t, err)
+		entries = append(entries, chainedAuditEntry{Seq: int64(i), PrevHash: prevHash, Hash: hash, auditEntry: e})
+		prevHash = hash
+	}
+	return entries
+}
+
+func TestAuditChainHashIsStableAcrossStorage(t *testing.T) {
+	e := testAuditChain(t, 1)[0]
+
+	// PostgreSQL keeps microseconds and re-encodes JSONB with its own spacing
+	stored := e.auditEntry
+	stored.Timestamp = stored.Timestamp.Truncate(time.Microsecond)
+	stored.Context = json.RawMessage(`{"a":{"ip":"10.0.0.1"},"b":1}`)
+
+	hash, err := auditChainHash(e.Seq, e.PrevHash, stored)
+	require.NoError(t, err)
+	assert.Equal(t, e.Hash, hash)
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	assert.Nil(t, verifyAuditChain(0, "", testAuditChain(t, 3)))
+
+	edited := testAuditChain(t, 3)
+	edited[1].EntityID = "2"
+	assert.Equal(t, &AuditChainBreak{Seq: 2, Reason: "contents don't match the row's hash"},
+		verifyAuditChain(0, "", edited))
+
+	deleted := testAuditChain(t, 3)
+	deleted = append(deleted[:1], deleted[2:]...)
+	brk := verifyAuditChain(0, "", deleted)
+	require.NotNil(t, brk)
+	assert.Equal(t, int64(2), brk.Seq)
+
+	// Rehashing an edited row still breaks the link to the next one
+	rehashed := testAuditChain(t, 3)
+	rehashed[1].EntityID = "2"
+	rehashed[1].Hash, _ = auditChainHash(2, rehashed[1].PrevHash, rehashed[1].auditEntry)
+	brk = verifyAuditChain(0, "", rehashed)
+	require.NotNil(t, brk)
+	assert.Equal(t, int64(3), brk.Seq)
+}
+
+func TestAuditExportSignature(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	public := key.Public().(ed25519.PublicKey)
+
+	entries := testAuditChain(t, 4)
+	export, err := newAuditExport(3, entries[1].Hash, entries[2:], key)
+	require.NoError(t, err)
+	data, err := json.Marshal(export)
+	require.NoError(t, err)
+
+	manifest, err := VerifyAuditExport(data, public)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), manifest.FromSeq)
+	assert.Equal(t, int64(4), manifest.ToSeq)
+	assert.Equal(t, entries[3].Hash, manifest.LastHash)
+
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, err = VerifyAuditExport(data, otherPublic)
+	assert.ErrorContains(t, err, "signature is invalid")
+
+	export.Entries = export.Entries[:1]
+	data, err = json.Marshal(export)
+	require.NoError(t, err)
+	_, err = VerifyAuditExport(data, public)
+	assert.ErrorContains(t, err, "don't match the manifest")
+}
+
+func TestParseAuditSigningKey(t *testing.T) {
+	key, err := ParseAuditSigningKey("AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=")
+	require.NoError(t, err)
+	assert.Len(t, key, ed25519.PrivateKeySize)
+
+	_, err = ParseAuditSigningKey("c2hvcnQ=")
+	assert.ErrorContains(t, err, "32-byte")
+}
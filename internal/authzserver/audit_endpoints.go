@@ -1,4 +1,4 @@
-package main
+package authzserver
 
 import (
 	"context"
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dangerclosesec/supra/internal/budget"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
@@ -44,6 +45,10 @@ type AuditLogEntry struct {
 	RequestID   string                 `json:"request_id,omitempty"`
 	ClientIP    string                 `json:"client_ip,omitempty"`
 	UserAgent   string                 `json:"user_agent,omitempty"`
+	RemoteAddr  string                 `json:"remote_addr,omitempty"`
+	ClientCert  string                 `json:"client_cert,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+	APIKey      string                 `json:"api_key,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 }
 
@@ -100,7 +105,7 @@ func (s *AuthzService) addAuditLogEndpoints(mux *http.ServeMux) {
 
 // getAuditLogsHandler handles retrieving audit logs with filtering
 func (s *AuthzService) getAuditLogsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	ctx, cancel := s.startBudget(r.Context(), budget.Long)
 	defer cancel()
 
 	// Parse query parameters
@@ -182,7 +187,7 @@ func (s *AuthzService) getAuditLogsHandler(w http.ResponseWriter, r *http.Reques
 
 // getAuditLogByIDHandler handles retrieving a specific audit log by ID
 func (s *AuthzService) getAuditLogByIDHandler(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
 	defer cancel()
 
 	entry, err := s.getAuditLogByID(ctx, id)
@@ -276,7 +281,7 @@ func (s *AuthzService) queryAuditLogs(ctx context.Context, params AuditLogQueryP
 			id, timestamp, action_type, result, 
 			entity_type, entity_id, subject_type, subject_id,
 			relation, permission, context, request_id, 
-			client_ip, user_agent, created_at
+			client_ip, user_agent, remote_addr, client_cert, deprecated, api_key, created_at
 		FROM 
 			authz_audit_logs 
 		%s
@@ -303,13 +308,13 @@ func (s *AuthzService) queryAuditLogs(ctx context.Context, params AuditLogQueryP
 		var contextBytes []byte
 		
 		// Use sql.NullString for fields that may be NULL
-		var subjectType, subjectID, relation, permission, requestID, clientIP, userAgent sql.NullString
+		var subjectType, subjectID, relation, permission, requestID, clientIP, userAgent, remoteAddr, clientCert, apiKey sql.NullString
 
 		err := rows.Scan(
 			&log.ID, &log.Timestamp, &log.ActionType, &log.Result,
 			&log.EntityType, &log.EntityID, &subjectType, &subjectID,
 			&relation, &permission, &contextBytes, &requestID,
-			&clientIP, &userAgent, &log.CreatedAt,
+			&clientIP, &userAgent, &remoteAddr, &clientCert, &log.Deprecated, &apiKey, &log.CreatedAt,
 		)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan audit log: %w", err)
@@ -337,6 +342,15 @@ func (s *AuthzService) queryAuditLogs(ctx context.Context, params AuditLogQueryP
 		if userAgent.Valid {
 			log.UserAgent = userAgent.String
 		}
+		if remoteAddr.Valid {
+			log.RemoteAddr = remoteAddr.String
+		}
+		if clientCert.Valid {
+			log.ClientCert = clientCert.String
+		}
+		if apiKey.Valid {
+			log.APIKey = apiKey.String
+		}
 
 		// Parse context JSON
 		if len(contextBytes) > 0 {
@@ -368,7 +382,7 @@ func (s *AuthzService) getAuditLogByID(ctx context.Context, id uuid.UUID) (*Audi
 			id, timestamp, action_type, result, 
 			entity_type, entity_id, subject_type, subject_id,
 			relation, permission, context, request_id, 
-			client_ip, user_agent, created_at
+			client_ip, user_agent, remote_addr, client_cert, deprecated, api_key, created_at
 		FROM 
 			authz_audit_logs 
 		WHERE 
@@ -379,13 +393,13 @@ func (s *AuthzService) getAuditLogByID(ctx context.Context, id uuid.UUID) (*Audi
 	var contextBytes []byte
 	
 	// Use sql.NullString for fields that may be NULL
-	var subjectType, subjectID, relation, permission, requestID, clientIP, userAgent sql.NullString
+	var subjectType, subjectID, relation, permission, requestID, clientIP, userAgent, remoteAddr, clientCert, apiKey sql.NullString
 
 	err := s.graph.Pool.QueryRow(ctx, query, id).Scan(
 		&log.ID, &log.Timestamp, &log.ActionType, &log.Result,
 		&log.EntityType, &log.EntityID, &subjectType, &subjectID,
 		&relation, &permission, &contextBytes, &requestID,
-		&clientIP, &userAgent, &log.CreatedAt,
+		&clientIP, &userAgent, &remoteAddr, &clientCert, &log.Deprecated, &apiKey, &log.CreatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -413,6 +427,15 @@ func (s *AuthzService) getAuditLogByID(ctx context.Context, id uuid.UUID) (*Audi
 	if userAgent.Valid {
 		log.UserAgent = userAgent.String
 	}
+	if remoteAddr.Valid {
+		log.RemoteAddr = remoteAddr.String
+	}
+	if clientCert.Valid {
+		log.ClientCert = clientCert.String
+	}
+	if apiKey.Valid {
+		log.APIKey = apiKey.String
+	}
 
 	// Parse context JSON
 	if len(contextBytes) > 0 {
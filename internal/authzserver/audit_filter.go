@@ -0,0 +1,75 @@
+package authzserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// redactedValue replaces the value of a redacted context key
+const redactedValue = "[REDACTED]"
+
+// sampled reports whether a permission check with the given result is
+// recorded. Denials and allows are sampled separately, so a small share of
+// high-volume allows can be kept alongside every denial.
+func (l *AuthzAuditLogger) sampled(allowed bool) bool {
+	rate := l.opts.DeniedSampleRate
+	if allowed {
+		rate = l.opts.AllowedSampleRate
+	}
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// scrub returns a copy of data with the configured keys redacted or hashed.
+// A key matches either its dotted path from the top of data, e.g.
+// "request.email", or, when it has no dots, a key of that name at any depth.
+func (l *AuthzAuditLogger) scrub(data map[string]interface{}) map[string]interface{} {
+	if data == nil || (len(l.opts.RedactKeys) == 0 && len(l.opts.HashKeys) == 0) {
+		return data
+	}
+	return l.scrubMap(data, "")
+}
+
+func (l *AuthzAuditLogger) scrubMap(data map[string]interface{}, prefix string) map[string]interface{} {
+	scrubbed := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		switch {
+		case matchesAuditKey(l.opts.RedactKeys, key, path):
+			scrubbed[key] = redactedValue
+		case matchesAuditKey(l.opts.HashKeys, key, path):
+			scrubbed[key] = hashAuditValue(value)
+		default:
+			if nested, ok := value.(map[string]interface{}); ok {
+				value = l.scrubMap(nested, path)
+			}
+			scrubbed[key] = value
+		}
+	}
+	return scrubbed
+}
+
+func matchesAuditKey(keys []string, key, path string) bool {
+	for _, k := range keys {
+		if k == path || (k == key && !strings.Contains(k, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashAuditValue replaces a value with its SHA-256, keeping equal values
+// correlatable across entries without storing them
+func hashAuditValue(value interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
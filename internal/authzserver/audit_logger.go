@@ -0,0 +1,447 @@
+package authzserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/clientip"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrAuditQueueFull is returned when an entry could neither be queued before
+// the enqueue timeout nor spooled to disk
+var ErrAuditQueueFull = errors.New("audit queue full")
+
+// ErrAuditLoggerClosed is returned for entries logged after Close
+var ErrAuditLoggerClosed = errors.New("audit logger closed")
+
+// AuditLoggerOptions tune how audit entries are queued and written
+type AuditLoggerOptions struct {
+	// QueueSize bounds the entries waiting to be written
+	QueueSize int
+	// BatchSize is the most entries written in one INSERT
+	BatchSize int
+	// FlushInterval is the longest an entry waits for a batch to fill
+	FlushInterval time.Duration
+	// EnqueueTimeout is how long a caller waits for room in a full queue
+	// before the entry is spooled
+	EnqueueTimeout time.Duration
+	// SpoolPath holds entries that could not be written to the database and
+	// is replayed on start; empty disables spooling
+	SpoolPath string
+	// AllowedSampleRate and DeniedSampleRate are the fractions of allowed
+	// and denied permission checks recorded; zero records all of them.
+	// Mutations are always recorded.
+	AllowedSampleRate float64
+	DeniedSampleRate  float64
+	// RedactKeys and HashKeys name context keys whose values are replaced by
+	// a placeholder or by their SHA-256 before the entry is stored
+	RedactKeys []string
+	HashKeys   []string
+	// ClientIPs resolves callers' addresses behind trusted proxies; nil
+	// records the address each connection came from
+	ClientIPs *clientip.Resolver
+}
+
+// DefaultAuditLoggerOptions returns the options used by NewAuthzAuditLogger
+func DefaultAuditLoggerOptions() AuditLoggerOptions {
+	return AuditLoggerOptions{
+		QueueSize:      10000,
+		BatchSize:      200,
+		FlushInterval:  time.Second,
+		EnqueueTimeout: 250 * time.Millisecond,
+	}
+}
+
+// AuthzAuditLogger handles audit logging for the authorization service.
+// Entries are queued and written in batches by a background writer, which
+// retries until the database accepts them and moves entries it rejects to a
+// dead-letter table. Close flushes the queue.
+type AuthzAuditLogger struct {
+	store auditStore
+	opts  AuditLoggerOptions
+	spool *auditSpool
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan auditEntry
+	abort  chan struct{}
+	done   chan struct{}
+
+	failures auditFailures
+}
+
+// auditFailures counts what went wrong writing the audit log
+type auditFailures struct {
+	writeErrors  atomic.Int64
+	deadLettered atomic.Int64
+	dropped      atomic.Int64
+}
+
+// auditFailureStats is a snapshot of auditFailures
+type auditFailureStats struct {
+	// WriteErrors are failed attempts to write a batch, which is retried
+	WriteErrors int64
+	// DeadLettered are entries the database rejected outright
+	DeadLettered int64
+	// Dropped are entries lost for good: neither written, spooled nor
+	// dead-lettered
+	Dropped int64
+}
+
+// failureStats returns the failures counted since the logger started
+func (l *AuthzAuditLogger) failureStats() auditFailureStats {
+	return auditFailureStats{
+		WriteErrors:  l.failures.writeErrors.Load(),
+		DeadLettered: l.failures.deadLettered.Load(),
+		Dropped:      l.failures.dropped.Load(),
+	}
+}
+
+// NewAuthzAuditLogger creates a new authorization audit logger
+func NewAuthzAuditLogger(pool *pgxpool.Pool) *AuthzAuditLogger {
+	return NewAuthzAuditLoggerWithOptions(pool, DefaultAuditLoggerOptions())
+}
+
+// NewAuthzAuditLoggerWithOptions creates an audit logger with custom
+// batching and spooling
+func NewAuthzAuditLoggerWithOptions(pool *pgxpool.Pool, opts AuditLoggerOptions) *AuthzAuditLogger {
+	return newAuditLogger(&pgAuditStore{pool: pool}, opts)
+}
+
+func newAuditLogger(store auditStore, opts AuditLoggerOptions) *AuthzAuditLogger {
+	defaults := DefaultAuditLoggerOptions()
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaults.QueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaults.FlushInterval
+	}
+	if opts.EnqueueTimeout <= 0 {
+		opts.EnqueueTimeout = defaults.EnqueueTimeout
+	}
+
+	l := &AuthzAuditLogger{
+		store: store,
+		opts:  opts,
+		queue: make(chan auditEntry, opts.QueueSize),
+		abort: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if opts.SpoolPath != "" {
+		l.spool = &auditSpool{path: opts.SpoolPath}
+	}
+
+	go l.run()
+	return l
+}
+
+// Close stops accepting entries and waits for queued ones to be written.
+// If ctx expires first, whatever is still pending is spooled.
+func (l *AuthzAuditLogger) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		<-l.done
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		close(l.abort)
+		<-l.done
+		return ctx.Err()
+	}
+}
+
+// enqueue hands an entry to the writer, waiting up to EnqueueTimeout for
+// room before spilling it to the spool
+func (l *AuthzAuditLogger) enqueue(ctx context.Context, entry auditEntry) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return ErrAuditLoggerClosed
+	}
+
+	select {
+	case l.queue <- entry:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(l.opts.EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.queue <- entry:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	if l.spool != nil {
+		err := l.spool.append([]auditEntry{entry})
+		if err == nil {
+			return nil
+		}
+		log.Printf("Failed to spool audit entry: %v", err)
+	}
+	l.failures.dropped.Add(1)
+	return ErrAuditQueueFull
+}
+
+// auditEntry is one row of authz_audit_logs. It is also the JSON stored in
+// the spool and the dead-letter table.
+type auditEntry struct {
+	ID          uuid.UUID       `json:"id"`
+	Timestamp   time.Time       `json:"timestamp"`
+	ActionType  string          `json:"action_type"`
+	Result      *bool           `json:"result,omitempty"`
+	EntityType  string          `json:"entity_type,omitempty"`
+	EntityID    string          `json:"entity_id,omitempty"`
+	SubjectType string          `json:"subject_type,omitempty"`
+	SubjectID   string          `json:"subject_id,omitempty"`
+	Relation    string          `json:"relation,omitempty"`
+	Permission  string          `json:"permission,omitempty"`
+	Context     json.RawMessage `json:"context,omitempty"`
+	RequestID   string          `json:"request_id,omitempty"`
+	ClientIP    string          `json:"client_ip,omitempty"`
+	UserAgent   string          `json:"user_agent,omitempty"`
+	// RemoteAddr is the connection's peer, which ClientIP differs from when
+	// a trusted proxy forwarded the request
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// ClientCert is who the caller's verified TLS certificate names
+	ClientCert string `json:"client_cert,omitempty"`
+	// Deprecated marks checks of a permission the schema deprecates
+	Deprecated bool `json:"deprecated,omitempty"`
+	// APIKey names the API key the caller authenticated with
+	APIKey string `json:"api_key,omitempty"`
+}
+
+// newAuditEntry captures the request details up front, since the request
+// must not be touched once its handler returns
+func newAuditEntry(actionType string, req *http.Request, clientIPs *clientip.Resolver) auditEntry {
+	entry := auditEntry{
+		ID:         uuid.New(),
+		Timestamp:  time.Now().UTC(),
+		ActionType: actionType,
+	}
+	if req != nil {
+		entry.RequestID = req.Header.Get("X-Request-ID")
+		entry.ClientIP = clientIPs.Resolve(req)
+		entry.RemoteAddr = req.RemoteAddr
+		entry.ClientCert = clientip.CertIdentity(req.TLS)
+		entry.UserAgent = req.UserAgent()
+		if key, ok := apiKeyFromContext(req.Context()); ok {
+			entry.APIKey = key.Name
+		}
+	}
+	return entry
+}
+
+// validate rejects entries that can never be stored
+func (e auditEntry) validate() error {
+	if e.ActionType == "" {
+		return errors.New("missing action_type")
+	}
+	if len(e.Context) > 0 && !json.Valid(e.Context) {
+		return errors.New("context is not valid JSON")
+	}
+	return nil
+}
+
+// LogPermissionCheck logs a permission check operation, subject to the
+// configured sampling
+func (l *AuthzAuditLogger) LogPermissionCheck(
+	ctx context.Context,
+	subject model.Subject,
+	permission string,
+	object model.Entity,
+	result bool,
+	contextData *map[string]interface{},
+	req *http.Request,
+) error {
+	if !l.sampled(result) {
+		return nil
+	}
+	return l.logPermissionCheck(ctx, subject, permission, object, result, contextData, req, false)
+}
+
+// LogDeprecatedPermissionCheck logs a check of a deprecated permission.
+// These are never sampled away, since they are how the remaining callers
+// are found before the permission is removed.
+func (l *AuthzAuditLogger) LogDeprecatedPermissionCheck(
+	ctx context.Context,
+	subject model.Subject,
+	permission string,
+	object model.Entity,
+	result bool,
+	contextData *map[string]interface{},
+	req *http.Request,
+) error {
+	return l.logPermissionCheck(ctx, subject, permission, object, result, contextData, req, true)
+}
+
+// LogSensitivePermissionCheck logs an allowed check of a sensitive
+// permission. These are never sampled away: the notification sent for one
+// is best effort, and the audit log is its durable record.
+func (l *AuthzAuditLogger) LogSensitivePermissionCheck(
+	ctx context.Context,
+	subject model.Subject,
+	permission string,
+	object model.Entity,
+	result bool,
+	contextData *map[string]interface{},
+	req *http.Request,
+) error {
+	return l.logPermissionCheck(ctx, subject, permission, object, result, contextData, req, false)
+}
+
+func (l *AuthzAuditLogger) logPermissionCheck(
+	ctx context.Context,
+	subject model.Subject,
+	permission string,
+	object model.Entity,
+	result bool,
+	contextData *map[string]interface{},
+	req *http.Request,
+	deprecated bool,
+) error {
+
+	if contextData != nil {
+		scrubbed := l.scrub(*contextData)
+		contextData = &scrubbed
+	}
+
+	// Convert context data to JSON
+	contextJSON, err := json.Marshal(contextData)
+	if err != nil {
+		log.Printf("Failed to marshal context data: %v", err)
+		contextJSON = []byte("{}")
+	}
+
+	entry := newAuditEntry("permission_check", req, l.opts.ClientIPs)
+	entry.Result = &result
+	entry.EntityType, entry.EntityID = object.Type, object.ID
+	entry.SubjectType, entry.SubjectID = subject.Type, subject.ID
+	entry.Permission = permission
+	entry.Context = contextJSON
+	entry.Deprecated = deprecated
+
+	return l.enqueue(ctx, entry)
+}
+
+// LogEntityCreate logs an entity creation operation
+func (l *AuthzAuditLogger) LogEntityCreate(
+	ctx context.Context,
+	entityType string,
+	entityID string,
+	attributes map[string]interface{},
+	req *http.Request,
+) error {
+	// Convert attributes to JSON
+	attributesJSON, err := json.Marshal(l.scrub(attributes))
+	if err != nil {
+		log.Printf("Failed to marshal entity attributes: %v", err)
+		attributesJSON = []byte("{}")
+	}
+
+	entry := newAuditEntry("entity_create", req, l.opts.ClientIPs)
+	entry.EntityType, entry.EntityID = entityType, entityID
+	entry.Context = attributesJSON
+
+	return l.enqueue(ctx, entry)
+}
+
+// LogEntityUpdate logs an upsert that replaced an entity's properties
+func (l *AuthzAuditLogger) LogEntityUpdate(
+	ctx context.Context,
+	entityType string,
+	entityID string,
+	attributes map[string]interface{},
+	req *http.Request,
+) error {
+	attributesJSON, err := json.Marshal(l.scrub(attributes))
+	if err != nil {
+		log.Printf("Failed to marshal entity attributes: %v", err)
+		attributesJSON = []byte("{}")
+	}
+
+	entry := newAuditEntry("entity_update", req, l.opts.ClientIPs)
+	entry.EntityType, entry.EntityID = entityType, entityID
+	entry.Context = attributesJSON
+
+	return l.enqueue(ctx, entry)
+}
+
+// LogEntityDelete logs an entity deletion operation
+func (l *AuthzAuditLogger) LogEntityDelete(
+	ctx context.Context,
+	entityType string,
+	entityID string,
+	req *http.Request,
+) error {
+	entry := newAuditEntry("entity_delete", req, l.opts.ClientIPs)
+	entry.EntityType, entry.EntityID = entityType, entityID
+
+	return l.enqueue(ctx, entry)
+}
+
+// LogRelationCreate logs a relation creation operation, recording the
+// relation's metadata as the entry context
+func (l *AuthzAuditLogger) LogRelationCreate(
+	ctx context.Context,
+	object model.Entity,
+	relation string,
+	subject model.Subject,
+	metadata map[string]interface{},
+	req *http.Request,
+) error {
+	entry := newAuditEntry("relation_create", req, l.opts.ClientIPs)
+	entry.EntityType, entry.EntityID = object.Type, object.ID
+	entry.SubjectType, entry.SubjectID = subject.Type, subject.ID
+	entry.Relation = relation
+	if len(metadata) > 0 {
+		metadataJSON, err := json.Marshal(l.scrub(metadata))
+		if err != nil {
+			log.Printf("Failed to marshal relation metadata: %v", err)
+		} else {
+			entry.Context = metadataJSON
+		}
+	}
+
+	return l.enqueue(ctx, entry)
+}
+
+// LogRelationDelete logs a relation deletion operation
+func (l *AuthzAuditLogger) LogRelationDelete(
+	ctx context.Context,
+	object model.Entity,
+	relation string,
+	subject model.Subject,
+	req *http.Request,
+) error {
+	entry := newAuditEntry("relation_delete", req, l.opts.ClientIPs)
+	entry.EntityType, entry.EntityID = object.Type, object.ID
+	entry.SubjectType, entry.SubjectID = subject.Type, subject.ID
+	entry.Relation = relation
+
+	return l.enqueue(ctx, entry)
+}
@@ -0,0 +1,265 @@
+package authzserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/clientip"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuditStore records writes and fails according to its hooks
+type fakeAuditStore struct {
+	mu          sync.Mutex
+	batches     [][]auditEntry
+	deadLetters []string
+	// fail returns an error for a write, or nil to accept it
+	fail func(entries []auditEntry) error
+}
+
+func (s *fakeAuditStore) insert(ctx context.Context, entries []auditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		if err := s.fail(entries); err != nil {
+			return err
+		}
+	}
+	s.batches = append(s.batches, append([]auditEntry(nil), entries...))
+	return nil
+}
+
+func (s *fakeAuditStore) deadLetter(ctx context.Context, payload []byte, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = append(s.deadLetters, reason)
+	return nil
+}
+
+func (s *fakeAuditStore) written() []auditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var all []auditEntry
+	for _, batch := range s.batches {
+		all = append(all, batch...)
+	}
+	return all
+}
+
+func logRelations(t *testing.T, l *AuthzAuditLogger, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		err := l.LogRelationCreate(context.Background(),
+			model.Entity{Type: "organization", ID: "acme"}, "member",
+			model.Subject{Type: "user", ID: "alice"}, nil, nil)
+		require.NoError(t, err)
+	}
+}
+
+func TestAuditLoggerBatchesAndFlushesOnClose(t *testing.T) {
+	store := &fakeAuditStore{}
+	l := newAuditLogger(store, AuditLoggerOptions{BatchSize: 10, FlushInterval: time.Hour})
+
+	logRelations(t, l, 25)
+	require.NoError(t, l.Close(context.Background()))
+
+	assert.Len(t, store.written(), 25)
+	require.Len(t, store.batches, 3)
+	assert.Len(t, store.batches[0], 10)
+	assert.Len(t, store.batches[2], 5)
+
+	assert.ErrorIs(t, l.LogEntityDelete(context.Background(), "user", "alice", nil), ErrAuditLoggerClosed)
+}
+
+func TestAuditLoggerDeadLettersRejectedEntries(t *testing.T) {
+	store := &fakeAuditStore{fail: func(entries []auditEntry) error {
+		for _, e := range entries {
+			if e.SubjectID == "bad" {
+				return &pgconn.PgError{Code: "22001", Message: "value too long"}
+			}
+		}
+		return nil
+	}}
+	l := newAuditLogger(store, AuditLoggerOptions{BatchSize: 10, FlushInterval: time.Hour})
+
+	logRelations(t, l, 2)
+	require.NoError(t, l.LogRelationCreate(context.Background(),
+		model.Entity{Type: "organization", ID: "acme"}, "member",
+		model.Subject{Type: "user", ID: "bad"}, nil, nil))
+	require.NoError(t, l.Close(context.Background()))
+
+	assert.Len(t, store.written(), 2)
+	require.Len(t, store.deadLetters, 1)
+	assert.Contains(t, store.deadLetters[0], "value too long")
+	assert.Equal(t, int64(1), l.failureStats().DeadLettered)
+}
+
+func TestAuditLoggerRetriesTransientFailures(t *testing.T) {
+	attempts := 0
+	store := &fakeAuditStore{fail: func(entries []auditEntry) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}}
+	l := newAuditLogger(store, AuditLoggerOptions{BatchSize: 10, FlushInterval: time.Hour})
+
+	logRelations(t, l, 3)
+	require.NoError(t, l.Close(context.Background()))
+
+	assert.Len(t, store.written(), 3)
+	assert.Empty(t, store.deadLetters)
+	assert.Equal(t, auditFailureStats{WriteErrors: 2}, l.failureStats())
+}
+
+func TestAuditLoggerSpoolsOnAbortAndReplays(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "audit.spool")
+
+	down := &fakeAuditStore{fail: func([]auditEntry) error { return errors.New("database down") }}
+	l := newAuditLogger(down, AuditLoggerOptions{BatchSize: 10, FlushInterval: time.Hour, SpoolPath: spool})
+	logRelations(t, l, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Close(ctx), context.DeadlineExceeded)
+
+	_, err := os.Stat(spool)
+	require.NoError(t, err, "pending entries should be spooled")
+
+	up := &fakeAuditStore{}
+	l = newAuditLogger(up, AuditLoggerOptions{BatchSize: 10, FlushInterval: time.Hour, SpoolPath: spool})
+	require.NoError(t, l.Close(context.Background()))
+
+	assert.Len(t, up.written(), 4)
+	_, err = os.Stat(spool + ".replay")
+	assert.True(t, os.IsNotExist(err), "replay file should be removed once written")
+}
+
+func TestAuditLoggerRecordsRelationMetadata(t *testing.T) {
+	store := &fakeAuditStore{}
+	l := newAuditLogger(store, AuditLoggerOptions{FlushInterval: time.Hour})
+
+	require.NoError(t, l.LogRelationCreate(context.Background(),
+		model.Entity{Type: "organization", ID: "acme"}, "admin",
+		model.Subject{Type: "user", ID: "alice"},
+		map[string]interface{}{"granted_by": "bob", "ticket_url": "https://tickets.example.com/42"}, nil))
+	require.NoError(t, l.Close(context.Background()))
+
+	written := store.written()
+	require.Len(t, written, 1)
+	assert.JSONEq(t, `{"granted_by":"bob","ticket_url":"https://tickets.example.com/42"}`, string(written[0].Context))
+}
+
+func TestAuditLoggerSamplesPermissionChecks(t *testing.T) {
+	store := &fakeAuditStore{}
+	l := newAuditLogger(store, AuditLoggerOptions{FlushInterval: time.Hour, AllowedSampleRate: 0.01})
+
+	subject := model.Subject{Type: "user", ID: "alice"}
+	object := model.Entity{Type: "document", ID: "plan"}
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, l.LogPermissionCheck(context.Background(), subject, "view", object, true, nil, nil))
+	}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, l.LogPermissionCheck(context.Background(), subject, "edit", object, false, nil, nil))
+	}
+	require.NoError(t, l.LogEntityDelete(context.Background(), "document", "plan", nil))
+	require.NoError(t, l.Close(context.Background()))
+
+	counts := map[string]int{}
+	for _, e := range store.written() {
+		counts[e.ActionType+":"+e.Permission]++
+	}
+	assert.Less(t, counts["permission_check:view"], 100, "about 1% of allowed checks should be kept")
+	assert.Equal(t, 20, counts["permission_check:edit"], "every denial should be kept")
+	assert.Equal(t, 1, counts["entity_delete:"], "mutations should not be sampled")
+}
+
+func TestAuditLoggerKeepsDeprecatedPermissionChecks(t *testing.T) {
+	store := &fakeAuditStore{}
+	l := newAuditLogger(store, AuditLoggerOptions{FlushInterval: time.Hour, AllowedSampleRate: 0.0001})
+
+	subject := model.Subject{Type: "user", ID: "alice"}
+	object := model.Entity{Type: "document", ID: "plan"}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.LogDeprecatedPermissionCheck(context.Background(), subject, "view", object, true, nil, nil))
+	}
+	require.NoError(t, l.Close(context.Background()))
+
+	written := store.written()
+	require.Len(t, written, 10, "deprecated checks should not be sampled")
+	for _, e := range written {
+		assert.True(t, e.Deprecated)
+	}
+}
+
+func TestAuditLoggerRedactsAndHashesContext(t *testing.T) {
+	store := &fakeAuditStore{}
+	l := newAuditLogger(store, AuditLoggerOptions{
+		FlushInterval: time.Hour,
+		RedactKeys:    []string{"ssn", "request.token"},
+		HashKeys:      []string{"email"},
+	})
+
+	contextData := map[string]interface{}{
+		"request": map[string]interface{}{
+			"token": "secret",
+			"email": "alice@example.com",
+			"ip":    "10.0.0.1",
+		},
+		"token": "kept",
+		"ssn":   "123-45-6789",
+	}
+	require.NoError(t, l.LogPermissionCheck(context.Background(),
+		model.Subject{Type: "user", ID: "alice"}, "view", model.Entity{Type: "document", ID: "plan"},
+		true, &contextData, nil))
+	require.NoError(t, l.Close(context.Background()))
+
+	written := store.written()
+	require.Len(t, written, 1)
+	assert.JSONEq(t, `{
+		"request": {
+			"token": "[REDACTED]",
+			"email": "sha256:ff8d9819fc0e12bf0d24892e45987e249a28dce836a85cad60e28eaaa8c6d976",
+			"ip": "10.0.0.1"
+		},
+		"token": "kept",
+		"ssn": "[REDACTED]"
+	}`, string(written[0].Context))
+	assert.Equal(t, "secret", contextData["request"].(map[string]interface{})["token"], "the caller's context should not be modified")
+}
+
+func TestAuditLoggerRecordsClientBehindProxy(t *testing.T) {
+	resolver, err := clientip.New([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	store := &fakeAuditStore{}
+	l := newAuditLogger(store, AuditLoggerOptions{FlushInterval: time.Hour, ClientIPs: resolver})
+
+	req := httptest.NewRequest(http.MethodPost, "/entity", nil)
+	req.RemoteAddr = "10.0.3.4:40122"
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 198.51.100.9")
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	require.NoError(t, l.LogEntityCreate(context.Background(), "document", "d1", nil, req))
+	require.NoError(t, l.Close(context.Background()))
+
+	written := store.written()
+	require.Len(t, written, 1)
+	assert.Equal(t, "198.51.100.9", written[0].ClientIP)
+	assert.Equal(t, "10.0.3.4:40122", written[0].RemoteAddr)
+	assert.Equal(t, "CN=billing", written[0].ClientCert)
+}
@@ -0,0 +1,444 @@
+package authzserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// auditColumns is the number of bind parameters per audit row
+const auditColumns = 21
+
+// maxAuditBatchSize keeps a batch under PostgreSQL's 65535 parameter limit
+const maxAuditBatchSize = 65535 / auditColumns
+
+// auditStore persists audit entries
+type auditStore interface {
+	// insert writes entries in one statement, skipping IDs already stored
+	insert(ctx context.Context, entries []auditEntry) error
+	// deadLetter records a payload the audit table rejected
+	deadLetter(ctx context.Context, payload []byte, reason string) error
+}
+
+// run is the background writer: it batches queued entries and flushes them
+// when a batch fills, on every FlushInterval and when the queue closes
+func (l *AuthzAuditLogger) run() {
+	defer close(l.done)
+
+	l.replaySpool()
+
+	ticker := time.NewTicker(l.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batchSize := min(l.opts.BatchSize, maxAuditBatchSize)
+	batch := make([]auditEntry, 0, batchSize)
+
+	for {
+		select {
+		case entry, ok := <-l.queue:
+			if !ok {
+				l.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= batchSize {
+				l.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				l.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes entries, retrying with backoff until the database takes them.
+// Entries the database rejects outright are dead-lettered rather than
+// retried; if the logger is aborted mid-retry the rest are spooled.
+func (l *AuthzAuditLogger) flush(entries []auditEntry) {
+	pending := make([]auditEntry, 0, len(entries))
+	for _, entry := range entries {
+		if err := entry.validate(); err != nil {
+			l.deadLetter(entry, err)
+			continue
+		}
+		pending = append(pending, entry)
+	}
+
+	backoff := 100 * time.Millisecond
+	for len(pending) > 0 {
+		err := l.insert(pending)
+		if err == nil {
+			return
+		}
+		if isRejectedAuditEntry(err) {
+			// Find the offending rows by writing the batch one entry at a time
+			pending, err = l.insertEach(pending)
+			if err == nil {
+				return
+			}
+		}
+
+		l.failures.writeErrors.Add(1)
+		log.Printf("Failed to write %d audit entries, retrying in %s: %v", len(pending), backoff, err)
+		select {
+		case <-l.abort:
+			l.spoolPending(pending)
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 5*time.Second)
+	}
+}
+
+func (l *AuthzAuditLogger) insert(entries []auditEntry) error {
+	ctx, cancel := context.WithTimeout(dbtrace.WithLabel(context.Background(), "audit.insert"), 10*time.Second)
+	defer cancel()
+	return l.store.insert(ctx, entries)
+}
+
+// insertEach writes entries individually, dead-lettering rejected ones. It
+// stops at the first transient failure and returns the entries left.
+func (l *AuthzAuditLogger) insertEach(entries []auditEntry) ([]auditEntry, error) {
+	for i, entry := range entries {
+		err := l.insert([]auditEntry{entry})
+		if err == nil {
+			continue
+		}
+		if isRejectedAuditEntry(err) {
+			l.deadLetter(entry, err)
+			continue
+		}
+		return entries[i:], err
+	}
+	return nil, nil
+}
+
+func (l *AuthzAuditLogger) deadLetter(entry auditEntry, reason error) {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		l.failures.dropped.Add(1)
+		log.Printf("Dropping unencodable audit entry %s: %v", entry.ID, reason)
+		return
+	}
+	l.deadLetterPayload(payload, reason)
+}
+
+func (l *AuthzAuditLogger) deadLetterPayload(payload []byte, reason error) {
+	ctx, cancel := context.WithTimeout(dbtrace.WithLabel(context.Background(), "audit.dead_letter"), 10*time.Second)
+	defer cancel()
+
+	if err := l.store.deadLetter(ctx, payload, reason.Error()); err != nil {
+		l.failures.dropped.Add(1)
+		log.Printf("Failed to dead-letter audit entry (%v): %v: %s", reason, err, payload)
+		return
+	}
+	l.failures.deadLettered.Add(1)
+}
+
+func (l *AuthzAuditLogger) spoolPending(entries []auditEntry) {
+	if l.spool == nil {
+		l.failures.dropped.Add(int64(len(entries)))
+		log.Printf("Dropping %d audit entries: database unavailable and no spool configured", len(entries))
+		return
+	}
+	if err := l.spool.append(entries); err != nil {
+		l.failures.dropped.Add(int64(len(entries)))
+		log.Printf("Dropping %d audit entries: spooling failed: %v", len(entries), err)
+	}
+}
+
+// replaySpool writes entries left in the spool by a previous run
+func (l *AuthzAuditLogger) replaySpool() {
+	if l.spool == nil {
+		return
+	}
+
+	entries, malformed, err := l.spool.load()
+	if err != nil {
+		log.Printf("Failed to read audit spool %s: %v", l.spool.path, err)
+		return
+	}
+	if len(entries) == 0 && len(malformed) == 0 {
+		return
+	}
+	log.Printf("Replaying %d spooled audit entries", len(entries))
+
+	for _, line := range malformed {
+		l.deadLetterPayload(line, errors.New("malformed spool entry"))
+	}
+
+	batchSize := min(l.opts.BatchSize, maxAuditBatchSize)
+	for start := 0; start < len(entries); start += batchSize {
+		l.flush(entries[start:min(start+batchSize, len(entries))])
+	}
+
+	// Anything that could not be written was spooled again by flush
+	if err := l.spool.clearReplay(); err != nil {
+		log.Printf("Failed to remove replayed audit spool: %v", err)
+	}
+}
+
+// isRejectedAuditEntry reports whether the database refused the data itself
+// (data exceptions and constraint violations), so retrying cannot succeed
+func isRejectedAuditEntry(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+}
+
+// pgAuditStore writes audit entries to authz_audit_logs
+type pgAuditStore struct {
+	pool *pgxpool.Pool
+}
+
+// insert appends entries to the audit hash chain. Writers take turns under
+// an advisory lock so every replica extends the same chain; entries a spool
+// replay resends are left out before sequence numbers are handed out, so
+// the chain has no gaps.
+func (s *pgAuditStore) insert(ctx context.Context, entries []auditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", auditChainLock); err != nil {
+		return err
+	}
+
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID.String()
+	}
+	rows, err := tx.Query(ctx, "SELECT id::text FROM authz_audit_logs WHERE id = ANY($1::uuid[])", ids)
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		stored[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var seq int64
+	var prevHash string
+	err = tx.QueryRow(ctx, `
+		SELECT chain_seq, hash FROM authz_audit_logs
+		WHERE chain_seq IS NOT NULL
+		ORDER BY chain_seq DESC
+		LIMIT 1
+	`).Scan(&seq, &prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	var query strings.Builder
+	query.WriteString(`
+		INSERT INTO authz_audit_logs (
+			id, timestamp, action_type, result, entity_type, entity_id, subject_type, subject_id,
+			relation, permission, context, request_id, client_ip, user_agent,
+			remote_addr, client_cert, deprecated, api_key, chain_seq, prev_hash, hash
+		) VALUES `)
+
+	args := make([]interface{}, 0, len(entries)*auditColumns)
+	row := 0
+	for _, e := range entries {
+		if stored[e.ID.String()] {
+			continue
+		}
+		stored[e.ID.String()] = true
+
+		e.Timestamp = e.Timestamp.UTC().Truncate(time.Microsecond)
+		seq++
+		hash, err := auditChainHash(seq, prevHash, e)
+		if err != nil {
+			return err
+		}
+
+		if row > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for c := 0; c < auditColumns; c++ {
+			if c > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", row*auditColumns+c+1)
+		}
+		query.WriteString(")")
+		row++
+
+		var contextJSON interface{}
+		if len(e.Context) > 0 {
+			contextJSON = []byte(e.Context)
+		}
+		args = append(args,
+			e.ID, e.Timestamp, e.ActionType, e.Result,
+			nullIfEmpty(e.EntityType), nullIfEmpty(e.EntityID),
+			nullIfEmpty(e.SubjectType), nullIfEmpty(e.SubjectID),
+			nullIfEmpty(e.Relation), nullIfEmpty(e.Permission), contextJSON,
+			e.RequestID, e.ClientIP, e.UserAgent,
+			nullIfEmpty(e.RemoteAddr), nullIfEmpty(e.ClientCert), e.Deprecated, nullIfEmpty(e.APIKey), seq, prevHash, hash,
+		)
+		prevHash = hash
+	}
+	if row == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, query.String(), args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *pgAuditStore) deadLetter(ctx context.Context, payload []byte, reason string) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO authz_audit_dead_letters (payload, error) VALUES ($1, $2)
+	`, payload, reason)
+	return err
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// auditSpool is an append-only file of JSON-encoded entries awaiting a
+// database write. load moves it aside to <path>.replay so entries spooled
+// during the replay are kept apart from the ones being replayed.
+type auditSpool struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *auditSpool) replayPath() string {
+	return s.path + ".replay"
+}
+
+func (s *auditSpool) append(entries []auditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// load returns the spooled entries and any lines that could not be decoded
+func (s *auditSpool) load() ([]auditEntry, [][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Fold the live spool into a replay file left by an interrupted replay
+	if data, err := os.ReadFile(s.path); err == nil {
+		f, err := os.OpenFile(s.replayPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, werr := f.Write(data)
+		if cerr := f.Close(); werr == nil {
+			werr = cerr
+		}
+		if werr != nil {
+			return nil, nil, werr
+		}
+		if err := os.Remove(s.path); err != nil {
+			return nil, nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(s.replayPath())
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var entries []auditEntry
+	var malformed [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry auditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// Store the raw line as a JSON string so it fits the payload column
+			raw, _ := json.Marshal(string(line))
+			malformed = append(malformed, raw)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, malformed, scanner.Err()
+}
+
+func (s *auditSpool) clearReplay() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.replayPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
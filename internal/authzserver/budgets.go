@@ -0,0 +1,54 @@
+package authzserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/internal/config"
+)
+
+// SetBudgets sets the time budgets of requests and of the steps of checks
+func (s *AuthzService) SetBudgets(b budget.Budgets) {
+	s.budgets = b
+}
+
+// configBudgets reads the budgets from the configuration, keeping the
+// default reserve
+func configBudgets(cfg *config.Config) budget.Budgets {
+	b := budget.Defaults()
+	b.Standard = cfg.Authz.Budgets.Request.Std()
+	b.Long = cfg.Authz.Budgets.Long.Std()
+	b.Max = cfg.Authz.Budgets.Max.Std()
+	b.Database = cfg.Authz.Budgets.Database.Std()
+	b.Rules = cfg.Authz.Budgets.Rules.Std()
+	return b
+}
+
+// startBudget begins the budget of an HTTP or gRPC request. Handlers start
+// it once and pass the context down, so a request's steps share it rather
+// than each getting a timeout of its own.
+func (s *AuthzService) startBudget(ctx context.Context, class budget.Class) (context.Context, context.CancelFunc) {
+	return s.budgets.Start(ctx, class)
+}
+
+// requestBudget reads the budget a caller asks for from X-Request-Timeout
+func requestBudget(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested, err := budget.ParseHeader(r.Header.Get(budget.Header))
+		if err != nil {
+			standardErrorResponse(w, "invalid_request_timeout", "Invalid request timeout", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if requested > 0 {
+			r = r.WithContext(budget.WithRequested(r.Context(), requested))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// budgetExceeded reports whether err means the request ran out of time
+func budgetExceeded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,46 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBudget(t *testing.T) {
+	s := &AuthzService{budgets: budget.Budgets{Standard: 10 * time.Second, Long: 30 * time.Second, Max: time.Minute}}
+
+	var remaining time.Duration
+	handler := requestBudget(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := s.startBudget(r.Context(), budget.Long)
+		defer cancel()
+		remaining, _ = budget.Remaining(ctx)
+	}))
+
+	serve := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/check", nil)
+		if header != "" {
+			req.Header.Set(budget.Header, header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, serve("").Code)
+	assert.Equal(t, 30*time.Second, remaining.Round(time.Second))
+
+	require.Equal(t, http.StatusOK, serve("250ms").Code)
+	assert.LessOrEqual(t, remaining, 250*time.Millisecond)
+
+	require.Equal(t, http.StatusOK, serve("1h").Code)
+	assert.Equal(t, time.Minute, remaining.Round(time.Second), "requests are capped at the max budget")
+
+	rec := serve("soon")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_request_timeout")
+}
@@ -0,0 +1,188 @@
+package authzserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/jobs"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// maxBulkChecks bounds the rows of one bulk check
+const maxBulkChecks = 100000
+
+// maxBulkCheckUpload bounds the size of an uploaded bulk check file
+const maxBulkCheckUpload = 32 << 20
+
+// bulkCheckColumns are the columns of a bulk check's results file
+var bulkCheckColumns = []string{"row", "subject", "permission", "object", "allowed", "reason", "error"}
+
+// submitBulkCheck queues a bulk_check job for a CSV sent as the request
+// body or as the "file" field of a multipart form
+func (s *AuthzService) submitBulkCheck(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkCheckUpload)
+
+	var file io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		part, _, err := r.FormFile("file")
+		if err != nil {
+			standardErrorResponse(w, "invalid_request", "Missing upload",
+				"Send the CSV as the form's file field: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer part.Close()
+		file = part
+	}
+
+	checks, err := parseBulkChecks(file)
+	if err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid bulk check file", err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := &BulkCheckJobParams{Checks: checks}
+	if err := params.validate(); err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid bulk check file", err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.startJob(w, r, JobBulkCheck, params)
+}
+
+// parseBulkChecks reads checks from a CSV with a header row. Subjects and
+// objects are either "type:id" columns named subject and object, or split
+// into subject_type, subject_id, object_type and object_id. An optional
+// context column holds a JSON object; other columns are ignored, so an
+// auditor's spreadsheet can be uploaded as it is.
+func parseBulkChecks(file io.Reader) ([]CheckPermissionRequest, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	_, combined := columns["subject"]
+	for _, required := range bulkCheckRequiredColumns(combined) {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing %s column; the header must name permission and either subject and object (as type:id) or subject_type, subject_id, object_type and object_id", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var checks []CheckPermissionRequest
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(checks) == maxBulkChecks {
+			return nil, fmt.Errorf("at most %d checks can be run at once", maxBulkChecks)
+		}
+
+		check := CheckPermissionRequest{Permission: field(record, "permission")}
+		if combined {
+			var ok bool
+			if check.SubjectType, check.SubjectID, ok = strings.Cut(field(record, "subject"), ":"); !ok {
+				return nil, fmt.Errorf("line %d: subject must be type:id, got %q", line, field(record, "subject"))
+			}
+			if check.ObjectType, check.ObjectID, ok = strings.Cut(field(record, "object"), ":"); !ok {
+				return nil, fmt.Errorf("line %d: object must be type:id, got %q", line, field(record, "object"))
+			}
+		} else {
+			check.SubjectType, check.SubjectID = field(record, "subject_type"), field(record, "subject_id")
+			check.ObjectType, check.ObjectID = field(record, "object_type"), field(record, "object_id")
+		}
+		if check.SubjectType == "" || check.SubjectID == "" || check.Permission == "" ||
+			check.ObjectType == "" || check.ObjectID == "" {
+			return nil, fmt.Errorf("line %d: subject, permission and object are required", line)
+		}
+		if raw := field(record, "context"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &check.Context); err != nil {
+				return nil, fmt.Errorf("line %d: context must be a JSON object: %w", line, err)
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func bulkCheckRequiredColumns(combined bool) []string {
+	if combined {
+		return []string{"subject", "permission", "object"}
+	}
+	return []string{"subject_type", "subject_id", "permission", "object_type", "object_id"}
+}
+
+// runBulkCheckJob evaluates each check as /check would, auditing it under
+// the job, and writes the decisions with their reasons as CSV. A check
+// that fails is reported in its row rather than failing the job.
+func (s *AuthzService) runBulkCheckJob(ctx context.Context, job *jobs.Job, report func(jobs.Progress)) (*jobs.Result, error) {
+	decoded, err := decodeJobParams(job.Kind, job.Params)
+	if err != nil {
+		return nil, err
+	}
+	params := decoded.(*BulkCheckJobParams)
+	r := jobRequest(ctx, job)
+
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	out.Write(bulkCheckColumns)
+
+	total := int64(len(params.Checks))
+	for i, check := range params.Checks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		row := []string{strconv.Itoa(i + 1), check.SubjectType + ":" + check.SubjectID, check.Permission,
+			check.ObjectType + ":" + check.ObjectID}
+
+		decision, err := s.decide(ctx, r, check)
+		switch {
+		case errors.Is(err, errPermissionNotDefined):
+			row = append(row, "false", graph.ReasonUnknownPermission, err.Error())
+		case err != nil:
+			row = append(row, "false", "", err.Error())
+		default:
+			row = append(row, strconv.FormatBool(decision.Allowed), decision.Reason, "")
+		}
+		out.Write(row)
+		report(jobs.Progress{Done: int64(i + 1), Total: total})
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return nil, err
+	}
+	return &jobs.Result{
+		ContentType: "text/csv",
+		Filename:    fmt.Sprintf("bulk-check-%s.csv", job.ID),
+		Data:        buf.Bytes(),
+	}, nil
+}
@@ -0,0 +1,52 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBulkChecks(t *testing.T) {
+	checks, err := parseBulkChecks(strings.NewReader("\ufeffSubject,Permission,Object,Reviewer\n" +
+		"user:alice,view,document:plan,bob\n" +
+		"team:eng#member, edit ,folder:q3:reports,\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []CheckPermissionRequest{
+		{SubjectType: "user", SubjectID: "alice", Permission: "view", ObjectType: "document", ObjectID: "plan"},
+		{SubjectType: "team", SubjectID: "eng#member", Permission: "edit", ObjectType: "folder", ObjectID: "q3:reports"},
+	}, checks)
+
+	checks, err = parseBulkChecks(strings.NewReader("subject_type,subject_id,permission,object_type,object_id,context\n" +
+		`user,alice,approve,invoice,42,"{""amount"": 100}"` + "\n"))
+	require.NoError(t, err)
+	require.Len(t, checks, 1)
+	assert.Equal(t, "invoice", checks[0].ObjectType)
+	assert.Equal(t, map[string]interface{}{"amount": float64(100)}, checks[0].Context)
+}
+
+func TestParseBulkChecksRejectsBadRows(t *testing.T) {
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{"", "the file is empty"},
+		{"subject,object\n", "missing permission column"},
+		{"subject_type,subject_id,permission\n", "missing object_type column"},
+		{"subject,permission,object\nalice,view,document:plan\n", "line 2: subject must be type:id"},
+		{"subject,permission,object\nuser:alice,,document:plan\n", "line 2: subject, permission and object are required"},
+		{"subject,permission,object,context\nuser:alice,view,document:plan,[1]\n", "line 2: context must be a JSON object"},
+	}
+	for _, tt := range tests {
+		_, err := parseBulkChecks(strings.NewReader(tt.file))
+		assert.ErrorContains(t, err, tt.err, tt.file)
+	}
+}
+
+func TestBulkCheckIsReadOnly(t *testing.T) {
+	assert.False(t, isWrite(httptest.NewRequest(http.MethodPost, "/api/jobs/bulk-check", nil)))
+	assert.True(t, isAdminRoute("/api/jobs/bulk-check"))
+}
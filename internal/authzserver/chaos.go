@@ -0,0 +1,61 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/chaos"
+)
+
+// ChaosFaultRequest sets the fault injected at one point
+type ChaosFaultRequest struct {
+	Point string `json:"point"`
+	chaos.Fault
+}
+
+// ChaosStatusResponse lists the injection points and the faults in effect
+type ChaosStatusResponse struct {
+	Points []string               `json:"points"`
+	Faults map[string]chaos.Fault `json:"faults"`
+}
+
+// SetChaos turns on chaos mode: faults set through /api/chaos are injected
+// into rule lookups here and, through the tracer Run installs, into every
+// database query
+func (s *AuthzService) SetChaos(injector *chaos.Injector) {
+	s.chaos = injector
+	s.graph.SetFaultInjector(injector)
+}
+
+// addChaosEndpoints serves the fault controls when chaos mode is on
+func (s *AuthzService) addChaosEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/chaos", func(w http.ResponseWriter, r *http.Request) {
+		if s.chaos == nil {
+			standardErrorResponse(w, "chaos_disabled", "Chaos mode is off",
+				"Start the service with AUTHZ_CHAOS=true to inject faults", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req ChaosFaultRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := s.chaos.Set(req.Point, req.Fault); err != nil {
+				standardErrorResponse(w, "invalid_fault", "Invalid fault", err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			// Without a point every fault is cleared
+			s.chaos.Clear(r.URL.Query().Get("point"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		jsonResponse(w, ChaosStatusResponse{Points: chaos.Points, Faults: s.chaos.Faults()}, http.StatusOK)
+	})
+}
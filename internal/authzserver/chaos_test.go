@@ -0,0 +1,43 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/chaos"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ graph.FaultInjector = (*chaos.Injector)(nil)
+
+func TestChaosEndpoints(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addChaosEndpoints(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chaos", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "chaos mode is off by default")
+
+	s.chaos = chaos.New()
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/chaos",
+		strings.NewReader(`{"point":"db","latency":"50ms","error_rate":0.1}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"db":{"latency":"50ms","jitter":"0s","error_rate":0.1}`)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/chaos", strings.NewReader(`{"point":"disk"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/chaos", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, s.chaos.Faults())
+
+	assert.True(t, isAdminRoute("/api/chaos"))
+}
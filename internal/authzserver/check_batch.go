@@ -0,0 +1,112 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// maxCheckBatch bounds the checks of one /check/batch request. Larger sets
+// go through a bulk_check job.
+const maxCheckBatch = 100
+
+// CheckBatchRequest is a list of permission checks made in one request
+type CheckBatchRequest struct {
+	Checks []CheckPermissionRequest `json:"checks"`
+}
+
+// CheckBatchResponse has one result per check, in request order
+type CheckBatchResponse struct {
+	Results []CheckBatchResult `json:"results"`
+	// Failed counts the checks that could not be evaluated
+	Failed int `json:"failed"`
+}
+
+// CheckBatchResult is the decision of one check of a batch, or why it could
+// not be made. Code is set with Error: invalid_request,
+// permission_not_found, schema_version_not_found, budget_exceeded or
+// internal_error.
+type CheckBatchResult struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// checkBatchHandler runs up to maxCheckBatch checks one after another, as
+// /check would, and reports each result on its own so one failing check
+// doesn't fail the others. The request fails as a whole only when it is
+// malformed.
+func (s *AuthzService) checkBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CheckBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Checks) == 0 {
+		standardErrorResponse(w, "invalid_request", "Invalid check batch", "checks is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Checks) > maxCheckBatch {
+		standardErrorResponse(w, "invalid_request", "Invalid check batch",
+			fmt.Sprintf("at most %d checks can be made at once, got %d; use a bulk_check job for more", maxCheckBatch, len(req.Checks)),
+			http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Long)
+	defer cancel()
+
+	resp := CheckBatchResponse{Results: make([]CheckBatchResult, len(req.Checks))}
+	// A deprecated permission checked several times is warned about once
+	warned := make(map[string]bool)
+	for i, check := range req.Checks {
+		result := &resp.Results[i]
+		if check.SubjectType == "" || check.SubjectID == "" || check.Permission == "" ||
+			check.ObjectType == "" || check.ObjectID == "" {
+			result.Code = "invalid_request"
+			result.Error = "subject_type, subject_id, permission, object_type and object_id are required"
+			resp.Failed++
+			continue
+		}
+
+		decision, err := s.decide(ctx, r, check)
+		switch {
+		case errors.Is(err, graph.ErrSchemaVersionNotFound):
+			result.Code = "schema_version_not_found"
+			result.Error = fmt.Sprintf("Schema version not found: %d", check.SchemaVersion)
+		case errors.Is(err, errPermissionNotDefined):
+			result.Code = "permission_not_found"
+			result.Reason = graph.ReasonUnknownPermission
+			result.Error = fmt.Sprintf("Permission definition not found: %s.%s", check.ObjectType, check.Permission)
+		case budgetExceeded(err):
+			result.Code = "budget_exceeded"
+			result.Error = err.Error()
+		case err != nil:
+			log.Printf("Error evaluating permission in batch: %v", err)
+			result.Code = "internal_error"
+			result.Error = err.Error()
+		default:
+			result.Allowed = decision.Allowed
+			result.Reason = decision.Reason
+			if key := check.ObjectType + "." + check.Permission; decision.Deprecated != nil && !warned[key] {
+				warned[key] = true
+				setDeprecationHeaders(w, deprecationWarning(check.ObjectType, check.Permission, *decision.Deprecated))
+			}
+			continue
+		}
+		resp.Failed++
+	}
+
+	jsonResponse(w, resp, http.StatusOK)
+}
@@ -0,0 +1,45 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckBatchHandler(t *testing.T) {
+	s := &AuthzService{}
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.checkBatchHandler(rec, httptest.NewRequest(http.MethodPost, "/check/batch", strings.NewReader(body)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"checks":`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"checks":[]}`).Code)
+
+	checks, _ := json.Marshal(map[string]interface{}{"checks": make([]CheckPermissionRequest, maxCheckBatch+1)})
+	rec := post(string(checks))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "bulk_check job")
+
+	// Invalid checks are reported on their own
+	rec = post(`{"checks":[{"subject_type":"user"},{"permission":"view"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp CheckBatchResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Failed)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, "invalid_request", resp.Results[1].Code)
+
+	rec = httptest.NewRecorder()
+	s.checkBatchHandler(rec, httptest.NewRequest(http.MethodGet, "/check/batch", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	assert.False(t, isWrite(httptest.NewRequest(http.MethodPost, "/check/batch", nil)))
+	assert.False(t, isAdminRoute("/check/batch"))
+}
@@ -0,0 +1,141 @@
+package authzserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/cluster"
+)
+
+// Caches a replica holds that can be invalidated across the cluster
+const (
+	cacheRules         = "rules"
+	cacheRelationStats = "relation_stats"
+	cacheTenantRules   = "tenant_rules"
+	cacheAPIKeys       = "api_keys"
+)
+
+// ClusterStatusResponse lists the replicas of the service
+type ClusterStatusResponse struct {
+	Self    string           `json:"self"`
+	Members []cluster.Member `json:"members"`
+}
+
+// InvalidateCacheRequest names a cache to drop on every replica
+type InvalidateCacheRequest struct {
+	Cache string `json:"cache"`
+}
+
+// SetCluster connects the service to the other replicas: it reloads rules
+// when another replica syncs the schema, drops caches on request and
+// follows mode changes
+func (s *AuthzService) SetCluster(c *cluster.Cluster) {
+	s.cluster = c
+	s.subscribeModeChanges(c)
+
+	c.Subscribe(cluster.EventSchemaReloaded, func(cluster.Event) {
+		if err := s.invalidateCache(cacheRules); err != nil {
+			log.Printf("Failed to reload rules after a schema sync elsewhere: %v", err)
+		}
+	})
+	c.Subscribe(cluster.EventCacheInvalidated, func(e cluster.Event) {
+		var req InvalidateCacheRequest
+		if err := json.Unmarshal(e.Data, &req); err != nil {
+			log.Printf("Ignoring cache invalidation from %s: %v", e.Origin, err)
+			return
+		}
+		if err := s.invalidateCache(req.Cache); err != nil {
+			log.Printf("Failed to invalidate %s cache: %v", req.Cache, err)
+		}
+	})
+}
+
+// invalidateCache drops a cache on this replica
+func (s *AuthzService) invalidateCache(name string) error {
+	switch name {
+	case cacheRules:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.graph.ReloadRules(ctx); err != nil {
+			return err
+		}
+		if err := s.graph.ReloadRelationDeclarations(ctx); err != nil {
+			return err
+		}
+		return s.graph.ReloadAttributeDeclarations(ctx)
+	case cacheRelationStats:
+		s.graph.InvalidateRelationStats()
+		return nil
+	case cacheTenantRules:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return s.graph.ReloadTenantRules(ctx)
+	case cacheAPIKeys:
+		s.apiKeys.invalidate()
+		return nil
+	default:
+		return fmt.Errorf("unknown cache %q", name)
+	}
+}
+
+// broadcast sends an event to the other replicas, if there are any
+func (s *AuthzService) broadcast(ctx context.Context, eventType string, data interface{}) {
+	if s.cluster == nil {
+		return
+	}
+	if err := s.cluster.Broadcast(ctx, eventType, data); err != nil {
+		log.Printf("Failed to notify other replicas: %v", err)
+	}
+}
+
+// addClusterEndpoints lists the replicas and fans out cache invalidation
+func (s *AuthzService) addClusterEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/cluster", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if s.cluster == nil {
+			standardErrorResponse(w, "cluster_disabled", "This replica is not part of a cluster", "", http.StatusServiceUnavailable)
+			return
+		}
+
+		members, err := s.cluster.Members(r.Context())
+		if err != nil {
+			log.Printf("Error listing cluster members: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to list cluster members", "", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, ClusterStatusResponse{Self: s.cluster.ID(), Members: members}, http.StatusOK)
+	})
+
+	mux.HandleFunc("/api/cluster/invalidate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req InvalidateCacheRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Cache != cacheRules && req.Cache != cacheRelationStats {
+			standardErrorResponse(w, "invalid_cache", "Unknown cache",
+				fmt.Sprintf("cache must be %s or %s", cacheRules, cacheRelationStats), http.StatusBadRequest)
+			return
+		}
+		if err := s.invalidateCache(req.Cache); err != nil {
+			log.Printf("Error invalidating %s cache: %v", req.Cache, err)
+			standardErrorResponse(w, "internal_error", "Failed to invalidate cache", "", http.StatusInternalServerError)
+			return
+		}
+
+		s.broadcast(r.Context(), cluster.EventCacheInvalidated, req)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,27 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterEndpoints(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addClusterEndpoints(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/cluster", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "a standalone replica has no cluster to list")
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/cluster/invalidate", strings.NewReader(`{"cache":"sessions"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_cache")
+
+	assert.True(t, isAdminRoute("/api/cluster/invalidate"))
+}
@@ -0,0 +1,58 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalJSONResponse(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+	data := map[string]string{"type": "user", "id": "alice"}
+
+	first := httptest.NewRecorder()
+	conditionalJSONResponse(first, httptest.NewRequest(http.MethodGet, "/entity", nil), data, modified, entityCacheControl)
+	require.Equal(t, http.StatusOK, first.Code)
+
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, entityCacheControl, first.Header().Get("Cache-Control"))
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", first.Header().Get("Last-Modified"))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"weak etag in list", map[string]string{"If-None-Match": `"other", W/` + etag}, http.StatusNotModified},
+		{"stale etag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"etag wins over date", map[string]string{
+			"If-None-Match":     `"other"`,
+			"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT",
+		}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 11:59:59 GMT"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/entity", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			conditionalJSONResponse(rec, req, data, modified, entityCacheControl)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, etag, rec.Header().Get("ETag"))
+			if tt.status == http.StatusNotModified {
+				assert.Empty(t, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package authzserver
+
+import (
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// ConditionLimits reads the limits on permission conditions from the
+// configuration. `supra schema apply` holds migrations to the same limits.
+func ConditionLimits(cfg *config.Config) graph.ConditionLimits {
+	return graph.ConditionLimits{
+		MaxLength:    cfg.Authz.ConditionLimits.MaxLength,
+		MaxDepth:     cfg.Authz.ConditionLimits.MaxDepth,
+		MaxRuleCalls: cfg.Authz.ConditionLimits.MaxRuleCalls,
+	}
+}
@@ -0,0 +1,131 @@
+package authzserver
+
+import (
+	"crypto/subtle"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	authzui "github.com/dangerclosesec/supra/ui/authz"
+)
+
+// dashboardPath is where the embedded dashboard is mounted; it must match
+// basePath in ui/authz/next.config.js
+const dashboardPath = "/dashboard"
+
+// adminRoutes are the endpoints only the dashboard uses. They expose the
+// whole graph and audit trail, so unlike the check and schema APIs used by
+// services they require the admin token.
+var adminRoutes = []string{
+	dashboardPath,
+	"/api/graph",
+	"/api/audit/logs",
+	"/api/audit/verify",
+	"/api/audit/export",
+	"/api/health",
+	"/api/cluster",
+	"/api/usage",
+	"/api/chaos",
+	"/api/mode",
+	"/api/schema/drift",
+	"/api/flags",
+	"/api/shadow",
+	"/api/jobs",
+	"/metrics",
+	"/api/permission-path",
+	"/api/entity-types",
+	"/api/relations",
+	"/visualize-condition",
+	"/test-relation",
+	"/api/api-keys",
+}
+
+// isAdminRoute reports whether p is served only to administrators
+func isAdminRoute(p string) bool {
+	for _, route := range adminRoutes {
+		if p == route || strings.HasPrefix(p, route+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAdminToken sets the function returning the current admin token. It is
+// called on every request so a rotated token takes effect immediately.
+func (s *AuthzService) SetAdminToken(token func() string) {
+	s.adminToken = token
+}
+
+// adminAuth rejects requests to admin routes that don't carry the admin
+// token, either as a bearer token or as the basic auth password, or an
+// admin-scoped API key
+func (s *AuthzService) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || !isAdminRoute(r.URL.Path) || hasAdminKey(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var expected string
+		if s.adminToken != nil {
+			expected = s.adminToken()
+		}
+		if expected == "" {
+			http.Error(w, "Dashboard disabled: set AUTHZ_ADMIN_TOKEN to enable it", http.StatusServiceUnavailable)
+			return
+		}
+
+		if !validAdminToken(r, expected) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="supra authz"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validAdminToken(r *http.Request, expected string) bool {
+	var given string
+	if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	} else if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		given = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if given == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// addDashboardEndpoints serves the embedded dashboard build
+func (s *AuthzService) addDashboardEndpoints(mux *http.ServeMux) {
+	mux.Handle(dashboardPath+"/", http.StripPrefix(dashboardPath, spaHandler(authzui.FS())))
+	mux.Handle(dashboardPath, http.RedirectHandler(dashboardPath+"/", http.StatusMovedPermanently))
+}
+
+// spaHandler serves files from a static export, resolving /page to
+// page.html and falling back to index.html for client-side routes
+func spaHandler(files fs.FS) http.Handler {
+	fileServer := http.FileServer(http.FS(files))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+		switch {
+		case name == "" || isFile(files, name):
+		case isFile(files, name+".html"):
+			r.URL.Path = "/" + name + ".html"
+		default:
+			r.URL.Path = "/"
+		}
+
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+func isFile(files fs.FS, name string) bool {
+	info, err := fs.Stat(files, name)
+	return err == nil && !info.IsDir()
+}
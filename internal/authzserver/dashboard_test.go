@@ -0,0 +1,80 @@
+package authzserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		setup  func(r *http.Request)
+		status int
+	}{
+		{"public route", "", "/check", nil, http.StatusOK},
+		{"no token configured", "", "/dashboard/", nil, http.StatusServiceUnavailable},
+		{"missing credentials", "s3cret", "/api/graph", nil, http.StatusUnauthorized},
+		{"wrong bearer", "s3cret", "/api/audit/logs/42", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer nope")
+		}, http.StatusUnauthorized},
+		{"bearer", "s3cret", "/api/audit/logs/42", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer s3cret")
+		}, http.StatusOK},
+		{"basic", "s3cret", "/dashboard/permissions", func(r *http.Request) {
+			r.SetBasicAuth("admin", "s3cret")
+		}, http.StatusOK},
+		{"sdk route stays open", "s3cret", "/api/permission-definitions", nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AuthzService{}
+			s.SetAdminToken(func() string { return tt.token })
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.setup != nil {
+				tt.setup(req)
+			}
+			rec := httptest.NewRecorder()
+			s.adminAuth(ok).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
+
+func TestSPAHandler(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":          {Data: []byte("index")},
+		"permissions.html":    {Data: []byte("permissions")},
+		"_next/static/app.js": {Data: []byte("js")},
+	}
+	handler := spaHandler(files)
+
+	tests := map[string]string{
+		"/":                    "index",
+		"/permissions":         "permissions",
+		"/_next/static/app.js": "js",
+		"/unknown/route":       "index",
+	}
+
+	for path, want := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		body, _ := io.ReadAll(rec.Body)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, want, string(body), path)
+	}
+}
@@ -0,0 +1,39 @@
+package authzserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/decisionlog"
+)
+
+// SetDecisionLog streams every check decision, subject to the streamer's
+// sampling, alongside the audit log
+func (s *AuthzService) SetDecisionLog(streamer *decisionlog.Streamer) {
+	s.decisions = streamer
+}
+
+// newDecisionStreamer connects the configured ClickHouse sink. The table is
+// created up front; if ClickHouse is unreachable the service still starts
+// and the streamer drops batches until it recovers.
+func newDecisionStreamer(ctx context.Context, cfg *config.Config) (*decisionlog.Streamer, error) {
+	sink, err := decisionlog.NewClickHouseSink(cfg.Authz.Decisions.ClickHouseURL, cfg.Authz.Decisions.Table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure decision stream: %w", err)
+	}
+
+	createCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := sink.CreateTable(createCtx); err != nil {
+		log.Printf("Warning: failed to create the ClickHouse decisions table: %v", err)
+	}
+
+	return decisionlog.NewStreamer(sink, decisionlog.Options{
+		SampleRate:    cfg.Authz.Decisions.SampleRate,
+		BatchSize:     cfg.Authz.Decisions.BatchSize,
+		FlushInterval: cfg.Authz.Decisions.FlushInterval.Std(),
+	}), nil
+}
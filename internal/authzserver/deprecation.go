@@ -0,0 +1,95 @@
+package authzserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// deprecationKey is a deprecated permission that was checked
+type deprecationKey struct {
+	EntityType string
+	Permission string
+}
+
+// deprecationMeter counts checks of deprecated permissions, so a rename can
+// be finished once the count stops growing
+type deprecationMeter struct {
+	mu     sync.Mutex
+	counts map[deprecationKey]int64
+}
+
+func newDeprecationMeter() *deprecationMeter {
+	return &deprecationMeter{counts: make(map[deprecationKey]int64)}
+}
+
+func (m *deprecationMeter) record(key deprecationKey) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[key]++
+}
+
+// deprecationCount is the checks of one deprecated permission
+type deprecationCount struct {
+	deprecationKey
+	Checks int64
+}
+
+// snapshot returns the counts sorted by entity type and permission
+func (m *deprecationMeter) snapshot() []deprecationCount {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	counts := make([]deprecationCount, 0, len(m.counts))
+	for key, n := range m.counts {
+		counts = append(counts, deprecationCount{key, n})
+	}
+	m.mu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].EntityType != counts[j].EntityType {
+			return counts[i].EntityType < counts[j].EntityType
+		}
+		return counts[i].Permission < counts[j].Permission
+	})
+	return counts
+}
+
+// deprecationWarning is the warning returned to callers of a deprecated
+// permission, naming its replacement when the schema gave one
+func deprecationWarning(objectType, permission, message string) string {
+	warning := fmt.Sprintf("permission %s.%s is deprecated", objectType, permission)
+	if message != "" {
+		warning += ": " + message
+	}
+	return warning
+}
+
+// setDeprecationHeaders marks a check response as using a deprecated
+// permission, with a Warning header (RFC 7234) carrying the reason
+func setDeprecationHeaders(w http.ResponseWriter, warning string) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Add("Warning", "299 - "+strconv.Quote(warning))
+}
+
+// writeDeprecationMetrics writes checks of deprecated permissions in the
+// Prometheus text exposition format
+func writeDeprecationMetrics(w http.ResponseWriter, counts []deprecationCount) {
+	var b strings.Builder
+
+	b.WriteString("# HELP supra_authz_deprecated_checks_total Checks of permissions the schema deprecates by entity type and permission.\n")
+	b.WriteString("# TYPE supra_authz_deprecated_checks_total counter\n")
+	for _, c := range counts {
+		fmt.Fprintf(&b, `supra_authz_deprecated_checks_total{entity_type="%s",permission="%s"} %d`+"\n",
+			escapeLabel(c.EntityType), escapeLabel(c.Permission), c.Checks)
+	}
+
+	w.Write([]byte(b.String()))
+}
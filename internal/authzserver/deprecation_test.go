@@ -0,0 +1,42 @@
+package authzserver
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeprecationMeter(t *testing.T) {
+	m := newDeprecationMeter()
+	m.record(deprecationKey{EntityType: "folder", Permission: "read"})
+	m.record(deprecationKey{EntityType: "document", Permission: "view"})
+	m.record(deprecationKey{EntityType: "document", Permission: "view"})
+
+	assert.Equal(t, []deprecationCount{
+		{deprecationKey{"document", "view"}, 2},
+		{deprecationKey{"folder", "read"}, 1},
+	}, m.snapshot())
+
+	var unset *deprecationMeter
+	unset.record(deprecationKey{EntityType: "document", Permission: "view"})
+	assert.Empty(t, unset.snapshot())
+}
+
+func TestDeprecationHeaders(t *testing.T) {
+	rec := httptest.NewRecorder()
+	setDeprecationHeaders(rec, deprecationWarning("document", "view", `use "view_v2"`))
+
+	assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+	assert.Equal(t, `299 - "permission document.view is deprecated: use \"view_v2\""`, rec.Header().Get("Warning"))
+	assert.Equal(t, "permission document.read is deprecated", deprecationWarning("document", "read", ""))
+}
+
+func TestWriteDeprecationMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeDeprecationMetrics(rec, []deprecationCount{{deprecationKey{"document", "view"}, 4}})
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE supra_authz_deprecated_checks_total counter\n")
+	assert.Contains(t, body, `supra_authz_deprecated_checks_total{entity_type="document",permission="view"} 4`)
+}
@@ -0,0 +1,97 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// maxEntityBatch bounds the entities of one /entities/batch request
+const maxEntityBatch = 1000
+
+// EntityBatchRequest names the entities to retrieve
+type EntityBatchRequest struct {
+	Entities []graph.EntityKey `json:"entities"`
+}
+
+// EntityBatchResponse has the entities found, in request order, and the
+// keys that matched none
+type EntityBatchResponse struct {
+	Entities []EntityResponse  `json:"entities"`
+	Missing  []graph.EntityKey `json:"missing"`
+}
+
+// entityBatchHandler retrieves up to maxEntityBatch entities in one round
+// trip, for admin tools that would otherwise GET /entity once per row
+func (s *AuthzService) entityBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EntityBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Entities) > maxEntityBatch {
+		standardErrorResponse(w, "invalid_request", "Too many entities",
+			fmt.Sprintf("At most %d entities may be retrieved at once", maxEntityBatch), http.StatusBadRequest)
+		return
+	}
+	for i, key := range req.Entities {
+		if key.Type == "" || key.ExternalID == "" {
+			standardErrorResponse(w, "missing_fields", "Required fields missing",
+				fmt.Sprintf("entities[%d]: type and id are required fields", i), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	entities, err := s.graph.GetEntities(ctx, req.Entities)
+	if err != nil {
+		log.Printf("Error retrieving entities: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to retrieve entities", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, entityBatchResponse(req.Entities, entities), http.StatusOK)
+}
+
+// entityBatchResponse orders the entities found as their keys were
+// requested and lists the keys not found
+func entityBatchResponse(keys []graph.EntityKey, entities []graph.Entity) EntityBatchResponse {
+	found := make(map[graph.EntityKey]graph.Entity, len(entities))
+	for _, entity := range entities {
+		found[graph.EntityKey{Type: entity.Type, ExternalID: entity.ExternalID}] = entity
+	}
+
+	resp := EntityBatchResponse{Entities: []EntityResponse{}, Missing: []graph.EntityKey{}}
+	seen := make(map[graph.EntityKey]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		entity, ok := found[key]
+		if !ok {
+			resp.Missing = append(resp.Missing, key)
+			continue
+		}
+		resp.Entities = append(resp.Entities, EntityResponse{
+			ID:         entity.ID,
+			Type:       entity.Type,
+			ExternalID: entity.ExternalID,
+			Properties: entity.Properties,
+			CreatedAt:  entity.CreatedAt,
+			UpdatedAt:  entity.UpdatedAt,
+		})
+	}
+	return resp
+}
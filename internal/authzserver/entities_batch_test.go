@@ -0,0 +1,45 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+func TestEntityBatchResponse(t *testing.T) {
+	keys := []graph.EntityKey{
+		{Type: "document", ExternalID: "d2"},
+		{Type: "document", ExternalID: "gone"},
+		{Type: "document", ExternalID: "d1"},
+		{Type: "document", ExternalID: "d2"},
+	}
+	entities := []graph.Entity{
+		{ID: 1, Type: "document", ExternalID: "d1"},
+		{ID: 2, Type: "document", ExternalID: "d2"},
+	}
+
+	resp := entityBatchResponse(keys, entities)
+	if assert.Len(t, resp.Entities, 2) {
+		assert.Equal(t, "d2", resp.Entities[0].ExternalID)
+		assert.Equal(t, "d1", resp.Entities[1].ExternalID)
+	}
+	assert.Equal(t, []graph.EntityKey{{Type: "document", ExternalID: "gone"}}, resp.Missing)
+}
+
+func TestEntityBatchValidation(t *testing.T) {
+	s := &AuthzService{}
+	for name, body := range map[string]string{
+		"malformed":  `{"entities":`,
+		"missing id": `{"entities":[{"type":"document"}]}`,
+		"too many":   `{"entities":[` + strings.Repeat(`{"type":"a","id":"b"},`, maxEntityBatch) + `{"type":"a","id":"b"}]}`,
+	} {
+		rec := httptest.NewRecorder()
+		s.entityBatchHandler(rec, httptest.NewRequest(http.MethodPost, "/entities/batch", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, name)
+	}
+}
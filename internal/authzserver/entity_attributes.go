@@ -0,0 +1,152 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// AttributeRequest sets a declared attribute of an entity. Value is checked
+// against the attribute's data type in the schema.
+type AttributeRequest struct {
+	Type       string      `json:"type"`
+	ExternalID string      `json:"external_id"`
+	Attribute  string      `json:"attribute"`
+	Value      interface{} `json:"value"`
+}
+
+// AttributesResponse lists the typed attributes of an entity
+type AttributesResponse struct {
+	Type       string                 `json:"type"`
+	ExternalID string                 `json:"external_id"`
+	Attributes []graph.TypedAttribute `json:"attributes"`
+}
+
+// attributeHandler serves /attribute: POST sets a typed attribute, GET
+// ?type=&id= lists an entity's typed attributes and DELETE
+// ?type=&id=&attribute= removes one
+func (s *AuthzService) attributeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.setAttributeHandler(w, r)
+	case http.MethodGet:
+		s.listAttributesHandler(w, r)
+	case http.MethodDelete:
+		s.deleteAttributeHandler(w, r)
+	default:
+		standardErrorResponse(w, "method_not_allowed", "Method not allowed",
+			fmt.Sprintf("The %s method is not supported for this endpoint", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *AuthzService) setAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	var req AttributeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Type == "" || req.ExternalID == "" || req.Attribute == "" {
+		standardErrorResponse(w, "missing_fields", "Required fields missing",
+			"Type, external_id and attribute are required fields", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorizeAdmin(w, r, &adminTarget{Type: req.Type, ID: req.ExternalID}) {
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	attr, err := s.graph.SetAttribute(ctx, req.Type, req.ExternalID, req.Attribute, req.Value)
+	switch {
+	case errors.Is(err, graph.ErrUndeclaredAttribute):
+		standardErrorResponse(w, "undeclared_attribute", "Attribute not declared by the schema", err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, graph.ErrAttributeType):
+		standardErrorResponse(w, "invalid_attribute_value", "Attribute value does not match its data type", err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, graph.ErrEntityNotFound):
+		standardErrorResponse(w, "entity_not_found", "Entity not found", err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error setting attribute: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to set attribute", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.usage.recordEntityWrite(usageKey{Tenant: usageTenant(r, req.Type, req.ExternalID, nil), EntityType: req.Type})
+	if err := s.auditLogger.LogEntityUpdate(r.Context(), req.Type, req.ExternalID,
+		map[string]interface{}{req.Attribute: attr.Value}, r); err != nil {
+		log.Printf("Failed to log attribute write: %v", err)
+	}
+
+	jsonResponse(w, attr, http.StatusOK)
+}
+
+func (s *AuthzService) listAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	entityType := r.URL.Query().Get("type")
+	externalID := r.URL.Query().Get("id")
+	if entityType == "" || externalID == "" {
+		standardErrorResponse(w, "missing_parameters", "Missing query parameters",
+			"Type and id query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	attributes, err := s.graph.GetAttributes(ctx, entityType, externalID)
+	if err != nil {
+		log.Printf("Error retrieving attributes: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to retrieve attributes", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, AttributesResponse{
+		Type:       entityType,
+		ExternalID: externalID,
+		Attributes: attributes,
+	}, http.StatusOK)
+}
+
+func (s *AuthzService) deleteAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	entityType, externalID, attribute := query.Get("type"), query.Get("id"), query.Get("attribute")
+	if entityType == "" || externalID == "" || attribute == "" {
+		standardErrorResponse(w, "missing_parameters", "Missing query parameters",
+			"Type, id and attribute query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorizeAdmin(w, r, &adminTarget{Type: entityType, ID: externalID}) {
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	err := s.graph.DeleteAttribute(ctx, entityType, externalID, attribute)
+	switch {
+	case errors.Is(err, graph.ErrAttributeNotFound):
+		standardErrorResponse(w, "attribute_not_found", "Attribute not found", err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error deleting attribute: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to delete attribute", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.usage.recordEntityWrite(usageKey{Tenant: usageTenant(r, entityType, externalID, nil), EntityType: entityType})
+	if err := s.auditLogger.LogEntityUpdate(r.Context(), entityType, externalID,
+		map[string]interface{}{attribute: nil}, r); err != nil {
+		log.Printf("Failed to log attribute deletion: %v", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
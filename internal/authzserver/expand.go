@@ -0,0 +1,64 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// ExpandRequest names the object#permission to expand
+type ExpandRequest struct {
+	ObjectType string `json:"object_type"`
+	ObjectID   string `json:"object_id"`
+	Permission string `json:"permission"`
+}
+
+// addExpandEndpoints serves /expand, the machine-readable counterpart of
+// /api/permission-path: the permission's whole evaluated tree rather than
+// the paths for one subject
+func (s *AuthzService) addExpandEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/expand", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ExpandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ObjectType == "" || req.ObjectID == "" || req.Permission == "" {
+			standardErrorResponse(w, "invalid_request", "Missing required fields",
+				"object_type, object_id and permission are required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+		defer cancel()
+
+		conditionExpr, err := s.permissionCondition(ctx, req.ObjectType, req.Permission)
+		if errors.Is(err, errPermissionNotDefined) {
+			standardErrorResponse(w, graph.ReasonUnknownPermission, "Permission definition not found",
+				err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error expanding permission: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to expand permission", err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		tree, err := s.graph.Expand(ctx, conditionExpr, req.ObjectType, req.ObjectID, req.Permission)
+		if err != nil {
+			log.Printf("Error expanding permission: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to expand permission", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, tree, http.StatusOK)
+	})
+}
@@ -0,0 +1,141 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// FlagRequest sets the rollout of one evaluator flag
+type FlagRequest struct {
+	Flag string `json:"flag"`
+	graph.FlagRollout
+}
+
+// FlagsResponse lists the evaluator flags and, for the configured ones, the
+// checks evaluated with the flag on and off
+type FlagsResponse struct {
+	Flags      []string          `json:"flags"`
+	Configured []graph.FlagStats `json:"configured"`
+}
+
+// SetFlags applies evaluator flag rollouts from the configuration
+func (s *AuthzService) SetFlags(flags map[string]config.FlagRollout) error {
+	rollouts := make(map[string]graph.FlagRollout, len(flags))
+	for flag, rollout := range flags {
+		rollouts[flag] = graph.FlagRollout{Rollout: rollout.Rollout, EntityTypes: rollout.EntityTypes}
+	}
+	if err := s.graph.SetFlags(rollouts); err != nil {
+		return err
+	}
+	for _, stats := range s.graph.FlagStats() {
+		log.Printf("Evaluator flag %s on for %s", stats.Flag, describeRollout(stats.Rollout))
+	}
+	return nil
+}
+
+// describeRollout summarizes a rollout for the log, e.g. "10% of objects,
+// 100% of document"
+func describeRollout(r graph.FlagRollout) string {
+	parts := []string{fmt.Sprintf("%g%% of objects", r.Rollout*100)}
+	for entityType, f := range r.EntityTypes {
+		parts = append(parts, fmt.Sprintf("%g%% of %s", f*100, entityType))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// flagRollouts returns the rollouts in effect
+func (s *AuthzService) flagRollouts() map[string]graph.FlagRollout {
+	rollouts := make(map[string]graph.FlagRollout)
+	for _, stats := range s.graph.FlagStats() {
+		rollouts[stats.Flag] = stats.Rollout
+	}
+	return rollouts
+}
+
+// addFlagEndpoints serves the evaluator flags and their comparison. POST
+// sets one flag's rollout and DELETE ?flag= turns one off, on this replica
+// until the next restart or SIGHUP.
+func (s *AuthzService) addFlagEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/flags", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req FlagRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+				return
+			}
+			rollouts := s.flagRollouts()
+			rollouts[req.Flag] = req.FlagRollout
+			if err := s.graph.SetFlags(rollouts); err != nil {
+				standardErrorResponse(w, "invalid_flag", "Invalid flag rollout", err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("Evaluator flag %s set to %s", req.Flag, describeRollout(req.FlagRollout))
+		case http.MethodDelete:
+			flag := r.URL.Query().Get("flag")
+			rollouts := s.flagRollouts()
+			if _, ok := rollouts[flag]; !ok {
+				standardErrorResponse(w, "not_found", "Flag not configured",
+					fmt.Sprintf("No rollout is configured for %q", flag), http.StatusNotFound)
+				return
+			}
+			delete(rollouts, flag)
+			if err := s.graph.SetFlags(rollouts); err != nil {
+				standardErrorResponse(w, "internal_error", "Failed to turn off flag", err.Error(), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Evaluator flag %s turned off", flag)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		jsonResponse(w, FlagsResponse{Flags: graph.Flags, Configured: s.graph.FlagStats()}, http.StatusOK)
+	})
+}
+
+// writeFlagMetrics writes the checks on each side of the configured flags in
+// the Prometheus text exposition format
+func writeFlagMetrics(w http.ResponseWriter, stats []graph.FlagStats) {
+	var b strings.Builder
+
+	b.WriteString("# HELP supra_authz_flag_checks_total Checks by evaluator flag, whether it was on, and result.\n")
+	b.WriteString("# TYPE supra_authz_flag_checks_total counter\n")
+	for _, s := range stats {
+		for _, arm := range flagArms(s) {
+			fmt.Fprintf(&b, `supra_authz_flag_checks_total{flag="%s",enabled="%s",result="allowed"} %d`+"\n",
+				escapeLabel(s.Flag), arm.enabled, arm.stats.Allowed)
+			fmt.Fprintf(&b, `supra_authz_flag_checks_total{flag="%s",enabled="%s",result="denied"} %d`+"\n",
+				escapeLabel(s.Flag), arm.enabled, arm.stats.Checks-arm.stats.Allowed-arm.stats.Errors)
+			fmt.Fprintf(&b, `supra_authz_flag_checks_total{flag="%s",enabled="%s",result="error"} %d`+"\n",
+				escapeLabel(s.Flag), arm.enabled, arm.stats.Errors)
+		}
+	}
+
+	b.WriteString("# HELP supra_authz_flag_check_seconds_total Time spent evaluating checks by evaluator flag and whether it was on.\n")
+	b.WriteString("# TYPE supra_authz_flag_check_seconds_total counter\n")
+	for _, s := range stats {
+		for _, arm := range flagArms(s) {
+			fmt.Fprintf(&b, `supra_authz_flag_check_seconds_total{flag="%s",enabled="%s"} %g`+"\n",
+				escapeLabel(s.Flag), arm.enabled, arm.stats.Seconds)
+		}
+	}
+
+	w.Write([]byte(b.String()))
+}
+
+type flagArm struct {
+	enabled string
+	stats   graph.FlagArmStats
+}
+
+func flagArms(s graph.FlagStats) []flagArm {
+	return []flagArm{{"true", s.On}, {"false", s.Off}}
+}
@@ -0,0 +1,72 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagEndpoints(t *testing.T) {
+	s := &AuthzService{graph: &graph.IdentityGraph{}}
+	require.NoError(t, s.SetFlags(map[string]config.FlagRollout{graph.FlagParallelOr: {Rollout: 0.1}}))
+	assert.Error(t, s.SetFlags(map[string]config.FlagRollout{"closure_tables": {Rollout: 1}}))
+
+	mux := http.NewServeMux()
+	s.addFlagEndpoints(mux)
+	serve := func(method, target, body string) (*httptest.ResponseRecorder, FlagsResponse) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var resp FlagsResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	rec, resp := serve(http.MethodGet, "/api/flags", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, graph.Flags, resp.Flags)
+	require.Len(t, resp.Configured, 1)
+	assert.Equal(t, 0.1, resp.Configured[0].Rollout.Rollout)
+
+	rec, resp = serve(http.MethodPost, "/api/flags",
+		`{"flag":"strict_direction","entity_types":{"document":1}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, resp.Configured, 2)
+	assert.Equal(t, graph.FlagStrictDirection, resp.Configured[1].Flag)
+	assert.Equal(t, map[string]float64{"document": 1}, resp.Configured[1].Rollout.EntityTypes)
+
+	rec, _ = serve(http.MethodPost, "/api/flags", `{"flag":"parallel_or","rollout":2}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_flag")
+
+	rec, resp = serve(http.MethodDelete, "/api/flags?flag=parallel_or", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, resp.Configured, 1)
+	assert.Equal(t, graph.FlagStrictDirection, resp.Configured[0].Flag)
+
+	rec, _ = serve(http.MethodDelete, "/api/flags?flag=parallel_or", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.True(t, isAdminRoute("/api/flags"))
+	assert.False(t, isWrite(httptest.NewRequest(http.MethodPost, "/api/flags", nil)))
+}
+
+func TestWriteFlagMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeFlagMetrics(rec, []graph.FlagStats{{
+		Flag: graph.FlagParallelOr,
+		On:   graph.FlagArmStats{Checks: 10, Allowed: 6, Errors: 1, Seconds: 0.5},
+		Off:  graph.FlagArmStats{Checks: 90, Allowed: 50, Seconds: 9},
+	}})
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `supra_authz_flag_checks_total{flag="parallel_or",enabled="true",result="denied"} 3`)
+	assert.Contains(t, body, `supra_authz_flag_checks_total{flag="parallel_or",enabled="false",result="allowed"} 50`)
+	assert.Contains(t, body, `supra_authz_flag_check_seconds_total{flag="parallel_or",enabled="false"} 9`)
+}
@@ -0,0 +1,123 @@
+package authzserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+
+	authzv1 "github.com/dangerclosesec/supra/api/authz/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// gatewayPrefix is where the REST gateway generated from the google.api.http
+// rules in api/authz/v1/authz.proto is served
+const gatewayPrefix = "/v1/"
+
+// addGatewayEndpoints serves the REST gateway and its OpenAPI description
+func (s *AuthzService) addGatewayEndpoints(mux *http.ServeMux) {
+	mux.Handle(gatewayPrefix, s.gatewayHandler())
+	mux.HandleFunc(gatewayPrefix+"openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(authzv1.OpenAPI)
+	})
+}
+
+// gatewayHandler translates JSON calls to the gRPC service in process, so
+// both APIs share one implementation of validation, admin scopes, metering
+// and auditing. Field names stay snake_case, as in the rest of the HTTP API.
+func (s *AuthzService) gatewayHandler() http.Handler {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+		runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+		runtime.WithForwardResponseOption(gatewayDeprecation),
+		runtime.WithErrorHandler(gatewayError),
+		runtime.WithMiddlewares(gatewayQueryLabel),
+	)
+	// Registering only fails for a nil server
+	_ = authzv1.RegisterAuthzServiceHandlerServer(context.Background(), mux, &grpcService{s: s})
+
+	// The caller's address and TLS state are passed as a gRPC peer, which
+	// grpcRequest reads for the audit trail and certificate principals
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &peer.Peer{Addr: gatewayAddr(r.RemoteAddr)}
+		if r.TLS != nil {
+			p.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+		}
+		mux.ServeHTTP(w, r.WithContext(peer.NewContext(r.Context(), p)))
+	})
+}
+
+// gatewayAddr is an HTTP caller's address as a net.Addr
+type gatewayAddr string
+
+func (a gatewayAddr) Network() string { return "tcp" }
+func (a gatewayAddr) String() string  { return string(a) }
+
+// gatewayHeaderMatcher passes the headers grpcRequest reads through as
+// metadata under their own names
+func gatewayHeaderMatcher(key string) (string, bool) {
+	for _, header := range grpcHeaders {
+		if strings.EqualFold(key, header) {
+			return strings.ToLower(header), true
+		}
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// gatewayDeprecation sends the Deprecation and Warning headers /check sends
+// when the gRPC call flagged a deprecated permission
+func gatewayDeprecation(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if warning := md.HeaderMD.Get("warning"); len(warning) > 0 {
+		setDeprecationHeaders(w, warning[0])
+	}
+	return nil
+}
+
+// gatewayError writes a gRPC status in the HTTP API's error format, with
+// the status code name in snake_case, e.g. not_found
+func gatewayError(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter,
+	_ *http.Request, err error) {
+
+	var httpErr *runtime.HTTPStatusError
+	if errors.As(err, &httpErr) {
+		err = httpErr.Err
+	}
+	st := status.Convert(err)
+	httpStatus := runtime.HTTPStatusFromCode(st.Code())
+	if httpErr != nil {
+		httpStatus = httpErr.HTTPStatus
+	}
+	standardErrorResponse(w, snakeCase(st.Code().String()), st.Message(), "", httpStatus)
+}
+
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
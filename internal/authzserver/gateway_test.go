@@ -0,0 +1,59 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGateway(t *testing.T) {
+	s := &AuthzService{}
+	s.SetAdminScopes(true)
+	mux := http.NewServeMux()
+	s.addGatewayEndpoints(mux)
+	handler := s.modeGuard(mux)
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(http.MethodPost, "/v1/check", `{"subject_type":"user","subject_id":"alice"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"invalid_argument"`)
+
+	rec = call(http.MethodPost, "/v1/entity", `{"type":"user","external_id":"alice"}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"unauthenticated"`)
+
+	rec = call(http.MethodGet, "/v1/entity?type=user", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = call(http.MethodPost, "/v1/unknown", "{}")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"not_found"`)
+
+	require.NoError(t, s.SetMode(ModeReadOnly, "database failover"))
+	rec = call(http.MethodPost, "/v1/relation", `{}`)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	// Checks only read, so they stay open
+	rec = call(http.MethodPost, "/v1/check", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = call(http.MethodGet, "/v1/openapi.json", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"/v1/check"`)
+}
+
+func TestSnakeCase(t *testing.T) {
+	assert.Equal(t, "not_found", snakeCase("NotFound"))
+	assert.Equal(t, "unauthenticated", snakeCase("Unauthenticated"))
+	assert.Equal(t, "failed_precondition", snakeCase("FailedPrecondition"))
+}
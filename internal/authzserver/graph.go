@@ -1,4 +1,4 @@
-package main
+package authzserver
 
 import (
 	"context"
@@ -7,15 +7,22 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"time"
 
+	"github.com/dangerclosesec/supra/internal/budget"
 	"github.com/lib/pq"
 )
 
 // GraphData represents the complete visualization data structure
 type GraphData struct {
-	Nodes []Node `json:"nodes"`
-	Links []Link `json:"links"`
+	Nodes   []Node             `json:"nodes"`
+	Links   []Link             `json:"links"`
+	Overlay *PermissionOverlay `json:"overlay,omitempty"`
+	// NextCursor continues with the seed entities after this page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Truncated is set when the node or link limit cut the graph short;
+	// Warnings says where
+	Truncated bool     `json:"truncated,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
 }
 
 // Node represents an entity in the graph visualization
@@ -24,6 +31,8 @@ type Node struct {
 	Type  string `json:"type"`
 	Label string `json:"label"`
 	Group string `json:"group"` // For visual grouping/coloring
+	// Access marks nodes the overlay subject's permission flows through
+	Access bool `json:"access,omitempty"`
 }
 
 // Link represents a relationship in the graph visualization
@@ -32,6 +41,8 @@ type Link struct {
 	Target string `json:"target"`
 	Type   string `json:"type"`  // Relationship type
 	Label  string `json:"label"` // Display label
+	// Access marks links that grant the overlay permission
+	Access bool `json:"access,omitempty"`
 }
 
 // addGraphVisualizationEndpoint adds the endpoint for graph data visualization
@@ -44,34 +55,49 @@ func (s *AuthzService) addGraphVisualizationEndpoint(mux *http.ServeMux) {
 		relationshipType := r.URL.Query().Get("relation_type")
 		depth := r.URL.Query().Get("depth")
 
+		page, err := parseGraphPage(r.URL.Query())
+		if err != nil {
+			standardErrorResponse(w, "invalid_pagination", "Invalid pagination", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Optional permission overlay (subject=type:id&permission=name)
+		overlay, err := parseOverlayQuery(r.URL.Query())
+		if err != nil {
+			standardErrorResponse(w, "invalid_overlay", "Invalid permission overlay", err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Default depth if not provided
 		if depth == "" {
 			depth = "2" // Default to 2 levels
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Long)
 		defer cancel()
 
 		// Generate graph data based on filters
-		graphData, err := s.generateGraphData(ctx, entityType, entityID, relationshipType, depth)
+		graphData, err := s.generateGraphData(ctx, entityType, entityID, relationshipType, depth, page)
 		if err != nil {
 			log.Printf("Error generating graph data: %v", err)
 			http.Error(w, "Error generating graph data", http.StatusInternalServerError)
 			return
 		}
 
+		if overlay != nil {
+			if err := s.applyPermissionOverlay(ctx, graphData, *overlay); err != nil {
+				log.Printf("Error applying permission overlay: %v", err)
+				http.Error(w, "Error applying permission overlay", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// Return the graph data as JSON
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(graphData); err != nil {
 			log.Printf("Error encoding graph data: %v", err)
 		}
 	})
-
-	// Serve the visualization HTML page
-	// mux.HandleFunc("/visualize", func(w http.ResponseWriter, r *http.Request) {
-	// 	w.Header().Set("Content-Type", "text/html")
-	// 	w.Write([]byte(graphVisualizationHTML))
-	// })
 }
 
 func (s *AuthzService) generateGraphData(
@@ -80,6 +106,7 @@ func (s *AuthzService) generateGraphData(
 	entityID,
 	relationshipType,
 	depth string,
+	page graphPage,
 ) (*GraphData, error) {
 	log.Printf("Generating graph data with filters - type: '%s', id: '%s', relation: '%s', depth: '%s'",
 		entityType, entityID, relationshipType, depth)
@@ -91,6 +118,10 @@ func (s *AuthzService) generateGraphData(
 		Properties []byte
 	}
 
+	result := &GraphData{}
+
+	// Seeds are paged in (type, external_id) order; one extra row tells us
+	// whether there is a next page
 	seedQuery := `
 		SELECT 
 			type, external_id, properties
@@ -99,9 +130,18 @@ func (s *AuthzService) generateGraphData(
 		WHERE 
 			($1 = '' OR type = $1)
 			AND ($2 = '' OR external_id = $2)
+			AND (NOT $3 OR (type, external_id) > ($4, $5))
+		ORDER BY type, external_id
+		LIMIT $6
 	`
 
-	seedRows, err := s.graph.Pool.Query(ctx, seedQuery, entityType, entityID)
+	var afterType, afterID string
+	if page.Cursor != nil {
+		afterType, afterID = page.Cursor.Type, page.Cursor.ID
+	}
+
+	seedRows, err := s.graph.Pool.Query(ctx, seedQuery, entityType, entityID,
+		page.Cursor != nil, afterType, afterID, page.Limit+1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query seed entities: %w", err)
 	}
@@ -120,6 +160,16 @@ func (s *AuthzService) generateGraphData(
 
 		seedEntities = append(seedEntities, entity)
 	}
+	seedRows.Close()
+
+	if len(seedEntities) > page.Limit {
+		seedEntities = seedEntities[:page.Limit]
+		last := seedEntities[len(seedEntities)-1]
+		result.NextCursor = encodeGraphCursor(graphCursor{Type: last.Type, ID: last.ExternalID})
+		result.Truncated = true
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"more than %d entities match the filters; follow next_cursor for the rest", page.Limit))
+	}
 
 	log.Printf("Found %d seed entities based on filters", len(seedEntities))
 	for _, e := range seedEntities {
@@ -149,8 +199,8 @@ func (s *AuthzService) generateGraphData(
 	}
 
 	// If no specific filters, but we're not finding organizations,
-	// let's explicitly add them to the seed entities
-	if entityType == "" && entityID == "" {
+	// let's explicitly add them to the seed entities (first page only)
+	if entityType == "" && entityID == "" && page.Cursor == nil && len(seedEntities) < page.Limit {
 		// Explicitly query for organizations
 		orgQuery := `
 			SELECT 
@@ -182,6 +232,9 @@ func (s *AuthzService) generateGraphData(
 				}
 
 				orgCount++
+				if len(seedEntities) >= page.Limit {
+					break
+				}
 
 				// Add to seed entities if not already included
 				orgID := fmt.Sprintf("%s:%s", org.Type, org.ExternalID)
@@ -217,7 +270,7 @@ func (s *AuthzService) generateGraphData(
 	currentDepth := 0
 	currentEntityIds := seedEntityIds
 
-	for currentDepth < depthInt && len(currentEntityIds) > 0 {
+	for currentDepth < depthInt && len(currentEntityIds) > 0 && len(allEntities) < page.Limit {
 		log.Printf("Processing depth %d with %d entities", currentDepth, len(currentEntityIds))
 
 		// Build query to find all entities connected to current set
@@ -246,9 +299,13 @@ func (s *AuthzService) generateGraphData(
 			WHERE
 				(r.object_type || ':' || r.object_id) = ANY($1)
 				AND ($2 = '' OR r.relation = $2)
+
+			-- Rows may repeat known entities, which count against the limit
+			-- too, so one row past it is enough to fill the remaining budget
+			LIMIT $3
 		`
 
-		relatedRows, err := s.graph.Pool.Query(ctx, relatedQuery, pq.Array(currentEntityIds), relationshipType)
+		relatedRows, err := s.graph.Pool.Query(ctx, relatedQuery, pq.Array(currentEntityIds), relationshipType, page.Limit+1)
 		if err != nil {
 			return nil, fmt.Errorf("failed to query related entities at depth %d: %w", currentDepth, err)
 		}
@@ -274,6 +331,12 @@ func (s *AuthzService) generateGraphData(
 
 			// Add to all entities if not already included
 			if _, exists := allEntities[entityKey]; !exists {
+				if len(allEntities) >= page.Limit {
+					result.Truncated = true
+					result.Warnings = append(result.Warnings, fmt.Sprintf(
+						"node limit of %d reached at depth %d; narrow the filters or raise limit", page.Limit, currentDepth+1))
+					break
+				}
 				allEntities[entityKey] = entity
 				newEntityIds = append(newEntityIds, entityKey)
 			}
@@ -335,10 +398,12 @@ func (s *AuthzService) generateGraphData(
 		WHERE 
 			(subject_type || ':' || subject_id) = ANY($1)
 			AND (object_type || ':' || object_id) = ANY($1)
-			AND ($2 = '' OR relation = $2);
+			AND ($2 = '' OR relation = $2)
+		LIMIT $3;
 	`
 
-	relRows, err := s.graph.Pool.Query(ctx, relQuery, pq.Array(nodeKeys), relationshipType)
+	linkLimit := page.Limit * graphLinksPerNode
+	relRows, err := s.graph.Pool.Query(ctx, relQuery, pq.Array(nodeKeys), relationshipType, linkLimit+1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query relationships: %w", err)
 	}
@@ -355,6 +420,13 @@ func (s *AuthzService) generateGraphData(
 			return nil, fmt.Errorf("failed to scan relationship: %w", err)
 		}
 
+		if len(links) >= linkLimit {
+			result.Truncated = true
+			result.Warnings = append(result.Warnings, fmt.Sprintf(
+				"link limit of %d reached; some relations between the returned nodes are missing", linkLimit))
+			break
+		}
+
 		sourceID := subjectType + ":" + subjectID
 		targetID := objectType + ":" + objectID
 
@@ -383,10 +455,9 @@ func (s *AuthzService) generateGraphData(
 
 	log.Printf("Final graph has %d nodes and %d links", len(nodes), len(links))
 
-	return &GraphData{
-		Nodes: nodes,
-		Links: links,
-	}, nil
+	result.Nodes = nodes
+	result.Links = links
+	return result, nil
 }
 
 // Helper function to check if a string is in a slice
@@ -0,0 +1,156 @@
+package authzserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// PermissionOverlay describes the permission check painted over a graph. The
+// nodes and links through which the subject holds the permission are marked
+// with access so the viewer can color the effective-access subgraph.
+type PermissionOverlay struct {
+	Subject    string `json:"subject"`
+	Permission string `json:"permission"`
+	Object     string `json:"object"`
+	Expression string `json:"expression,omitempty"`
+	Allowed    bool   `json:"allowed"`
+	Reason     string `json:"reason"`
+}
+
+// parseOverlayQuery reads the overlay parameters of /api/graph. The overlay
+// checks subject (type:id) against permission on the entity the graph is
+// centred on, so entity_type and entity_id are required with it. A nil
+// request means no overlay was asked for.
+func parseOverlayQuery(query url.Values) (*PermissionPathRequest, error) {
+	subject := query.Get("subject")
+	permission := query.Get("permission")
+	if subject == "" && permission == "" {
+		return nil, nil
+	}
+	if subject == "" || permission == "" {
+		return nil, errors.New("subject and permission must be given together")
+	}
+
+	subjectType, subjectID, ok := strings.Cut(subject, ":")
+	if !ok || subjectType == "" || subjectID == "" {
+		return nil, fmt.Errorf("subject %q is not in type:id form", subject)
+	}
+
+	req := &PermissionPathRequest{
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		Permission:  permission,
+		ObjectType:  query.Get("entity_type"),
+		ObjectID:    query.Get("entity_id"),
+	}
+	if req.ObjectType == "" || req.ObjectID == "" {
+		return nil, errors.New("entity_type and entity_id are required for a permission overlay")
+	}
+	return req, nil
+}
+
+// applyPermissionOverlay checks the permission and, when it is granted,
+// marks the nodes and links of every path that grants it
+func (s *AuthzService) applyPermissionOverlay(ctx context.Context, data *GraphData, req PermissionPathRequest) error {
+	overlay := &PermissionOverlay{
+		Subject:    req.SubjectType + ":" + req.SubjectID,
+		Permission: req.Permission,
+		Object:     req.ObjectType + ":" + req.ObjectID,
+	}
+	data.Overlay = overlay
+
+	err := s.graph.Pool.QueryRow(ctx, `
+		SELECT condition_expression
+		FROM permission_definitions
+		WHERE entity_type = $1 AND permission_name = $2
+	`, req.ObjectType, req.Permission).Scan(&overlay.Expression)
+	if err != nil {
+		log.Printf("Error retrieving permission definition for overlay: %v", err)
+		overlay.Reason = graph.ReasonUnknownPermission
+		return nil
+	}
+
+	contextData := map[string]interface{}{"request": map[string]interface{}{}}
+	decision, err := s.graph.DecideCondition(ctx, overlay.Expression,
+		req.SubjectType, req.SubjectID, req.ObjectType, req.ObjectID, contextData)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate permission: %w", err)
+	}
+	overlay.Allowed, overlay.Reason = decision.Allowed, decision.Reason
+
+	_ = s.auditLogger.LogPermissionCheck(ctx, model.Subject{Type: req.SubjectType, ID: req.SubjectID},
+		req.Permission, model.Entity{Type: req.ObjectType, ID: req.ObjectID}, decision.Allowed, nil, nil)
+
+	if !decision.Allowed {
+		// Paths found for a denied check only satisfy part of the condition
+		return nil
+	}
+
+	expression, err := graph.NewConditionParser(overlay.Expression).Parse()
+	if err != nil {
+		return fmt.Errorf("failed to parse condition: %w", err)
+	}
+	_, nodes, links, err := s.findPermissionPaths(ctx, expression,
+		req.SubjectType, req.SubjectID, req.ObjectType, req.ObjectID)
+	if err != nil {
+		return fmt.Errorf("failed to find permission paths: %w", err)
+	}
+
+	markAccess(data, nodes, links)
+	return nil
+}
+
+// markAccess flags the given path nodes and links in data, adding any the
+// graph walk did not reach so the access subgraph is always complete
+func markAccess(data *GraphData, nodes []Node, links []Link) {
+	onPath := make(map[string]bool)
+	for _, link := range links {
+		onPath[link.Source] = true
+		onPath[link.Target] = true
+	}
+
+	seenNodes := make(map[string]bool)
+	for i := range data.Nodes {
+		seenNodes[data.Nodes[i].ID] = true
+		if onPath[data.Nodes[i].ID] {
+			data.Nodes[i].Access = true
+		}
+	}
+	for _, node := range nodes {
+		if !seenNodes[node.ID] && onPath[node.ID] {
+			node.Access = true
+			data.Nodes = append(data.Nodes, node)
+			seenNodes[node.ID] = true
+		}
+	}
+
+	linkKey := func(l Link) string { return l.Source + "|" + l.Type + "|" + l.Target }
+	pathLinks := make(map[string]bool)
+	for _, link := range links {
+		pathLinks[linkKey(link)] = true
+	}
+
+	seenLinks := make(map[string]bool)
+	for i := range data.Links {
+		key := linkKey(data.Links[i])
+		seenLinks[key] = true
+		if pathLinks[key] {
+			data.Links[i].Access = true
+		}
+	}
+	for _, link := range links {
+		key := linkKey(link)
+		if !seenLinks[key] {
+			link.Access = true
+			data.Links = append(data.Links, link)
+			seenLinks[key] = true
+		}
+	}
+}
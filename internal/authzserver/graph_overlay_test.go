@@ -0,0 +1,67 @@
+package authzserver
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOverlayQuery(t *testing.T) {
+	req, err := parseOverlayQuery(url.Values{"depth": {"2"}})
+	require.NoError(t, err)
+	assert.Nil(t, req, "no overlay without subject and permission")
+
+	req, err = parseOverlayQuery(url.Values{
+		"subject":     {"user:alice"},
+		"permission":  {"view"},
+		"entity_type": {"document"},
+		"entity_id":   {"plan"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PermissionPathRequest{
+		SubjectType: "user", SubjectID: "alice", Permission: "view",
+		ObjectType: "document", ObjectID: "plan",
+	}, *req)
+
+	invalid := []url.Values{
+		{"subject": {"user:alice"}},
+		{"subject": {"alice"}, "permission": {"view"}, "entity_type": {"document"}, "entity_id": {"plan"}},
+		{"subject": {"user:alice"}, "permission": {"view"}, "entity_type": {"document"}},
+	}
+	for _, query := range invalid {
+		_, err := parseOverlayQuery(query)
+		assert.Error(t, err, query.Encode())
+	}
+}
+
+func TestMarkAccess(t *testing.T) {
+	data := &GraphData{
+		Nodes: []Node{{ID: "user:alice"}, {ID: "team:eng"}, {ID: "user:bob"}},
+		Links: []Link{
+			{Source: "user:alice", Target: "team:eng", Type: "member"},
+			{Source: "user:bob", Target: "team:eng", Type: "member"},
+		},
+	}
+	pathNodes := []Node{{ID: "user:alice"}, {ID: "team:eng"}, {ID: "document:plan"}}
+	pathLinks := []Link{
+		{Source: "user:alice", Target: "team:eng", Type: "member"},
+		{Source: "team:eng", Target: "document:plan", Type: "viewer"},
+	}
+
+	markAccess(data, pathNodes, pathLinks)
+
+	access := make(map[string]bool)
+	for _, n := range data.Nodes {
+		access[n.ID] = n.Access
+	}
+	assert.Equal(t, map[string]bool{
+		"user:alice": true, "team:eng": true, "user:bob": false, "document:plan": true,
+	}, access)
+
+	require.Len(t, data.Links, 3)
+	assert.True(t, data.Links[0].Access)
+	assert.False(t, data.Links[1].Access, "bob's membership does not grant alice anything")
+	assert.True(t, data.Links[2].Access, "path links outside the walk are added")
+}
@@ -0,0 +1,76 @@
+package authzserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// defaultGraphNodeLimit bounds /api/graph responses when no limit is given
+	defaultGraphNodeLimit = 500
+	// maxGraphNodeLimit is the largest limit a caller may ask for
+	maxGraphNodeLimit = 5000
+	// graphLinksPerNode sets the link limit relative to the node limit
+	graphLinksPerNode = 10
+)
+
+// graphPage bounds one /api/graph response
+type graphPage struct {
+	// Limit is the most nodes returned
+	Limit int
+	// Cursor is the seed entity the page starts after, nil for the first page
+	Cursor *graphCursor
+}
+
+// graphCursor is the last seed entity of a page
+type graphCursor struct {
+	Type string `json:"t"`
+	ID   string `json:"i"`
+}
+
+// parseGraphPage reads the limit and cursor parameters of /api/graph
+func parseGraphPage(query url.Values) (graphPage, error) {
+	page := graphPage{Limit: defaultGraphNodeLimit}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return graphPage{}, fmt.Errorf("limit must be a positive integer, got %q", limitStr)
+		}
+		if limit > maxGraphNodeLimit {
+			return graphPage{}, fmt.Errorf("limit may be at most %d", maxGraphNodeLimit)
+		}
+		page.Limit = limit
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeGraphCursor(cursor)
+		if err != nil {
+			return graphPage{}, err
+		}
+		page.Cursor = &c
+	}
+
+	return page, nil
+}
+
+func encodeGraphCursor(c graphCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeGraphCursor(s string) (graphCursor, error) {
+	var c graphCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil || c.Type == "" || c.ID == "" {
+		return graphCursor{}, errors.New("invalid cursor")
+	}
+	return c, nil
+}
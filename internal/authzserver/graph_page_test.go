@@ -0,0 +1,34 @@
+package authzserver
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGraphPage(t *testing.T) {
+	page, err := parseGraphPage(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, graphPage{Limit: defaultGraphNodeLimit}, page)
+
+	cursor := encodeGraphCursor(graphCursor{Type: "user", ID: "alice:smith"})
+	page, err = parseGraphPage(url.Values{"limit": {"50"}, "cursor": {cursor}})
+	require.NoError(t, err)
+	assert.Equal(t, 50, page.Limit)
+	require.NotNil(t, page.Cursor)
+	assert.Equal(t, graphCursor{Type: "user", ID: "alice:smith"}, *page.Cursor)
+
+	invalid := []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"ten"}},
+		{"limit": {"5001"}},
+		{"cursor": {"not-a-cursor"}},
+		{"cursor": {encodeGraphCursor(graphCursor{Type: "user"})}},
+	}
+	for _, query := range invalid {
+		_, err := parseGraphPage(query)
+		assert.Error(t, err, query.Encode())
+	}
+}
@@ -0,0 +1,374 @@
+package authzserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	authzv1 "github.com/dangerclosesec/supra/api/authz/v1"
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/tracing"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcWrites are the methods read-only mode rejects
+var grpcWrites = map[string]bool{
+	authzv1.AuthzService_CreateEntity_FullMethodName:    true,
+	authzv1.AuthzService_CreateRelation_FullMethodName:  true,
+	authzv1.AuthzService_WritePermission_FullMethodName: true,
+}
+
+// grpcHeaders are the metadata keys copied into the request the shared
+// check and write paths read the caller from
+var grpcHeaders = []string{"authorization", "user-agent", "x-request-id", "x-api-key", principalHeader, tenantHeader}
+
+// GRPCServer returns a gRPC server for the AuthzService API in
+// api/authz/v1, backed by the same graph as Handler. Callers authenticate
+// and name their principal and tenant with the same headers, sent as
+// metadata.
+func (s *AuthzService) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor, grpcLogInterceptor, grpcQueryLabelInterceptor, s.grpcMetricsInterceptor, s.grpcAuthFailureLimit, s.grpcAPIKeyInterceptor, s.grpcRateLimitInterceptor, s.grpcModeInterceptor))
+	server := grpc.NewServer(opts...)
+	authzv1.RegisterAuthzServiceServer(server, &grpcService{s: s})
+	return server
+}
+
+// grpcLogInterceptor logs each call like logMiddleware logs requests
+func grpcLogInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	log.Printf("[gRPC] %s %s %s %s", info.FullMethod, addr, status.Code(err), time.Since(start))
+	return resp, err
+}
+
+// grpcModeInterceptor turns calls away in read-only and maintenance mode,
+// as modeGuard does for HTTP
+func (s *AuthzService) grpcModeInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	mode := s.mode.get()
+	switch {
+	case mode.Mode == ModeMaintenance:
+		return nil, status.Errorf(codes.Unavailable, "the authorization service is down for maintenance: %s", mode.Reason)
+	case mode.Mode == ModeReadOnly && grpcWrites[info.FullMethod]:
+		return nil, status.Errorf(codes.Unavailable, "the authorization service is read-only: %s", mode.Reason)
+	}
+	return handler(ctx, req)
+}
+
+// grpcAPIKeyInterceptor applies apiKeyAuth's rules to calls: writing
+// permission definitions needs an admin key, the other writes a write key
+func (s *AuthzService) grpcAPIKeyInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	if !s.apiKeys.enforced() {
+		return handler(ctx, req)
+	}
+
+	key, err := s.authenticateAPIKey(ctx, apiKeySecret(grpcRequest(ctx)))
+	if err != nil {
+		log.Printf("Error looking up API key: %v", err)
+		return nil, status.Error(codes.Internal, "failed to check the API key")
+	}
+	if key == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "a valid API key is required in the %s metadata or as a bearer token", strings.ToLower(apiKeyHeader))
+	}
+
+	required := config.ScopeRead
+	switch {
+	case info.FullMethod == authzv1.AuthzService_WritePermission_FullMethodName:
+		required = config.ScopeAdmin
+	case grpcWrites[info.FullMethod]:
+		required = config.ScopeWrite
+	}
+	if !scopeCovers(key.Scope, required) {
+		return nil, status.Errorf(codes.PermissionDenied, "API key %s has %s scope; %s needs %s", key.Name, key.Scope, info.FullMethod, required)
+	}
+	return handler(withAPIKey(ctx, *key), req)
+}
+
+// grpcRequest describes a call as the HTTP request the shared paths use to
+// meter, audit and authorize it
+func grpcRequest(ctx context.Context) *http.Request {
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range grpcHeaders {
+			if values := md.Get(key); len(values) > 0 {
+				r.Header.Set(key, values[0])
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	return r
+}
+
+// adminStatus converts a refused write to the matching gRPC status
+func adminStatus(err *adminError) error {
+	code := codes.Internal
+	switch err.status {
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	}
+	return status.Errorf(code, "%s: %s", err.message, err.details)
+}
+
+// structMap converts a protobuf Struct, which may be nil, to a map
+func structMap(s *structpb.Struct) map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	return s.AsMap()
+}
+
+// grpcService implements authzv1.AuthzServiceServer on an AuthzService
+type grpcService struct {
+	authzv1.UnimplementedAuthzServiceServer
+	s *AuthzService
+}
+
+func (g *grpcService) Check(ctx context.Context, req *authzv1.CheckRequest) (*authzv1.CheckResponse, error) {
+	if req.SubjectType == "" || req.SubjectId == "" || req.Permission == "" ||
+		req.ObjectType == "" || req.ObjectId == "" {
+		return nil, status.Error(codes.InvalidArgument, "subject_type, subject_id, permission, object_type and object_id are required")
+	}
+
+	check := CheckPermissionRequest{
+		SubjectType:   req.SubjectType,
+		SubjectID:     req.SubjectId,
+		Permission:    req.Permission,
+		ObjectType:    req.ObjectType,
+		ObjectID:      req.ObjectId,
+		Context:       structMap(req.Context),
+		SchemaVersion: int(req.SchemaVersion),
+	}
+	if req.AsOf != nil {
+		asOf := req.AsOf.AsTime()
+		check.AsOf = &asOf
+	}
+
+	ctx, cancel := g.s.startBudget(ctx, budget.Standard)
+	defer cancel()
+
+	decision, err := g.s.decide(ctx, grpcRequest(ctx), check)
+	if errors.Is(err, errPermissionNotDefined) || errors.Is(err, graph.ErrSchemaVersionNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if budgetExceeded(err) {
+		return nil, status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	if err != nil {
+		log.Printf("Error evaluating permission: %v", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if decision.Deprecated != nil {
+		warning := deprecationWarning(req.ObjectType, req.Permission, *decision.Deprecated)
+		if err := grpc.SetHeader(ctx, metadata.Pairs("deprecation", "true", "warning", warning)); err != nil {
+			log.Printf("Failed to send deprecation warning: %v", err)
+		}
+	}
+	return &authzv1.CheckResponse{Allowed: decision.Allowed, Reason: decision.Reason}, nil
+}
+
+func (g *grpcService) CreateEntity(ctx context.Context, req *authzv1.CreateEntityRequest) (*authzv1.Entity, error) {
+	if req.Type == "" || req.ExternalId == "" {
+		return nil, status.Error(codes.InvalidArgument, "type and external_id are required")
+	}
+
+	entityReq := EntityRequest{Type: req.Type, ExternalID: req.ExternalId, Properties: structMap(req.Properties)}
+	properties := entityReq.Properties
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	r := grpcRequest(ctx)
+	if err := g.s.checkAdmin(r, &adminTarget{Type: req.Type, ID: req.ExternalId, Properties: properties}); err != nil {
+		return nil, adminStatus(err)
+	}
+
+	ctx, cancel := g.s.startBudget(ctx, budget.Standard)
+	defer cancel()
+
+	var entity *graph.Entity
+	var err error
+	created := true
+	if req.Upsert {
+		entity, created, err = g.s.upsertEntity(ctx, r, entityReq)
+	} else {
+		entity, err = g.s.createEntity(ctx, r, entityReq)
+	}
+	if errors.Is(err, errEntityExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "entity %s:%s already exists", req.Type, req.ExternalId)
+	}
+	if err != nil {
+		log.Printf("Error creating entity: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to create entity: %v", err)
+	}
+
+	msg, err := entityMessage(entity)
+	if err != nil {
+		return nil, err
+	}
+	msg.Status = writeCreated
+	if !created {
+		msg.Status = writeUpdated
+	}
+	return msg, nil
+}
+
+func (g *grpcService) GetEntity(ctx context.Context, req *authzv1.GetEntityRequest) (*authzv1.Entity, error) {
+	if req.Type == "" || req.ExternalId == "" {
+		return nil, status.Error(codes.InvalidArgument, "type and external_id are required")
+	}
+
+	ctx, cancel := g.s.startBudget(ctx, budget.Standard)
+	defer cancel()
+
+	entity, err := g.s.graph.GetEntity(ctx, req.Type, req.ExternalId)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return nil, status.Errorf(codes.NotFound, "entity %s:%s not found", req.Type, req.ExternalId)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to retrieve entity: %v", err)
+	}
+	return entityMessage(entity)
+}
+
+func (g *grpcService) CreateRelation(ctx context.Context, req *authzv1.CreateRelationRequest) (*authzv1.Relation, error) {
+	if req.SubjectType == "" || req.SubjectId == "" || req.Relation == "" ||
+		req.ObjectType == "" || req.ObjectId == "" {
+		return nil, status.Error(codes.InvalidArgument, "subject_type, subject_id, relation, object_type and object_id are required")
+	}
+
+	r := grpcRequest(ctx)
+	if err := g.s.checkAdmin(r, &adminTarget{
+		Type:    req.ObjectType,
+		ID:      req.ObjectId,
+		Subject: &model.Subject{Type: req.SubjectType, ID: req.SubjectId},
+	}); err != nil {
+		return nil, adminStatus(err)
+	}
+
+	ctx, cancel := g.s.startBudget(ctx, budget.Standard)
+	defer cancel()
+
+	relationReq := RelationRequest{
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectId,
+		Relation:    req.Relation,
+		ObjectType:  req.ObjectType,
+		ObjectID:    req.ObjectId,
+		Metadata:    structMap(req.Metadata),
+		Source:      req.Source,
+	}
+	var relation *graph.Relation
+	var err error
+	created := true
+	if req.Upsert {
+		relation, created, err = g.s.upsertRelation(ctx, r, relationReq)
+	} else {
+		relation, err = g.s.createRelation(ctx, r, relationReq)
+	}
+	var limitErr *graph.CardinalityError
+	if errors.As(err, &limitErr) {
+		return nil, status.Error(codes.FailedPrecondition, limitErr.Error())
+	}
+	if errors.Is(err, graph.ErrInvalidRelation) || errors.Is(err, graph.ErrInvalidSource) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create relation: %v", err)
+	}
+
+	metadata, err := structpb.NewStruct(relation.Metadata)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode relation metadata: %v", err)
+	}
+	msg := &authzv1.Relation{
+		Id:          relation.ID,
+		SubjectType: relation.SubjectType,
+		SubjectId:   relation.SubjectID,
+		Relation:    relation.Relation,
+		ObjectType:  relation.ObjectType,
+		ObjectId:    relation.ObjectID,
+		Metadata:    metadata,
+		CreatedAt:   timestamppb.New(relation.CreatedAt),
+		Status:      writeCreated,
+		Source:      relation.Source,
+	}
+	if !created {
+		msg.Status = writeExisting
+	}
+	return msg, nil
+}
+
+func (g *grpcService) WritePermission(ctx context.Context, req *authzv1.WritePermissionRequest) (*authzv1.PermissionDefinition, error) {
+	if req.EntityType == "" || req.PermissionName == "" || req.ConditionExpression == "" {
+		return nil, status.Error(codes.InvalidArgument, "entity_type, permission_name and condition_expression are required")
+	}
+
+	// Permission definitions apply to every tenant
+	if err := g.s.checkAdmin(grpcRequest(ctx), nil); err != nil {
+		return nil, adminStatus(err)
+	}
+
+	ctx, cancel := g.s.startBudget(ctx, budget.Standard)
+	defer cancel()
+
+	perm, err := g.s.graph.AddPermissionDefinition(ctx, req.EntityType, req.PermissionName,
+		req.ConditionExpression, req.Description)
+	if errors.Is(err, graph.ErrConditionTooComplex) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to write permission: %v", err)
+	}
+	return &authzv1.PermissionDefinition{
+		Id:                  perm.ID,
+		EntityType:          perm.EntityType,
+		PermissionName:      perm.PermissionName,
+		ConditionExpression: perm.ConditionExpression,
+		Description:         perm.Description,
+		CreatedAt:           timestamppb.New(perm.CreatedAt),
+	}, nil
+}
+
+func entityMessage(entity *graph.Entity) (*authzv1.Entity, error) {
+	properties, err := structpb.NewStruct(entity.Properties)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to encode entity properties: %v", err))
+	}
+	return &authzv1.Entity{
+		Id:         entity.ID,
+		Type:       entity.Type,
+		ExternalId: entity.ExternalID,
+		Properties: properties,
+		CreatedAt:  timestamppb.New(entity.CreatedAt),
+		UpdatedAt:  timestamppb.New(entity.UpdatedAt),
+	}, nil
+}
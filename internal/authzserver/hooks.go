@@ -0,0 +1,115 @@
+package authzserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// CheckHook runs around every permission check made over HTTP, gRPC, the
+// REST gateway and bulk check jobs, so deployments can add feature flags,
+// licensing gates and deny overrides without changing the check path.
+// Hooks run in the order they were added. An error fails the check.
+type CheckHook interface {
+	// BeforeCheck runs before the permission is evaluated. It may change
+	// the check, e.g. adding values to its context for request.*
+	// conditions, or decide it by returning a decision, in which case the
+	// permission isn't evaluated and later hooks' BeforeCheck are skipped.
+	BeforeCheck(ctx context.Context, check *CheckPermissionRequest) (*graph.Decision, error)
+	// AfterCheck runs with the decision and returns the decision to use
+	AfterCheck(ctx context.Context, check CheckPermissionRequest, decision graph.Decision) (graph.Decision, error)
+}
+
+// CheckHookFuncs is a CheckHook made of functions; either may be nil
+type CheckHookFuncs struct {
+	Before func(ctx context.Context, check *CheckPermissionRequest) (*graph.Decision, error)
+	After  func(ctx context.Context, check CheckPermissionRequest, decision graph.Decision) (graph.Decision, error)
+}
+
+func (f CheckHookFuncs) BeforeCheck(ctx context.Context, check *CheckPermissionRequest) (*graph.Decision, error) {
+	if f.Before == nil {
+		return nil, nil
+	}
+	return f.Before(ctx, check)
+}
+
+func (f CheckHookFuncs) AfterCheck(ctx context.Context, check CheckPermissionRequest, decision graph.Decision) (graph.Decision, error) {
+	if f.After == nil {
+		return decision, nil
+	}
+	return f.After(ctx, check, decision)
+}
+
+type namedCheckHook struct {
+	name string
+	hook CheckHook
+}
+
+var (
+	registeredHooksMu sync.Mutex
+	registeredHooks   []namedCheckHook
+)
+
+// RegisterCheckHook adds a hook to every AuthzService created afterwards.
+// It is meant to be called from the init function of a package the
+// service's main package imports for its side effects.
+func RegisterCheckHook(name string, hook CheckHook) {
+	registeredHooksMu.Lock()
+	defer registeredHooksMu.Unlock()
+	registeredHooks = append(registeredHooks, namedCheckHook{name, hook})
+}
+
+// AddCheckHook adds a hook to this service's checks. Hooks must be added
+// before the service starts serving. name identifies the hook in decision
+// reasons and errors.
+func (s *AuthzService) AddCheckHook(name string, hook CheckHook) {
+	s.hooks = append(s.hooks, namedCheckHook{name, hook})
+}
+
+// checkHooks returns the hooks registered with RegisterCheckHook
+func checkHooks() []namedCheckHook {
+	registeredHooksMu.Lock()
+	defer registeredHooksMu.Unlock()
+	return append([]namedCheckHook(nil), registeredHooks...)
+}
+
+// beforeCheck runs the hooks' BeforeCheck until one decides the check
+func (s *AuthzService) beforeCheck(ctx context.Context, check *CheckPermissionRequest) (*graph.Decision, error) {
+	for _, h := range s.hooks {
+		decision, err := h.hook.BeforeCheck(ctx, check)
+		if err != nil {
+			return nil, fmt.Errorf("check hook %s: %w", h.name, err)
+		}
+		if decision != nil {
+			hookReason(decision, h.name)
+			return decision, nil
+		}
+	}
+	return nil, nil
+}
+
+// afterCheck passes the decision through every hook's AfterCheck
+func (s *AuthzService) afterCheck(ctx context.Context, check CheckPermissionRequest, decision graph.Decision) (graph.Decision, error) {
+	for _, h := range s.hooks {
+		next, err := h.hook.AfterCheck(ctx, check, decision)
+		if err != nil {
+			return graph.Decision{}, fmt.Errorf("check hook %s: %w", h.name, err)
+		}
+		if next.Allowed != decision.Allowed && next.Reason == decision.Reason {
+			// An override must not keep the reason for the opposite outcome
+			next.Reason = ""
+		}
+		hookReason(&next, h.name)
+		decision = next
+	}
+	return decision, nil
+}
+
+// hookReason attributes a decision without a reason to the hook that made it
+func hookReason(decision *graph.Decision, name string) {
+	if decision.Reason == "" {
+		decision.Reason = graph.ReasonHook + ":" + name
+	}
+}
@@ -0,0 +1,190 @@
+package authzserver
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/notify"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// definitionStore is a graph store holding only permission definitions,
+// keyed by "type.permission"; every other table is empty
+type definitionStore map[string]graph.ResolvedPermission
+
+func (s definitionStore) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (s definitionStore) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return emptyRows{}, nil
+}
+
+func (s definitionStore) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if !strings.Contains(sql, "FROM permission_definitions") {
+		return errRow{errors.New("definitionStore: unexpected query")}
+	}
+	def, ok := s[args[0].(string)+"."+args[1].(string)]
+	if !ok {
+		return errRow{pgx.ErrNoRows}
+	}
+	return definitionRow(def)
+}
+
+func (s definitionStore) Begin(ctx context.Context) (pgx.Tx, error) {
+	return nil, errors.New("definitionStore: transactions are not supported")
+}
+
+type definitionRow graph.ResolvedPermission
+
+func (r definitionRow) Scan(dest ...any) error {
+	*dest[0].(*string) = r.Condition
+	*dest[1].(**string) = r.Deprecated
+	*dest[2].(**string) = r.Sensitive
+	return nil
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...any) error { return r.err }
+
+type emptyRows struct{}
+
+func (emptyRows) Close()                                       {}
+func (emptyRows) Err() error                                   { return nil }
+func (emptyRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (emptyRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (emptyRows) Next() bool                                   { return false }
+func (emptyRows) Scan(dest ...any) error                       { return nil }
+func (emptyRows) Values() ([]any, error)                       { return nil, nil }
+func (emptyRows) RawValues() [][]byte                          { return nil }
+func (emptyRows) Conn() *pgx.Conn                              { return nil }
+
+func definitionGraph(t *testing.T, defs definitionStore) *graph.IdentityGraph {
+	t.Helper()
+	g, err := graph.New(context.Background(), defs)
+	require.NoError(t, err)
+	return g
+}
+
+func TestCheckHookDecides(t *testing.T) {
+	store := &fakeAuditStore{}
+	s := &AuthzService{
+		graph:       definitionGraph(t, definitionStore{}),
+		usage:       newUsageMeter(),
+		auditLogger: newAuditLogger(store, AuditLoggerOptions{BatchSize: 10, FlushInterval: time.Hour}),
+	}
+	var after []graph.Decision
+	s.AddCheckHook("license", CheckHookFuncs{
+		Before: func(ctx context.Context, check *CheckPermissionRequest) (*graph.Decision, error) {
+			if check.ObjectType == "report" {
+				return &graph.Decision{Allowed: false}, nil
+			}
+			return nil, nil
+		},
+		After: func(ctx context.Context, check CheckPermissionRequest, decision graph.Decision) (graph.Decision, error) {
+			after = append(after, decision)
+			return decision, nil
+		},
+	})
+
+	// The hook decides a permission the schema doesn't define
+	decision, err := s.decide(context.Background(), httptest.NewRequest("POST", "/check", nil), CheckPermissionRequest{
+		SubjectType: "user", SubjectID: "alice", Permission: "view", ObjectType: "report", ObjectID: "q3",
+	})
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "hook:license", decision.Reason)
+	assert.Equal(t, []graph.Decision{{Allowed: false, Reason: "hook:license"}}, after, "after hooks see hook decisions")
+	require.NoError(t, s.auditLogger.Close(context.Background()))
+	assert.Len(t, store.written(), 1, "hook decisions are audited")
+}
+
+func TestCheckHookAllowsSensitive(t *testing.T) {
+	label := "break-glass"
+	store := &fakeAuditStore{}
+	sink := &recordedEvents{}
+	notifier := notify.New([]notify.Sink{sink}, notify.Options{Workers: 1})
+	s := &AuthzService{
+		graph: definitionGraph(t, definitionStore{
+			"account.emergency_access": {Condition: "owner", Sensitive: &label},
+		}),
+		usage: newUsageMeter(),
+		// Ordinary allowed checks are all but sampled away
+		auditLogger: newAuditLogger(store, AuditLoggerOptions{BatchSize: 10, FlushInterval: time.Hour, AllowedSampleRate: 1e-9}),
+	}
+	s.SetSensitiveNotifier(notifier)
+	s.AddCheckHook("oncall", CheckHookFuncs{
+		Before: func(ctx context.Context, check *CheckPermissionRequest) (*graph.Decision, error) {
+			return &graph.Decision{Allowed: true}, nil
+		},
+	})
+
+	decision, err := s.decide(context.Background(), httptest.NewRequest("POST", "/check", nil), CheckPermissionRequest{
+		SubjectType: "user", SubjectID: "alice", Permission: "emergency_access", ObjectType: "account", ObjectID: "acme",
+	})
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	require.NoError(t, notifier.Close(context.Background()))
+	require.NoError(t, s.auditLogger.Close(context.Background()))
+
+	require.Len(t, sink.events, 1, "a hook allowing a sensitive permission still notifies")
+	assert.Equal(t, "break-glass", sink.events[0].Label)
+	assert.Equal(t, "hook:oncall", sink.events[0].Reason)
+	assert.Len(t, store.written(), 1, "and is audited regardless of sampling")
+}
+
+func TestCheckHookOrder(t *testing.T) {
+	s := &AuthzService{}
+	s.AddCheckHook("flags", CheckHookFuncs{
+		Before: func(ctx context.Context, check *CheckPermissionRequest) (*graph.Decision, error) {
+			if check.Context == nil {
+				check.Context = map[string]interface{}{}
+			}
+			check.Context["beta"] = true
+			return nil, nil
+		},
+	})
+	s.AddCheckHook("suspended", CheckHookFuncs{
+		After: func(ctx context.Context, check CheckPermissionRequest, decision graph.Decision) (graph.Decision, error) {
+			if check.SubjectID == "mallory" {
+				decision.Allowed = false
+			}
+			return decision, nil
+		},
+	})
+
+	check := CheckPermissionRequest{SubjectType: "user", SubjectID: "mallory"}
+	decision, err := s.beforeCheck(context.Background(), &check)
+	require.NoError(t, err)
+	assert.Nil(t, decision, "no hook decided the check")
+	assert.Equal(t, true, check.Context["beta"])
+
+	overridden, err := s.afterCheck(context.Background(), check, graph.Decision{Allowed: true, Reason: graph.ReasonMatchedRelation})
+	require.NoError(t, err)
+	assert.Equal(t, graph.Decision{Allowed: false, Reason: "hook:suspended"}, overridden)
+
+	kept, err := s.afterCheck(context.Background(), CheckPermissionRequest{SubjectID: "alice"},
+		graph.Decision{Allowed: true, Reason: graph.ReasonMatchedRelation})
+	require.NoError(t, err)
+	assert.Equal(t, graph.Decision{Allowed: true, Reason: graph.ReasonMatchedRelation}, kept)
+}
+
+func TestCheckHookError(t *testing.T) {
+	s := &AuthzService{}
+	s.AddCheckHook("licensing", CheckHookFuncs{
+		Before: func(ctx context.Context, check *CheckPermissionRequest) (*graph.Decision, error) {
+			return nil, errors.New("license server unreachable")
+		},
+	})
+	_, err := s.decide(context.Background(), httptest.NewRequest("POST", "/check", nil), CheckPermissionRequest{})
+	assert.EqualError(t, err, "check hook licensing: license server unreachable")
+}
@@ -0,0 +1,763 @@
+package authzserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/jobs"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/google/uuid"
+)
+
+// Kinds of background job the service runs
+const (
+	// JobAuditExport builds a signed export of the audit chain
+	JobAuditExport = "audit_export"
+	// JobAccessReview lists who holds a permission on objects of a type,
+	// as CSV
+	JobAccessReview = "access_review"
+	// JobOrphanGC finds relations whose subject or object entity is
+	// missing, and optionally repairs or deletes them
+	JobOrphanGC = "orphan_gc"
+	// JobBulkImport creates entities and relations in bulk
+	JobBulkImport = "bulk_import"
+	// JobBulkCheck evaluates a list of checks, such as an entitlement
+	// review's spreadsheet, into a CSV of decisions
+	JobBulkCheck = "bulk_check"
+	// JobRevokeSource deletes every relation one source wrote
+	JobRevokeSource = "revoke_source"
+)
+
+// maxJobList bounds the jobs GET /api/jobs returns
+const maxJobList = 500
+
+// AuditExportJobParams are the params of an audit_export job
+type AuditExportJobParams struct {
+	From  int64 `json:"from,omitempty"`
+	Limit int   `json:"limit,omitempty"`
+}
+
+// AccessReviewJobParams are the params of an access_review job. Without
+// object IDs every object of the type is reviewed.
+type AccessReviewJobParams struct {
+	ObjectType  string                 `json:"object_type"`
+	Permission  string                 `json:"permission"`
+	ObjectIDs   []string               `json:"object_ids,omitempty"`
+	SubjectType string                 `json:"subject_type,omitempty"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+}
+
+// Orphan GC actions
+const (
+	OrphanReport = "report"
+	OrphanRepair = "repair"
+	OrphanDelete = "delete"
+)
+
+// OrphanGCJobParams are the params of an orphan_gc job. Report only counts
+// orphaned relations; repair creates their missing entities as stubs, as
+// /api/health/fix-orphaned-relationship does for one, and delete removes
+// them.
+type OrphanGCJobParams struct {
+	Action string `json:"action,omitempty"`
+}
+
+// OrphanGCResult is the result of an orphan_gc job
+type OrphanGCResult struct {
+	Action          string `json:"action"`
+	Found           int64  `json:"found"`
+	EntitiesCreated int64  `json:"entities_created,omitempty"`
+	Deleted         int64  `json:"deleted,omitempty"`
+}
+
+// BulkImportJobParams are the params of a bulk_import job. Entities are
+// created before relations; ones that already exist are skipped.
+// Relations without a source of their own are tagged with Source, or
+// import:<job ID> without one, so the import can be revoked as a whole.
+type BulkImportJobParams struct {
+	Entities  []EntityRequest   `json:"entities,omitempty"`
+	Relations []RelationRequest `json:"relations,omitempty"`
+	Source    string            `json:"source,omitempty"`
+}
+
+// BulkImportResult is the result of a bulk_import job
+type BulkImportResult struct {
+	EntitiesCreated  int      `json:"entities_created"`
+	EntitiesSkipped  int      `json:"entities_skipped"`
+	RelationsCreated int      `json:"relations_created"`
+	Errors           []string `json:"errors,omitempty"`
+}
+
+// maxImportErrors bounds the failures a bulk import reports individually
+const maxImportErrors = 100
+
+// BulkCheckJobParams are the params of a bulk_check job. They are usually
+// built from a CSV uploaded to /api/jobs/bulk-check.
+type BulkCheckJobParams struct {
+	Checks []CheckPermissionRequest `json:"checks"`
+}
+
+// RevokeSourceJobParams are the params of a revoke_source job
+type RevokeSourceJobParams struct {
+	Source string `json:"source"`
+}
+
+// JobRequest submits a background job
+type JobRequest struct {
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+func (p AuditExportJobParams) validate() error {
+	if p.From < 0 {
+		return errors.New("from must be a row number of at least 1")
+	}
+	if p.Limit < 0 || p.Limit > maxAuditExport {
+		return fmt.Errorf("limit must be between 1 and %d", maxAuditExport)
+	}
+	return nil
+}
+
+func (p AccessReviewJobParams) validate() error {
+	if p.ObjectType == "" || p.Permission == "" {
+		return errors.New("object_type and permission are required")
+	}
+	return nil
+}
+
+func (p OrphanGCJobParams) validate() error {
+	switch p.Action {
+	case "", OrphanReport, OrphanRepair, OrphanDelete:
+		return nil
+	}
+	return fmt.Errorf("action must be %s, %s or %s, got %q", OrphanReport, OrphanRepair, OrphanDelete, p.Action)
+}
+
+func (p BulkCheckJobParams) validate() error {
+	if len(p.Checks) == 0 {
+		return errors.New("checks are required")
+	}
+	if len(p.Checks) > maxBulkChecks {
+		return fmt.Errorf("at most %d checks can be run at once, got %d", maxBulkChecks, len(p.Checks))
+	}
+	for i, c := range p.Checks {
+		if c.SubjectType == "" || c.SubjectID == "" || c.Permission == "" || c.ObjectType == "" || c.ObjectID == "" {
+			return fmt.Errorf("checks[%d]: subject_type, subject_id, permission, object_type and object_id are required", i)
+		}
+	}
+	return nil
+}
+
+func (p BulkImportJobParams) validate() error {
+	if len(p.Entities) == 0 && len(p.Relations) == 0 {
+		return errors.New("entities or relations are required")
+	}
+	for i, e := range p.Entities {
+		if e.Type == "" || e.ExternalID == "" {
+			return fmt.Errorf("entities[%d]: type and external_id are required", i)
+		}
+	}
+	for i, r := range p.Relations {
+		if r.SubjectType == "" || r.SubjectID == "" || r.Relation == "" || r.ObjectType == "" || r.ObjectID == "" {
+			return fmt.Errorf("relations[%d]: subject_type, subject_id, relation, object_type and object_id are required", i)
+		}
+		if r.Source != "" {
+			if err := graph.ValidateSource(r.Source); err != nil {
+				return fmt.Errorf("relations[%d]: %w", i, err)
+			}
+		}
+	}
+	if p.Source != "" {
+		return graph.ValidateSource(p.Source)
+	}
+	return nil
+}
+
+func (p RevokeSourceJobParams) validate() error {
+	return graph.ValidateSource(p.Source)
+}
+
+// decodeJobParams decodes a job's params, which may be empty, and
+// validates them
+func decodeJobParams(kind string, raw json.RawMessage) (interface{ validate() error }, error) {
+	var params interface{ validate() error }
+	switch kind {
+	case JobAuditExport:
+		params = &AuditExportJobParams{}
+	case JobAccessReview:
+		params = &AccessReviewJobParams{}
+	case JobOrphanGC:
+		params = &OrphanGCJobParams{}
+	case JobBulkImport:
+		params = &BulkImportJobParams{}
+	case JobBulkCheck:
+		params = &BulkCheckJobParams{}
+	case JobRevokeSource:
+		params = &RevokeSourceJobParams{}
+	default:
+		return nil, fmt.Errorf("%w %q", jobs.ErrUnknownKind, kind)
+	}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, params); err != nil {
+			return nil, fmt.Errorf("invalid %s params: %w", kind, err)
+		}
+	}
+	if err := params.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s params: %w", kind, err)
+	}
+	return params, nil
+}
+
+// isWriteJob reports whether a job changes the graph, so it can't be
+// submitted in read-only mode
+func isWriteJob(kind string, params interface{}) bool {
+	switch p := params.(type) {
+	case *BulkImportJobParams, *RevokeSourceJobParams:
+		return true
+	case *OrphanGCJobParams:
+		return p.Action == OrphanRepair || p.Action == OrphanDelete
+	}
+	return false
+}
+
+// SetJobs runs heavy operations on m instead of inline in HTTP handlers
+func (s *AuthzService) SetJobs(m *jobs.Manager) {
+	s.jobs = m
+	m.Register(JobAuditExport, s.runAuditExportJob)
+	m.Register(JobAccessReview, s.runAccessReviewJob)
+	m.Register(JobOrphanGC, s.runOrphanGCJob)
+	m.Register(JobBulkImport, s.runBulkImportJob)
+	m.Register(JobBulkCheck, s.runBulkCheckJob)
+	m.Register(JobRevokeSource, s.runRevokeSourceJob)
+}
+
+// newJobManager runs jobs on this replica's workers, identified by its
+// cluster ID when it joined the cluster
+func newJobManager(s *AuthzService, cfg *config.Config) *jobs.Manager {
+	worker := "standalone"
+	if s.cluster != nil {
+		worker = s.cluster.ID()
+	} else if hostname, err := os.Hostname(); err == nil {
+		worker = hostname
+	}
+	return jobs.New(jobs.NewPostgresStore(s.graph.Pool), worker, jobs.Options{
+		Workers:      cfg.Authz.Jobs.Workers,
+		PollInterval: cfg.Authz.Jobs.PollInterval.Std(),
+		Retention:    cfg.Authz.Jobs.Retention.Std(),
+	})
+}
+
+// addJobEndpoints serves job submission, status, results and
+// cancellation:
+//
+//	POST /api/jobs                  submit {"kind", "params"}
+//	GET  /api/jobs                  list, filtered by ?kind=, ?status=, ?limit=
+//	GET  /api/jobs/{id}             status and progress
+//	GET  /api/jobs/{id}/result      download what a succeeded job produced
+//	POST /api/jobs/{id}/cancel      cancel a queued or running job
+//	POST /api/jobs/bulk-check       submit a bulk_check job from a CSV upload
+func (s *AuthzService) addJobEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if s.jobs == nil {
+			jobsDisabled(w)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			s.listJobs(w, r)
+		case http.MethodPost:
+			s.submitJob(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/jobs/bulk-check", func(w http.ResponseWriter, r *http.Request) {
+		if s.jobs == nil {
+			jobsDisabled(w)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.submitBulkCheck(w, r)
+	})
+
+	mux.HandleFunc("/api/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		if s.jobs == nil {
+			jobsDisabled(w)
+			return
+		}
+		rawID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid job ID", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			job, err := s.jobs.Get(r.Context(), id)
+			if err != nil {
+				jobError(w, err)
+				return
+			}
+			jsonResponse(w, job, http.StatusOK)
+		case action == "result" && r.Method == http.MethodGet:
+			result, err := s.jobs.Result(r.Context(), id)
+			if err != nil {
+				jobError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", result.ContentType)
+			if result.Filename != "" {
+				w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, result.Filename))
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(result.Data)))
+			w.Write(result.Data)
+		case action == "cancel" && r.Method == http.MethodPost,
+			action == "" && r.Method == http.MethodDelete:
+			job, err := s.jobs.Cancel(r.Context(), id)
+			if err != nil {
+				jobError(w, err)
+				return
+			}
+			jsonResponse(w, job, http.StatusAccepted)
+		case action == "" || action == "result" || action == "cancel":
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (s *AuthzService) submitJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Kind == "" {
+		standardErrorResponse(w, "invalid_request", "Missing required fields", "kind is required", http.StatusBadRequest)
+		return
+	}
+	params, err := decodeJobParams(req.Kind, req.Params)
+	if err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid job", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if isWriteJob(req.Kind, params) {
+		if status := s.mode.get(); status.Mode != ModeNormal {
+			w.Header().Set("Retry-After", modeRetryAfter)
+			standardErrorResponse(w, "read_only", "The authorization service is read-only",
+				status.Reason, http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	s.startJob(w, r, req.Kind, params)
+}
+
+// startJob submits validated params and answers with the queued job
+func (s *AuthzService) startJob(w http.ResponseWriter, r *http.Request, kind string, params interface{}) {
+	job, err := s.jobs.Submit(r.Context(), kind, params)
+	if err != nil {
+		log.Printf("Error submitting %s job: %v", kind, err)
+		standardErrorResponse(w, "internal_error", "Failed to submit job", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/api/jobs/"+job.ID.String())
+	jsonResponse(w, job, http.StatusAccepted)
+}
+
+func (s *AuthzService) listJobs(w http.ResponseWriter, r *http.Request) {
+	filter := jobs.Filter{
+		Kind:   r.URL.Query().Get("kind"),
+		Status: r.URL.Query().Get("status"),
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxJobList {
+			standardErrorResponse(w, "invalid_request", "Invalid limit",
+				fmt.Sprintf("limit must be between 1 and %d", maxJobList), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	list, err := s.jobs.List(r.Context(), filter)
+	if err != nil {
+		standardErrorResponse(w, "internal_error", "Failed to list jobs", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"jobs": list}, http.StatusOK)
+}
+
+func jobsDisabled(w http.ResponseWriter) {
+	standardErrorResponse(w, "jobs_disabled", "Background jobs are unavailable",
+		"The service was started without a job manager", http.StatusNotFound)
+}
+
+// jobError reports a failed lookup or cancellation of a job
+func jobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		standardErrorResponse(w, "not_found", "Job not found", err.Error(), http.StatusNotFound)
+	case errors.Is(err, jobs.ErrNoResult):
+		standardErrorResponse(w, "no_result", "Job has no result",
+			"Only succeeded jobs have a result; check the job's status", http.StatusConflict)
+	case errors.Is(err, jobs.ErrFinished):
+		standardErrorResponse(w, "job_finished", "Job already finished", err.Error(), http.StatusConflict)
+	default:
+		standardErrorResponse(w, "internal_error", "Failed to load job", err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// jobRequest stands in for the HTTP request when a job writes, so its
+// audit entries name the job that made them
+func jobRequest(ctx context.Context, job *jobs.Job) *http.Request {
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/api/jobs/"+job.ID.String(), nil)
+	r.Header.Set("X-Request-ID", "job:"+job.ID.String())
+	r.Header.Set("User-Agent", "supra-job/"+job.Kind)
+	return r
+}
+
+// checkWritable fails write jobs that start while the service is read-only
+func (s *AuthzService) checkWritable() error {
+	if mode := s.mode.get().Mode; mode != ModeNormal {
+		return fmt.Errorf("the authorization service is in %s mode", mode)
+	}
+	return nil
+}
+
+func (s *AuthzService) runAuditExportJob(ctx context.Context, job *jobs.Job, report func(jobs.Progress)) (*jobs.Result, error) {
+	decoded, err := decodeJobParams(job.Kind, job.Params)
+	if err != nil {
+		return nil, err
+	}
+	params := decoded.(*AuditExportJobParams)
+	fromSeq, limit := params.From, params.Limit
+	if fromSeq == 0 {
+		fromSeq = 1
+	}
+	if limit == 0 {
+		limit = defaultAuditExport
+	}
+
+	prevHash, entries, err := s.loadAuditChain(ctx, fromSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	export, err := newAuditExport(fromSeq, prevHash, entries, s.auditSigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign audit export: %w", err)
+	}
+	report(jobs.Progress{Done: int64(len(entries)), Total: int64(len(entries))})
+	return jobs.JSONResult(fmt.Sprintf("authz-audit-%d-%d.json", export.Manifest.FromSeq, export.Manifest.ToSeq), export)
+}
+
+// accessReviewPage is how many object IDs an access review loads at once
+const accessReviewPage = 500
+
+func (s *AuthzService) runAccessReviewJob(ctx context.Context, job *jobs.Job, report func(jobs.Progress)) (*jobs.Result, error) {
+	decoded, err := decodeJobParams(job.Kind, job.Params)
+	if err != nil {
+		return nil, err
+	}
+	params := decoded.(*AccessReviewJobParams)
+
+	conditionExpr, err := s.permissionCondition(ctx, params.ObjectType, params.Permission)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if params.ObjectIDs != nil {
+		total = int64(len(params.ObjectIDs))
+	} else if err := s.graph.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM entities WHERE type = $1
+	`, params.ObjectType).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count objects: %w", err)
+	}
+
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	out.Write([]string{"object_type", "object_id", "permission", "subject_type", "subject_id", "grants"})
+
+	var done int64
+	review := func(objectID string) error {
+		cursor := ""
+		for {
+			result, err := s.graph.LookupSubjects(ctx, conditionExpr, params.ObjectType, objectID, params.SubjectType,
+				lookupContext(params.Context), graph.LookupPage{Cursor: cursor, Limit: graph.MaxLookupLimit})
+			if err != nil {
+				return fmt.Errorf("failed to look up subjects of %s:%s: %w", params.ObjectType, objectID, err)
+			}
+			for _, subject := range result.Subjects {
+				out.Write([]string{params.ObjectType, objectID, params.Permission,
+					subject.Type, subject.ID, strings.Join(subject.Grants, "; ")})
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			cursor = result.NextCursor
+		}
+		done++
+		report(jobs.Progress{Done: done, Total: total})
+		return nil
+	}
+
+	if params.ObjectIDs != nil {
+		for _, id := range params.ObjectIDs {
+			if err := review(id); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		after := ""
+		for {
+			ids, err := s.objectIDsAfter(ctx, params.ObjectType, after, accessReviewPage)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if err := review(id); err != nil {
+					return nil, err
+				}
+			}
+			if len(ids) < accessReviewPage {
+				break
+			}
+			after = ids[len(ids)-1]
+		}
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return nil, err
+	}
+	return &jobs.Result{
+		ContentType: "text/csv",
+		Filename:    fmt.Sprintf("access-review-%s-%s.csv", params.ObjectType, params.Permission),
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// objectIDsAfter pages through the IDs of the entities of a type
+func (s *AuthzService) objectIDsAfter(ctx context.Context, entityType, after string, limit int) ([]string, error) {
+	rows, err := s.graph.Pool.Query(ctx, `
+		SELECT external_id FROM entities
+		WHERE type = $1 AND external_id > $2
+		ORDER BY external_id
+		LIMIT $3
+	`, entityType, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// orphanGCBatch is how many orphaned relations are handled at once
+const orphanGCBatch = 1000
+
+// orphanedRelation is a relation with a missing subject or object entity
+type orphanedRelation struct {
+	id                     int64
+	subjectType, subjectID string
+	relation               string
+	objectType, objectID   string
+	subjectMissing         bool
+	objectMissing          bool
+}
+
+func (s *AuthzService) runOrphanGCJob(ctx context.Context, job *jobs.Job, report func(jobs.Progress)) (*jobs.Result, error) {
+	decoded, err := decodeJobParams(job.Kind, job.Params)
+	if err != nil {
+		return nil, err
+	}
+	params := decoded.(*OrphanGCJobParams)
+	result := OrphanGCResult{Action: params.Action}
+	if result.Action == "" {
+		result.Action = OrphanReport
+	}
+	if result.Action != OrphanReport {
+		if err := s.checkWritable(); err != nil {
+			return nil, err
+		}
+	}
+	r := jobRequest(ctx, job)
+
+	var afterID int64
+	for {
+		batch, err := s.orphanedRelationsAfter(ctx, afterID, orphanGCBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		afterID = batch[len(batch)-1].id
+		result.Found += int64(len(batch))
+
+		switch result.Action {
+		case OrphanRepair:
+			for _, rel := range batch {
+				if rel.subjectMissing && s.createStubEntity(ctx, rel.subjectType, graph.SubjectEntityID(rel.subjectID)) {
+					result.EntitiesCreated++
+				}
+				if rel.objectMissing && s.createStubEntity(ctx, rel.objectType, rel.objectID) {
+					result.EntitiesCreated++
+				}
+			}
+		case OrphanDelete:
+			ids := make([]int64, len(batch))
+			for i, rel := range batch {
+				ids[i] = rel.id
+			}
+			tag, err := s.graph.Pool.Exec(ctx, `DELETE FROM relations WHERE id = ANY($1)`, ids)
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete orphaned relations: %w", err)
+			}
+			result.Deleted += tag.RowsAffected()
+			for _, rel := range batch {
+				if err := s.auditLogger.LogRelationDelete(ctx,
+					model.Entity{Type: rel.objectType, ID: rel.objectID}, rel.relation,
+					model.Subject{Type: rel.subjectType, ID: rel.subjectID}, r); err != nil {
+					log.Printf("Failed to log relation deletion: %v", err)
+				}
+			}
+		}
+		report(jobs.Progress{Done: result.Found})
+	}
+
+	return jobs.JSONResult("orphan-gc.json", result)
+}
+
+// orphanedRelationsAfter pages through relations with a missing entity by ID
+func (s *AuthzService) orphanedRelationsAfter(ctx context.Context, afterID int64, limit int) ([]orphanedRelation, error) {
+	rows, err := s.graph.Pool.Query(ctx, `
+		SELECT r.id, r.subject_type, r.subject_id, r.relation, r.object_type, r.object_id,
+			NOT EXISTS (SELECT 1 FROM entities WHERE type = r.subject_type AND external_id = split_part(r.subject_id, '#', 1)),
+			NOT EXISTS (SELECT 1 FROM entities WHERE type = r.object_type AND external_id = r.object_id)
+		FROM relations r
+		WHERE r.id > $1 AND (
+			NOT EXISTS (SELECT 1 FROM entities WHERE type = r.subject_type AND external_id = split_part(r.subject_id, '#', 1))
+			OR NOT EXISTS (SELECT 1 FROM entities WHERE type = r.object_type AND external_id = r.object_id)
+		)
+		ORDER BY r.id
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orphaned relations: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []orphanedRelation
+	for rows.Next() {
+		var rel orphanedRelation
+		if err := rows.Scan(&rel.id, &rel.subjectType, &rel.subjectID, &rel.relation,
+			&rel.objectType, &rel.objectID, &rel.subjectMissing, &rel.objectMissing); err != nil {
+			return nil, err
+		}
+		batch = append(batch, rel)
+	}
+	return batch, rows.Err()
+}
+
+// createStubEntity creates a missing relation endpoint the way relation
+// writes do, reporting whether it was created
+func (s *AuthzService) createStubEntity(ctx context.Context, entityType, externalID string) bool {
+	if exists, _ := s.entityExists(ctx, entityType, externalID); exists {
+		return false
+	}
+	_, err := s.graph.CreateEntity(ctx, entityType, externalID, map[string]interface{}{
+		"name":         externalID,
+		"auto_created": true,
+	})
+	if err != nil {
+		log.Printf("Failed to auto-create entity %s:%s: %v", entityType, externalID, err)
+		return false
+	}
+	return true
+}
+
+func (s *AuthzService) runBulkImportJob(ctx context.Context, job *jobs.Job, report func(jobs.Progress)) (*jobs.Result, error) {
+	decoded, err := decodeJobParams(job.Kind, job.Params)
+	if err != nil {
+		return nil, err
+	}
+	params := decoded.(*BulkImportJobParams)
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
+	r := jobRequest(ctx, job)
+	source := params.Source
+	if source == "" {
+		source = "import:" + job.ID.String()
+	}
+
+	var result BulkImportResult
+	failed := func(format string, args ...interface{}) {
+		if len(result.Errors) < maxImportErrors {
+			result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+		}
+	}
+	total := int64(len(params.Entities) + len(params.Relations))
+	var done int64
+
+	for _, e := range params.Entities {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		_, err := s.createEntity(ctx, r, e)
+		switch {
+		case errors.Is(err, errEntityExists):
+			result.EntitiesSkipped++
+		case err != nil:
+			failed("entity %s:%s: %v", e.Type, e.ExternalID, err)
+		default:
+			result.EntitiesCreated++
+		}
+		done++
+		report(jobs.Progress{Done: done, Total: total})
+	}
+
+	for _, rel := range params.Relations {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if rel.Source == "" {
+			rel.Source = source
+		}
+		if _, err := s.createRelation(ctx, r, rel); err != nil {
+			failed("relation %s:%s %s %s:%s: %v", rel.SubjectType, rel.SubjectID, rel.Relation, rel.ObjectType, rel.ObjectID, err)
+		} else {
+			result.RelationsCreated++
+		}
+		done++
+		report(jobs.Progress{Done: done, Total: total})
+	}
+
+	return jobs.JSONResult("bulk-import.json", result)
+}
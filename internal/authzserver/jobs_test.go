@@ -0,0 +1,113 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJobParams(t *testing.T) {
+	tests := []struct {
+		kind   string
+		params string
+		err    string
+	}{
+		{JobAuditExport, ``, ""},
+		{JobAuditExport, `{"from":10,"limit":500}`, ""},
+		{JobAuditExport, `{"limit":1000000}`, "limit must be between"},
+		{JobAccessReview, `{"object_type":"document","permission":"view"}`, ""},
+		{JobAccessReview, `{"object_type":"document"}`, "object_type and permission are required"},
+		{JobOrphanGC, `null`, ""},
+		{JobOrphanGC, `{"action":"purge"}`, "action must be"},
+		{JobBulkImport, `{}`, "entities or relations are required"},
+		{JobBulkImport, `{"relations":[{"subject_type":"user","subject_id":"alice"}]}`, "relations[0]"},
+		{JobBulkImport, `{"entities":[{"type":"user","external_id":"alice"}]}`, ""},
+		{JobBulkCheck, `{}`, "checks are required"},
+		{JobBulkCheck, `{"checks":[{"subject_type":"user","subject_id":"alice","permission":"view"}]}`, "checks[0]"},
+		{JobBulkCheck, `{"checks":[{"subject_type":"user","subject_id":"alice","permission":"view","object_type":"document","object_id":"plan"}]}`, ""},
+		{JobBulkImport, `{"source":"bad source","entities":[{"type":"user","external_id":"alice"}]}`, "invalid relation source"},
+		{JobRevokeSource, `{}`, "invalid relation source"},
+		{JobRevokeSource, `{"source":"import:batch-42"}`, ""},
+		{"reindex", `{}`, "unknown job kind"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind+" "+tt.params, func(t *testing.T) {
+			_, err := decodeJobParams(tt.kind, []byte(tt.params))
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestJobEndpoints(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addJobEndpoints(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "jobs are unavailable without a manager")
+
+	// No workers are started, so nothing touches the store
+	s.SetJobs(jobs.New(nil, "test", jobs.Options{}))
+	assert.ElementsMatch(t, []string{JobAuditExport, JobAccessReview, JobOrphanGC, JobBulkImport, JobBulkCheck, JobRevokeSource}, s.jobs.Kinds())
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"missing kind", http.MethodPost, "/api/jobs", `{}`, http.StatusBadRequest},
+		{"unknown kind", http.MethodPost, "/api/jobs", `{"kind":"reindex"}`, http.StatusBadRequest},
+		{"invalid params", http.MethodPost, "/api/jobs", `{"kind":"orphan_gc","params":{"action":"purge"}}`, http.StatusBadRequest},
+		{"invalid list limit", http.MethodGet, "/api/jobs?limit=0", "", http.StatusBadRequest},
+		{"invalid ID", http.MethodGet, "/api/jobs/not-a-uuid", "", http.StatusBadRequest},
+		{"unknown action", http.MethodGet, "/api/jobs/6f1c2f8e-7d1a-4a57-9a43-5bb7d1f0b7a1/logs", "", http.StatusNotFound},
+		{"wrong method", http.MethodPut, "/api/jobs/6f1c2f8e-7d1a-4a57-9a43-5bb7d1f0b7a1", "", http.StatusMethodNotAllowed},
+		{"empty bulk check", http.MethodPost, "/api/jobs/bulk-check", "", http.StatusBadRequest},
+		{"bulk check without permission column", http.MethodPost, "/api/jobs/bulk-check", "subject,object\nuser:alice,document:plan\n", http.StatusBadRequest},
+		{"bulk check listed", http.MethodGet, "/api/jobs/bulk-check", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+
+	assert.True(t, isAdminRoute("/api/jobs"))
+	assert.True(t, isAdminRoute("/api/jobs/6f1c2f8e-7d1a-4a57-9a43-5bb7d1f0b7a1/result"))
+}
+
+func TestWriteJobsRefusedWhenReadOnly(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addJobEndpoints(mux)
+	s.SetJobs(jobs.New(nil, "test", jobs.Options{}))
+	require.NoError(t, s.SetMode(ModeReadOnly, "database failover"))
+
+	for _, body := range []string{
+		`{"kind":"bulk_import","params":{"entities":[{"type":"user","external_id":"alice"}]}}`,
+		`{"kind":"orphan_gc","params":{"action":"delete"}}`,
+		`{"kind":"revoke_source","params":{"source":"scim"}}`,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(body)))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), "database failover")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/jobs", nil)
+	assert.False(t, isWrite(req), "read jobs such as exports stay open in read-only mode")
+}
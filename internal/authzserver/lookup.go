@@ -0,0 +1,175 @@
+package authzserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// LookupObjectsRequest asks which objects of a type a subject has a
+// permission on. Results come in pages of Limit IDs; pass the previous
+// response's NextCursor as Cursor for the next one.
+type LookupObjectsRequest struct {
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Permission  string                 `json:"permission"`
+	ObjectType  string                 `json:"object_type"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	Limit       int                    `json:"limit,omitempty"`
+	Cursor      string                 `json:"cursor,omitempty"`
+}
+
+// LookupObjectsResponse is a page of object IDs, in ascending order
+type LookupObjectsResponse = graph.LookupResult
+
+// LookupSubjectsRequest asks who has a permission on an object, optionally
+// only subjects of SubjectType. Paging works as for LookupObjectsRequest.
+type LookupSubjectsRequest struct {
+	Permission  string                 `json:"permission"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	SubjectType string                 `json:"subject_type,omitempty"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	Limit       int                    `json:"limit,omitempty"`
+	Cursor      string                 `json:"cursor,omitempty"`
+}
+
+// LookupSubjectsResponse is a page of subjects, each with the relation
+// paths that grant it the permission
+type LookupSubjectsResponse = graph.LookupSubjectsResult
+
+// addLookupEndpoints serves the reverse of /check: the objects a subject
+// can access, for filtered list views, and who can access an object, for
+// access reviews
+func (s *AuthzService) addLookupEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/lookup-objects", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req LookupObjectsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.SubjectType == "" || req.SubjectID == "" || req.Permission == "" || req.ObjectType == "" {
+			standardErrorResponse(w, "invalid_request", "Missing required fields",
+				"subject_type, subject_id, permission and object_type are required", http.StatusBadRequest)
+			return
+		}
+		if req.Limit < 0 || req.Limit > graph.MaxLookupLimit {
+			standardErrorResponse(w, "invalid_request", "Invalid limit",
+				"limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Long)
+		defer cancel()
+
+		result, err := s.lookupObjects(ctx, req)
+		if errors.Is(err, errPermissionNotDefined) {
+			standardErrorResponse(w, graph.ReasonUnknownPermission, "Permission definition not found",
+				err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up objects: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to look up objects", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, result, http.StatusOK)
+	})
+
+	mux.HandleFunc("/lookup-subjects", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req LookupSubjectsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Permission == "" || req.ObjectType == "" || req.ObjectID == "" {
+			standardErrorResponse(w, "invalid_request", "Missing required fields",
+				"permission, object_type and object_id are required", http.StatusBadRequest)
+			return
+		}
+		if req.Limit < 0 || req.Limit > graph.MaxLookupLimit {
+			standardErrorResponse(w, "invalid_request", "Invalid limit",
+				"limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Long)
+		defer cancel()
+
+		result, err := s.lookupSubjects(ctx, req)
+		if errors.Is(err, errPermissionNotDefined) {
+			standardErrorResponse(w, graph.ReasonUnknownPermission, "Permission definition not found",
+				err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up subjects: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to look up subjects", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, result, http.StatusOK)
+	})
+}
+
+func (s *AuthzService) lookupObjects(ctx context.Context, req LookupObjectsRequest) (LookupObjectsResponse, error) {
+	conditionExpr, err := s.permissionCondition(ctx, req.ObjectType, req.Permission)
+	if err != nil {
+		return LookupObjectsResponse{}, err
+	}
+
+	contextData := lookupContext(req.Context)
+	result, err := s.graph.LookupObjects(ctx, conditionExpr, req.SubjectType, req.SubjectID, req.ObjectType,
+		contextData, graph.LookupPage{Cursor: req.Cursor, Limit: req.Limit})
+	if err != nil {
+		return LookupObjectsResponse{}, err
+	}
+	if result.ObjectIDs == nil {
+		result.ObjectIDs = []string{}
+	}
+	return result, nil
+}
+
+func (s *AuthzService) lookupSubjects(ctx context.Context, req LookupSubjectsRequest) (LookupSubjectsResponse, error) {
+	conditionExpr, err := s.permissionCondition(ctx, req.ObjectType, req.Permission)
+	if err != nil {
+		return LookupSubjectsResponse{}, err
+	}
+
+	contextData := lookupContext(req.Context)
+	result, err := s.graph.LookupSubjects(ctx, conditionExpr, req.ObjectType, req.ObjectID, req.SubjectType,
+		contextData, graph.LookupPage{Cursor: req.Cursor, Limit: req.Limit})
+	if err != nil {
+		return LookupSubjectsResponse{}, err
+	}
+	if result.Subjects == nil {
+		result.Subjects = []graph.LookupSubject{}
+	}
+	return result, nil
+}
+
+// lookupContext applies the context defaults /check uses, so lookups agree
+// with checks
+func lookupContext(contextData map[string]interface{}) map[string]interface{} {
+	if contextData == nil {
+		contextData = make(map[string]interface{})
+	}
+	if _, ok := contextData["request"]; !ok {
+		contextData["request"] = make(map[string]interface{})
+	}
+	return contextData
+}
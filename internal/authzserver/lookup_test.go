@@ -0,0 +1,76 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupObjectsValidation(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addLookupEndpoints(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid JSON", http.MethodPost, "{", http.StatusBadRequest},
+		{"missing object type", http.MethodPost,
+			`{"subject_type":"user","subject_id":"alice","permission":"view"}`, http.StatusBadRequest},
+		{"limit too large", http.MethodPost,
+			`{"subject_type":"user","subject_id":"alice","permission":"view","object_type":"document","limit":1001}`,
+			http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, "/lookup-objects", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+
+	assert.False(t, isAdminRoute("/lookup-objects"))
+	assert.True(t, matchesRoute("/lookup-objects", readOnlyRoutes))
+}
+
+func TestLookupSubjectsValidation(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addLookupEndpoints(mux)
+
+	for _, body := range []string{
+		"{",
+		`{"permission":"view","object_type":"document"}`,
+		`{"permission":"view","object_type":"document","object_id":"d1","limit":-1}`,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/lookup-subjects", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	assert.True(t, matchesRoute("/lookup-subjects", readOnlyRoutes))
+}
+
+func TestExpandValidation(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addExpandEndpoints(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/expand", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/expand",
+		strings.NewReader(`{"object_type":"document","permission":"view"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.True(t, matchesRoute("/expand", readOnlyRoutes))
+}
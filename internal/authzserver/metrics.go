@@ -0,0 +1,238 @@
+package authzserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency
+// histograms, from a cached check to a request that hit its budget
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// latencyHistogram counts durations into latencyBuckets by a set of label
+// values. The zero value is ready.
+type latencyHistogram struct {
+	mu     sync.Mutex
+	series map[string]*latencySeries
+}
+
+// latencySeries is one set of label values' observations; counts are per
+// bucket rather than cumulative, with the last for those over every bound
+type latencySeries struct {
+	counts []int64
+	sum    float64
+}
+
+// observe counts d under labels, which are already formatted as in
+// route="GET /check",code="2xx"
+func (h *latencyHistogram) observe(labels string, d time.Duration) {
+	seconds := d.Seconds()
+	bucket := sort.SearchFloat64s(latencyBuckets, seconds)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.series == nil {
+		h.series = make(map[string]*latencySeries)
+	}
+	s, ok := h.series[labels]
+	if !ok {
+		s = &latencySeries{counts: make([]int64, len(latencyBuckets)+1)}
+		h.series[labels] = s
+	}
+	s.counts[bucket]++
+	s.sum += seconds
+}
+
+// write writes the histogram in the Prometheus text exposition format
+func (h *latencyHistogram) write(b *strings.Builder, name, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	labels := make([]string, 0, len(h.series))
+	for l := range h.series {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+
+	for _, l := range labels {
+		s := h.series[l]
+		var total int64
+		for i, bound := range latencyBuckets {
+			total += s.counts[i]
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%g\"} %d\n", name, l, bound, total)
+		}
+		total += s.counts[len(latencyBuckets)]
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, total)
+		fmt.Fprintf(b, "%s_sum{%s} %g\n", name, l, s.sum)
+		fmt.Fprintf(b, "%s_count{%s} %d\n", name, l, total)
+	}
+}
+
+// serviceMetrics times the service's requests, calls and checks
+type serviceMetrics struct {
+	// requests are HTTP requests by route and status class
+	requests latencyHistogram
+	// calls are gRPC calls by method and status code
+	calls latencyHistogram
+	// checks are permission checks by result
+	checks latencyHistogram
+}
+
+// statusClass groups status codes as 2xx, 4xx and so on
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// requestMetrics times each request under the route queryLabels found
+// for it, so runs inside it
+func (s *AuthzService) requestMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapper := &responseWriterWrapper{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(wrapper, r)
+		s.metrics.requests.observe(fmt.Sprintf(`route="%s",code="%s"`,
+			escapeLabel(dbtrace.Label(r.Context())), statusClass(wrapper.Status)), time.Since(start))
+	})
+}
+
+// grpcMetricsInterceptor times each call like requestMetrics times requests
+func (s *AuthzService) grpcMetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.metrics.calls.observe(fmt.Sprintf(`method="%s",code="%s"`,
+		escapeLabel(info.FullMethod), status.Code(err)), time.Since(start))
+	return resp, err
+}
+
+// observeCheck times a check under its result: allowed, denied or error
+func (s *AuthzService) observeCheck(d time.Duration, allowed bool, err error) {
+	result := "denied"
+	switch {
+	case err != nil:
+		result = "error"
+	case allowed:
+		result = "allowed"
+	}
+	s.metrics.checks.observe(`result="`+result+`"`, d)
+}
+
+// writeLatencyMetrics writes the request, call and check histograms
+func writeLatencyMetrics(w http.ResponseWriter, m *serviceMetrics) {
+	var b strings.Builder
+	m.checks.write(&b, "supra_authz_check_duration_seconds", "Time to decide permission checks by result.")
+	m.requests.write(&b, "supra_authz_http_request_duration_seconds", "HTTP request latency by route and status class.")
+	m.calls.write(&b, "supra_authz_grpc_call_duration_seconds", "gRPC call latency by method and status code.")
+	w.Write([]byte(b.String()))
+}
+
+// writeGraphMetrics writes the graph's cache lookups, along with the
+// service's own, and how deep checks recursed
+func writeGraphMetrics(w http.ResponseWriter, stats graph.Stats, caches ...graph.CacheStats) {
+	var b strings.Builder
+	caches = append(stats.Caches, caches...)
+
+	b.WriteString("# HELP supra_authz_cache_requests_total Cache lookups by cache and whether they hit.\n")
+	b.WriteString("# TYPE supra_authz_cache_requests_total counter\n")
+	for _, c := range caches {
+		fmt.Fprintf(&b, "supra_authz_cache_requests_total{cache=\"%s\",result=\"hit\"} %d\n", escapeLabel(c.Cache), c.Hits)
+		fmt.Fprintf(&b, "supra_authz_cache_requests_total{cache=\"%s\",result=\"miss\"} %d\n", escapeLabel(c.Cache), c.Misses)
+	}
+
+	b.WriteString("# HELP supra_authz_check_depth Deepest level of subject sets or inherited permissions checks reached.\n")
+	b.WriteString("# TYPE supra_authz_check_depth histogram\n")
+	var total, sum int64
+	for depth, n := range stats.Depths {
+		total += n
+		sum += int64(depth) * n
+		fmt.Fprintf(&b, "supra_authz_check_depth_bucket{le=\"%d\"} %d\n", depth, total)
+	}
+	fmt.Fprintf(&b, "supra_authz_check_depth_bucket{le=\"+Inf\"} %d\n", total)
+	fmt.Fprintf(&b, "supra_authz_check_depth_sum %d\n", sum)
+	fmt.Fprintf(&b, "supra_authz_check_depth_count %d\n", total)
+
+	w.Write([]byte(b.String()))
+}
+
+// poolStats is a snapshot of the connection pool's counters
+type poolStats struct {
+	Acquired, Idle, Constructing, Max int32
+	Acquires, EmptyAcquires           int64
+	CanceledAcquires                  int64
+	AcquireWait                       time.Duration
+}
+
+func poolStatsOf(stat *pgxpool.Stat) poolStats {
+	return poolStats{
+		Acquired:         stat.AcquiredConns(),
+		Idle:             stat.IdleConns(),
+		Constructing:     stat.ConstructingConns(),
+		Max:              stat.MaxConns(),
+		Acquires:         stat.AcquireCount(),
+		EmptyAcquires:    stat.EmptyAcquireCount(),
+		CanceledAcquires: stat.CanceledAcquireCount(),
+		AcquireWait:      stat.AcquireDuration(),
+	}
+}
+
+// writePoolMetrics writes the database connection pool's state. Acquires
+// that found the pool empty waited for a connection, so a rising count
+// means the pool is too small for the load.
+func writePoolMetrics(w http.ResponseWriter, stats poolStats) {
+	var b strings.Builder
+
+	b.WriteString("# HELP supra_db_pool_connections Database connections by state.\n")
+	b.WriteString("# TYPE supra_db_pool_connections gauge\n")
+	fmt.Fprintf(&b, "supra_db_pool_connections{state=\"acquired\"} %d\n", stats.Acquired)
+	fmt.Fprintf(&b, "supra_db_pool_connections{state=\"idle\"} %d\n", stats.Idle)
+	fmt.Fprintf(&b, "supra_db_pool_connections{state=\"constructing\"} %d\n", stats.Constructing)
+
+	b.WriteString("# HELP supra_db_pool_max_connections Most connections the pool opens.\n")
+	b.WriteString("# TYPE supra_db_pool_max_connections gauge\n")
+	fmt.Fprintf(&b, "supra_db_pool_max_connections %d\n", stats.Max)
+
+	b.WriteString("# HELP supra_db_pool_acquires_total Connections taken from the pool.\n")
+	b.WriteString("# TYPE supra_db_pool_acquires_total counter\n")
+	fmt.Fprintf(&b, "supra_db_pool_acquires_total %d\n", stats.Acquires)
+
+	b.WriteString("# HELP supra_db_pool_empty_acquires_total Acquires that waited because every connection was in use.\n")
+	b.WriteString("# TYPE supra_db_pool_empty_acquires_total counter\n")
+	fmt.Fprintf(&b, "supra_db_pool_empty_acquires_total %d\n", stats.EmptyAcquires)
+
+	b.WriteString("# HELP supra_db_pool_canceled_acquires_total Acquires given up on before a connection was free.\n")
+	b.WriteString("# TYPE supra_db_pool_canceled_acquires_total counter\n")
+	fmt.Fprintf(&b, "supra_db_pool_canceled_acquires_total %d\n", stats.CanceledAcquires)
+
+	b.WriteString("# HELP supra_db_pool_acquire_seconds_total Time spent acquiring connections.\n")
+	b.WriteString("# TYPE supra_db_pool_acquire_seconds_total counter\n")
+	fmt.Fprintf(&b, "supra_db_pool_acquire_seconds_total %g\n", stats.AcquireWait.Seconds())
+
+	w.Write([]byte(b.String()))
+}
+
+// writeAuditFailureMetrics writes the audit log's failed writes: attempts
+// that will be retried, entries the database rejected and entries lost
+func writeAuditFailureMetrics(w http.ResponseWriter, failures auditFailureStats) {
+	var b strings.Builder
+	b.WriteString("# HELP supra_authz_audit_failures_total Audit log write failures by kind.\n")
+	b.WriteString("# TYPE supra_authz_audit_failures_total counter\n")
+	fmt.Fprintf(&b, "supra_authz_audit_failures_total{kind=\"write_error\"} %d\n", failures.WriteErrors)
+	fmt.Fprintf(&b, "supra_authz_audit_failures_total{kind=\"dead_lettered\"} %d\n", failures.DeadLettered)
+	fmt.Fprintf(&b, "supra_authz_audit_failures_total{kind=\"dropped\"} %d\n", failures.Dropped)
+	w.Write([]byte(b.String()))
+}
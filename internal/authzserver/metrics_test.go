@@ -0,0 +1,126 @@
+package authzserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var m serviceMetrics
+	m.checks.observe(`result="allowed"`, 3*time.Millisecond)
+	m.checks.observe(`result="allowed"`, 30*time.Second)
+	m.checks.observe(`result="denied"`, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	writeLatencyMetrics(rec, &m)
+	body := rec.Body.String()
+
+	assert.Contains(t, body, "# TYPE supra_authz_check_duration_seconds histogram\n")
+	assert.Contains(t, body, `supra_authz_check_duration_seconds_bucket{result="allowed",le="0.0025"} 0`)
+	assert.Contains(t, body, `supra_authz_check_duration_seconds_bucket{result="allowed",le="0.005"} 1`)
+	assert.Contains(t, body, `supra_authz_check_duration_seconds_bucket{result="allowed",le="10"} 1`)
+	assert.Contains(t, body, `supra_authz_check_duration_seconds_bucket{result="allowed",le="+Inf"} 2`)
+	assert.Contains(t, body, `supra_authz_check_duration_seconds_count{result="allowed"} 2`)
+	assert.Contains(t, body, `supra_authz_check_duration_seconds_bucket{result="denied",le="0.001"} 1`,
+		"bounds are inclusive")
+	assert.Contains(t, body, "# TYPE supra_authz_http_request_duration_seconds histogram\n")
+}
+
+func TestRequestMetrics(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/entity", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad entity", http.StatusBadRequest)
+	})
+	handler := queryLabels(mux, s.requestMetrics(mux))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/check", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/check", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/entity", nil))
+
+	rec := httptest.NewRecorder()
+	writeLatencyMetrics(rec, &s.metrics)
+	body := rec.Body.String()
+	assert.Contains(t, body, `supra_authz_http_request_duration_seconds_count{route="POST /check",code="2xx"} 2`)
+	assert.Contains(t, body, `supra_authz_http_request_duration_seconds_count{route="POST /entity",code="4xx"} 1`)
+}
+
+func TestGRPCMetrics(t *testing.T) {
+	s := &AuthzService{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/supra.authz.v1.AuthzService/Check"}
+	_, err := s.grpcMetricsInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.InvalidArgument, "missing subject")
+	})
+	require.Error(t, err)
+
+	rec := httptest.NewRecorder()
+	writeLatencyMetrics(rec, &s.metrics)
+	assert.Contains(t, rec.Body.String(),
+		`supra_authz_grpc_call_duration_seconds_count{method="/supra.authz.v1.AuthzService/Check",code="InvalidArgument"} 1`)
+}
+
+func TestObserveCheck(t *testing.T) {
+	s := &AuthzService{}
+	s.observeCheck(time.Millisecond, true, nil)
+	s.observeCheck(time.Millisecond, false, nil)
+	s.observeCheck(time.Millisecond, true, errors.New("budget exceeded"))
+
+	rec := httptest.NewRecorder()
+	writeLatencyMetrics(rec, &s.metrics)
+	body := rec.Body.String()
+	for _, result := range []string{"allowed", "denied", "error"} {
+		assert.Contains(t, body, `supra_authz_check_duration_seconds_count{result="`+result+`"} 1`)
+	}
+}
+
+func TestWriteGraphMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeGraphMetrics(rec, graph.Stats{
+		Caches: []graph.CacheStats{{Cache: graph.CacheRules, Hits: 9, Misses: 1}},
+		Depths: []int64{5, 0, 2},
+	}, graph.CacheStats{Cache: cacheAPIKeys, Hits: 4})
+	body := rec.Body.String()
+
+	assert.Contains(t, body, `supra_authz_cache_requests_total{cache="rules",result="hit"} 9`)
+	assert.Contains(t, body, `supra_authz_cache_requests_total{cache="rules",result="miss"} 1`)
+	assert.Contains(t, body, `supra_authz_cache_requests_total{cache="api_keys",result="hit"} 4`)
+	assert.Contains(t, body, `supra_authz_check_depth_bucket{le="0"} 5`)
+	assert.Contains(t, body, `supra_authz_check_depth_bucket{le="1"} 5`)
+	assert.Contains(t, body, `supra_authz_check_depth_bucket{le="2"} 7`)
+	assert.Contains(t, body, "supra_authz_check_depth_sum 4\n")
+	assert.Contains(t, body, "supra_authz_check_depth_count 7\n")
+}
+
+func TestWritePoolMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writePoolMetrics(rec, poolStats{Acquired: 3, Idle: 1, Max: 4, Acquires: 120, EmptyAcquires: 7, AcquireWait: 1500 * time.Millisecond})
+	body := rec.Body.String()
+
+	assert.Contains(t, body, `supra_db_pool_connections{state="acquired"} 3`)
+	assert.Contains(t, body, `supra_db_pool_connections{state="idle"} 1`)
+	assert.Contains(t, body, "supra_db_pool_max_connections 4\n")
+	assert.Contains(t, body, "supra_db_pool_empty_acquires_total 7\n")
+	assert.Contains(t, body, "supra_db_pool_acquire_seconds_total 1.5\n")
+}
+
+func TestWriteAuditFailureMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeAuditFailureMetrics(rec, auditFailureStats{WriteErrors: 2, Dropped: 1})
+	body := rec.Body.String()
+
+	assert.Contains(t, body, `supra_authz_audit_failures_total{kind="write_error"} 2`)
+	assert.Contains(t, body, `supra_authz_audit_failures_total{kind="dead_lettered"} 0`)
+	assert.Contains(t, body, `supra_authz_audit_failures_total{kind="dropped"} 1`)
+}
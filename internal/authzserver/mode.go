@@ -0,0 +1,232 @@
+package authzserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/cluster"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/lifecycle"
+)
+
+// Service modes. Read-only keeps checks working while the database can't
+// take writes, e.g. during a failover; maintenance turns away everything but
+// the mode controls, for migration windows.
+const (
+	ModeNormal      = "normal"
+	ModeReadOnly    = "read_only"
+	ModeMaintenance = "maintenance"
+)
+
+// Modes lists every mode
+var Modes = []string{ModeNormal, ModeReadOnly, ModeMaintenance}
+
+// modeRetryAfter is the Retry-After, in seconds, sent with rejected requests
+const modeRetryAfter = "60"
+
+// readOnlyRoutes are the POST endpoints that only read, so they stay open in
+// read-only mode. Every other POST, PUT, PATCH and DELETE is a write.
+var readOnlyRoutes = []string{
+	"/check",
+	"/check/warm",
+	"/check/batch",
+	"/lookup-objects",
+	"/lookup-subjects",
+	"/expand",
+	"/visualize-condition",
+	"/test-relation",
+	"/api/test-rule",
+	"/api/permission-path",
+	// Jobs that write are refused by the handler instead
+	"/api/jobs",
+	"/api/jobs/bulk-check",
+	"/v1/check",
+}
+
+// controlRoutes change this replica's state rather than the graph, so no
+// method on them is a write
+var controlRoutes = []string{"/api/mode", "/api/chaos", "/api/flags", "/api/cluster/invalidate"}
+
+// maintenanceRoutes stay open in maintenance mode, so it can be turned off
+var maintenanceRoutes = []string{"/api/mode", "/health"}
+
+// ModeRequest switches the service's mode. Reason is shown to rejected
+// clients, e.g. "database failover in progress".
+type ModeRequest struct {
+	Mode   string `json:"mode"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ModeStatus is the mode in effect and when it was set
+type ModeStatus struct {
+	Mode   string    `json:"mode"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// serviceMode holds the mode in effect. The zero value is normal.
+type serviceMode struct {
+	mu     sync.RWMutex
+	status ModeStatus
+}
+
+func (m *serviceMode) get() ModeStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := m.status
+	if status.Mode == "" {
+		status.Mode = ModeNormal
+	}
+	return status
+}
+
+func (m *serviceMode) set(mode, reason string) (ModeStatus, error) {
+	if !validMode(mode) {
+		return ModeStatus{}, fmt.Errorf("mode must be one of %s, got %q", strings.Join(Modes, ", "), mode)
+	}
+	if mode == ModeNormal {
+		reason = ""
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = ModeStatus{Mode: mode, Reason: reason, Since: time.Now().UTC()}
+	return m.status, nil
+}
+
+func validMode(mode string) bool {
+	for _, m := range Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMode switches this replica's mode, logging the change
+func (s *AuthzService) SetMode(mode, reason string) error {
+	previous := s.mode.get()
+	status, err := s.mode.set(mode, reason)
+	if err != nil {
+		return err
+	}
+	if status.Mode != previous.Mode {
+		if status.Reason != "" {
+			log.Printf("Authorization service mode changed from %s to %s: %s", previous.Mode, status.Mode, status.Reason)
+		} else {
+			log.Printf("Authorization service mode changed from %s to %s", previous.Mode, status.Mode)
+		}
+	}
+	return nil
+}
+
+// subscribeModeChanges follows mode switches made on other replicas
+func (s *AuthzService) subscribeModeChanges(c *cluster.Cluster) {
+	c.Subscribe(cluster.EventModeChanged, func(e cluster.Event) {
+		var req ModeRequest
+		if err := json.Unmarshal(e.Data, &req); err != nil {
+			log.Printf("Ignoring mode change from %s: %v", e.Origin, err)
+			return
+		}
+		if err := s.SetMode(req.Mode, req.Reason); err != nil {
+			log.Printf("Ignoring mode change from %s: %v", e.Origin, err)
+		}
+	})
+}
+
+// reloadOnHangup applies the mode, evaluator flags and rate limit from a
+// reloaded configuration each time the process gets SIGHUP, until ctx ends.
+// The change stays on this replica; each one is expected to be signalled
+// with its own configuration.
+func (s *AuthzService) reloadOnHangup(ctx context.Context, reload func() (*config.Config, error)) {
+	lifecycle.OnHangup(ctx, func() {
+		cfg, err := reload()
+		if err != nil {
+			log.Printf("Keeping the current mode, failed to reload configuration: %v", err)
+			return
+		}
+		if err := s.SetMode(cfg.Authz.Mode, cfg.Authz.ModeReason); err != nil {
+			log.Printf("Keeping the current mode: %v", err)
+		}
+		if err := s.SetFlags(cfg.Authz.Flags); err != nil {
+			log.Printf("Keeping the current evaluator flags: %v", err)
+		}
+		s.SetRateLimit(cfg.Authz.RateLimit)
+	})
+}
+
+// modeGuard rejects the requests the current mode doesn't serve with a 503
+// carrying the reason the mode was set
+func (s *AuthzService) modeGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := s.mode.get()
+		switch {
+		case status.Mode == ModeMaintenance && !matchesRoute(r.URL.Path, maintenanceRoutes):
+			w.Header().Set("Retry-After", modeRetryAfter)
+			standardErrorResponse(w, "maintenance", "The authorization service is down for maintenance",
+				status.Reason, http.StatusServiceUnavailable)
+		case status.Mode == ModeReadOnly && isWrite(r):
+			w.Header().Set("Retry-After", modeRetryAfter)
+			standardErrorResponse(w, "read_only", "The authorization service is read-only",
+				status.Reason, http.StatusServiceUnavailable)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// isWrite reports whether r could change the graph, schema or rules
+func isWrite(r *http.Request) bool {
+	if matchesRoute(r.URL.Path, controlRoutes) {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	case http.MethodPost:
+		return !matchesRoute(r.URL.Path, readOnlyRoutes)
+	default:
+		return true
+	}
+}
+
+func matchesRoute(p string, routes []string) bool {
+	for _, route := range routes {
+		if p == route {
+			return true
+		}
+	}
+	return false
+}
+
+// addModeEndpoints serves the mode switch. A change is sent to the other
+// replicas, so the whole cluster goes read-only together.
+func (s *AuthzService) addModeEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/mode", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			var req ModeRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := s.SetMode(req.Mode, req.Reason); err != nil {
+				standardErrorResponse(w, "invalid_mode", "Invalid mode", err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.broadcast(r.Context(), cluster.EventModeChanged, req)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		jsonResponse(w, s.mode.get(), http.StatusOK)
+	})
+}
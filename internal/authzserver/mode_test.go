@@ -0,0 +1,71 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModeGuard(t *testing.T) {
+	s := &AuthzService{}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := s.modeGuard(ok)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/relation").Code, "normal mode serves writes")
+
+	require.NoError(t, s.SetMode(ModeReadOnly, "database failover"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/check").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/entity").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/api/mode").Code)
+	rec := serve(http.MethodDelete, "/entity")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, modeRetryAfter, rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), `"code":"read_only"`)
+	assert.Contains(t, rec.Body.String(), "database failover")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodPost, "/relation").Code)
+
+	require.NoError(t, s.SetMode(ModeMaintenance, ""))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodPost, "/check").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/mode").Code)
+
+	require.NoError(t, s.SetMode(ModeNormal, "ignored"))
+	assert.Empty(t, s.mode.get().Reason)
+	assert.Error(t, s.SetMode("readonly", ""))
+}
+
+func TestModeEndpoint(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addModeEndpoints(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/mode", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"mode":"normal"`)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/mode",
+		strings.NewReader(`{"mode":"read_only","reason":"migrating"}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"mode":"read_only","reason":"migrating"`)
+	assert.Equal(t, ModeReadOnly, s.mode.get().Mode)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/mode", strings.NewReader(`{"mode":"off"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ModeReadOnly, s.mode.get().Mode)
+
+	assert.True(t, isAdminRoute("/api/mode"))
+}
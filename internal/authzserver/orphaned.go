@@ -1,12 +1,14 @@
-package main
+package authzserver
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
 )
 
 // OrphanedRelationship represents a relationship with a missing entity
@@ -30,7 +32,7 @@ func (s *AuthzService) addHealthCheckEndpoints(mux *http.ServeMux) {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Long)
 		defer cancel()
 
 		// Query for relationships with missing entities
@@ -54,7 +56,7 @@ func (s *AuthzService) addHealthCheckEndpoints(mux *http.ServeMux) {
             LEFT JOIN LATERAL (
                 SELECT EXISTS (
                     SELECT 1 FROM entities 
-                    WHERE type = r.subject_type AND external_id = r.subject_id
+                    WHERE type = r.subject_type AND external_id = split_part(r.subject_id, '#', 1)
                 ) AS exists
             ) sub_exists ON true
             LEFT JOIN LATERAL (
@@ -109,7 +111,7 @@ func (s *AuthzService) addHealthCheckEndpoints(mux *http.ServeMux) {
             LEFT JOIN LATERAL (
                 SELECT EXISTS (
                     SELECT 1 FROM entities 
-                    WHERE type = r.subject_type AND external_id = r.subject_id
+                    WHERE type = r.subject_type AND external_id = split_part(r.subject_id, '#', 1)
                 ) AS exists
             ) sub_exists ON true
             LEFT JOIN LATERAL (
@@ -168,7 +170,7 @@ func (s *AuthzService) addHealthCheckEndpoints(mux *http.ServeMux) {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
 		defer cancel()
 
 		// Get the relationship details
@@ -190,6 +192,8 @@ func (s *AuthzService) addHealthCheckEndpoints(mux *http.ServeMux) {
 			http.Error(w, "Failed to retrieve relationship", http.StatusInternalServerError)
 			return
 		}
+		// A subject set's entity is the one that has to exist
+		rel.SubjectID = graph.SubjectEntityID(rel.SubjectID)
 
 		// Check which entities are missing
 		var subjectExists, objectExists bool
@@ -1,13 +1,13 @@
-package main
+package authzserver
 
 import (
 	"context"
 	"encoding/json"
 	"net/http"
-	"time"
 
-	"github.com/dangerclosesec/supra/internal/auth/graph"
+	"github.com/dangerclosesec/supra/internal/budget"
 	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/pkg/graph"
 )
 
 // Permission Path Visualization API
@@ -52,7 +52,7 @@ func (s *AuthzService) addPermissionPathEndpoint(mux *http.ServeMux) {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
 		defer cancel()
 
 		// Check if permission exists and get the expression
@@ -99,7 +99,7 @@ func (s *AuthzService) addPermissionPathEndpoint(mux *http.ServeMux) {
 			Allowed:    allowed,
 		}
 
-		_ = s.auditLogger.LogPermissionCheck(ctx, model.Subject{req.SubjectType, req.SubjectID}, req.Permission, model.Entity{req.ObjectType, req.ObjectID}, allowed, nil, r)
+		_ = s.auditLogger.LogPermissionCheck(ctx, model.Subject{Type: req.SubjectType, ID: req.SubjectID}, req.Permission, model.Entity{Type: req.ObjectType, ID: req.ObjectID}, allowed, nil, r)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
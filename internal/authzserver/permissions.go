@@ -1,15 +1,17 @@
 // File to be added to the Go backend to support permission exploration UI
 
-package main
+package authzserver
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/dangerclosesec/supra/internal/budget"
 )
 
 // ListPermissionsResponse represents the response for listing permission definitions
@@ -24,7 +26,12 @@ type PermissionDefinition struct {
 	PermissionName      string `json:"permission_name"`
 	ConditionExpression string `json:"condition_expression"`
 	Description         string `json:"description,omitempty"`
-	CreatedAt           string `json:"created_at,omitempty"`
+	// Deprecated holds the schema's deprecation message, empty when it
+	// gave none; it is omitted for permissions that aren't deprecated
+	Deprecated *string `json:"deprecated,omitempty"`
+	// Sensitive holds the schema's @sensitive label the same way
+	Sensitive *string `json:"sensitive,omitempty"`
+	CreatedAt string  `json:"created_at,omitempty"`
 }
 
 // ListEntitiesResponse represents the response for listing entity types
@@ -46,13 +53,15 @@ type ListRelationsResponse struct {
 
 // RelationInfo represents information about a relation between entities
 type RelationInfo struct {
-	ID          int64  `json:"id"`
-	SubjectType string `json:"subject_type"`
-	SubjectID   string `json:"subject_id"`
-	Relation    string `json:"relation"`
-	ObjectType  string `json:"object_type"`
-	ObjectID    string `json:"object_id"`
-	CreatedAt   string `json:"created_at,omitempty"`
+	ID          int64                  `json:"id"`
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Relation    string                 `json:"relation"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Source      string                 `json:"source"`
+	CreatedAt   string                 `json:"created_at,omitempty"`
 }
 
 // addSchemaExplorerEndpoints adds endpoints for exploring the permission schema
@@ -66,13 +75,13 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 		}
 
 		// Get context with timeout
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
 		defer cancel()
 
 		// Query the database for all permission definitions
 		rows, err := s.graph.Pool.Query(ctx, `
 			SELECT 
-				id, entity_type, permission_name, condition_expression, description, created_at
+				id, entity_type, permission_name, condition_expression, description, deprecated, sensitive, created_at
 			FROM 
 				permission_definitions
 			ORDER BY
@@ -96,6 +105,8 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 				&perm.PermissionName,
 				&perm.ConditionExpression,
 				&perm.Description,
+				&perm.Deprecated,
+				&perm.Sensitive,
 				&createdAt,
 			)
 			if err != nil {
@@ -112,7 +123,7 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 		}
 
 		// Return the results
-		jsonResponse(w, permissions, http.StatusOK)
+		conditionalJSONResponse(w, r, permissions, time.Time{}, schemaCacheControl)
 	})
 
 	// Endpoint to get all entity types
@@ -124,7 +135,7 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 		}
 
 		// Get context with timeout
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
 		defer cancel()
 
 		// Query distinct entity types from permission definitions
@@ -211,7 +222,7 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 		}
 
 		// Return the results
-		jsonResponse(w, entities, http.StatusOK)
+		conditionalJSONResponse(w, r, entities, time.Time{}, schemaCacheControl)
 	})
 
 	// Endpoint to get all relations
@@ -233,14 +244,15 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 
 		entityType := r.URL.Query().Get("entity_type")
 		relationName := r.URL.Query().Get("relation")
+		source := r.URL.Query().Get("source")
 
 		// Get context with timeout
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
 		defer cancel()
 
 		// Construct base query
 		query := `
-			SELECT id, subject_type, subject_id, relation, object_type, object_id, created_at
+			SELECT id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
 			FROM relations
 			WHERE 1=1
 		`
@@ -260,6 +272,12 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 			argPos++
 		}
 
+		if source != "" {
+			query += fmt.Sprintf(" AND source = $%d", argPos)
+			args = append(args, source)
+			argPos++
+		}
+
 		// Add limit and order
 		query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", argPos)
 		args = append(args, limit)
@@ -277,6 +295,7 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 		var relations []RelationInfo
 		for rows.Next() {
 			var rel RelationInfo
+			var metadataJSON []byte
 			var createdAt interface{} // Handle potential NULL value
 			err := rows.Scan(
 				&rel.ID,
@@ -285,6 +304,8 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 				&rel.Relation,
 				&rel.ObjectType,
 				&rel.ObjectID,
+				&metadataJSON,
+				&rel.Source,
 				&createdAt,
 			)
 			if err != nil {
@@ -292,6 +313,10 @@ func (s *AuthzService) addSchemaExplorerEndpoints(mux *http.ServeMux) {
 				continue
 			}
 
+			if err := json.Unmarshal(metadataJSON, &rel.Metadata); err != nil {
+				log.Printf("Error parsing relation metadata: %v", err)
+			}
+
 			// Convert createdAt to string if not nil
 			if createdAt != nil {
 				rel.CreatedAt = createdAt.(time.Time).Format(time.RFC3339)
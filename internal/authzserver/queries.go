@@ -0,0 +1,53 @@
+package authzserver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+)
+
+// SetQueryRecorder reports the queries counted by recorder, whose tracer
+// Run installs on the pool, on /metrics
+func (s *AuthzService) SetQueryRecorder(recorder *dbtrace.Recorder) {
+	s.queries = recorder
+}
+
+// queryLabels attributes the database queries of a request to its method
+// and the mux pattern that serves it, e.g. POST /relation, so unmatched
+// paths can't multiply the labels
+func queryLabels(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		label := dbtrace.Unlabeled
+		if _, pattern := mux.Handler(r); pattern != "" {
+			label = r.Method + " " + pattern
+		}
+		next.ServeHTTP(w, r.WithContext(dbtrace.WithLabel(r.Context(), label)))
+	})
+}
+
+// traceRoute names a request's span by the route queryLabels found for it
+func traceRoute(r *http.Request) string {
+	return dbtrace.Label(r.Context())
+}
+
+// gatewayQueryLabel narrows the label of REST gateway calls from the /v1/
+// prefix to the route, e.g. GET /v1/entities/{type}/{external_id}
+func gatewayQueryLabel(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		if pattern, ok := runtime.HTTPPathPattern(r.Context()); ok {
+			r = r.WithContext(dbtrace.WithLabel(r.Context(), r.Method+" "+pattern))
+		}
+		next(w, r, params)
+	}
+}
+
+// grpcQueryLabelInterceptor attributes the database queries of a call to
+// its method, e.g. /supra.authz.v1.AuthzService/Check
+func grpcQueryLabelInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	return handler(dbtrace.WithLabel(ctx, info.FullMethod), req)
+}
@@ -0,0 +1,33 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryLabels(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/entity", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc("/api/rules/", func(http.ResponseWriter, *http.Request) {})
+
+	var label string
+	handler := queryLabels(mux, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		label = dbtrace.Label(r.Context())
+	}))
+
+	tests := map[string]string{
+		"POST /entity":            "POST /entity",
+		"GET /api/rules/document": "GET /api/rules/",
+		"GET /nowhere":            dbtrace.Unlabeled,
+	}
+	for request, want := range tests {
+		method, path, _ := strings.Cut(request, " ")
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+		assert.Equal(t, want, label, request)
+	}
+}
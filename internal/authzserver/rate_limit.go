@@ -0,0 +1,303 @@
+package authzserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled are
+// forgotten, so callers seen once don't hold memory forever
+const rateLimitSweepInterval = time.Minute
+
+// Kinds of caller a rate limit applies to
+const (
+	rateLimitAPIKey   = "api_key"
+	rateLimitClientIP = "client_ip"
+)
+
+// rateLimitCaller is who a request is counted against: its API key when it
+// authenticated with one, or else its client address
+type rateLimitCaller struct {
+	Kind string
+	Name string
+}
+
+// tokenBucket holds a caller's tokens as of last
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// limited is set while the caller is being turned away, so it is
+	// logged once per episode rather than per request
+	limited bool
+}
+
+// rateLimiter gives each caller a token bucket refilled at rate tokens a
+// second up to burst. Limits are per replica. A nil rateLimiter allows
+// everything.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	exempt map[string]bool
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[rateLimitCaller]*tokenBucket
+	lastSweep time.Time
+	rejected  map[string]int64
+}
+
+// newRateLimiter returns a limiter allowing each caller rate requests a
+// second with bursts of up to burst, or nil when rate isn't positive. A
+// zero burst allows one second's worth. exempt names API keys that are
+// never limited.
+func newRateLimiter(rate float64, burst int, exempt []string) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	l := &rateLimiter{
+		rate:     rate,
+		burst:    float64(burst),
+		exempt:   make(map[string]bool, len(exempt)),
+		now:      time.Now,
+		buckets:  make(map[rateLimitCaller]*tokenBucket),
+		rejected: make(map[string]int64),
+	}
+	for _, name := range exempt {
+		l.exempt[name] = true
+	}
+	return l
+}
+
+// allow takes a token from caller's bucket. When there is none it returns
+// false and how long until there will be.
+func (l *rateLimiter) allow(caller rateLimitCaller) (bool, time.Duration) {
+	if l == nil || (caller.Kind == rateLimitAPIKey && l.exempt[caller.Name]) {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(caller)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.limited = false
+		return true, 0
+	}
+	return false, l.reject(caller, bucket)
+}
+
+// peek reports whether caller's bucket has a token, like allow, without
+// taking it
+func (l *rateLimiter) peek(caller rateLimitCaller) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(caller)
+	if bucket.tokens >= 1 {
+		return true, 0
+	}
+	return false, l.reject(caller, bucket)
+}
+
+// refill returns caller's bucket topped up to now, creating it full
+func (l *rateLimiter) refill(caller rateLimitCaller) *tokenBucket {
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[caller]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[caller] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	return bucket
+}
+
+// reject counts a request turned away and returns how long until bucket
+// has a token again
+func (l *rateLimiter) reject(caller rateLimitCaller, bucket *tokenBucket) time.Duration {
+	l.rejected[caller.Kind]++
+	if !bucket.limited {
+		bucket.limited = true
+		log.Printf("Rate limiting %s %s: over %g requests/s", caller.Kind, caller.Name, l.rate)
+	}
+	return time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets buckets that have refilled, since a new bucket starts full
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for caller, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(l.buckets, caller)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rejections returns the requests turned away, by caller kind
+func (l *rateLimiter) rejections() map[string]int64 {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counts := make(map[string]int64, len(l.rejected))
+	for kind, n := range l.rejected {
+		counts[kind] = n
+	}
+	return counts
+}
+
+// SetRateLimit limits each caller, by API key or client address, to the
+// configured requests a second. Zero turns limiting off. Callers start
+// again with full buckets.
+func (s *AuthzService) SetRateLimit(limit config.RateLimit) {
+	s.rateLimits.Store(newRateLimiter(limit.RequestsPerSecond, limit.Burst, limit.Exempt))
+}
+
+// rateLimitCallerOf names who r is counted against
+func (s *AuthzService) rateLimitCallerOf(r *http.Request) rateLimitCaller {
+	if key, ok := apiKeyFromContext(r.Context()); ok {
+		return rateLimitCaller{Kind: rateLimitAPIKey, Name: key.Name}
+	}
+	return rateLimitCaller{Kind: rateLimitClientIP, Name: s.clientIPs.Resolve(r)}
+}
+
+// retryAfter is a wait in whole seconds for a Retry-After header
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
+
+// rateLimitExempt reports whether r skips rate limiting: preflights, and
+// health and version probes
+func rateLimitExempt(r *http.Request) bool {
+	return r.Method == http.MethodOptions || r.URL.Path == "/health" || r.URL.Path == "/version"
+}
+
+// rateLimitedResponse writes the 429 Too Many Requests for a caller that
+// has wait to go until its next token
+func rateLimitedResponse(w http.ResponseWriter, limits *rateLimiter, wait time.Duration) {
+	w.Header().Set("Retry-After", retryAfter(wait))
+	standardErrorResponse(w, "rate_limited", "Too many requests",
+		fmt.Sprintf("Callers may make %g requests a second, in bursts of up to %g", limits.rate, limits.burst),
+		http.StatusTooManyRequests)
+}
+
+// authFailureLimit runs in front of apiKeyAuth and counts requests it
+// turns away against their client address, so guessing keys costs tokens
+// like any other request and an address out of tokens is turned away
+// before its key is looked up
+func (s *AuthzService) authFailureLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := s.rateLimits.Load()
+		if limits == nil || rateLimitExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		caller := rateLimitCaller{Kind: rateLimitClientIP, Name: s.clientIPs.Resolve(r)}
+		if ok, wait := limits.peek(caller); !ok {
+			rateLimitedResponse(w, limits, wait)
+			return
+		}
+		wrapper := &responseWriterWrapper{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(wrapper, r)
+		if wrapper.Status == http.StatusUnauthorized {
+			limits.allow(caller)
+		}
+	})
+}
+
+// rateLimit turns a caller over its limit away with 429 Too Many Requests
+// before the request reaches the database. It runs after apiKeyAuth, so
+// callers with a key share its bucket wherever they call from; requests
+// that fail authentication never reach it and are counted by
+// authFailureLimit instead. Health and version probes are never limited.
+func (s *AuthzService) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := s.rateLimits.Load()
+		if limits == nil || rateLimitExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, wait := limits.allow(s.rateLimitCallerOf(r)); !ok {
+			rateLimitedResponse(w, limits, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// grpcAuthFailureLimit applies authFailureLimit to calls
+func (s *AuthzService) grpcAuthFailureLimit(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	limits := s.rateLimits.Load()
+	if limits == nil {
+		return handler(ctx, req)
+	}
+	caller := rateLimitCaller{Kind: rateLimitClientIP, Name: s.clientIPs.Resolve(grpcRequest(ctx))}
+	if ok, wait := limits.peek(caller); !ok {
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter(wait)))
+		return nil, status.Errorf(codes.ResourceExhausted, "rate limit of %g requests a second exceeded", limits.rate)
+	}
+	resp, err := handler(ctx, req)
+	if status.Code(err) == codes.Unauthenticated {
+		limits.allow(caller)
+	}
+	return resp, err
+}
+
+// grpcRateLimitInterceptor applies rateLimit to calls, failing those over
+// the limit with ResourceExhausted and a retry-after header
+func (s *AuthzService) grpcRateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	limits := s.rateLimits.Load()
+	if limits == nil {
+		return handler(ctx, req)
+	}
+	if ok, wait := limits.allow(s.rateLimitCallerOf(grpcRequest(ctx))); !ok {
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter(wait)))
+		return nil, status.Errorf(codes.ResourceExhausted, "rate limit of %g requests a second exceeded", limits.rate)
+	}
+	return handler(ctx, req)
+}
+
+// writeRateLimitMetrics writes requests turned away by the rate limit in
+// the Prometheus text exposition format
+func writeRateLimitMetrics(w http.ResponseWriter, rejected map[string]int64) {
+	var b strings.Builder
+	b.WriteString("# HELP supra_authz_rate_limited_total Requests turned away by the rate limit by caller kind.\n")
+	b.WriteString("# TYPE supra_authz_rate_limited_total counter\n")
+	for _, kind := range []string{rateLimitAPIKey, rateLimitClientIP} {
+		fmt.Fprintf(&b, "supra_authz_rate_limited_total{caller=%q} %d\n", kind, rejected[kind])
+	}
+	w.Write([]byte(b.String()))
+}
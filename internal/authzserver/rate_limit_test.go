@@ -0,0 +1,128 @@
+package authzserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authzv1 "github.com/dangerclosesec/supra/api/authz/v1"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newRateLimiter(2, 3, []string{"batch"})
+	l.now = func() time.Time { return now }
+
+	alice := rateLimitCaller{Kind: rateLimitAPIKey, Name: "alice"}
+	for i := 0; i < 3; i++ {
+		ok, _ := l.allow(alice)
+		require.True(t, ok, "the burst should be allowed")
+	}
+	ok, wait := l.allow(alice)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = l.allow(rateLimitCaller{Kind: rateLimitClientIP, Name: "10.0.0.7"})
+	assert.True(t, ok, "callers have their own buckets")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.allow(alice)
+	assert.True(t, ok, "a token refills at the rate")
+
+	for i := 0; i < 10; i++ {
+		ok, _ = l.allow(rateLimitCaller{Kind: rateLimitAPIKey, Name: "batch"})
+		require.True(t, ok, "exempt keys aren't limited")
+	}
+	assert.Equal(t, map[string]int64{rateLimitAPIKey: 1}, l.rejections())
+
+	now = now.Add(2 * rateLimitSweepInterval)
+	l.allow(alice)
+	assert.Len(t, l.buckets, 1, "refilled buckets should be swept")
+
+	assert.Nil(t, newRateLimiter(0, 10, nil))
+	var off *rateLimiter
+	ok, _ = off.allow(alice)
+	assert.True(t, ok)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s := &AuthzService{}
+	s.SetRateLimit(config.RateLimit{RequestsPerSecond: 0.5, Burst: 1})
+	handler := s.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	call := func(path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, call("/check", "10.0.0.7:4000").Code)
+	rec := call("/check", "10.0.0.7:4001")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), "rate_limited")
+
+	assert.Equal(t, http.StatusOK, call("/check", "10.0.0.8:4000").Code, "another address has its own bucket")
+	assert.Equal(t, http.StatusOK, call("/health", "10.0.0.7:4002").Code, "health checks aren't limited")
+
+	rec = httptest.NewRecorder()
+	writeRateLimitMetrics(rec, s.rateLimits.Load().rejections())
+	assert.Contains(t, rec.Body.String(), `supra_authz_rate_limited_total{caller="client_ip"} 1`)
+
+	s.SetRateLimit(config.RateLimit{})
+	assert.Equal(t, http.StatusOK, call("/check", "10.0.0.7:4003").Code, "zero turns limiting off")
+}
+
+func TestAuthFailureLimit(t *testing.T) {
+	s := &AuthzService{}
+	s.SetAPIKeys([]config.APIKey{{Name: "alice", Scope: config.ScopeRead, Key: "alice-secret"}}, false)
+	s.SetRateLimit(config.RateLimit{RequestsPerSecond: 0.5, Burst: 2})
+	handler := s.authFailureLimit(s.apiKeyAuth(s.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	call := func(key, addr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/check", nil)
+		req.Header.Set(apiKeyHeader, key)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call("supra_guess1", "10.0.0.7:4000"))
+	assert.Equal(t, http.StatusUnauthorized, call("supra_guess2", "10.0.0.7:4001"))
+	assert.Equal(t, http.StatusTooManyRequests, call("supra_guess3", "10.0.0.7:4002"),
+		"failed authentications should use up the address's tokens")
+	assert.Equal(t, http.StatusTooManyRequests, call("alice-secret", "10.0.0.7:4003"),
+		"an address out of tokens is turned away before its key is checked")
+
+	assert.Equal(t, http.StatusOK, call("alice-secret", "10.0.0.8:4000"))
+	assert.Equal(t, http.StatusOK, call("alice-secret", "10.0.0.8:4001"))
+	assert.Equal(t, http.StatusUnauthorized, call("supra_guess4", "10.0.0.8:4002"),
+		"requests with a key are counted against the key, not the address")
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	s := &AuthzService{}
+	s.SetRateLimit(config.RateLimit{RequestsPerSecond: 0.1, Burst: 1})
+	client := grpcClient(t, s)
+
+	// Past the limit the call fails validation
+	_, err := client.Check(context.Background(), &authzv1.CheckRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	var header metadata.MD
+	_, err = client.Check(context.Background(), &authzv1.CheckRequest{}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"10"}, header.Get("retry-after"))
+}
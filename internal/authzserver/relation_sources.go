@@ -0,0 +1,103 @@
+package authzserver
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/internal/jobs"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// RevokeSourceResult is the result of a revoke_source job
+type RevokeSourceResult struct {
+	Source  string `json:"source"`
+	Deleted int64  `json:"deleted"`
+}
+
+// addRelationSourceEndpoints serves the sources relations were written by
+// and their revocation:
+//
+//	GET    /api/relations/sources           sources with their relation counts
+//	DELETE /api/relations/sources/{source}  submit a revoke_source job
+//
+// Listing one source's relations is GET /api/relations?source=.
+func (s *AuthzService) addRelationSourceEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/relations/sources", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+		defer cancel()
+
+		sources, err := s.graph.RelationSources(ctx)
+		if err != nil {
+			log.Printf("Error listing relation sources: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to list relation sources", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sources == nil {
+			sources = []graph.RelationSource{}
+		}
+		jsonResponse(w, map[string]interface{}{"sources": sources}, http.StatusOK)
+	})
+
+	mux.HandleFunc("/api/relations/sources/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		params := &RevokeSourceJobParams{Source: strings.TrimPrefix(r.URL.Path, "/api/relations/sources/")}
+		if err := params.validate(); err != nil {
+			standardErrorResponse(w, "invalid_source", "Invalid relation source", err.Error(), http.StatusBadRequest)
+			return
+		}
+		// A source's relations cross admin scopes, so only the admin token
+		// may revoke them
+		if !s.authorizeAdmin(w, r, nil) {
+			return
+		}
+		if s.jobs == nil {
+			jobsDisabled(w)
+			return
+		}
+		s.startJob(w, r, JobRevokeSource, params)
+	})
+}
+
+// runRevokeSourceJob deletes a source's relations a batch at a time,
+// metering and auditing each like DELETE /relation does
+func (s *AuthzService) runRevokeSourceJob(ctx context.Context, job *jobs.Job, report func(jobs.Progress)) (*jobs.Result, error) {
+	decoded, err := decodeJobParams(job.Kind, job.Params)
+	if err != nil {
+		return nil, err
+	}
+	params := decoded.(*RevokeSourceJobParams)
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
+	r := jobRequest(ctx, job)
+
+	result := RevokeSourceResult{Source: params.Source}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch, err := s.graph.DeleteSourceRelations(ctx, params.Source, orphanGCBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		s.recordRelationDeletes(r, batch)
+		result.Deleted += int64(len(batch))
+		report(jobs.Progress{Done: result.Deleted})
+	}
+
+	return jobs.JSONResult("revoke-source.json", result)
+}
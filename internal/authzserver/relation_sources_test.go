@@ -0,0 +1,48 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelationSourceEndpoints(t *testing.T) {
+	s := &AuthzService{enforceAdminScopes: true}
+	mux := http.NewServeMux()
+	s.addRelationSourceEndpoints(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		status int
+	}{
+		{"sources are read-only", http.MethodPost, "/api/relations/sources", "", http.StatusMethodNotAllowed},
+		{"revoke needs DELETE", http.MethodGet, "/api/relations/sources/scim", "", http.StatusMethodNotAllowed},
+		{"invalid source", http.MethodDelete, "/api/relations/sources/a%20b", "", http.StatusBadRequest},
+		{"missing source", http.MethodDelete, "/api/relations/sources/", "", http.StatusBadRequest},
+		{"without credentials", http.MethodDelete, "/api/relations/sources/scim", "", http.StatusUnauthorized},
+		{"scoped admin", http.MethodDelete, "/api/relations/sources/scim", "user:alice", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(principalHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+
+	s.enforceAdminScopes = false
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/relations/sources/import:batch-42", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "revocation runs as a job, so needs the job manager")
+
+	assert.True(t, isAdminRoute("/api/relations/sources/scim"))
+}
@@ -0,0 +1,259 @@
+package authzserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/shadow"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// maxRelationBatch bounds the operations of one /relations/batch request
+const maxRelationBatch = 1000
+
+// RelationBatchRequest is a list of relation writes, applied atomically
+// unless ContinueOnError is set
+type RelationBatchRequest struct {
+	Operations []RelationOperation `json:"operations"`
+	// ContinueOnError applies each operation on its own, reporting the ones
+	// that fail in their results instead of failing the batch
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+}
+
+// RelationOperation creates or deletes one relation. Op is create or
+// delete; metadata is only stored by creates.
+type RelationOperation struct {
+	Op string `json:"op"`
+	RelationRequest
+}
+
+// RelationBatchResponse has one result per operation, in request order
+type RelationBatchResponse struct {
+	Created int                   `json:"created"`
+	Deleted int                   `json:"deleted"`
+	Results []RelationBatchResult `json:"results"`
+	// Failed counts the operations that failed, with continue_on_error
+	Failed int `json:"failed,omitempty"`
+}
+
+// RelationBatchResult is the relation an operation created or deleted.
+// Relation is omitted for a delete that matched nothing. With
+// continue_on_error, an operation that failed has the error's code and
+// details instead.
+type RelationBatchResult struct {
+	Op       string          `json:"op"`
+	Relation *graph.Relation `json:"relation,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// relationBatchHandler applies up to maxRelationBatch relation creates and
+// deletes in one transaction. If any operation fails, none are applied and
+// the error names the failing operation's index. With continue_on_error
+// each operation is applied and reported on its own instead.
+func (s *AuthzService) relationBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RelationBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+		return
+	}
+	writes, err := relationWrites(req.Operations)
+	if err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid relation batch", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Long)
+	defer cancel()
+
+	if req.ContinueOnError {
+		jsonResponse(w, s.writeRelationsEach(ctx, r, req.Operations, writes), http.StatusOK)
+		return
+	}
+
+	// Every operation must be in the caller's scopes before any is applied
+	for i, op := range req.Operations {
+		if err := s.checkAdmin(r, &adminTarget{
+			Type:    op.ObjectType,
+			ID:      op.ObjectID,
+			Subject: &model.Subject{Type: op.SubjectType, ID: op.SubjectID},
+		}); err != nil {
+			standardErrorResponse(w, err.code, err.message,
+				fmt.Sprintf("operations[%d]: %s", i, err.details), err.status)
+			return
+		}
+	}
+
+	results, err := s.writeRelations(ctx, r, writes)
+	if err != nil {
+		code, message, status := relationWriteError(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error writing relation batch: %v", err)
+		}
+		standardErrorResponse(w, code, message, err.Error(), status)
+		return
+	}
+
+	resp := RelationBatchResponse{Results: make([]RelationBatchResult, len(results))}
+	for i, result := range results {
+		resp.Results[i] = RelationBatchResult{Op: string(result.Op), Relation: result.Relation}
+		switch {
+		case result.Relation == nil:
+		case result.Op == graph.RelationCreate:
+			resp.Created++
+		case result.Op == graph.RelationDelete:
+			resp.Deleted++
+		}
+	}
+	jsonResponse(w, resp, http.StatusOK)
+}
+
+// writeRelationsEach applies a batch's operations one at a time, each in
+// its own transaction, reporting the ones outside the caller's scopes or
+// that fail in their results
+func (s *AuthzService) writeRelationsEach(ctx context.Context, r *http.Request, ops []RelationOperation, writes []graph.RelationWrite) RelationBatchResponse {
+	resp := RelationBatchResponse{Results: make([]RelationBatchResult, len(writes))}
+	for i, write := range writes {
+		result := &resp.Results[i]
+		result.Op = string(write.Op)
+
+		if err := s.checkAdmin(r, &adminTarget{
+			Type:    ops[i].ObjectType,
+			ID:      ops[i].ObjectID,
+			Subject: &model.Subject{Type: ops[i].SubjectType, ID: ops[i].SubjectID},
+		}); err != nil {
+			result.Code, result.Error = err.code, err.details
+			resp.Failed++
+			continue
+		}
+
+		written, err := s.writeRelations(ctx, r, []graph.RelationWrite{write})
+		if err != nil {
+			code, _, status := relationWriteError(err)
+			if status == http.StatusInternalServerError {
+				log.Printf("Error writing relation batch operation %d: %v", i, err)
+			}
+			result.Code, result.Error = code, err.Error()
+			resp.Failed++
+			continue
+		}
+
+		result.Relation = written[0].Relation
+		switch {
+		case result.Relation == nil:
+		case write.Op == graph.RelationCreate:
+			resp.Created++
+		case write.Op == graph.RelationDelete:
+			resp.Deleted++
+		}
+	}
+	return resp
+}
+
+// relationWriteError returns the code, message and status reporting a
+// failed relation write
+func relationWriteError(err error) (code, message string, status int) {
+	var limitErr *graph.CardinalityError
+	switch {
+	case errors.As(err, &limitErr):
+		return "cardinality_exceeded", "Relation limit reached", http.StatusConflict
+	case errors.Is(err, graph.ErrInvalidRelation):
+		return "invalid_relation", "Relation not declared by the schema", http.StatusBadRequest
+	case errors.Is(err, graph.ErrInvalidSource):
+		return "invalid_source", "Invalid relation source", http.StatusBadRequest
+	case errors.Is(err, graph.ErrRelationExists):
+		return "relation_exists", "Relation already exists", http.StatusConflict
+	case budgetExceeded(err):
+		return "budget_exceeded", "Relation writes ran out of time", http.StatusGatewayTimeout
+	default:
+		return "internal_error", "Failed to write relations", http.StatusInternalServerError
+	}
+}
+
+// relationWrites validates a batch's operations and converts them for the
+// graph
+func relationWrites(ops []RelationOperation) ([]graph.RelationWrite, error) {
+	if len(ops) == 0 {
+		return nil, errors.New("operations is required")
+	}
+	if len(ops) > maxRelationBatch {
+		return nil, fmt.Errorf("at most %d operations can be applied at once, got %d", maxRelationBatch, len(ops))
+	}
+
+	writes := make([]graph.RelationWrite, len(ops))
+	for i, op := range ops {
+		kind := graph.RelationOp(op.Op)
+		if kind != graph.RelationCreate && kind != graph.RelationDelete {
+			return nil, fmt.Errorf("operations[%d]: op must be create or delete, got %q", i, op.Op)
+		}
+		if op.SubjectType == "" || op.SubjectID == "" || op.Relation == "" ||
+			op.ObjectType == "" || op.ObjectID == "" {
+			return nil, fmt.Errorf("operations[%d]: subject_type, subject_id, relation, object_type and object_id are required", i)
+		}
+		writes[i] = graph.RelationWrite{
+			Op:          kind,
+			SubjectType: op.SubjectType,
+			SubjectID:   op.SubjectID,
+			Relation:    op.Relation,
+			ObjectType:  op.ObjectType,
+			ObjectID:    op.ObjectID,
+			Metadata:    op.Metadata,
+			Source:      op.Source,
+		}
+	}
+	return writes, nil
+}
+
+// writeRelations applies a batch and, once it has committed, meters,
+// mirrors and audits each relation it changed. Admin scopes are checked by
+// the caller.
+func (s *AuthzService) writeRelations(ctx context.Context, r *http.Request, writes []graph.RelationWrite) ([]graph.RelationWriteResult, error) {
+	results, err := s.graph.WriteRelations(ctx, writes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		rel := result.Relation
+		if rel == nil {
+			continue
+		}
+		s.usage.recordRelationWrite(usageKey{
+			Tenant:     usageTenant(r, rel.ObjectType, rel.ObjectID, nil),
+			EntityType: rel.ObjectType,
+		})
+
+		object := model.Entity{Type: rel.ObjectType, ID: rel.ObjectID}
+		subject := model.Subject{Type: rel.SubjectType, ID: rel.SubjectID}
+		if result.Op == graph.RelationDelete {
+			if err := s.auditLogger.LogRelationDelete(r.Context(), object, rel.Relation, subject, r); err != nil {
+				log.Printf("Failed to log relation deletion: %v", err)
+			}
+			continue
+		}
+
+		s.shadow.WriteRelation(shadow.Relation{
+			SubjectType: rel.SubjectType,
+			SubjectID:   rel.SubjectID,
+			Relation:    rel.Relation,
+			ObjectType:  rel.ObjectType,
+			ObjectID:    rel.ObjectID,
+			Metadata:    rel.Metadata,
+		})
+		if err := s.auditLogger.LogRelationCreate(r.Context(), object, rel.Relation, subject, rel.Metadata, r); err != nil {
+			log.Printf("Failed to log relation creation: %v", err)
+		}
+	}
+	return results, nil
+}
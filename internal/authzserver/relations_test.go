@@ -0,0 +1,174 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteRelationRequiresFilter(t *testing.T) {
+	s := &AuthzService{}
+	s.SetAdminToken(func() string { return "s3cret" })
+	s.SetAdminScopes(true)
+
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		status int
+		code   string
+	}{
+		{"no filter", "", "", http.StatusBadRequest, "invalid_request"},
+		{"relation only", "?relation=viewer", "", http.StatusBadRequest, "invalid_request"},
+		{"subject without ID", "?subject_type=user&object_type=document&object_id=plan", "", http.StatusBadRequest, "invalid_request"},
+		{"no credentials", "?object_type=document&object_id=plan", "", http.StatusUnauthorized, "admin_credentials_required"},
+		{"scoped admin across objects", "?subject_type=user&subject_id=alice", "user:bob", http.StatusForbidden, "admin_token_required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/relation"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set(principalHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			s.relationHandler(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"code":"`+tt.code+`"`)
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	s.relationHandler(rec, httptest.NewRequest(http.MethodPut, "/relation", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestListRelations(t *testing.T) {
+	s := &AuthzService{graph: definitionGraph(t, definitionStore{})}
+
+	rec := httptest.NewRecorder()
+	s.relationHandler(rec, httptest.NewRequest(http.MethodGet, "/relation?relation=member", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "listing needs a subject or an object")
+
+	rec = httptest.NewRecorder()
+	s.relationHandler(rec, httptest.NewRequest(http.MethodGet, "/relation?object_type=organization&object_id=acme&source=entity-sync", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"relations":[]}`, rec.Body.String())
+}
+
+func TestDeleteEntityValidation(t *testing.T) {
+	s := &AuthzService{}
+	s.SetAdminToken(func() string { return "s3cret" })
+	s.SetAdminScopes(true)
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		code   string
+	}{
+		{"no type", "?id=plan", http.StatusBadRequest, "missing_parameters"},
+		{"no id", "?type=document", http.StatusBadRequest, "missing_parameters"},
+		{"invalid cascade", "?type=document&id=plan&cascade=maybe", http.StatusBadRequest, "invalid_request"},
+		{"no credentials", "?type=document&id=plan&cascade=true", http.StatusUnauthorized, "admin_credentials_required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.entityHandler(rec, httptest.NewRequest(http.MethodDelete, "/entity"+tt.query, nil))
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"code":"`+tt.code+`"`)
+		})
+	}
+}
+
+func TestRelationWrites(t *testing.T) {
+	valid := RelationOperation{Op: "create", RelationRequest: RelationRequest{
+		SubjectType: "user", SubjectID: "alice", Relation: "viewer", ObjectType: "document", ObjectID: "plan",
+		Source: "scim",
+	}}
+	missing := valid
+	missing.SubjectID = ""
+	unknown := valid
+	unknown.Op = "upsert"
+
+	writes, err := relationWrites([]RelationOperation{valid, {Op: "delete", RelationRequest: valid.RelationRequest}})
+	require.NoError(t, err)
+	assert.Equal(t, graph.RelationCreate, writes[0].Op)
+	assert.Equal(t, graph.RelationDelete, writes[1].Op)
+	assert.Equal(t, "plan", writes[1].ObjectID)
+	assert.Equal(t, "scim", writes[0].Source)
+
+	_, err = relationWrites(nil)
+	assert.Error(t, err)
+	_, err = relationWrites(make([]RelationOperation, maxRelationBatch+1))
+	assert.ErrorContains(t, err, "at most")
+	_, err = relationWrites([]RelationOperation{valid, missing})
+	assert.ErrorContains(t, err, "operations[1]")
+	_, err = relationWrites([]RelationOperation{unknown})
+	assert.ErrorContains(t, err, "op must be create or delete")
+}
+
+func TestRelationBatchHandler(t *testing.T) {
+	s := &AuthzService{}
+	s.SetAdminScopes(true)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.relationBatchHandler(rec, httptest.NewRequest(http.MethodPost, "/relations/batch", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"operations":`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = post(`{"operations":[{"op":"create","subject_type":"user","relation":"viewer"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "operations[0]")
+
+	rec = post(`{"operations":[{"op":"delete","subject_type":"user","subject_id":"alice","relation":"viewer","object_type":"document","object_id":"plan"}]}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"admin_credentials_required"`)
+
+	// With continue_on_error, operations outside the caller's scopes fail
+	// on their own
+	rec = post(`{"continue_on_error":true,"operations":[{"op":"delete","subject_type":"user","subject_id":"alice","relation":"viewer","object_type":"document","object_id":"plan"}]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp RelationBatchResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Failed)
+	assert.Equal(t, "admin_credentials_required", resp.Results[0].Code)
+
+	rec = httptest.NewRecorder()
+	s.relationBatchHandler(rec, httptest.NewRequest(http.MethodGet, "/relations/batch", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestUpsertParam(t *testing.T) {
+	s := &AuthzService{}
+
+	for _, path := range []string{"/entity?upsert=maybe", "/relation?upsert=maybe"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		rec := httptest.NewRecorder()
+		if strings.HasPrefix(path, "/entity") {
+			s.entityHandler(rec, req)
+		} else {
+			s.relationHandler(rec, req)
+		}
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+		assert.Contains(t, rec.Body.String(), `"code":"invalid_request"`, path)
+	}
+
+	for query, want := range map[string]bool{"": false, "?upsert=true": true, "?upsert=1": true, "?upsert=false": false} {
+		upsert, ok := upsertParam(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/entity"+query, nil))
+		require.True(t, ok, query)
+		assert.Equal(t, want, upsert, query)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package authzserver
 
 import (
 	"context"
@@ -8,12 +8,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/dangerclosesec/supra/internal/auth/graph"
+	"github.com/dangerclosesec/supra/internal/budget"
 	"github.com/dangerclosesec/supra/permissions/model"
 	"github.com/dangerclosesec/supra/permissions/parser"
+	"github.com/dangerclosesec/supra/pkg/graph"
 )
 
 // RuleDefinitionResponse represents a rule definition for API responses
@@ -32,8 +34,21 @@ type ParameterDefinition struct {
 	DataType string `json:"data_type"`
 }
 
+// SyncOptions control how a permission model is synced
+type SyncOptions struct {
+	// FailOnRuleTests refuses to sync a model whose inline rule tests fail;
+	// otherwise failures are only logged
+	FailOnRuleTests bool
+}
+
 // SyncPermissionModel loads a permission model from a file and syncs rules to the database
 func SyncPermissionModel(ctx context.Context, pool interface{}, filePath string) error {
+	return SyncPermissionModelWithOptions(ctx, pool, filePath, SyncOptions{})
+}
+
+// SyncPermissionModelWithOptions is SyncPermissionModel with control over
+// failing rule tests
+func SyncPermissionModelWithOptions(ctx context.Context, pool interface{}, filePath string, opts SyncOptions) error {
 	// Read the permission model file
 	content, err := readFile(filePath)
 	if err != nil {
@@ -52,15 +67,121 @@ func SyncPermissionModel(ctx context.Context, pool interface{}, filePath string)
 		}
 	}
 
+	// Run the rule tests declared in the schema before the rules go live
+	if failed := checkRuleTests(ctx, permModel); failed > 0 && opts.FailOnRuleTests {
+		return fmt.Errorf("%d rule test case(s) failed; rules were not synced", failed)
+	}
+
 	// Sync rules to database
 	err = SyncRulesToDatabase(ctx, pool, permModel)
 	if err != nil {
 		return fmt.Errorf("failed to sync rules to database: %w", err)
 	}
 
+	if g, ok := pool.(*graph.IdentityGraph); ok {
+		if err := g.SyncDerivedRelations(ctx, derivedRelations(permModel)); err != nil {
+			return err
+		}
+		if err := g.SyncRelationLimits(ctx, relationLimits(permModel)); err != nil {
+			return err
+		}
+		if err := g.SyncRelationDeclarations(ctx, relationDeclarations(permModel)); err != nil {
+			return err
+		}
+		if err := g.SyncAttributeDeclarations(ctx, attributeDeclarations(permModel)); err != nil {
+			return err
+		}
+		version, err := g.SnapshotSchema(ctx, filePath)
+		if err != nil {
+			return err
+		}
+		log.Printf("Permission model is at schema version %d", version)
+	}
+
 	return nil
 }
 
+// derivedRelations collects the model's derived relations in a stable
+// order, warning about any that read an attribute the entity doesn't declare
+func derivedRelations(permModel *model.PermissionModel) []graph.DerivedRelation {
+	names := make([]string, 0, len(permModel.Entities))
+	for name := range permModel.Entities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	derived := []graph.DerivedRelation{}
+	for _, name := range names {
+		entity := permModel.Entities[name]
+		for _, d := range entity.DerivedRelations {
+			declared := false
+			for _, attr := range entity.Attributes {
+				declared = declared || attr.Name == d.Attribute
+			}
+			if !declared {
+				log.Printf("Warning: derived relation %s.%s reads attribute %s, which %s does not declare",
+					name, d.Name, d.Attribute, name)
+			}
+			derived = append(derived, graph.DerivedRelation{
+				EntityType:  name,
+				Relation:    d.Name,
+				SubjectType: d.SubjectType,
+				Attribute:   d.Attribute,
+				Value:       d.Value,
+			})
+		}
+	}
+	return derived
+}
+
+// relationDeclarations collects the relations the model declares and the
+// subject types they take, counting derived relations' subject types
+func relationDeclarations(permModel *model.PermissionModel) []graph.RelationDeclaration {
+	declared := []graph.RelationDeclaration{}
+	for name, entity := range permModel.Entities {
+		for _, rel := range entity.Relations {
+			declared = append(declared, graph.RelationDeclaration{EntityType: name, Relation: rel.Name, TargetType: rel.Target})
+		}
+		for _, d := range entity.DerivedRelations {
+			declared = append(declared, graph.RelationDeclaration{EntityType: name, Relation: d.Name, TargetType: d.SubjectType})
+		}
+	}
+	return declared
+}
+
+// attributeDeclarations collects the attributes the model declares and
+// their data types
+func attributeDeclarations(permModel *model.PermissionModel) []graph.AttributeDeclaration {
+	declared := []graph.AttributeDeclaration{}
+	for name, entity := range permModel.Entities {
+		for _, attr := range entity.Attributes {
+			declared = append(declared, graph.AttributeDeclaration{
+				EntityType: name,
+				Attribute:  attr.Name,
+				DataType:   string(attr.DataType),
+			})
+		}
+	}
+	return declared
+}
+
+// relationLimits collects the caps declared on the model's relations
+func relationLimits(permModel *model.PermissionModel) []graph.RelationLimit {
+	limits := []graph.RelationLimit{}
+	for name, entity := range permModel.Entities {
+		for _, rel := range entity.Relations {
+			if rel.MaxSubjects > 0 {
+				limits = append(limits, graph.RelationLimit{
+					EntityType:  name,
+					Relation:    rel.Name,
+					MaxSubjects: rel.MaxSubjects,
+				})
+			}
+		}
+	}
+	return limits
+}
+
 // SyncRulesToDatabase syncs rule definitions from the model to the database
 func SyncRulesToDatabase(ctx context.Context, pool interface{}, permModel *model.PermissionModel) error {
 	pgPool, ok := pool.(*graph.IdentityGraph)
@@ -84,21 +205,7 @@ func SyncRulesToDatabase(ctx context.Context, pool interface{}, permModel *model
 	}
 
 	if !tableExists {
-		log.Println("Rule definitions table does not exist. Creating it now.")
-		_, err := pgPool.Pool.Exec(ctx, `
-			CREATE TABLE rule_definitions (
-				id SERIAL PRIMARY KEY,
-				rule_name TEXT NOT NULL UNIQUE,
-				parameters JSONB NOT NULL,
-				expression TEXT NOT NULL,
-				description TEXT,
-				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-			)
-		`)
-		if err != nil {
-			return fmt.Errorf("failed to create rule_definitions table: %w", err)
-		}
-		log.Println("Created rule_definitions table")
+		return fmt.Errorf("rule_definitions table does not exist; run `supra migrate up --target authz`")
 	}
 
 	// If model has no rules, we're done
@@ -112,6 +219,9 @@ func SyncRulesToDatabase(ctx context.Context, pool interface{}, permModel *model
 	// Process each rule in the model
 	for _, rule := range permModel.Rules {
 		log.Printf("Processing rule: %s", rule.Name)
+		if graph.IsBuiltinFunction(rule.Name) {
+			return fmt.Errorf("rule %s: the name is reserved for a built-in function", rule.Name)
+		}
 
 		// Convert rule parameters to JSON
 		parametersJSON, err := json.Marshal(convertRuleParameters(rule))
@@ -156,6 +266,28 @@ func SyncRulesToDatabase(ctx context.Context, pool interface{}, permModel *model
 	return nil
 }
 
+// checkRuleTests runs the model's rule tests, logs each failing case and
+// returns how many failed
+func checkRuleTests(ctx context.Context, permModel *model.PermissionModel) int {
+	results := graph.RunRuleTests(ctx, permModel)
+	failed := 0
+	for _, result := range results {
+		if result.Passed() {
+			continue
+		}
+		failed++
+		if result.Err != nil {
+			log.Printf("Rule test failed: %s: %v", result, result.Err)
+		} else {
+			log.Printf("Rule test failed: %s returned %v, expected %v", result, result.Got, result.Expected)
+		}
+	}
+	if len(results) > 0 {
+		log.Printf("Rule tests: %d of %d cases passed", len(results)-failed, len(results))
+	}
+	return failed
+}
+
 // convertRuleParameters converts model.RuleParameter to ParameterDefinition
 func convertRuleParameters(rule *model.Rule) []ParameterDefinition {
 	params := make([]ParameterDefinition, len(rule.Parameters))
@@ -191,7 +323,7 @@ func (s *AuthzService) addRuleEndpoints(mux *http.ServeMux) {
 		}
 
 		// Get context with timeout
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
 		defer cancel()
 
 		// Query the database for all rule definitions
@@ -241,7 +373,7 @@ func (s *AuthzService) addRuleEndpoints(mux *http.ServeMux) {
 		}
 
 		// Return the results
-		jsonResponse(w, rules, http.StatusOK)
+		conditionalJSONResponse(w, r, rules, time.Time{}, schemaCacheControl)
 	})
 
 	// Endpoint to test a rule with parameters
@@ -266,7 +398,7 @@ func (s *AuthzService) addRuleEndpoints(mux *http.ServeMux) {
 		}
 
 		// Get context with timeout
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
 		defer cancel()
 
 		// Get rule definition from database
@@ -0,0 +1,55 @@
+package authzserver
+
+import (
+	"testing"
+
+	"github.com/dangerclosesec/supra/permissions/parser"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelationLimitsFromSchema(t *testing.T) {
+	p := parser.NewParser(parser.NewLexer(`entity document {
+    relation owner @user max 1
+    relation viewer @user
+}`))
+	permModel := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	assert.Equal(t, []graph.RelationLimit{
+		{EntityType: "document", Relation: "owner", MaxSubjects: 1},
+	}, relationLimits(permModel))
+}
+
+func TestRelationDeclarationsFromSchema(t *testing.T) {
+	p := parser.NewParser(parser.NewLexer(`entity document {
+    attribute public boolean
+    relation owner @user max 1
+    relation viewer @group
+    relation viewer @user:* when public
+}`))
+	permModel := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	assert.ElementsMatch(t, []graph.RelationDeclaration{
+		{EntityType: "document", Relation: "owner", TargetType: "user"},
+		{EntityType: "document", Relation: "viewer", TargetType: "group"},
+		{EntityType: "document", Relation: "viewer", TargetType: "user"},
+	}, relationDeclarations(permModel))
+}
+
+func TestAttributeDeclarationsFromSchema(t *testing.T) {
+	p := parser.NewParser(parser.NewLexer(`entity document {
+    attribute public boolean
+    attribute tags string[]
+    relation owner @user
+}`))
+	permModel := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	assert.ElementsMatch(t, []graph.AttributeDeclaration{
+		{EntityType: "document", Attribute: "public", DataType: graph.AttributeBoolean},
+		{EntityType: "document", Attribute: "tags", DataType: graph.AttributeStringArray},
+	}, attributeDeclarations(permModel))
+}
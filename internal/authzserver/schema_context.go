@@ -0,0 +1,66 @@
+package authzserver
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// ContextSchemaResponse lists the request context fields the permissions
+// of a schema version read, for clients to build and check a check's
+// context before sending it
+type ContextSchemaResponse struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Fields        []graph.ContextField `json:"fields"`
+}
+
+// addSchemaContextEndpoints adds /api/schema/context. ?schema_version=
+// lists an earlier version's fields instead of the current ones.
+func (s *AuthzService) addSchemaContextEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/schema/context", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+		defer cancel()
+
+		var version int
+		if v := r.URL.Query().Get("schema_version"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				standardErrorResponse(w, "invalid_request", "Invalid schema version",
+					"schema_version must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			version = n
+			ctx = graph.WithSchemaVersion(ctx, version)
+		} else {
+			current, err := s.graph.CurrentSchemaVersion(ctx)
+			if err != nil {
+				log.Printf("Error getting schema version: %v", err)
+				standardErrorResponse(w, "internal_error", "Failed to get schema version", err.Error(), http.StatusInternalServerError)
+				return
+			}
+			version = current
+		}
+
+		fields, err := s.graph.ContextFields(ctx)
+		switch {
+		case errors.Is(err, graph.ErrSchemaVersionNotFound):
+			standardErrorResponse(w, "schema_version_not_found", "Schema version not found", err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			log.Printf("Error listing context fields: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to list context fields", err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, ContextSchemaResponse{SchemaVersion: version, Fields: fields}, http.StatusOK)
+	})
+}
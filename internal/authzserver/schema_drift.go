@@ -0,0 +1,330 @@
+package authzserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/permissions/migration"
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/permissions/parser"
+)
+
+// Where a schema change is found, relative to the schema file
+const (
+	DriftFileOnly     = "file_only"
+	DriftDatabaseOnly = "database_only"
+	DriftChanged      = "changed"
+)
+
+// SchemaChange is one difference between the schema file a replica loaded
+// and the permission model in the database. Name is an entity, a rule, or
+// entity.permission for a permission or its deprecation.
+type SchemaChange struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Database string `json:"database,omitempty"`
+	File     string `json:"file,omitempty"`
+}
+
+// SchemaDriftResponse compares the schema file loaded at startup with the
+// database as it is now
+type SchemaDriftResponse struct {
+	SchemaPath string         `json:"schema_path"`
+	LoadedAt   time.Time      `json:"loaded_at"`
+	CheckedAt  time.Time      `json:"checked_at"`
+	InSync     bool           `json:"in_sync"`
+	Changes    []SchemaChange `json:"changes"`
+}
+
+// loadedSchema is the schema file read at startup
+type loadedSchema struct {
+	mu       sync.RWMutex
+	path     string
+	model    *model.PermissionModel
+	loadedAt time.Time
+}
+
+func (l *loadedSchema) get() (string, *model.PermissionModel, time.Time) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.path, l.model, l.loadedAt
+}
+
+func (l *loadedSchema) set(path string, m *model.PermissionModel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path, l.model, l.loadedAt = path, m, time.Now().UTC()
+}
+
+// checkSchemaDrift parses the schema file and logs how it differs from the
+// model in the database, before the file is synced. A replica started with
+// a stale SCHEMA_PATH shows up here instead of silently serving old
+// permissions. The file is kept for /api/schema/drift.
+func (s *AuthzService) checkSchemaDrift(ctx context.Context, schemaPath string) {
+	content, err := readFile(schemaPath)
+	if err != nil {
+		log.Printf("Warning: Failed to read %s to compare with the database: %v", schemaPath, err)
+		return
+	}
+	fileModel := parser.NewParser(parser.NewLexer(string(content))).ParsePermissionModel()
+	s.schema.set(schemaPath, fileModel)
+
+	dbModel, err := loadDatabaseModel(ctx, s.graph.Pool)
+	if err != nil {
+		log.Printf("Warning: Failed to load the permission model from the database: %v", err)
+		return
+	}
+
+	changes := schemaChanges(dbModel, fileModel)
+	if len(changes) == 0 {
+		log.Printf("Schema %s matches the permission model in the database", schemaPath)
+		return
+	}
+	log.Printf("Warning: Schema %s differs from the permission model in the database in %d place(s):", schemaPath, len(changes))
+	for _, change := range changes {
+		log.Printf("  %s", change)
+	}
+}
+
+func (c SchemaChange) String() string {
+	switch c.Status {
+	case DriftFileOnly:
+		return fmt.Sprintf("+ %s %s: %s (file only)", c.Kind, c.Name, c.File)
+	case DriftDatabaseOnly:
+		return fmt.Sprintf("- %s %s: %s (database only)", c.Kind, c.Name, c.Database)
+	default:
+		return fmt.Sprintf("* %s %s: database %q, file %q", c.Kind, c.Name, c.Database, c.File)
+	}
+}
+
+// schemaChanges lists the differences between the model in the database
+// and the one in the schema file, sorted by kind and name. Entities the
+// file declares without permissions are not stored, so they are left out.
+func schemaChanges(dbModel, fileModel *model.PermissionModel) []SchemaChange {
+	stored := model.NewPermissionModel()
+	stored.Rules = fileModel.Rules
+	for name, entity := range fileModel.Entities {
+		if len(entity.Permissions) > 0 {
+			stored.Entities[name] = entity
+		}
+	}
+	diff := migration.GenerateDiff(dbModel, stored)
+
+	changes := []SchemaChange{}
+	for _, name := range diff.AddedEntities {
+		changes = append(changes, SchemaChange{Kind: "entity", Name: name, Status: DriftFileOnly,
+			File: fmt.Sprintf("%d permission(s)", len(stored.Entities[name].Permissions))})
+	}
+	for _, name := range diff.RemovedEntities {
+		changes = append(changes, SchemaChange{Kind: "entity", Name: name, Status: DriftDatabaseOnly,
+			Database: fmt.Sprintf("%d permission(s)", len(dbModel.Entities[name].Permissions))})
+	}
+	for entity, entityDiff := range diff.ModifiedEntities {
+		for _, perm := range entityDiff.AddedPermissions {
+			changes = append(changes, SchemaChange{Kind: "permission", Name: entity + "." + perm.Name,
+				Status: DriftFileOnly, File: perm.Expression})
+		}
+		for _, name := range entityDiff.RemovedPermissions {
+			var expr string
+			if perm := findPermission(dbModel.Entities[entity], name); perm != nil {
+				expr = perm.Expression
+			}
+			changes = append(changes, SchemaChange{Kind: "permission", Name: entity + "." + name,
+				Status: DriftDatabaseOnly, Database: expr})
+		}
+		for name, permDiff := range entityDiff.ModifiedPermissions {
+			changes = append(changes, SchemaChange{Kind: "permission", Name: entity + "." + name,
+				Status: DriftChanged, Database: permDiff.OldExpression, File: permDiff.NewExpression})
+		}
+		for _, perm := range entityDiff.DeprecatedPermissions {
+			var was string
+			if old := findPermission(dbModel.Entities[entity], perm.Name); old != nil && old.Deprecated {
+				was = deprecationNote(*old)
+			}
+			changes = append(changes, SchemaChange{Kind: "deprecation", Name: entity + "." + perm.Name,
+				Status: DriftChanged, Database: was, File: deprecationNote(perm)})
+		}
+		for _, name := range entityDiff.RestoredPermissions {
+			var was string
+			if old := findPermission(dbModel.Entities[entity], name); old != nil {
+				was = deprecationNote(*old)
+			}
+			changes = append(changes, SchemaChange{Kind: "deprecation", Name: entity + "." + name,
+				Status: DriftChanged, Database: was})
+		}
+		for _, perm := range entityDiff.SensitivePermissions {
+			var was string
+			if old := findPermission(dbModel.Entities[entity], perm.Name); old != nil && old.Sensitive {
+				was = sensitivityNote(*old)
+			}
+			changes = append(changes, SchemaChange{Kind: "sensitivity", Name: entity + "." + perm.Name,
+				Status: DriftChanged, Database: was, File: sensitivityNote(perm)})
+		}
+		for _, name := range entityDiff.UnmarkedSensitive {
+			var was string
+			if old := findPermission(dbModel.Entities[entity], name); old != nil {
+				was = sensitivityNote(*old)
+			}
+			changes = append(changes, SchemaChange{Kind: "sensitivity", Name: entity + "." + name,
+				Status: DriftChanged, Database: was})
+		}
+	}
+	for _, rule := range diff.AddedRules {
+		changes = append(changes, SchemaChange{Kind: "rule", Name: rule.Name, Status: DriftFileOnly, File: rule.Expression})
+	}
+	for _, name := range diff.RemovedRules {
+		changes = append(changes, SchemaChange{Kind: "rule", Name: name, Status: DriftDatabaseOnly,
+			Database: dbModel.Rules[name].Expression})
+	}
+	for name, ruleDiff := range diff.ModifiedRules {
+		changes = append(changes, SchemaChange{Kind: "rule", Name: name, Status: DriftChanged,
+			Database: ruleDiff.OldExpression, File: ruleDiff.NewExpression})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// findPermission returns the entity's permission named name, or nil
+func findPermission(entity *model.Entity, name string) *model.Permission {
+	for i := range entity.Permissions {
+		if entity.Permissions[i].Name == name {
+			return &entity.Permissions[i]
+		}
+	}
+	return nil
+}
+
+// deprecationNote describes a permission's deprecation for a SchemaChange
+func deprecationNote(perm model.Permission) string {
+	if perm.DeprecationMessage == "" {
+		return "deprecated"
+	}
+	return "deprecated: " + perm.DeprecationMessage
+}
+
+// sensitivityNote describes a sensitive permission for a SchemaChange
+func sensitivityNote(perm model.Permission) string {
+	if perm.SensitiveLabel == "" {
+		return "sensitive"
+	}
+	return "sensitive: " + perm.SensitiveLabel
+}
+
+// loadDatabaseModel reads the permissions and rules in the database into a
+// permission model, the way the migrator's LoadCurrentModel does
+func loadDatabaseModel(ctx context.Context, pool *pgxpool.Pool) (*model.PermissionModel, error) {
+	permModel := model.NewPermissionModel()
+
+	rows, err := pool.Query(ctx, `
+		SELECT entity_type, permission_name, condition_expression, deprecated, sensitive
+		FROM permission_definitions
+		ORDER BY entity_type, permission_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permission definitions: %w", err)
+	}
+	for rows.Next() {
+		var entityType, name, expr string
+		var deprecated, sensitive *string
+		if err := rows.Scan(&entityType, &name, &expr, &deprecated, &sensitive); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan permission definition: %w", err)
+		}
+		entity := permModel.GetEntity(entityType)
+		if entity == nil {
+			entity = &model.Entity{Name: entityType}
+			permModel.AddEntity(entity)
+		}
+		perm := model.Permission{Name: name, Expression: expr}
+		if deprecated != nil {
+			perm.Deprecated, perm.DeprecationMessage = true, *deprecated
+		}
+		if sensitive != nil {
+			perm.Sensitive, perm.SensitiveLabel = true, *sensitive
+		}
+		entity.Permissions = append(entity.Permissions, perm)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read permission definitions: %w", err)
+	}
+
+	rows, err = pool.Query(ctx, `SELECT rule_name, parameters, expression FROM rule_definitions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule definitions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, expr string
+		var parametersJSON []byte
+		if err := rows.Scan(&name, &parametersJSON, &expr); err != nil {
+			return nil, fmt.Errorf("failed to scan rule definition: %w", err)
+		}
+		var params []ParameterDefinition
+		if err := json.Unmarshal(parametersJSON, &params); err != nil {
+			return nil, fmt.Errorf("failed to parse parameters of rule %s: %w", name, err)
+		}
+		rule := &model.Rule{Name: name, Expression: expr}
+		for _, param := range params {
+			rule.Parameters = append(rule.Parameters, model.RuleParameter{
+				Name:     param.Name,
+				DataType: model.AttributeDataType(param.DataType),
+			})
+		}
+		permModel.AddRule(rule)
+	}
+	return permModel, rows.Err()
+}
+
+// addSchemaDriftEndpoints adds /api/schema/drift, comparing the schema file
+// loaded at startup with the database now
+func (s *AuthzService) addSchemaDriftEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/schema/drift", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		path, fileModel, loadedAt := s.schema.get()
+		if fileModel == nil {
+			standardErrorResponse(w, "schema_not_loaded", "No schema file loaded",
+				"This replica did not load a schema file at startup", http.StatusNotFound)
+			return
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+		defer cancel()
+
+		dbModel, err := loadDatabaseModel(ctx, s.graph.Pool)
+		if err != nil {
+			log.Printf("Error loading the permission model: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to load the permission model", err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		changes := schemaChanges(dbModel, fileModel)
+		jsonResponse(w, SchemaDriftResponse{
+			SchemaPath: path,
+			LoadedAt:   loadedAt,
+			CheckedAt:  time.Now().UTC(),
+			InSync:     len(changes) == 0,
+			Changes:    changes,
+		}, http.StatusOK)
+	})
+}
@@ -0,0 +1,76 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/permissions/parser"
+)
+
+func TestSchemaChanges(t *testing.T) {
+	db := model.NewPermissionModel()
+	db.AddEntity(&model.Entity{Name: "document", Permissions: []model.Permission{
+		{Name: "view", Expression: "owner"},
+		{Name: "edit", Expression: "owner"},
+		{Name: "read", Expression: "viewer", Deprecated: true},
+		{Name: "purge", Expression: "owner", Sensitive: true},
+	}})
+	db.AddEntity(&model.Entity{Name: "folder", Permissions: []model.Permission{
+		{Name: "view", Expression: "owner"},
+	}})
+	db.AddRule(&model.Rule{Name: "within_limit", Expression: "amount < limit"})
+	db.AddRule(&model.Rule{Name: "retired", Expression: "true"})
+
+	p := parser.NewParser(parser.NewLexer(`entity user {}
+
+entity document {
+    relation owner @user
+    relation viewer @user
+    permission view = owner or viewer
+    permission read = viewer
+    @deprecated("use view")
+    permission edit = owner
+    @sensitive("break-glass")
+    permission purge = owner
+}
+
+entity team {
+    relation member @user
+    permission join = member
+}
+
+rule within_limit(amount integer, limit integer) {
+    amount <= limit
+}`))
+	file := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	assert.Equal(t, []SchemaChange{
+		{Kind: "deprecation", Name: "document.edit", Status: DriftChanged, File: "deprecated: use view"},
+		{Kind: "deprecation", Name: "document.read", Status: DriftChanged, Database: "deprecated"},
+		{Kind: "entity", Name: "folder", Status: DriftDatabaseOnly, Database: "1 permission(s)"},
+		{Kind: "entity", Name: "team", Status: DriftFileOnly, File: "1 permission(s)"},
+		{Kind: "permission", Name: "document.view", Status: DriftChanged, Database: "owner", File: "owner or viewer"},
+		{Kind: "rule", Name: "retired", Status: DriftDatabaseOnly, Database: "true"},
+		{Kind: "rule", Name: "within_limit", Status: DriftChanged, Database: "amount < limit", File: "amount <= limit"},
+		{Kind: "sensitivity", Name: "document.purge", Status: DriftChanged, Database: "sensitive", File: "sensitive: break-glass"},
+	}, schemaChanges(db, file))
+
+	assert.Empty(t, schemaChanges(db, db))
+}
+
+func TestSchemaDriftNotLoaded(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addSchemaDriftEndpoints(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/schema/drift", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "schema_not_loaded")
+}
@@ -0,0 +1,63 @@
+package authzserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+const (
+	defaultSchemaVersionList = 20
+	maxSchemaVersionList     = 500
+)
+
+// SchemaVersionsResponse lists the recorded schema versions, newest first.
+// Current is the version unpinned checks evaluate against.
+type SchemaVersionsResponse struct {
+	Current  int                   `json:"current"`
+	Versions []graph.SchemaVersion `json:"versions"`
+}
+
+// addSchemaVersionEndpoints adds /api/schema/versions, which clients read
+// to pin a burst of checks to one schema version
+func (s *AuthzService) addSchemaVersionEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/schema/versions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := defaultSchemaVersionList
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxSchemaVersionList {
+				standardErrorResponse(w, "invalid_request", "Invalid limit",
+					fmt.Sprintf("limit must be between 1 and %d", maxSchemaVersionList), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+		defer cancel()
+
+		current, err := s.graph.CurrentSchemaVersion(ctx)
+		if err != nil {
+			log.Printf("Error getting schema version: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to get schema version", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		versions, err := s.graph.SchemaVersions(ctx, limit)
+		if err != nil {
+			log.Printf("Error listing schema versions: %v", err)
+			standardErrorResponse(w, "internal_error", "Failed to list schema versions", err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, SchemaVersionsResponse{Current: current, Versions: versions}, http.StatusOK)
+	})
+}
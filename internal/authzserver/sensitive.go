@@ -0,0 +1,85 @@
+package authzserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/notify"
+	"github.com/dangerclosesec/supra/internal/secrets"
+)
+
+// SetSensitiveNotifier sends an event to notifier for every check that
+// allows a permission the schema marks @sensitive
+func (s *AuthzService) SetSensitiveNotifier(notifier *notify.Notifier) {
+	s.sensitive = notifier
+}
+
+// newSensitiveNotifier delivers sensitive permission events to the
+// configured webhook and log. The webhook secret is read per delivery, so
+// rotating it needs no restart.
+func newSensitiveNotifier(cfg *config.Config, secretManager *secrets.Manager) (*notify.Notifier, error) {
+	var sinks []notify.Sink
+	if url := cfg.Authz.Sensitive.WebhookURL; url != "" {
+		secret := secretManager.Get(config.SecretSensitiveWebhook)
+		webhook, err := notify.NewWebhook(url, func() string {
+			if secret == nil {
+				return cfg.Authz.Sensitive.Secret
+			}
+			return secret.Value()
+		}, cfg.Authz.Sensitive.Timeout.Std())
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure sensitive permission webhook: %w", err)
+		}
+		sinks = append(sinks, webhook)
+	}
+	if path := cfg.Authz.Sensitive.LogPath; path != "" {
+		sink, err := notify.NewLog(path)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return notify.New(sinks, notify.Options{QueueSize: cfg.Authz.Sensitive.QueueSize}), nil
+}
+
+// notifySensitive queues the event for a check that allowed a sensitive
+// permission, labelled with the schema's annotation
+func (s *AuthzService) notifySensitive(r *http.Request, req CheckPermissionRequest, label, reason, tenant string, contextData map[string]interface{}) {
+	if s.sensitive == nil {
+		return
+	}
+	if s.auditLogger != nil {
+		contextData = s.auditLogger.scrub(contextData)
+	}
+	key, _ := apiKeyFromContext(r.Context())
+	s.sensitive.Notify(notify.Event{
+		Label:         label,
+		SubjectType:   req.SubjectType,
+		SubjectID:     req.SubjectID,
+		Permission:    req.Permission,
+		ObjectType:    req.ObjectType,
+		ObjectID:      req.ObjectID,
+		Reason:        reason,
+		Context:       contextData,
+		SchemaVersion: req.SchemaVersion,
+		Tenant:        tenant,
+		RequestID:     r.Header.Get("X-Request-ID"),
+		ClientIP:      s.clientIPs.Resolve(r),
+		UserAgent:     r.UserAgent(),
+		APIKey:        key.Name,
+	})
+}
+
+// writeSensitiveMetrics writes sensitive permission event deliveries in the
+// Prometheus text exposition format
+func writeSensitiveMetrics(w http.ResponseWriter, stats notify.Stats) {
+	var b strings.Builder
+	b.WriteString("# HELP supra_authz_sensitive_notifications_total Sensitive permission events by delivery result.\n")
+	b.WriteString("# TYPE supra_authz_sensitive_notifications_total counter\n")
+	fmt.Fprintf(&b, "supra_authz_sensitive_notifications_total{result=\"sent\"} %d\n", stats.Sent)
+	fmt.Fprintf(&b, "supra_authz_sensitive_notifications_total{result=\"failed\"} %d\n", stats.Failed)
+	fmt.Fprintf(&b, "supra_authz_sensitive_notifications_total{result=\"dropped\"} %d\n", stats.Dropped)
+	w.Write([]byte(b.String()))
+}
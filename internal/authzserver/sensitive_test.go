@@ -0,0 +1,75 @@
+package authzserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (r *recordedEvents) Send(_ context.Context, e notify.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestNotifySensitive(t *testing.T) {
+	sink := &recordedEvents{}
+	notifier := notify.New([]notify.Sink{sink}, notify.Options{Workers: 1})
+	s := &AuthzService{auditLogger: &AuthzAuditLogger{opts: AuditLoggerOptions{RedactKeys: []string{"request.token"}}}}
+	s.SetSensitiveNotifier(notifier)
+
+	req := httptest.NewRequest(http.MethodPost, "/check", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	req.Header.Set("User-Agent", "oncall-cli/1.0")
+	req = req.WithContext(withAPIKey(req.Context(), apiKeyIdentity{Name: "oncall", Scope: config.ScopeRead}))
+
+	s.notifySensitive(req, CheckPermissionRequest{
+		SubjectType: "user", SubjectID: "alice",
+		Permission: "emergency_access",
+		ObjectType: "account", ObjectID: "acme",
+	}, "break-glass", "relation", "acme", map[string]interface{}{
+		"request": map[string]interface{}{"token": "t0ps3cret", "ticket": "INC-7"},
+	})
+	require.NoError(t, notifier.Close(context.Background()))
+
+	require.Len(t, sink.events, 1)
+	e := sink.events[0]
+	assert.Equal(t, notify.EventSensitiveAllowed, e.Type)
+	assert.Equal(t, "break-glass", e.Label)
+	assert.Equal(t, "alice", e.SubjectID)
+	assert.Equal(t, "emergency_access", e.Permission)
+	assert.Equal(t, "acme", e.Tenant)
+	assert.Equal(t, "req-42", e.RequestID)
+	assert.Equal(t, "oncall-cli/1.0", e.UserAgent)
+	assert.Equal(t, "oncall", e.APIKey)
+	assert.NotEmpty(t, e.ClientIP)
+	request := e.Context["request"].(map[string]interface{})
+	assert.Equal(t, "INC-7", request["ticket"])
+	assert.NotEqual(t, "t0ps3cret", request["token"], "context should be scrubbed like the audit log")
+
+	// Without a notifier nothing is sent
+	(&AuthzService{}).notifySensitive(req, CheckPermissionRequest{}, "", "", "", nil)
+}
+
+func TestWriteSensitiveMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeSensitiveMetrics(rec, notify.Stats{Sent: 3, Failed: 1})
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE supra_authz_sensitive_notifications_total counter\n")
+	assert.Contains(t, body, `supra_authz_sensitive_notifications_total{result="sent"} 3`)
+	assert.Contains(t, body, `supra_authz_sensitive_notifications_total{result="failed"} 1`)
+}
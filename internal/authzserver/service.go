@@ -0,0 +1,1874 @@
+// Package authzserver implements the authorization service: permission checks,
+// graph management, schema and audit endpoints backed by the identity graph.
+package authzserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/internal/chaos"
+	"github.com/dangerclosesec/supra/internal/clientip"
+	"github.com/dangerclosesec/supra/internal/cluster"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/dangerclosesec/supra/internal/decisionlog"
+	"github.com/dangerclosesec/supra/internal/jobs"
+	"github.com/dangerclosesec/supra/internal/lifecycle"
+	"github.com/dangerclosesec/supra/internal/migrate"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/notify"
+	"github.com/dangerclosesec/supra/internal/secrets"
+	"github.com/dangerclosesec/supra/internal/shadow"
+	"github.com/dangerclosesec/supra/internal/tracing"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// AuthzService provides HTTP endpoints for authorization decisions
+type AuthzService struct {
+	graph       *graph.IdentityGraph
+	addr        string
+	auditLogger *AuthzAuditLogger
+	adminToken  func() string
+	cluster     *cluster.Cluster
+	usage       *usageMeter
+	chaos       *chaos.Injector
+	decisions   *decisionlog.Streamer
+	shadow      *shadow.Shadower
+	sensitive   *notify.Notifier
+	jobs        *jobs.Manager
+	warming     warmLimiter
+	mode        serviceMode
+
+	auditSigningKey    ed25519.PrivateKey
+	enforceAdminScopes bool
+	// clientIPs resolves callers' addresses behind trusted proxies
+	clientIPs *clientip.Resolver
+	// deprecations counts checks of permissions the schema deprecates
+	deprecations *deprecationMeter
+	// hooks run before and after every check
+	hooks []namedCheckHook
+	// queries counts database queries by the route or job that ran them
+	queries *dbtrace.Recorder
+	// budgets bound requests and the steps of their checks
+	budgets budget.Budgets
+	// schema is the schema file loaded at startup, compared with the
+	// database by /api/schema/drift
+	schema loadedSchema
+	// apiKeys authenticate callers while keys are enforced
+	apiKeys *apiKeyRegistry
+	// rateLimits turn away callers making requests too fast; they are
+	// replaced when the configuration is reloaded
+	rateLimits atomic.Pointer[rateLimiter]
+	// drain fails the health check once shutdown begins
+	drain lifecycle.Drainer
+	// metrics times requests, calls and checks for /metrics
+	metrics serviceMetrics
+}
+
+// NewAuthzService creates a new authorization service
+func NewAuthzService(poolConfig *pgxpool.Config, addr string, auditOpts AuditLoggerOptions) (*AuthzService, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Initializes the identity graph
+	graph, err := graph.NewIdentityGraphWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identity graph: %w", err)
+	}
+
+	// Initialize the audit logger
+	auditLogger := NewAuthzAuditLoggerWithOptions(graph.Pool, auditOpts)
+
+	return &AuthzService{
+		graph:        graph,
+		addr:         addr,
+		auditLogger:  auditLogger,
+		usage:        newUsageMeter(),
+		deprecations: newDeprecationMeter(),
+		clientIPs:    auditOpts.ClientIPs,
+		hooks:        checkHooks(),
+		budgets:      budget.Defaults(),
+	}, nil
+}
+
+// VisualizeConditionRequest parses a condition and, with Check, decides it
+type VisualizeConditionRequest struct {
+	Condition string                   `json:"condition"`
+	Check     *VisualizeConditionCheck `json:"check,omitempty"`
+}
+
+// VisualizeConditionCheck is the subject, object and context a visualized
+// condition is decided for
+type VisualizeConditionCheck struct {
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+}
+
+// VisualizeConditionResponse is a parsed condition as a string and as a
+// tree of nodes with their source spans. With a check, each node has its
+// decision and Decision is the condition's.
+type VisualizeConditionResponse struct {
+	ParsedExpression string               `json:"parsed_expression"`
+	AST              *graph.ConditionNode `json:"ast"`
+	Decision         *graph.Decision      `json:"decision,omitempty"`
+}
+
+// Add a new testing endpoint to visualize permission condition expressions
+func (s *AuthzService) addPermissionVisualizer(mux *http.ServeMux) {
+	mux.HandleFunc("/visualize-condition", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Parse the condition expression from the request
+		var req VisualizeConditionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+
+		if req.Condition == "" {
+			http.Error(w, "Condition is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the condition into a tree the dashboard can render
+		tree, err := graph.ParseConditionTree(req.Condition)
+		if err != nil {
+			jsonResponse(w, map[string]string{
+				"error": fmt.Sprintf("Failed to parse condition: %v", err),
+			}, http.StatusBadRequest)
+			return
+		}
+
+		// With a check, decide every node so the branch that granted or
+		// denied access can be highlighted
+		if c := req.Check; c != nil {
+			if c.SubjectType == "" || c.SubjectID == "" || c.ObjectType == "" || c.ObjectID == "" {
+				http.Error(w, "check needs subject_type, subject_id, object_type and object_id", http.StatusBadRequest)
+				return
+			}
+			ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+			defer cancel()
+
+			tree, err = s.graph.ExplainCondition(ctx, req.Condition,
+				c.SubjectType, c.SubjectID, c.ObjectType, c.ObjectID, c.Context)
+			if err != nil {
+				jsonResponse(w, map[string]string{
+					"error": fmt.Sprintf("Failed to evaluate condition: %v", err),
+				}, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		jsonResponse(w, VisualizeConditionResponse{
+			ParsedExpression: tree.Text,
+			AST:              tree,
+			Decision:         tree.Decision,
+		}, http.StatusOK)
+	})
+
+	// Add an endpoint to test relations directly
+	mux.HandleFunc("/test-relation", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			SubjectType string `json:"subject_type"`
+			SubjectID   string `json:"subject_id"`
+			Relation    string `json:"relation"`
+			ObjectType  string `json:"object_type"`
+			ObjectID    string `json:"object_id"`
+			Direction   string `json:"direction"` // "normal", "reverse", or "both"
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		var result struct {
+			NormalDirection  bool `json:"normal_direction"`
+			ReverseDirection bool `json:"reverse_direction"`
+			HasRelation      bool `json:"has_relation"`
+		}
+
+		// Test normal direction (subject -> relation -> object)
+		var exists bool
+		if req.Direction == "normal" || req.Direction == "both" || req.Direction == "" {
+			err := s.graph.Pool.QueryRow(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM relations 
+					WHERE subject_type = $1 AND subject_id = $2 
+					AND relation = $3 
+					AND object_type = $4 AND object_id = $5
+				)
+			`, req.SubjectType, req.SubjectID, req.Relation, req.ObjectType, req.ObjectID).Scan(&exists)
+
+			if err != nil {
+				jsonResponse(w, map[string]string{
+					"error": fmt.Sprintf("Database error: %v", err),
+				}, http.StatusInternalServerError)
+				return
+			}
+
+			result.NormalDirection = exists
+		}
+
+		// Test reverse direction (object -> relation -> subject)
+		if req.Direction == "reverse" || req.Direction == "both" || req.Direction == "" {
+			err := s.graph.Pool.QueryRow(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM relations 
+					WHERE subject_type = $1 AND subject_id = $2 
+					AND relation = $3 
+					AND object_type = $4 AND object_id = $5
+				)
+			`, req.ObjectType, req.ObjectID, req.Relation, req.SubjectType, req.SubjectID).Scan(&exists)
+
+			if err != nil {
+				jsonResponse(w, map[string]string{
+					"error": fmt.Sprintf("Database error: %v", err),
+				}, http.StatusInternalServerError)
+				return
+			}
+
+			result.ReverseDirection = exists
+		}
+
+		result.HasRelation = result.NormalDirection || result.ReverseDirection
+		jsonResponse(w, result, http.StatusOK)
+	})
+}
+
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Allow requests from the Next.js frontend
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+apiKeyHeader+", If-None-Match, If-Modified-Since, X-Request-Timeout")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified")
+
+		// Handle preflight requests
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Update the Start method to include the visualization endpoint
+func (s *AuthzService) Start() error {
+	log.Printf("Starting authorization service on %s", s.addr)
+	return http.ListenAndServe(s.addr, s.Handler())
+}
+
+// Handler returns the service's HTTP routes wrapped in its middleware
+func (s *AuthzService) Handler() http.Handler {
+	// Define routes
+	mux := http.NewServeMux()
+
+	// Existing endpoints
+	mux.HandleFunc("/check", s.checkPermissionHandler)
+	mux.HandleFunc("/check/batch", s.checkBatchHandler)
+	mux.HandleFunc("/entity", s.entityHandler)
+	mux.HandleFunc("/entity/attributes/history", s.attributeHistoryHandler)
+	mux.HandleFunc("/entities/batch", s.entityBatchHandler)
+	mux.HandleFunc("/attribute", s.attributeHandler)
+	mux.HandleFunc("/relation", s.relationHandler)
+	mux.HandleFunc("/api/relation", s.relationHandler)
+	mux.HandleFunc("/relations/batch", s.relationBatchHandler)
+	mux.HandleFunc("/permission", s.permissionHandler)
+	mux.HandleFunc("/health", s.healthHandler)
+	mux.Handle("/version", lifecycle.VersionHandler("authz", s.versions))
+
+	// Add check pre-warming for clients about to make a burst of checks
+	s.addWarmEndpoints(mux)
+	s.addLookupEndpoints(mux)
+	s.addExpandEndpoints(mux)
+
+	s.addSchemaExplorerEndpoints(mux)
+	s.addSchemaDriftEndpoints(mux)
+	s.addSchemaVersionEndpoints(mux)
+	s.addSchemaContextEndpoints(mux)
+
+	// Add rule management endpoints
+	s.addRuleEndpoints(mux)
+	s.addTenantRuleEndpoints(mux)
+
+	// Add testing endpoints
+	s.addPermissionVisualizer(mux)
+
+	// Add graph visualization endpoints
+	s.addGraphVisualizationEndpoint(mux)
+
+	// Add permission path
+	s.addPermissionPathEndpoint(mux)
+
+	// Add health check endpoints
+	s.addHealthCheckEndpoints(mux)
+
+	//
+	s.addAuditLogEndpoints(mux)
+	s.addAuditChainEndpoints(mux)
+
+	// Add cluster membership endpoints
+	s.addClusterEndpoints(mux)
+
+	// Add usage metering endpoints
+	s.addUsageEndpoints(mux)
+
+	// Add fault injection controls for chaos testing
+	s.addChaosEndpoints(mux)
+
+	// Add the read-only and maintenance mode switch
+	s.addModeEndpoints(mux)
+
+	// Add evaluator flag rollouts and their comparison
+	s.addFlagEndpoints(mux)
+
+	// Add shadow check comparisons
+	s.addShadowEndpoints(mux)
+
+	// Add background job submission and status
+	s.addJobEndpoints(mux)
+
+	// Add relation source listing and revocation
+	s.addRelationSourceEndpoints(mux)
+
+	// Add API key issuing and revocation
+	s.addAPIKeyEndpoints(mux)
+
+	// Add the REST gateway generated from the gRPC API
+	s.addGatewayEndpoints(mux)
+
+	// Serve the embedded dashboard
+	s.addDashboardEndpoints(mux)
+
+	// Wrap with query labeling, tracing, latency metrics, logging, failed
+	// authentication limiting, API key and admin authentication, rate
+	// limiting, mode and CORS middleware
+	return corsMiddleware(queryLabels(mux, tracing.Handler(s.requestMetrics(requestBudget(logMiddleware(s.authFailureLimit(s.apiKeyAuth(s.rateLimit(s.adminAuth(s.modeGuard(mux)))))))), traceRoute)))
+}
+
+// healthHandler reports whether this replica can reach its database, for
+// load balancers and the SDK's health probes
+func (s *AuthzService) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// A replica in maintenance or shutting down is taken out of rotation
+	mode := s.mode.get().Mode
+	if s.drain.Draining() {
+		jsonResponse(w, map[string]string{"status": "draining", "mode": mode}, http.StatusServiceUnavailable)
+		return
+	}
+	if mode == ModeMaintenance {
+		jsonResponse(w, map[string]string{"status": "maintenance", "mode": mode}, http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	if err := s.graph.Pool.Ping(ctx); err != nil {
+		log.Printf("Health check failed: %v", err)
+		jsonResponse(w, map[string]string{"status": "unhealthy", "mode": mode}, http.StatusServiceUnavailable)
+		return
+	}
+	jsonResponse(w, map[string]string{"status": "healthy", "mode": mode}, http.StatusOK)
+}
+
+// versions reads the migration and permission model versions for /version
+func (s *AuthzService) versions(ctx context.Context, info *lifecycle.Info) error {
+	if s.graph == nil {
+		return nil
+	}
+	schema, err := s.graph.CurrentSchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	info.SchemaVersion = int64(schema)
+
+	// Closing db leaves the pool open
+	db := stdlib.OpenDBFromPool(s.graph.Pool)
+	defer db.Close()
+	info.DatabaseVersion, err = migrate.CurrentVersion(ctx, db, migrate.TargetAuthz)
+	return err
+}
+
+// CheckPermissionRequest represents an access check request
+type CheckPermissionRequest struct {
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Permission  string                 `json:"permission"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	// AsOf evaluates entity attributes as they were at this time
+	AsOf *time.Time `json:"as_of,omitempty"`
+	// SchemaVersion evaluates the permission and the rules it calls as
+	// they were in this schema version, rather than the latest
+	SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+// CheckPermissionResponse is the result of a permission check
+type CheckPermissionResponse struct {
+	Allowed bool `json:"allowed"`
+	// Reason is a stable code explaining the decision, such as
+	// matched_relation, matched_rule:isOwner or denied_no_path
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Update the CheckPermission method to use the new parser
+func (s *AuthzService) checkPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	// Only allows POST requests
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parses the JSON request
+	var req CheckPermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, CheckPermissionResponse{
+			Allowed: false,
+			Error:   "Invalid request format",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	// Validates the required fields
+	if req.SubjectType == "" || req.SubjectID == "" || req.Permission == "" ||
+		req.ObjectType == "" || req.ObjectID == "" {
+		jsonResponse(w, CheckPermissionResponse{
+			Allowed: false,
+			Error:   "Missing required fields",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	// Add debugging log
+	log.Printf("Checking permission: %s has %s on %s:%s",
+		fmt.Sprintf("%s:%s", req.SubjectType, req.SubjectID),
+		req.Permission,
+		req.ObjectType, req.ObjectID)
+
+	// Performs the permission check
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	decision, err := s.decide(ctx, r, req)
+	if errors.Is(err, graph.ErrSchemaVersionNotFound) {
+		jsonResponse(w, CheckPermissionResponse{
+			Allowed: false,
+			Error:   fmt.Sprintf("Schema version not found: %d", req.SchemaVersion),
+		}, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errPermissionNotDefined) {
+		log.Printf("Error retrieving permission definition: %v", err)
+		jsonResponse(w, CheckPermissionResponse{
+			Allowed: false,
+			Reason:  graph.ReasonUnknownPermission,
+			Error:   fmt.Sprintf("Permission definition not found: %s.%s", req.ObjectType, req.Permission),
+		}, http.StatusNotFound)
+		return
+	}
+	if budgetExceeded(err) {
+		log.Printf("Permission check ran out of time: %v", err)
+		jsonResponse(w, CheckPermissionResponse{
+			Allowed: false,
+			Error:   err.Error(),
+		}, http.StatusGatewayTimeout)
+		return
+	}
+	if err != nil {
+		log.Printf("Error evaluating permission: %v", err)
+		jsonResponse(w, CheckPermissionResponse{
+			Allowed: false,
+			Error:   err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	if decision.Deprecated != nil {
+		setDeprecationHeaders(w, deprecationWarning(req.ObjectType, req.Permission, *decision.Deprecated))
+	}
+
+	// Returns the result
+	jsonResponse(w, CheckPermissionResponse{
+		Allowed: decision.Allowed,
+		Reason:  decision.Reason,
+	}, http.StatusOK)
+}
+
+// errPermissionNotDefined means the object's type has no such permission
+var errPermissionNotDefined = graph.ErrPermissionNotDefined
+
+// permissionCondition returns the condition of a permission, or an error
+// wrapping errPermissionNotDefined when the object type doesn't define it
+func (s *AuthzService) permissionCondition(ctx context.Context, objectType, permission string) (string, error) {
+	def, err := s.permissionDefinition(ctx, objectType, permission)
+	return def.Condition, err
+}
+
+// permissionDefinition returns the condition of a permission and whether
+// the schema deprecates it or marks it sensitive
+func (s *AuthzService) permissionDefinition(ctx context.Context, objectType, permission string) (graph.ResolvedPermission, error) {
+	return s.graph.ResolvePermission(ctx, objectType, permission)
+}
+
+// checkDecision is a check's decision, noting when the permission checked
+// is deprecated
+type checkDecision struct {
+	graph.Decision
+	// Deprecated is the deprecation message of a deprecated permission,
+	// empty when the schema gave none, and nil otherwise
+	Deprecated *string
+}
+
+// decide runs a permission check for the HTTP and gRPC APIs alike, metering,
+// streaming and auditing it. r supplies the caller's request ID, address and
+// tenant header.
+func (s *AuthzService) decide(ctx context.Context, r *http.Request, req CheckPermissionRequest) (result checkDecision, err error) {
+	ctx, span := tracing.Start(ctx, "authz.Check",
+		attribute.String("permission", req.Permission), attribute.String("object_type", req.ObjectType))
+	start := time.Now()
+	defer func() {
+		s.observeCheck(time.Since(start), result.Allowed, err)
+		span.SetAttributes(attribute.Bool("allowed", result.Allowed))
+		tracing.End(span, err)
+	}()
+	if req.AsOf != nil {
+		ctx = graph.WithAsOf(ctx, *req.AsOf)
+	}
+	if req.SchemaVersion != 0 {
+		ctx = graph.WithSchemaVersion(ctx, req.SchemaVersion)
+	}
+
+	// Hooks may enrich the check, or decide it without evaluating it
+	hookDecision, err := s.beforeCheck(ctx, &req)
+	if err != nil {
+		return checkDecision{}, err
+	}
+
+	// Prepare context for evaluation - if none provided, use empty map
+	contextData := req.Context
+	if contextData == nil {
+		contextData = make(map[string]interface{})
+	}
+
+	// Add request context for backward compatibility
+	if _, hasRequestCtx := contextData["request"]; !hasRequestCtx {
+		contextData["request"] = make(map[string]interface{})
+	}
+
+	if hookDecision == nil {
+		// Hooks may have spent the budget; evaluation checks it again
+		// before each step
+		if err := budget.Check(ctx); err != nil {
+			return checkDecision{}, err
+		}
+	}
+
+	// Get the permission definition even when a hook decided, so a
+	// sensitive permission a hook allows is still notified and audited.
+	// Hooks may decide permissions the schema doesn't define.
+	def, err := s.permissionDefinition(ctx, req.ObjectType, req.Permission)
+	if err != nil && (hookDecision == nil || !errors.Is(err, graph.ErrPermissionNotDefined)) {
+		return checkDecision{}, err
+	}
+	deprecated, sensitive := def.Deprecated, def.Sensitive
+
+	var decision graph.Decision
+	if hookDecision != nil {
+		decision = *hookDecision
+	} else {
+		log.Printf("Permission condition: %s", def.Condition)
+
+		// Use the condition parser and evaluator with context
+		decision, err = s.graph.DecideCondition(ctx, def.Condition,
+			req.SubjectType, req.SubjectID, req.ObjectType, req.ObjectID, contextData)
+		if err != nil {
+			return checkDecision{}, err
+		}
+	}
+
+	if decision, err = s.afterCheck(ctx, req, decision); err != nil {
+		return checkDecision{}, err
+	}
+	allowed := decision.Allowed
+
+	log.Printf("Permission check result: %v (%s)", allowed, decision.Reason)
+
+	tenant := usageTenant(r, req.ObjectType, req.ObjectID, nil)
+	s.usage.recordCheck(usageKey{Tenant: tenant, EntityType: req.ObjectType}, allowed)
+
+	s.decisions.Record(decisionlog.Decision{
+		Time:        start,
+		Tenant:      tenant,
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectID,
+		Permission:  req.Permission,
+		ObjectType:  req.ObjectType,
+		ObjectID:    req.ObjectID,
+		Allowed:     allowed,
+		Reason:      decision.Reason,
+		Duration:    time.Since(start),
+		RequestID:   r.Header.Get("X-Request-ID"),
+		ClientIP:    s.clientIPs.Resolve(r),
+	})
+
+	s.shadow.Compare(shadow.Check{
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectID,
+		Permission:  req.Permission,
+		ObjectType:  req.ObjectType,
+		ObjectID:    req.ObjectID,
+		Context:     req.Context,
+	}, allowed)
+
+	// Log the permission check
+	modelSubject := model.Subject{Type: req.SubjectType, ID: req.SubjectID}
+	modelObject := model.Entity{Type: req.ObjectType, ID: req.ObjectID}
+
+	// Queue the audit entry; it is written in the background. Checks of
+	// deprecated permissions skip sampling so every remaining caller shows,
+	// as do allowed checks of sensitive ones so each notification sent has
+	// a durable record behind it.
+	logCheck := s.auditLogger.LogPermissionCheck
+	if sensitive != nil && allowed {
+		log.Printf("Sensitive permission %s.%s allowed for %s:%s", req.ObjectType, req.Permission, req.SubjectType, req.SubjectID)
+		s.notifySensitive(r, req, *sensitive, decision.Reason, tenant, contextData)
+		logCheck = s.auditLogger.LogSensitivePermissionCheck
+	}
+	if deprecated != nil {
+		log.Printf("Deprecated permission checked: %s", deprecationWarning(req.ObjectType, req.Permission, *deprecated))
+		s.deprecations.record(deprecationKey{EntityType: req.ObjectType, Permission: req.Permission})
+		logCheck = s.auditLogger.LogDeprecatedPermissionCheck
+	}
+	if err := logCheck(
+		r.Context(),
+		modelSubject,
+		req.Permission,
+		modelObject,
+		allowed,
+		&contextData,
+		r,
+	); err != nil {
+		log.Printf("Failed to log permission check: %v", err)
+	}
+
+	return checkDecision{Decision: decision, Deprecated: deprecated}, nil
+}
+
+// EntityRequest for creating entities
+type EntityRequest struct {
+	Type       string                 `json:"type"`
+	ExternalID string                 `json:"external_id"`
+	Properties map[string]interface{} `json:"properties"`
+	// Upsert is the same as the upsert=true query parameter
+	Upsert bool `json:"upsert,omitempty"`
+}
+
+// EntityResponse after entity operations
+type EntityResponse struct {
+	ID         int64                  `json:"id"`
+	Type       string                 `json:"type"`
+	ExternalID string                 `json:"external_id"`
+	Properties map[string]interface{} `json:"properties"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+	// Status is created, or updated when an upsert replaced the
+	// properties of an existing entity
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Write statuses reported by POST /entity and /relation
+const (
+	writeCreated  = "created"
+	writeUpdated  = "updated"
+	writeExisting = "existing"
+)
+
+// entityHandler manages entity creation and retrieval. POST with
+// upsert=true replaces the properties of an existing entity instead of
+// failing with entity_already_exists.
+func (s *AuthzService) entityHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		// Creates a new entity
+		upsert, ok := upsertParam(w, r)
+		if !ok {
+			return
+		}
+
+		var req EntityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			standardErrorResponse(
+				w,
+				"invalid_request",
+				"Invalid request format",
+				err.Error(),
+				http.StatusBadRequest,
+			)
+			return
+		}
+
+		if req.Type == "" || req.ExternalID == "" {
+			standardErrorResponse(
+				w,
+				"missing_fields",
+				"Required fields missing",
+				"Type and external_id are required fields",
+				http.StatusBadRequest,
+			)
+			return
+		}
+
+		properties := req.Properties
+		if properties == nil {
+			properties = map[string]interface{}{}
+		}
+		if !s.authorizeAdmin(w, r, &adminTarget{Type: req.Type, ID: req.ExternalID, Properties: properties}) {
+			return
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+		defer cancel()
+
+		var entity *graph.Entity
+		var err error
+		created := true
+		if upsert || req.Upsert {
+			entity, created, err = s.upsertEntity(ctx, r, req)
+		} else {
+			entity, err = s.createEntity(ctx, r, req)
+		}
+		if errors.Is(err, errEntityExists) {
+			standardErrorResponse(
+				w,
+				"entity_already_exists",
+				"Entity already exists",
+				fmt.Sprintf("Entity with type '%s' and ID '%s' already exists", req.Type, req.ExternalID),
+				http.StatusConflict,
+			)
+			return
+		}
+		if err != nil {
+			log.Printf("Error creating entity: %v", err)
+			standardErrorResponse(
+				w,
+				"internal_error",
+				"Failed to create entity",
+				err.Error(),
+				http.StatusInternalServerError,
+			)
+			return
+		}
+
+		resp := EntityResponse{
+			ID:         entity.ID,
+			Type:       entity.Type,
+			ExternalID: entity.ExternalID,
+			Properties: entity.Properties,
+			CreatedAt:  entity.CreatedAt,
+			UpdatedAt:  entity.UpdatedAt,
+			Status:     writeCreated,
+		}
+		if !created {
+			resp.Status = writeUpdated
+			jsonResponse(w, resp, http.StatusOK)
+			return
+		}
+		jsonResponse(w, resp, http.StatusCreated)
+
+	case http.MethodGet:
+		// Retrieves an entity
+		entityType := r.URL.Query().Get("type")
+		externalID := r.URL.Query().Get("id")
+
+		if entityType == "" || externalID == "" {
+			standardErrorResponse(
+				w,
+				"missing_parameters",
+				"Missing query parameters",
+				"Type and id query parameters are required",
+				http.StatusBadRequest,
+			)
+			return
+		}
+
+		ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+		defer cancel()
+
+		entity, err := s.graph.GetEntity(ctx, entityType, externalID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				standardErrorResponse(
+					w,
+					"entity_not_found",
+					"Entity not found",
+					err.Error(),
+					http.StatusNotFound,
+				)
+			} else {
+				standardErrorResponse(
+					w,
+					"internal_error",
+					"Failed to retrieve entity",
+					err.Error(),
+					http.StatusInternalServerError,
+				)
+			}
+			return
+		}
+
+		// Lets polling clients skip unchanged entities
+		conditionalJSONResponse(w, r, EntityResponse{
+			ID:         entity.ID,
+			Type:       entity.Type,
+			ExternalID: entity.ExternalID,
+			Properties: entity.Properties,
+			CreatedAt:  entity.CreatedAt,
+			UpdatedAt:  entity.UpdatedAt,
+		}, entity.UpdatedAt, entityCacheControl)
+
+	case http.MethodDelete:
+		s.deleteEntityHandler(w, r)
+
+	default:
+		standardErrorResponse(
+			w,
+			"method_not_allowed",
+			"Method not allowed",
+			fmt.Sprintf("The %s method is not supported for this endpoint", r.Method),
+			http.StatusMethodNotAllowed,
+		)
+	}
+}
+
+// DeleteEntityResponse reports a deleted entity and the relations deleted
+// with it
+type DeleteEntityResponse struct {
+	Type             string           `json:"type"`
+	ExternalID       string           `json:"external_id"`
+	RelationsDeleted int              `json:"relations_deleted"`
+	Relations        []graph.Relation `json:"relations,omitempty"`
+}
+
+// deleteEntityHandler deletes the entity named by the type and id query
+// parameters. With cascade=true the relations it is the subject or object
+// of are deleted with it; otherwise an entity still in relations is kept.
+func (s *AuthzService) deleteEntityHandler(w http.ResponseWriter, r *http.Request) {
+	entityType := r.URL.Query().Get("type")
+	externalID := r.URL.Query().Get("id")
+	if entityType == "" || externalID == "" {
+		standardErrorResponse(w, "missing_parameters", "Missing query parameters",
+			"Type and id query parameters are required", http.StatusBadRequest)
+		return
+	}
+	var cascade bool
+	if v := r.URL.Query().Get("cascade"); v != "" {
+		var err error
+		if cascade, err = strconv.ParseBool(v); err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid cascade parameter",
+				"cascade must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !s.authorizeAdmin(w, r, &adminTarget{Type: entityType, ID: externalID}) {
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Long)
+	defer cancel()
+
+	relations, err := s.deleteEntity(ctx, r, entityType, externalID, cascade)
+	switch {
+	case errors.Is(err, graph.ErrEntityNotFound):
+		standardErrorResponse(w, "entity_not_found", "Entity not found", err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, graph.ErrEntityInUse):
+		standardErrorResponse(w, "entity_in_use", "Entity has relations",
+			err.Error()+"; delete them first or pass cascade=true", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error deleting entity: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to delete entity", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, DeleteEntityResponse{
+		Type:             entityType,
+		ExternalID:       externalID,
+		RelationsDeleted: len(relations),
+		Relations:        relations,
+	}, http.StatusOK)
+}
+
+// deleteEntity deletes an entity and, with cascade, its relations,
+// metering and auditing each deletion. Admin scopes are checked by the
+// caller.
+func (s *AuthzService) deleteEntity(ctx context.Context, r *http.Request, entityType, externalID string, cascade bool) ([]graph.Relation, error) {
+	relations, err := s.graph.DeleteEntity(ctx, entityType, externalID, cascade)
+	if err != nil {
+		return nil, err
+	}
+
+	s.usage.recordEntityWrite(usageKey{Tenant: usageTenant(r, entityType, externalID, nil), EntityType: entityType})
+	if err := s.auditLogger.LogEntityDelete(r.Context(), entityType, externalID, r); err != nil {
+		log.Printf("Failed to log entity deletion: %v", err)
+	}
+	for _, rel := range relations {
+		s.usage.recordRelationWrite(usageKey{
+			Tenant:     usageTenant(r, rel.ObjectType, rel.ObjectID, nil),
+			EntityType: rel.ObjectType,
+		})
+		if err := s.auditLogger.LogRelationDelete(
+			r.Context(),
+			model.Entity{Type: rel.ObjectType, ID: rel.ObjectID},
+			rel.Relation,
+			model.Subject{Type: rel.SubjectType, ID: rel.SubjectID},
+			r,
+		); err != nil {
+			log.Printf("Failed to log relation deletion: %v", err)
+		}
+	}
+	return relations, nil
+}
+
+// errEntityExists means an entity with the same type and external ID exists
+var errEntityExists = errors.New("entity already exists")
+
+// createEntity creates an entity for the HTTP and gRPC APIs alike, metering
+// and auditing the write. Admin scopes are checked by the caller.
+func (s *AuthzService) createEntity(ctx context.Context, r *http.Request, req EntityRequest) (*graph.Entity, error) {
+	properties := req.Properties
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+
+	// Check if entity already exists
+	if exists, _ := s.entityExists(ctx, req.Type, req.ExternalID); exists {
+		return nil, errEntityExists
+	}
+
+	entity, err := s.graph.CreateEntity(ctx, req.Type, req.ExternalID, properties)
+	if err != nil {
+		// A concurrent create can still win the race
+		if strings.Contains(err.Error(), "unique constraint") || strings.Contains(err.Error(), "duplicate key") {
+			return nil, fmt.Errorf("%w: %v", errEntityExists, err)
+		}
+		return nil, err
+	}
+
+	s.usage.recordEntityWrite(usageKey{
+		Tenant:     usageTenant(r, req.Type, req.ExternalID, properties),
+		EntityType: req.Type,
+	})
+	s.shadow.WriteEntity(shadow.Entity{Type: req.Type, ExternalID: req.ExternalID, Properties: properties})
+
+	// Queue the audit entry for the background writer
+	if err := s.auditLogger.LogEntityCreate(
+		r.Context(),
+		req.Type,
+		req.ExternalID,
+		req.Properties,
+		r,
+	); err != nil {
+		log.Printf("Failed to log entity creation: %v", err)
+	}
+
+	return entity, nil
+}
+
+// upsertEntity creates an entity or replaces the properties of the existing
+// one, metering, mirroring and auditing the write either way. Admin scopes
+// are checked by the caller.
+func (s *AuthzService) upsertEntity(ctx context.Context, r *http.Request, req EntityRequest) (*graph.Entity, bool, error) {
+	properties := req.Properties
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+
+	entity, created, err := s.graph.UpsertEntity(ctx, req.Type, req.ExternalID, properties)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.usage.recordEntityWrite(usageKey{
+		Tenant:     usageTenant(r, req.Type, req.ExternalID, properties),
+		EntityType: req.Type,
+	})
+	s.shadow.WriteEntity(shadow.Entity{Type: req.Type, ExternalID: req.ExternalID, Properties: properties})
+
+	logWrite := s.auditLogger.LogEntityUpdate
+	if created {
+		logWrite = s.auditLogger.LogEntityCreate
+	}
+	if err := logWrite(r.Context(), req.Type, req.ExternalID, req.Properties, r); err != nil {
+		log.Printf("Failed to log entity upsert: %v", err)
+	}
+
+	return entity, created, nil
+}
+
+// upsertParam reads the upsert query parameter of a POST, writing the error
+// response when it isn't a boolean
+func upsertParam(w http.ResponseWriter, r *http.Request) (upsert, ok bool) {
+	v := r.URL.Query().Get("upsert")
+	if v == "" {
+		return false, true
+	}
+	upsert, err := strconv.ParseBool(v)
+	if err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid upsert parameter",
+			"upsert must be true or false", http.StatusBadRequest)
+		return false, false
+	}
+	return upsert, true
+}
+
+// RelationRequest for creating relations
+type RelationRequest struct {
+	SubjectType string `json:"subject_type"`
+	SubjectID   string `json:"subject_id"`
+	Relation    string `json:"relation"`
+	ObjectType  string `json:"object_type"`
+	ObjectID    string `json:"object_id"`
+	// Metadata is free-form provenance for the grant, e.g. granted_by,
+	// reason, ticket_url or source
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Source names what wrote the relation, e.g. scim or import:batch-42,
+	// so its writes can be listed and revoked together. Defaults to manual.
+	Source string `json:"source,omitempty"`
+	// Upsert is the same as the upsert=true query parameter
+	Upsert bool `json:"upsert,omitempty"`
+}
+
+// RelationResponse after relation operations
+type RelationResponse struct {
+	ID          int64                  `json:"id"`
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Relation    string                 `json:"relation"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Source      string                 `json:"source"`
+	CreatedAt   time.Time              `json:"created_at"`
+	// Status is created, or existing when an upsert found the relation
+	// already stored
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DeleteRelationsResponse lists the relations a DELETE /relation removed
+type DeleteRelationsResponse struct {
+	Deleted   int              `json:"deleted"`
+	Relations []graph.Relation `json:"relations"`
+}
+
+// relationHandler manages relation listing, creation and deletion. POST
+// with upsert=true returns an existing relation instead of failing.
+func (s *AuthzService) relationHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listRelationsHandler(w, r)
+		return
+	case http.MethodPost:
+	case http.MethodDelete:
+		s.deleteRelationHandler(w, r)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upsert, ok := upsertParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req RelationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, RelationResponse{Error: "Invalid request format"}, http.StatusBadRequest)
+		return
+	}
+
+	if req.SubjectType == "" || req.SubjectID == "" || req.Relation == "" ||
+		req.ObjectType == "" || req.ObjectID == "" {
+		jsonResponse(w, RelationResponse{Error: "All fields are required"}, http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorizeAdmin(w, r, &adminTarget{
+		Type:    req.ObjectType,
+		ID:      req.ObjectID,
+		Subject: &model.Subject{Type: req.SubjectType, ID: req.SubjectID},
+	}) {
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	var relation *graph.Relation
+	var err error
+	created := true
+	if upsert || req.Upsert {
+		relation, created, err = s.upsertRelation(ctx, r, req)
+	} else {
+		relation, err = s.createRelation(ctx, r, req)
+	}
+	var limitErr *graph.CardinalityError
+	if errors.As(err, &limitErr) {
+		standardErrorResponse(w, "cardinality_exceeded", "Relation limit reached", limitErr.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, graph.ErrInvalidRelation) {
+		standardErrorResponse(w, "invalid_relation", "Relation not declared by the schema", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, graph.ErrInvalidSource) {
+		standardErrorResponse(w, "invalid_source", "Invalid relation source", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		jsonResponse(w, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	resp := RelationResponse{
+		ID:          relation.ID,
+		SubjectType: relation.SubjectType,
+		SubjectID:   relation.SubjectID,
+		Relation:    relation.Relation,
+		ObjectType:  relation.ObjectType,
+		ObjectID:    relation.ObjectID,
+		Metadata:    relation.Metadata,
+		Source:      relation.Source,
+		CreatedAt:   relation.CreatedAt,
+		Status:      writeCreated,
+	}
+	if !created {
+		resp.Status = writeExisting
+		jsonResponse(w, resp, http.StatusOK)
+		return
+	}
+	jsonResponse(w, resp, http.StatusCreated)
+}
+
+// createRelation creates a relation for the HTTP and gRPC APIs alike,
+// creating missing endpoints as stub entities and metering and auditing the
+// write. Admin scopes are checked by the caller.
+func (s *AuthzService) createRelation(ctx context.Context, r *http.Request, req RelationRequest) (*graph.Relation, error) {
+	// Checked before the endpoints are created, so a rejected relation
+	// leaves no stub entities behind
+	if err := validateRelationRequest(s.graph, req); err != nil {
+		return nil, err
+	}
+	s.createRelationEndpoints(ctx, req)
+
+	relation, err := s.graph.CreateRelation(ctx, req.SubjectType, req.SubjectID,
+		req.Relation, req.ObjectType, req.ObjectID, req.Metadata, req.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordRelationCreate(r, req, relation)
+	return relation, nil
+}
+
+// upsertRelation creates a relation unless it exists, in which case the
+// stored one is returned and nothing is metered, mirrored or audited
+func (s *AuthzService) upsertRelation(ctx context.Context, r *http.Request, req RelationRequest) (*graph.Relation, bool, error) {
+	if err := validateRelationRequest(s.graph, req); err != nil {
+		return nil, false, err
+	}
+	s.createRelationEndpoints(ctx, req)
+
+	relation, created, err := s.graph.UpsertRelation(ctx, req.SubjectType, req.SubjectID,
+		req.Relation, req.ObjectType, req.ObjectID, req.Metadata, req.Source)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		s.recordRelationCreate(r, req, relation)
+	}
+	return relation, created, nil
+}
+
+// validateRelationRequest checks a relation against the schema and its
+// source, if any
+func validateRelationRequest(g *graph.IdentityGraph, req RelationRequest) error {
+	if err := g.ValidateRelation(req.SubjectType, req.SubjectID, req.Relation, req.ObjectType); err != nil {
+		return err
+	}
+	if req.Source != "" {
+		return graph.ValidateSource(req.Source)
+	}
+	return nil
+}
+
+// createRelationEndpoints creates a relation's missing subject and object
+// as stub entities. For a subject set, the subject is the set's entity.
+func (s *AuthzService) createRelationEndpoints(ctx context.Context, req RelationRequest) {
+	// Check and create subject entity if missing
+	subjectID := graph.SubjectEntityID(req.SubjectID)
+	subjectExists, _ := s.entityExists(ctx, req.SubjectType, subjectID)
+	if !subjectExists {
+		// Create stub entity with minimal properties
+		_, err := s.graph.CreateEntity(ctx, req.SubjectType, subjectID, map[string]interface{}{
+			"name":         subjectID, // Use ID as default name
+			"auto_created": true,      // Flag to indicate it was auto-created
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to auto-create subject entity: %v", err)
+		}
+	}
+
+	// Same for object entity
+	objectExists, _ := s.entityExists(ctx, req.ObjectType, req.ObjectID)
+	if !objectExists {
+		_, err := s.graph.CreateEntity(ctx, req.ObjectType, req.ObjectID, map[string]interface{}{
+			"name":         req.ObjectID,
+			"auto_created": true,
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to auto-create object entity: %v", err)
+		}
+	}
+}
+
+// recordRelationCreate meters, mirrors and audits a created relation
+func (s *AuthzService) recordRelationCreate(r *http.Request, req RelationRequest, relation *graph.Relation) {
+	s.usage.recordRelationWrite(usageKey{
+		Tenant:     usageTenant(r, req.ObjectType, req.ObjectID, nil),
+		EntityType: req.ObjectType,
+	})
+	s.shadow.WriteRelation(shadow.Relation{
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectID,
+		Relation:    req.Relation,
+		ObjectType:  req.ObjectType,
+		ObjectID:    req.ObjectID,
+		Metadata:    req.Metadata,
+	})
+
+	// Queue the audit entry for the background writer
+	modelSubject := model.Subject{Type: req.SubjectType, ID: req.SubjectID}
+	modelObject := model.Entity{Type: req.ObjectType, ID: req.ObjectID}
+	if err := s.auditLogger.LogRelationCreate(
+		r.Context(),
+		modelObject,
+		req.Relation,
+		modelSubject,
+		relation.Metadata,
+		r,
+	); err != nil {
+		log.Printf("Failed to log relation creation: %v", err)
+	}
+}
+
+// deleteRelationHandler deletes the relations matching the subject_type,
+// subject_id, relation, object_type and object_id query parameters. A
+// subject or an object is required; deleting every relation of a subject
+// across objects needs the admin token when admin scopes are enforced.
+// relationFilterParam reads a relation filter naming a subject, an object
+// or both from the query, writing an error response and returning false
+// when it names neither
+func relationFilterParam(w http.ResponseWriter, r *http.Request) (graph.RelationFilter, bool) {
+	query := r.URL.Query()
+	filter := graph.RelationFilter{
+		SubjectType: query.Get("subject_type"),
+		SubjectID:   query.Get("subject_id"),
+		Relation:    query.Get("relation"),
+		ObjectType:  query.Get("object_type"),
+		ObjectID:    query.Get("object_id"),
+	}
+
+	if (filter.SubjectType == "") != (filter.SubjectID == "") || (filter.ObjectType == "") != (filter.ObjectID == "") {
+		standardErrorResponse(w, "invalid_request", "Invalid relation filter",
+			"subject_type and subject_id, and object_type and object_id, must be given together", http.StatusBadRequest)
+		return graph.RelationFilter{}, false
+	}
+	if filter.SubjectType == "" && filter.ObjectType == "" {
+		standardErrorResponse(w, "invalid_request", "Missing required fields",
+			"A subject (subject_type and subject_id) or an object (object_type and object_id) is required", http.StatusBadRequest)
+		return graph.RelationFilter{}, false
+	}
+	return filter, true
+}
+
+// listRelationsHandler lists the relations of a subject or an object,
+// optionally only those with a relation name or source
+func (s *AuthzService) listRelationsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, ok := relationFilterParam(w, r)
+	if !ok {
+		return
+	}
+	filter.Source = r.URL.Query().Get("source")
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	relations, err := s.graph.FindRelations(ctx, filter)
+	if err != nil {
+		log.Printf("Error listing relations: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to list relations", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := ListRelationsResponse{Relations: make([]RelationInfo, 0, len(relations))}
+	for _, rel := range relations {
+		resp.Relations = append(resp.Relations, RelationInfo{
+			ID:          rel.ID,
+			SubjectType: rel.SubjectType,
+			SubjectID:   rel.SubjectID,
+			Relation:    rel.Relation,
+			ObjectType:  rel.ObjectType,
+			ObjectID:    rel.ObjectID,
+			Metadata:    rel.Metadata,
+			Source:      rel.Source,
+			CreatedAt:   rel.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	jsonResponse(w, resp, http.StatusOK)
+}
+
+func (s *AuthzService) deleteRelationHandler(w http.ResponseWriter, r *http.Request) {
+	filter, ok := relationFilterParam(w, r)
+	if !ok {
+		return
+	}
+
+	var target *adminTarget
+	if filter.ObjectType != "" {
+		target = &adminTarget{Type: filter.ObjectType, ID: filter.ObjectID}
+		if filter.SubjectType != "" {
+			target.Subject = &model.Subject{Type: filter.SubjectType, ID: filter.SubjectID}
+		}
+	}
+	if !s.authorizeAdmin(w, r, target) {
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	relations, err := s.deleteRelations(ctx, r, filter)
+	if err != nil {
+		log.Printf("Error deleting relations: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to delete relations", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if relations == nil {
+		relations = []graph.Relation{}
+	}
+	jsonResponse(w, DeleteRelationsResponse{Deleted: len(relations), Relations: relations}, http.StatusOK)
+}
+
+// deleteRelations deletes the relations matching filter, metering and
+// auditing each one
+func (s *AuthzService) deleteRelations(ctx context.Context, r *http.Request, filter graph.RelationFilter) ([]graph.Relation, error) {
+	relations, err := s.graph.DeleteRelations(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	s.recordRelationDeletes(r, relations)
+	return relations, nil
+}
+
+// recordRelationDeletes meters and audits deleted relations
+func (s *AuthzService) recordRelationDeletes(r *http.Request, relations []graph.Relation) {
+	for _, rel := range relations {
+		s.usage.recordRelationWrite(usageKey{
+			Tenant:     usageTenant(r, rel.ObjectType, rel.ObjectID, nil),
+			EntityType: rel.ObjectType,
+		})
+		if err := s.auditLogger.LogRelationDelete(
+			r.Context(),
+			model.Entity{Type: rel.ObjectType, ID: rel.ObjectID},
+			rel.Relation,
+			model.Subject{Type: rel.SubjectType, ID: rel.SubjectID},
+			r,
+		); err != nil {
+			log.Printf("Failed to log relation deletion: %v", err)
+		}
+	}
+}
+
+// PermissionRequest for creating permission definitions
+type PermissionRequest struct {
+	EntityType          string `json:"entity_type"`
+	PermissionName      string `json:"permission_name"`
+	ConditionExpression string `json:"condition_expression"`
+	Description         string `json:"description,omitempty"`
+}
+
+// PermissionResponse after permission operations
+type PermissionResponse struct {
+	ID                  int64     `json:"id"`
+	EntityType          string    `json:"entity_type"`
+	PermissionName      string    `json:"permission_name"`
+	ConditionExpression string    `json:"condition_expression"`
+	Description         string    `json:"description,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	Error               string    `json:"error,omitempty"`
+}
+
+// permissionHandler manages permission definition creation
+func (s *AuthzService) permissionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, PermissionResponse{Error: "Invalid request format"}, http.StatusBadRequest)
+		return
+	}
+
+	if req.EntityType == "" || req.PermissionName == "" || req.ConditionExpression == "" {
+		jsonResponse(w, PermissionResponse{Error: "EntityType, PermissionName, and ConditionExpression are required"}, http.StatusBadRequest)
+		return
+	}
+
+	// Permission definitions apply to every tenant
+	if !s.authorizeAdmin(w, r, nil) {
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	perm, err := s.graph.AddPermissionDefinition(ctx, req.EntityType, req.PermissionName,
+		req.ConditionExpression, req.Description)
+	if errors.Is(err, graph.ErrConditionTooComplex) {
+		standardErrorResponse(w, "condition_too_complex", "Permission condition over the configured limits", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		jsonResponse(w, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, PermissionResponse{
+		ID:                  perm.ID,
+		EntityType:          perm.EntityType,
+		PermissionName:      perm.PermissionName,
+		ConditionExpression: perm.ConditionExpression,
+		Description:         perm.Description,
+		CreatedAt:           perm.CreatedAt,
+	}, http.StatusCreated)
+}
+
+// ErrorResponse represents a standardized error response
+type ErrorResponse struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+// standardErrorResponse sends a standardized error response with error code and details
+func standardErrorResponse(w http.ResponseWriter, code string, message string, details string, statusCode int) {
+	resp := ErrorResponse{
+		Code:    code,
+		Message: message,
+		Details: details,
+	}
+	jsonResponse(w, resp, statusCode)
+}
+
+// jsonResponse sends a JSON response with the specified status code
+func jsonResponse(w http.ResponseWriter, data interface{}, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+// logMiddleware logs HTTP requests
+func logMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Records the response status by wrapping the ResponseWriter
+		wrapper := &responseWriterWrapper{
+			ResponseWriter: w,
+			Status:         http.StatusOK,
+		}
+
+		next.ServeHTTP(wrapper, r)
+
+		log.Printf("[%s] %s %s %d %s", r.Method, r.URL.Path, r.RemoteAddr, wrapper.Status, time.Since(start))
+	})
+}
+
+// responseWriterWrapper captures the status code of the response
+type responseWriterWrapper struct {
+	http.ResponseWriter
+	Status int
+}
+
+// WriteHeader captures the status code before writing it
+func (w *responseWriterWrapper) WriteHeader(statusCode int) {
+	w.Status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// RunOptions are the optional hooks for RunWithOptions
+type RunOptions struct {
+	// Reload re-reads the configuration when the process gets SIGHUP. Only
+	// the mode and evaluator flags are applied from it; other settings need
+	// a restart.
+	Reload func() (*config.Config, error)
+}
+
+// Run starts the authorization service with an already loaded and validated
+// configuration and serves until ctx is cancelled
+func Run(ctx context.Context, cfg *config.Config, secretManager *secrets.Manager) error {
+	return RunWithOptions(ctx, cfg, secretManager, RunOptions{})
+}
+
+// RunWithOptions is like Run with hooks such as a configuration reload
+func RunWithOptions(ctx context.Context, cfg *config.Config, secretManager *secrets.Manager, opts RunOptions) error {
+	schemaPath := cfg.Authz.SchemaPath
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.Authz.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid authz database URL: %w", err)
+	}
+	poolConfig.BeforeConnect = secrets.PostgresBeforeConnect(secretManager.Get(config.SecretAuthzDatabaseURL), nil)
+
+	var injector *chaos.Injector
+	if cfg.Authz.Chaos {
+		log.Printf("Warning: chaos mode is on; faults set through /api/chaos will slow down or fail requests")
+		injector = chaos.New()
+		poolConfig.ConnConfig.Tracer = injector.QueryTracer(poolConfig.ConnConfig.Tracer)
+	}
+
+	// Counts queries by route and job, including injected latency
+	queries := dbtrace.New(dbtrace.Options{
+		Database:      "authz",
+		SlowThreshold: cfg.Database.SlowQueryThreshold.Std(),
+		LogQueries:    cfg.Database.LogQueries,
+	})
+	poolConfig.ConnConfig.Tracer = queries.QueryTracer(poolConfig.ConnConfig.Tracer)
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer(poolConfig.ConnConfig.Tracer)
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Service:     "supra-authz",
+		Version:     lifecycle.Version,
+		Endpoint:    cfg.Authz.Tracing.Endpoint,
+		SampleRatio: cfg.Authz.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	// Flushes the spans of the last requests once the server has stopped
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
+	clientIPs, err := clientip.New(cfg.Authz.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Creates the service
+	service, err := NewAuthzService(poolConfig, cfg.Authz.ListenAddr, AuditLoggerOptions{
+		QueueSize:     cfg.Authz.Audit.QueueSize,
+		BatchSize:     cfg.Authz.Audit.BatchSize,
+		FlushInterval: cfg.Authz.Audit.FlushInterval.Std(),
+		SpoolPath:     cfg.Authz.Audit.SpoolPath,
+
+		AllowedSampleRate: cfg.Authz.Audit.SampleAllowed,
+		DeniedSampleRate:  cfg.Authz.Audit.SampleDenied,
+		RedactKeys:        cfg.Authz.Audit.RedactKeys,
+		HashKeys:          cfg.Authz.Audit.HashKeys,
+		ClientIPs:         clientIPs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create authorization service: %w", err)
+	}
+	defer service.graph.Pool.Close()
+
+	// Flushes queued audit entries before the pool closes
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := service.auditLogger.Close(closeCtx); err != nil {
+			log.Printf("Audit log flush incomplete: %v", err)
+		}
+	}()
+
+	// Streams sampled decisions to ClickHouse; flushed after the server stops
+	if cfg.Authz.Decisions.ClickHouseURL != "" {
+		streamer, err := newDecisionStreamer(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		service.SetDecisionLog(streamer)
+		defer func() {
+			closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := streamer.Close(closeCtx); err != nil {
+				log.Printf("Decision stream flush incomplete: %v", err)
+			}
+		}()
+	}
+
+	// Compares checks with a secondary backend ahead of a migration; calls
+	// in flight finish after the server stops
+	if cfg.Authz.Shadow.URL != "" {
+		shadower, err := newShadower(cfg)
+		if err != nil {
+			return err
+		}
+		log.Printf("Shadowing checks to %s backend at %s", cfg.Authz.Shadow.Kind, cfg.Authz.Shadow.URL)
+		service.SetShadow(shadower)
+		defer func() {
+			closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := shadower.Close(closeCtx); err != nil {
+				log.Printf("Shadow calls still in flight at shutdown: %v", err)
+			}
+		}()
+	}
+
+	// Notifies security tooling of allowed checks of sensitive permissions;
+	// events still queued are delivered after the server stops
+	if cfg.Authz.Sensitive.WebhookURL != "" || cfg.Authz.Sensitive.LogPath != "" {
+		notifier, err := newSensitiveNotifier(cfg, secretManager)
+		if err != nil {
+			return err
+		}
+		service.SetSensitiveNotifier(notifier)
+		defer func() {
+			closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := notifier.Close(closeCtx); err != nil {
+				log.Printf("Sensitive permission events undelivered at shutdown: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Authz.Audit.SigningKey != "" {
+		key, err := ParseAuditSigningKey(cfg.Authz.Audit.SigningKey)
+		if err != nil {
+			return err
+		}
+		service.SetAuditSigningKey(key)
+	}
+
+	service.SetAdminScopes(cfg.Authz.AdminScopes)
+	service.SetRateLimit(cfg.Authz.RateLimit)
+	service.SetQueryRecorder(queries)
+	service.SetBudgets(configBudgets(cfg))
+	if injector != nil {
+		service.SetChaos(injector)
+	}
+	service.graph.SetStrictRelationDirection(cfg.Authz.StrictRelationDirection)
+	service.graph.SetRelationValidation(cfg.Authz.ValidateRelations)
+	service.graph.SetConditionLimits(ConditionLimits(cfg))
+	service.graph.SetTenantRuleLimits(TenantRuleLimits(cfg))
+	if err := service.SetFlags(cfg.Authz.Flags); err != nil {
+		return fmt.Errorf("invalid evaluator flags: %w", err)
+	}
+	if err := service.SetMode(cfg.Authz.Mode, cfg.Authz.ModeReason); err != nil {
+		return err
+	}
+	if opts.Reload != nil {
+		go service.reloadOnHangup(ctx, opts.Reload)
+	}
+
+	// The dashboard and its admin APIs stay closed until a token is configured
+	adminToken := secretManager.Get(config.SecretAuthzAdminToken)
+	service.SetAdminToken(func() string {
+		if adminToken == nil {
+			return ""
+		}
+		return adminToken.Value()
+	})
+
+	// Requests need an API key once any are configured or required
+	apiKeys, err := config.ParseAPIKeys(cfg.Authz.APIKeys)
+	if err != nil {
+		return fmt.Errorf("invalid API keys: %w", err)
+	}
+	service.SetAPIKeys(apiKeys, cfg.Authz.RequireAPIKey)
+	secretManager.OnRotate(config.SecretAuthzAPIKeys, func(value string) {
+		keys, err := config.ParseAPIKeys(value)
+		if err != nil {
+			log.Printf("Keeping the current API keys, the rotated ones are invalid: %v", err)
+			return
+		}
+		log.Printf("API keys rotated")
+		service.SetAPIKeys(keys, cfg.Authz.RequireAPIKey)
+	})
+
+	// Re-establishes database connections when the credentials rotate
+	secretManager.OnRotate(config.SecretAuthzDatabaseURL, func(string) {
+		log.Printf("Database credentials rotated, resetting connection pool")
+		service.graph.Pool.Reset()
+	})
+
+	// Joins the other replicas; without the cluster tables this replica
+	// runs standalone
+	replica := cluster.New(service.graph.Pool, cluster.Options{ListenAddr: service.addr})
+	if err := replica.Start(ctx); err != nil {
+		log.Printf("Warning: running without cluster coordination: %v", err)
+	} else {
+		service.SetCluster(replica)
+		// Leaves the cluster before the pool closes
+		defer replica.Wait()
+	}
+
+	// Runs exports, reviews, GC and imports in the background; running
+	// jobs are put back in the queue for another replica at shutdown
+	jobManager := newJobManager(service, cfg)
+	service.SetJobs(jobManager)
+	jobManager.Start()
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := jobManager.Stop(stopCtx); err != nil {
+			log.Printf("Jobs still running at shutdown: %v", err)
+		}
+	}()
+
+	// Compare the schema file with the database before it is synced, so a
+	// stale file is reported even where it isn't synced
+	if _, err := os.Stat(schemaPath); err == nil {
+		driftCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		service.checkSchemaDrift(driftCtx, schemaPath)
+		cancel()
+	}
+
+	// Load permission model from schema.perm, unless the database may not
+	// be writable
+	if mode := service.mode.get().Mode; mode != ModeNormal {
+		log.Printf("Skipping schema sync in %s mode", mode)
+	} else if _, err := os.Stat(schemaPath); err == nil {
+		log.Printf("Loading permission model from %s", schemaPath)
+		syncCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err = SyncPermissionModelWithOptions(syncCtx, service.graph, schemaPath, SyncOptions{
+			FailOnRuleTests: cfg.Authz.FailOnRuleTests,
+		})
+		cancel()
+		if err != nil {
+			log.Printf("Warning: Failed to load permission model: %v", err)
+		} else {
+			log.Printf("Successfully loaded permission model")
+			service.broadcast(ctx, cluster.EventSchemaReloaded, nil)
+		}
+	} else {
+		log.Printf("Schema file not found at %s, skipping schema load", schemaPath)
+	}
+
+	srv := &http.Server{
+		Addr:      service.addr,
+		Handler:   service.Handler(),
+		TLSConfig: tlsConfig,
+	}
+
+	serverErrors := make(chan error, 2)
+	go func() {
+		if tlsConfig != nil {
+			log.Printf("Starting authorization service on %s with TLS", service.addr)
+			serverErrors <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		log.Printf("Starting authorization service on %s", service.addr)
+		serverErrors <- srv.ListenAndServe()
+	}()
+
+	if addr := cfg.Authz.GRPCListenAddr; addr != "" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for gRPC on %s: %w", addr, err)
+		}
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer := service.GRPCServer(opts...)
+		// Finishes in-flight calls before the pool closes
+		defer grpcServer.GracefulStop()
+		go func() {
+			log.Printf("Starting authorization gRPC service on %s", addr)
+			serverErrors <- grpcServer.Serve(lis)
+		}()
+	}
+
+	select {
+	case err := <-serverErrors:
+		return fmt.Errorf("server error: %w", err)
+	case <-ctx.Done():
+		log.Printf("Shutting down authorization service, draining for %s", cfg.Shutdown.Delay.Std())
+		return service.drain.Shutdown(cfg.Shutdown.Delay.Std(), cfg.Shutdown.Timeout.Std(), srv.Shutdown)
+	}
+}
+
+// Helper function to check if an entity exists
+func (s *AuthzService) entityExists(ctx context.Context, entityType, externalID string) (bool, error) {
+	var exists bool
+	err := s.graph.Pool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM entities 
+			WHERE type = $1 AND external_id = $2
+		)
+	`, entityType, externalID).Scan(&exists)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check if entity exists: %w", err)
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,77 @@
+package authzserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/shadow"
+)
+
+// SetShadow compares every check, subject to the shadower's sampling, with
+// a secondary backend, and forwards writes to it when dual-writing
+func (s *AuthzService) SetShadow(shadower *shadow.Shadower) {
+	s.shadow = shadower
+}
+
+// newShadower connects the configured secondary backend
+func newShadower(cfg *config.Config) (*shadow.Shadower, error) {
+	backend, err := shadow.NewBackend(cfg.Authz.Shadow.Kind, cfg.Authz.Shadow.URL, cfg.Authz.Shadow.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure shadow backend: %w", err)
+	}
+	return shadow.New(backend, shadow.Options{
+		SampleRate:  cfg.Authz.Shadow.SampleRate,
+		Concurrency: cfg.Authz.Shadow.Concurrency,
+		Timeout:     cfg.Authz.Shadow.Timeout.Std(),
+		DualWrite:   cfg.Authz.Shadow.DualWrite,
+	}), nil
+}
+
+// addShadowEndpoints reports how the secondary backend's answers compare
+func (s *AuthzService) addShadowEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/shadow", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if s.shadow == nil {
+			standardErrorResponse(w, "shadow_disabled", "Shadow checks are off",
+				"Start the service with AUTHZ_SHADOW_URL set to compare checks with another backend", http.StatusNotFound)
+			return
+		}
+		jsonResponse(w, s.shadow.Stats(), http.StatusOK)
+	})
+}
+
+// writeShadowMetrics writes shadow comparisons in the Prometheus text
+// exposition format
+func writeShadowMetrics(w http.ResponseWriter, stats shadow.Stats) {
+	var b strings.Builder
+
+	b.WriteString("# HELP supra_authz_shadow_checks_total Checks compared with the shadow backend by entity type, permission and result.\n")
+	b.WriteString("# TYPE supra_authz_shadow_checks_total counter\n")
+	for _, e := range stats.Checks {
+		for _, result := range []struct {
+			name  string
+			value int64
+		}{
+			{"match", e.Matches},
+			{"mismatch", e.Mismatches},
+			{"error", e.Errors},
+			{"skipped", e.Skipped},
+		} {
+			fmt.Fprintf(&b, `supra_authz_shadow_checks_total{entity_type="%s",permission="%s",result="%s"} %d`+"\n",
+				escapeLabel(e.ObjectType), escapeLabel(e.Permission), result.name, result.value)
+		}
+	}
+
+	b.WriteString("# HELP supra_authz_shadow_writes_total Writes forwarded to the shadow backend by result.\n")
+	b.WriteString("# TYPE supra_authz_shadow_writes_total counter\n")
+	b.WriteString(`supra_authz_shadow_writes_total{result="ok"} ` + strconv.FormatInt(stats.Writes-stats.WriteErrors, 10) + "\n")
+	b.WriteString(`supra_authz_shadow_writes_total{result="error"} ` + strconv.FormatInt(stats.WriteErrors, 10) + "\n")
+
+	w.Write([]byte(b.String()))
+}
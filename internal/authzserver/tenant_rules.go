@@ -0,0 +1,146 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/internal/cluster"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// TenantRuleRequest creates or replaces one of a tenant's rules
+type TenantRuleRequest struct {
+	Tenant      string                `json:"tenant"`
+	Name        string                `json:"name"`
+	Parameters  []ParameterDefinition `json:"parameters"`
+	Expression  string                `json:"expression"`
+	Description string                `json:"description,omitempty"`
+}
+
+// TenantRulesResponse lists a tenant's rules
+type TenantRulesResponse struct {
+	Tenant string             `json:"tenant"`
+	Rules  []graph.TenantRule `json:"rules"`
+}
+
+// TenantRuleLimits reads the limits on tenant rules from the configuration
+func TenantRuleLimits(cfg *config.Config) graph.TenantRuleLimits {
+	return graph.TenantRuleLimits{
+		MaxRules: cfg.Authz.TenantRules.MaxRules,
+		Timeout:  cfg.Authz.TenantRules.Timeout.Std(),
+	}
+}
+
+// addTenantRuleEndpoints adds /api/tenant-rules: GET ?tenant= lists a
+// tenant's rules, POST sets one and DELETE ?tenant=&name= removes one. A
+// tenant's own admins may manage its rules, as they may its entities.
+func (s *AuthzService) addTenantRuleEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/tenant-rules", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.listTenantRulesHandler(w, r)
+		case http.MethodPost, http.MethodPut:
+			s.setTenantRuleHandler(w, r)
+		case http.MethodDelete:
+			s.deleteTenantRuleHandler(w, r)
+		default:
+			standardErrorResponse(w, "method_not_allowed", "Method not allowed",
+				fmt.Sprintf("The %s method is not supported for this endpoint", r.Method), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (s *AuthzService) listTenantRulesHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		standardErrorResponse(w, "missing_parameters", "Missing query parameters",
+			"The tenant query parameter is required", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeAdmin(w, r, &adminTarget{Type: tenantEntityType, ID: tenant}) {
+		return
+	}
+
+	jsonResponse(w, TenantRulesResponse{Tenant: tenant, Rules: s.graph.TenantRules(tenant)}, http.StatusOK)
+}
+
+func (s *AuthzService) setTenantRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var req TenantRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Tenant == "" || req.Name == "" || req.Expression == "" {
+		standardErrorResponse(w, "missing_fields", "Required fields missing",
+			"Tenant, name and expression are required fields", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeAdmin(w, r, &adminTarget{Type: tenantEntityType, ID: req.Tenant}) {
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	rule := graph.TenantRule{
+		Tenant:      req.Tenant,
+		Name:        req.Name,
+		Expression:  req.Expression,
+		Description: req.Description,
+	}
+	for _, param := range req.Parameters {
+		rule.Parameters = append(rule.Parameters, graph.RuleParameter{Name: param.Name, DataType: param.DataType})
+	}
+
+	stored, err := s.graph.SetTenantRule(ctx, rule)
+	switch {
+	case errors.Is(err, graph.ErrInvalidTenantRule):
+		standardErrorResponse(w, "invalid_tenant_rule", "Invalid tenant rule", err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, graph.ErrTenantRuleLimit):
+		standardErrorResponse(w, "tenant_rule_limit", "Tenant rule limit reached", err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error setting tenant rule: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to set tenant rule", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.broadcast(r.Context(), cluster.EventCacheInvalidated, InvalidateCacheRequest{Cache: cacheTenantRules})
+	jsonResponse(w, stored, http.StatusOK)
+}
+
+func (s *AuthzService) deleteTenantRuleHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	tenant, name := query.Get("tenant"), query.Get("name")
+	if tenant == "" || name == "" {
+		standardErrorResponse(w, "missing_parameters", "Missing query parameters",
+			"Tenant and name query parameters are required", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeAdmin(w, r, &adminTarget{Type: tenantEntityType, ID: tenant}) {
+		return
+	}
+
+	ctx, cancel := s.startBudget(r.Context(), budget.Standard)
+	defer cancel()
+
+	err := s.graph.DeleteTenantRule(ctx, tenant, name)
+	switch {
+	case errors.Is(err, graph.ErrTenantRuleNotFound):
+		standardErrorResponse(w, "tenant_rule_not_found", "Tenant rule not found", err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error deleting tenant rule: %v", err)
+		standardErrorResponse(w, "internal_error", "Failed to delete tenant rule", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.broadcast(r.Context(), cluster.EventCacheInvalidated, InvalidateCacheRequest{Cache: cacheTenantRules})
+	w.WriteHeader(http.StatusNoContent)
+}
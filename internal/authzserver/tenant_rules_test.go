@@ -0,0 +1,33 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantRuleRequestValidation(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addTenantRuleEndpoints(mux)
+
+	for _, tc := range []struct {
+		method, target, body string
+		status               int
+		code                 string
+	}{
+		{http.MethodGet, "/api/tenant-rules", "", http.StatusBadRequest, "missing_parameters"},
+		{http.MethodPost, "/api/tenant-rules", `{"tenant": "acme", "name": "r"}`, http.StatusBadRequest, "missing_fields"},
+		{http.MethodPost, "/api/tenant-rules", `{`, http.StatusBadRequest, "invalid_request"},
+		{http.MethodDelete, "/api/tenant-rules?tenant=acme", "", http.StatusBadRequest, "missing_parameters"},
+		{http.MethodPatch, "/api/tenant-rules", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+		assert.Equal(t, tc.status, rec.Code, tc.method+" "+tc.target)
+		assert.Contains(t, rec.Body.String(), tc.code, tc.method+" "+tc.target)
+	}
+}
@@ -0,0 +1,46 @@
+package authzserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dangerclosesec/supra/internal/config"
+)
+
+// serverTLSConfig returns the TLS settings both APIs are served with, or
+// nil when TLS is off
+func serverTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	settings := cfg.Authz.TLS
+	if settings.CertPath == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(settings.CertPath, settings.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if settings.ClientCAPath != "" {
+		pem, err := os.ReadFile(settings.ClientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file holds no PEM certificates")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if settings.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,309 @@
+package authzserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tenantHeader names the tenant a request is billed to. Callers sharing the
+// service set it so checks on entities without a tenant property, which
+// aren't looked up to keep checks fast, are still attributed.
+const tenantHeader = "X-Supra-Tenant"
+
+// tupleCountTTL is how long stored tuple counts are reused; counting them
+// scans the relations table
+const tupleCountTTL = time.Minute
+
+// usageKey is the tenant and entity type usage is attributed to. Tenant is
+// empty when a request couldn't be attributed.
+type usageKey struct {
+	Tenant     string
+	EntityType string
+}
+
+type usageCounts struct {
+	checksAllowed  int64
+	checksDenied   int64
+	entityWrites   int64
+	relationWrites int64
+}
+
+// UsageEntry is the usage of one tenant and entity type
+type UsageEntry struct {
+	Tenant         string `json:"tenant"`
+	EntityType     string `json:"entity_type"`
+	ChecksAllowed  int64  `json:"checks_allowed"`
+	ChecksDenied   int64  `json:"checks_denied"`
+	EntityWrites   int64  `json:"entity_writes"`
+	RelationWrites int64  `json:"relation_writes"`
+	StoredTuples   int64  `json:"stored_tuples"`
+}
+
+// UsageResponse reports usage counted by this replica since it started,
+// alongside the tuples stored for the whole cluster
+type UsageResponse struct {
+	Since   time.Time    `json:"since"`
+	Entries []UsageEntry `json:"entries"`
+}
+
+// usageMeter counts checks and writes per tenant and entity type
+type usageMeter struct {
+	mu     sync.Mutex
+	since  time.Time
+	counts map[usageKey]*usageCounts
+
+	tuplesMu       sync.Mutex
+	tuples         map[usageKey]int64
+	tuplesLoadedAt time.Time
+}
+
+func newUsageMeter() *usageMeter {
+	return &usageMeter{
+		since:  time.Now(),
+		counts: make(map[usageKey]*usageCounts),
+	}
+}
+
+func (m *usageMeter) add(key usageKey, update func(*usageCounts)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counts[key]
+	if !ok {
+		c = &usageCounts{}
+		m.counts[key] = c
+	}
+	update(c)
+}
+
+func (m *usageMeter) recordCheck(key usageKey, allowed bool) {
+	m.add(key, func(c *usageCounts) {
+		if allowed {
+			c.checksAllowed++
+		} else {
+			c.checksDenied++
+		}
+	})
+}
+
+func (m *usageMeter) recordEntityWrite(key usageKey) {
+	m.add(key, func(c *usageCounts) { c.entityWrites++ })
+}
+
+func (m *usageMeter) recordRelationWrite(key usageKey) {
+	m.add(key, func(c *usageCounts) { c.relationWrites++ })
+}
+
+// snapshot merges the request counts with stored tuple counts, sorted by
+// tenant and entity type
+func (m *usageMeter) snapshot(tuples map[usageKey]int64) UsageResponse {
+	merged := make(map[usageKey]*UsageEntry)
+	entry := func(key usageKey) *UsageEntry {
+		e, ok := merged[key]
+		if !ok {
+			e = &UsageEntry{Tenant: key.Tenant, EntityType: key.EntityType}
+			merged[key] = e
+		}
+		return e
+	}
+
+	m.mu.Lock()
+	since := m.since
+	for key, c := range m.counts {
+		e := entry(key)
+		e.ChecksAllowed = c.checksAllowed
+		e.ChecksDenied = c.checksDenied
+		e.EntityWrites = c.entityWrites
+		e.RelationWrites = c.relationWrites
+	}
+	m.mu.Unlock()
+
+	for key, n := range tuples {
+		entry(key).StoredTuples = n
+	}
+
+	entries := make([]UsageEntry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Tenant != entries[j].Tenant {
+			return entries[i].Tenant < entries[j].Tenant
+		}
+		return entries[i].EntityType < entries[j].EntityType
+	})
+	return UsageResponse{Since: since, Entries: entries}
+}
+
+// storedTuples returns relation counts by tenant and object type, reusing
+// the last count for tupleCountTTL
+func (m *usageMeter) storedTuples(ctx context.Context, load func(context.Context) (map[usageKey]int64, error)) (map[usageKey]int64, error) {
+	m.tuplesMu.Lock()
+	defer m.tuplesMu.Unlock()
+
+	if m.tuples != nil && time.Since(m.tuplesLoadedAt) < tupleCountTTL {
+		return m.tuples, nil
+	}
+	tuples, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.tuples = tuples
+	m.tuplesLoadedAt = time.Now()
+	return tuples, nil
+}
+
+// usageTenant attributes a request to a tenant: the tenant header, then the
+// object itself when it is a tenant, then a tenant property being written
+func usageTenant(r *http.Request, objectType, objectID string, properties map[string]interface{}) string {
+	if tenant := r.Header.Get(tenantHeader); tenant != "" {
+		return tenant
+	}
+	if objectType == tenantEntityType {
+		return objectID
+	}
+	tenant, _ := properties[tenantProperty].(string)
+	return tenant
+}
+
+// loadStoredTuples counts relations by the tenant and type of their object
+func (s *AuthzService) loadStoredTuples(ctx context.Context) (map[usageKey]int64, error) {
+	rows, err := s.graph.Pool.Query(ctx, `
+		SELECT
+			COALESCE(CASE WHEN r.object_type = $1 THEN r.object_id END, e.properties->>$2, '') AS tenant,
+			r.object_type,
+			COUNT(*)
+		FROM relations r
+		LEFT JOIN entities e ON e.type = r.object_type AND e.external_id = r.object_id
+		GROUP BY 1, 2
+	`, tenantEntityType, tenantProperty)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count stored tuples: %w", err)
+	}
+	defer rows.Close()
+
+	tuples := make(map[usageKey]int64)
+	for rows.Next() {
+		var key usageKey
+		var n int64
+		if err := rows.Scan(&key.Tenant, &key.EntityType, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan tuple count: %w", err)
+		}
+		tuples[key] = n
+	}
+	return tuples, rows.Err()
+}
+
+// usageSnapshot reports usage, leaving stored tuples out when they can't be
+// counted rather than failing the whole report
+func (s *AuthzService) usageSnapshot(ctx context.Context) UsageResponse {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tuples, err := s.usage.storedTuples(ctx, s.loadStoredTuples)
+	if err != nil {
+		log.Printf("Error counting stored tuples for usage: %v", err)
+	}
+	return s.usage.snapshot(tuples)
+}
+
+// addUsageEndpoints serves usage as JSON for chargeback reports and in the
+// Prometheus text format for scraping
+func (s *AuthzService) addUsageEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/api/usage", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		jsonResponse(w, s.usageSnapshot(r.Context()), http.StatusOK)
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeUsageMetrics(w, s.usageSnapshot(r.Context()))
+		writeDeprecationMetrics(w, s.deprecations.snapshot())
+		if s.shadow != nil {
+			writeShadowMetrics(w, s.shadow.Stats())
+		}
+		if limits := s.rateLimits.Load(); limits != nil {
+			writeRateLimitMetrics(w, limits.rejections())
+		}
+		if s.sensitive != nil {
+			writeSensitiveMetrics(w, s.sensitive.Stats())
+		}
+		writeFlagMetrics(w, s.graph.FlagStats())
+		writeLatencyMetrics(w, &s.metrics)
+		writeGraphMetrics(w, s.graph.Stats(), s.apiKeys.cacheStats())
+		if s.graph.Pool != nil {
+			writePoolMetrics(w, poolStatsOf(s.graph.Pool.Stat()))
+		}
+		if s.auditLogger != nil {
+			writeAuditFailureMetrics(w, s.auditLogger.failureStats())
+		}
+		if s.queries != nil {
+			s.queries.WriteMetrics(w)
+		}
+	})
+}
+
+// writeUsageMetrics writes usage in the Prometheus text exposition format
+func writeUsageMetrics(w http.ResponseWriter, usage UsageResponse) {
+	var b strings.Builder
+
+	b.WriteString("# HELP supra_authz_checks_total Permission checks by tenant, entity type and result.\n")
+	b.WriteString("# TYPE supra_authz_checks_total counter\n")
+	for _, e := range usage.Entries {
+		if e.ChecksAllowed+e.ChecksDenied == 0 {
+			continue
+		}
+		writeMetric(&b, "supra_authz_checks_total", e, e.ChecksAllowed, "result", "allowed")
+		writeMetric(&b, "supra_authz_checks_total", e, e.ChecksDenied, "result", "denied")
+	}
+
+	b.WriteString("# HELP supra_authz_writes_total Entity and relation writes by tenant, entity type and kind.\n")
+	b.WriteString("# TYPE supra_authz_writes_total counter\n")
+	for _, e := range usage.Entries {
+		if e.EntityWrites+e.RelationWrites == 0 {
+			continue
+		}
+		writeMetric(&b, "supra_authz_writes_total", e, e.EntityWrites, "kind", "entity")
+		writeMetric(&b, "supra_authz_writes_total", e, e.RelationWrites, "kind", "relation")
+	}
+
+	b.WriteString("# HELP supra_authz_stored_tuples Relations stored by tenant and object type.\n")
+	b.WriteString("# TYPE supra_authz_stored_tuples gauge\n")
+	for _, e := range usage.Entries {
+		if e.StoredTuples == 0 {
+			continue
+		}
+		writeMetric(&b, "supra_authz_stored_tuples", e, e.StoredTuples, "", "")
+	}
+
+	w.Write([]byte(b.String()))
+}
+
+func writeMetric(b *strings.Builder, name string, e UsageEntry, value int64, label, labelValue string) {
+	fmt.Fprintf(b, `%s{tenant="%s",entity_type="%s"`, name, escapeLabel(e.Tenant), escapeLabel(e.EntityType))
+	if label != "" {
+		fmt.Fprintf(b, `,%s="%s"`, label, escapeLabel(labelValue))
+	}
+	b.WriteString("} ")
+	b.WriteString(strconv.FormatInt(value, 10))
+	b.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,81 @@
+package authzserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageTenant(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/check", nil)
+	assert.Equal(t, "acme", usageTenant(r, "organization", "acme", nil), "a tenant is billed for itself")
+	assert.Equal(t, "globex", usageTenant(r, "document", "1", map[string]interface{}{"tenant": "globex"}))
+	assert.Equal(t, "", usageTenant(r, "document", "1", nil), "unattributed without a header or property")
+
+	r.Header.Set(tenantHeader, "initech")
+	assert.Equal(t, "initech", usageTenant(r, "organization", "acme", nil), "the header wins")
+}
+
+func TestUsageMeterSnapshot(t *testing.T) {
+	m := newUsageMeter()
+	doc := usageKey{Tenant: "acme", EntityType: "document"}
+	m.recordCheck(doc, true)
+	m.recordCheck(doc, true)
+	m.recordCheck(doc, false)
+	m.recordEntityWrite(doc)
+	m.recordRelationWrite(usageKey{Tenant: "acme", EntityType: "folder"})
+
+	usage := m.snapshot(map[usageKey]int64{
+		doc:                              7,
+		{Tenant: "", EntityType: "user"}: 2,
+	})
+	assert.Equal(t, []UsageEntry{
+		{Tenant: "", EntityType: "user", StoredTuples: 2},
+		{Tenant: "acme", EntityType: "document", ChecksAllowed: 2, ChecksDenied: 1, EntityWrites: 1, StoredTuples: 7},
+		{Tenant: "acme", EntityType: "folder", RelationWrites: 1},
+	}, usage.Entries)
+}
+
+func TestUsageMeterCachesStoredTuples(t *testing.T) {
+	m := newUsageMeter()
+	loads := 0
+	load := func(context.Context) (map[usageKey]int64, error) {
+		loads++
+		return map[usageKey]int64{{EntityType: "document"}: 1}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := m.storedTuples(context.Background(), load)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, loads)
+
+	m = newUsageMeter()
+	_, err := m.storedTuples(context.Background(), func(context.Context) (map[usageKey]int64, error) {
+		return nil, errors.New("down")
+	})
+	assert.Error(t, err)
+	assert.Nil(t, m.tuples, "a failed count is retried on the next report")
+}
+
+func TestWriteUsageMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeUsageMetrics(rec, UsageResponse{Entries: []UsageEntry{
+		{Tenant: `ac"me`, EntityType: "document", ChecksAllowed: 3, ChecksDenied: 1, StoredTuples: 5},
+	}})
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE supra_authz_checks_total counter\n")
+	assert.Contains(t, body, `supra_authz_checks_total{tenant="ac\"me",entity_type="document",result="allowed"} 3`)
+	assert.Contains(t, body, `supra_authz_checks_total{tenant="ac\"me",entity_type="document",result="denied"} 1`)
+	assert.Contains(t, body, `supra_authz_stored_tuples{tenant="ac\"me",entity_type="document"} 5`)
+	assert.NotContains(t, body, "supra_authz_writes_total{", "entries without writes are left out")
+
+	assert.True(t, isAdminRoute("/metrics"))
+	assert.True(t, isAdminRoute("/api/usage"))
+}
@@ -0,0 +1,50 @@
+package authzserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisualizeCondition(t *testing.T) {
+	s := &AuthzService{graph: &graph.IdentityGraph{}}
+	mux := http.NewServeMux()
+	s.addPermissionVisualizer(mux)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/visualize-condition", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"condition":"owner or (editor and request.ticket)"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp VisualizeConditionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "(owner or (editor and request.ticket))", resp.ParsedExpression)
+	require.NotNil(t, resp.AST)
+	assert.Equal(t, graph.NodeOr, resp.AST.Type)
+	assert.Equal(t, graph.Span{Start: 0, End: 36}, resp.AST.Span)
+	assert.Equal(t, graph.Span{Start: 10, End: 35}, resp.AST.Children[1].Span)
+	assert.Nil(t, resp.Decision, "nothing is decided without a check")
+
+	rec = post(`{"condition":"request.ticket or request.escalated",
+		"check":{"subject_type":"user","subject_id":"alice","object_type":"doc","object_id":"1",
+		"context":{"request":{"escalated":true}}}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	resp = VisualizeConditionResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Decision)
+	assert.True(t, resp.Decision.Allowed)
+	assert.False(t, resp.AST.Children[0].Decisive)
+	assert.True(t, resp.AST.Children[1].Decisive, "the operand that granted access is highlighted")
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"condition":"owner or"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"condition":"owner","check":{"subject_type":"user"}}`).Code)
+}
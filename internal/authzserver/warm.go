@@ -0,0 +1,143 @@
+package authzserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Bounds on pre-warming, which shares the database with live checks
+const (
+	// maxWarmChecks is how many checks one request can ask to warm
+	maxWarmChecks = 100
+	// maxWarmBatches is how many requests are warmed at once; more are
+	// turned away rather than queued, since a late warm-up is no use
+	maxWarmBatches = 4
+	// warmTimeout bounds the time spent warming one request's checks
+	warmTimeout = 30 * time.Second
+)
+
+// WarmChecksRequest lists checks a client expects to make soon, such as the
+// ones a dashboard runs when it renders
+type WarmChecksRequest struct {
+	Checks []CheckPermissionRequest `json:"checks"`
+}
+
+// WarmChecksResponse reports how many distinct checks are being warmed
+type WarmChecksResponse struct {
+	Accepted int `json:"accepted"`
+}
+
+// warmLimiter counts the requests being warmed in the background
+type warmLimiter struct {
+	mu      sync.Mutex
+	running int
+}
+
+func (l *warmLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running >= maxWarmBatches {
+		return false
+	}
+	l.running++
+	return true
+}
+
+func (l *warmLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+}
+
+// addWarmEndpoints serves /check/warm, which runs the given checks in the
+// background and returns at once. Running a check loads the permission
+// definition, the rules and the relation counts the planner uses, and pulls
+// the relation rows it touches into Postgres' buffer cache, so the real
+// check that follows doesn't pay for a cold start. Results are discarded and
+// are neither audited nor metered.
+func (s *AuthzService) addWarmEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/check/warm", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req WarmChecksRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid request format", err.Error(), http.StatusBadRequest)
+			return
+		}
+		checks, err := warmableChecks(req.Checks)
+		if err != nil {
+			standardErrorResponse(w, "invalid_request", "Invalid checks", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !s.warming.acquire() {
+			standardErrorResponse(w, "warming_busy", "Too many checks are being warmed",
+				"Retry later, or make the checks directly", http.StatusTooManyRequests)
+			return
+		}
+		go func() {
+			defer s.warming.release()
+			s.warmChecks(checks)
+		}()
+
+		jsonResponse(w, WarmChecksResponse{Accepted: len(checks)}, http.StatusAccepted)
+	})
+}
+
+// warmableChecks validates the checks in a warm request and drops repeats
+func warmableChecks(checks []CheckPermissionRequest) ([]CheckPermissionRequest, error) {
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("checks must not be empty")
+	}
+	if len(checks) > maxWarmChecks {
+		return nil, fmt.Errorf("at most %d checks can be warmed at once, got %d", maxWarmChecks, len(checks))
+	}
+
+	seen := make(map[string]bool, len(checks))
+	unique := make([]CheckPermissionRequest, 0, len(checks))
+	for i, c := range checks {
+		if c.SubjectType == "" || c.SubjectID == "" || c.Permission == "" ||
+			c.ObjectType == "" || c.ObjectID == "" {
+			return nil, fmt.Errorf("checks[%d] is missing required fields", i)
+		}
+		key := fmt.Sprintf("%s:%s %s %s:%s", c.SubjectType, c.SubjectID, c.Permission, c.ObjectType, c.ObjectID)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, c)
+	}
+	return unique, nil
+}
+
+// warmChecks runs checks one after another, so a batch never takes more
+// than one pool connection from live traffic
+func (s *AuthzService) warmChecks(checks []CheckPermissionRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), warmTimeout)
+	defer cancel()
+
+	start := time.Now()
+	failed := 0
+	for _, c := range checks {
+		contextData := c.Context
+		if contextData == nil {
+			contextData = map[string]interface{}{"request": map[string]interface{}{}}
+		}
+		if _, err := s.graph.CheckPermission(ctx, c.SubjectType, c.SubjectID,
+			c.Permission, c.ObjectType, c.ObjectID, contextData); err != nil {
+			failed++
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	log.Printf("Warmed %d checks in %s (%d failed)", len(checks), time.Since(start).Round(time.Millisecond), failed)
+}
@@ -0,0 +1,59 @@
+package authzserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmableChecks(t *testing.T) {
+	check := CheckPermissionRequest{
+		SubjectType: "user", SubjectID: "alice", Permission: "view", ObjectType: "document", ObjectID: "d1",
+	}
+	other := check
+	other.ObjectID = "d2"
+
+	checks, err := warmableChecks([]CheckPermissionRequest{check, other, check})
+	require.NoError(t, err)
+	assert.Equal(t, []CheckPermissionRequest{check, other}, checks, "repeats are dropped")
+
+	_, err = warmableChecks(nil)
+	assert.Error(t, err)
+
+	_, err = warmableChecks([]CheckPermissionRequest{check, {SubjectType: "user"}})
+	assert.EqualError(t, err, "checks[1] is missing required fields")
+
+	_, err = warmableChecks(make([]CheckPermissionRequest, maxWarmChecks+1))
+	assert.Error(t, err)
+}
+
+func TestWarmEndpoint(t *testing.T) {
+	s := &AuthzService{}
+	mux := http.NewServeMux()
+	s.addWarmEndpoints(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/check/warm", strings.NewReader(`{"checks":[]}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Every slot is taken, so the request is turned away before anything runs
+	for i := 0; i < maxWarmBatches; i++ {
+		require.True(t, s.warming.acquire())
+	}
+	assert.False(t, s.warming.acquire())
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/check/warm", strings.NewReader(
+		`{"checks":[{"subject_type":"user","subject_id":"alice","permission":"view","object_type":"document","object_id":"d1"}]}`)))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, rec.Body.String(), "warming_busy")
+
+	s.warming.release()
+	assert.True(t, s.warming.acquire())
+
+	assert.False(t, isAdminRoute("/check/warm"))
+}
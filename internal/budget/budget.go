@@ -0,0 +1,168 @@
+// Package budget gives each request of the authorization service one time
+// budget, shared by its steps rather than restarted by each of them. The
+// total comes from the configuration or the caller's X-Request-Timeout
+// header; database round trips and rule evaluations get sub-budgets capped
+// by what is left, and expensive steps check the remainder before starting
+// so a request past its budget fails fast instead of queueing more work.
+package budget
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header asks for a request budget, as a Go duration like "250ms" or a
+// number of seconds. It may shorten a request's budget or lengthen it up to
+// Budgets.Max.
+const Header = "X-Request-Timeout"
+
+// ErrExhausted is returned by Check when too little of the budget is left
+// for another step. It wraps context.DeadlineExceeded, so callers can treat
+// it like any other deadline.
+var ErrExhausted = fmt.Errorf("request budget exhausted: %w", context.DeadlineExceeded)
+
+// Class picks the default budget of a request
+type Class int
+
+const (
+	// Standard is for checks, reads and single writes
+	Standard Class = iota
+	// Long is for batches, lookups, exports and cascading deletes
+	Long
+)
+
+// Budgets are the time limits of requests and of their steps. A zero
+// sub-budget leaves the step limited by the request's budget only.
+type Budgets struct {
+	// Standard and Long are the budgets of requests of each class that
+	// don't ask for one
+	Standard time.Duration
+	Long     time.Duration
+	// Max caps the budget a request may ask for
+	Max time.Duration
+	// Database caps each database round trip of an evaluation
+	Database time.Duration
+	// Rules caps the evaluation of each rule
+	Rules time.Duration
+	// Reserve is the least a step is started with; Check fails when less
+	// is left
+	Reserve time.Duration
+}
+
+// Defaults returns the budgets used when the configuration sets none
+func Defaults() Budgets {
+	return Budgets{
+		Standard: 10 * time.Second,
+		Long:     30 * time.Second,
+		Max:      60 * time.Second,
+		Database: 5 * time.Second,
+		Rules:    2 * time.Second,
+		Reserve:  5 * time.Millisecond,
+	}
+}
+
+type budgetsKey struct{}
+type requestedKey struct{}
+
+// ParseHeader parses the value of the Header, returning zero for an empty
+// one
+func ParseHeader(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, numErr := strconv.ParseFloat(value, 64)
+		if numErr != nil {
+			return 0, fmt.Errorf("invalid %s %q: want a duration like 250ms or a number of seconds", Header, value)
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", Header, value)
+	}
+	return d, nil
+}
+
+// WithRequested records the budget a caller asked for, which Start uses
+// instead of the class's default
+func WithRequested(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, requestedKey{}, d)
+}
+
+// Start begins a request's budget: the one the caller asked for, capped at
+// Max, or the class's default. An earlier deadline already on ctx, such as
+// a gRPC client's, is kept. The budgets travel with the returned context
+// for Database, Rules and Check.
+func (b Budgets) Start(ctx context.Context, class Class) (context.Context, context.CancelFunc) {
+	total := b.Standard
+	if class == Long {
+		total = b.Long
+	}
+	if requested, ok := ctx.Value(requestedKey{}).(time.Duration); ok && requested > 0 {
+		total = requested
+		if b.Max > 0 && total > b.Max {
+			total = b.Max
+		}
+	}
+
+	ctx = context.WithValue(ctx, budgetsKey{}, b)
+	if total <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, total)
+}
+
+// from returns the budgets a request was started with
+func from(ctx context.Context) Budgets {
+	b, _ := ctx.Value(budgetsKey{}).(Budgets)
+	return b
+}
+
+// Remaining is how much of the request's budget is left; ok is false when
+// it has no deadline
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// Check reports ErrExhausted when the request is past its deadline, or
+// would be before its budget's Reserve could be spent on another step
+func Check(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ErrExhausted
+	}
+	if remaining, ok := Remaining(ctx); ok && remaining < from(ctx).Reserve {
+		return ErrExhausted
+	}
+	return nil
+}
+
+// Database limits a database round trip to the Database sub-budget, or to
+// what is left of the request's budget when that is sooner
+func Database(ctx context.Context) (context.Context, context.CancelFunc) {
+	return sub(ctx, from(ctx).Database)
+}
+
+// Rules limits a rule evaluation to the Rules sub-budget, or to what is
+// left of the request's budget when that is sooner
+func Rules(ctx context.Context) (context.Context, context.CancelFunc) {
+	return sub(ctx, from(ctx).Rules)
+}
+
+func sub(ctx context.Context, limit time.Duration) (context.Context, context.CancelFunc) {
+	if limit <= 0 {
+		return ctx, func() {}
+	}
+	if remaining, ok := Remaining(ctx); ok && remaining <= limit {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, limit)
+}
@@ -0,0 +1,92 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":      0,
+		"250ms": 250 * time.Millisecond,
+		"2":     2 * time.Second,
+		"0.5":   500 * time.Millisecond,
+	}
+	for value, want := range tests {
+		got, err := ParseHeader(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	for _, value := range []string{"soon", "-1s", "0"} {
+		_, err := ParseHeader(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestStart(t *testing.T) {
+	b := Budgets{Standard: time.Second, Long: time.Minute, Max: 10 * time.Second}
+
+	remaining := func(ctx context.Context, class Class) time.Duration {
+		ctx, cancel := b.Start(ctx, class)
+		defer cancel()
+		d, ok := Remaining(ctx)
+		require.True(t, ok)
+		return d.Round(time.Second)
+	}
+
+	assert.Equal(t, time.Second, remaining(context.Background(), Standard))
+	assert.Equal(t, time.Minute, remaining(context.Background(), Long))
+	assert.Equal(t, 5*time.Second, remaining(WithRequested(context.Background(), 5*time.Second), Standard))
+	assert.Equal(t, 10*time.Second, remaining(WithRequested(context.Background(), time.Hour), Long), "requests are capped at Max")
+
+	// A caller's earlier deadline is kept
+	parent, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.Equal(t, 2*time.Second, remaining(parent, Long))
+}
+
+func TestSubBudgets(t *testing.T) {
+	b := Budgets{Standard: 10 * time.Second, Database: time.Second, Rules: 20 * time.Second}
+	ctx, cancel := b.Start(context.Background(), Standard)
+	defer cancel()
+
+	dbCtx, dbCancel := Database(ctx)
+	defer dbCancel()
+	d, _ := Remaining(dbCtx)
+	assert.Equal(t, time.Second, d.Round(time.Second))
+
+	rulesCtx, rulesCancel := Rules(ctx)
+	defer rulesCancel()
+	d, _ = Remaining(rulesCtx)
+	assert.Equal(t, 10*time.Second, d.Round(time.Second), "a sub-budget can't outlast the request")
+
+	// Without a budget, steps are left unlimited
+	plain, plainCancel := Database(context.Background())
+	defer plainCancel()
+	_, ok := Remaining(plain)
+	assert.False(t, ok)
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, Check(context.Background()))
+
+	b := Budgets{Standard: 10 * time.Millisecond, Reserve: time.Second}
+	ctx, cancel := b.Start(context.Background(), Standard)
+	defer cancel()
+	err := Check(ctx)
+	assert.ErrorIs(t, err, ErrExhausted, "less than the reserve is left")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	b.Reserve = 0
+	ctx, cancel = b.Start(context.Background(), Standard)
+	defer cancel()
+	assert.NoError(t, Check(ctx))
+	<-ctx.Done()
+	assert.ErrorIs(t, Check(ctx), ErrExhausted)
+}
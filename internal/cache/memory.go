@@ -49,6 +49,43 @@ func (c *InMemoryCache) Get(ctx context.Context, key string) (interface{}, bool)
 	return cacheEntry.value, true
 }
 
+// Add stores a key-value pair only if the key isn't already cached, and
+// reports whether it did. Concurrent Adds of a key store it once.
+func (c *InMemoryCache) Add(ctx context.Context, key string, value interface{}) bool {
+	entry := cacheEntry{value: value, expiresAt: time.Now().Add(c.ttl)}
+	for {
+		existing, loaded := c.data.LoadOrStore(key, entry)
+		if !loaded {
+			return true
+		}
+		old := existing.(cacheEntry)
+		if !time.Now().After(old.expiresAt) {
+			return false
+		}
+		// The cached entry has expired; replace it unless another Add
+		// already has
+		if c.data.CompareAndSwap(key, old, entry) {
+			return true
+		}
+	}
+}
+
+// Take retrieves a value and removes it from the cache, so that of
+// concurrent Takes of a key only one gets the value
+func (c *InMemoryCache) Take(ctx context.Context, key string) (interface{}, bool) {
+	entry, ok := c.data.LoadAndDelete(key)
+	if !ok {
+		return nil, false
+	}
+
+	cacheEntry := entry.(cacheEntry)
+	if time.Now().After(cacheEntry.expiresAt) {
+		return nil, false
+	}
+
+	return cacheEntry.value, true
+}
+
 // Delete removes a key-value pair from the cache
 func (c *InMemoryCache) Delete(ctx context.Context, key string) {
 	c.data.Delete(key)
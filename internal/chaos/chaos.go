@@ -0,0 +1,170 @@
+// Package chaos injects latency and errors into the authz service's
+// dependencies, so timeouts and failure handling can be exercised on
+// purpose in staging. Nothing is injected until a fault is set.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/jackc/pgx/v5"
+)
+
+// Points where faults can be injected
+const (
+	// PointDB is every database query
+	PointDB = "db"
+	// PointRuleCache is each rule lookup during a check
+	PointRuleCache = "rule_cache"
+)
+
+// Points lists every injection point
+var Points = []string{PointDB, PointRuleCache}
+
+// ErrInjected is the error an injected failure returns
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Fault describes what to do at a point
+type Fault struct {
+	// Latency delays every call, plus a random extra of up to Jitter
+	Latency config.Duration `json:"latency"`
+	Jitter  config.Duration `json:"jitter"`
+	// ErrorRate is the fraction of calls, from 0 to 1, that fail
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// Validate reports whether the fault can be applied
+func (f Fault) Validate() error {
+	if f.Latency < 0 || f.Jitter < 0 {
+		return errors.New("latency and jitter must not be negative")
+	}
+	if f.ErrorRate < 0 || f.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1, got %v", f.ErrorRate)
+	}
+	return nil
+}
+
+// Injector holds the faults in effect. A nil Injector injects nothing.
+type Injector struct {
+	mu     sync.RWMutex
+	faults map[string]Fault
+}
+
+// New returns an injector with no faults set
+func New() *Injector {
+	return &Injector{faults: make(map[string]Fault)}
+}
+
+// Set replaces the fault at point
+func (i *Injector) Set(point string, f Fault) error {
+	if !validPoint(point) {
+		return fmt.Errorf("unknown injection point %q", point)
+	}
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults[point] = f
+	return nil
+}
+
+// Clear removes the fault at point, or every fault when point is empty
+func (i *Injector) Clear(point string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if point == "" {
+		i.faults = make(map[string]Fault)
+		return
+	}
+	delete(i.faults, point)
+}
+
+// Faults returns the faults in effect by point
+func (i *Injector) Faults() map[string]Fault {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	faults := make(map[string]Fault, len(i.faults))
+	for point, f := range i.faults {
+		faults[point] = f
+	}
+	return faults
+}
+
+// Inject applies the fault at point: it waits out the latency, returning
+// early with ctx's error if ctx ends first, then fails at the error rate
+func (i *Injector) Inject(ctx context.Context, point string) error {
+	if i == nil {
+		return nil
+	}
+	i.mu.RLock()
+	f, ok := i.faults[point]
+	i.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	delay := time.Duration(f.Latency)
+	if f.Jitter > 0 {
+		delay += rand.N(time.Duration(f.Jitter))
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if f.ErrorRate > 0 && rand.Float64() < f.ErrorRate {
+		return fmt.Errorf("%w at %s", ErrInjected, point)
+	}
+	return nil
+}
+
+func validPoint(point string) bool {
+	for _, p := range Points {
+		if p == point {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryTracer returns a pgx tracer that injects PointDB faults into every
+// query, then hands off to next if it is set. A failed query sees its
+// context cancelled with ErrInjected as the cause, before anything is sent,
+// so the connection stays usable.
+func (i *Injector) QueryTracer(next pgx.QueryTracer) pgx.QueryTracer {
+	return &queryTracer{injector: i, next: next}
+}
+
+type queryTracer struct {
+	injector *Injector
+	next     pgx.QueryTracer
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.next != nil {
+		ctx = t.next.TraceQueryStart(ctx, conn, data)
+	}
+	if err := t.injector.Inject(ctx, PointDB); err != nil {
+		failed, cancel := context.WithCancelCause(ctx)
+		cancel(err)
+		return failed
+	}
+	return ctx
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if t.next != nil {
+		t.next.TraceQueryEnd(ctx, conn, data)
+	}
+}
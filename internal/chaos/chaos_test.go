@@ -0,0 +1,80 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectErrors(t *testing.T) {
+	i := New()
+	ctx := context.Background()
+	assert.NoError(t, i.Inject(ctx, PointDB), "nothing is injected before a fault is set")
+
+	require.NoError(t, i.Set(PointDB, Fault{ErrorRate: 1}))
+	assert.ErrorIs(t, i.Inject(ctx, PointDB), ErrInjected)
+	assert.NoError(t, i.Inject(ctx, PointRuleCache), "faults apply only to their point")
+
+	i.Clear(PointDB)
+	assert.NoError(t, i.Inject(ctx, PointDB))
+
+	var nilInjector *Injector
+	assert.NoError(t, nilInjector.Inject(ctx, PointDB))
+}
+
+func TestInjectLatency(t *testing.T) {
+	i := New()
+	require.NoError(t, i.Set(PointRuleCache, Fault{Latency: config.Duration(20 * time.Millisecond)}))
+
+	start := time.Now()
+	require.NoError(t, i.Inject(context.Background(), PointRuleCache))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	require.NoError(t, i.Set(PointRuleCache, Fault{Latency: config.Duration(time.Hour)}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, i.Inject(ctx, PointRuleCache), context.DeadlineExceeded, "latency gives way to the caller's deadline")
+}
+
+func TestSetValidates(t *testing.T) {
+	i := New()
+	assert.Error(t, i.Set("cache", Fault{}))
+	assert.Error(t, i.Set(PointDB, Fault{ErrorRate: 1.5}))
+	assert.Error(t, i.Set(PointDB, Fault{Latency: config.Duration(-time.Second)}))
+	assert.Empty(t, i.Faults())
+}
+
+type recordingTracer struct{ started, ended int }
+
+func (r *recordingTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	r.started++
+	return ctx
+}
+
+func (r *recordingTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {
+	r.ended++
+}
+
+func TestQueryTracer(t *testing.T) {
+	i := New()
+	next := &recordingTracer{}
+	tracer := i.QueryTracer(next)
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{})
+	assert.NoError(t, ctx.Err())
+
+	require.NoError(t, i.Set(PointDB, Fault{ErrorRate: 1}))
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{})
+	assert.Error(t, ctx.Err(), "a failed query starts with its context cancelled")
+	assert.True(t, errors.Is(context.Cause(ctx), ErrInjected))
+
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	assert.Equal(t, 2, next.started)
+	assert.Equal(t, 1, next.ended)
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/migrate"
+	"github.com/dangerclosesec/supra/internal/secrets"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateTarget string
+	migrateDB     string
+	migrateDownTo int64
+)
+
+func newMigrateCommand() *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage database schema migrations",
+		Long: `Apply, roll back and inspect the versioned SQL migrations embedded in this binary.
+The api target covers the application database, the authz target the identity graph database.`,
+	}
+
+	migrateUpCmd := &cobra.Command{
+		Use:   "up",
+		Short: "Apply all pending migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return forEachMigrator(cmd.Context(), func(ctx context.Context, m *migrate.Migrator) error {
+				results, err := m.Up(ctx)
+				for _, r := range results {
+					fmt.Printf("[%s] %s\n", m.Target(), r)
+				}
+				if err == nil && len(results) == 0 {
+					fmt.Printf("[%s] no pending migrations\n", m.Target())
+				}
+				return err
+			})
+		},
+	}
+
+	migrateDownCmd := &cobra.Command{
+		Use:   "down",
+		Short: "Roll back the latest migration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if migrateTarget == "all" {
+				return fmt.Errorf("down requires an explicit --target (api or authz)")
+			}
+
+			return forEachMigrator(cmd.Context(), func(ctx context.Context, m *migrate.Migrator) error {
+				if migrateDownTo >= 0 {
+					results, err := m.DownTo(ctx, migrateDownTo)
+					for _, r := range results {
+						fmt.Printf("[%s] %s\n", m.Target(), r)
+					}
+					return err
+				}
+
+				result, err := m.Down(ctx)
+				if result != nil {
+					fmt.Printf("[%s] %s\n", m.Target(), result)
+				}
+				return err
+			})
+		},
+	}
+
+	migrateStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show which migrations have been applied",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return forEachMigrator(cmd.Context(), func(ctx context.Context, m *migrate.Migrator) error {
+				statuses, err := m.Status(ctx)
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintf(w, "TARGET\tVERSION\tMIGRATION\tAPPLIED AT\n")
+				for _, s := range statuses {
+					applied := "pending"
+					if s.State == goose.StateApplied {
+						applied = s.AppliedAt.Format(time.RFC3339)
+					}
+					fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", m.Target(), s.Source.Version, s.Source.Path, applied)
+				}
+				return w.Flush()
+			})
+		},
+	}
+
+	migrateCmd.PersistentFlags().StringVarP(&migrateTarget, "target", "t", "all", "Database to migrate: api, authz or all")
+	migrateCmd.PersistentFlags().StringVarP(&migrateDB, "db", "d", "", "Connection string, overriding the configured one (requires a single --target)")
+	migrateDownCmd.Flags().Int64Var(&migrateDownTo, "to", -1, "Roll back every migration newer than this version instead of just the latest")
+
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+
+	return migrateCmd
+}
+
+// forEachMigrator connects to every selected database and runs fn against it
+func forEachMigrator(ctx context.Context, fn func(context.Context, *migrate.Migrator) error) error {
+	targets := migrate.Targets
+	if migrateTarget != "all" {
+		target, err := migrate.ParseTarget(migrateTarget)
+		if err != nil {
+			return err
+		}
+		targets = []migrate.Target{target}
+	} else if migrateDB != "" {
+		return fmt.Errorf("--db requires a single --target (api or authz)")
+	}
+
+	dsns, err := migrationDSNs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		db, err := sql.Open("pgx", dsns[target])
+		if err != nil {
+			return fmt.Errorf("opening %s database: %w", target, err)
+		}
+
+		m, err := migrate.New(db, target)
+		if err == nil {
+			err = fn(ctx, m)
+		}
+		db.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrationDSNs resolves the connection string of each database from the
+// shared configuration, honouring the --db override
+func migrationDSNs(ctx context.Context) (map[migrate.Target]string, error) {
+	path := globals.configPath
+	if path == "" {
+		path = os.Getenv(config.ConfigFileEnv)
+	}
+
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading configuration: %w", err)
+	}
+
+	if migrateDB == "" {
+		secretCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		if _, err := secrets.FromConfig(secretCtx, cfg, slog.Default()); err != nil {
+			return nil, fmt.Errorf("resolving secrets: %w", err)
+		}
+	}
+
+	dsns := map[migrate.Target]string{
+		migrate.TargetAPI:   cfg.DatabaseDSN(),
+		migrate.TargetAuthz: cfg.Authz.DatabaseURL,
+	}
+	if migrateDB != "" {
+		target, _ := migrate.ParseTarget(migrateTarget)
+		dsns[target] = migrateDB
+	}
+
+	return dsns, nil
+}
@@ -0,0 +1,370 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/database"
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/dangerclosesec/supra/internal/lifecycle"
+	"github.com/dangerclosesec/supra/internal/migrate"
+	"github.com/dangerclosesec/supra/internal/repository"
+	"github.com/dangerclosesec/supra/internal/secrets"
+	"github.com/dangerclosesec/supra/internal/service"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+type reconcileOptions struct {
+	batchSize int
+	dryRun    bool
+	timeout   time.Duration
+	entity    string
+	workers   int
+	resume    bool
+	reset     bool
+	planOut   string
+	applyPlan string
+	since     string
+	org       string
+	idRange   string
+	interval  time.Duration
+	listen    string
+}
+
+func newReconcileCommand() *cobra.Command {
+	var opts reconcileOptions
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Reconcile application entities with the permission graph",
+		Long: `Compare users and organizations in the application database with the
+permission graph and write any missing entities and relations.
+
+--since, --org and --id-range reconcile only matching entities, e.g. after
+fixing a sync bug that affected one organization. Filtered runs don't use
+checkpoints.
+
+With --interval it runs as a daemon, reconciling every interval and at once
+on SIGHUP, which also refreshes secrets. --listen serves /health and
+/version for probes. On SIGTERM a pass under way gets the shutdown timeout
+(SHUTDOWN_TIMEOUT) to finish.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReconcile(cmd.Context(), opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.IntVar(&opts.batchSize, "batch-size", 100, "Number of entities to process in a batch")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "Print what would be done without making changes")
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Minute, "Maximum time to run reconciliation")
+	flags.StringVar(&opts.entity, "entity", "all", "Entity types to reconcile: all, or a comma-separated list such as users,organizations")
+	flags.IntVar(&opts.workers, "workers", 4, "Number of batches to process concurrently per entity type")
+	flags.BoolVar(&opts.resume, "resume", true, "Resume from the last saved checkpoint instead of starting over")
+	flags.BoolVar(&opts.reset, "reset-checkpoint", false, "Discard saved checkpoints before running")
+	flags.StringVar(&opts.planOut, "plan-out", "", "With --dry-run, write the change plan as JSON to this file")
+	flags.StringVar(&opts.applyPlan, "apply-plan", "", "Execute a previously reviewed plan file instead of reconciling")
+	flags.StringVar(&opts.since, "since", "", "Only entities updated since a time (RFC 3339 or 2006-01-02) or a duration ago (e.g. 24h)")
+	flags.StringVar(&opts.org, "org", "", "Only this organization and its members, by organization ID")
+	flags.StringVar(&opts.idRange, "id-range", "", "Only entities with IDs in FROM..TO, inclusive; either end may be omitted")
+	flags.DurationVar(&opts.interval, "interval", 0, "Keep running, reconciling this often, instead of exiting after one pass; --timeout bounds each pass")
+	flags.StringVar(&opts.listen, "listen", "", "With --interval, serve /health and /version on this address, e.g. :8081")
+
+	return cmd
+}
+
+// reconcileFilter builds the entity filter from the --since, --org and
+// --id-range flags, reading durations back from now
+func reconcileFilter(opts reconcileOptions, now time.Time) (repository.EntityFilter, error) {
+	var filter repository.EntityFilter
+
+	if opts.since != "" {
+		if d, err := time.ParseDuration(opts.since); err == nil {
+			filter.UpdatedSince = now.Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, opts.since); err == nil {
+			filter.UpdatedSince = t
+		} else if t, err := time.Parse(time.DateOnly, opts.since); err == nil {
+			filter.UpdatedSince = t
+		} else {
+			return filter, fmt.Errorf("--since %q is not a duration, RFC 3339 time or date", opts.since)
+		}
+	}
+
+	if opts.org != "" {
+		id, err := uuid.Parse(opts.org)
+		if err != nil {
+			return filter, fmt.Errorf("--org: %w", err)
+		}
+		filter.OrganizationID = id
+	}
+
+	if opts.idRange != "" {
+		from, to, ok := strings.Cut(opts.idRange, "..")
+		if !ok {
+			return filter, fmt.Errorf("--id-range %q is not in FROM..TO form", opts.idRange)
+		}
+		var err error
+		if from != "" {
+			if filter.MinID, err = uuid.Parse(from); err != nil {
+				return filter, fmt.Errorf("--id-range: %w", err)
+			}
+		}
+		if to != "" {
+			if filter.MaxID, err = uuid.Parse(to); err != nil {
+				return filter, fmt.Errorf("--id-range: %w", err)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+func runReconcile(ctx context.Context, opts reconcileOptions) error {
+	logger := slog.Default()
+
+	if opts.planOut != "" && !opts.dryRun {
+		return fmt.Errorf("--plan-out requires --dry-run")
+	}
+	if opts.interval > 0 && (opts.planOut != "" || opts.applyPlan != "") {
+		return fmt.Errorf("--interval can't be combined with --plan-out or --apply-plan")
+	}
+	if opts.listen != "" && opts.interval <= 0 {
+		return fmt.Errorf("--listen requires --interval")
+	}
+	filter, err := reconcileFilter(opts, time.Now())
+	if err != nil {
+		return err
+	}
+
+	cfg, secretManager, err := loadConfig(ctx, config.ServiceReconcile)
+	if err != nil {
+		return err
+	}
+	secretManager.Start()
+	defer secretManager.Stop()
+
+	// Initialize database
+	db, err := database.Open(cfg, secretManager, dbtrace.New(dbtrace.Options{
+		Database:      "api",
+		SlowThreshold: cfg.Database.SlowQueryThreshold.Std(),
+		LogQueries:    cfg.Database.LogQueries,
+	}))
+	if err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+
+	// Initialize repositories
+	userRepo := repository.NewUserRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+
+	// Initialize Supra service
+	supraService, err := auth.NewSupraService(cfg.Supra.Host)
+	if err != nil {
+		return fmt.Errorf("initializing supra service: %w", err)
+	}
+
+	// Initialize entity sync service
+	entitySyncService := service.NewEntitySyncService(supraService)
+
+	// Initialize reconciliation service
+	reconciliationService := service.NewEntityReconciliationService(
+		userRepo,
+		orgRepo,
+		entitySyncService,
+		0, // Interval doesn't matter for one-time sync
+		logger,
+	)
+
+	// Configure the reconciliation service
+	reconciliationService.SetBatchSize(opts.batchSize)
+	reconciliationService.SetDryRun(opts.dryRun)
+	reconciliationService.SetWorkers(opts.workers)
+
+	// Create context with timeout; a daemon applies it to each pass instead
+	runCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	// Apply a reviewed plan and exit without re-reading the application database
+	if opts.applyPlan != "" {
+		plan, err := service.ReadPlanFile(opts.applyPlan)
+		if err != nil {
+			return fmt.Errorf("loading plan: %w", err)
+		}
+		if err := reconciliationService.ApplyPlan(runCtx, plan); err != nil {
+			return fmt.Errorf("applying plan: %w", err)
+		}
+		logger.Info("plan applied successfully", "plan", opts.applyPlan)
+		return nil
+	}
+
+	var plan *service.ReconciliationPlan
+	if opts.planOut != "" {
+		plan = service.NewReconciliationPlan()
+		reconciliationService.SetPlan(plan)
+	}
+
+	// Enable checkpointing so interrupted runs can pick up where they left off
+	if opts.resume || opts.reset {
+		reconciliationService.SetCheckpointStore(repository.NewReconciliationCheckpointRepository(db))
+	}
+	if opts.reset {
+		if err := reconciliationService.ResetCheckpoints(runCtx); err != nil {
+			return fmt.Errorf("resetting checkpoints: %w", err)
+		}
+		if !opts.resume {
+			reconciliationService.SetCheckpointStore(nil)
+		}
+	}
+
+	if opts.interval > 0 {
+		lifecycle.Banner(logger, "reconcile", "interval", opts.interval, "listen", opts.listen)
+		return runReconcileDaemon(ctx, cfg, db, secretManager, reconciliationService, opts)
+	}
+
+	if err := reconcileOnce(runCtx, reconciliationService, opts.entity, filter); err != nil {
+		return err
+	}
+
+	if plan != nil {
+		if err := plan.WriteFile(opts.planOut); err != nil {
+			return fmt.Errorf("writing plan: %w", err)
+		}
+		logger.Info("wrote reconciliation plan",
+			"path", opts.planOut,
+			"entities", len(plan.Entities),
+			"relations", len(plan.Relations),
+		)
+	}
+
+	logger.Info("reconciliation completed successfully")
+	return nil
+}
+
+// reconcileOnce reconciles the sources named by the entity flag
+func reconcileOnce(ctx context.Context, svc *service.EntityReconciliationService, entity string, filter repository.EntityFilter) error {
+	sources := svc.Sources()
+	if entity != "all" {
+		sources = strings.Split(entity, ",")
+	}
+	slog.Info("reconciling entities", "entity_types", sources, "filtered", !filter.IsZero())
+	for _, name := range sources {
+		if err := svc.Reconcile(ctx, strings.TrimSpace(name), filter); err != nil {
+			return fmt.Errorf("reconciliation failed: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// runReconcileDaemon reconciles every interval until ctx ends, and at once
+// on SIGHUP. Passes run detached from ctx, so one under way at shutdown can
+// finish within the shutdown timeout; checkpoints let the next run resume
+// one that doesn't.
+func runReconcileDaemon(
+	ctx context.Context,
+	cfg *config.Config,
+	db *gorm.DB,
+	secretManager *secrets.Manager,
+	svc *service.EntityReconciliationService,
+	opts reconcileOptions,
+) error {
+	logger := slog.Default()
+	var drain lifecycle.Drainer
+
+	if opts.listen != "" {
+		srv := &http.Server{
+			Addr:              opts.listen,
+			Handler:           reconcileProbes(&drain, db),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("probe server failed", "addr", opts.listen, "error", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	now := make(chan struct{}, 1)
+	go lifecycle.OnHangup(ctx, func() {
+		logger.Info("SIGHUP received, refreshing secrets and reconciling now")
+		refreshSecrets(ctx, secretManager)
+		select {
+		case now <- struct{}{}:
+		default:
+		}
+	})
+
+	for {
+		filter, err := reconcileFilter(opts, time.Now())
+		if err != nil {
+			return err
+		}
+
+		passCtx, cancelPass := context.WithTimeout(context.WithoutCancel(ctx), opts.timeout)
+		done := make(chan error, 1)
+		go func() { done <- reconcileOnce(passCtx, svc, opts.entity, filter) }()
+
+		select {
+		case err := <-done:
+			cancelPass()
+			if err != nil {
+				logger.Error("reconcile pass failed", "error", err)
+			} else {
+				logger.Info("reconcile pass completed", "next_in", opts.interval)
+			}
+		case <-ctx.Done():
+			logger.Info("shutdown started, waiting for the reconcile pass", "timeout", cfg.Shutdown.Timeout.Std())
+			return drain.Shutdown(0, cfg.Shutdown.Timeout.Std(), func(shutdownCtx context.Context) error {
+				defer cancelPass()
+				select {
+				case err := <-done:
+					return err
+				case <-shutdownCtx.Done():
+					cancelPass()
+					<-done
+					return fmt.Errorf("reconcile pass cut short at shutdown; the next run resumes from its checkpoint")
+				}
+			})
+		}
+
+		select {
+		case <-time.After(opts.interval):
+		case <-now:
+		case <-ctx.Done():
+			drain.Shutdown(0, cfg.Shutdown.Timeout.Std(), func(context.Context) error { return nil })
+			return nil
+		}
+	}
+}
+
+// reconcileProbes serves the daemon's /health and /version
+func reconcileProbes(drain *lifecycle.Drainer, db *gorm.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if drain.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"draining"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"healthy"}`))
+	})
+	mux.Handle("/version", lifecycle.VersionHandler("reconcile", func(ctx context.Context, info *lifecycle.Info) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		info.DatabaseVersion, err = migrate.CurrentVersion(ctx, sqlDB, migrate.TargetAPI)
+		return err
+	}))
+	return mux
+}
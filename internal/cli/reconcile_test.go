@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileFilter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	from, to := uuid.New(), uuid.New()
+
+	filter, err := reconcileFilter(reconcileOptions{}, now)
+	require.NoError(t, err)
+	assert.True(t, filter.IsZero())
+
+	filter, err = reconcileFilter(reconcileOptions{since: "24h", org: from.String(), idRange: from.String() + ".." + to.String()}, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-24*time.Hour), filter.UpdatedSince)
+	assert.Equal(t, from, filter.OrganizationID)
+	assert.Equal(t, from, filter.MinID)
+	assert.Equal(t, to, filter.MaxID)
+
+	filter, err = reconcileFilter(reconcileOptions{since: "2025-05-01", idRange: ".." + to.String()}, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), filter.UpdatedSince)
+	assert.Equal(t, uuid.Nil, filter.MinID)
+	assert.Equal(t, to, filter.MaxID)
+
+	for _, opts := range []reconcileOptions{
+		{since: "last week"},
+		{org: "acme"},
+		{idRange: from.String()},
+		{idRange: "a..b"},
+	} {
+		_, err := reconcileFilter(opts, now)
+		assert.Error(t, err, opts)
+	}
+}
@@ -0,0 +1,158 @@
+// Package cli implements the supra command line: the API and authz servers,
+// reconciliation, permission schema management and database migrations behind
+// one binary with shared configuration and logging.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+// globalOptions are the flags shared by every subcommand
+type globalOptions struct {
+	configPath string
+	logLevel   string
+	logFormat  string
+	verbose    bool
+}
+
+var globals globalOptions
+
+// NewRootCommand builds the supra command tree
+func NewRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "supra",
+		Short: "Supra runs and administers the supra identity and authorization services",
+		Long: `Supra bundles the API server, the authorization service, entity reconciliation,
+permission schema tooling and database migrations in a single binary.`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := newLogger(globals.logLevel, globals.logFormat)
+			if err != nil {
+				return err
+			}
+			slog.SetDefault(logger)
+			return nil
+		},
+	}
+
+	root.PersistentFlags().StringVarP(&globals.configPath, "config", "c", "", "Config file (.yaml, .toml or .json); defaults to $"+config.ConfigFileEnv)
+	root.PersistentFlags().StringVar(&globals.logLevel, "log-level", "info", "Log level: debug, info, warn or error")
+	root.PersistentFlags().StringVar(&globals.logFormat, "log-format", "json", "Log format: json or text")
+	root.PersistentFlags().BoolVarP(&globals.verbose, "verbose", "v", false, "Enable verbose output")
+
+	root.AddCommand(newServeCommand())
+	root.AddCommand(newReconcileCommand())
+	root.AddCommand(newSchemaCommand())
+	root.AddCommand(newMigrateCommand())
+	root.AddCommand(newAuditCommand())
+	root.AddCommand(newVersionCommand())
+
+	return root
+}
+
+// Execute runs the supra command line with os.Args and exits on failure
+func Execute() {
+	ExecuteArgs(os.Args[1:])
+}
+
+// ExecuteArgs runs the supra command line with the given arguments. The
+// standalone binaries use it to forward to their subcommand.
+func ExecuteArgs(args []string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	root := NewRootCommand()
+	root.SetArgs(args)
+	if err := root.ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// newLogger creates the process-wide structured logger
+func newLogger(level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:     lvl,
+		AddSource: lvl <= slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{
+					Key:   a.Key,
+					Value: slog.StringValue(a.Value.Time().Format(time.RFC3339)),
+				}
+			}
+			return a
+		},
+	}
+
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stdout, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid --log-format %q (expected json or text)", format)
+	}
+}
+
+// configPath is the config file named by --config or SUPRA_CONFIG, if any
+func configPath() string {
+	if globals.configPath != "" {
+		return globals.configPath
+	}
+	return os.Getenv(config.ConfigFileEnv)
+}
+
+// reloadConfig re-reads the configuration of a running service. Secret
+// references are left unresolved, so only plain settings can be reloaded.
+func reloadConfig(service config.Service) (*config.Config, error) {
+	cfg, err := config.LoadFile(configPath())
+	if err != nil {
+		return nil, fmt.Errorf("loading configuration: %w", err)
+	}
+	if err := cfg.Validate(service); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// loadConfig reads the shared configuration, resolves secret references and
+// validates the settings service needs. The returned manager is not started.
+func loadConfig(ctx context.Context, service config.Service) (*config.Config, *secrets.Manager, error) {
+	cfg, err := config.LoadFile(configPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading configuration: %w", err)
+	}
+
+	// Resolve secrets held in Vault, AWS Secrets Manager or KMS-encrypted files
+	secretCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	secretManager, err := secrets.FromConfig(secretCtx, cfg, slog.Default())
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving secrets: %w", err)
+	}
+
+	if err := cfg.Validate(service); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	slog.Info("effective configuration", "service", service, "config", cfg.Redacted())
+
+	return cfg, secretManager, nil
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootCommandTree(t *testing.T) {
+	root := NewRootCommand()
+
+	for _, path := range [][]string{
+		{"serve", "api"},
+		{"serve", "authz"},
+		{"reconcile"},
+		{"schema", "migrate"},
+		{"schema", "test"},
+		{"schema", "rollback"},
+		{"schema", "validate"},
+		{"schema", "export"},
+		{"migrate", "status"},
+		{"version"},
+	} {
+		cmd, _, err := root.Find(path)
+		require.NoError(t, err, path)
+		assert.Equal(t, path[len(path)-1], cmd.Name())
+	}
+
+	// Building the tree twice must not redefine flags
+	assert.NotPanics(t, func() { NewRootCommand() })
+}
+
+func TestNewLogger(t *testing.T) {
+	_, err := newLogger("debug", "text")
+	assert.NoError(t, err)
+
+	_, err = newLogger("loud", "json")
+	assert.ErrorContains(t, err, "--log-level")
+
+	_, err = newLogger("info", "xml")
+	assert.ErrorContains(t, err, "--log-format")
+}
@@ -0,0 +1,750 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/authzserver"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/permissions/lint"
+	"github.com/dangerclosesec/supra/permissions/migration"
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/permissions/parser"
+	"github.com/dangerclosesec/supra/permissions/schematest"
+	"github.com/dangerclosesec/supra/pkg/graph"
+	_ "github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var schemaDB string
+
+func newSchemaCommand() *cobra.Command {
+	schema := &cobra.Command{
+		Use:     "schema",
+		Aliases: []string{"permify"},
+		Short:   "Parse, migrate and version permission models",
+		Long: `Manage .perm permission models stored in the authz database. The database
+defaults to the configured authz database URL.`,
+	}
+	schema.PersistentFlags().StringVarP(&schemaDB, "db", "d", "", "Database connection string (defaults to authz.database_url)")
+
+	schema.AddCommand(&cobra.Command{
+		Use:   "parse [file]",
+		Short: "Parse a .perm file",
+		Long:  `Parse a .perm file and display its contents.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filePath := args[0]
+			permModel, err := parseModel(filePath)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Successfully parsed %s\n", filePath)
+			fmt.Printf("Found %d entities\n", len(permModel.Entities))
+
+			if globals.verbose {
+				for name, entity := range permModel.Entities {
+					fmt.Printf("\nEntity: %s\n", name)
+
+					fmt.Printf("  Relations (%d):\n", len(entity.Relations)+len(entity.DerivedRelations))
+					for _, rel := range entity.Relations {
+						if rel.MaxSubjects > 0 {
+							fmt.Printf("    - %s @%s max %d\n", rel.Name, rel.Target, rel.MaxSubjects)
+							continue
+						}
+						fmt.Printf("    - %s @%s\n", rel.Name, rel.Target)
+					}
+					for _, derived := range entity.DerivedRelations {
+						fmt.Printf("    - %s\n", derived)
+					}
+
+					fmt.Printf("  Permissions (%d):\n", len(entity.Permissions))
+					for _, perm := range entity.Permissions {
+						var notes []string
+						if perm.Deprecated {
+							notes = append(notes, "deprecated")
+						}
+						if perm.Sensitive {
+							notes = append(notes, "sensitive")
+						}
+						if len(notes) > 0 {
+							fmt.Printf("    - %s = %s (%s)\n", perm.Name, perm.Expression, strings.Join(notes, ", "))
+							continue
+						}
+						fmt.Printf("    - %s = %s\n", perm.Name, perm.Expression)
+					}
+				}
+			}
+			return nil
+		},
+	})
+
+	schema.AddCommand(&cobra.Command{
+		Use:   "test [schema] [assertions.yaml]",
+		Short: "Run a schema's rule tests and permission assertions",
+		Long: `Evaluate every case of the schema's rule test blocks against the rules it
+declares, without a database:
+
+  test check_balance {
+      balance = 100, amount = 50 => true
+  }
+
+Given an assertion file, also load its relationships and attributes into
+memory and check each of its assertions against the schema:
+
+  schema: !include permissions/schema.perm
+  relationships:
+    - organization:acme#owner@user:alice
+  scenarios:
+    - name: "Owners manage their organization"
+      checks:
+        - entity: "organization:acme"
+          subject: "user:alice"
+          assertions:
+            manage_organization: true
+
+An assertion file alone is tested against the schema it includes.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			schemaPath, assertionsPath := args[0], ""
+			if len(args) == 2 {
+				assertionsPath = args[1]
+			} else if ext := filepath.Ext(schemaPath); ext == ".yaml" || ext == ".yml" {
+				schemaPath, assertionsPath = "", schemaPath
+			}
+
+			var assertions *schematest.File
+			if assertionsPath != "" {
+				var err error
+				if assertions, err = schematest.ReadFile(assertionsPath); err != nil {
+					return err
+				}
+			}
+
+			var permModel *model.PermissionModel
+			var err error
+			if schemaPath != "" {
+				permModel, err = parseModel(schemaPath)
+			} else {
+				permModel, err = assertions.LoadModel()
+			}
+			if err != nil {
+				return err
+			}
+
+			ruleErr := runRuleTests(cmd.Context(), permModel)
+			if assertions == nil {
+				return ruleErr
+			}
+			return errors.Join(ruleErr, runAssertions(cmd.Context(), permModel, assertions))
+		},
+	})
+
+	var validateStrict bool
+	validateCmd := &cobra.Command{
+		Use:   "validate [file]",
+		Short: "Check a .perm file for mistakes beyond parse errors",
+		Long: `Parse a .perm file and lint the model: references to undeclared relations,
+permissions and attributes, relations to undeclared entities, rule calls
+with the wrong number of arguments, permissions that depend on themselves
+and permissions that can never be granted. Diagnostics are printed as
+file:line: severity: message. Exits non-zero if any error is found, or any
+warning with --strict, for use in CI.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return validateSchema(args[0], validateStrict)
+		},
+	}
+	validateCmd.Flags().BoolVar(&validateStrict, "strict", false, "Fail on warnings as well as errors")
+	schema.AddCommand(validateCmd)
+
+	schema.AddCommand(&cobra.Command{
+		Use:   "init",
+		Short: "Initialize the database schema",
+		Long:  `Initialize the database schema for permission models.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSchemaDB(cmd.Context(), func(db *sql.DB) error {
+				if err := migration.NewMigrator(db).InitializeSchema(); err != nil {
+					return fmt.Errorf("initializing schema: %w", err)
+				}
+				fmt.Println("Schema initialized successfully")
+				return nil
+			})
+		},
+	})
+
+	var dryRun bool
+	migrateCmd := &cobra.Command{
+		Use:   "migrate [file]",
+		Short: "Apply a permission model to the database",
+		Long: `Parse a .perm file and apply it to the database.
+
+With --dry-run the database isn't changed: the changes and the SQL statements
+applying them would execute are printed for review instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filePath := args[0]
+			permModel, err := parseModel(filePath)
+			if err != nil {
+				return err
+			}
+
+			return withSchemaDB(cmd.Context(), func(db *sql.DB) error {
+				migrator := migration.NewMigrator(db)
+				limits, err := schemaConditionLimits()
+				if err != nil {
+					return err
+				}
+				migrator.ConditionLimits = limits
+
+				description := fmt.Sprintf("Migration from %s at %s",
+					filepath.Base(filePath), time.Now().Format(time.RFC3339))
+
+				if dryRun {
+					return printMigrationPlan(migrator, permModel, description)
+				}
+
+				// Initialize schema if needed
+				if err := migrator.InitializeSchema(); err != nil {
+					return fmt.Errorf("initializing schema: %w", err)
+				}
+
+				diff, err := migrator.ApplyMigration(permModel, description)
+				if err != nil {
+					return fmt.Errorf("applying migration: %w", err)
+				}
+
+				if diff == "No changes detected. Migration skipped." {
+					fmt.Println(diff)
+					return nil
+				}
+
+				fmt.Println("Migration applied successfully")
+				if globals.verbose {
+					fmt.Println("\nChanges:")
+					fmt.Println(diff)
+				}
+
+				version, err := migrator.GetCurrentVersion()
+				if err != nil {
+					return fmt.Errorf("getting current version: %w", err)
+				}
+				fmt.Printf("Current version: %d\n", version)
+				return nil
+			})
+		},
+	}
+	migrateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the changes and SQL without applying them")
+	schema.AddCommand(migrateCmd)
+
+	schema.AddCommand(&cobra.Command{
+		Use:   "rollback [version]",
+		Short: "Restore a previous permission model version",
+		Long: `Restore the permission model a past migration applied, by default the one
+before the current version, and print the changes made. The rollback is
+recorded as a new version, so it can itself be rolled back. Derived
+relations and relation and attribute declarations are not versioned and are
+left as they are.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSchemaDB(cmd.Context(), func(db *sql.DB) error {
+				migrator := migration.NewMigrator(db)
+				if err := migrator.InitializeSchema(); err != nil {
+					return fmt.Errorf("initializing schema: %w", err)
+				}
+
+				current, err := migrator.GetCurrentVersion()
+				if err != nil {
+					return fmt.Errorf("getting current version: %w", err)
+				}
+				target := current - 1
+				if len(args) == 1 {
+					if target, err = strconv.Atoi(args[0]); err != nil {
+						return fmt.Errorf("invalid version %q", args[0])
+					}
+				}
+				if target < 1 || target >= current {
+					return fmt.Errorf("no version to roll back to: version must be between 1 and %d", current-1)
+				}
+
+				diff, err := migrator.Rollback(target)
+				if err != nil {
+					return fmt.Errorf("rolling back to version %d: %w", target, err)
+				}
+				if diff == "No changes detected. Migration skipped." {
+					fmt.Printf("Version %d matches the current model. Rollback skipped.\n", target)
+					return nil
+				}
+
+				fmt.Printf("Rolled back to version %d\n", target)
+				fmt.Println("\nChanges:")
+				fmt.Println(diff)
+
+				version, err := migrator.GetCurrentVersion()
+				if err != nil {
+					return fmt.Errorf("getting current version: %w", err)
+				}
+				fmt.Printf("Current version: %d\n", version)
+				return nil
+			})
+		},
+	})
+
+	schema.AddCommand(&cobra.Command{
+		Use:   "diff [file]",
+		Short: "Show differences between a .perm file and the current database",
+		Long:  `Parse a .perm file and show differences compared to the current database.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			permModel, err := parseModel(args[0])
+			if err != nil {
+				return err
+			}
+
+			return withSchemaDB(cmd.Context(), func(db *sql.DB) error {
+				currentModel, err := migration.NewMigrator(db).LoadCurrentModel()
+				if err != nil {
+					return fmt.Errorf("loading current model: %w", err)
+				}
+
+				fmt.Println(migration.GenerateDiff(currentModel, permModel).String())
+				return nil
+			})
+		},
+	})
+
+	var exportOutput string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the database's permission model as a .perm file",
+		Long: `Rebuild a .perm file from the permission and rule definitions and the
+relation and attribute declarations in the database, to get back to a
+canonical schema file after changes made through the API. Entities are
+written by name and rules after them, so the file may be ordered
+differently from the one originally migrated.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSchemaDB(cmd.Context(), func(db *sql.DB) error {
+				permModel, err := migration.NewMigrator(db).ExportModel()
+				if err != nil {
+					return fmt.Errorf("exporting model: %w", err)
+				}
+				source := model.Format(permModel)
+
+				p := parser.NewParser(parser.NewLexer(source))
+				p.ParsePermissionModel()
+				for _, parseErr := range p.Errors() {
+					fmt.Fprintf(os.Stderr, "warning: the exported schema doesn't parse: %s\n", parseErr)
+				}
+
+				if exportOutput == "" {
+					fmt.Print(source)
+					return nil
+				}
+				if err := os.WriteFile(exportOutput, []byte(source), 0o644); err != nil {
+					return err
+				}
+				fmt.Printf("Wrote %s\n", exportOutput)
+				return nil
+			})
+		},
+	}
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "File to write instead of stdout")
+	schema.AddCommand(exportCmd)
+
+	var reverseLimit int
+	reverseCmd := &cobra.Command{
+		Use:   "reverse-relations [file]",
+		Short: "List relation tuples stored in the reverse direction",
+		Long: `List tuples of the relations declared in a .perm file that are stored
+object->subject with no subject->object counterpart. They only match through
+the bidirectional fallback, so fix them before enabling
+authz.strict_relation_direction for their entity type.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			permModel, err := parseModel(args[0])
+			if err != nil {
+				return err
+			}
+			return printReverseRelations(cmd.Context(), permModel, reverseLimit)
+		},
+	}
+	reverseCmd.Flags().IntVar(&reverseLimit, "limit", 100, "Maximum tuples listed per relation")
+	schema.AddCommand(reverseCmd)
+
+	var analyzeSince time.Duration
+	analyzeCmd := &cobra.Command{
+		Use:   "analyze",
+		Short: "Report who still checks deprecated permissions",
+		Long: `List the permissions the current model marks @deprecated and the callers
+that checked them within --since, from the audit log. Checks of deprecated
+permissions are always audited, so a permission no caller has checked for
+long enough can be removed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSchemaDB(cmd.Context(), func(db *sql.DB) error {
+				return printDeprecatedCallers(db, time.Now().Add(-analyzeSince))
+			})
+		},
+	}
+	analyzeCmd.Flags().DurationVar(&analyzeSince, "since", 30*24*time.Hour, "How far back to look for callers")
+	schema.AddCommand(analyzeCmd)
+
+	schema.AddCommand(&cobra.Command{
+		Use:   "version",
+		Short: "Show the current permission model version",
+		Long:  `Show the current permission model version in the database.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSchemaDB(cmd.Context(), printSchemaVersion)
+		},
+	})
+
+	return schema
+}
+
+// parseModel parses a .perm file, turning parser diagnostics into an error
+func parseModel(filePath string) (*model.PermissionModel, error) {
+	permModel, parseErrors, err := parser.ParseFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filePath, err)
+	}
+	if len(parseErrors) > 0 {
+		return nil, errors.New("parsing errors:\n  - " + strings.Join(parseErrors, "\n  - "))
+	}
+	return permModel, nil
+}
+
+// printMigrationPlan prints the diff and SQL statements applying permModel
+// would execute, without changing the database
+func printMigrationPlan(migrator *migration.Migrator, permModel *model.PermissionModel, description string) error {
+	plan, err := migrator.PlanMigration(permModel, description)
+	if err != nil {
+		return fmt.Errorf("planning migration: %w", err)
+	}
+	if plan.IsEmpty() {
+		fmt.Println("No changes detected. Nothing would be applied.")
+		return nil
+	}
+
+	fmt.Printf("Dry run: version %d would be applied with these changes:\n\n", plan.Version)
+	fmt.Println(plan.Diff.String())
+	fmt.Println("\nSQL:")
+	fmt.Println()
+	fmt.Print(plan.SQL())
+	return nil
+}
+
+// runRuleTests prints each failing rule test case, and every case when
+// verbose, and fails if any case failed
+func runRuleTests(ctx context.Context, permModel *model.PermissionModel) error {
+	results := graph.RunRuleTests(ctx, permModel)
+	if len(results) == 0 {
+		fmt.Println("No rule tests found")
+		return nil
+	}
+
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("FAIL %s: %v\n", result, result.Err)
+		case !result.Passed():
+			failed++
+			fmt.Printf("FAIL %s: got %v, want %v\n", result, result.Got, result.Expected)
+		case globals.verbose:
+			fmt.Printf("ok   %s\n", result)
+		}
+	}
+
+	fmt.Printf("%d of %d rule test cases passed\n", len(results)-failed, len(results))
+	if failed > 0 {
+		return fmt.Errorf("%d rule test case(s) failed", failed)
+	}
+	return nil
+}
+
+// runAssertions prints each failing assertion of an assertion file, and
+// every assertion when verbose, and fails if any assertion failed
+func runAssertions(ctx context.Context, permModel *model.PermissionModel, assertions *schematest.File) error {
+	results, err := schematest.Run(ctx, permModel, assertions)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("FAIL %s: %v\n", result, result.Err)
+		case !result.Passed():
+			failed++
+			fmt.Printf("FAIL %s: got %v, want %v\n", result, result.Got, result.Expected)
+		case globals.verbose:
+			fmt.Printf("ok   %s\n", result)
+		}
+	}
+
+	fmt.Printf("%d of %d assertions passed\n", len(results)-failed, len(results))
+	if failed > 0 {
+		return fmt.Errorf("%d assertion(s) failed", failed)
+	}
+	return nil
+}
+
+// schemaConnString returns the authz database named by --db or the shared
+// configuration
+func schemaConnString(ctx context.Context) (string, error) {
+	if schemaDB != "" {
+		return schemaDB, nil
+	}
+	cfg, _, err := loadConfig(ctx, config.ServiceAuthz)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Authz.DatabaseURL, nil
+}
+
+// validateSchema prints a .perm file's parse errors and lint diagnostics,
+// failing if there are parse errors or lint errors, or warnings if strict
+func validateSchema(filePath string, strict bool) error {
+	permModel, parseErrors, err := parser.ParseFile(filePath)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", filePath, err)
+	}
+	for _, msg := range parseErrors {
+		fmt.Printf("%s: error: %s\n", filePath, msg)
+	}
+	if len(parseErrors) > 0 {
+		return fmt.Errorf("%s has %d parse error(s)", filePath, len(parseErrors))
+	}
+
+	diagnostics := lint.Lint(permModel)
+	warnings := 0
+	for _, d := range diagnostics {
+		fmt.Printf("%s:%d: %s: %s\n", filePath, d.Line, d.Severity, d.Message)
+		if d.Severity == lint.SeverityWarning {
+			warnings++
+		}
+	}
+	errs := len(diagnostics) - warnings
+	switch {
+	case errs > 0:
+		return fmt.Errorf("%s has %d error(s) and %d warning(s)", filePath, errs, warnings)
+	case strict && warnings > 0:
+		return fmt.Errorf("%s has %d warning(s)", filePath, warnings)
+	}
+	fmt.Printf("%s is valid", filePath)
+	if warnings > 0 {
+		fmt.Printf(" with %d warning(s)", warnings)
+	}
+	fmt.Println()
+	return nil
+}
+
+// schemaConditionLimits returns the limits on permission conditions the
+// authorization service enforces, so a migration can't write a condition
+// the API would reject
+func schemaConditionLimits() (graph.ConditionLimits, error) {
+	cfg, err := config.LoadFile(configPath())
+	if err != nil {
+		return graph.ConditionLimits{}, fmt.Errorf("loading configuration: %w", err)
+	}
+	return authzserver.ConditionLimits(cfg), nil
+}
+
+// withSchemaDB opens the authz database and passes it to fn
+func withSchemaDB(ctx context.Context, fn func(db *sql.DB) error) error {
+	connString, err := schemaConnString(ctx)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	return fn(db)
+}
+
+func printSchemaVersion(db *sql.DB) error {
+	version, err := migration.NewMigrator(db).GetCurrentVersion()
+	if err != nil {
+		return fmt.Errorf("getting current version: %w", err)
+	}
+
+	fmt.Printf("Current permission model version: %d\n", version)
+	if !globals.verbose {
+		return nil
+	}
+
+	rows, err := db.Query(`
+		SELECT version, description, source_file, applied_at
+		FROM permission_versions
+		ORDER BY version DESC
+	`)
+	if err != nil {
+		return fmt.Errorf("getting version history: %w", err)
+	}
+	defer rows.Close()
+
+	fmt.Println("\nVersion history:")
+	fmt.Println("----------------")
+
+	for rows.Next() {
+		var v int
+		var desc, sourceFile string
+		var appliedAt time.Time
+		if err := rows.Scan(&v, &desc, &sourceFile, &appliedAt); err != nil {
+			return fmt.Errorf("scanning version: %w", err)
+		}
+
+		fmt.Printf("Version %d (applied %s)\n", v, appliedAt.Format(time.RFC3339))
+		fmt.Printf("  Source: %s\n", sourceFile)
+		fmt.Printf("  Description: %s\n\n", desc)
+	}
+
+	return rows.Err()
+}
+
+// printDeprecatedCallers reports the deprecated permissions and who has
+// checked each since the given time
+func printDeprecatedCallers(db *sql.DB, since time.Time) error {
+	rows, err := db.Query(`
+		SELECT entity_type, permission_name, deprecated
+		FROM permission_definitions
+		WHERE deprecated IS NOT NULL
+		ORDER BY entity_type, permission_name
+	`)
+	if err != nil {
+		return fmt.Errorf("listing deprecated permissions: %w", err)
+	}
+	type deprecated struct {
+		entityType, permission, message string
+	}
+	var permissions []deprecated
+	for rows.Next() {
+		var d deprecated
+		if err := rows.Scan(&d.entityType, &d.permission, &d.message); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning deprecated permission: %w", err)
+		}
+		permissions = append(permissions, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		fmt.Println("No deprecated permissions")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, d := range permissions {
+		fmt.Fprintf(w, "%s.%s", d.entityType, d.permission)
+		if d.message != "" {
+			fmt.Fprintf(w, " (%s)", d.message)
+		}
+		fmt.Fprintln(w)
+
+		callers, err := db.Query(`
+			SELECT COALESCE(NULLIF(client_cert, ''), NULLIF(client_ip, ''), '-'),
+				COALESCE(NULLIF(user_agent, ''), '-'), COUNT(*), MAX(timestamp)
+			FROM authz_audit_logs
+			WHERE deprecated AND entity_type = $1 AND permission = $2 AND timestamp >= $3
+			GROUP BY 1, 2
+			ORDER BY 3 DESC
+		`, d.entityType, d.permission, since)
+		if err != nil {
+			return fmt.Errorf("listing callers of %s.%s: %w", d.entityType, d.permission, err)
+		}
+		found := 0
+		for callers.Next() {
+			var caller, userAgent string
+			var checks int64
+			var lastSeen time.Time
+			if err := callers.Scan(&caller, &userAgent, &checks, &lastSeen); err != nil {
+				callers.Close()
+				return fmt.Errorf("scanning caller: %w", err)
+			}
+			if found == 0 {
+				fmt.Fprintf(w, "  CALLER\tUSER AGENT\tCHECKS\tLAST SEEN\n")
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%s\n", caller, userAgent, checks, lastSeen.Format(time.RFC3339))
+			found++
+		}
+		callers.Close()
+		if err := callers.Err(); err != nil {
+			return err
+		}
+		if found == 0 {
+			fmt.Fprintf(w, "  no callers since %s; safe to remove\n", since.Format(time.RFC3339))
+		}
+	}
+	return w.Flush()
+}
+
+// printReverseRelations reports the tuples that only match the model's
+// relations when read object->subject
+func printReverseRelations(ctx context.Context, permModel *model.PermissionModel, limit int) error {
+	var declared []graph.RelationDeclaration
+	for name, entity := range permModel.Entities {
+		for _, rel := range entity.Relations {
+			declared = append(declared, graph.RelationDeclaration{EntityType: name, Relation: rel.Name, TargetType: rel.Target})
+		}
+	}
+	sort.Slice(declared, func(i, j int) bool {
+		if declared[i].EntityType != declared[j].EntityType {
+			return declared[i].EntityType < declared[j].EntityType
+		}
+		return declared[i].Relation < declared[j].Relation
+	})
+
+	connString, err := schemaConnString(ctx)
+	if err != nil {
+		return err
+	}
+	g, err := graph.NewIdentityGraph(ctx, connString)
+	if err != nil {
+		return err
+	}
+	defer g.Pool.Close()
+
+	relations, err := g.ReverseOnlyRelations(ctx, declared, limit)
+	if err != nil {
+		return err
+	}
+	if len(relations) == 0 {
+		fmt.Println("No reversed relations found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tSTORED AS\tEXPECTED\n")
+	for _, r := range relations {
+		fmt.Fprintf(w, "%d\t%s:%s %s %s:%s\t%s:%s %s %s:%s\n", r.ID,
+			r.SubjectType, r.SubjectID, r.Relation, r.ObjectType, r.ObjectID,
+			r.ObjectType, r.ObjectID, r.Relation, r.SubjectType, r.SubjectID)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d reversed relations found\n", len(relations))
+	return nil
+}
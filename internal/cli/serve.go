@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/apiserver"
+	"github.com/dangerclosesec/supra/internal/authzserver"
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/lifecycle"
+	"github.com/dangerclosesec/supra/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+func newServeCommand() *cobra.Command {
+	serve := &cobra.Command{
+		Use:   "serve",
+		Short: "Run one of the supra services",
+	}
+
+	serve.AddCommand(&cobra.Command{
+		Use:   "api",
+		Short: "Run the identity API server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, secretManager, err := loadConfig(cmd.Context(), config.ServiceAPI)
+			if err != nil {
+				return err
+			}
+			secretManager.Start()
+			defer secretManager.Stop()
+			go refreshSecretsOnHangup(cmd.Context(), secretManager)
+
+			lifecycle.Banner(slog.Default(), "api", "port", cfg.Server.Port)
+			return apiserver.Run(cmd.Context(), cfg, secretManager, slog.Default())
+		},
+	})
+
+	serve.AddCommand(&cobra.Command{
+		Use:   "authz",
+		Short: "Run the authorization service",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, secretManager, err := loadConfig(cmd.Context(), config.ServiceAuthz)
+			if err != nil {
+				return err
+			}
+			secretManager.Start()
+			defer secretManager.Stop()
+			go refreshSecretsOnHangup(cmd.Context(), secretManager)
+
+			lifecycle.Banner(slog.Default(), "authz", "addr", cfg.Authz.ListenAddr, "grpc_addr", cfg.Authz.GRPCListenAddr)
+			return authzserver.RunWithOptions(cmd.Context(), cfg, secretManager, authzserver.RunOptions{
+				Reload: func() (*config.Config, error) {
+					return reloadConfig(config.ServiceAuthz)
+				},
+			})
+		},
+	})
+
+	return serve
+}
+
+// refreshSecretsOnHangup re-reads secrets held in a secret store on SIGHUP,
+// so a rotation is picked up without waiting for the refresh interval.
+// Settings that can't change safely while running still need a restart.
+func refreshSecretsOnHangup(ctx context.Context, secretManager *secrets.Manager) {
+	lifecycle.OnHangup(ctx, func() {
+		slog.Info("SIGHUP received, refreshing secrets")
+		refreshSecrets(ctx, secretManager)
+	})
+}
+
+func refreshSecrets(ctx context.Context, secretManager *secrets.Manager) {
+	refreshCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := secretManager.Refresh(refreshCtx); err != nil {
+		slog.Warn("some secrets could not be refreshed", "error", err)
+	}
+}
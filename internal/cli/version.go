@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/dangerclosesec/supra/internal/lifecycle"
+	"github.com/spf13/cobra"
+)
+
+func newVersionCommand() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version, commit and build time of this binary",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := lifecycle.Build("supra")
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+
+			commit := info.Commit
+			if commit == "" {
+				commit = "unknown"
+			} else if info.Modified {
+				commit += "-dirty"
+			}
+			fmt.Printf("supra %s (commit %s", info.Version, commit)
+			if info.BuildTime != "" {
+				fmt.Printf(", built %s", info.BuildTime)
+			}
+			fmt.Printf(", %s)\n", info.GoVersion)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the build details as JSON")
+
+	return cmd
+}
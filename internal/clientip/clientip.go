@@ -0,0 +1,140 @@
+// Package clientip works out which client made a request that may have
+// passed through load balancers and reverse proxies. Forwarding headers are
+// only believed when they were added by a proxy listed as trusted, so a
+// client can't choose the address it is recorded under.
+package clientip
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver finds the client address of requests. A nil Resolver trusts no
+// proxies and resolves every request to its peer's address.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// New returns a Resolver that believes the forwarding headers of the given
+// proxies, each an IP address or a CIDR range
+func New(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, entry := range trustedProxies {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy range %q: %w", entry, err)
+			}
+			r.trusted = append(r.trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy address %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return r, nil
+}
+
+// Resolve returns the address of the client that made req. Forwarding
+// headers, Forwarded when present and X-Forwarded-For otherwise, are read
+// from the nearest hop outwards for as long as each hop is a trusted proxy;
+// the first untrusted hop is the client. Without a trusted peer the headers
+// are ignored and the peer itself is the client.
+func (r *Resolver) Resolve(req *http.Request) string {
+	peer, ok := parseHost(req.RemoteAddr)
+	if !ok {
+		return req.RemoteAddr
+	}
+	if r == nil || !r.isTrusted(peer) {
+		return peer.String()
+	}
+
+	hops := forwardedFor(req.Header)
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHost(hops[i])
+		if !ok {
+			// Anything further out can't be vouched for
+			break
+		}
+		client = addr
+		if !r.isTrusted(addr) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor lists the hops a request was forwarded through, client
+// first. Every header line is read, since proxies may append their own.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(key, "for") {
+						hops = append(hops, strings.Trim(val, `"`))
+					}
+				}
+			}
+		}
+		return hops
+	}
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseHost reads an IP address with or without a port, including the
+// bracketed IPv6 form Forwarded uses. Obfuscated and "unknown" identifiers
+// don't parse.
+func parseHost(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// CertIdentity returns who the verified client certificate of a TLS
+// connection names: its first URI SAN, such as a SPIFFE ID, or else its
+// subject. It is empty when no client certificate was verified.
+func CertIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := state.VerifiedChains[0][0]
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.String()
+}
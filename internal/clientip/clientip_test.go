@@ -0,0 +1,85 @@
+package clientip
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	r, err := New([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5123", nil, "203.0.113.7"},
+		{"untrusted peer's headers are ignored", "203.0.113.7:5123",
+			map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:443",
+			map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"spoofed entries left of the client are skipped", "10.1.2.3:443",
+			map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.9, 192.168.1.1"}, "198.51.100.9"},
+		{"all hops trusted", "10.1.2.3:443",
+			map[string]string{"X-Forwarded-For": "10.9.9.9, 192.168.1.1"}, "10.9.9.9"},
+		{"garbage stops the walk", "10.1.2.3:443",
+			map[string]string{"X-Forwarded-For": "198.51.100.9, bogus, 10.2.2.2"}, "10.2.2.2"},
+		{"no header", "10.1.2.3:443", nil, "10.1.2.3"},
+		{"forwarded", "10.1.2.3:443",
+			map[string]string{"Forwarded": `for=198.51.100.9;proto=https, for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		{"forwarded wins over x-forwarded-for", "10.1.2.3:443",
+			map[string]string{"Forwarded": "for=198.51.100.9", "X-Forwarded-For": "1.2.3.4"}, "198.51.100.9"},
+		{"ipv6 proxy", "[fd00::1]:443",
+			map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"mapped ipv4 peer", "[::ffff:10.1.2.3]:443",
+			map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"unparseable peer is kept", "pipe", nil, "pipe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, r.Resolve(req))
+		})
+	}
+
+	var none *Resolver
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:443"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9")
+	assert.Equal(t, "10.1.2.3", none.Resolve(req), "a nil resolver trusts nobody")
+}
+
+func TestNewRejectsInvalidEntries(t *testing.T) {
+	_, err := New([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = New([]string{"proxy.internal"})
+	assert.Error(t, err)
+}
+
+func TestCertIdentity(t *testing.T) {
+	assert.Empty(t, CertIdentity(nil))
+	assert.Empty(t, CertIdentity(&tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "unverified"}}},
+	}), "only verified certificates count")
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing", Organization: []string{"Acme"}}}
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	assert.Equal(t, "CN=billing,O=Acme", CertIdentity(state))
+
+	spiffe, _ := url.Parse("spiffe://acme.internal/billing")
+	cert.URIs = []*url.URL{spiffe}
+	assert.Equal(t, "spiffe://acme.internal/billing", CertIdentity(state))
+}
@@ -0,0 +1,206 @@
+// Package cluster coordinates replicas of the authz service through its
+// database: membership with heartbeats, events broadcast with LISTEN/NOTIFY
+// and leases that elect a single runner for background jobs.
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Options tune membership and event delivery
+type Options struct {
+	// ListenAddr is the address this replica serves on, shown to operators
+	ListenAddr string
+	// HeartbeatInterval is how often membership is renewed
+	HeartbeatInterval time.Duration
+	// MemberTTL is how long a replica may miss heartbeats before it is
+	// considered gone and removed
+	MemberTTL time.Duration
+}
+
+// DefaultOptions returns the options used when a field is left zero
+func DefaultOptions() Options {
+	return Options{
+		HeartbeatInterval: 5 * time.Second,
+		MemberTTL:         30 * time.Second,
+	}
+}
+
+// Member is a replica registered in the cluster
+type Member struct {
+	ID          string    `json:"id"`
+	Hostname    string    `json:"hostname"`
+	ListenAddr  string    `json:"listen_addr,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	// Self marks the replica that answered
+	Self bool `json:"self"`
+}
+
+// Cluster is this replica's view of the cluster
+type Cluster struct {
+	pool     *pgxpool.Pool
+	opts     Options
+	id       string
+	hostname string
+
+	handlersMu sync.RWMutex
+	handlers   map[string][]func(Event)
+
+	done chan struct{}
+}
+
+// New creates a cluster member backed by pool. Call Start to join.
+func New(pool *pgxpool.Pool, opts Options) *Cluster {
+	defaults := DefaultOptions()
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = defaults.HeartbeatInterval
+	}
+	if opts.MemberTTL <= 0 {
+		opts.MemberTTL = defaults.MemberTTL
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &Cluster{
+		pool:     pool,
+		opts:     opts,
+		id:       newMemberID(hostname),
+		hostname: hostname,
+		handlers: make(map[string][]func(Event)),
+		done:     make(chan struct{}),
+	}
+}
+
+// newMemberID names a replica after its host, with a random suffix so
+// restarts and replicas sharing a hostname stay distinct
+func newMemberID(hostname string) string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s-%d", hostname, time.Now().UnixNano())
+	}
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
+
+// ID identifies this replica
+func (c *Cluster) ID() string {
+	return c.id
+}
+
+// Start registers this replica and keeps its heartbeat and event listener
+// running until ctx is cancelled, when it leaves the cluster. Wait blocks
+// until that cleanup is done.
+func (c *Cluster) Start(ctx context.Context) error {
+	if _, err := c.pool.Exec(ctx, `
+		INSERT INTO authz_cluster_members (id, hostname, listen_addr)
+		VALUES ($1, $2, $3)
+	`, c.id, c.hostname, c.opts.ListenAddr); err != nil {
+		return fmt.Errorf("failed to join cluster: %w", err)
+	}
+	log.Printf("Joined cluster as %s", c.id)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.heartbeat(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		c.listen(ctx)
+	}()
+
+	go func() {
+		wg.Wait()
+		c.leave()
+		close(c.done)
+	}()
+	return nil
+}
+
+// Wait blocks until a started member has left the cluster
+func (c *Cluster) Wait() {
+	<-c.done
+}
+
+// heartbeat renews membership and removes replicas that stopped renewing
+func (c *Cluster) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		beatCtx, cancel := context.WithTimeout(ctx, c.opts.HeartbeatInterval)
+		// A replica removed as stale, e.g. after a long pause, re-registers
+		_, err := c.pool.Exec(beatCtx, `
+			INSERT INTO authz_cluster_members (id, hostname, listen_addr)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (id) DO UPDATE SET heartbeat_at = NOW()
+		`, c.id, c.hostname, c.opts.ListenAddr)
+		if err == nil {
+			_, err = c.pool.Exec(beatCtx, `
+				DELETE FROM authz_cluster_members
+				WHERE heartbeat_at < NOW() - make_interval(secs => $1)
+			`, c.opts.MemberTTL.Seconds())
+		}
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Cluster heartbeat failed: %v", err)
+		}
+	}
+}
+
+// leave removes this replica and releases its leases
+func (c *Cluster) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := c.pool.Exec(ctx, `DELETE FROM authz_cluster_leases WHERE holder = $1`, c.id); err != nil {
+		log.Printf("Failed to release cluster leases: %v", err)
+	}
+	if _, err := c.pool.Exec(ctx, `DELETE FROM authz_cluster_members WHERE id = $1`, c.id); err != nil {
+		log.Printf("Failed to leave cluster: %v", err)
+	}
+}
+
+// Members lists the replicas that have sent a heartbeat within MemberTTL
+func (c *Cluster) Members(ctx context.Context) ([]Member, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT id, hostname, listen_addr, started_at, heartbeat_at
+		FROM authz_cluster_members
+		WHERE heartbeat_at >= NOW() - make_interval(secs => $1)
+		ORDER BY started_at, id
+	`, c.opts.MemberTTL.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.ID, &m.Hostname, &m.ListenAddr, &m.StartedAt, &m.HeartbeatAt); err != nil {
+			return nil, fmt.Errorf("failed to scan cluster member: %w", err)
+		}
+		m.Self = m.ID == c.id
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
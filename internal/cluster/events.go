@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// notifyChannel is the Postgres channel cluster events are sent on
+const notifyChannel = "supra_authz_cluster"
+
+// maxEventPayload keeps events under Postgres' NOTIFY payload limit
+const maxEventPayload = 7900
+
+// Events sent between replicas
+const (
+	// EventSchemaReloaded means a replica synced the permission model, so
+	// the others must reload their rule caches
+	EventSchemaReloaded = "schema_reloaded"
+	// EventCacheInvalidated asks replicas to drop a named cache
+	EventCacheInvalidated = "cache_invalidated"
+	// EventModeChanged switches replicas into or out of read-only or
+	// maintenance mode
+	EventModeChanged = "mode_changed"
+)
+
+// Event is a message broadcast to every replica
+type Event struct {
+	Type   string          `json:"type"`
+	Origin string          `json:"origin"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// Subscribe calls handler for each event of eventType sent by another
+// replica. The sender applies its own changes directly, so it is skipped.
+// Events sent while the listener is reconnecting are not redelivered.
+func (c *Cluster) Subscribe(eventType string, handler func(Event)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	c.handlers[eventType] = append(c.handlers[eventType], handler)
+}
+
+// Broadcast sends an event with optional JSON data to every replica
+func (c *Cluster) Broadcast(ctx context.Context, eventType string, data interface{}) error {
+	event := Event{Type: eventType, Origin: c.id}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+		}
+		event.Data = raw
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	if len(payload) > maxEventPayload {
+		return fmt.Errorf("%s event is %d bytes, more than the %d NOTIFY allows", eventType, len(payload), maxEventPayload)
+	}
+
+	if _, err := c.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to broadcast %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// listen holds a connection listening for events until ctx is cancelled,
+// reconnecting after failures
+func (c *Cluster) listen(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := c.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("Cluster event listener stopped, reconnecting in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+func (c *Cluster) listenOnce(ctx context.Context) error {
+	pooled, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection is left listening, so it is taken out of the pool and
+	// closed rather than reused
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		c.dispatch(notification.Payload)
+	}
+}
+
+// dispatch decodes an event and hands it to its subscribers
+func (c *Cluster) dispatch(payload string) {
+	var event Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		log.Printf("Ignoring malformed cluster event: %v", err)
+		return
+	}
+	if event.Origin == c.id {
+		return
+	}
+
+	c.handlersMu.RLock()
+	handlers := c.handlers[event.Type]
+	c.handlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
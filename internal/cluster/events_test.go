@@ -0,0 +1,39 @@
+package cluster
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDispatchSkipsOwnEvents(t *testing.T) {
+	c := New(nil, Options{})
+
+	var received []Event
+	c.Subscribe(EventCacheInvalidated, func(e Event) {
+		received = append(received, e)
+	})
+
+	payload := func(e Event) string {
+		raw, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(raw)
+	}
+
+	c.dispatch(payload(Event{Type: EventCacheInvalidated, Origin: c.ID(), Data: json.RawMessage(`{"cache":"rules"}`)}))
+	c.dispatch(payload(Event{Type: EventSchemaReloaded, Origin: "other"}))
+	c.dispatch("not json")
+	c.dispatch(payload(Event{Type: EventCacheInvalidated, Origin: "other", Data: json.RawMessage(`{"cache":"rules"}`)}))
+
+	if len(received) != 1 || received[0].Origin != "other" || string(received[0].Data) != `{"cache":"rules"}` {
+		t.Errorf("received = %+v, want only the other replica's cache event", received)
+	}
+}
+
+func TestNewMemberIDsAreUnique(t *testing.T) {
+	a, b := newMemberID("host"), newMemberID("host")
+	if a == b {
+		t.Errorf("newMemberID returned %q twice", a)
+	}
+}
@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TryAcquire takes or renews the named lease for ttl. It reports false when
+// another replica holds an unexpired lease.
+func (c *Cluster) TryAcquire(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	var holder string
+	err := c.pool.QueryRow(ctx, `
+		INSERT INTO authz_cluster_leases (name, holder, expires_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE SET
+			holder = EXCLUDED.holder,
+			acquired_at = CASE WHEN authz_cluster_leases.holder = EXCLUDED.holder
+				THEN authz_cluster_leases.acquired_at ELSE NOW() END,
+			expires_at = EXCLUDED.expires_at
+		WHERE authz_cluster_leases.holder = EXCLUDED.holder
+		   OR authz_cluster_leases.expires_at < NOW()
+		RETURNING holder
+	`, name, c.id, ttl.Seconds()).Scan(&holder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// Release gives up the named lease if this replica holds it
+func (c *Cluster) Release(ctx context.Context, name string) error {
+	if _, err := c.pool.Exec(ctx, `
+		DELETE FROM authz_cluster_leases WHERE name = $1 AND holder = $2
+	`, name, c.id); err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", name, err)
+	}
+	return nil
+}
+
+// RunExclusive runs job every interval on whichever single replica holds the
+// named lease, e.g. for sweepers and retention jobs, until ctx is cancelled.
+// The lease outlives one interval so a slow run keeps it; if the holder
+// dies, another replica takes over once it expires.
+func (c *Cluster) RunExclusive(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	ttl := 2 * interval
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		held, err := c.TryAcquire(ctx, name, ttl)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Cluster job %s: %v", name, err)
+			}
+			continue
+		}
+		if !held {
+			continue
+		}
+
+		jobCtx, cancel := context.WithTimeout(ctx, ttl)
+		if err := job(jobCtx); err != nil {
+			log.Printf("Cluster job %s failed: %v", name, err)
+		}
+		cancel()
+	}
+}
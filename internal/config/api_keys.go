@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// API key scopes, each covering the ones before it: read allows checks,
+// lookups and reads; write also allows entity, relation and attribute
+// writes; admin also allows schema changes and the admin APIs
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists the API key scopes, narrowest first
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// minAPIKeyLength keeps configured keys from being guessable
+const minAPIKeyLength = 24
+
+// APIKey is an API key given in the configuration
+type APIKey struct {
+	Name  string
+	Scope string
+	Key   string
+}
+
+// ValidScope reports whether scope is one of Scopes
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAPIKeys reads comma-separated name:scope:key entries, e.g.
+// "billing:read:3f9c...,provisioner:write:a71b..."
+func ParseAPIKeys(value string) ([]APIKey, error) {
+	var keys []APIKey
+	names := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("API key entries must be name:scope:key")
+		}
+		key := APIKey{Name: parts[0], Scope: parts[1], Key: parts[2]}
+		if !ValidScope(key.Scope) {
+			return nil, fmt.Errorf("API key %s: scope must be one of %s, got %q", key.Name, strings.Join(Scopes, ", "), key.Scope)
+		}
+		if len(key.Key) < minAPIKeyLength {
+			return nil, fmt.Errorf("API key %s: must be at least %d characters, got %d", key.Name, minAPIKeyLength, len(key.Key))
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("API key %s: name used twice", key.Name)
+		}
+		names[key.Name] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// isSecretReference reports whether a value still names a secret to be
+// resolved, as it does when a running service reloads its configuration
+func isSecretReference(value string) bool {
+	for _, scheme := range []string{"vault://", "awssm://", "kmsfile://"} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Run("environment overrides the config file", func(t *testing.T) {
+		path := writeFile(t, "supra.yaml", `
+server:
+  port: "9000"
+  read_timeout: 30s
+jwt:
+  secret: from-file
+`)
+		t.Setenv("SERVER_PORT", "9100")
+
+		cfg, err := config.LoadFile(path)
+		require.NoError(t, err)
+
+		assert.Equal(t, "9100", cfg.Server.Port)
+		assert.Equal(t, 30*time.Second, cfg.Server.ReadTimeout.Std())
+		assert.Equal(t, 15*time.Second, cfg.Server.WriteTimeout.Std())
+		assert.Equal(t, "from-file", cfg.JWT.Secret)
+	})
+
+	t.Run("reads toml", func(t *testing.T) {
+		path := writeFile(t, "supra.toml", "[authz]\nlisten_addr = \":5000\"\n")
+
+		cfg, err := config.LoadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, ":5000", cfg.Authz.ListenAddr)
+	})
+
+	t.Run("leaves the gRPC listener off by default", func(t *testing.T) {
+		cfg, err := config.LoadFile("")
+		require.NoError(t, err)
+		assert.Empty(t, cfg.Authz.GRPCListenAddr)
+
+		t.Setenv("AUTHZ_GRPC_LISTEN_ADDR", ":4781")
+		cfg, err = config.LoadFile("")
+		require.NoError(t, err)
+		assert.Equal(t, ":4781", cfg.Authz.GRPCListenAddr)
+	})
+
+	t.Run("keeps DB_URL for the permission service", func(t *testing.T) {
+		t.Setenv("DB_URL", "postgres://supra@db:5432/supra_authz")
+
+		cfg, err := config.LoadFile("")
+		require.NoError(t, err)
+		assert.Equal(t, "postgres://supra@db:5432/supra_authz", cfg.Authz.DatabaseURL)
+		assert.Empty(t, cfg.Database.URL, "the API keeps using the DB_* parts")
+
+		t.Setenv("API_DB_URL", "postgres://supra@db:5432/supra_api")
+		cfg, err = config.LoadFile("")
+		require.NoError(t, err)
+		assert.Equal(t, "postgres://supra@db:5432/supra_api", cfg.DatabaseDSN())
+	})
+
+	t.Run("reads secrets from files", func(t *testing.T) {
+		secret := writeFile(t, "jwt", "s3cret\n")
+		t.Setenv("JWT_SECRET", "from-env")
+		t.Setenv("JWT_SECRET_FILE", secret)
+
+		cfg, err := config.LoadFile("")
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", cfg.JWT.Secret)
+	})
+
+	t.Run("reads lists from the environment", func(t *testing.T) {
+		t.Setenv("AUTHZ_STRICT_RELATION_DIRECTION", "document, folder,,")
+
+		cfg, err := config.LoadFile("")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"document", "folder"}, cfg.Authz.StrictRelationDirection)
+	})
+
+	t.Run("reads flag rollouts from the environment", func(t *testing.T) {
+		t.Setenv("AUTHZ_FLAGS", "parallel_or=0.25, strict_direction:document=1")
+
+		cfg, err := config.LoadFile("")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]config.FlagRollout{
+			"parallel_or":      {Rollout: 0.25},
+			"strict_direction": {EntityTypes: map[string]float64{"document": 1}},
+		}, cfg.Authz.Flags)
+
+		t.Setenv("AUTHZ_FLAGS", "parallel_or")
+		_, err = config.LoadFile("")
+		assert.ErrorContains(t, err, "AUTHZ_FLAGS")
+	})
+
+	t.Run("rejects unknown file types", func(t *testing.T) {
+		_, err := config.LoadFile(writeFile(t, "supra.ini", ""))
+		assert.ErrorContains(t, err, "unsupported config file extension")
+	})
+
+	t.Run("rejects invalid durations", func(t *testing.T) {
+		t.Setenv("JWT_EXPIRY_PERIOD", "tomorrow")
+
+		_, err := config.LoadFile("")
+		assert.ErrorContains(t, err, "JWT_EXPIRY_PERIOD")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	cfg := config.Default()
+
+	err := cfg.Validate(config.ServiceAPI)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "jwt.secret")
+	assert.Contains(t, err.Error(), "sendgrid.api_key")
+
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg.Authz.DatabaseURL = "mysql://localhost/graph"
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "scheme must be postgres")
+
+	cfg = config.Default()
+	cfg.Authz.Chaos = true
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_ADMIN_TOKEN")
+	cfg.Authz.AdminToken = "token"
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Authz.Decisions.ClickHouseURL = "clickhouse:9000"
+	cfg.Authz.Decisions.SampleRate = 2
+	err = cfg.Validate(config.ServiceAuthz)
+	assert.ErrorContains(t, err, "AUTHZ_DECISIONS_CLICKHOUSE_URL")
+	assert.ErrorContains(t, err, "AUTHZ_DECISIONS_SAMPLE_RATE")
+
+	cfg = config.Default()
+	cfg.Authz.Mode = "readonly"
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_MODE")
+	cfg.Authz.Mode = "read_only"
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Authz.Flags = map[string]config.FlagRollout{"parallel_or": {EntityTypes: map[string]float64{"document": 10}}}
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "authz.flags.parallel_or.entity_types.document")
+
+	cfg = config.Default()
+	cfg.Authz.Shadow.URL = "http://spicedb:8443"
+	cfg.Authz.Shadow.Kind = "zanzibar"
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_SHADOW_KIND")
+	cfg.Authz.Shadow.Kind = "spicedb"
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Authz.RateLimit.Burst = -1
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_RATE_LIMIT_BURST")
+
+	cfg = config.Default()
+	cfg.Authz.Sensitive.WebhookURL = "siem.internal/hooks/supra"
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_SENSITIVE_WEBHOOK_URL")
+	cfg.Authz.Sensitive.WebhookURL = "https://siem.internal/hooks/supra"
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Authz.Tracing.Endpoint = "otel-collector:4318"
+	cfg.Authz.Tracing.SampleRatio = 1.5
+	err = cfg.Validate(config.ServiceAuthz)
+	assert.ErrorContains(t, err, "AUTHZ_TRACING_ENDPOINT")
+	assert.ErrorContains(t, err, "AUTHZ_TRACING_SAMPLE_RATIO")
+	cfg.Authz.Tracing.Endpoint = "http://otel-collector:4318"
+	cfg.Authz.Tracing.SampleRatio = 0.1
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Authz.TrustedProxies = []string{"10.0.0.0/8", "lb.internal"}
+	cfg.Authz.TLS.ClientCAPath = "/etc/supra/clients.pem"
+	err = cfg.Validate(config.ServiceAuthz)
+	assert.ErrorContains(t, err, "AUTHZ_TRUSTED_PROXIES")
+	assert.ErrorContains(t, err, "authz.tls.client_ca_path")
+	cfg.Authz.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+	cfg.Authz.TLS.CertPath = "/etc/supra/tls.crt"
+	cfg.Authz.TLS.KeyPath = "/etc/supra/tls.key"
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Authz.Audit.SigningKey = "not-a-key"
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_AUDIT_SIGNING_KEY")
+	cfg.Authz.Audit.SigningKey = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Authz.Jobs.Workers = -1
+	cfg.Authz.Jobs.Retention = 0
+	err = cfg.Validate(config.ServiceAuthz)
+	assert.ErrorContains(t, err, "AUTHZ_JOB_WORKERS")
+	assert.ErrorContains(t, err, "AUTHZ_JOB_RETENTION")
+	cfg.Authz.Jobs.Workers = 0
+	cfg.Authz.Jobs.Retention = config.Duration(time.Hour)
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Authz.Budgets.Max = config.Duration(time.Second)
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_MAX_REQUEST_BUDGET")
+	cfg.Authz.Budgets.Max = config.Duration(time.Minute)
+	cfg.Authz.Budgets.Rules = config.Duration(-time.Second)
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_RULE_BUDGET")
+
+	cfg = config.Default()
+	cfg.Authz.ConditionLimits.MaxDepth = -1
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_MAX_CONDITION_DEPTH")
+	cfg.Authz.ConditionLimits.MaxDepth = 0
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+	cfg.Authz.TenantRules.Timeout = config.Duration(-time.Millisecond)
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_TENANT_RULE_TIMEOUT")
+
+	cfg = config.Default()
+	cfg.Authz.APIKeys = "billing:read:short"
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "AUTHZ_API_KEYS")
+	cfg.Authz.APIKeys = "billing:owner:0123456789abcdef0123456789abcdef"
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "scope must be one of")
+	cfg.Authz.APIKeys = "billing:read:0123456789abcdef0123456789abcdef, provisioner:write:fedcba9876543210fedcba9876543210"
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+	cfg.Authz.APIKeys = "vault://secret/data/supra#api_keys"
+	assert.NoError(t, cfg.Validate(config.ServiceAuthz))
+
+	cfg = config.Default()
+	cfg.Database.SlowQueryThreshold = config.Duration(-time.Second)
+	assert.ErrorContains(t, cfg.Validate(config.ServiceAuthz), "DB_SLOW_QUERY_THRESHOLD")
+
+	cfg = config.Default()
+	cfg.Shutdown.Timeout = 0
+	assert.ErrorContains(t, cfg.Validate(config.ServiceReconcile), "SHUTDOWN_TIMEOUT")
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := config.Default()
+	cfg.JWT.Secret = "super-secret-value"
+	cfg.Database.URL = "postgres://app:hunter2@db:5432/app"
+
+	out := cfg.Redacted()
+
+	assert.NotContains(t, out, "super-secret-value")
+	assert.NotContains(t, out, "hunter2")
+	assert.False(t, strings.Contains(out, "password@localhost"), "authz URL password must be masked")
+	assert.Contains(t, out, "db:5432/app")
+}
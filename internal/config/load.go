@@ -0,0 +1,423 @@
+// internal/config/load.go
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// mergeFile overlays the values found in a YAML, TOML or JSON file onto cfg.
+// Files are decoded into a generic map and re-encoded as JSON so that a single
+// set of struct tags describes every format.
+func mergeFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("unsupported config file extension %q (use .yaml, .yml, .toml or .json)", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("normalizing config file %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(normalized, cfg); err != nil {
+		return fmt.Errorf("decoding config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyEnv overrides configuration with environment variables. Variable names
+// are unchanged from the previous env-only configuration.
+func applyEnv(cfg *Config) error {
+	// Database configuration
+	setFromEnv(&cfg.Database.URL, "API_DB_URL")
+	setFromEnv(&cfg.Database.Host, "DB_HOST")
+	setFromEnv(&cfg.Database.Port, "DB_PORT")
+	setFromEnv(&cfg.Database.User, "DB_USER")
+	setFromEnv(&cfg.Database.Password, "DB_PASSWORD")
+	setFromEnv(&cfg.Database.Name, "DB_NAME")
+	setFromEnv(&cfg.Database.SSLMode, "DB_SSLMODE")
+	setFromEnv(&cfg.Database.SearchPath, "DB_SCHEMA")
+	if err := setDurationFromEnv(&cfg.Database.SlowQueryThreshold, "DB_SLOW_QUERY_THRESHOLD"); err != nil {
+		return err
+	}
+	if err := setBoolFromEnv(&cfg.Database.LogQueries, "DB_LOG_QUERIES"); err != nil {
+		return err
+	}
+
+	// Authorization service; DB_URL is honoured for backwards compatibility
+	setFromEnv(&cfg.Authz.DatabaseURL, "DB_URL")
+	setFromEnv(&cfg.Authz.DatabaseURL, "AUTHZ_DB_URL")
+	setFromEnv(&cfg.Authz.ListenAddr, "LISTEN_ADDR")
+	setFromEnv(&cfg.Authz.GRPCListenAddr, "AUTHZ_GRPC_LISTEN_ADDR")
+	setFromEnv(&cfg.Authz.SchemaPath, "SCHEMA_PATH")
+	setFromEnv(&cfg.Authz.TLS.CertPath, "AUTHZ_TLS_CERT_PATH")
+	setFromEnv(&cfg.Authz.TLS.KeyPath, "AUTHZ_TLS_KEY_PATH")
+	setFromEnv(&cfg.Authz.TLS.ClientCAPath, "AUTHZ_TLS_CLIENT_CA_PATH")
+	if err := setBoolFromEnv(&cfg.Authz.TLS.RequireClientCert, "AUTHZ_TLS_REQUIRE_CLIENT_CERT"); err != nil {
+		return err
+	}
+	setListFromEnv(&cfg.Authz.TrustedProxies, "AUTHZ_TRUSTED_PROXIES")
+	setFromEnv(&cfg.Authz.AdminToken, "AUTHZ_ADMIN_TOKEN")
+	setFromEnv(&cfg.Authz.APIKeys, "AUTHZ_API_KEYS")
+	if err := setBoolFromEnv(&cfg.Authz.RequireAPIKey, "AUTHZ_REQUIRE_API_KEY"); err != nil {
+		return err
+	}
+	if err := setBoolFromEnv(&cfg.Authz.AdminScopes, "AUTHZ_ADMIN_SCOPES"); err != nil {
+		return err
+	}
+	setListFromEnv(&cfg.Authz.StrictRelationDirection, "AUTHZ_STRICT_RELATION_DIRECTION")
+	if err := setFlagsFromEnv(&cfg.Authz.Flags, "AUTHZ_FLAGS"); err != nil {
+		return err
+	}
+	if err := setBoolFromEnv(&cfg.Authz.FailOnRuleTests, "AUTHZ_FAIL_ON_RULE_TESTS"); err != nil {
+		return err
+	}
+	if err := setBoolFromEnv(&cfg.Authz.ValidateRelations, "AUTHZ_VALIDATE_RELATIONS"); err != nil {
+		return err
+	}
+	if err := setBoolFromEnv(&cfg.Authz.Chaos, "AUTHZ_CHAOS"); err != nil {
+		return err
+	}
+	setFromEnv(&cfg.Authz.Mode, "AUTHZ_MODE")
+	setFromEnv(&cfg.Authz.ModeReason, "AUTHZ_MODE_REASON")
+	if err := setIntFromEnv(&cfg.Authz.Audit.QueueSize, "AUTHZ_AUDIT_QUEUE_SIZE"); err != nil {
+		return err
+	}
+	if err := setIntFromEnv(&cfg.Authz.Audit.BatchSize, "AUTHZ_AUDIT_BATCH_SIZE"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.Authz.Audit.FlushInterval, "AUTHZ_AUDIT_FLUSH_INTERVAL"); err != nil {
+		return err
+	}
+	setFromEnv(&cfg.Authz.Audit.SpoolPath, "AUTHZ_AUDIT_SPOOL_PATH")
+	if err := setFloatFromEnv(&cfg.Authz.Audit.SampleAllowed, "AUTHZ_AUDIT_SAMPLE_ALLOWED"); err != nil {
+		return err
+	}
+	if err := setFloatFromEnv(&cfg.Authz.Audit.SampleDenied, "AUTHZ_AUDIT_SAMPLE_DENIED"); err != nil {
+		return err
+	}
+	setListFromEnv(&cfg.Authz.Audit.RedactKeys, "AUTHZ_AUDIT_REDACT_KEYS")
+	setListFromEnv(&cfg.Authz.Audit.HashKeys, "AUTHZ_AUDIT_HASH_KEYS")
+	setFromEnv(&cfg.Authz.Audit.SigningKey, "AUTHZ_AUDIT_SIGNING_KEY")
+	setFromEnv(&cfg.Authz.Decisions.ClickHouseURL, "AUTHZ_DECISIONS_CLICKHOUSE_URL")
+	setFromEnv(&cfg.Authz.Decisions.Table, "AUTHZ_DECISIONS_TABLE")
+	if err := setFloatFromEnv(&cfg.Authz.Decisions.SampleRate, "AUTHZ_DECISIONS_SAMPLE_RATE"); err != nil {
+		return err
+	}
+	if err := setIntFromEnv(&cfg.Authz.Decisions.BatchSize, "AUTHZ_DECISIONS_BATCH_SIZE"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.Authz.Decisions.FlushInterval, "AUTHZ_DECISIONS_FLUSH_INTERVAL"); err != nil {
+		return err
+	}
+	setFromEnv(&cfg.Authz.Shadow.URL, "AUTHZ_SHADOW_URL")
+	setFromEnv(&cfg.Authz.Shadow.Kind, "AUTHZ_SHADOW_KIND")
+	setFromEnv(&cfg.Authz.Shadow.Token, "AUTHZ_SHADOW_TOKEN")
+	if err := setFloatFromEnv(&cfg.Authz.Shadow.SampleRate, "AUTHZ_SHADOW_SAMPLE_RATE"); err != nil {
+		return err
+	}
+	if err := setIntFromEnv(&cfg.Authz.Shadow.Concurrency, "AUTHZ_SHADOW_CONCURRENCY"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.Authz.Shadow.Timeout, "AUTHZ_SHADOW_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setBoolFromEnv(&cfg.Authz.Shadow.DualWrite, "AUTHZ_SHADOW_DUAL_WRITE"); err != nil {
+		return err
+	}
+	if err := setFloatFromEnv(&cfg.Authz.RateLimit.RequestsPerSecond, "AUTHZ_RATE_LIMIT"); err != nil {
+		return err
+	}
+	if err := setIntFromEnv(&cfg.Authz.RateLimit.Burst, "AUTHZ_RATE_LIMIT_BURST"); err != nil {
+		return err
+	}
+	setListFromEnv(&cfg.Authz.RateLimit.Exempt, "AUTHZ_RATE_LIMIT_EXEMPT")
+	setFromEnv(&cfg.Authz.Sensitive.WebhookURL, "AUTHZ_SENSITIVE_WEBHOOK_URL")
+	setFromEnv(&cfg.Authz.Sensitive.Secret, "AUTHZ_SENSITIVE_WEBHOOK_SECRET")
+	setFromEnv(&cfg.Authz.Sensitive.LogPath, "AUTHZ_SENSITIVE_LOG_PATH")
+	if err := setDurationFromEnv(&cfg.Authz.Sensitive.Timeout, "AUTHZ_SENSITIVE_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setIntFromEnv(&cfg.Authz.Sensitive.QueueSize, "AUTHZ_SENSITIVE_QUEUE_SIZE"); err != nil {
+		return err
+	}
+	setFromEnv(&cfg.Authz.Tracing.Endpoint, "AUTHZ_TRACING_ENDPOINT")
+	if err := setFloatFromEnv(&cfg.Authz.Tracing.SampleRatio, "AUTHZ_TRACING_SAMPLE_RATIO"); err != nil {
+		return err
+	}
+	if err := setIntFromEnv(&cfg.Authz.Jobs.Workers, "AUTHZ_JOB_WORKERS"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.Authz.Jobs.PollInterval, "AUTHZ_JOB_POLL_INTERVAL"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.Authz.Jobs.Retention, "AUTHZ_JOB_RETENTION"); err != nil {
+		return err
+	}
+	for target, key := range map[*Duration]string{
+		&cfg.Authz.Budgets.Request:  "AUTHZ_REQUEST_BUDGET",
+		&cfg.Authz.Budgets.Long:     "AUTHZ_LONG_REQUEST_BUDGET",
+		&cfg.Authz.Budgets.Max:      "AUTHZ_MAX_REQUEST_BUDGET",
+		&cfg.Authz.Budgets.Database: "AUTHZ_DB_BUDGET",
+		&cfg.Authz.Budgets.Rules:    "AUTHZ_RULE_BUDGET",
+	} {
+		if err := setDurationFromEnv(target, key); err != nil {
+			return err
+		}
+	}
+	for target, key := range map[*int]string{
+		&cfg.Authz.ConditionLimits.MaxLength:    "AUTHZ_MAX_CONDITION_LENGTH",
+		&cfg.Authz.ConditionLimits.MaxDepth:     "AUTHZ_MAX_CONDITION_DEPTH",
+		&cfg.Authz.ConditionLimits.MaxRuleCalls: "AUTHZ_MAX_CONDITION_RULE_CALLS",
+		&cfg.Authz.TenantRules.MaxRules:         "AUTHZ_TENANT_RULE_MAX",
+	} {
+		if err := setIntFromEnv(target, key); err != nil {
+			return err
+		}
+	}
+
+	if err := setDurationFromEnv(&cfg.Authz.TenantRules.Timeout, "AUTHZ_TENANT_RULE_TIMEOUT"); err != nil {
+		return err
+	}
+
+	// Supra host
+	setFromEnv(&cfg.Supra.Host, "SUPRA_HOST")
+	setFromEnv(&cfg.Supra.APIKey, "SUPRA_API_KEY")
+
+	// JWT configuration
+	setFromEnv(&cfg.JWT.Secret, "JWT_SECRET")
+	if err := setDurationFromEnv(&cfg.JWT.ExpiryPeriod, "JWT_EXPIRY_PERIOD"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.JWT.OrgTokenExpiryPeriod, "JWT_ORG_TOKEN_EXPIRY_PERIOD"); err != nil {
+		return err
+	}
+
+	// Email verification
+	setFromEnv(&cfg.Verification.Secret, "VERIFICATION_SECRET")
+	if err := setDurationFromEnv(&cfg.Verification.TokenTTL, "VERIFICATION_TOKEN_TTL"); err != nil {
+		return err
+	}
+	if err := setIntFromEnv(&cfg.Verification.MaxAttempts, "VERIFICATION_MAX_ATTEMPTS"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.Verification.ResendInterval, "VERIFICATION_RESEND_INTERVAL"); err != nil {
+		return err
+	}
+
+	// Sendgrid configuration
+	setFromEnv(&cfg.Sendgrid.APIKey, "SENDGRID_API_KEY")
+	setFromEnv(&cfg.Sendgrid.From, "SENDGRID_FROM")
+
+	// Server configuration
+	setFromEnv(&cfg.Server.Port, "SERVER_PORT")
+	if err := setDurationFromEnv(&cfg.Server.ReadTimeout, "SERVER_READ_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.Server.WriteTimeout, "SERVER_WRITE_TIMEOUT"); err != nil {
+		return err
+	}
+
+	if err := setDurationFromEnv(&cfg.Shutdown.Delay, "SHUTDOWN_DELAY"); err != nil {
+		return err
+	}
+	if err := setDurationFromEnv(&cfg.Shutdown.Timeout, "SHUTDOWN_TIMEOUT"); err != nil {
+		return err
+	}
+
+	setFromEnv(&cfg.BaseURL, "BASE_URL")
+
+	// Secret backends
+	if err := setDurationFromEnv(&cfg.Secrets.RefreshInterval, "SECRETS_REFRESH_INTERVAL"); err != nil {
+		return err
+	}
+	setFromEnv(&cfg.Secrets.Vault.Address, "VAULT_ADDR")
+	setFromEnv(&cfg.Secrets.Vault.Token, "VAULT_TOKEN")
+	setFromEnv(&cfg.Secrets.Vault.Namespace, "VAULT_NAMESPACE")
+	setFromEnv(&cfg.Secrets.AWS.Region, "AWS_REGION")
+
+	return nil
+}
+
+// secretFileTargets maps <NAME>_FILE environment variables to the secret they
+// provide, so secrets can be mounted as files (Docker/Kubernetes secrets)
+// instead of being passed in the environment
+func secretFileTargets(cfg *Config) map[string]*string {
+	return map[string]*string{
+		"DB_PASSWORD_FILE":                    &cfg.Database.Password,
+		"API_DB_URL_FILE":                     &cfg.Database.URL,
+		"AUTHZ_DB_URL_FILE":                   &cfg.Authz.DatabaseURL,
+		"AUTHZ_ADMIN_TOKEN_FILE":              &cfg.Authz.AdminToken,
+		"AUTHZ_API_KEYS_FILE":                 &cfg.Authz.APIKeys,
+		"AUTHZ_DECISIONS_CLICKHOUSE_URL_FILE": &cfg.Authz.Decisions.ClickHouseURL,
+		"AUTHZ_SHADOW_TOKEN_FILE":             &cfg.Authz.Shadow.Token,
+		"AUTHZ_SENSITIVE_WEBHOOK_SECRET_FILE": &cfg.Authz.Sensitive.Secret,
+		"AUTHZ_AUDIT_SIGNING_KEY_FILE":        &cfg.Authz.Audit.SigningKey,
+		"JWT_SECRET_FILE":                     &cfg.JWT.Secret,
+		"VERIFICATION_SECRET_FILE":            &cfg.Verification.Secret,
+		"SENDGRID_API_KEY_FILE":               &cfg.Sendgrid.APIKey,
+		"SUPRA_API_KEY_FILE":                  &cfg.Supra.APIKey,
+		"VAULT_TOKEN_FILE":                    &cfg.Secrets.Vault.Token,
+	}
+}
+
+// applySecretFiles reads secrets from the files named by *_FILE variables
+func applySecretFiles(cfg *Config) error {
+	for env, target := range secretFileTargets(cfg) {
+		path, ok := os.LookupEnv(env)
+		if !ok || path == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", env, err)
+		}
+		*target = strings.TrimRight(string(data), "\r\n")
+	}
+
+	return nil
+}
+
+func setFromEnv(target *string, key string) {
+	if value, exists := os.LookupEnv(key); exists {
+		*target = value
+	}
+}
+
+// setListFromEnv reads a comma-separated list, dropping empty entries
+func setListFromEnv(target *[]string, key string) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return
+	}
+
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*target = list
+}
+
+// setFlagsFromEnv reads flag rollouts written flag=fraction for every
+// entity type or flag:type=fraction for one, e.g.
+// "parallel_or=0.1,strict_direction:document=1"
+func setFlagsFromEnv(target *map[string]FlagRollout, key string) error {
+	var list []string
+	setListFromEnv(&list, key)
+	if list == nil {
+		return nil
+	}
+
+	flags := make(map[string]FlagRollout)
+	for _, item := range list {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid %s entry %q: expected flag=fraction or flag:type=fraction", key, item)
+		}
+		fraction, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s entry %q: %w", key, item, err)
+		}
+		flag, entityType, scoped := strings.Cut(strings.TrimSpace(name), ":")
+		rollout := flags[flag]
+		if scoped {
+			if rollout.EntityTypes == nil {
+				rollout.EntityTypes = make(map[string]float64)
+			}
+			rollout.EntityTypes[entityType] = fraction
+		} else {
+			rollout.Rollout = fraction
+		}
+		flags[flag] = rollout
+	}
+	*target = flags
+	return nil
+}
+
+func setDurationFromEnv(target *Duration, key string) error {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid duration %q (use values like 15s or 24h): %w", key, value, err)
+	}
+	*target = Duration(d)
+
+	return nil
+}
+
+func setIntFromEnv(target *int, key string) error {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid integer %q: %w", key, value, err)
+	}
+	*target = n
+
+	return nil
+}
+
+func setFloatFromEnv(target *float64, key string) error {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%s: invalid number %q: %w", key, value, err)
+	}
+	*target = f
+
+	return nil
+}
+
+func setBoolFromEnv(target *bool, key string) error {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid boolean %q (use true or false): %w", key, value, err)
+	}
+	*target = b
+
+	return nil
+}
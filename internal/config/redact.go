@@ -0,0 +1,81 @@
+// internal/config/redact.go
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are config keys whose values are never printed
+var sensitiveKeys = map[string]bool{
+	"password":    true,
+	"secret":      true,
+	"api_key":     true,
+	"token":       true,
+	"admin_token": true,
+	"api_keys":    true,
+}
+
+// urlKeys are config keys holding connection URLs that may embed a password
+var urlKeys = map[string]bool{
+	"url":          true,
+	"database_url": true,
+}
+
+// Redacted returns the effective configuration as JSON with secrets masked,
+// suitable for logging at startup
+func (c *Config) Redacted() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "{}"
+	}
+
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return "{}"
+	}
+	redactTree(tree)
+
+	out, err := json.Marshal(tree)
+	if err != nil {
+		return "{}"
+	}
+	return string(out)
+}
+
+func redactTree(node map[string]interface{}) {
+	for key, value := range node {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			redactTree(v)
+		case string:
+			if v == "" {
+				continue
+			}
+			if sensitiveKeys[key] {
+				node[key] = redacted
+			} else if urlKeys[key] {
+				node[key] = redactURL(v)
+			}
+		}
+	}
+}
+
+// redactURL masks the password component of a URL, leaving the rest readable
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		if strings.Contains(raw, "@") {
+			return redacted
+		}
+		return raw
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -0,0 +1,261 @@
+// internal/config/validate.go
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/clientip"
+)
+
+// defaultJWTSecret is the placeholder secret shipped in Default; it must be
+// replaced before the API is started
+const defaultJWTSecret = "your-secret-key"
+
+// Validate checks the settings required by the given service and returns every
+// problem found, each naming the setting and how to provide it
+func (c *Config) Validate(service Service) error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch service {
+	case ServiceAPI:
+		c.validateDatabase(add)
+
+		if c.JWT.Secret == "" || c.JWT.Secret == defaultJWTSecret {
+			add("jwt.secret: must be set to a random value (JWT_SECRET or JWT_SECRET_FILE)")
+		} else if len(c.JWT.Secret) < 32 {
+			add("jwt.secret: must be at least 32 characters, got %d", len(c.JWT.Secret))
+		}
+		if c.JWT.ExpiryPeriod <= 0 {
+			add("jwt.expiry_period: must be positive (JWT_EXPIRY_PERIOD, e.g. 24h)")
+		}
+		if c.JWT.OrgTokenExpiryPeriod <= 0 {
+			add("jwt.org_token_expiry_period: must be positive (JWT_ORG_TOKEN_EXPIRY_PERIOD, e.g. 15m)")
+		}
+		if c.Verification.Secret != "" && len(c.Verification.Secret) < 32 {
+			add("verification.secret: must be at least 32 characters, got %d", len(c.Verification.Secret))
+		}
+		if c.Verification.TokenTTL <= 0 {
+			add("verification.token_ttl: must be positive (VERIFICATION_TOKEN_TTL, e.g. 24h)")
+		}
+		if c.Verification.MaxAttempts <= 0 {
+			add("verification.max_attempts: must be positive (VERIFICATION_MAX_ATTEMPTS)")
+		}
+
+		if _, err := strconv.Atoi(c.Server.Port); err != nil {
+			add("server.port: %q is not a port number (SERVER_PORT)", c.Server.Port)
+		}
+		if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 {
+			add("server.read_timeout/write_timeout: must be positive (SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT)")
+		}
+
+		if c.Sendgrid.APIKey == "" {
+			add("sendgrid.api_key: must be set to send verification email (SENDGRID_API_KEY or SENDGRID_API_KEY_FILE)")
+		}
+		if c.Sendgrid.From == "" {
+			add("sendgrid.from: must be set (SENDGRID_FROM)")
+		}
+		if c.BaseURL == "" {
+			add("base_url: must be set to the public URL used in email links (BASE_URL)")
+		}
+
+		c.validateSupraHost(add)
+
+	case ServiceAuthz:
+		if c.Authz.DatabaseURL == "" {
+			add("authz.database_url: must be set (AUTHZ_DB_URL or DB_URL)")
+		} else if err := validatePostgresURL(c.Authz.DatabaseURL); err != nil {
+			add("authz.database_url: %v", err)
+		}
+		if c.Authz.ListenAddr == "" {
+			add("authz.listen_addr: must be set (LISTEN_ADDR, e.g. :4780)")
+		}
+		if c.Authz.SchemaPath == "" {
+			add("authz.schema_path: must be set (SCHEMA_PATH)")
+		}
+		if (c.Authz.TLS.CertPath == "") != (c.Authz.TLS.KeyPath == "") {
+			add("authz.tls: cert_path and key_path must be set together (AUTHZ_TLS_CERT_PATH, AUTHZ_TLS_KEY_PATH)")
+		}
+		if c.Authz.TLS.ClientCAPath != "" && c.Authz.TLS.CertPath == "" {
+			add("authz.tls.client_ca_path: needs TLS enabled (AUTHZ_TLS_CERT_PATH, AUTHZ_TLS_KEY_PATH)")
+		}
+		if c.Authz.TLS.RequireClientCert && c.Authz.TLS.ClientCAPath == "" {
+			add("authz.tls.require_client_cert: needs a client CA to verify against (AUTHZ_TLS_CLIENT_CA_PATH)")
+		}
+		if _, err := clientip.New(c.Authz.TrustedProxies); err != nil {
+			add("authz.trusted_proxies: %v (AUTHZ_TRUSTED_PROXIES)", err)
+		}
+		if !isSecretReference(c.Authz.APIKeys) {
+			if _, err := ParseAPIKeys(c.Authz.APIKeys); err != nil {
+				add("authz.api_keys: %v (AUTHZ_API_KEYS)", err)
+			}
+		}
+		if c.Authz.Chaos && c.Authz.AdminToken == "" {
+			add("authz.chaos: needs an admin token to guard its fault controls (AUTHZ_ADMIN_TOKEN)")
+		}
+		for flag, rollout := range c.Authz.Flags {
+			if r := rollout.Rollout; r < 0 || r > 1 {
+				add("authz.flags.%s.rollout: must be between 0 and 1, got %v (AUTHZ_FLAGS)", flag, r)
+			}
+			for entityType, r := range rollout.EntityTypes {
+				if r < 0 || r > 1 {
+					add("authz.flags.%s.entity_types.%s: must be between 0 and 1, got %v (AUTHZ_FLAGS)", flag, entityType, r)
+				}
+			}
+		}
+		switch c.Authz.Mode {
+		case "normal", "read_only", "maintenance":
+		default:
+			add("authz.mode: must be normal, read_only or maintenance, got %q (AUTHZ_MODE)", c.Authz.Mode)
+		}
+		if c.Authz.Audit.QueueSize <= 0 || c.Authz.Audit.BatchSize <= 0 {
+			add("authz.audit.queue_size/batch_size: must be positive (AUTHZ_AUDIT_QUEUE_SIZE, AUTHZ_AUDIT_BATCH_SIZE)")
+		}
+		if c.Authz.Audit.FlushInterval <= 0 {
+			add("authz.audit.flush_interval: must be positive (AUTHZ_AUDIT_FLUSH_INTERVAL, e.g. 1s)")
+		}
+		if r := c.Authz.Audit.SampleAllowed; r < 0 || r > 1 {
+			add("authz.audit.sample_allowed: must be between 0 and 1, got %v (AUTHZ_AUDIT_SAMPLE_ALLOWED)", r)
+		}
+		if r := c.Authz.Audit.SampleDenied; r < 0 || r > 1 {
+			add("authz.audit.sample_denied: must be between 0 and 1, got %v (AUTHZ_AUDIT_SAMPLE_DENIED)", r)
+		}
+		if key := c.Authz.Audit.SigningKey; key != "" {
+			if raw, err := base64.StdEncoding.DecodeString(key); err != nil || (len(raw) != 32 && len(raw) != 64) {
+				add("authz.audit.signing_key: must be a base64 Ed25519 seed (32 bytes) or private key (64 bytes) (AUTHZ_AUDIT_SIGNING_KEY)")
+			}
+		}
+		if c.Authz.Decisions.ClickHouseURL != "" {
+			if u, err := url.Parse(c.Authz.Decisions.ClickHouseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				add("authz.decisions.clickhouse_url: must be an http(s) URL to ClickHouse's HTTP interface (AUTHZ_DECISIONS_CLICKHOUSE_URL)")
+			}
+			if c.Authz.Decisions.BatchSize <= 0 || c.Authz.Decisions.FlushInterval <= 0 {
+				add("authz.decisions.batch_size/flush_interval: must be positive (AUTHZ_DECISIONS_BATCH_SIZE, AUTHZ_DECISIONS_FLUSH_INTERVAL)")
+			}
+		}
+		if r := c.Authz.Decisions.SampleRate; r < 0 || r > 1 {
+			add("authz.decisions.sample_rate: must be between 0 and 1, got %v (AUTHZ_DECISIONS_SAMPLE_RATE)", r)
+		}
+		if c.Authz.Shadow.URL != "" {
+			if u, err := url.Parse(c.Authz.Shadow.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("authz.shadow.url: must be an absolute http(s) URL (AUTHZ_SHADOW_URL)")
+			}
+			switch c.Authz.Shadow.Kind {
+			case "supra", "spicedb", "http":
+			default:
+				add("authz.shadow.kind: must be supra, spicedb or http, got %q (AUTHZ_SHADOW_KIND)", c.Authz.Shadow.Kind)
+			}
+			if c.Authz.Shadow.Concurrency <= 0 || c.Authz.Shadow.Timeout <= 0 {
+				add("authz.shadow.concurrency/timeout: must be positive (AUTHZ_SHADOW_CONCURRENCY, AUTHZ_SHADOW_TIMEOUT)")
+			}
+		}
+		if r := c.Authz.Shadow.SampleRate; r < 0 || r > 1 {
+			add("authz.shadow.sample_rate: must be between 0 and 1, got %v (AUTHZ_SHADOW_SAMPLE_RATE)", r)
+		}
+		if l := c.Authz.RateLimit; l.RequestsPerSecond < 0 || l.Burst < 0 {
+			add("authz.rate_limit: requests_per_second and burst must not be negative (AUTHZ_RATE_LIMIT, AUTHZ_RATE_LIMIT_BURST)")
+		}
+		if s := c.Authz.Sensitive; s.WebhookURL != "" || s.LogPath != "" {
+			if s.WebhookURL != "" {
+				if u, err := url.Parse(s.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					add("authz.sensitive.webhook_url: must be an absolute http(s) URL (AUTHZ_SENSITIVE_WEBHOOK_URL)")
+				}
+			}
+			if s.Timeout <= 0 || s.QueueSize <= 0 {
+				add("authz.sensitive.timeout/queue_size: must be positive (AUTHZ_SENSITIVE_TIMEOUT, AUTHZ_SENSITIVE_QUEUE_SIZE)")
+			}
+		}
+		if c.Authz.Tracing.Endpoint != "" {
+			if u, err := url.Parse(c.Authz.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("authz.tracing.endpoint: must be an absolute http(s) URL of an OTLP collector (AUTHZ_TRACING_ENDPOINT)")
+			}
+		}
+		if r := c.Authz.Tracing.SampleRatio; r < 0 || r > 1 {
+			add("authz.tracing.sample_ratio: must be between 0 and 1, got %v (AUTHZ_TRACING_SAMPLE_RATIO)", r)
+		}
+		if c.Authz.Jobs.Workers < 0 {
+			add("authz.jobs.workers: must not be negative, got %d (AUTHZ_JOB_WORKERS)", c.Authz.Jobs.Workers)
+		}
+		if c.Authz.Jobs.PollInterval <= 0 || c.Authz.Jobs.Retention <= 0 {
+			add("authz.jobs.poll_interval/retention: must be positive (AUTHZ_JOB_POLL_INTERVAL, AUTHZ_JOB_RETENTION)")
+		}
+		b := c.Authz.Budgets
+		if b.Request <= 0 || b.Long <= 0 || b.Max <= 0 {
+			add("authz.budgets.request/long/max: must be positive (AUTHZ_REQUEST_BUDGET, AUTHZ_LONG_REQUEST_BUDGET, AUTHZ_MAX_REQUEST_BUDGET)")
+		} else if b.Request > b.Max || b.Long > b.Max {
+			add("authz.budgets.max: must be at least the request and long budgets, got %s (AUTHZ_MAX_REQUEST_BUDGET)", b.Max.Std())
+		}
+		if b.Database < 0 || b.Rules < 0 {
+			add("authz.budgets.database/rules: must not be negative (AUTHZ_DB_BUDGET, AUTHZ_RULE_BUDGET)")
+		}
+		if l := c.Authz.ConditionLimits; l.MaxLength < 0 || l.MaxDepth < 0 || l.MaxRuleCalls < 0 {
+			add("authz.condition_limits: must not be negative, 0 disables a limit (AUTHZ_MAX_CONDITION_LENGTH, AUTHZ_MAX_CONDITION_DEPTH, AUTHZ_MAX_CONDITION_RULE_CALLS)")
+		}
+		if t := c.Authz.TenantRules; t.MaxRules < 0 || t.Timeout < 0 {
+			add("authz.tenant_rules: must not be negative, 0 disables a limit (AUTHZ_TENANT_RULE_MAX, AUTHZ_TENANT_RULE_TIMEOUT)")
+		}
+
+	case ServiceReconcile:
+		c.validateDatabase(add)
+		c.validateSupraHost(add)
+
+	default:
+		add("unknown service %q", service)
+	}
+
+	if c.Shutdown.Delay < 0 || c.Shutdown.Timeout <= 0 {
+		add("shutdown.delay/timeout: delay must not be negative and timeout must be positive (SHUTDOWN_DELAY, SHUTDOWN_TIMEOUT)")
+	}
+	if c.Database.SlowQueryThreshold < 0 {
+		add("database.slow_query_threshold: must not be negative (DB_SLOW_QUERY_THRESHOLD, e.g. 500ms)")
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateDatabase(add func(string, ...interface{})) {
+	if c.Database.URL != "" {
+		if err := validatePostgresURL(c.Database.URL); err != nil {
+			add("database.url: %v", err)
+		}
+		return
+	}
+
+	if c.Database.Host == "" {
+		add("database.host: must be set (DB_HOST) or provide database.url (API_DB_URL)")
+	}
+	if c.Database.Name == "" {
+		add("database.name: must be set (DB_NAME)")
+	}
+	if c.Database.User == "" {
+		add("database.user: must be set (DB_USER)")
+	}
+}
+
+func (c *Config) validateSupraHost(add func(string, ...interface{})) {
+	u, err := url.Parse(c.Supra.Host)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		add("supra.host: %q must be an absolute URL such as http://localhost:4780 (SUPRA_HOST)", c.Supra.Host)
+	}
+}
+
+func validatePostgresURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("not a valid URL")
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return fmt.Errorf("scheme must be postgres:// or postgresql://, got %q", u.Scheme)
+	}
+	if strings.TrimPrefix(u.Path, "/") == "" {
+		return fmt.Errorf("database name is missing from the URL path")
+	}
+	return nil
+}
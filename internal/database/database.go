@@ -0,0 +1,80 @@
+// Package database opens the application database shared by the API server
+// and the reconciler.
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/config"
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/dangerclosesec/supra/internal/secrets"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open connects to the application database described by cfg. New connections
+// take their credentials from secretManager, so rotated passwords are picked up
+// without a restart. Queries are recorded by queries, which may be nil.
+func Open(cfg *config.Config, secretManager *secrets.Manager, queries *dbtrace.Recorder) (*gorm.DB, error) {
+	connConfig, err := pgx.ParseConfig(cfg.DatabaseDSN())
+	if err != nil {
+		return nil, fmt.Errorf("parsing database configuration: %w", err)
+	}
+
+	// New connections pick up rotated credentials
+	var password *secrets.Secret
+	if cfg.Database.URL == "" {
+		password = secretManager.Get(config.SecretDatabasePassword)
+	}
+	beforeConnect := secrets.PostgresBeforeConnect(secretManager.Get(config.SecretDatabaseURL), password)
+	connDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(beforeConnect))
+
+	gormConfig := &gorm.Config{
+		// Queries are logged by the recorder, when slow or when
+		// database.log_queries is set
+		Logger: queries.GormLogger(logger.Default.LogMode(logger.Info)),
+		NowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: connDB}), gormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("getting database instance: %w", err)
+	}
+
+	// Configure connection pool
+	sqlDB.SetMaxOpenConns(25)
+	sqlDB.SetMaxIdleConns(25)
+	sqlDB.SetConnMaxLifetime(5 * time.Minute)
+	sqlDB.SetConnMaxIdleTime(5 * time.Minute)
+
+	// Drop idle connections when credentials rotate; busy ones are replaced
+	// as they reach their maximum lifetime
+	reconnect := func(string) {
+		sqlDB.SetMaxIdleConns(0)
+		sqlDB.SetMaxIdleConns(25)
+	}
+	secretManager.OnRotate(config.SecretDatabaseURL, reconnect)
+	secretManager.OnRotate(config.SecretDatabasePassword, reconnect)
+
+	// Verify connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("pinging database: %w", err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,203 @@
+// Package dbtrace attributes database load to the application paths that
+// cause it. Queries are counted and timed under the label on their context,
+// such as the HTTP route or background job that ran them, slow ones are
+// logged, and the totals are served in the Prometheus text format. It
+// instruments the API's gorm database and the authz service's pgx pool
+// alike.
+package dbtrace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Unlabeled is the label of queries whose context carries none
+const Unlabeled = "unlabeled"
+
+// otherLabel collects queries once maxLabels labels are tracked, so a label
+// built from request data can't grow the metrics without bound
+const (
+	otherLabel = "other"
+	maxLabels  = 500
+)
+
+// maxLoggedQuery is how much of a query's SQL is logged
+const maxLoggedQuery = 500
+
+type labelKey struct{}
+
+// WithLabel returns a context whose queries are attributed to label, e.g.
+// "GET /entity" or "jobs.export". An inner label replaces an outer one.
+func WithLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, labelKey{}, func() string { return label })
+}
+
+// WithLabelFunc is like WithLabel for a label only known once the query
+// runs, such as a route pattern a router fills in after the middleware
+// that sets the label
+func WithLabelFunc(ctx context.Context, label func() string) context.Context {
+	return context.WithValue(ctx, labelKey{}, label)
+}
+
+// Label returns the label queries run with ctx are attributed to
+func Label(ctx context.Context) string {
+	if ctx != nil {
+		if label, ok := ctx.Value(labelKey{}).(func() string); ok {
+			if l := label(); l != "" {
+				return l
+			}
+		}
+	}
+	return Unlabeled
+}
+
+// Options configure a Recorder
+type Options struct {
+	// Database names the database in metrics and log lines, e.g. api or
+	// authz
+	Database string
+	// SlowThreshold counts and logs queries that take at least this long;
+	// zero disables both
+	SlowThreshold time.Duration
+	// LogQueries logs every query, not only slow ones
+	LogQueries bool
+}
+
+// LabelStats are the queries run under one label
+type LabelStats struct {
+	Label   string  `json:"label"`
+	Queries int64   `json:"queries"`
+	Errors  int64   `json:"errors"`
+	Slow    int64   `json:"slow"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Recorder counts queries by label. A nil Recorder records nothing.
+type Recorder struct {
+	opts Options
+
+	mu    sync.Mutex
+	stats map[string]*LabelStats
+}
+
+// New returns a Recorder for one database
+func New(opts Options) *Recorder {
+	return &Recorder{opts: opts, stats: make(map[string]*LabelStats)}
+}
+
+// Observe records a finished query and logs it when it was slow or every
+// query is logged
+func (r *Recorder) Observe(ctx context.Context, sql string, elapsed time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	label := Label(ctx)
+	slow := r.opts.SlowThreshold > 0 && elapsed >= r.opts.SlowThreshold
+
+	r.mu.Lock()
+	s, ok := r.stats[label]
+	if !ok {
+		if len(r.stats) >= maxLabels {
+			label = otherLabel
+			s = r.stats[label]
+		}
+		if s == nil {
+			s = &LabelStats{Label: label}
+			r.stats[label] = s
+		}
+	}
+	s.Queries++
+	s.Seconds += elapsed.Seconds()
+	if err != nil {
+		s.Errors++
+	}
+	if slow {
+		s.Slow++
+	}
+	r.mu.Unlock()
+
+	switch {
+	case slow:
+		log.Printf("[db %s] slow query (%s) from %s: %s", r.opts.Database, elapsed, label, compact(sql))
+	case r.opts.LogQueries:
+		log.Printf("[db %s] %s %s: %s", r.opts.Database, label, elapsed, compact(sql))
+	}
+}
+
+// Stats returns the queries recorded so far, by label
+func (r *Recorder) Stats() []LabelStats {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make([]LabelStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Label < stats[j].Label })
+	return stats
+}
+
+// WriteMetrics writes the recorded queries in the Prometheus text
+// exposition format. Each call writes the HELP and TYPE lines, so an
+// endpoint serves one Recorder.
+func (r *Recorder) WriteMetrics(w io.Writer) {
+	stats := r.Stats()
+	db := escapeLabel(r.database())
+	var b strings.Builder
+
+	b.WriteString("# HELP supra_db_queries_total Database queries by database and application label.\n")
+	b.WriteString("# TYPE supra_db_queries_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(&b, "supra_db_queries_total{db=\"%s\",label=\"%s\"} %d\n", db, escapeLabel(s.Label), s.Queries)
+	}
+
+	b.WriteString("# HELP supra_db_query_errors_total Failed database queries by database and application label.\n")
+	b.WriteString("# TYPE supra_db_query_errors_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(&b, "supra_db_query_errors_total{db=\"%s\",label=\"%s\"} %d\n", db, escapeLabel(s.Label), s.Errors)
+	}
+
+	b.WriteString("# HELP supra_db_slow_queries_total Database queries over the slow query threshold by database and application label.\n")
+	b.WriteString("# TYPE supra_db_slow_queries_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(&b, "supra_db_slow_queries_total{db=\"%s\",label=\"%s\"} %d\n", db, escapeLabel(s.Label), s.Slow)
+	}
+
+	b.WriteString("# HELP supra_db_query_seconds_total Time spent in database queries by database and application label.\n")
+	b.WriteString("# TYPE supra_db_query_seconds_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(&b, "supra_db_query_seconds_total{db=\"%s\",label=\"%s\"} %g\n", db, escapeLabel(s.Label), s.Seconds)
+	}
+
+	io.WriteString(w, b.String())
+}
+
+func (r *Recorder) database() string {
+	if r == nil {
+		return ""
+	}
+	return r.opts.Database
+}
+
+// compact puts a query on one line and shortens it for the log
+func compact(sql string) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	if len(sql) > maxLoggedQuery {
+		sql = sql[:maxLoggedQuery] + "..."
+	}
+	return sql
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
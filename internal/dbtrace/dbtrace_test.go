@@ -0,0 +1,127 @@
+package dbtrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestLabel(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, Unlabeled, Label(ctx))
+
+	ctx = WithLabel(ctx, "POST /entity")
+	assert.Equal(t, "POST /entity", Label(ctx))
+	assert.Equal(t, "jobs.export", Label(WithLabel(ctx, "jobs.export")), "an inner label wins")
+
+	pattern := ""
+	lazy := WithLabelFunc(context.Background(), func() string { return pattern })
+	assert.Equal(t, Unlabeled, Label(lazy), "an empty label falls back")
+	pattern = "GET /api/organizations/{orgID}"
+	assert.Equal(t, pattern, Label(lazy), "the label is read when the query runs")
+}
+
+func TestObserve(t *testing.T) {
+	r := New(Options{Database: "authz", SlowThreshold: 100 * time.Millisecond})
+	ctx := WithLabel(context.Background(), "POST /check")
+
+	r.Observe(ctx, "SELECT 1", 10*time.Millisecond, nil)
+	r.Observe(ctx, "SELECT 1", 150*time.Millisecond, nil)
+	r.Observe(ctx, "SELECT 1", time.Millisecond, errors.New("boom"))
+	r.Observe(context.Background(), "SELECT 2", time.Millisecond, nil)
+
+	stats := r.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, LabelStats{Label: "POST /check", Queries: 3, Errors: 1, Slow: 1, Seconds: 0.161}, round(stats[0]))
+	assert.Equal(t, Unlabeled, stats[1].Label)
+
+	var nilRecorder *Recorder
+	nilRecorder.Observe(ctx, "SELECT 1", time.Second, nil)
+	assert.Empty(t, nilRecorder.Stats())
+}
+
+func TestObserveCapsLabels(t *testing.T) {
+	r := New(Options{})
+	for i := 0; i < maxLabels+10; i++ {
+		r.Observe(WithLabel(context.Background(), fmt.Sprintf("label-%d", i)), "SELECT 1", 0, nil)
+	}
+	stats := r.Stats()
+	assert.Len(t, stats, maxLabels+1)
+
+	var other int64
+	for _, s := range stats {
+		if s.Label == otherLabel {
+			other = s.Queries
+		}
+	}
+	assert.EqualValues(t, 10, other)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	r := New(Options{Database: "api"})
+	r.Observe(WithLabel(context.Background(), `GET /a"b`), "SELECT 1", time.Second, nil)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE supra_db_queries_total counter\n")
+	assert.Contains(t, body, `supra_db_queries_total{db="api",label="GET /a\"b"} 1`)
+	assert.Contains(t, body, `supra_db_query_seconds_total{db="api",label="GET /a\"b"} 1`)
+}
+
+type recordingTracer struct{ started, ended int }
+
+func (r *recordingTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	r.started++
+	return ctx
+}
+
+func (r *recordingTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {
+	r.ended++
+}
+
+func TestQueryTracer(t *testing.T) {
+	r := New(Options{})
+	next := &recordingTracer{}
+	tracer := r.QueryTracer(next)
+
+	ctx := tracer.TraceQueryStart(WithLabel(context.Background(), "jobs.export"), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	require.Len(t, r.Stats(), 1)
+	assert.Equal(t, "jobs.export", r.Stats()[0].Label)
+	assert.EqualValues(t, 1, r.Stats()[0].Errors)
+	assert.Equal(t, 1, next.started)
+	assert.Equal(t, 1, next.ended)
+}
+
+func TestGormLogger(t *testing.T) {
+	r := New(Options{})
+	l := r.GormLogger(logger.Discard).LogMode(logger.Silent)
+	ctx := WithLabel(context.Background(), "POST /api/auth/login")
+	query := func() (string, int64) { return "SELECT * FROM users", 0 }
+
+	l.Trace(ctx, time.Now(), query, nil)
+	l.Trace(ctx, time.Now(), query, gorm.ErrRecordNotFound)
+	l.Trace(ctx, time.Now(), query, errors.New("boom"))
+
+	require.Len(t, r.Stats(), 1)
+	assert.EqualValues(t, 3, r.Stats()[0].Queries)
+	assert.EqualValues(t, 1, r.Stats()[0].Errors, "a missing record is not an error")
+}
+
+func round(s LabelStats) LabelStats {
+	s.Seconds = float64(time.Duration(s.Seconds*float64(time.Second)).Round(time.Millisecond)) / float64(time.Second)
+	return s
+}
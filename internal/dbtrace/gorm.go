@@ -0,0 +1,46 @@
+package dbtrace
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// GormLogger returns a gorm logger that records every query and logs slow
+// ones, passing gorm's other messages to next. A missing record is not
+// counted as an error, as gorm reports it for an empty First.
+func (r *Recorder) GormLogger(next logger.Interface) logger.Interface {
+	return &gormLogger{recorder: r, next: next}
+}
+
+type gormLogger struct {
+	recorder *Recorder
+	next     logger.Interface
+}
+
+func (l *gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &gormLogger{recorder: l.recorder, next: l.next.LogMode(level)}
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.next.Info(ctx, msg, args...)
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.next.Warn(ctx, msg, args...)
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.next.Error(ctx, msg, args...)
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	sql, _ := fc()
+	l.recorder.Observe(ctx, sql, time.Since(begin), err)
+}
@@ -0,0 +1,42 @@
+package dbtrace
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueryTracer returns a pgx tracer that records every query, then hands off
+// to next if it is set
+func (r *Recorder) QueryTracer(next pgx.QueryTracer) pgx.QueryTracer {
+	return &queryTracer{recorder: r, next: next}
+}
+
+type queryTracer struct {
+	recorder *Recorder
+	next     pgx.QueryTracer
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql string
+	at  time.Time
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.next != nil {
+		ctx = t.next.TraceQueryStart(ctx, conn, data)
+	}
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, at: time.Now()})
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if start, ok := ctx.Value(queryStartKey{}).(queryStart); ok {
+		t.recorder.Observe(ctx, start.sql, time.Since(start.at), data.Err)
+	}
+	if t.next != nil {
+		t.next.TraceQueryEnd(ctx, conn, data)
+	}
+}
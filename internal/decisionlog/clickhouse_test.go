@@ -0,0 +1,100 @@
+package decisionlog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clickHouseRequest struct {
+	query   string
+	body    string
+	user    string
+	key     string
+	rawPath string
+}
+
+func fakeClickHouse(t *testing.T, status int) (*httptest.Server, *[]clickHouseRequest) {
+	var requests []clickHouseRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, clickHouseRequest{
+			query:   r.URL.Query().Get("query"),
+			body:    string(body),
+			user:    r.Header.Get("X-ClickHouse-User"),
+			key:     r.Header.Get("X-ClickHouse-Key"),
+			rawPath: r.URL.RawQuery,
+		})
+		if status != http.StatusOK {
+			http.Error(w, "Code: 60. DB::Exception: Table analytics.decisions does not exist", status)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestClickHouseSinkWrite(t *testing.T) {
+	srv, requests := fakeClickHouse(t, http.StatusOK)
+	sink, err := NewClickHouseSink(strings.Replace(srv.URL, "http://", "http://writer:s3cret@", 1)+"/?database=analytics", "decisions")
+	require.NoError(t, err)
+
+	at := time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.FixedZone("EST", -5*3600))
+	err = sink.Write(context.Background(), []Decision{
+		{Time: at, Tenant: "acme", SubjectType: "user", SubjectID: "alice", Permission: "view",
+			ObjectType: "document", ObjectID: "d1", Allowed: true, Reason: "matched_relation",
+			Duration: 1500 * time.Microsecond, SampleRate: 0.5},
+		{Time: at, SubjectType: "user", SubjectID: "bob", Permission: "view",
+			ObjectType: "document", ObjectID: "d1", Reason: "denied_no_path", SampleRate: 0.5},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, *requests, 1)
+	req := (*requests)[0]
+	assert.Equal(t, "INSERT INTO decisions FORMAT JSONEachRow", req.query)
+	assert.Contains(t, req.rawPath, "database=analytics")
+	assert.Equal(t, "writer", req.user)
+	assert.Equal(t, "s3cret", req.key)
+	assert.NotContains(t, req.rawPath, "s3cret", "credentials stay out of the URL")
+
+	lines := strings.Split(strings.TrimSpace(req.body), "\n")
+	require.Len(t, lines, 2)
+	var row map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+	assert.Equal(t, "2026-03-01 17:30:00.123456", row["time"], "times are stored in UTC")
+	assert.Equal(t, "acme", row["tenant"])
+	assert.Equal(t, true, row["allowed"])
+	assert.Equal(t, float64(1500), row["duration_us"])
+	assert.Equal(t, 0.5, row["sample_rate"])
+}
+
+func TestClickHouseSinkCreateTable(t *testing.T) {
+	srv, requests := fakeClickHouse(t, http.StatusOK)
+	sink, err := NewClickHouseSink(srv.URL, "")
+	require.NoError(t, err)
+
+	require.NoError(t, sink.CreateTable(context.Background()))
+	require.Len(t, *requests, 1)
+	assert.Empty(t, (*requests)[0].user)
+	assert.True(t, strings.HasPrefix((*requests)[0].body, "CREATE TABLE IF NOT EXISTS authz_decisions ("))
+}
+
+func TestClickHouseSinkErrors(t *testing.T) {
+	srv, _ := fakeClickHouse(t, http.StatusNotFound)
+	sink, err := NewClickHouseSink(srv.URL, "analytics.decisions")
+	require.NoError(t, err)
+	err = sink.Write(context.Background(), []Decision{{}})
+	assert.ErrorContains(t, err, "does not exist")
+
+	_, err = NewClickHouseSink("tcp://clickhouse:9000", "")
+	assert.ErrorContains(t, err, "scheme must be http or https")
+	_, err = NewClickHouseSink(srv.URL, "decisions; DROP TABLE x")
+	assert.ErrorContains(t, err, "invalid ClickHouse table name")
+}
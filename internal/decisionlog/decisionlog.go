@@ -0,0 +1,209 @@
+// Package decisionlog streams sampled permission decisions to an analytics
+// store. Unlike the audit log it is best effort: decisions are batched in
+// the background and dropped, not spooled, when the store falls behind.
+package decisionlog
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Decision is one permission check
+type Decision struct {
+	Time        time.Time
+	Tenant      string
+	SubjectType string
+	SubjectID   string
+	Permission  string
+	ObjectType  string
+	ObjectID    string
+	Allowed     bool
+	Reason      string
+	Duration    time.Duration
+	RequestID   string
+	ClientIP    string
+	// SampleRate is the fraction of decisions kept when this one was, so
+	// counts can be scaled back up by 1/SampleRate
+	SampleRate float64
+}
+
+// Sink stores batches of decisions
+type Sink interface {
+	Write(ctx context.Context, decisions []Decision) error
+}
+
+// Options tune sampling and batching
+type Options struct {
+	// SampleRate is the fraction of decisions kept, from 0 to 1; zero keeps
+	// all of them
+	SampleRate float64
+	// QueueSize bounds the decisions waiting to be written
+	QueueSize int
+	// BatchSize is the most decisions written in one insert
+	BatchSize int
+	// FlushInterval is the longest a decision waits for a batch to fill
+	FlushInterval time.Duration
+}
+
+// DefaultOptions returns the options used for fields left zero
+func DefaultOptions() Options {
+	return Options{
+		QueueSize:     10000,
+		BatchSize:     1000,
+		FlushInterval: 5 * time.Second,
+	}
+}
+
+// writeAttempts is how many times a batch is tried before it is dropped
+const writeAttempts = 3
+
+// Streamer queues decisions and writes them to a sink in batches. A nil
+// Streamer records nothing.
+type Streamer struct {
+	sink Sink
+	opts Options
+
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan Decision
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// NewStreamer starts a streamer writing to sink
+func NewStreamer(sink Sink, opts Options) *Streamer {
+	defaults := DefaultOptions()
+	if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+		opts.SampleRate = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaults.QueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaults.FlushInterval
+	}
+
+	s := &Streamer{
+		sink:  sink,
+		opts:  opts,
+		queue: make(chan Decision, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Record samples d and queues it without blocking. Decisions that arrive
+// while the queue is full are dropped and counted.
+func (s *Streamer) Record(d Decision) {
+	if s == nil {
+		return
+	}
+	if s.opts.SampleRate < 1 && rand.Float64() >= s.opts.SampleRate {
+		return
+	}
+	d.SampleRate = s.opts.SampleRate
+	if d.Time.IsZero() {
+		d.Time = time.Now()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- d:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many sampled decisions were lost to a full queue or
+// a failing sink
+func (s *Streamer) Dropped() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.dropped.Load()
+}
+
+// Close stops accepting decisions and waits for queued ones to be written,
+// or for ctx to expire
+func (s *Streamer) Close(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Streamer) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Decision, 0, s.opts.BatchSize)
+	for {
+		select {
+		case d, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, d)
+			if len(batch) >= s.opts.BatchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes a batch, retrying briefly before giving it up
+func (s *Streamer) flush(batch []Decision) {
+	if len(batch) == 0 {
+		return
+	}
+
+	backoff := 250 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= writeAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = s.sink.Write(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt < writeAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	s.dropped.Add(uint64(len(batch)))
+	log.Printf("Dropping %d decisions after %d failed writes: %v", len(batch), writeAttempts, err)
+}
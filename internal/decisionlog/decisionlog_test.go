@@ -0,0 +1,90 @@
+package decisionlog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]Decision
+	err     error
+}
+
+func (m *memorySink) Write(_ context.Context, decisions []Decision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.batches = append(m.batches, append([]Decision(nil), decisions...))
+	return nil
+}
+
+func (m *memorySink) written() []Decision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var all []Decision
+	for _, b := range m.batches {
+		all = append(all, b...)
+	}
+	return all
+}
+
+func TestStreamerBatchesAndFlushesOnClose(t *testing.T) {
+	sink := &memorySink{}
+	s := NewStreamer(sink, Options{BatchSize: 2, FlushInterval: time.Hour})
+
+	for _, id := range []string{"a", "b", "c"} {
+		s.Record(Decision{SubjectType: "user", SubjectID: id, Allowed: true})
+	}
+	require.NoError(t, s.Close(context.Background()))
+
+	written := sink.written()
+	require.Len(t, written, 3)
+	assert.Len(t, sink.batches, 2, "a full batch is written as soon as it fills, the rest on close")
+	assert.Equal(t, 1.0, written[0].SampleRate)
+	assert.False(t, written[0].Time.IsZero())
+
+	s.Record(Decision{SubjectID: "late"})
+	assert.Len(t, sink.written(), 3, "decisions after Close are ignored")
+}
+
+func TestStreamerSampling(t *testing.T) {
+	sink := &memorySink{}
+	s := NewStreamer(sink, Options{SampleRate: 0.25, FlushInterval: time.Hour})
+	for i := 0; i < 4000; i++ {
+		s.Record(Decision{})
+	}
+	require.NoError(t, s.Close(context.Background()))
+
+	written := sink.written()
+	assert.InDelta(t, 1000, len(written), 200)
+	assert.Equal(t, 0.25, written[0].SampleRate)
+}
+
+func TestStreamerDropsWhenFull(t *testing.T) {
+	sink := &memorySink{err: errors.New("unavailable")}
+	s := NewStreamer(sink, Options{QueueSize: 1, BatchSize: 1, FlushInterval: time.Hour})
+	for i := 0; i < 10; i++ {
+		s.Record(Decision{})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, s.Close(ctx))
+	assert.Equal(t, uint64(10), s.Dropped(), "every decision is either rejected by the queue or given up by the writer")
+}
+
+func TestNilStreamer(t *testing.T) {
+	var s *Streamer
+	s.Record(Decision{})
+	assert.Zero(t, s.Dropped())
+	assert.NoError(t, s.Close(context.Background()))
+}
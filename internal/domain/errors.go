@@ -24,6 +24,10 @@ var (
 	ErrInvalidVerificationCode = errors.New("invalid verification code")
 	ErrVerificationExpired     = errors.New("verification code expired")
 	ErrAlreadyVerified         = errors.New("already verified")
+	// ErrTooManyVerificationAttempts locks verification until a new link
+	// is requested
+	ErrTooManyVerificationAttempts = errors.New("too many verification attempts")
+	ErrResendTooSoon               = errors.New("verification email sent too recently")
 
 	// Organization-related errors
 	ErrOrganizationNotFound = errors.New("organization not found")
@@ -12,7 +12,11 @@ func (s *Service) sendWithSendgrid(data EmailData, htmlContent, textContent stri
 	to := mail.NewEmail("", data.To)
 	message := mail.NewSingleEmail(from, data.Subject, to, textContent, htmlContent)
 
-	response, err := s.sendgridClient.Send(message)
+	s.clientMu.RLock()
+	client := s.sendgridClient
+	s.clientMu.RUnlock()
+
+	response, err := client.Send(message)
 	if err != nil {
 		return fmt.Errorf("failed to send email via Sendgrid: %w", err)
 	}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"sync"
 
 	"github.com/dangerclosesec/supra"
 	"github.com/dangerclosesec/supra/internal/config"
@@ -37,6 +38,7 @@ type EmailData struct {
 type Service struct {
 	config         *config.Config
 	provider       Provider
+	clientMu       sync.RWMutex
 	sendgridClient *sendgrid.Client
 	Templates      map[string]*Template
 }
@@ -65,6 +67,13 @@ func NewEmailService(config *config.Config, provider Provider) (*Service, error)
 	return s, nil
 }
 
+// SetSendgridAPIKey replaces the Sendgrid client after the API key rotates
+func (s *Service) SetSendgridAPIKey(apiKey string) {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	s.sendgridClient = sendgrid.NewSendClient(apiKey)
+}
+
 // loadTemplates loads all email templates from the embedded filesystem
 func (s *Service) loadTemplates() error {
 	templateGroups, err := templateFS.ReadDir(DefaultTemplatePath)
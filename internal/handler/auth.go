@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/dangerclosesec/supra/internal/domain"
+	"github.com/dangerclosesec/supra/internal/middleware"
 	"github.com/dangerclosesec/supra/internal/model"
 	"github.com/dangerclosesec/supra/internal/service"
 	chmw "github.com/go-chi/chi/v5/middleware"
@@ -27,6 +28,17 @@ func NewAuthHandler(userService *service.UserService, cacheService *service.Cach
 	}
 }
 
+// SignupQuery holds the query parameters of a signup
+type SignupQuery struct {
+	Nonce string `query:"nonce" validate:"required"`
+}
+
+// LoginQuery holds the query parameters of a login. The nonce is fetched
+// with GET /login and is good for one login attempt.
+type LoginQuery struct {
+	Nonce string `query:"nonce" validate:"required"`
+}
+
 type SignupResponse struct {
 	BaseResponse
 	User  *model.User `json:"user" sanitize:"user"`
@@ -41,37 +53,21 @@ func (h *AuthHandler) SignupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == http.MethodGet {
-		nonce, err := h.userService.GenerateNonce(r.Context())
-		if err != nil {
-			h.respondWithError(w, http.StatusInternalServerError, "Failed to generate nonce")
-			return
-		}
-
-		h.respondWithJSON(w, http.StatusOK, map[string]string{"nonce": nonce})
+		h.respondWithNonce(w, r)
 		return
 	}
 
-	// Check for nonce query string parameter
-	nonce := r.URL.Query().Get("nonce")
-	if nonce == "" {
-		h.respondWithError(w, http.StatusBadRequest, "Nonce is required")
-		return
-	}
-
-	// Verify nonce against cache service
-	exists, err := h.cacheService.CheckNonce(r.Context(), nonce)
-	if err != nil || !exists {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid or expired nonce")
+	// The query and body are validated by the route's middleware
+	query, queryOK := middleware.Query[SignupQuery](r)
+	input, bodyOK := middleware.Body[service.SignupInput](r)
+	if !queryOK || !bodyOK {
+		h.respondWithError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	// Parses the request body
-	var input service.SignupInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if !h.validateNonce(w, r, query.Nonce) {
 		return
 	}
-	defer r.Body.Close()
 
 	// Calls the service layer to handle the signup
 	output, err := h.userService.Signup(r.Context(), input)
@@ -120,17 +116,29 @@ type MFADetails struct {
 }
 
 func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
 		h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	var input service.LoginInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if r.Method == http.MethodGet {
+		h.respondWithNonce(w, r)
+		return
+	}
+
+	// The query and body are validated by the route's middleware
+	query, queryOK := middleware.Query[LoginQuery](r)
+	input, bodyOK := middleware.Body[service.LoginInput](r)
+	if !queryOK || !bodyOK {
+		h.respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	// A nonce is used up by the first attempt, so a captured login request
+	// can't be replayed
+	if !h.validateNonce(w, r, query.Nonce) {
 		return
 	}
-	defer r.Body.Close()
 
 	// First phase: Password verification
 	output, err := h.userService.VerifyPassword(r.Context(), input)
@@ -230,11 +238,11 @@ func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) VerifyHandler(w http.ResponseWriter, r *http.Request) {
-	var input service.VerifyInput
-
-	query := r.URL.Query()
-	input.Code = query.Get("code")
-	input.UserID = query.Get("user")
+	input, ok := middleware.Query[service.VerifyInput](r)
+	if !ok {
+		h.respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
 
 	if err := h.userService.VerifyEmail(r.Context(), input); err != nil {
 		slog.ErrorContext(r.Context(), "User verification error", "error", err, "requestID", chmw.GetReqID(r.Context()))
@@ -242,7 +250,11 @@ func (h *AuthHandler) VerifyHandler(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, domain.ErrUserNotFound):
 			h.respondWithError(w, http.StatusNotFound, "User not found")
 		case errors.Is(err, domain.ErrInvalidVerificationCode):
-			h.respondWithError(w, http.StatusBadRequest, "Invalid verification code")
+			h.respondWithError(w, http.StatusBadRequest, "Invalid verification link")
+		case errors.Is(err, domain.ErrVerificationExpired):
+			h.respondWithError(w, http.StatusGone, "Verification link expired, request a new one")
+		case errors.Is(err, domain.ErrTooManyVerificationAttempts):
+			h.respondWithError(w, http.StatusTooManyRequests, "Too many verification attempts, request a new link")
 		case errors.Is(err, domain.ErrAlreadyVerified):
 			h.respondWithError(w, http.StatusBadRequest, "User already verified")
 		default:
@@ -254,6 +266,61 @@ func (h *AuthHandler) VerifyHandler(w http.ResponseWriter, r *http.Request) {
 	h.respondWithJSON(w, http.StatusOK, map[string]string{"message": "User verified successfully"})
 }
 
+// ResendVerificationHandler sends a new verification link. It answers the
+// same whether or not the address belongs to a user awaiting verification,
+// or was sent a link too recently, so it can't be used to find accounts.
+func (h *AuthHandler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	input, ok := middleware.Body[service.ResendVerificationInput](r)
+	if !ok {
+		h.respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	err := h.userService.ResendVerification(r.Context(), input)
+	switch {
+	case err == nil,
+		errors.Is(err, domain.ErrUserNotFound),
+		errors.Is(err, domain.ErrAlreadyVerified),
+		errors.Is(err, domain.ErrResendTooSoon):
+	default:
+		slog.ErrorContext(r.Context(), "Verification resend error", "error", err, "requestID", chmw.GetReqID(r.Context()))
+		h.respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If the address is awaiting verification, a new link has been sent",
+	})
+}
+
+// respondWithNonce answers with a new nonce for a signup or login
+func (h *AuthHandler) respondWithNonce(w http.ResponseWriter, r *http.Request) {
+	nonce, err := h.userService.GenerateNonce(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating nonce", "error", err, "requestID", chmw.GetReqID(r.Context()))
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to generate nonce")
+		return
+	}
+
+	h.respondWithJSON(w, http.StatusOK, map[string]string{"nonce": nonce})
+}
+
+// validateNonce uses up nonce, answering the request and returning false
+// if it isn't valid
+func (h *AuthHandler) validateNonce(w http.ResponseWriter, r *http.Request, nonce string) bool {
+	err := h.userService.ValidateNonce(r.Context(), nonce)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, domain.ErrInvalidNonce):
+		h.respondWithError(w, http.StatusBadRequest, "Invalid or expired nonce")
+	default:
+		slog.ErrorContext(r.Context(), "Error validating nonce", "error", err, "requestID", chmw.GetReqID(r.Context()))
+		h.respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+	return false
+}
+
 func (h *AuthHandler) respondWithError(w http.ResponseWriter, code int, message string) {
 	h.respondWithJSON(w, code, ErrorResponse{Error: message})
 }
@@ -3,12 +3,12 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-)
 
-// UserIDKey is the context key for the user ID
-type contextKey string
+	"github.com/dangerclosesec/supra/internal/middleware"
+)
 
-const UserIDKey = contextKey("userID")
+// UserIDKey is the context key for the user ID, as set by middleware.AuthMiddleware
+var UserIDKey = middleware.UserIDKey
 
 type ErrorResponse struct { // TypeGen: ErrorResponse
 	BaseResponse
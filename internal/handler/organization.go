@@ -0,0 +1,82 @@
+// internal/handler/organization.go
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/internal/domain"
+	"github.com/dangerclosesec/supra/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type OrganizationHandler struct {
+	service *service.OrganizationService
+}
+
+func NewOrganizationHandler(service *service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		service: service,
+	}
+}
+
+// OrganizationMemberResponse is a single organization membership
+type OrganizationMemberResponse struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// GetOrganization returns an organization. Authorization is enforced by the router.
+func (h *OrganizationHandler) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	orgID, err := uuid.Parse(chi.URLParam(r, "orgID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid organization ID")
+		return
+	}
+
+	org, err := h.service.GetOrganization(r.Context(), orgID)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"id":         org.ID,
+		"name":       org.Name,
+		"org_type":   org.OrgType,
+		"created_at": org.CreatedAt,
+	})
+}
+
+// ListMembers returns the members of an organization. Authorization is enforced by the router.
+func (h *OrganizationHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	orgID, err := uuid.Parse(chi.URLParam(r, "orgID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid organization ID")
+		return
+	}
+
+	members, err := h.service.ListMembers(r.Context(), orgID)
+	if err != nil {
+		h.handleError(w, err)
+		return
+	}
+
+	resp := make([]OrganizationMemberResponse, 0, len(members))
+	for _, m := range members {
+		resp = append(resp, OrganizationMemberResponse{UserID: m.UserID.String(), Role: m.Role})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handleError handles common error cases
+func (h *OrganizationHandler) handleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrOrganizationNotFound):
+		respondWithError(w, http.StatusNotFound, "Organization not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
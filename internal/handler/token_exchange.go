@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/domain"
+	"github.com/dangerclosesec/supra/internal/middleware"
+	"github.com/dangerclosesec/supra/internal/service"
+	chmw "github.com/go-chi/chi/v5/middleware"
+)
+
+// IssuedTokenTypeJWT is the issued_token_type of exchanged tokens, as in
+// OAuth 2.0 Token Exchange
+const IssuedTokenTypeJWT = "urn:ietf:params:oauth:token-type:jwt"
+
+type TokenExchangeHandler struct {
+	service *service.TokenExchangeService
+}
+
+func NewTokenExchangeHandler(service *service.TokenExchangeService) *TokenExchangeHandler {
+	return &TokenExchangeHandler{
+		service: service,
+	}
+}
+
+// TokenExchangeResponse is an org-scoped access token
+type TokenExchangeResponse struct {
+	BaseResponse
+	AccessToken     string   `json:"access_token"`
+	IssuedTokenType string   `json:"issued_token_type"`
+	TokenType       string   `json:"token_type"`
+	ExpiresIn       int      `json:"expires_in"`
+	Audience        string   `json:"audience"`
+	Roles           []string `json:"roles"`
+}
+
+// Exchange trades the caller's user token for one scoped to an
+// organization they belong to
+func (h *TokenExchangeHandler) Exchange(w http.ResponseWriter, r *http.Request) {
+	claims, claimsOK := middleware.Claims(r.Context())
+	input, bodyOK := middleware.Body[service.TokenExchangeInput](r)
+	if !claimsOK || !bodyOK {
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	output, err := h.service.Exchange(r.Context(), claims, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidInput):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrOrganizationNotFound), errors.Is(err, domain.ErrUnauthorized):
+			// Unknown organizations get the same answer as ones the user isn't in
+			respondWithError(w, http.StatusForbidden, "Not a member of the organization")
+		default:
+			slog.ErrorContext(r.Context(), "Token exchange error", "error", err, "requestID", chmw.GetReqID(r.Context()))
+			respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, TokenExchangeResponse{
+		BaseResponse:    BaseResponse{Ok: true},
+		AccessToken:     output.Token,
+		IssuedTokenType: IssuedTokenTypeJWT,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(time.Until(output.ExpiresAt).Seconds()),
+		Audience:        output.OrganizationID,
+		Roles:           output.Roles,
+	})
+}
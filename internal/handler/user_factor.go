@@ -2,11 +2,11 @@
 package handler
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
 
 	"github.com/dangerclosesec/supra/internal/domain"
+	"github.com/dangerclosesec/supra/internal/middleware"
 	"github.com/dangerclosesec/supra/internal/model"
 	"github.com/dangerclosesec/supra/internal/service"
 	"github.com/go-chi/chi/v5"
@@ -25,8 +25,8 @@ func NewUserFactorHandler(service *service.UserFactorService) *UserFactorHandler
 
 // CreateFactorRequest represents the request body for creating a new factor
 type CreateFactorRequest struct {
-	FactorType model.FactorType `json:"factor_type"`
-	Material   string           `json:"material"`
+	FactorType model.FactorType `json:"factor_type" validate:"required,oneof=webauthn passkey hashpass pubkey totp openid sms email u2f backup_code verification_code"`
+	Material   string           `json:"material" validate:"required"`
 }
 
 // ListFactors returns all factors for the authenticated user
@@ -58,9 +58,9 @@ func (h *UserFactorHandler) CreateFactor(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var req CreateFactorRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	req, ok := middleware.Body[CreateFactorRequest](r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -81,7 +81,7 @@ func (h *UserFactorHandler) CreateFactor(w http.ResponseWriter, r *http.Request)
 
 // VerifyFactorRequest represents the request body for factor verification
 type VerifyFactorRequest struct {
-	Code string `json:"code"`
+	Code string `json:"code" validate:"required"`
 }
 
 // VerifyFactor verifies a specific factor
@@ -101,9 +101,9 @@ func (h *UserFactorHandler) VerifyFactor(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var req VerifyFactorRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	req, ok := middleware.Body[VerifyFactorRequest](r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -0,0 +1,464 @@
+// Package jobs runs long operations, such as exports, reports, garbage
+// collection and bulk imports, in the background instead of inside the HTTP
+// request that asked for them. Jobs are stored in the database, so any
+// replica can pick one up, report its progress or cancel it, and a job
+// whose replica stops is taken over by another.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/dbtrace"
+	"github.com/google/uuid"
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+var (
+	// ErrNotFound is returned for a job ID that doesn't exist
+	ErrNotFound = errors.New("job not found")
+	// ErrUnknownKind is returned when submitting a kind no handler is
+	// registered for
+	ErrUnknownKind = errors.New("unknown job kind")
+	// ErrNoResult is returned for the result of a job that hasn't
+	// succeeded or produced none
+	ErrNoResult = errors.New("job has no result")
+	// ErrFinished is returned when canceling a job that already finished
+	ErrFinished = errors.New("job already finished")
+)
+
+// Job is one submitted operation and where it has got to
+type Job struct {
+	ID       uuid.UUID       `json:"id"`
+	Kind     string          `json:"kind"`
+	Status   string          `json:"status"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Progress Progress        `json:"progress"`
+	Error    string          `json:"error,omitempty"`
+	// Attempts counts the runs started, including ones a stopped replica
+	// didn't finish
+	Attempts        int        `json:"attempts"`
+	Worker          string     `json:"worker,omitempty"`
+	CancelRequested bool       `json:"cancel_requested,omitempty"`
+	HasResult       bool       `json:"has_result"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job will not run again
+func (j *Job) Finished() bool {
+	switch j.Status {
+	case StatusSucceeded, StatusFailed, StatusCanceled:
+		return true
+	}
+	return false
+}
+
+// Progress counts the units of work a job has done, out of Total when the
+// job knows it
+type Progress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total,omitempty"`
+}
+
+// Result is what a job produced, kept for download until the job is pruned
+type Result struct {
+	ContentType string
+	Filename    string
+	Data        []byte
+}
+
+// JSONResult encodes v as a JSON result
+func JSONResult(filename string, v interface{}) (*Result, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{ContentType: "application/json", Filename: filename, Data: data}, nil
+}
+
+// Handler runs a job of one kind. It should return promptly once ctx is
+// done, which happens when the job is canceled or the replica stops, and
+// may call report as it goes. A nil result is fine for jobs that only have
+// side effects.
+type Handler func(ctx context.Context, job *Job, report func(Progress)) (*Result, error)
+
+// Filter selects jobs to list; zero fields match everything
+type Filter struct {
+	Kind   string
+	Status string
+	Limit  int
+}
+
+// Store keeps jobs. Claim must hand each job to one worker at a time, even
+// across replicas.
+type Store interface {
+	Create(ctx context.Context, kind string, params json.RawMessage) (*Job, error)
+	Get(ctx context.Context, id uuid.UUID) (*Job, error)
+	List(ctx context.Context, filter Filter) ([]Job, error)
+	// Claim starts the oldest queued job of one of the kinds, or a running
+	// one whose worker stopped heartbeating for staleAfter, and returns nil
+	// when there is none. Stale jobs that have used up maxAttempts fail
+	// instead.
+	Claim(ctx context.Context, kinds []string, worker string, staleAfter time.Duration, maxAttempts int) (*Job, error)
+	// Heartbeat records progress and reports whether cancellation was
+	// requested
+	Heartbeat(ctx context.Context, id uuid.UUID, worker string, progress Progress) (bool, error)
+	// Finish records the outcome of a run
+	Finish(ctx context.Context, id uuid.UUID, worker, status, errMsg string, result *Result) error
+	// Release puts a running job back in the queue, for a worker that is
+	// stopping
+	Release(ctx context.Context, id uuid.UUID, worker string) error
+	// RequestCancel cancels a queued job at once and asks the worker of a
+	// running one to stop
+	RequestCancel(ctx context.Context, id uuid.UUID) (*Job, error)
+	Result(ctx context.Context, id uuid.UUID) (*Result, error)
+	// Prune deletes jobs that finished before the given time
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Options tune the worker pool
+type Options struct {
+	// Workers is how many jobs this replica runs at once; zero only
+	// accepts jobs for other replicas to run
+	Workers int
+	// PollInterval is how often idle workers look for jobs submitted to
+	// other replicas
+	PollInterval time.Duration
+	// HeartbeatInterval is how often a running job's progress is saved
+	// and cancellation checked
+	HeartbeatInterval time.Duration
+	// StaleAfter is how long a running job may go without a heartbeat
+	// before another worker takes it over
+	StaleAfter time.Duration
+	// MaxAttempts bounds the runs of a job whose workers keep stopping
+	MaxAttempts int
+	// Retention is how long finished jobs and their results are kept
+	Retention time.Duration
+}
+
+// DefaultOptions returns the options used for fields left zero, except
+// Workers
+func DefaultOptions() Options {
+	return Options{
+		Workers:           2,
+		PollInterval:      2 * time.Second,
+		HeartbeatInterval: 2 * time.Second,
+		StaleAfter:        time.Minute,
+		MaxAttempts:       3,
+		Retention:         7 * 24 * time.Hour,
+	}
+}
+
+// pruneInterval is how often finished jobs past their retention are deleted
+const pruneInterval = time.Hour
+
+// errCanceled is the cause of a job context canceled by request
+var errCanceled = errors.New("job canceled")
+
+// Manager accepts jobs and runs them on a pool of workers
+type Manager struct {
+	store  Store
+	worker string
+	opts   Options
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	kinds    []string
+
+	wake   chan struct{}
+	ctx    context.Context
+	stop   context.CancelFunc
+	wg     sync.WaitGroup
+	closed chan struct{}
+}
+
+// New returns a Manager whose workers identify themselves as worker, e.g.
+// the replica's cluster ID
+func New(store Store, worker string, opts Options) *Manager {
+	defaults := DefaultOptions()
+	if opts.Workers < 0 {
+		opts.Workers = 0
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaults.PollInterval
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = defaults.HeartbeatInterval
+	}
+	if opts.StaleAfter <= 0 {
+		opts.StaleAfter = defaults.StaleAfter
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = defaults.Retention
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &Manager{
+		store:    store,
+		worker:   worker,
+		opts:     opts,
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+		ctx:      ctx,
+		stop:     stop,
+		closed:   make(chan struct{}),
+	}
+}
+
+// Register sets the handler for a kind of job. Handlers must be registered
+// before Start.
+func (m *Manager) Register(kind string, handler Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.handlers[kind]; !ok {
+		m.kinds = append(m.kinds, kind)
+	}
+	m.handlers[kind] = handler
+}
+
+// Kinds lists the registered kinds
+func (m *Manager) Kinds() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.kinds...)
+}
+
+func (m *Manager) handler(kind string) (Handler, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h, ok := m.handlers[kind]
+	return h, ok
+}
+
+// Submit queues a job of a registered kind with params encoded as JSON
+func (m *Manager) Submit(ctx context.Context, kind string, params interface{}) (*Job, error) {
+	if _, ok := m.handler(kind); !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job params: %w", err)
+	}
+	job, err := m.store.Create(ctx, kind, data)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get returns a job
+func (m *Manager) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	return m.store.Get(ctx, id)
+}
+
+// List returns jobs, newest first
+func (m *Manager) List(ctx context.Context, filter Filter) ([]Job, error) {
+	return m.store.List(ctx, filter)
+}
+
+// Cancel cancels a queued job or asks a running one to stop; it stops at
+// its worker's next heartbeat
+func (m *Manager) Cancel(ctx context.Context, id uuid.UUID) (*Job, error) {
+	return m.store.RequestCancel(ctx, id)
+}
+
+// Result returns what a succeeded job produced
+func (m *Manager) Result(ctx context.Context, id uuid.UUID) (*Result, error) {
+	return m.store.Result(ctx, id)
+}
+
+// Start runs the workers until Stop
+func (m *Manager) Start() {
+	for i := 0; i < m.opts.Workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	m.wg.Add(1)
+	go m.prune()
+}
+
+// Stop stops taking jobs and interrupts running ones, which are put back in
+// the queue for another replica, then waits for the workers or ctx
+func (m *Manager) Stop(ctx context.Context) error {
+	m.stop()
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before waiting again
+		for m.ctx.Err() == nil {
+			job, err := m.store.Claim(m.ctx, m.Kinds(), m.worker, m.opts.StaleAfter, m.opts.MaxAttempts)
+			if err != nil {
+				if m.ctx.Err() == nil {
+					log.Printf("Failed to claim job: %v", err)
+				}
+				break
+			}
+			if job == nil {
+				break
+			}
+			m.run(job)
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs one claimed job and records how it ended
+func (m *Manager) run(job *Job) {
+	handler, ok := m.handler(job.Kind)
+	if !ok {
+		m.finish(job, StatusFailed, fmt.Sprintf("no handler for kind %q", job.Kind), nil)
+		return
+	}
+	log.Printf("Running %s job %s (attempt %d)", job.Kind, job.ID, job.Attempts)
+
+	// Queries are attributed to the kind of job
+	ctx, cancel := context.WithCancelCause(dbtrace.WithLabel(m.ctx, "jobs."+job.Kind))
+	defer cancel(nil)
+
+	var mu sync.Mutex
+	progress := job.Progress
+	report := func(p Progress) {
+		mu.Lock()
+		progress = p
+		mu.Unlock()
+	}
+
+	// Saves progress and watches for cancellation while the handler runs
+	beats := make(chan struct{})
+	go func() {
+		defer close(beats)
+		ticker := time.NewTicker(m.opts.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			mu.Lock()
+			p := progress
+			mu.Unlock()
+			canceled, err := m.store.Heartbeat(ctx, job.ID, m.worker, p)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Failed to record progress of job %s: %v", job.ID, err)
+				}
+				continue
+			}
+			if canceled {
+				cancel(errCanceled)
+				return
+			}
+		}
+	}()
+
+	result, err := runHandler(ctx, handler, job, report)
+	cancel(nil)
+	<-beats
+
+	switch {
+	case errors.Is(context.Cause(ctx), errCanceled):
+		m.finish(job, StatusCanceled, "", nil)
+	case m.ctx.Err() != nil:
+		// The replica is stopping; another takes the job over
+		releaseCtx, done := context.WithTimeout(context.Background(), 5*time.Second)
+		defer done()
+		if err := m.store.Release(releaseCtx, job.ID, m.worker); err != nil {
+			log.Printf("Failed to release job %s: %v", job.ID, err)
+		}
+	case err != nil:
+		log.Printf("Job %s failed: %v", job.ID, err)
+		m.finish(job, StatusFailed, err.Error(), nil)
+	default:
+		m.finish(job, StatusSucceeded, "", result)
+	}
+}
+
+// runHandler calls the handler, turning a panic into an error so one bad
+// job can't take the replica down
+func runHandler(ctx context.Context, handler Handler, job *Job, report func(Progress)) (result *Result, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Job %s panicked: %v\n%s", job.ID, p, debug.Stack())
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, job, report)
+}
+
+func (m *Manager) finish(job *Job, status, errMsg string, result *Result) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.store.Finish(ctx, job.ID, m.worker, status, errMsg, result); err != nil {
+		log.Printf("Failed to record outcome of job %s: %v", job.ID, err)
+	}
+}
+
+// prune deletes expired jobs every pruneInterval. Every replica does it;
+// the deletes are idempotent.
+func (m *Manager) prune() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := m.store.Prune(m.ctx, time.Now().Add(-m.opts.Retention))
+		if err != nil {
+			if m.ctx.Err() == nil {
+				log.Printf("Failed to prune jobs: %v", err)
+			}
+			continue
+		}
+		if n > 0 {
+			log.Printf("Pruned %d finished jobs", n)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps jobs in a map, following PostgresStore's rules
+type memoryStore struct {
+	mu      sync.Mutex
+	jobs    map[uuid.UUID]*Job
+	results map[uuid.UUID]*Result
+	beats   map[uuid.UUID]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		jobs:    make(map[uuid.UUID]*Job),
+		results: make(map[uuid.UUID]*Result),
+		beats:   make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (s *memoryStore) Create(ctx context.Context, kind string, params json.RawMessage) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := &Job{ID: uuid.New(), Kind: kind, Status: StatusQueued, Params: params, CreatedAt: time.Now()}
+	s.jobs[job.ID] = job
+	copied := *job
+	return &copied, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (s *memoryStore) List(ctx context.Context, filter Filter) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := []Job{}
+	for _, job := range s.jobs {
+		if (filter.Kind == "" || job.Kind == filter.Kind) && (filter.Status == "" || job.Status == filter.Status) {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+func (s *memoryStore) Claim(ctx context.Context, kinds []string, worker string, staleAfter time.Duration, maxAttempts int) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stale := time.Now().Add(-staleAfter)
+	var oldest *Job
+	for _, job := range s.jobs {
+		isStale := job.Status == StatusRunning && s.beats[job.ID].Before(stale)
+		if isStale && job.Attempts >= maxAttempts {
+			job.Status, job.Error = StatusFailed, "abandoned by its worker too many times"
+			continue
+		}
+		if job.CancelRequested || (job.Status != StatusQueued && !isStale) || !contains(kinds, job.Kind) {
+			continue
+		}
+		if oldest == nil || job.CreatedAt.Before(oldest.CreatedAt) {
+			oldest = job
+		}
+	}
+	if oldest == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	oldest.Status, oldest.Worker, oldest.StartedAt = StatusRunning, worker, &now
+	oldest.Attempts++
+	s.beats[oldest.ID] = now
+	copied := *oldest
+	return &copied, nil
+}
+
+func (s *memoryStore) Heartbeat(ctx context.Context, id uuid.UUID, worker string, progress Progress) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Worker != worker || job.Status != StatusRunning {
+		return true, nil
+	}
+	job.Progress = progress
+	s.beats[id] = time.Now()
+	return job.CancelRequested, nil
+}
+
+func (s *memoryStore) Finish(ctx context.Context, id uuid.UUID, worker, status, errMsg string, result *Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Worker != worker || job.Status != StatusRunning {
+		return nil
+	}
+	now := time.Now()
+	job.Status, job.Error, job.FinishedAt = status, errMsg, &now
+	if result != nil {
+		s.results[id] = result
+		job.HasResult = true
+	}
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, id uuid.UUID, worker string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok && job.Worker == worker && job.Status == StatusRunning {
+		job.Status, job.Worker = StatusQueued, ""
+	}
+	return nil
+}
+
+func (s *memoryStore) RequestCancel(ctx context.Context, id uuid.UUID) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if job.Finished() {
+		return nil, ErrFinished
+	}
+	job.CancelRequested = true
+	if job.Status == StatusQueued {
+		job.Status = StatusCanceled
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (s *memoryStore) Result(ctx context.Context, id uuid.UUID) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result, ok := s.results[id]
+	if job.Status != StatusSucceeded || !ok {
+		return nil, ErrNoResult
+	}
+	return result, nil
+}
+
+func (s *memoryStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(before) {
+			delete(s.jobs, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func testOptions() Options {
+	return Options{Workers: 1, PollInterval: 10 * time.Millisecond, HeartbeatInterval: 10 * time.Millisecond}
+}
+
+// waitFor polls the job until it finishes
+func waitFor(t *testing.T, m *Manager, id uuid.UUID) *Job {
+	t.Helper()
+	var job *Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = m.Get(context.Background(), id)
+		require.NoError(t, err)
+		return job.Finished()
+	}, 5*time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestManagerRunsJobs(t *testing.T) {
+	m := New(newMemoryStore(), "worker-1", testOptions())
+	m.Register("echo", func(ctx context.Context, job *Job, report func(Progress)) (*Result, error) {
+		var params struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(job.Params, &params); err != nil {
+			return nil, err
+		}
+		report(Progress{Done: 1, Total: 1})
+		return &Result{ContentType: "text/plain", Filename: "echo.txt", Data: []byte(params.Message)}, nil
+	})
+	m.Start()
+	defer m.Stop(context.Background())
+
+	job, err := m.Submit(context.Background(), "echo", map[string]string{"message": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, job.Status)
+
+	job = waitFor(t, m, job.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "worker-1", job.Worker)
+
+	result, err := m.Result(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(result.Data))
+	assert.Equal(t, "echo.txt", result.Filename)
+}
+
+func TestManagerRejectsUnknownKinds(t *testing.T) {
+	m := New(newMemoryStore(), "worker-1", testOptions())
+
+	_, err := m.Submit(context.Background(), "missing", nil)
+	assert.ErrorIs(t, err, ErrUnknownKind)
+}
+
+func TestManagerRecordsFailuresAndPanics(t *testing.T) {
+	m := New(newMemoryStore(), "worker-1", testOptions())
+	m.Register("fail", func(ctx context.Context, job *Job, report func(Progress)) (*Result, error) {
+		return nil, errors.New("boom")
+	})
+	m.Register("panic", func(ctx context.Context, job *Job, report func(Progress)) (*Result, error) {
+		panic("oops")
+	})
+	m.Start()
+	defer m.Stop(context.Background())
+
+	failed, err := m.Submit(context.Background(), "fail", nil)
+	require.NoError(t, err)
+	panicked, err := m.Submit(context.Background(), "panic", nil)
+	require.NoError(t, err)
+
+	job := waitFor(t, m, failed.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, "boom", job.Error)
+
+	job = waitFor(t, m, panicked.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Contains(t, job.Error, "oops")
+
+	_, err = m.Result(context.Background(), failed.ID)
+	assert.ErrorIs(t, err, ErrNoResult)
+}
+
+func TestManagerCancelsRunningJobs(t *testing.T) {
+	m := New(newMemoryStore(), "worker-1", testOptions())
+	started := make(chan struct{})
+	m.Register("wait", func(ctx context.Context, job *Job, report func(Progress)) (*Result, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	m.Start()
+	defer m.Stop(context.Background())
+
+	job, err := m.Submit(context.Background(), "wait", nil)
+	require.NoError(t, err)
+	<-started
+
+	_, err = m.Cancel(context.Background(), job.ID)
+	require.NoError(t, err)
+	job = waitFor(t, m, job.ID)
+	assert.Equal(t, StatusCanceled, job.Status)
+
+	_, err = m.Cancel(context.Background(), job.ID)
+	assert.ErrorIs(t, err, ErrFinished)
+}
+
+func TestManagerCancelsQueuedJobs(t *testing.T) {
+	// No workers, so the job stays queued
+	m := New(newMemoryStore(), "worker-1", Options{})
+	m.Register("noop", func(ctx context.Context, job *Job, report func(Progress)) (*Result, error) {
+		return nil, nil
+	})
+
+	job, err := m.Submit(context.Background(), "noop", nil)
+	require.NoError(t, err)
+	job, err = m.Cancel(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCanceled, job.Status)
+
+	_, err = m.Cancel(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManagerReleasesJobsOnStop(t *testing.T) {
+	store := newMemoryStore()
+	m := New(store, "worker-1", testOptions())
+	started := make(chan struct{})
+	m.Register("wait", func(ctx context.Context, job *Job, report func(Progress)) (*Result, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	m.Start()
+
+	job, err := m.Submit(context.Background(), "wait", nil)
+	require.NoError(t, err)
+	<-started
+	require.NoError(t, m.Stop(context.Background()))
+
+	job, err = store.Get(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, job.Status, "another replica should pick the job up")
+}
+
+func TestManagerTakesOverStaleJobs(t *testing.T) {
+	store := newMemoryStore()
+	job, err := store.Create(context.Background(), "noop", nil)
+	require.NoError(t, err)
+	// A replica claimed the job, then stopped without heartbeating
+	_, err = store.Claim(context.Background(), []string{"noop"}, "worker-gone", time.Minute, 3)
+	require.NoError(t, err)
+	store.beats[job.ID] = time.Now().Add(-time.Hour)
+
+	opts := testOptions()
+	opts.StaleAfter = time.Minute
+	m := New(store, "worker-1", opts)
+	m.Register("noop", func(ctx context.Context, job *Job, report func(Progress)) (*Result, error) {
+		return nil, nil
+	})
+	m.Start()
+	defer m.Stop(context.Background())
+
+	job = waitFor(t, m, job.ID)
+	assert.Equal(t, StatusSucceeded, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, "worker-1", job.Worker)
+}
@@ -0,0 +1,238 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore keeps jobs in the authz_jobs table
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore returns a store backed by pool
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+// jobColumns are the columns scanned by scanJob, leaving out the result
+const jobColumns = `id, kind, status, params, progress_done, progress_total,
+	COALESCE(error, ''), attempts, COALESCE(worker, ''), cancel_requested,
+	result IS NOT NULL, created_at, started_at, finished_at`
+
+func scanJob(row pgx.Row) (*Job, error) {
+	var job Job
+	var params []byte
+	if err := row.Scan(&job.ID, &job.Kind, &job.Status, &params, &job.Progress.Done, &job.Progress.Total,
+		&job.Error, &job.Attempts, &job.Worker, &job.CancelRequested,
+		&job.HasResult, &job.CreatedAt, &job.StartedAt, &job.FinishedAt); err != nil {
+		return nil, err
+	}
+	job.Params = json.RawMessage(params)
+	return &job, nil
+}
+
+func (s *PostgresStore) Create(ctx context.Context, kind string, params json.RawMessage) (*Job, error) {
+	if len(params) == 0 || string(params) == "null" {
+		params = json.RawMessage("{}")
+	}
+	job, err := scanJob(s.pool.QueryRow(ctx, `
+		INSERT INTO authz_jobs (id, kind, params)
+		VALUES ($1, $2, $3)
+		RETURNING `+jobColumns, uuid.New(), kind, []byte(params)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+	return job, nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	job, err := scanJob(s.pool.QueryRow(ctx, `SELECT `+jobColumns+` FROM authz_jobs WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+func (s *PostgresStore) List(ctx context.Context, filter Filter) ([]Job, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+jobColumns+`
+		FROM authz_jobs
+		WHERE ($1 = '' OR kind = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3`, filter.Kind, filter.Status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, kinds []string, worker string, staleAfter time.Duration, maxAttempts int) (*Job, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	stale := time.Now().Add(-staleAfter)
+
+	// Stale jobs that have already been tried enough fail, rather than
+	// taking down one replica after another
+	if _, err := s.pool.Exec(ctx, `
+		UPDATE authz_jobs
+		SET status = 'failed', error = 'abandoned by its worker too many times', finished_at = NOW()
+		WHERE status = 'running' AND heartbeat_at < $1 AND attempts >= $2`,
+		stale, maxAttempts); err != nil {
+		return nil, fmt.Errorf("failed to fail abandoned jobs: %w", err)
+	}
+
+	job, err := scanJob(s.pool.QueryRow(ctx, `
+		UPDATE authz_jobs
+		SET status = 'running', worker = $1, attempts = attempts + 1,
+			started_at = NOW(), heartbeat_at = NOW()
+		WHERE id = (
+			SELECT id FROM authz_jobs
+			WHERE kind = ANY($2) AND NOT cancel_requested
+				AND (status = 'queued' OR (status = 'running' AND heartbeat_at < $3))
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns, worker, kinds, stale))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+func (s *PostgresStore) Heartbeat(ctx context.Context, id uuid.UUID, worker string, progress Progress) (bool, error) {
+	var cancelRequested bool
+	err := s.pool.QueryRow(ctx, `
+		UPDATE authz_jobs
+		SET heartbeat_at = NOW(), progress_done = $3, progress_total = $4
+		WHERE id = $1 AND worker = $2 AND status = 'running'
+		RETURNING cancel_requested`, id, worker, progress.Done, progress.Total).Scan(&cancelRequested)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Another worker took the job over, or it was pruned; either way
+		// this run should stop
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record job heartbeat: %w", err)
+	}
+	return cancelRequested, nil
+}
+
+func (s *PostgresStore) Finish(ctx context.Context, id uuid.UUID, worker, status, errMsg string, result *Result) error {
+	var data []byte
+	var contentType, filename *string
+	if result != nil {
+		data = result.Data
+		if data == nil {
+			data = []byte{}
+		}
+		contentType, filename = &result.ContentType, &result.Filename
+	}
+	_, err := s.pool.Exec(ctx, `
+		UPDATE authz_jobs
+		SET status = $3, error = NULLIF($4, ''), result = $5, result_type = $6, result_filename = $7,
+			finished_at = NOW(), heartbeat_at = NOW(),
+			progress_done = CASE WHEN $3 = 'succeeded' AND progress_total > 0 THEN progress_total ELSE progress_done END
+		WHERE id = $1 AND worker = $2 AND status = 'running'`,
+		id, worker, status, errMsg, data, contentType, filename)
+	if err != nil {
+		return fmt.Errorf("failed to finish job: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Release(ctx context.Context, id uuid.UUID, worker string) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE authz_jobs
+		SET status = CASE WHEN cancel_requested THEN 'canceled' ELSE 'queued' END,
+			worker = NULL, heartbeat_at = NULL,
+			finished_at = CASE WHEN cancel_requested THEN NOW() END
+		WHERE id = $1 AND worker = $2 AND status = 'running'`, id, worker)
+	if err != nil {
+		return fmt.Errorf("failed to release job: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) RequestCancel(ctx context.Context, id uuid.UUID) (*Job, error) {
+	job, err := scanJob(s.pool.QueryRow(ctx, `
+		UPDATE authz_jobs
+		SET cancel_requested = TRUE,
+			status = CASE WHEN status = 'queued' THEN 'canceled' ELSE status END,
+			finished_at = CASE WHEN status = 'queued' THEN NOW() ELSE finished_at END
+		WHERE id = $1 AND status IN ('queued', 'running')
+		RETURNING `+jobColumns, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := s.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrFinished
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+	return job, nil
+}
+
+func (s *PostgresStore) Result(ctx context.Context, id uuid.UUID) (*Result, error) {
+	var status string
+	var data []byte
+	var contentType, filename *string
+	err := s.pool.QueryRow(ctx, `
+		SELECT status, result, result_type, result_filename FROM authz_jobs WHERE id = $1`, id).
+		Scan(&status, &data, &contentType, &filename)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job result: %w", err)
+	}
+	if status != StatusSucceeded || data == nil {
+		return nil, ErrNoResult
+	}
+	result := &Result{Data: data}
+	if contentType != nil {
+		result.ContentType = *contentType
+	}
+	if filename != nil {
+		result.Filename = *filename
+	}
+	return result, nil
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM authz_jobs WHERE finished_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
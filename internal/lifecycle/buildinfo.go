@@ -0,0 +1,111 @@
+// Package lifecycle gives every supra process the same operational
+// behavior: a startup banner naming the build, a /version endpoint, SIGHUP
+// handling and a shutdown that drains before it stops.
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Build details, set at link time, e.g.
+//
+//	go build -ldflags "-X github.com/dangerclosesec/supra/internal/lifecycle.Version=v1.4.0"
+//
+// Commit and BuildTime default to the VCS stamp go build records.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the running binary. DatabaseVersion is the latest
+// migration applied to the service's database and SchemaVersion the
+// permission model version; either is left out where it doesn't apply or
+// couldn't be read.
+type Info struct {
+	Service         string `json:"service"`
+	Version         string `json:"version"`
+	Commit          string `json:"commit,omitempty"`
+	Modified        bool   `json:"modified,omitempty"`
+	BuildTime       string `json:"build_time,omitempty"`
+	GoVersion       string `json:"go_version"`
+	DatabaseVersion int64  `json:"database_version,omitempty"`
+	SchemaVersion   int64  `json:"schema_version,omitempty"`
+}
+
+// Build returns the build details of service
+func Build(service string) Info {
+	info := Info{
+		Service:   service,
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// Banner logs that service is starting, with its build and attrs, the
+// settings worth seeing at a glance such as its listen address
+func Banner(logger *slog.Logger, service string, attrs ...any) {
+	info := Build(service)
+	attrs = append([]any{
+		"version", info.Version,
+		"commit", info.Commit,
+		"build_time", info.BuildTime,
+		"go_version", info.GoVersion,
+		"pid", os.Getpid(),
+	}, attrs...)
+	logger.Info("starting supra "+service, attrs...)
+}
+
+// VersionHandler serves Info as JSON. versions, if set, fills in the
+// database and schema versions; a failure is logged and leaves them out, so
+// the endpoint answers while the database is down.
+func VersionHandler(service string, versions func(ctx context.Context, info *Info) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		info := Build(service)
+		if versions != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+			if err := versions(ctx, &info); err != nil {
+				slog.Warn("reading versions for /version", "error", err)
+			}
+			cancel()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(info)
+	})
+}
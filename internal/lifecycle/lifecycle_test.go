@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionHandler(t *testing.T) {
+	defer func(v, c string) { Version, Commit = v, c }(Version, Commit)
+	Version, Commit = "v1.4.0", "abc123"
+
+	handler := VersionHandler("authz", func(ctx context.Context, info *Info) error {
+		info.DatabaseVersion = 21
+		info.SchemaVersion = 7
+		return nil
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var info Info
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, "authz", info.Service)
+	assert.Equal(t, "v1.4.0", info.Version)
+	assert.Equal(t, "abc123", info.Commit)
+	assert.Equal(t, int64(21), info.DatabaseVersion)
+	assert.Equal(t, int64(7), info.SchemaVersion)
+	assert.NotEmpty(t, info.GoVersion)
+
+	failing := VersionHandler("api", func(ctx context.Context, info *Info) error {
+		return errors.New("connection refused")
+	})
+	rec = httptest.NewRecorder()
+	failing.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "a database failure shouldn't fail /version")
+	assert.NotContains(t, rec.Body.String(), "database_version")
+}
+
+func TestDrainerShutdown(t *testing.T) {
+	var d Drainer
+	assert.False(t, d.Draining())
+
+	var drainingWhenStopped bool
+	var deadline time.Time
+	err := d.Shutdown(10*time.Millisecond, time.Minute, func(ctx context.Context) error {
+		drainingWhenStopped = d.Draining()
+		deadline, _ = ctx.Deadline()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, drainingWhenStopped)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+}
+
+func TestOnHangup(t *testing.T) {
+	// Keeps SIGHUP from killing the test before OnHangup is listening
+	guard := make(chan os.Signal, 16)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	called := make(chan struct{}, 1)
+	ready := make(chan struct{})
+	go func() {
+		close(ready)
+		OnHangup(ctx, func() {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+		})
+	}()
+	<-ready
+
+	// The handler may not be installed the instant the goroutine starts
+	deadline := time.After(5 * time.Second)
+	for {
+		require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+		select {
+		case <-called:
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("SIGHUP wasn't handled")
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Drainer records that a process has begun shutting down. Health checks
+// fail while it drains, so traffic moves elsewhere before it stops serving.
+// The zero value isn't draining.
+type Drainer struct {
+	draining atomic.Bool
+}
+
+// Draining reports whether shutdown has begun
+func (d *Drainer) Draining() bool {
+	return d != nil && d.draining.Load()
+}
+
+// Shutdown drains for delay while still serving, then gives stop timeout to
+// finish in-flight work
+func (d *Drainer) Shutdown(delay, timeout time.Duration, stop func(ctx context.Context) error) error {
+	d.draining.Store(true)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return stop(ctx)
+}
+
+// OnHangup calls fn each time the process gets SIGHUP, until ctx ends
+func OnHangup(ctx context.Context, fn func()) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			fn()
+		}
+	}
+}
@@ -33,14 +33,43 @@ import (
 	"strings"
 
 	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/go-chi/chi/v5"
 )
 
 type UserContextKey string
 
 var UserIDKey UserContextKey = "supra_user_id"
 
-// AuthMiddleware creates a middleware that validates JWT tokens
-func AuthMiddleware(tokenManager *auth.TokenManager) func(http.Handler) http.Handler {
+// ClaimsKey holds the validated token's claims
+var ClaimsKey UserContextKey = "supra_token_claims"
+
+// AuthOption configures AuthMiddleware
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	// orgParam is the URL parameter naming the organization org-scoped
+	// tokens are accepted for; empty refuses them
+	orgParam string
+}
+
+// AllowOrganizationTokens lets a route take org-scoped tokens as well as
+// user tokens, as long as the organization named by the URL parameter is
+// the token's audience. Routes check their permissions as usual.
+func AllowOrganizationTokens(orgParam string) AuthOption {
+	return func(o *authOptions) {
+		o.orgParam = orgParam
+	}
+}
+
+// AuthMiddleware creates a middleware that validates JWT tokens. Org-scoped
+// tokens from the token exchange are refused unless the route opts in with
+// AllowOrganizationTokens, so they can't stand in for the user's own token.
+func AuthMiddleware(tokenManager *auth.TokenManager, opts ...AuthOption) func(http.Handler) http.Handler {
+	var options authOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract token from Authorization header
@@ -63,9 +92,20 @@ func AuthMiddleware(tokenManager *auth.TokenManager) func(http.Handler) http.Han
 				respondWithError(w, http.StatusUnauthorized, "Invalid token")
 				return
 			}
+			if org := claims.Organization(); org != "" {
+				if options.orgParam == "" {
+					respondWithError(w, http.StatusForbidden, "Organization-scoped tokens can't be used here")
+					return
+				}
+				if org != chi.URLParam(r, options.orgParam) {
+					respondWithError(w, http.StatusForbidden, "Token is scoped to another organization")
+					return
+				}
+			}
 
-			// Create new context with user ID
+			// Create new context with user ID and claims
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, ClaimsKey, claims)
 
 			// Call next handler with new context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -73,6 +113,12 @@ func AuthMiddleware(tokenManager *auth.TokenManager) func(http.Handler) http.Han
 	}
 }
 
+// Claims returns the claims of the token AuthMiddleware validated
+func Claims(ctx context.Context) (*auth.Claims, bool) {
+	claims, ok := ctx.Value(ClaimsKey).(*auth.Claims)
+	return claims, ok
+}
+
 // respondWithError sends a JSON error response
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
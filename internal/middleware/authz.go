@@ -0,0 +1,132 @@
+// internal/middleware/authz.go
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// PermissionChecker performs permission checks against the identity graph.
+// *auth.SupraService satisfies this interface.
+type PermissionChecker interface {
+	CheckPermission(ctx context.Context, subject auth.Subject, permission string, object auth.Entity, contextData map[string]interface{}) (bool, error)
+}
+
+// ObjectResolver extracts the object a request acts on, e.g. the organization
+// named in the URL
+type ObjectResolver func(r *http.Request) (auth.Entity, error)
+
+type decisionCacheKey struct{}
+
+// decisionCache memoizes permission decisions for the lifetime of one request so
+// that middleware and handlers asking the same question only hit supra once
+type decisionCache struct {
+	mu        sync.Mutex
+	decisions map[string]bool
+}
+
+// DecisionCacheMiddleware attaches an empty per-request decision cache
+func DecisionCacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cache := &decisionCache{decisions: make(map[string]bool)}
+		ctx := context.WithValue(r.Context(), decisionCacheKey{}, cache)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Authorize checks whether subject holds permission on object, consulting and
+// populating the request's decision cache when one is present
+func Authorize(ctx context.Context, checker PermissionChecker, subject auth.Subject, permission string, object auth.Entity) (bool, error) {
+	key := fmt.Sprintf("%s:%s#%s@%s:%s", object.Type, object.ID, permission, subject.Type, subject.ID)
+
+	cache, _ := ctx.Value(decisionCacheKey{}).(*decisionCache)
+	if cache != nil {
+		cache.mu.Lock()
+		allowed, ok := cache.decisions[key]
+		cache.mu.Unlock()
+		if ok {
+			return allowed, nil
+		}
+	}
+
+	allowed, err := checker.CheckPermission(ctx, subject, permission, object, nil)
+	if err != nil {
+		return false, err
+	}
+
+	if cache != nil {
+		cache.mu.Lock()
+		cache.decisions[key] = allowed
+		cache.mu.Unlock()
+	}
+
+	return allowed, nil
+}
+
+// RequirePermission rejects requests whose authenticated user does not hold
+// permission on the object returned by resolve. It must run after AuthMiddleware.
+func RequirePermission(checker PermissionChecker, permission string, resolve ObjectResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value(UserIDKey).(string)
+			if userID == "" {
+				respondWithError(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+
+			object, err := resolve(r)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			subject := auth.Subject{Type: "user", ID: userID}
+			allowed, err := Authorize(r.Context(), checker, subject, permission, object)
+			if err != nil {
+				slog.Error("permission check failed",
+					"permission", permission,
+					"object", object.Type+":"+object.ID,
+					"user_id", userID,
+					"error", err,
+				)
+				respondWithError(w, http.StatusServiceUnavailable, "Authorization service unavailable")
+				return
+			}
+
+			if !allowed {
+				respondWithError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// URLParamObject resolves the object from a chi URL parameter
+func URLParamObject(entityType, param string) ObjectResolver {
+	return func(r *http.Request) (auth.Entity, error) {
+		id := chi.URLParam(r, param)
+		if id == "" {
+			return auth.Entity{}, fmt.Errorf("missing %s", param)
+		}
+		return auth.Entity{Type: entityType, ID: id}, nil
+	}
+}
+
+// CurrentUserObject resolves the object to the authenticated user themselves,
+// for routes that manage the caller's own profile
+func CurrentUserObject(r *http.Request) (auth.Entity, error) {
+	userID, _ := r.Context().Value(UserIDKey).(string)
+	if userID == "" {
+		return auth.Entity{}, errors.New("missing user")
+	}
+	return auth.Entity{Type: "user", ID: userID}, nil
+}
@@ -0,0 +1,101 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeChecker struct {
+	allowed bool
+	calls   int
+}
+
+func (f *fakeChecker) CheckPermission(ctx context.Context, subject auth.Subject, permission string, object auth.Entity, contextData map[string]interface{}) (bool, error) {
+	f.calls++
+	return f.allowed, nil
+}
+
+func withUser(r *http.Request, userID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, userID))
+}
+
+func TestRequirePermission(t *testing.T) {
+	object := func(r *http.Request) (auth.Entity, error) {
+		return auth.Entity{Type: "organization", ID: "o1"}, nil
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	t.Run("allows and caches decisions per request", func(t *testing.T) {
+		checker := &fakeChecker{allowed: true}
+		guard := middleware.RequirePermission(checker, "manage_users", object)
+		handler := middleware.DecisionCacheMiddleware(guard(guard(ok)))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, withUser(httptest.NewRequest(http.MethodGet, "/", nil), "u1"))
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, 1, checker.calls)
+	})
+
+	t.Run("denies without the permission", func(t *testing.T) {
+		checker := &fakeChecker{allowed: false}
+		handler := middleware.RequirePermission(checker, "manage_users", object)(ok)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, withUser(httptest.NewRequest(http.MethodGet, "/", nil), "u1"))
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("requires an authenticated user", func(t *testing.T) {
+		checker := &fakeChecker{allowed: true}
+		handler := middleware.RequirePermission(checker, "manage_users", object)(ok)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, 0, checker.calls)
+	})
+}
+
+func TestAuthMiddlewareOrganizationTokens(t *testing.T) {
+	tokens := auth.NewTokenManager("0123456789abcdef0123456789abcdef", time.Hour)
+	noContent := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+	router := chi.NewRouter()
+	router.With(middleware.AuthMiddleware(tokens)).Get("/factors", noContent)
+	router.With(middleware.AuthMiddleware(tokens, middleware.AllowOrganizationTokens("orgID"))).
+		Get("/organizations/{orgID}", noContent)
+
+	serve := func(token, path string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	user, err := tokens.Generate("u1", "u1@example.com")
+	require.NoError(t, err)
+	scoped, _, err := tokens.GenerateForOrganization("u1", "u1@example.com", "o1", []string{"admin"}, time.Minute)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusNoContent, serve(user, "/factors"))
+	assert.Equal(t, http.StatusNoContent, serve(user, "/organizations/o1"), "user tokens aren't scoped")
+	assert.Equal(t, http.StatusForbidden, serve(scoped, "/factors"), "routes take org-scoped tokens only when they opt in")
+	assert.Equal(t, http.StatusNoContent, serve(scoped, "/organizations/o1"))
+	assert.Equal(t, http.StatusForbidden, serve(scoped, "/organizations/o2"))
+	assert.Equal(t, http.StatusUnauthorized, serve("", "/organizations/o1"))
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+)
+
+// IdempotencyKeyHeader names the header a client sets to make a request
+// safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on a response replayed for a retried
+// request instead of running it again
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength bounds the keys clients can choose
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyStore keeps the responses of idempotent requests until they
+// expire. *service.CacheService is one.
+type IdempotencyStore interface {
+	// Add stores value unless key is already stored, and reports whether
+	// it did
+	Add(ctx context.Context, key string, value interface{}) (bool, error)
+	Set(ctx context.Context, key string, value interface{}) error
+	Get(ctx context.Context, key string, result interface{}) error
+	Delete(ctx context.Context, key string) error
+}
+
+// idempotentResponse is what the store keeps for an Idempotency-Key: the
+// request it was first used with, and its response once there is one
+type idempotentResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Done        bool   `json:"done"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Idempotency makes requests carrying an Idempotency-Key header safe to
+// retry: the first request with a key runs, and its response is replayed
+// to any later request with the same key, query and body for as long as
+// store keeps it, so a client retrying a signup after a dropped connection
+// gets the user the first attempt created rather than a second attempt's
+// error. A retry while the first request is still running is answered
+// 409, and reusing a key for a different request 422. Only successes are
+// kept: a request turned away, say for an expired nonce checked after this
+// runs, or failed by a server error can be retried for real. Requests
+// without the header run as usual.
+func Idempotency(store IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				respondWithError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// Keys are scoped to the route, and remember the request's
+			// query and body to catch a key reused for a different request
+			storeKey := "idempotency:" + r.Method + " " + r.URL.Path + ":" + key
+			hash := sha256.New()
+			hash.Write([]byte(r.URL.RawQuery))
+			hash.Write([]byte{0})
+			hash.Write(body)
+			fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+			added, err := store.Add(r.Context(), storeKey, idempotentResponse{Fingerprint: fingerprint})
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if !added {
+				replayIdempotent(w, r, store, storeKey, fingerprint)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// Use a context that outlives a cancelled request, so the key
+			// isn't left pending
+			ctx := context.WithoutCancel(r.Context())
+			if rec.status >= http.StatusBadRequest {
+				store.Delete(ctx, storeKey)
+				return
+			}
+			store.Set(ctx, storeKey, idempotentResponse{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      rec.status,
+				ContentType: rec.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+			})
+		})
+	}
+}
+
+// replayIdempotent answers a request whose Idempotency-Key was already used
+func replayIdempotent(w http.ResponseWriter, r *http.Request, store IdempotencyStore, storeKey, fingerprint string) {
+	var stored idempotentResponse
+	if err := store.Get(r.Context(), storeKey, &stored); err != nil {
+		// The first request failed or expired since it was added
+		respondWithError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress, retry it")
+		return
+	}
+
+	switch {
+	case stored.Fingerprint != fingerprint:
+		respondWithError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+	case !stored.Done:
+		respondWithError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress, retry it")
+	default:
+		if stored.ContentType != "" {
+			w.Header().Set("Content-Type", stored.ContentType)
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,109 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/middleware"
+	"github.com/dangerclosesec/supra/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	store := service.NewCacheService(service.CacheConfig{TTL: time.Minute, CleanupFreq: time.Minute})
+	defer store.Close()
+
+	var calls atomic.Int32
+	status := http.StatusCreated
+	handler := middleware.Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"user":` + strconv.Itoa(int(n)) + `}`))
+	}))
+	postURL := func(target, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	post := func(key, body string) *httptest.ResponseRecorder {
+		return postURL("/api/auth/signup", key, body)
+	}
+
+	t.Run("replays the first response to retries", func(t *testing.T) {
+		first := post("signup-1", `{"email":"a@example.com"}`)
+		assert.Equal(t, http.StatusCreated, first.Code)
+		assert.Empty(t, first.Header().Get(middleware.IdempotentReplayedHeader))
+
+		retry := post("signup-1", `{"email":"a@example.com"}`)
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+		assert.Equal(t, "true", retry.Header().Get(middleware.IdempotentReplayedHeader))
+		assert.EqualValues(t, 1, calls.Load())
+	})
+
+	t.Run("rejects a key reused for another request", func(t *testing.T) {
+		rec := post("signup-1", `{"email":"b@example.com"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.EqualValues(t, 1, calls.Load())
+	})
+
+	t.Run("runs requests without a key", func(t *testing.T) {
+		post("", `{}`)
+		post("", `{}`)
+		assert.EqualValues(t, 3, calls.Load())
+	})
+
+	t.Run("lets server errors be retried", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		post("signup-2", `{}`)
+		status = http.StatusCreated
+		rec := post("signup-2", `{}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Empty(t, rec.Header().Get(middleware.IdempotentReplayedHeader))
+		assert.EqualValues(t, 5, calls.Load())
+	})
+
+	t.Run("lets rejected requests be retried", func(t *testing.T) {
+		status = http.StatusBadRequest
+		rec := postURL("/api/auth/signup?nonce=used", "signup-4", `{}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		status = http.StatusCreated
+		rec = postURL("/api/auth/signup?nonce=fresh", "signup-4", `{}`)
+		assert.Equal(t, http.StatusCreated, rec.Code, "a retry with a fresh nonce should run")
+		assert.Empty(t, rec.Header().Get(middleware.IdempotentReplayedHeader))
+
+		rec = postURL("/api/auth/signup?nonce=other", "signup-4", `{}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, "the query is part of the request")
+		assert.EqualValues(t, 7, calls.Load())
+	})
+
+	t.Run("rejects retries of a request in progress", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		slow := middleware.Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusCreated)
+		}))
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/signup", strings.NewReader(`{}`))
+			req.Header.Set(middleware.IdempotencyKeyHeader, "signup-3")
+			slow.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+		<-started
+		defer close(release)
+
+		rec := post("signup-3", `{}`)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
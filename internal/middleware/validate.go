@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Where a FieldError's field was read from
+const (
+	InBody  = "body"
+	InQuery = "query"
+)
+
+// FieldError is one invalid field of a request
+type FieldError struct {
+	// Field is the field's path, by JSON name for the body, as in
+	// "email" or "factors[0].code", or the query parameter's name
+	Field   string `json:"field"`
+	In      string `json:"in"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse is the 422 response to a request that fails
+// validation. It has the fields of the handlers' ErrorResponse.
+type ValidationErrorResponse struct {
+	Ok     bool         `json:"ok"`
+	Error  string       `json:"error"`
+	Code   string       `json:"error_code"`
+	Fields []FieldError `json:"fields"`
+}
+
+// nameTags are the struct tags naming fields, by where they are read from
+var nameTags = map[string]string{InBody: "json", InQuery: "query"}
+
+// validators check the validate struct tags of request schemas, naming
+// fields as nameTags do
+var validators = map[string]*validator.Validate{
+	InBody:  newValidator(nameTags[InBody]),
+	InQuery: newValidator(nameTags[InQuery]),
+}
+
+func newValidator(tag string) *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return fieldName(field, tag)
+	})
+	return v
+}
+
+type validatedBodyKey struct{ t reflect.Type }
+type validatedQueryKey struct{ t reflect.Type }
+
+// ValidateJSON decodes the request's JSON body into a T and checks it
+// against T's validate struct tags before the handler runs, which reads it
+// with Body. Requests whose body doesn't decode into a T, or fails a check,
+// are answered 422 with the path of each invalid field:
+//
+//	r.With(middleware.ValidateJSON[service.LoginInput]()).Post("/login", h.LoginHandler)
+func ValidateJSON[T any]() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body T
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				respondWithValidationErrors(w, []FieldError{decodeError(err)})
+				return
+			}
+
+			if fields := validationErrors(body, InBody); len(fields) > 0 {
+				respondWithValidationErrors(w, fields)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), validatedBodyKey{reflect.TypeFor[T]()}, body)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ValidateQuery fills a T's string fields from the query parameters named
+// by their query struct tags and checks it against T's validate struct
+// tags before the handler runs, which reads it with Query. Requests that
+// fail a check are answered 422 like ValidateJSON's.
+func ValidateQuery[T any]() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var query T
+			v := reflect.ValueOf(&query).Elem()
+			values := r.URL.Query()
+			for i := 0; i < v.NumField(); i++ {
+				field := v.Type().Field(i)
+				name := field.Tag.Get("query")
+				if name == "" || name == "-" || field.Type.Kind() != reflect.String {
+					continue
+				}
+				v.Field(i).SetString(values.Get(name))
+			}
+
+			if fields := validationErrors(query, InQuery); len(fields) > 0 {
+				respondWithValidationErrors(w, fields)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), validatedQueryKey{reflect.TypeFor[T]()}, query)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Body returns the body ValidateJSON[T] decoded and validated, and false
+// if the route doesn't validate a T
+func Body[T any](r *http.Request) (T, bool) {
+	body, ok := r.Context().Value(validatedBodyKey{reflect.TypeFor[T]()}).(T)
+	return body, ok
+}
+
+// Query returns the query parameters ValidateQuery[T] validated, and false
+// if the route doesn't validate a T
+func Query[T any](r *http.Request) (T, bool) {
+	query, ok := r.Context().Value(validatedQueryKey{reflect.TypeFor[T]()}).(T)
+	return query, ok
+}
+
+// decodeError describes why a body didn't decode, naming the field when it
+// has the wrong type
+func decodeError(err error) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return FieldError{Field: typeErr.Field, In: InBody, Message: "must be " + jsonKind(typeErr.Type)}
+	}
+	return FieldError{In: InBody, Message: "must be a JSON object"}
+}
+
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// validationErrors checks v against its validate struct tags
+func validationErrors(v interface{}, in string) []FieldError {
+	err := validators[in].Struct(v)
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return nil
+	}
+
+	fields := make([]FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		// The namespace starts with the struct's type name
+		path := fe.Namespace()
+		if i := strings.Index(path, "."); i >= 0 {
+			path = path[i+1:]
+		}
+		fields = append(fields, FieldError{Field: path, In: in, Message: message(fe, reflect.TypeOf(v), in)})
+	}
+	return fields
+}
+
+// message describes a failed check
+func message(fe validator.FieldError, t reflect.Type, in string) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a UUID"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "eqfield":
+		if field, ok := t.FieldByName(fe.Param()); ok {
+			return "must match " + fieldName(field, nameTags[in])
+		}
+		return "must match " + fe.Param()
+	case "min", "max", "len":
+		bound := map[string]string{"min": "at least", "max": "at most", "len": "exactly"}[fe.Tag()]
+		switch fe.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters long", bound, fe.Param())
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return fmt.Sprintf("must have %s %s items", bound, fe.Param())
+		default:
+			return fmt.Sprintf("must be %s %s", bound, fe.Param())
+		}
+	default:
+		if fe.Param() != "" {
+			return fmt.Sprintf("must satisfy %s=%s", fe.Tag(), fe.Param())
+		}
+		return "must satisfy " + fe.Tag()
+	}
+}
+
+// fieldName names a field as its json or query struct tag does, falling
+// back to its Go name
+func fieldName(field reflect.StructField, tag string) string {
+	name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, fields []FieldError) {
+	msg := "Invalid request"
+	if len(fields) == 1 && fields[0].Field != "" {
+		msg = "Invalid " + fields[0].Field + ": " + fields[0].Message
+	} else if len(fields) > 1 {
+		msg = "Invalid request: " + strconv.Itoa(len(fields)) + " fields failed validation"
+	}
+	respondWithJSON(w, http.StatusUnprocessableEntity, ValidationErrorResponse{
+		Error:  msg,
+		Code:   "validation_failed",
+		Fields: fields,
+	})
+}
@@ -0,0 +1,114 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type signup struct {
+	Email           string `json:"email" validate:"required,email"`
+	Password        string `json:"password" validate:"required,min=8"`
+	ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password"`
+	Age             int    `json:"age"`
+	Items           []item `json:"items" validate:"dive"`
+}
+
+type verifyQuery struct {
+	UserID string `json:"user_id" query:"user" validate:"required,uuid"`
+	Code   string `query:"code" validate:"required"`
+}
+
+func serve(t *testing.T, mw func(http.Handler) http.Handler, handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mw(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func validationResponse(t *testing.T, rec *httptest.ResponseRecorder) middleware.ValidationErrorResponse {
+	t.Helper()
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	var resp middleware.ValidationErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.False(t, resp.Ok)
+	assert.Equal(t, "validation_failed", resp.Code)
+	return resp
+}
+
+func TestValidateJSON(t *testing.T) {
+	var got signup
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		got, ok = middleware.Body[signup](r)
+		assert.True(t, ok)
+		_, ok = middleware.Body[item](r)
+		assert.False(t, ok)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	post := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	}
+
+	t.Run("passes the decoded body on", func(t *testing.T) {
+		rec := serve(t, middleware.ValidateJSON[signup](), handler,
+			post(`{"email":"a@example.com","password":"secret123","confirm_password":"secret123"}`))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "a@example.com", got.Email)
+	})
+
+	t.Run("reports every invalid field by path", func(t *testing.T) {
+		rec := serve(t, middleware.ValidateJSON[signup](), handler,
+			post(`{"email":"nope","password":"short","confirm_password":"other","items":[{"code":"x"},{}]}`))
+		resp := validationResponse(t, rec)
+		assert.Equal(t, []middleware.FieldError{
+			{Field: "email", In: "body", Message: "must be a valid email address"},
+			{Field: "password", In: "body", Message: "must be at least 8 characters long"},
+			{Field: "confirm_password", In: "body", Message: "must match password"},
+			{Field: "items[1].code", In: "body", Message: "is required"},
+		}, resp.Fields)
+		assert.Equal(t, "Invalid request: 4 fields failed validation", resp.Error)
+	})
+
+	t.Run("names fields of the wrong type", func(t *testing.T) {
+		resp := validationResponse(t, serve(t, middleware.ValidateJSON[signup](), handler, post(`{"age":"ten"}`)))
+		assert.Equal(t, []middleware.FieldError{{Field: "age", In: "body", Message: "must be an integer"}}, resp.Fields)
+		assert.Equal(t, "Invalid age: must be an integer", resp.Error)
+	})
+
+	t.Run("rejects malformed bodies", func(t *testing.T) {
+		resp := validationResponse(t, serve(t, middleware.ValidateJSON[signup](), handler, post(`{`)))
+		assert.Equal(t, []middleware.FieldError{{In: "body", Message: "must be a JSON object"}}, resp.Fields)
+	})
+}
+
+func TestValidateQuery(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		query, ok := middleware.Query[verifyQuery](r)
+		require.True(t, ok)
+		w.Write([]byte(query.UserID + " " + query.Code))
+	}
+
+	rec := serve(t, middleware.ValidateQuery[verifyQuery](), handler,
+		httptest.NewRequest(http.MethodGet, "/?user=3b241101-e2bb-4255-8caf-4136c566a962&code=123", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3b241101-e2bb-4255-8caf-4136c566a962 123", rec.Body.String())
+
+	rec = serve(t, middleware.ValidateQuery[verifyQuery](), handler,
+		httptest.NewRequest(http.MethodGet, "/?user=42", nil))
+	resp := validationResponse(t, rec)
+	assert.Equal(t, []middleware.FieldError{
+		{Field: "user", In: "query", Message: "must be a UUID"},
+		{Field: "code", In: "query", Message: "is required"},
+	}, resp.Fields)
+}
@@ -0,0 +1,137 @@
+// internal/migrate/migrate.go
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+
+	"github.com/dangerclosesec/supra/db/migrations"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+)
+
+// Target identifies one of the supra databases
+type Target string
+
+const (
+	// TargetAPI is the application database used by the API and reconciler
+	TargetAPI Target = "api"
+	// TargetAuthz is the identity graph database used by the authz service
+	TargetAuthz Target = "authz"
+)
+
+// Targets lists every migration target in the order they should be applied
+var Targets = []Target{TargetAPI, TargetAuthz}
+
+// ParseTarget validates a target name given on the command line
+func ParseTarget(name string) (Target, error) {
+	for _, t := range Targets {
+		if string(t) == name {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown migration target %q (expected api or authz)", name)
+}
+
+// versionTable returns the table recording applied versions. The API keeps
+// goose's default so databases migrated with the goose CLI carry over; the
+// authz history lives in its own table in case both share one database.
+func (t Target) versionTable() string {
+	if t == TargetAuthz {
+		return "goose_authz_db_version"
+	}
+	return goose.DefaultTablename
+}
+
+func (t Target) files() fs.FS {
+	if t == TargetAuthz {
+		return migrations.Authz()
+	}
+	return migrations.API()
+}
+
+// Migrator applies the embedded migrations for one target
+type Migrator struct {
+	target   Target
+	provider *goose.Provider
+}
+
+// New creates a migrator for target on db, which must be a PostgreSQL
+// connection
+func New(db *sql.DB, target Target) (*Migrator, error) {
+	store, err := database.NewStore(database.DialectPostgres, target.versionTable())
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := goose.NewProvider("", db, target.files(), goose.WithStore(store))
+	if err != nil {
+		return nil, fmt.Errorf("loading %s migrations: %w", target, err)
+	}
+
+	return &Migrator{target: target, provider: provider}, nil
+}
+
+// Target returns the database this migrator manages
+func (m *Migrator) Target() Target {
+	return m.target
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	results, err := m.provider.Up(ctx)
+	if err != nil {
+		return results, fmt.Errorf("migrating %s up: %w", m.target, err)
+	}
+	return results, nil
+}
+
+// Down rolls back the most recently applied migration
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	result, err := m.provider.Down(ctx)
+	if err != nil {
+		return result, fmt.Errorf("migrating %s down: %w", m.target, err)
+	}
+	return result, nil
+}
+
+// DownTo rolls back every migration newer than version
+func (m *Migrator) DownTo(ctx context.Context, version int64) ([]*goose.MigrationResult, error) {
+	results, err := m.provider.DownTo(ctx, version)
+	if err != nil {
+		return results, fmt.Errorf("migrating %s down to %d: %w", m.target, version, err)
+	}
+	return results, nil
+}
+
+// Status reports every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	return m.provider.Status(ctx)
+}
+
+// Version returns the latest applied migration version, or zero when none
+// has been applied
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	version, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("getting %s migration version: %w", m.target, err)
+	}
+	return version, nil
+}
+
+// CurrentVersion returns the latest migration applied to target on db, for
+// services reporting what they run against
+func CurrentVersion(ctx context.Context, db *sql.DB, target Target) (int64, error) {
+	m, err := New(db, target)
+	if err != nil {
+		return 0, err
+	}
+	return m.Version(ctx)
+}
+
+// HasPending reports whether any migration has not been applied yet
+func (m *Migrator) HasPending(ctx context.Context) (bool, error) {
+	return m.provider.HasPending(ctx)
+}
@@ -0,0 +1,35 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/migrate"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	// Opening does not connect, which is enough to load and parse sources
+	db, err := sql.Open("pgx", "postgres://localhost:1/unused")
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, target := range migrate.Targets {
+		t.Run(string(target), func(t *testing.T) {
+			m, err := migrate.New(db, target)
+			require.NoError(t, err)
+			assert.Equal(t, target, m.Target())
+		})
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	target, err := migrate.ParseTarget("authz")
+	require.NoError(t, err)
+	assert.Equal(t, migrate.TargetAuthz, target)
+
+	_, err = migrate.ParseTarget("mysql")
+	assert.Error(t, err)
+}
@@ -197,6 +197,45 @@ func (c *MockUserRepositoryIfaceFindAllCall) DoAndReturn(f func(context.Context)
 	return c
 }
 
+// FindAfterID mocks base method.
+func (m *MockUserRepositoryIface) FindAfterID(ctx context.Context, afterID uuid.UUID, limit int) ([]*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindAfterID", ctx, afterID, limit)
+	ret0, _ := ret[0].([]*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindAfterID indicates an expected call of FindAfterID.
+func (mr *MockUserRepositoryIfaceMockRecorder) FindAfterID(ctx, afterID, limit any) *MockUserRepositoryIfaceFindAfterIDCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindAfterID", reflect.TypeOf((*MockUserRepositoryIface)(nil).FindAfterID), ctx, afterID, limit)
+	return &MockUserRepositoryIfaceFindAfterIDCall{Call: call}
+}
+
+// MockUserRepositoryIfaceFindAfterIDCall wrap *gomock.Call
+type MockUserRepositoryIfaceFindAfterIDCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockUserRepositoryIfaceFindAfterIDCall) Return(arg0 []*model.User, arg1 error) *MockUserRepositoryIfaceFindAfterIDCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockUserRepositoryIfaceFindAfterIDCall) Do(f func(context.Context, uuid.UUID, int) ([]*model.User, error)) *MockUserRepositoryIfaceFindAfterIDCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockUserRepositoryIfaceFindAfterIDCall) DoAndReturn(f func(context.Context, uuid.UUID, int) ([]*model.User, error)) *MockUserRepositoryIfaceFindAfterIDCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // FindAllPaginated mocks base method.
 func (m *MockUserRepositoryIface) FindAllPaginated(ctx context.Context, offset, limit int) ([]*model.User, int64, error) {
 	m.ctrl.T.Helper()
@@ -315,6 +354,45 @@ func (c *MockUserRepositoryIfaceFindByIDCall) DoAndReturn(f func(context.Context
 	return c
 }
 
+// FindPage mocks base method.
+func (m *MockUserRepositoryIface) FindPage(ctx context.Context, filter repository.EntityFilter, afterID uuid.UUID, limit int) ([]*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindPage", ctx, filter, afterID, limit)
+	ret0, _ := ret[0].([]*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPage indicates an expected call of FindPage.
+func (mr *MockUserRepositoryIfaceMockRecorder) FindPage(ctx, filter, afterID, limit any) *MockUserRepositoryIfaceFindPageCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPage", reflect.TypeOf((*MockUserRepositoryIface)(nil).FindPage), ctx, filter, afterID, limit)
+	return &MockUserRepositoryIfaceFindPageCall{Call: call}
+}
+
+// MockUserRepositoryIfaceFindPageCall wrap *gomock.Call
+type MockUserRepositoryIfaceFindPageCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockUserRepositoryIfaceFindPageCall) Return(arg0 []*model.User, arg1 error) *MockUserRepositoryIfaceFindPageCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockUserRepositoryIfaceFindPageCall) Do(f func(context.Context, repository.EntityFilter, uuid.UUID, int) ([]*model.User, error)) *MockUserRepositoryIfaceFindPageCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockUserRepositoryIfaceFindPageCall) DoAndReturn(f func(context.Context, repository.EntityFilter, uuid.UUID, int) ([]*model.User, error)) *MockUserRepositoryIfaceFindPageCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // Update mocks base method.
 func (m *MockUserRepositoryIface) Update(ctx context.Context, user *model.User) error {
 	m.ctrl.T.Helper()
@@ -69,6 +69,7 @@ func (m *JSONMap) Scan(value interface{}) error {
 const (
 	ActionPermissionCheck = "permission_check"
 	ActionEntityCreate    = "entity_create"
+	ActionEntityUpdate    = "entity_update"
 	ActionEntityDelete    = "entity_delete"
 	ActionRelationCreate  = "relation_create"
 	ActionRelationDelete  = "relation_delete"
@@ -0,0 +1,24 @@
+// internal/model/reconciliation.go
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReconciliationCheckpoint records how far a reconciliation run has progressed
+// for a single entity type, so an interrupted run can resume where it stopped.
+type ReconciliationCheckpoint struct {
+	EntityType string    `gorm:"type:text;primary_key" json:"entity_type"`
+	LastID     uuid.UUID `gorm:"type:uuid;not null" json:"last_id"`
+	Processed  int64     `gorm:"not null;default:0" json:"processed"`
+	Failed     int64     `gorm:"not null;default:0" json:"failed"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for ReconciliationCheckpoint
+func (ReconciliationCheckpoint) TableName() string {
+	return "reconciliation_checkpoints"
+}
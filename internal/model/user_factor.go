@@ -33,6 +33,10 @@ type UserFactor struct {
 	IsActive                bool       `gorm:"default:true"`
 	VerifiedAt              *time.Time
 	LastUsedAt              *time.Time
+	// ExpiresAt ends a verification factor's use; FailedAttempts counts
+	// the invalid tries at it since it was issued
+	ExpiresAt               *time.Time
+	FailedAttempts          int `gorm:"not null;default:0"`
 	FederatedAuthProvider   string `gorm:"type:text"`
 	FederatedAuthExternalID string `gorm:"type:text"`
 	CreatedAt               time.Time
@@ -0,0 +1,220 @@
+// Package notify reports, as they happen, checks that allowed a permission
+// the schema marks @sensitive, such as break-glass or admin access, so
+// security tooling can react in real time. Events go to a webhook and to a
+// JSON lines log a SIEM agent ships. Unlike the audit log, which records
+// the same checks durably, delivery is best effort: events are retried a
+// few times and then dropped.
+package notify
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventSensitiveAllowed is the type of an event sent when a check allows
+// a sensitive permission
+const EventSensitiveAllowed = "sensitive_permission.allowed"
+
+// Event is one allowed check of a sensitive permission, with everything
+// known about who made it
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Label is the @sensitive annotation's message, e.g. "break-glass"
+	Label       string `json:"label,omitempty"`
+	SubjectType string `json:"subject_type"`
+	SubjectID   string `json:"subject_id"`
+	Permission  string `json:"permission"`
+	ObjectType  string `json:"object_type"`
+	ObjectID    string `json:"object_id"`
+	Reason      string `json:"reason,omitempty"`
+	// Context is the check's context as the audit log stores it, with
+	// the configured keys redacted or hashed
+	Context       map[string]interface{} `json:"context,omitempty"`
+	SchemaVersion int                    `json:"schema_version,omitempty"`
+	Tenant        string                 `json:"tenant,omitempty"`
+	RequestID     string                 `json:"request_id,omitempty"`
+	ClientIP      string                 `json:"client_ip,omitempty"`
+	UserAgent     string                 `json:"user_agent,omitempty"`
+	// APIKey names the API key the caller authenticated with
+	APIKey string `json:"api_key,omitempty"`
+}
+
+// Sink delivers events
+type Sink interface {
+	Send(ctx context.Context, e Event) error
+}
+
+// Options tune delivery
+type Options struct {
+	// QueueSize bounds the events waiting to be delivered
+	QueueSize int
+	// Workers is how many events are delivered at once
+	Workers int
+	// Attempts is how many times each sink is tried before an event is
+	// given up on
+	Attempts int
+}
+
+// DefaultOptions returns the options used for fields left zero
+func DefaultOptions() Options {
+	return Options{
+		QueueSize: 1000,
+		Workers:   4,
+		Attempts:  3,
+	}
+}
+
+// Stats counts deliveries since the Notifier started. Sent and Failed count
+// each sink separately; Dropped counts events that were never queued.
+type Stats struct {
+	Sent    uint64 `json:"sent"`
+	Failed  uint64 `json:"failed"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// Notifier queues events and delivers them to its sinks in the background.
+// A nil Notifier sends nothing.
+type Notifier struct {
+	sinks []Sink
+	opts  Options
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Event
+	wg     sync.WaitGroup
+
+	sent    atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// New starts a notifier delivering to sinks
+func New(sinks []Sink, opts Options) *Notifier {
+	defaults := DefaultOptions()
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaults.QueueSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaults.Workers
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = defaults.Attempts
+	}
+
+	n := &Notifier{
+		sinks: sinks,
+		opts:  opts,
+		queue: make(chan Event, opts.QueueSize),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		n.wg.Add(1)
+		go n.run()
+	}
+	return n
+}
+
+// Notify queues e without blocking, filling in its ID, type and time when
+// they are empty. Events that arrive while the queue is full are dropped
+// and counted.
+func (n *Notifier) Notify(e Event) {
+	if n == nil {
+		return
+	}
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if e.Type == "" {
+		e.Type = EventSensitiveAllowed
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.queue <- e:
+	default:
+		n.dropped.Add(1)
+		log.Printf("Dropping sensitive permission event %s: the queue is full", e.ID)
+	}
+}
+
+// Stats returns the deliveries so far
+func (n *Notifier) Stats() Stats {
+	if n == nil {
+		return Stats{}
+	}
+	return Stats{Sent: n.sent.Load(), Failed: n.failed.Load(), Dropped: n.dropped.Load()}
+}
+
+// Close stops accepting events and waits for queued ones to be delivered,
+// or for ctx to expire, then closes sinks that hold a file
+func (n *Notifier) Close(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, sink := range n.sinks {
+		if c, ok := sink.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	return nil
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for e := range n.queue {
+		for _, sink := range n.sinks {
+			n.deliver(sink, e)
+		}
+	}
+}
+
+// deliver sends e to sink, retrying briefly before giving it up
+func (n *Notifier) deliver(sink Sink, e Event) {
+	backoff := 250 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= n.opts.Attempts; attempt++ {
+		err = sink.Send(context.Background(), e)
+		if err == nil {
+			n.sent.Add(1)
+			return
+		}
+		if attempt < n.opts.Attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	n.failed.Add(1)
+	log.Printf("Failed to deliver sensitive permission event %s after %d attempts: %v", e.ID, n.opts.Attempts, err)
+}
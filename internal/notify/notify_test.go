@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memorySink struct {
+	mu     sync.Mutex
+	events []Event
+	fails  int
+}
+
+func (m *memorySink) Send(_ context.Context, e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fails > 0 {
+		m.fails--
+		return errors.New("unavailable")
+	}
+	m.events = append(m.events, e)
+	return nil
+}
+
+func TestNotifierDelivers(t *testing.T) {
+	sink := &memorySink{fails: 1}
+	n := New([]Sink{sink}, Options{Workers: 1})
+
+	n.Notify(Event{SubjectType: "user", SubjectID: "alice", Permission: "break_glass", ObjectType: "account", ObjectID: "1"})
+	require.NoError(t, n.Close(context.Background()))
+
+	require.Len(t, sink.events, 1, "a failed delivery should be retried")
+	e := sink.events[0]
+	assert.NotEmpty(t, e.ID)
+	assert.Equal(t, EventSensitiveAllowed, e.Type)
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, Stats{Sent: 1}, n.Stats())
+
+	n.Notify(Event{SubjectID: "late"})
+	assert.Len(t, sink.events, 1, "events after Close are ignored")
+
+	var none *Notifier
+	none.Notify(Event{})
+	assert.NoError(t, none.Close(context.Background()))
+}
+
+func TestNotifierGivesUp(t *testing.T) {
+	sink := &memorySink{fails: 5}
+	n := New([]Sink{sink}, Options{Workers: 1, Attempts: 1})
+	n.Notify(Event{SubjectID: "alice"})
+	require.NoError(t, n.Close(context.Background()))
+	assert.Empty(t, sink.events)
+	assert.Equal(t, Stats{Failed: 1}, n.Stats())
+}
+
+func TestWebhook(t *testing.T) {
+	var got Event
+	var headers http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhook(server.URL, func() string { return "whsec" }, 0)
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.Background(), Event{ID: "evt-1", Type: EventSensitiveAllowed, Label: "break-glass", SubjectID: "alice"}))
+
+	assert.Equal(t, "evt-1", got.ID)
+	assert.Equal(t, "break-glass", got.Label)
+	assert.Equal(t, "evt-1", headers.Get(DeliveryHeader))
+	assert.Equal(t, EventSensitiveAllowed, headers.Get(EventHeader))
+	assert.True(t, Verify("whsec", headers.Get(TimestampHeader), headers.Get(SignatureHeader), body))
+	assert.False(t, Verify("other", headers.Get(TimestampHeader), headers.Get(SignatureHeader), body))
+
+	unsigned, err := NewWebhook(server.URL, nil, 0)
+	require.NoError(t, err)
+	require.NoError(t, unsigned.Send(context.Background(), Event{ID: "evt-2"}))
+	assert.Empty(t, headers.Get(SignatureHeader))
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	sink, err = NewWebhook(failing.URL, nil, 0)
+	require.NoError(t, err)
+	assert.ErrorContains(t, sink.Send(context.Background(), Event{}), "down for maintenance")
+
+	_, err = NewWebhook("siem.internal/hook", nil, 0)
+	assert.Error(t, err)
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sensitive.log")
+	sink, err := NewLog(path)
+	require.NoError(t, err)
+
+	n := New([]Sink{sink}, Options{Workers: 1})
+	n.Notify(Event{ID: "evt-1", SubjectID: "alice"})
+	n.Notify(Event{ID: "evt-2", SubjectID: "bob"})
+	require.NoError(t, n.Close(context.Background()))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		ids = append(ids, e.ID)
+	}
+	assert.Equal(t, []string{"evt-1", "evt-2"}, ids)
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers sent with each webhook delivery
+const (
+	// EventHeader is the event's type
+	EventHeader = "X-Supra-Event"
+	// DeliveryHeader is the event's ID, the same across retries
+	DeliveryHeader = "X-Supra-Delivery"
+	// TimestampHeader is when the delivery was signed, in Unix seconds
+	TimestampHeader = "X-Supra-Timestamp"
+	// SignatureHeader is "sha256=" and the hex HMAC-SHA256 of the
+	// timestamp, a dot and the body, keyed with the webhook secret
+	SignatureHeader = "X-Supra-Signature"
+)
+
+// Sign returns the signature of a delivery made at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of a delivery made at
+// timestamp, for receivers written in Go. Receivers should also reject
+// timestamps too far in the past to stop replays.
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// webhook posts each event as JSON to a URL
+type webhook struct {
+	client *http.Client
+	url    string
+	secret func() string
+}
+
+// NewWebhook returns a sink posting events to rawURL. secret, when it
+// returns a value, signs each delivery; it is called per delivery so a
+// rotated secret takes effect at once.
+func NewWebhook(rawURL string, secret func() string, timeout time.Duration) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook URL %q must be an absolute http(s) URL", rawURL)
+	}
+	if secret == nil {
+		secret = func() string { return "" }
+	}
+	return &webhook{client: &http.Client{Timeout: timeout}, url: rawURL, secret: secret}, nil
+}
+
+func (w *webhook) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, e.Type)
+	req.Header.Set(DeliveryHeader, e.ID)
+	if secret := w.secret(); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", w.url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// logFile appends each event as a line of JSON
+type logFile struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+// NewLog returns a sink appending events as JSON lines to the file at
+// path, for a SIEM agent to ship; "-" writes them to stdout
+func NewLog(path string) (Sink, error) {
+	if path == "-" {
+		return &logFile{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sensitive permission log: %w", err)
+	}
+	return &logFile{w: f, file: f}, nil
+}
+
+func (l *logFile) Send(_ context.Context, e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the log's file, unless it is stdout
+func (l *logFile) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
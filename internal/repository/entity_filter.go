@@ -0,0 +1,42 @@
+// internal/repository/entity_filter.go
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EntityFilter narrows the entities returned by a keyset page walk, such as
+// the ones reconciliation makes. Zero fields don't filter.
+type EntityFilter struct {
+	// UpdatedSince keeps entities updated at or after it
+	UpdatedSince time.Time
+	// OrganizationID keeps the organization itself, or the users who are
+	// members of it
+	OrganizationID uuid.UUID
+	// MinID and MaxID bound entity IDs, inclusive
+	MinID uuid.UUID
+	MaxID uuid.UUID
+}
+
+// IsZero reports whether the filter keeps every entity
+func (f EntityFilter) IsZero() bool {
+	return f == EntityFilter{}
+}
+
+// scope applies the filter's update time and ID bounds to a query on a
+// table with id and updated_at columns
+func (f EntityFilter) scope(db *gorm.DB) *gorm.DB {
+	if !f.UpdatedSince.IsZero() {
+		db = db.Where("updated_at >= ?", f.UpdatedSince)
+	}
+	if f.MinID != uuid.Nil {
+		db = db.Where("id >= ?", f.MinID)
+	}
+	if f.MaxID != uuid.Nil {
+		db = db.Where("id <= ?", f.MaxID)
+	}
+	return db
+}
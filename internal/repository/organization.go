@@ -49,6 +49,31 @@ func (r *OrganizationRepository) FindAllPaginated(ctx context.Context, offset, l
 	return orgs, count, nil
 }
 
+// FindAfterID returns up to limit organizations ordered by ID whose ID is greater than afterID.
+// Passing uuid.Nil starts from the beginning.
+func (r *OrganizationRepository) FindAfterID(ctx context.Context, afterID uuid.UUID, limit int) ([]*model.Organization, error) {
+	var orgs []*model.Organization
+	result := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&orgs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find organizations after cursor: %w", result.Error)
+	}
+	return orgs, nil
+}
+
+// FindPage is FindAfterID keeping only the organizations matching filter
+func (r *OrganizationRepository) FindPage(ctx context.Context, filter EntityFilter, afterID uuid.UUID, limit int) ([]*model.Organization, error) {
+	var orgs []*model.Organization
+	query := filter.scope(r.db.WithContext(ctx).Where("id > ?", afterID))
+	if filter.OrganizationID != uuid.Nil {
+		query = query.Where("id = ?", filter.OrganizationID)
+	}
+	result := query.Order("id ASC").Limit(limit).Find(&orgs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find organizations after cursor: %w", result.Error)
+	}
+	return orgs, nil
+}
+
 // FindOrganizationUsers returns all users belonging to the given organization
 func (r *OrganizationRepository) FindOrganizationUsers(ctx context.Context, orgID uuid.UUID) ([]*model.OrganizationUser, error) {
 	var orgUsers []*model.OrganizationUser
@@ -0,0 +1,60 @@
+// internal/repository/reconciliation_checkpoint.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReconciliationCheckpointRepository persists reconciliation progress
+type ReconciliationCheckpointRepository struct {
+	db *gorm.DB
+}
+
+// NewReconciliationCheckpointRepository creates a new ReconciliationCheckpointRepository
+func NewReconciliationCheckpointRepository(db *gorm.DB) *ReconciliationCheckpointRepository {
+	return &ReconciliationCheckpointRepository{db: db}
+}
+
+// Get returns the checkpoint for an entity type, or nil if none has been saved
+func (r *ReconciliationCheckpointRepository) Get(ctx context.Context, entityType string) (*model.ReconciliationCheckpoint, error) {
+	var checkpoint model.ReconciliationCheckpoint
+	if err := r.db.WithContext(ctx).First(&checkpoint, "entity_type = ?", entityType).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("finding reconciliation checkpoint: %w", err)
+	}
+	return &checkpoint, nil
+}
+
+// Save inserts or updates the checkpoint for its entity type
+func (r *ReconciliationCheckpointRepository) Save(ctx context.Context, checkpoint *model.ReconciliationCheckpoint) error {
+	checkpoint.UpdatedAt = time.Now().UTC()
+	if checkpoint.StartedAt.IsZero() {
+		checkpoint.StartedAt = checkpoint.UpdatedAt
+	}
+
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entity_type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_id", "processed", "failed", "updated_at"}),
+	}).Create(checkpoint).Error
+	if err != nil {
+		return fmt.Errorf("saving reconciliation checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Clear removes the checkpoint for an entity type
+func (r *ReconciliationCheckpointRepository) Clear(ctx context.Context, entityType string) error {
+	if err := r.db.WithContext(ctx).Delete(&model.ReconciliationCheckpoint{}, "entity_type = ?", entityType).Error; err != nil {
+		return fmt.Errorf("clearing reconciliation checkpoint: %w", err)
+	}
+	return nil
+}
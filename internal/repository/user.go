@@ -19,8 +19,10 @@ type UserRepositoryIface interface {
 	FindByID(ctx context.Context, id uuid.UUID) (*model.User, error)
 	Update(ctx context.Context, user *model.User) error
 	Delete(ctx context.Context, id uuid.UUID) error
-	FindAll(ctx context.Context) ([]*model.User, error)                                    // Get all users
-	FindAllPaginated(ctx context.Context, offset, limit int) ([]*model.User, int64, error) // Get users with pagination
+	FindAll(ctx context.Context) ([]*model.User, error)                                                     // Get all users
+	FindAllPaginated(ctx context.Context, offset, limit int) ([]*model.User, int64, error)                  // Get users with pagination
+	FindAfterID(ctx context.Context, afterID uuid.UUID, limit int) ([]*model.User, error)                   // Get users ordered by ID, after a cursor
+	FindPage(ctx context.Context, filter EntityFilter, afterID uuid.UUID, limit int) ([]*model.User, error) // FindAfterID, keeping only users matching filter
 }
 
 type UserRepository struct {
@@ -135,3 +137,30 @@ func (r *UserRepository) FindAllPaginated(ctx context.Context, offset, limit int
 
 	return users, count, nil
 }
+
+// FindAfterID returns up to limit users ordered by ID whose ID is greater than afterID.
+// Passing uuid.Nil starts from the beginning.
+func (r *UserRepository) FindAfterID(ctx context.Context, afterID uuid.UUID, limit int) ([]*model.User, error) {
+	var users []*model.User
+	result := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find users after cursor: %w", result.Error)
+	}
+	return users, nil
+}
+
+// FindPage is FindAfterID keeping only the users matching filter. A user
+// matches an organization filter by being a member of the organization.
+func (r *UserRepository) FindPage(ctx context.Context, filter EntityFilter, afterID uuid.UUID, limit int) ([]*model.User, error) {
+	var users []*model.User
+	query := filter.scope(r.db.WithContext(ctx).Where("id > ?", afterID))
+	if filter.OrganizationID != uuid.Nil {
+		query = query.Where("id IN (?)", r.db.Model(&model.OrganizationUser{}).
+			Select("user_id").Where("organization_id = ?", filter.OrganizationID))
+	}
+	result := query.Order("id ASC").Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find users after cursor: %w", result.Error)
+	}
+	return users, nil
+}
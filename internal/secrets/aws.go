@@ -0,0 +1,128 @@
+// internal/secrets/aws.go
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+const (
+	// SchemeAWSSecretsManager addresses secrets in AWS Secrets Manager by name
+	// or ARN
+	SchemeAWSSecretsManager = "awssm"
+	// SchemeKMSFile addresses a local file holding a KMS-encrypted secret,
+	// either raw ciphertext or base64 encoded
+	SchemeKMSFile = "kmsfile"
+)
+
+// SecretsManagerAPI is the subset of the Secrets Manager client used here
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// KMSAPI is the subset of the KMS client used here
+type KMSAPI interface {
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// AWSSecretsManagerProvider reads secrets from AWS Secrets Manager
+type AWSSecretsManagerProvider struct {
+	client SecretsManagerAPI
+}
+
+// NewAWSSecretsManagerProvider wraps a Secrets Manager client
+func NewAWSSecretsManagerProvider(client SecretsManagerAPI) *AWSSecretsManagerProvider {
+	return &AWSSecretsManagerProvider{client: client}
+}
+
+// Fetch returns the secret string, or ref.Key from it when the secret holds a
+// JSON object
+func (p *AWSSecretsManagerProvider) Fetch(ctx context.Context, ref Reference) (string, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(ref.Path),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	switch {
+	case out.SecretString != nil:
+		value = *out.SecretString
+	case out.SecretBinary != nil:
+		value = string(out.SecretBinary)
+	default:
+		return "", fmt.Errorf("secret %s has no value", ref.Path)
+	}
+
+	if ref.Key == "" {
+		return value, nil
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, cannot select key %q", ref.Path, ref.Key)
+	}
+	return lookupKey(data, ref)
+}
+
+// KMSFileProvider decrypts KMS ciphertext stored in local files, e.g. secrets
+// baked into an image or mounted from a config map
+type KMSFileProvider struct {
+	client KMSAPI
+}
+
+// NewKMSFileProvider wraps a KMS client
+func NewKMSFileProvider(client KMSAPI) *KMSFileProvider {
+	return &KMSFileProvider{client: client}
+}
+
+// Fetch reads and decrypts the file at ref.Path. The file is re-read on every
+// refresh so replacing it rotates the secret.
+func (p *KMSFileProvider) Fetch(ctx context.Context, ref Reference) (string, error) {
+	data, err := os.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext := data
+	trimmed := bytes.TrimSpace(data)
+	if decoded, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil {
+		ciphertext = decoded
+	}
+
+	out, err := p.client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: ciphertext})
+	if err != nil {
+		return "", fmt.Errorf("decrypting %s: %w", ref.Path, err)
+	}
+
+	return string(bytes.TrimRight(out.Plaintext, "\r\n")), nil
+}
+
+// RegisterAWS installs the Secrets Manager and KMS file providers using the
+// default AWS credential chain. region may be empty to use AWS_REGION.
+func RegisterAWS(ctx context.Context, r *Resolver, region string) error {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("loading AWS configuration: %w", err)
+	}
+
+	r.Register(SchemeAWSSecretsManager, NewAWSSecretsManagerProvider(secretsmanager.NewFromConfig(cfg)))
+	r.Register(SchemeKMSFile, NewKMSFileProvider(kms.NewFromConfig(cfg)))
+
+	return nil
+}
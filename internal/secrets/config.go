@@ -0,0 +1,53 @@
+// internal/secrets/config.go
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/dangerclosesec/supra/internal/config"
+)
+
+// FromConfig builds a manager for the backends configured in cfg, resolves
+// every secret reference in cfg in place and tracks the secret settings so
+// they can be rotated. Backends are only contacted when a setting refers to
+// them.
+func FromConfig(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*Manager, error) {
+	fields := cfg.SecretFields()
+
+	names := make([]string, 0, len(fields))
+	schemes := make(map[string]bool)
+	for name, field := range fields {
+		names = append(names, name)
+		if ref, ok := ParseReference(*field); ok {
+			schemes[ref.Scheme] = true
+		}
+	}
+	sort.Strings(names)
+
+	resolver := NewResolver()
+	if schemes[SchemeVault] {
+		if cfg.Secrets.Vault.Address == "" {
+			return nil, fmt.Errorf("secrets.vault.address: must be set to use vault:// references (VAULT_ADDR)")
+		}
+		resolver.Register(SchemeVault, NewVaultProvider(cfg.Secrets.Vault.Address, cfg.Secrets.Vault.Token, cfg.Secrets.Vault.Namespace))
+	}
+	if schemes[SchemeAWSSecretsManager] || schemes[SchemeKMSFile] {
+		if err := RegisterAWS(ctx, resolver, cfg.Secrets.AWS.Region); err != nil {
+			return nil, err
+		}
+	}
+
+	manager := NewManager(resolver, cfg.Secrets.RefreshInterval.Std(), logger)
+	for _, name := range names {
+		secret, err := manager.Track(ctx, name, *fields[name])
+		if err != nil {
+			return nil, err
+		}
+		*fields[name] = secret.Value()
+	}
+
+	return manager, nil
+}
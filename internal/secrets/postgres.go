@@ -0,0 +1,35 @@
+// internal/secrets/postgres.go
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PostgresBeforeConnect returns a pgx BeforeConnect hook that applies the
+// current credentials to every new connection, so connections opened after a
+// rotation use the new password. dsn and password may each be nil; a dynamic
+// dsn replaces the whole connection target, password only the password.
+func PostgresBeforeConnect(dsn, password *Secret) func(context.Context, *pgx.ConnConfig) error {
+	return func(ctx context.Context, cc *pgx.ConnConfig) error {
+		if dsn != nil && dsn.Dynamic() && dsn.Value() != "" {
+			parsed, err := pgx.ParseConfig(dsn.Value())
+			if err != nil {
+				return fmt.Errorf("parsing rotated %s: %w", dsn.Name(), err)
+			}
+			cc.Host = parsed.Host
+			cc.Port = parsed.Port
+			cc.Database = parsed.Database
+			cc.User = parsed.User
+			cc.Password = parsed.Password
+		}
+
+		if password != nil && password.Value() != "" {
+			cc.Password = password.Value()
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,279 @@
+// internal/secrets/secrets.go
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownScheme is returned when a reference names a backend that has not
+// been configured
+var ErrUnknownScheme = errors.New("no secret provider registered for scheme")
+
+// Reference points at a secret held by an external backend. It is written in
+// configuration values as scheme://path#key, for example
+//
+//	vault://secret/data/supra#jwt_secret
+//	awssm://prod/supra/db#password
+//	kmsfile:///run/secrets/jwt.enc
+//
+// Key selects a field when the secret is a JSON object or a Vault KV entry.
+type Reference struct {
+	Scheme string
+	Path   string
+	Key    string
+}
+
+func (r Reference) String() string {
+	s := r.Scheme + "://" + r.Path
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+// ParseReference reports whether value is a secret reference for one of the
+// known schemes. Plain values, including postgres:// URLs, are not references.
+func ParseReference(value string) (Reference, bool) {
+	scheme, rest, ok := strings.Cut(value, "://")
+	if !ok {
+		return Reference{}, false
+	}
+
+	switch scheme {
+	case SchemeVault, SchemeAWSSecretsManager, SchemeKMSFile:
+	default:
+		return Reference{}, false
+	}
+
+	path, key, _ := strings.Cut(rest, "#")
+	return Reference{Scheme: scheme, Path: path, Key: key}, true
+}
+
+// Provider fetches secrets from one backend
+type Provider interface {
+	Fetch(ctx context.Context, ref Reference) (string, error)
+}
+
+// Resolver dispatches references to the provider registered for their scheme
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver creates a resolver with no providers
+func NewResolver() *Resolver {
+	return &Resolver{providers: make(map[string]Provider)}
+}
+
+// Register installs the provider used for scheme
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.providers[scheme] = p
+}
+
+// Resolve returns value unchanged unless it is a secret reference, in which
+// case the secret is fetched from its backend
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	ref, ok := ParseReference(value)
+	if !ok {
+		return value, nil
+	}
+
+	p, ok := r.providers[ref.Scheme]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownScheme, ref.Scheme)
+	}
+
+	secret, err := p.Fetch(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", ref, err)
+	}
+
+	return secret, nil
+}
+
+// Secret is a named configuration value that may change when its backend
+// rotates it
+type Secret struct {
+	name   string
+	source string
+
+	mu    sync.RWMutex
+	value string
+}
+
+// Name returns the configuration key the secret was tracked under
+func (s *Secret) Name() string {
+	return s.name
+}
+
+// Value returns the most recently fetched secret
+func (s *Secret) Value() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+// Dynamic reports whether the secret comes from a backend and can rotate
+func (s *Secret) Dynamic() bool {
+	_, ok := ParseReference(s.source)
+	return ok
+}
+
+func (s *Secret) set(value string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value == value {
+		return false
+	}
+	s.value = value
+	return true
+}
+
+// Manager resolves tracked secrets and periodically refreshes those backed by
+// an external store, notifying subscribers when a value rotates
+type Manager struct {
+	resolver *Resolver
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu        sync.Mutex
+	secrets   map[string]*Secret
+	listeners map[string][]func(string)
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewManager creates a manager that refreshes secrets every interval. A
+// non-positive interval disables rotation.
+func NewManager(resolver *Resolver, interval time.Duration, logger *slog.Logger) *Manager {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Manager{
+		resolver:  resolver,
+		interval:  interval,
+		logger:    logger,
+		secrets:   make(map[string]*Secret),
+		listeners: make(map[string][]func(string)),
+	}
+}
+
+// Track resolves source and remembers it under name so it is refreshed on
+// every rotation pass
+func (m *Manager) Track(ctx context.Context, name, source string) (*Secret, error) {
+	value, err := m.resolver.Resolve(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	secret := &Secret{name: name, source: source, value: value}
+
+	m.mu.Lock()
+	m.secrets[name] = secret
+	m.mu.Unlock()
+
+	return secret, nil
+}
+
+// Get returns the secret tracked under name, or nil
+func (m *Manager) Get(name string) *Secret {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.secrets[name]
+}
+
+// OnRotate registers fn to be called with the new value whenever the secret
+// tracked under name changes
+func (m *Manager) OnRotate(name string, fn func(value string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners[name] = append(m.listeners[name], fn)
+}
+
+// Refresh re-fetches every dynamic secret once. A backend failure keeps the
+// previous value so a transient outage does not take the service down.
+func (m *Manager) Refresh(ctx context.Context) error {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.secrets))
+	for name := range m.secrets {
+		names = append(names, name)
+	}
+	m.mu.Unlock()
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		secret := m.Get(name)
+		if !secret.Dynamic() {
+			continue
+		}
+
+		value, err := m.resolver.Resolve(ctx, secret.source)
+		if err != nil {
+			m.logger.Warn("failed to refresh secret", "secret", name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		if !secret.set(value) {
+			continue
+		}
+
+		m.logger.Info("secret rotated", "secret", name)
+
+		m.mu.Lock()
+		listeners := append([]func(string){}, m.listeners[name]...)
+		m.mu.Unlock()
+		for _, fn := range listeners {
+			fn(value)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Start refreshes secrets in the background until Stop is called
+func (m *Manager) Start() {
+	if m.interval <= 0 {
+		return
+	}
+
+	m.stopCh = make(chan struct{})
+	m.doneCh = make(chan struct{})
+
+	go func() {
+		defer close(m.doneCh)
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), m.interval)
+				_ = m.Refresh(ctx)
+				cancel()
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends background refreshing
+func (m *Manager) Stop() {
+	if m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	<-m.doneCh
+	m.stopCh = nil
+}
@@ -0,0 +1,93 @@
+// internal/secrets/vault.go
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SchemeVault addresses secrets in HashiCorp Vault. The path is the full API
+// path below /v1, e.g. secret/data/supra for a KV v2 mount.
+const SchemeVault = "vault"
+
+// VaultProvider reads secrets through the Vault HTTP API
+type VaultProvider struct {
+	address   string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// NewVaultProvider creates a provider for the Vault server at address
+func NewVaultProvider(address, token, namespace string) *VaultProvider {
+	return &VaultProvider{
+		address:   strings.TrimRight(address, "/"),
+		token:     token,
+		namespace: namespace,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Fetch reads ref.Path and returns ref.Key from it. KV v2 responses, which
+// nest the entry under data.data, are unwrapped automatically.
+func (p *VaultProvider) Fetch(ctx context.Context, ref Reference) (string, error) {
+	if ref.Key == "" {
+		return "", fmt.Errorf("vault reference %s must name a key after #", ref)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.address+"/v1/"+strings.TrimLeft(ref.Path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("decoding vault response: %w", err)
+	}
+
+	data := payload.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	return lookupKey(data, ref)
+}
+
+// lookupKey extracts a string field from a decoded secret
+func lookupKey(data map[string]interface{}, ref Reference) (string, error) {
+	value, ok := data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in %s", ref.Key, ref.Path)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("key %q in %s is not a scalar value", ref.Key, ref.Path)
+	}
+}
@@ -87,23 +87,41 @@ func (s *CacheService) Set(ctx context.Context, key string, value interface{}) e
 	return nil
 }
 
-// CheckNonce checks if a nonce exists in the cache
+// nonceKeyPrefix keeps nonces apart from the other entries in the cache, so
+// a client can't present another entry's key as a nonce and consume it
+const nonceKeyPrefix = "nonce:"
+
+// StoreNonce stores a nonce in the cache for CheckNonce to take
+func (s *CacheService) StoreNonce(ctx context.Context, nonce string) error {
+	if nonce == "" {
+		return domain.ErrInvalidInput
+	}
+
+	s.cache.Set(ctx, nonceKeyPrefix+nonce, true)
+	return nil
+}
+
+// CheckNonce checks if a nonce stored by StoreNonce exists in the cache
 func (s *CacheService) CheckNonce(ctx context.Context, nonce string) (bool, error) {
 	// Validate inputs
 	if nonce == "" {
 		return false, domain.ErrInvalidInput
 	}
 
-	// Check if nonce exists in cache
-	_, found := s.cache.Get(ctx, nonce)
-	if !found {
-		return false, nil
-	}
+	// Take the nonce from the cache so it can't be used again, even by a
+	// concurrent request
+	_, found := s.cache.Take(ctx, nonceKeyPrefix+nonce)
+	return found, nil
+}
 
-	// Delete the nonce from cache
-	s.cache.Delete(ctx, nonce)
+// Add stores a value in the cache unless the key is already cached, and
+// reports whether it did
+func (s *CacheService) Add(ctx context.Context, key string, value interface{}) (bool, error) {
+	if key == "" {
+		return false, domain.ErrInvalidInput
+	}
 
-	return found, nil
+	return s.cache.Add(ctx, key, value), nil
 }
 
 // Get retrieves a value from the cache with type conversion
@@ -0,0 +1,259 @@
+// internal/service/entity_mapper.go
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/model"
+)
+
+// MappedRelation is a relation derived from an application model. An empty
+// Object means the relation is written on the mapped entity itself.
+type MappedRelation struct {
+	Object   auth.Entity
+	Relation string
+	Subject  auth.Subject
+}
+
+// EntityMapper describes how an application model of type T is represented in
+// the identity graph
+type EntityMapper[T any] struct {
+	// EntityType is the graph entity type, e.g. "project"
+	EntityType string
+	// ID extracts the external ID of the entity
+	ID func(obj T) string
+	// Attributes maps the model onto entity attributes; optional
+	Attributes func(obj T) map[string]interface{}
+	// Relations returns relations that should exist for the model; optional
+	Relations func(obj T) []MappedRelation
+	// RelationsOnly skips the entity write and only syncs Relations. Use it for
+	// join models such as organization memberships.
+	RelationsOnly bool
+}
+
+// MappedEntity is the graph representation of an application model
+type MappedEntity struct {
+	Type          string
+	ID            string
+	Attributes    map[string]interface{}
+	Relations     []MappedRelation
+	RelationsOnly bool
+}
+
+// registeredMapper is the type-erased form of an EntityMapper stored in the registry
+type registeredMapper struct {
+	entityType    string
+	relationsOnly bool
+	id            func(obj interface{}) string
+	attributes    func(obj interface{}) map[string]interface{}
+	relations     func(obj interface{}) []MappedRelation
+}
+
+// MapperRegistry holds entity mappers keyed by the Go type they handle
+type MapperRegistry struct {
+	mu      sync.RWMutex
+	mappers map[reflect.Type]*registeredMapper
+}
+
+// NewMapperRegistry creates an empty registry
+func NewMapperRegistry() *MapperRegistry {
+	return &MapperRegistry{
+		mappers: make(map[reflect.Type]*registeredMapper),
+	}
+}
+
+// RegisterMapper adds or replaces the mapper for models of type T. Both T and
+// *T values are accepted by the registry once registered.
+func RegisterMapper[T any](r *MapperRegistry, m EntityMapper[T]) error {
+	if m.EntityType == "" {
+		return fmt.Errorf("mapper entity type is required")
+	}
+	if m.ID == nil {
+		return fmt.Errorf("mapper for %s requires an ID function", m.EntityType)
+	}
+
+	rm := &registeredMapper{
+		entityType:    m.EntityType,
+		relationsOnly: m.RelationsOnly,
+		id:            func(obj interface{}) string { return m.ID(obj.(T)) },
+		attributes: func(obj interface{}) map[string]interface{} {
+			if m.Attributes == nil {
+				return map[string]interface{}{}
+			}
+			return m.Attributes(obj.(T))
+		},
+		relations: func(obj interface{}) []MappedRelation {
+			if m.Relations == nil {
+				return nil
+			}
+			return m.Relations(obj.(T))
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mappers[reflect.TypeOf((*T)(nil)).Elem()] = rm
+
+	return nil
+}
+
+// lookup returns the mapper for obj, dereferencing pointers when the mapper
+// was registered for the value type
+func (r *MapperRegistry) lookup(obj interface{}) (*registeredMapper, interface{}, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t := reflect.TypeOf(obj)
+	if m, ok := r.mappers[t]; ok {
+		return m, obj, true
+	}
+
+	if t != nil && t.Kind() == reflect.Pointer {
+		if m, ok := r.mappers[t.Elem()]; ok {
+			v := reflect.ValueOf(obj)
+			if v.IsNil() {
+				return nil, nil, false
+			}
+			return m, v.Elem().Interface(), true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// EntityTypes returns the entity types of all registered mappers
+func (r *MapperRegistry) EntityTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.mappers))
+	for _, m := range r.mappers {
+		types = append(types, m.entityType)
+	}
+	return types
+}
+
+// Has reports whether a mapper is registered for obj's type
+func (r *MapperRegistry) Has(obj interface{}) bool {
+	_, _, ok := r.lookup(obj)
+	return ok
+}
+
+// Map resolves the graph representation of obj without writing anything
+func (r *MapperRegistry) Map(obj interface{}) (*MappedEntity, error) {
+	m, v, ok := r.lookup(obj)
+	if !ok {
+		return nil, fmt.Errorf("no entity mapper registered for %T", obj)
+	}
+
+	mapped := &MappedEntity{
+		Type:          m.entityType,
+		ID:            m.id(v),
+		RelationsOnly: m.relationsOnly,
+	}
+	if mapped.ID == "" {
+		return nil, fmt.Errorf("mapper for %s returned an empty ID", mapped.Type)
+	}
+
+	mapped.Relations = m.relations(v)
+	for i := range mapped.Relations {
+		if mapped.Relations[i].Object.Type == "" {
+			mapped.Relations[i].Object = auth.Entity{Type: mapped.Type, ID: mapped.ID}
+		}
+	}
+
+	if !mapped.RelationsOnly {
+		mapped.Attributes = m.attributes(v)
+	}
+
+	return mapped, nil
+}
+
+// registerDefaultMappers installs mappers for the models shipped with supra
+func registerDefaultMappers(r *MapperRegistry) {
+	_ = RegisterMapper(r, EntityMapper[model.User]{
+		EntityType: "user",
+		ID:         func(u model.User) string { return u.ID.String() },
+		Attributes: func(u model.User) map[string]interface{} { return userAttributes(&u) },
+		// Users own their own profile (user#owner@user in the schema)
+		Relations: func(u model.User) []MappedRelation {
+			return []MappedRelation{{Relation: "owner", Subject: auth.Subject{Type: "user", ID: u.ID.String()}}}
+		},
+	})
+
+	_ = RegisterMapper(r, EntityMapper[model.Organization]{
+		EntityType: "organization",
+		ID:         func(o model.Organization) string { return o.ID.String() },
+		Attributes: func(o model.Organization) map[string]interface{} { return organizationAttributes(&o) },
+	})
+
+	// Memberships become organization#<role>@user relations; the role name is
+	// assumed to match a relation in the schema
+	_ = RegisterMapper(r, EntityMapper[model.OrganizationUser]{
+		EntityType:    "organization",
+		ID:            func(ou model.OrganizationUser) string { return ou.ID.String() },
+		RelationsOnly: true,
+		Relations: func(ou model.OrganizationUser) []MappedRelation {
+			return []MappedRelation{{
+				Object:   auth.Entity{Type: "organization", ID: ou.OrganizationID.String()},
+				Relation: ou.Role,
+				Subject:  auth.Subject{Type: "user", ID: ou.UserID.String()},
+			}}
+		},
+	})
+}
+
+// Sync writes any registered model and its mapped relations to the permission system
+func (s *EntitySyncService) Sync(ctx context.Context, obj interface{}) error {
+	mapped, err := s.mappers.Map(obj)
+	if err != nil {
+		return err
+	}
+
+	return s.writeMapped(ctx, mapped)
+}
+
+// writeMapped writes a resolved entity and then its relations
+func (s *EntitySyncService) writeMapped(ctx context.Context, mapped *MappedEntity) error {
+	if !mapped.RelationsOnly {
+		if err := s.supraService.WriteEntityAttributes(ctx, mapped.Type, mapped.ID, mapped.Attributes); err != nil {
+			return fmt.Errorf("writing %s attributes: %w", mapped.Type, err)
+		}
+	}
+
+	for _, rel := range mapped.Relations {
+		if err := s.supraService.WriteRelationship(rel.Object, rel.Relation, rel.Subject); err != nil {
+			return fmt.Errorf("writing %s relation %s: %w", mapped.Type, rel.Relation, err)
+		}
+	}
+
+	return nil
+}
+
+// removeMapped undoes writeMapped: relation-only models have their relations
+// deleted, everything else is deleted as an entity
+func (s *EntitySyncService) removeMapped(ctx context.Context, mapped *MappedEntity) error {
+	if mapped.RelationsOnly {
+		for _, rel := range mapped.Relations {
+			if err := s.supraService.DeleteRelationship(rel.Object, rel.Relation, rel.Subject); err != nil {
+				return fmt.Errorf("deleting %s relation %s: %w", mapped.Type, rel.Relation, err)
+			}
+		}
+		return nil
+	}
+
+	if err := s.supraService.DeleteEntity(ctx, mapped.Type, mapped.ID); err != nil {
+		return fmt.Errorf("deleting %s entity: %w", mapped.Type, err)
+	}
+	return nil
+}
+
+// Mappers returns the registry used by the service so callers can register
+// additional application models
+func (s *EntitySyncService) Mappers() *MapperRegistry {
+	return s.mappers
+}
@@ -0,0 +1,93 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testProject struct {
+	ID    string
+	Name  string
+	OrgID string
+}
+
+func TestMapperRegistry(t *testing.T) {
+	registry := service.NewMapperRegistry()
+
+	err := service.RegisterMapper(registry, service.EntityMapper[testProject]{
+		EntityType: "project",
+		ID:         func(p testProject) string { return p.ID },
+		Attributes: func(p testProject) map[string]interface{} { return map[string]interface{}{"name": p.Name} },
+		Relations: func(p testProject) []service.MappedRelation {
+			return []service.MappedRelation{{
+				Relation: "parent",
+				Subject:  auth.Subject{Type: "organization", ID: p.OrgID},
+			}}
+		},
+	})
+	require.NoError(t, err)
+
+	t.Run("maps values and pointers", func(t *testing.T) {
+		p := testProject{ID: "p1", Name: "Apollo", OrgID: "o1"}
+
+		for _, obj := range []interface{}{p, &p} {
+			mapped, err := registry.Map(obj)
+			require.NoError(t, err)
+			assert.Equal(t, "project", mapped.Type)
+			assert.Equal(t, "p1", mapped.ID)
+			assert.Equal(t, "Apollo", mapped.Attributes["name"])
+			require.Len(t, mapped.Relations, 1)
+			assert.Equal(t, auth.Entity{Type: "project", ID: "p1"}, mapped.Relations[0].Object)
+		}
+	})
+
+	t.Run("rejects unregistered types", func(t *testing.T) {
+		_, err := registry.Map(struct{}{})
+		assert.Error(t, err)
+	})
+
+	t.Run("requires entity type and ID function", func(t *testing.T) {
+		assert.Error(t, service.RegisterMapper(registry, service.EntityMapper[testProject]{ID: func(p testProject) string { return p.ID }}))
+		assert.Error(t, service.RegisterMapper(registry, service.EntityMapper[testProject]{EntityType: "project"}))
+	})
+}
+
+func TestEntitySyncServiceSync(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{})
+	}))
+	defer server.Close()
+
+	supra, err := auth.NewSupraService(server.URL)
+	require.NoError(t, err)
+	sync := service.NewEntitySyncService(supra)
+
+	require.NoError(t, service.RegisterMapper(sync.Mappers(), service.EntityMapper[testProject]{
+		EntityType: "project",
+		ID:         func(p testProject) string { return p.ID },
+		Relations: func(p testProject) []service.MappedRelation {
+			return []service.MappedRelation{{Relation: "parent", Subject: auth.Subject{Type: "organization", ID: p.OrgID}}}
+		},
+	}))
+
+	require.NoError(t, sync.Sync(context.Background(), &testProject{ID: "p1", OrgID: "o1"}))
+	assert.Equal(t, []string{"/entity", "/relation"}, paths)
+
+	// Built-in mappers remain available
+	assert.True(t, sync.Mappers().Has(&model.User{ID: uuid.New()}))
+	assert.True(t, sync.Mappers().Has(&model.Organization{ID: uuid.New()}))
+}
@@ -3,13 +3,33 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/model"
 	"github.com/dangerclosesec/supra/internal/repository"
+	"github.com/google/uuid"
 )
 
+// Checkpoint keys for the entity types handled by reconciliation
+const (
+	checkpointUsers         = "user"
+	checkpointOrganizations = "organization"
+)
+
+// CheckpointStore persists reconciliation progress between runs
+type CheckpointStore interface {
+	Get(ctx context.Context, entityType string) (*model.ReconciliationCheckpoint, error)
+	Save(ctx context.Context, checkpoint *model.ReconciliationCheckpoint) error
+	Clear(ctx context.Context, entityType string) error
+}
+
 // EntityReconciliationService periodically reconciles database entities with permission system
 type EntityReconciliationService struct {
 	userRepo     repository.UserRepositoryIface
@@ -18,6 +38,11 @@ type EntityReconciliationService struct {
 	syncInterval time.Duration
 	batchSize    int
 	dryRun       bool // If true, don't make changes, just log
+	workers      int  // Number of batches processed concurrently per entity type
+	checkpoints  CheckpointStore
+	plan         *ReconciliationPlan // Collects planned changes during dry runs
+	sourcesMu    sync.RWMutex
+	sources      []*registeredSource
 	logger       *slog.Logger
 	stopChan     chan struct{}
 	stoppedChan  chan struct{}
@@ -35,17 +60,35 @@ func NewEntityReconciliationService(
 		syncInterval = 30 * time.Minute
 	}
 
-	return &EntityReconciliationService{
+	s := &EntityReconciliationService{
 		userRepo:     userRepo,
 		orgRepo:      orgRepo,
 		entitySync:   entitySync,
 		syncInterval: syncInterval,
 		batchSize:    100,
 		dryRun:       false,
+		workers:      1,
 		logger:       logger,
 		stopChan:     make(chan struct{}),
 		stoppedChan:  make(chan struct{}),
 	}
+
+	_ = RegisterSource(s, ReconcileSource[*model.User]{
+		Name:       "users",
+		EntityType: checkpointUsers,
+		Fetch:      s.fetchUsers,
+		ID:         func(user *model.User) uuid.UUID { return user.ID },
+		Reconcile:  s.reconcileUser,
+	})
+	_ = RegisterSource(s, ReconcileSource[*model.Organization]{
+		Name:       "organizations",
+		EntityType: checkpointOrganizations,
+		Fetch:      s.fetchOrganizations,
+		ID:         func(org *model.Organization) uuid.UUID { return org.ID },
+		Reconcile:  s.reconcileOrganization,
+	})
+
+	return s
 }
 
 // Start begins the periodic reconciliation process
@@ -76,21 +119,16 @@ func (s *EntityReconciliationService) Stop() {
 	<-s.stoppedChan
 }
 
-// reconcileAll reconciles all entities
+// reconcileAll reconciles all entities of every registered source
 func (s *EntityReconciliationService) reconcileAll(ctx context.Context) error {
 	s.logger.Info("starting full reconciliation of all entities")
 
-	// Reconcile users
-	if err := s.ReconcileUsers(ctx); err != nil {
-		return fmt.Errorf("reconciling users: %w", err)
-	}
-
-	// Reconcile organizations
-	if err := s.ReconcileOrganizations(ctx); err != nil {
-		return fmt.Errorf("reconciling organizations: %w", err)
+	for _, name := range s.Sources() {
+		if err := s.Reconcile(ctx, name, repository.EntityFilter{}); err != nil {
+			return fmt.Errorf("reconciling %s: %w", name, err)
+		}
 	}
 
-	// We could add other entity types here
 	s.logger.Info("completed full reconciliation of all entities")
 
 	return nil
@@ -114,157 +152,470 @@ func (s *EntityReconciliationService) SetDryRun(dryRun bool) {
 	s.dryRun = dryRun
 }
 
+// SetPlan records the changes a dry run would make into plan
+func (s *EntityReconciliationService) SetPlan(plan *ReconciliationPlan) {
+	s.plan = plan
+}
+
+// SetWorkers sets how many batches of each entity type are processed concurrently
+func (s *EntityReconciliationService) SetWorkers(workers int) {
+	if workers > 0 {
+		s.workers = workers
+	}
+}
+
+// SetCheckpointStore enables resumable runs. Progress is saved after every page
+// of batches and cleared once an entity type has been fully reconciled.
+func (s *EntityReconciliationService) SetCheckpointStore(store CheckpointStore) {
+	s.checkpoints = store
+}
+
+// ResetCheckpoints discards saved progress so the next run starts from the beginning
+func (s *EntityReconciliationService) ResetCheckpoints(ctx context.Context) error {
+	if s.checkpoints == nil {
+		return nil
+	}
+
+	s.sourcesMu.RLock()
+	sources := append([]*registeredSource(nil), s.sources...)
+	s.sourcesMu.RUnlock()
+
+	for _, src := range sources {
+		if err := s.checkpoints.Clear(ctx, src.entityType); err != nil {
+			return fmt.Errorf("clearing %s checkpoint: %w", src.entityType, err)
+		}
+	}
+
+	return nil
+}
+
 // ReconcileUsers reconciles all users with the permission system
 func (s *EntityReconciliationService) ReconcileUsers(ctx context.Context) error {
-	// In a real implementation, we'd use pagination to handle large datasets
-	// For simplicity, we'll fetch all users
-	users, err := s.userRepo.FindAll(ctx)
-	if err != nil {
-		return fmt.Errorf("fetching users: %w", err)
+	return s.Reconcile(ctx, "users", repository.EntityFilter{})
+}
+
+// ReconcileOrganizations reconciles all organizations with the permission system
+func (s *EntityReconciliationService) ReconcileOrganizations(ctx context.Context) error {
+	return s.Reconcile(ctx, "organizations", repository.EntityFilter{})
+}
+
+// fetchUsers pages through users, filtered only when there is a filter
+func (s *EntityReconciliationService) fetchUsers(ctx context.Context, filter repository.EntityFilter, afterID uuid.UUID, limit int) ([]*model.User, error) {
+	if filter.IsZero() {
+		return s.userRepo.FindAfterID(ctx, afterID, limit)
 	}
+	return s.userRepo.FindPage(ctx, filter, afterID, limit)
+}
 
-	s.logger.Info("reconciling users", "count", len(users), "dry_run", s.dryRun)
+// fetchOrganizations pages through organizations, filtered only when there
+// is a filter
+func (s *EntityReconciliationService) fetchOrganizations(ctx context.Context, filter repository.EntityFilter, afterID uuid.UUID, limit int) ([]*model.Organization, error) {
+	if filter.IsZero() {
+		return s.orgRepo.FindAfterID(ctx, afterID, limit)
+	}
+	return s.orgRepo.FindPage(ctx, filter, afterID, limit)
+}
 
-	// Process in batches
-	for i := 0; i < len(users); i += s.batchSize {
-		end := i + s.batchSize
-		if end > len(users) {
-			end = len(users)
+// reconcilePaged walks an entity table in ID order using keyset pagination. Each
+// page is split into batches that are handed to a pool of workers; a failing or
+// panicking batch is logged and counted without stopping the others. Once a page
+// completes, the last ID is checkpointed so an interrupted run can resume from it;
+// a page cut short by cancellation isn't, so a resumed run retries it whole.
+// Filtered walks cover part of the table, so they don't use checkpoints.
+func reconcilePaged[T any](
+	ctx context.Context,
+	s *EntityReconciliationService,
+	entityType string,
+	filtered bool,
+	fetch func(ctx context.Context, afterID uuid.UUID, limit int) ([]T, error),
+	idOf func(T) uuid.UUID,
+	reconcile func(ctx context.Context, item T) error,
+) error {
+	checkpoint := &model.ReconciliationCheckpoint{EntityType: entityType}
+
+	// Dry runs never touch checkpoints so they always report the full picture
+	useCheckpoints := s.checkpoints != nil && !s.dryRun && !filtered
+	if useCheckpoints {
+		saved, err := s.checkpoints.Get(ctx, entityType)
+		if err != nil {
+			return fmt.Errorf("loading %s checkpoint: %w", entityType, err)
 		}
+		if saved != nil {
+			checkpoint = saved
+			s.logger.Info("resuming reconciliation from checkpoint",
+				"entity_type", entityType,
+				"last_id", saved.LastID.String(),
+				"processed", saved.Processed,
+				"failed", saved.Failed,
+			)
+		}
+	}
 
-		batch := users[i:end]
-		s.logger.Info("processing user batch", "start", i, "end", end, "size", len(batch))
+	s.logger.Info("reconciling entities",
+		"entity_type", entityType,
+		"workers", s.workers,
+		"batch_size", s.batchSize,
+		"dry_run", s.dryRun,
+		"filtered", filtered,
+	)
+
+	pageSize := s.batchSize * s.workers
+	for {
+		page, err := fetch(ctx, checkpoint.LastID, pageSize)
+		if err != nil {
+			return fmt.Errorf("fetching %s page: %w", entityType, err)
+		}
+		if len(page) == 0 {
+			break
+		}
 
-		for _, user := range batch {
-			if s.dryRun {
-				s.logger.Info("would sync user (dry run)",
-					"user_id", user.ID.String(),
-					"email", user.Email,
-					"status", user.Status,
-				)
-				continue
+		var (
+			wg     sync.WaitGroup
+			failed atomic.Int64
+		)
+		for start := 0; start < len(page); start += s.batchSize {
+			end := start + s.batchSize
+			if end > len(page) {
+				end = len(page)
 			}
 
-			if err := s.entitySync.SyncUserToPermissions(ctx, user); err != nil {
-				s.logger.Error("failed to sync user",
-					"user_id", user.ID.String(),
-					"error", err,
-				)
-				// Continue with other users
-			} else {
-				s.logger.Info("successfully synced user",
-					"user_id", user.ID.String(),
-					"email", user.Email,
-				)
+			wg.Add(1)
+			go func(batch []T, start int) {
+				defer wg.Done()
+				failed.Add(runBatch(ctx, s, entityType, start, batch, reconcile))
+			}(page[start:end], start)
+		}
+		wg.Wait()
+
+		// Items failed or skipped because of the cancellation must not be
+		// checkpointed past
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		checkpoint.LastID = idOf(page[len(page)-1])
+		checkpoint.Processed += int64(len(page))
+		checkpoint.Failed += failed.Load()
+
+		if useCheckpoints {
+			if err := s.checkpoints.Save(ctx, checkpoint); err != nil {
+				return fmt.Errorf("saving %s checkpoint: %w", entityType, err)
 			}
 		}
 
-		// Check if context is done between batches
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			// Continue processing
+		if len(page) < pageSize {
+			break
+		}
+	}
+
+	s.logger.Info("completed entity reconciliation",
+		"entity_type", entityType,
+		"processed", checkpoint.Processed,
+		"failed", checkpoint.Failed,
+	)
+
+	if useCheckpoints {
+		if err := s.checkpoints.Clear(ctx, entityType); err != nil {
+			return fmt.Errorf("clearing %s checkpoint: %w", entityType, err)
 		}
 	}
 
 	return nil
 }
 
-// ReconcileOrganizations reconciles all organizations with the permission system
-func (s *EntityReconciliationService) ReconcileOrganizations(ctx context.Context) error {
-	// In a real implementation, we'd use pagination to handle large datasets
-	// For simplicity, we'll fetch all organizations
-	orgs, err := s.orgRepo.FindAll(ctx)
-	if err != nil {
-		return fmt.Errorf("fetching organizations: %w", err)
+// runBatch reconciles a single batch and returns the number of failed items.
+// A panic inside the batch is recovered and counts every unprocessed item as failed.
+// Once ctx is done the rest of the batch is skipped, uncounted.
+func runBatch[T any](
+	ctx context.Context,
+	s *EntityReconciliationService,
+	entityType string,
+	offset int,
+	batch []T,
+	reconcile func(ctx context.Context, item T) error,
+) (failed int64) {
+	done := 0
+	defer func() {
+		if r := recover(); r != nil {
+			failed += int64(len(batch) - done)
+			s.logger.Error("reconciliation batch panicked",
+				"entity_type", entityType,
+				"offset", offset,
+				"panic", r,
+			)
+		}
+	}()
+
+	s.logger.Info("processing batch", "entity_type", entityType, "offset", offset, "size", len(batch))
+
+	for _, item := range batch {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := reconcile(ctx, item); err != nil {
+			failed++
+		}
+		done++
 	}
 
-	s.logger.Info("reconciling organizations", "count", len(orgs), "dry_run", s.dryRun)
+	return failed
+}
 
-	// Process in batches
-	for i := 0; i < len(orgs); i += s.batchSize {
-		end := i + s.batchSize
-		if end > len(orgs) {
-			end = len(orgs)
+// reconcileUser syncs a single user, logging the outcome
+func (s *EntityReconciliationService) reconcileUser(ctx context.Context, user *model.User) error {
+	if s.dryRun {
+		s.logger.Info("would sync user (dry run)",
+			"user_id", user.ID.String(),
+			"email", user.Email,
+			"status", user.Status,
+		)
+		mapped, err := s.entitySync.Mappers().Map(user)
+		if err != nil {
+			return err
 		}
+		return s.planMapped(ctx, mapped)
+	}
 
-		batch := orgs[i:end]
-		s.logger.Info("processing organization batch", "start", i, "end", end, "size", len(batch))
-
-		for _, org := range batch {
-			if s.dryRun {
-				s.logger.Info("would sync organization (dry run)",
-					"org_id", org.ID.String(),
-					"name", org.Name,
-					"type", org.OrgType,
-				)
-
-				// Log members that would be synced
-				members, err := s.orgRepo.FindOrganizationUsers(ctx, org.ID)
-				if err == nil {
-					for _, member := range members {
-						s.logger.Info("would sync relationship (dry run)",
-							"org_id", org.ID.String(),
-							"user_id", member.UserID.String(),
-							"role", member.Role,
-						)
-					}
-				}
+	if err := s.entitySync.SyncUserToPermissions(ctx, user); err != nil {
+		s.logger.Error("failed to sync user",
+			"user_id", user.ID.String(),
+			"error", err,
+		)
+		return err
+	}
 
-				continue
-			}
+	s.logger.Info("successfully synced user",
+		"user_id", user.ID.String(),
+		"email", user.Email,
+	)
+	return nil
+}
 
-			// Sync organization entity
-			if err := s.entitySync.SyncOrganizationToPermissions(ctx, org); err != nil {
-				s.logger.Error("failed to sync organization",
-					"org_id", org.ID.String(),
-					"error", err,
-				)
-				// Continue with other organizations
-			} else {
-				s.logger.Info("successfully synced organization",
-					"org_id", org.ID.String(),
-					"name", org.Name,
-				)
-			}
+// reconcileOrganization syncs a single organization and its membership relationships
+func (s *EntityReconciliationService) reconcileOrganization(ctx context.Context, org *model.Organization) error {
+	if s.dryRun {
+		s.logger.Info("would sync organization (dry run)",
+			"org_id", org.ID.String(),
+			"name", org.Name,
+			"type", org.OrgType,
+		)
+		if err := s.planEntity(ctx, "organization", org.ID.String(), organizationAttributes(org)); err != nil {
+			return err
+		}
 
-			// Now reconcile membership relationships
-			members, err := s.orgRepo.FindOrganizationUsers(ctx, org.ID)
-			if err != nil {
-				s.logger.Error("failed to fetch organization members",
-					"org_id", org.ID.String(),
-					"error", err,
-				)
-				continue
-			}
+		// Log members that would be synced
+		members, err := s.orgRepo.FindOrganizationUsers(ctx, org.ID)
+		if err != nil {
+			return err
+		}
+		memberships := make([]MappedRelation, 0, len(members))
+		for _, member := range members {
+			s.logger.Info("would sync relationship (dry run)",
+				"org_id", org.ID.String(),
+				"user_id", member.UserID.String(),
+				"role", member.Role,
+			)
+			memberships = append(memberships, MappedRelation{
+				Relation: member.Role,
+				Subject:  auth.Subject{Type: "user", ID: member.UserID.String()},
+			})
+		}
 
-			for _, member := range members {
-				if err := s.entitySync.EstablishUserOrganizationRelation(ctx, org.ID, member.UserID, member.Role); err != nil {
-					s.logger.Error("failed to sync member relationship",
-						"org_id", org.ID.String(),
-						"user_id", member.UserID.String(),
-						"role", member.Role,
-						"error", err,
-					)
-				} else {
-					s.logger.Info("successfully synced relationship",
-						"org_id", org.ID.String(),
-						"user_id", member.UserID.String(),
-						"role", member.Role,
-					)
-				}
-			}
+		// Memberships are the only relations sync writes on an organization,
+		// so any other synced one is stale
+		return s.planRelations(ctx, auth.Entity{Type: "organization", ID: org.ID.String()}, memberships, true)
+	}
+
+	var syncErr error
+
+	// Sync organization entity
+	if err := s.entitySync.SyncOrganizationToPermissions(ctx, org); err != nil {
+		s.logger.Error("failed to sync organization",
+			"org_id", org.ID.String(),
+			"error", err,
+		)
+		syncErr = err
+	} else {
+		s.logger.Info("successfully synced organization",
+			"org_id", org.ID.String(),
+			"name", org.Name,
+		)
+	}
+
+	// Now reconcile membership relationships
+	members, err := s.orgRepo.FindOrganizationUsers(ctx, org.ID)
+	if err != nil {
+		s.logger.Error("failed to fetch organization members",
+			"org_id", org.ID.String(),
+			"error", err,
+		)
+		return err
+	}
+
+	for _, member := range members {
+		if err := s.entitySync.EstablishUserOrganizationRelation(ctx, org.ID, member.UserID, member.Role); err != nil {
+			s.logger.Error("failed to sync member relationship",
+				"org_id", org.ID.String(),
+				"user_id", member.UserID.String(),
+				"role", member.Role,
+				"error", err,
+			)
+			syncErr = err
+		} else {
+			s.logger.Info("successfully synced relationship",
+				"org_id", org.ID.String(),
+				"user_id", member.UserID.String(),
+				"role", member.Role,
+			)
 		}
+	}
+
+	return syncErr
+}
+
+// planEntity records an entity write in the plan: a create when the entity
+// hasn't been synced, or an update when its attributes differ. An entity
+// already in sync is left out.
+func (s *EntityReconciliationService) planEntity(ctx context.Context, entityType, entityID string, attributes map[string]interface{}) error {
+	if s.plan == nil {
+		return nil
+	}
+
+	stored, exists, err := s.entitySync.EntityAttributes(ctx, entityType, entityID)
+	if err != nil {
+		s.logger.Error("failed to look up entity for plan",
+			"entity_type", entityType,
+			"entity_id", entityID,
+			"error", err,
+		)
+		return err
+	}
 
-		// Check if context is done between batches
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			// Continue processing
+	action := PlanActionCreate
+	if exists {
+		same, err := sameAttributes(stored, attributes)
+		if err != nil {
+			return fmt.Errorf("comparing %s attributes: %w", entityType, err)
 		}
+		if same {
+			return nil
+		}
+		action = PlanActionUpdate
 	}
 
+	s.plan.AddEntity(PlannedEntity{
+		Action:     action,
+		Type:       entityType,
+		ID:         entityID,
+		Attributes: attributes,
+	})
 	return nil
 }
+
+// sameAttributes reports whether attributes, once encoded as JSON the way
+// the permission system stores them, equal the stored ones
+func sameAttributes(stored, attributes map[string]interface{}) (bool, error) {
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		return false, err
+	}
+	var encoded map[string]interface{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return false, err
+	}
+	if len(stored) == 0 && len(encoded) == 0 {
+		return true, nil
+	}
+	return reflect.DeepEqual(stored, encoded), nil
+}
+
+// planMapped records the writes syncing a mapped model would make: its
+// entity, and the relations the graph doesn't have yet
+func (s *EntityReconciliationService) planMapped(ctx context.Context, mapped *MappedEntity) error {
+	if !mapped.RelationsOnly {
+		if err := s.planEntity(ctx, mapped.Type, mapped.ID, mapped.Attributes); err != nil {
+			return err
+		}
+	}
+
+	// Group the relations by object so each object's are read once
+	var objects []auth.Entity
+	byObject := make(map[auth.Entity][]MappedRelation)
+	for _, rel := range mapped.Relations {
+		if _, ok := byObject[rel.Object]; !ok {
+			objects = append(objects, rel.Object)
+		}
+		byObject[rel.Object] = append(byObject[rel.Object], rel)
+	}
+	for _, object := range objects {
+		if err := s.planRelations(ctx, object, byObject[object], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planRelations records an add for each relation in desired that entity sync
+// hasn't written on object. With removeStale it also records a remove for
+// each synced relation on object that desired lacks; set it only when desired
+// is every relation sync writes on object.
+func (s *EntityReconciliationService) planRelations(ctx context.Context, object auth.Entity, desired []MappedRelation, removeStale bool) error {
+	if s.plan == nil {
+		return nil
+	}
+
+	synced, err := s.entitySync.SyncedRelations(ctx, object)
+	if err != nil {
+		s.logger.Error("failed to look up relations for plan",
+			"entity_type", object.Type,
+			"entity_id", object.ID,
+			"error", err,
+		)
+		return err
+	}
+
+	type tuple struct {
+		relation string
+		subject  auth.Subject
+	}
+	current := make(map[tuple]bool, len(synced))
+	for _, rel := range synced {
+		current[tuple{rel.Relation, rel.Subject}] = true
+	}
+
+	planned := make(map[tuple]bool, len(desired))
+	for _, rel := range desired {
+		key := tuple{rel.Relation, rel.Subject}
+		if planned[key] {
+			continue
+		}
+		planned[key] = true
+		if !current[key] {
+			s.plan.AddRelation(plannedRelation(PlanActionAdd, object, rel.Relation, rel.Subject))
+		}
+	}
+
+	if removeStale {
+		for _, rel := range synced {
+			key := tuple{rel.Relation, rel.Subject}
+			if planned[key] {
+				continue
+			}
+			planned[key] = true
+			s.plan.AddRelation(plannedRelation(PlanActionRemove, object, rel.Relation, rel.Subject))
+		}
+	}
+	return nil
+}
+
+// plannedRelation builds a plan step for a relation change on object
+func plannedRelation(action PlanAction, object auth.Entity, relation string, subject auth.Subject) PlannedRelation {
+	return PlannedRelation{
+		Action:      action,
+		ObjectType:  object.Type,
+		ObjectID:    object.ID,
+		Relation:    relation,
+		SubjectType: subject.Type,
+		SubjectID:   subject.ID,
+	}
+}
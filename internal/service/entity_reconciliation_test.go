@@ -0,0 +1,423 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/mocks"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/repository"
+	"github.com/dangerclosesec/supra/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// memoryCheckpointStore is an in-memory CheckpointStore for tests
+type memoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]model.ReconciliationCheckpoint
+	saves       int
+}
+
+func newMemoryCheckpointStore() *memoryCheckpointStore {
+	return &memoryCheckpointStore{checkpoints: map[string]model.ReconciliationCheckpoint{}}
+}
+
+func (m *memoryCheckpointStore) Get(ctx context.Context, entityType string) (*model.ReconciliationCheckpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp, ok := m.checkpoints[entityType]
+	if !ok {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+func (m *memoryCheckpointStore) Save(ctx context.Context, checkpoint *model.ReconciliationCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[checkpoint.EntityType] = *checkpoint
+	m.saves++
+	return nil
+}
+
+func (m *memoryCheckpointStore) Clear(ctx context.Context, entityType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.checkpoints, entityType)
+	return nil
+}
+
+// newTestEntitySync returns an EntitySyncService backed by a fake authz server
+// that counts entity writes and holds no entities or relations. Entities whose
+// ID is in failIDs are rejected with a 500.
+func newTestEntitySync(t *testing.T, synced *atomic.Int64, failIDs map[string]bool) *service.EntitySyncService {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/relation" {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"relations": []interface{}{}})
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"code": "entity_not_found", "message": "not found"})
+			return
+		}
+
+		var req struct {
+			ExternalID string `json:"external_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		if failIDs[req.ExternalID] {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]string{"code": "internal_error", "message": "boom"})
+			return
+		}
+
+		if r.URL.Path == "/entity" {
+			synced.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"type": "user", "external_id": req.ExternalID})
+	}))
+	t.Cleanup(server.Close)
+
+	supra, err := auth.NewSupraService(server.URL)
+	require.NoError(t, err)
+
+	return service.NewEntitySyncService(supra)
+}
+
+func makeUsers(n int) []*model.User {
+	users := make([]*model.User, n)
+	for i := range users {
+		users[i] = &model.User{ID: uuid.New(), Email: "user@example.com", Status: model.StatusActive}
+	}
+	return users
+}
+
+func TestReconcileUsers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("processes every page and clears the checkpoint", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		userRepo := mocks.NewMockUserRepositoryIface(ctrl)
+		users := makeUsers(5)
+
+		gomock.InOrder(
+			userRepo.EXPECT().FindAfterID(gomock.Any(), uuid.Nil, 4).Return(users[:4], nil),
+			userRepo.EXPECT().FindAfterID(gomock.Any(), users[3].ID, 4).Return(users[4:], nil),
+		)
+
+		var synced atomic.Int64
+		store := newMemoryCheckpointStore()
+		svc := service.NewEntityReconciliationService(userRepo, nil, newTestEntitySync(t, &synced, nil), 0, logger)
+		svc.SetBatchSize(2)
+		svc.SetWorkers(2)
+		svc.SetCheckpointStore(store)
+
+		require.NoError(t, svc.ReconcileUsers(context.Background()))
+		assert.Equal(t, int64(5), synced.Load())
+		assert.Equal(t, 2, store.saves)
+
+		cp, _ := store.Get(context.Background(), "user")
+		assert.Nil(t, cp, "checkpoint should be cleared after a complete run")
+	})
+
+	t.Run("resumes after the saved checkpoint", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		userRepo := mocks.NewMockUserRepositoryIface(ctrl)
+		users := makeUsers(3)
+		resumeFrom := uuid.New()
+
+		userRepo.EXPECT().FindAfterID(gomock.Any(), resumeFrom, 10).Return(users, nil)
+
+		var synced atomic.Int64
+		store := newMemoryCheckpointStore()
+		_ = store.Save(context.Background(), &model.ReconciliationCheckpoint{EntityType: "user", LastID: resumeFrom, Processed: 100})
+
+		svc := service.NewEntityReconciliationService(userRepo, nil, newTestEntitySync(t, &synced, nil), 0, logger)
+		svc.SetBatchSize(10)
+		svc.SetCheckpointStore(store)
+
+		require.NoError(t, svc.ReconcileUsers(context.Background()))
+		assert.Equal(t, int64(3), synced.Load())
+	})
+
+	t.Run("cancellation mid-page keeps the checkpoint before the page", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		userRepo := mocks.NewMockUserRepositoryIface(ctrl)
+		users := makeUsers(4)
+		resumeFrom := uuid.New()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		userRepo.EXPECT().FindAfterID(gomock.Any(), resumeFrom, 2).
+			DoAndReturn(func(context.Context, uuid.UUID, int) ([]*model.User, error) {
+				cancel()
+				return users[:2], nil
+			})
+
+		var synced atomic.Int64
+		store := newMemoryCheckpointStore()
+		_ = store.Save(ctx, &model.ReconciliationCheckpoint{EntityType: "user", LastID: resumeFrom, Processed: 100})
+
+		svc := service.NewEntityReconciliationService(userRepo, nil, newTestEntitySync(t, &synced, nil), 0, logger)
+		svc.SetBatchSize(2)
+		svc.SetCheckpointStore(store)
+
+		assert.ErrorIs(t, svc.ReconcileUsers(ctx), context.Canceled)
+		assert.Equal(t, 1, store.saves, "only the seeded checkpoint is saved")
+
+		cp, _ := store.Get(context.Background(), "user")
+		require.NotNil(t, cp)
+		assert.Equal(t, resumeFrom, cp.LastID, "a resumed run retries the cancelled page")
+		assert.Equal(t, int64(100), cp.Processed)
+	})
+
+	t.Run("failed entities do not stop other batches", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		userRepo := mocks.NewMockUserRepositoryIface(ctrl)
+		users := makeUsers(4)
+
+		userRepo.EXPECT().FindAfterID(gomock.Any(), uuid.Nil, 6).Return(users, nil)
+
+		var synced atomic.Int64
+		failIDs := map[string]bool{users[0].ID.String(): true}
+		svc := service.NewEntityReconciliationService(userRepo, nil, newTestEntitySync(t, &synced, failIDs), 0, logger)
+		svc.SetBatchSize(2)
+		svc.SetWorkers(3)
+
+		require.NoError(t, svc.ReconcileUsers(context.Background()))
+		assert.Equal(t, int64(3), synced.Load())
+	})
+
+	t.Run("dry run does not touch checkpoints", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		userRepo := mocks.NewMockUserRepositoryIface(ctrl)
+
+		userRepo.EXPECT().FindAfterID(gomock.Any(), uuid.Nil, 100).Return(makeUsers(2), nil)
+
+		var synced atomic.Int64
+		store := newMemoryCheckpointStore()
+		svc := service.NewEntityReconciliationService(userRepo, nil, newTestEntitySync(t, &synced, nil), 0, logger)
+		svc.SetDryRun(true)
+		svc.SetCheckpointStore(store)
+
+		require.NoError(t, svc.ReconcileUsers(context.Background()))
+		assert.Equal(t, int64(0), synced.Load())
+		assert.Equal(t, 0, store.saves)
+	})
+}
+
+func TestReconciliationPlan(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := makeUsers(3)
+	users[2].Status = model.StatusPending
+
+	// The first user is in sync, the second missing and the third stale
+	stored := map[string]map[string]interface{}{
+		users[0].ID.String(): {"is_verified": true, "email_domain": "example.com"},
+		users[2].ID.String(): {"is_verified": true, "email_domain": "example.com"},
+	}
+	// Only the first user's owner relation has been synced
+	synced := map[string][]map[string]string{
+		users[0].ID.String(): {{"subject_type": "user", "subject_id": users[0].ID.String(), "relation": "owner", "object_type": "user", "object_id": users[0].ID.String()}},
+	}
+
+	var (
+		mu       sync.Mutex
+		created  []string
+		relWrite int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/entity":
+			id := r.URL.Query().Get("id")
+			properties, ok := stored[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(map[string]string{"code": "entity_not_found", "message": "not found"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"type": "user", "external_id": id, "properties": properties})
+		case r.Method == http.MethodGet && r.URL.Path == "/relation":
+			assert.Equal(t, "entity-sync", r.URL.Query().Get("source"))
+			relations := synced[r.URL.Query().Get("object_id")]
+			if relations == nil {
+				relations = []map[string]string{}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"relations": relations})
+		case r.Method == http.MethodPost && r.URL.Path == "/entity":
+			var req struct {
+				ExternalID string `json:"external_id"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			created = append(created, req.ExternalID)
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]string{"external_id": req.ExternalID})
+		case r.Method == http.MethodPost && r.URL.Path == "/relation":
+			mu.Lock()
+			relWrite++
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]string{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	supra, err := auth.NewSupraService(server.URL)
+	require.NoError(t, err)
+	entitySync := service.NewEntitySyncService(supra)
+
+	t.Run("dry run records only what differs from the graph", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		userRepo := mocks.NewMockUserRepositoryIface(ctrl)
+		userRepo.EXPECT().FindAfterID(gomock.Any(), uuid.Nil, 100).Return(users, nil)
+
+		plan := service.NewReconciliationPlan()
+		svc := service.NewEntityReconciliationService(userRepo, nil, entitySync, 0, logger)
+		svc.SetDryRun(true)
+		svc.SetPlan(plan)
+
+		require.NoError(t, svc.ReconcileUsers(context.Background()))
+		require.Len(t, plan.Entities, 2, "the user in sync is left out")
+
+		actions := map[string]service.PlanAction{}
+		for _, e := range plan.Entities {
+			actions[e.ID] = e.Action
+		}
+		assert.Equal(t, service.PlanActionCreate, actions[users[1].ID.String()])
+		assert.Equal(t, service.PlanActionUpdate, actions[users[2].ID.String()])
+
+		owners := map[string]service.PlanAction{}
+		for _, rel := range plan.Relations {
+			assert.Equal(t, "owner", rel.Relation)
+			owners[rel.ObjectID] = rel.Action
+		}
+		assert.Equal(t, map[string]service.PlanAction{
+			users[1].ID.String(): service.PlanActionAdd,
+			users[2].ID.String(): service.PlanActionAdd,
+		}, owners, "only missing owner relations are added")
+		assert.Empty(t, created, "dry run must not write entities")
+	})
+
+	t.Run("plan round-trips through a file and applies", func(t *testing.T) {
+		plan := service.NewReconciliationPlan()
+		plan.AddEntity(service.PlannedEntity{Action: service.PlanActionCreate, Type: "user", ID: "u1", Attributes: map[string]interface{}{"is_verified": true}})
+		plan.AddRelation(service.PlannedRelation{Action: service.PlanActionAdd, ObjectType: "organization", ObjectID: "o1", Relation: "owner", SubjectType: "user", SubjectID: "u1"})
+
+		path := t.TempDir() + "/plan.json"
+		require.NoError(t, plan.WriteFile(path))
+
+		loaded, err := service.ReadPlanFile(path)
+		require.NoError(t, err)
+
+		svc := service.NewEntityReconciliationService(nil, nil, entitySync, 0, logger)
+		require.NoError(t, svc.ApplyPlan(context.Background(), loaded))
+
+		assert.Contains(t, created, "u1")
+		assert.Equal(t, 1, relWrite)
+	})
+}
+
+type testTeam struct {
+	ID    uuid.UUID
+	OrgID uuid.UUID
+}
+
+func TestReconcileSources(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("registered sources are reconciled through their mapper", func(t *testing.T) {
+		var synced atomic.Int64
+		entitySync := newTestEntitySync(t, &synced, nil)
+		require.NoError(t, service.RegisterMapper(entitySync.Mappers(), service.EntityMapper[testTeam]{
+			EntityType: "team",
+			ID:         func(team testTeam) string { return team.ID.String() },
+			Relations: func(team testTeam) []service.MappedRelation {
+				return []service.MappedRelation{{Relation: "organization", Subject: auth.Subject{Type: "organization", ID: team.OrgID.String()}}}
+			},
+		}))
+
+		orgID := uuid.New()
+		teams := []testTeam{{ID: uuid.New(), OrgID: orgID}, {ID: uuid.New(), OrgID: orgID}}
+		var filters []repository.EntityFilter
+
+		svc := service.NewEntityReconciliationService(nil, nil, entitySync, 0, logger)
+		require.NoError(t, service.RegisterSource(svc, service.ReconcileSource[testTeam]{
+			Name:       "teams",
+			EntityType: "team",
+			Fetch: func(ctx context.Context, filter repository.EntityFilter, afterID uuid.UUID, limit int) ([]testTeam, error) {
+				filters = append(filters, filter)
+				if afterID != uuid.Nil {
+					return nil, nil
+				}
+				return teams, nil
+			},
+			ID: func(team testTeam) uuid.UUID { return team.ID },
+		}))
+		assert.Equal(t, []string{"users", "organizations", "teams"}, svc.Sources())
+
+		plan := service.NewReconciliationPlan()
+		svc.SetDryRun(true)
+		svc.SetPlan(plan)
+
+		filter := repository.EntityFilter{OrganizationID: orgID}
+		require.NoError(t, svc.Reconcile(context.Background(), "teams", filter))
+		require.NotEmpty(t, filters)
+		assert.Equal(t, filter, filters[0])
+		require.Len(t, plan.Entities, 2)
+		assert.Equal(t, "team", plan.Entities[0].Type)
+		require.Len(t, plan.Relations, 2)
+		assert.Equal(t, orgID.String(), plan.Relations[0].SubjectID)
+
+		assert.ErrorContains(t, svc.Reconcile(context.Background(), "widgets", filter), "unknown entity type")
+		assert.Error(t, service.RegisterSource(svc, service.ReconcileSource[testTeam]{Name: "teams", EntityType: "team"}))
+	})
+
+	t.Run("filtered runs page with the filter and skip checkpoints", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		userRepo := mocks.NewMockUserRepositoryIface(ctrl)
+		users := makeUsers(2)
+		filter := repository.EntityFilter{OrganizationID: uuid.New()}
+
+		userRepo.EXPECT().FindPage(gomock.Any(), filter, uuid.Nil, 100).Return(users, nil)
+
+		var synced atomic.Int64
+		store := newMemoryCheckpointStore()
+		resumeFrom := uuid.New()
+		_ = store.Save(context.Background(), &model.ReconciliationCheckpoint{EntityType: "user", LastID: resumeFrom})
+		store.saves = 0
+
+		svc := service.NewEntityReconciliationService(userRepo, nil, newTestEntitySync(t, &synced, nil), 0, logger)
+		svc.SetCheckpointStore(store)
+
+		require.NoError(t, svc.Reconcile(context.Background(), "users", filter))
+		assert.Equal(t, int64(2), synced.Load())
+		assert.Equal(t, 0, store.saves)
+
+		cp, _ := store.Get(context.Background(), "user")
+		require.NotNil(t, cp, "a filtered run must leave the full run's checkpoint alone")
+		assert.Equal(t, resumeFrom, cp.LastID)
+	})
+}
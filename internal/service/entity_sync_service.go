@@ -14,53 +14,29 @@ import (
 // EntitySyncService handles synchronization between database entities and permission model
 type EntitySyncService struct {
 	supraService *auth.SupraService
-	// Could add caching, error tracking, etc.
+	mappers      *MapperRegistry
 }
 
-// NewEntitySyncService creates a new sync service
+// NewEntitySyncService creates a new sync service with mappers for users and
+// organizations registered. Additional models can be added via Mappers().
 func NewEntitySyncService(supraService *auth.SupraService) *EntitySyncService {
+	mappers := NewMapperRegistry()
+	registerDefaultMappers(mappers)
+
 	return &EntitySyncService{
 		supraService: supraService,
+		mappers:      mappers,
 	}
 }
 
 // SyncUserToPermissions creates or updates a user entity in the permission system
 func (s *EntitySyncService) SyncUserToPermissions(ctx context.Context, user *model.User) error {
-	// Extract relevant attributes from user model
-	attributes := map[string]interface{}{
-		"is_verified":  user.Status == model.StatusActive,
-		"email_domain": extractDomainFromEmail(user.Email),
-	}
-
-	// Create entity in the permission system
-	entityID := user.ID.String()
-
-	// Write attributes to the permission system
-	if err := s.supraService.WriteEntityAttributes(ctx, "user", entityID, attributes); err != nil {
-		return fmt.Errorf("writing user attributes: %w", err)
-	}
-
-	return nil
+	return s.Sync(ctx, user)
 }
 
 // SyncOrganizationToPermissions creates or updates an organization entity in the permission system
 func (s *EntitySyncService) SyncOrganizationToPermissions(ctx context.Context, org *model.Organization) error {
-	// Extract relevant attributes based on your permission schema
-	attributes := map[string]interface{}{
-		// Add relevant attributes dynamically based on your schema
-		// Keeping this generic rather than hardcoding specific attributes
-		"name": org.Name,
-		"type": string(org.OrgType),
-	}
-
-	entityID := org.ID.String()
-
-	// Write attributes to the permission system
-	if err := s.supraService.WriteEntityAttributes(ctx, "organization", entityID, attributes); err != nil {
-		return fmt.Errorf("writing organization attributes: %w", err)
-	}
-
-	return nil
+	return s.Sync(ctx, org)
 }
 
 // EstablishUserOrganizationRelation creates a relationship between a user and organization
@@ -76,6 +52,72 @@ func (s *EntitySyncService) EstablishUserOrganizationRelation(ctx context.Contex
 	)
 }
 
+// EntityAttributes returns the attributes an entity was synced with,
+// reporting false when it hasn't been synced to the permission system
+func (s *EntitySyncService) EntityAttributes(ctx context.Context, entityType, entityID string) (map[string]interface{}, bool, error) {
+	return s.supraService.EntityAttributes(ctx, entityType, entityID)
+}
+
+// SyncedRelations returns the relations entity sync wrote on object
+func (s *EntitySyncService) SyncedRelations(ctx context.Context, object auth.Entity) ([]MappedRelation, error) {
+	relations, err := s.supraService.SyncedRelations(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+
+	synced := make([]MappedRelation, 0, len(relations))
+	for _, rel := range relations {
+		synced = append(synced, MappedRelation{
+			Object:   auth.Entity{Type: rel.ObjectType, ID: rel.ObjectID},
+			Relation: rel.Relation,
+			Subject:  auth.Subject{Type: rel.SubjectType, ID: rel.SubjectID},
+		})
+	}
+	return synced, nil
+}
+
+// WriteEntity writes an entity with pre-computed attributes, as recorded in a reconciliation plan
+func (s *EntitySyncService) WriteEntity(ctx context.Context, entityType, entityID string, attributes map[string]interface{}) error {
+	if err := s.supraService.WriteEntityAttributes(ctx, entityType, entityID, attributes); err != nil {
+		return fmt.Errorf("writing %s attributes: %w", entityType, err)
+	}
+	return nil
+}
+
+// WriteRelation creates an arbitrary relationship between two entities
+func (s *EntitySyncService) WriteRelation(ctx context.Context, object auth.Entity, relation string, subject auth.Subject) error {
+	return s.supraService.WriteRelationship(object, relation, subject)
+}
+
+// WriteRelations applies a batch of relationship creates and deletes in as
+// few requests as the service allows, returning each write's error by index
+func (s *EntitySyncService) WriteRelations(ctx context.Context, writes []auth.RelationshipWrite) ([]error, error) {
+	return s.supraService.WriteRelationships(ctx, writes)
+}
+
+// DeleteRelation removes an arbitrary relationship between two entities
+func (s *EntitySyncService) DeleteRelation(ctx context.Context, object auth.Entity, relation string, subject auth.Subject) error {
+	return s.supraService.DeleteRelationship(object, relation, subject)
+}
+
+// userAttributes maps a user to the attributes stored in the permission system
+func userAttributes(user *model.User) map[string]interface{} {
+	return map[string]interface{}{
+		"is_verified":  user.Status == model.StatusActive,
+		"email_domain": extractDomainFromEmail(user.Email),
+	}
+}
+
+// organizationAttributes maps an organization to the attributes stored in the permission system
+func organizationAttributes(org *model.Organization) map[string]interface{} {
+	return map[string]interface{}{
+		// Add relevant attributes dynamically based on your schema
+		// Keeping this generic rather than hardcoding specific attributes
+		"name": org.Name,
+		"type": string(org.OrgType),
+	}
+}
+
 // Helper to extract domain from email
 func extractDomainFromEmail(email string) string {
 	parts := strings.Split(email, "@")
@@ -86,17 +128,7 @@ func extractDomainFromEmail(email string) string {
 }
 
 // DeleteEntityFromPermissions removes an entity from the permission system
+// with every relation it appears in
 func (s *EntitySyncService) DeleteEntityFromPermissions(ctx context.Context, entityType string, id uuid.UUID) error {
-	// First delete all relationships for this entity
-	err := s.supraService.DeleteRelationship(
-		auth.Entity{Type: entityType, ID: id.String()},
-		"*",                              // Wildcard to match any relation
-		auth.Subject{Type: "*", ID: "*"}, // Wildcard to match any subject
-	)
-	if err != nil {
-		return fmt.Errorf("deleting entity relationships: %w", err)
-	}
-
-	// Then delete the entity itself
 	return s.supraService.DeleteEntity(ctx, entityType, id.String())
 }
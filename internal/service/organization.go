@@ -0,0 +1,33 @@
+// internal/service/organization.go
+package service
+
+import (
+	"context"
+
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/repository"
+	"github.com/google/uuid"
+)
+
+// OrganizationService exposes organization management operations
+type OrganizationService struct {
+	orgRepo *repository.OrganizationRepository
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(orgRepo *repository.OrganizationRepository) *OrganizationService {
+	return &OrganizationService{orgRepo: orgRepo}
+}
+
+// GetOrganization returns a single organization
+func (s *OrganizationService) GetOrganization(ctx context.Context, orgID uuid.UUID) (*model.Organization, error) {
+	return s.orgRepo.FindByID(ctx, orgID)
+}
+
+// ListMembers returns the membership records of an organization
+func (s *OrganizationService) ListMembers(ctx context.Context, orgID uuid.UUID) ([]*model.OrganizationUser, error) {
+	if _, err := s.orgRepo.FindByID(ctx, orgID); err != nil {
+		return nil, err
+	}
+	return s.orgRepo.FindOrganizationUsers(ctx, orgID)
+}
@@ -0,0 +1,138 @@
+// internal/service/reconcile_source.go
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dangerclosesec/supra/internal/repository"
+	"github.com/google/uuid"
+)
+
+// ReconcileSource pages through the application models of one entity type
+// for reconciliation. Sources for users and organizations are registered by
+// NewEntityReconciliationService; RegisterSource adds others, such as
+// projects or teams, without changing the service.
+type ReconcileSource[T any] struct {
+	// Name selects the source with reconcile --entity, e.g. "projects"
+	Name string
+	// EntityType is the graph entity type, which keys the source's
+	// checkpoint, e.g. "project"
+	EntityType string
+	// Fetch returns up to limit models matching filter whose ID is greater
+	// than afterID, in ID order
+	Fetch func(ctx context.Context, filter repository.EntityFilter, afterID uuid.UUID, limit int) ([]T, error)
+	// ID returns a model's ID, the cursor for the next page
+	ID func(obj T) uuid.UUID
+	// Reconcile writes one model to the permission graph; optional. By
+	// default the model is written by the entity mapper registered for T,
+	// or logged and planned in a dry run.
+	Reconcile func(ctx context.Context, obj T) error
+}
+
+// registeredSource is the type-erased form of a ReconcileSource
+type registeredSource struct {
+	name       string
+	entityType string
+	run        func(ctx context.Context, filter repository.EntityFilter) error
+}
+
+// RegisterSource adds the source, or replaces the one registered under its
+// name. Sources are reconciled in the order they were first registered.
+func RegisterSource[T any](s *EntityReconciliationService, src ReconcileSource[T]) error {
+	if src.Name == "" || src.EntityType == "" {
+		return fmt.Errorf("reconcile source name and entity type are required")
+	}
+	if src.Fetch == nil || src.ID == nil {
+		return fmt.Errorf("reconcile source %s requires Fetch and ID functions", src.Name)
+	}
+
+	reconcile := src.Reconcile
+	if reconcile == nil {
+		reconcile = func(ctx context.Context, obj T) error { return s.reconcileMapped(ctx, obj) }
+	}
+
+	rs := &registeredSource{
+		name:       src.Name,
+		entityType: src.EntityType,
+		run: func(ctx context.Context, filter repository.EntityFilter) error {
+			fetch := func(ctx context.Context, afterID uuid.UUID, limit int) ([]T, error) {
+				return src.Fetch(ctx, filter, afterID, limit)
+			}
+			return reconcilePaged(ctx, s, src.EntityType, !filter.IsZero(), fetch, src.ID, reconcile)
+		},
+	}
+
+	s.sourcesMu.Lock()
+	defer s.sourcesMu.Unlock()
+	for i, existing := range s.sources {
+		if existing.name == src.Name {
+			s.sources[i] = rs
+			return nil
+		}
+	}
+	s.sources = append(s.sources, rs)
+	return nil
+}
+
+// Sources returns the names of the registered sources, in the order
+// ReconcileAllEntities reconciles them
+func (s *EntityReconciliationService) Sources() []string {
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+
+	names := make([]string, len(s.sources))
+	for i, src := range s.sources {
+		names[i] = src.name
+	}
+	return names
+}
+
+// Reconcile reconciles the models of the source named name that match
+// filter. Filtered runs neither resume from nor save checkpoints, since
+// their progress says nothing about the rest of the table.
+func (s *EntityReconciliationService) Reconcile(ctx context.Context, name string, filter repository.EntityFilter) error {
+	src, ok := s.source(name)
+	if !ok {
+		return fmt.Errorf("unknown entity type %q (expected one of %v)", name, s.Sources())
+	}
+	return src.run(ctx, filter)
+}
+
+func (s *EntityReconciliationService) source(name string) (*registeredSource, bool) {
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+	for _, src := range s.sources {
+		if src.name == name {
+			return src, true
+		}
+	}
+	return nil, false
+}
+
+// reconcileMapped writes obj through the entity mapper registry, or logs
+// and plans the writes it would make in a dry run
+func (s *EntityReconciliationService) reconcileMapped(ctx context.Context, obj interface{}) error {
+	mapped, err := s.entitySync.Mappers().Map(obj)
+	if err != nil {
+		return err
+	}
+
+	if s.dryRun {
+		s.logger.Info("would sync entity (dry run)",
+			"entity_type", mapped.Type,
+			"entity_id", mapped.ID,
+		)
+		return s.planMapped(ctx, mapped)
+	}
+
+	if err := s.entitySync.writeMapped(ctx, mapped); err != nil {
+		s.logger.Error("failed to sync entity",
+			"entity_type", mapped.Type,
+			"entity_id", mapped.ID,
+			"error", err,
+		)
+		return err
+	}
+	return nil
+}
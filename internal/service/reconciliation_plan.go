@@ -0,0 +1,179 @@
+// internal/service/reconciliation_plan.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+)
+
+// PlanAction describes what applying a plan step will do
+type PlanAction string
+
+const (
+	PlanActionCreate PlanAction = "create"
+	PlanActionUpdate PlanAction = "update"
+	PlanActionAdd    PlanAction = "add"
+	PlanActionRemove PlanAction = "remove"
+)
+
+// PlannedEntity is an entity write recorded during a dry run
+type PlannedEntity struct {
+	Action     PlanAction             `json:"action"`
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// PlannedRelation is a relation change recorded during a dry run
+type PlannedRelation struct {
+	Action      PlanAction `json:"action"`
+	ObjectType  string     `json:"object_type"`
+	ObjectID    string     `json:"object_id"`
+	Relation    string     `json:"relation"`
+	SubjectType string     `json:"subject_type"`
+	SubjectID   string     `json:"subject_id"`
+}
+
+// ReconciliationPlan is a machine-readable list of the changes a reconciliation
+// run would make. It is produced in dry-run mode so it can be reviewed and
+// approved, and later executed unchanged with ApplyPlan.
+type ReconciliationPlan struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Entities    []PlannedEntity   `json:"entities"`
+	Relations   []PlannedRelation `json:"relations"`
+
+	mu sync.Mutex
+}
+
+// NewReconciliationPlan creates an empty plan
+func NewReconciliationPlan() *ReconciliationPlan {
+	return &ReconciliationPlan{
+		GeneratedAt: time.Now().UTC(),
+		Entities:    []PlannedEntity{},
+		Relations:   []PlannedRelation{},
+	}
+}
+
+// AddEntity records an entity write; safe for concurrent use
+func (p *ReconciliationPlan) AddEntity(entity PlannedEntity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Entities = append(p.Entities, entity)
+}
+
+// AddRelation records a relation change; safe for concurrent use
+func (p *ReconciliationPlan) AddRelation(relation PlannedRelation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Relations = append(p.Relations, relation)
+}
+
+// WriteFile writes the plan to path as indented JSON
+func (p *ReconciliationPlan) WriteFile(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding plan: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing plan file: %w", err)
+	}
+
+	return nil
+}
+
+// ReadPlanFile loads a plan previously written by WriteFile
+func ReadPlanFile(path string) (*ReconciliationPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading plan file: %w", err)
+	}
+
+	var plan ReconciliationPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("decoding plan file: %w", err)
+	}
+
+	return &plan, nil
+}
+
+// ApplyPlan executes a previously reviewed plan. Entities are written before
+// relations so that relation endpoints exist. Individual failures are logged
+// and counted; an error is returned if any step failed.
+func (s *EntityReconciliationService) ApplyPlan(ctx context.Context, plan *ReconciliationPlan) error {
+	s.logger.Info("applying reconciliation plan",
+		"generated_at", plan.GeneratedAt,
+		"entities", len(plan.Entities),
+		"relations", len(plan.Relations),
+	)
+
+	var failed int
+
+	for _, entity := range plan.Entities {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		switch entity.Action {
+		case PlanActionCreate, PlanActionUpdate:
+			if err := s.entitySync.WriteEntity(ctx, entity.Type, entity.ID, entity.Attributes); err != nil {
+				s.logger.Error("failed to apply entity change",
+					"action", entity.Action,
+					"entity_type", entity.Type,
+					"entity_id", entity.ID,
+					"error", err,
+				)
+				failed++
+			}
+		default:
+			s.logger.Error("unsupported entity action in plan", "action", entity.Action)
+			failed++
+		}
+	}
+
+	for _, rel := range plan.Relations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		object := auth.Entity{Type: rel.ObjectType, ID: rel.ObjectID}
+		subject := auth.Subject{Type: rel.SubjectType, ID: rel.SubjectID}
+
+		var err error
+		switch rel.Action {
+		case PlanActionAdd:
+			err = s.entitySync.WriteRelation(ctx, object, rel.Relation, subject)
+		case PlanActionRemove:
+			err = s.entitySync.DeleteRelation(ctx, object, rel.Relation, subject)
+		default:
+			err = fmt.Errorf("unsupported relation action %q", rel.Action)
+		}
+
+		if err != nil {
+			s.logger.Error("failed to apply relation change",
+				"action", rel.Action,
+				"object", rel.ObjectType+":"+rel.ObjectID,
+				"relation", rel.Relation,
+				"subject", rel.SubjectType+":"+rel.SubjectID,
+				"error", err,
+			)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d plan steps failed", failed)
+	}
+
+	s.logger.Info("reconciliation plan applied")
+	return nil
+}
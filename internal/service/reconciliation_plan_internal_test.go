@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRelations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/relation", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"relations": []map[string]string{
+			{"subject_type": "user", "subject_id": "alice", "relation": "owner", "object_type": "organization", "object_id": "acme"},
+			{"subject_type": "user", "subject_id": "carol", "relation": "member", "object_type": "organization", "object_id": "acme"},
+		}})
+	}))
+	defer server.Close()
+
+	supra, err := auth.NewSupraService(server.URL)
+	require.NoError(t, err)
+	svc := NewEntityReconciliationService(nil, nil, NewEntitySyncService(supra), 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	acme := auth.Entity{Type: "organization", ID: "acme"}
+	desired := []MappedRelation{
+		{Relation: "owner", Subject: auth.Subject{Type: "user", ID: "alice"}},
+		{Relation: "member", Subject: auth.Subject{Type: "user", ID: "bob"}},
+	}
+
+	t.Run("adds missing relations and removes stale ones", func(t *testing.T) {
+		plan := NewReconciliationPlan()
+		svc.SetPlan(plan)
+
+		require.NoError(t, svc.planRelations(context.Background(), acme, desired, true))
+		assert.Equal(t, []PlannedRelation{
+			plannedRelation(PlanActionAdd, acme, "member", auth.Subject{Type: "user", ID: "bob"}),
+			plannedRelation(PlanActionRemove, acme, "member", auth.Subject{Type: "user", ID: "carol"}),
+		}, plan.Relations)
+	})
+
+	t.Run("keeps relations it doesn't own", func(t *testing.T) {
+		plan := NewReconciliationPlan()
+		svc.SetPlan(plan)
+
+		require.NoError(t, svc.planRelations(context.Background(), acme, desired, false))
+		assert.Equal(t, []PlannedRelation{
+			plannedRelation(PlanActionAdd, acme, "member", auth.Subject{Type: "user", ID: "bob"}),
+		}, plan.Relations)
+	})
+}
+
+func TestSameAttributes(t *testing.T) {
+	same, err := sameAttributes(map[string]interface{}{"count": float64(2), "name": "acme"}, map[string]interface{}{"count": 2, "name": "acme"})
+	require.NoError(t, err)
+	assert.True(t, same, "attributes are compared as stored")
+
+	same, err = sameAttributes(map[string]interface{}{"name": "acme"}, map[string]interface{}{"name": "globex"})
+	require.NoError(t, err)
+	assert.False(t, same)
+
+	same, err = sameAttributes(nil, map[string]interface{}{})
+	require.NoError(t, err)
+	assert.True(t, same)
+}
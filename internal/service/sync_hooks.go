@@ -0,0 +1,116 @@
+// internal/service/sync_hooks.go
+package service
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// SyncPlugin is a GORM plugin that enqueues permission-graph syncs whenever a
+// model with a registered mapper is created, updated or deleted. It replaces
+// manual SyncUserToPermissions-style calls in individual code paths.
+//
+// Callbacks run before the surrounding transaction commits, so a rolled back
+// write may still be synced; background reconciliation repairs such drift.
+type SyncPlugin struct {
+	queue  *SyncQueue
+	logger *slog.Logger
+}
+
+// NewSyncPlugin creates a plugin that feeds the given queue
+func NewSyncPlugin(queue *SyncQueue, logger *slog.Logger) *SyncPlugin {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SyncPlugin{queue: queue, logger: logger}
+}
+
+// Name implements gorm.Plugin
+func (p *SyncPlugin) Name() string {
+	return "supra:entity_sync"
+}
+
+// Initialize implements gorm.Plugin by registering after-write callbacks
+func (p *SyncPlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:create").Register("supra:sync_create", p.afterSave); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("supra:sync_update", p.afterSave); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("supra:sync_delete", p.afterDelete)
+}
+
+func (p *SyncPlugin) afterSave(tx *gorm.DB) {
+	p.enqueue(tx, false)
+}
+
+func (p *SyncPlugin) afterDelete(tx *gorm.DB) {
+	p.enqueue(tx, true)
+}
+
+// enqueue walks the statement's destination (a single model or a slice of
+// models) and queues every value that has a mapper and a usable ID. Deletes by
+// condition only, e.g. Delete(&User{}, "id = ?", id), carry no ID and are left
+// to reconciliation.
+func (p *SyncPlugin) enqueue(tx *gorm.DB, remove bool) {
+	if tx.Error != nil || tx.Statement == nil || tx.RowsAffected == 0 {
+		return
+	}
+
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for _, obj := range statementModels(tx.Statement.ReflectValue) {
+		if !p.queue.sync.mappers.Has(obj) {
+			continue
+		}
+
+		var err error
+		if remove {
+			err = p.queue.EnqueueRemove(ctx, obj)
+		} else {
+			err = p.queue.Enqueue(ctx, obj)
+		}
+		if err != nil {
+			p.logger.Debug("skipping entity sync",
+				"table", tx.Statement.Table,
+				"error", err,
+			)
+		}
+	}
+}
+
+// statementModels flattens a statement destination into addressable models
+func statementModels(v reflect.Value) []interface{} {
+	for v.IsValid() && v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		models := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			models = append(models, statementModels(v.Index(i))...)
+		}
+		return models
+	case reflect.Struct:
+		if v.CanAddr() {
+			return []interface{}{v.Addr().Interface()}
+		}
+		return []interface{}{v.Interface()}
+	default:
+		return nil
+	}
+}
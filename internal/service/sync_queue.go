@@ -0,0 +1,321 @@
+// internal/service/sync_queue.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+)
+
+// ErrSyncQueueClosed is returned when enqueueing after the queue has stopped
+var ErrSyncQueueClosed = errors.New("sync queue is closed")
+
+// SyncQueueConfig controls batching and backpressure of a SyncQueue
+type SyncQueueConfig struct {
+	// Capacity is the maximum number of distinct entities waiting to be written.
+	// Enqueue blocks once it is reached.
+	Capacity int
+	// BatchSize is the maximum number of entities written per flush
+	BatchSize int
+	// FlushInterval is the debounce window: repeated updates to the same entity
+	// within this window collapse into a single write
+	FlushInterval time.Duration
+}
+
+// DefaultSyncQueueConfig returns sensible defaults for bursty workloads
+func DefaultSyncQueueConfig() SyncQueueConfig {
+	return SyncQueueConfig{
+		Capacity:      10000,
+		BatchSize:     100,
+		FlushInterval: 500 * time.Millisecond,
+	}
+}
+
+// syncItem is a pending entity write or removal, snapshotted when it was enqueued
+type syncItem struct {
+	mapped *MappedEntity
+	remove bool
+}
+
+func (i *syncItem) key() string {
+	if i.mapped.RelationsOnly {
+		return "relations:" + i.mapped.Type + ":" + i.mapped.ID
+	}
+	return i.mapped.Type + ":" + i.mapped.ID
+}
+
+// SyncQueue buffers entity syncs so bursts of changes are written in batches.
+// Updates to an entity that is already pending replace the earlier snapshot
+// instead of producing another write.
+type SyncQueue struct {
+	sync   *EntitySyncService
+	config SyncQueueConfig
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]*syncItem
+	order   []string
+	closed  bool
+
+	slots   chan struct{} // one token per pending entity, bounds the queue
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// NewSyncQueue creates a queue that writes through the given sync service
+func NewSyncQueue(sync *EntitySyncService, config SyncQueueConfig, logger *slog.Logger) *SyncQueue {
+	defaults := DefaultSyncQueueConfig()
+	if config.Capacity <= 0 {
+		config.Capacity = defaults.Capacity
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaults.FlushInterval
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &SyncQueue{
+		sync:    sync,
+		config:  config,
+		logger:  logger,
+		pending: make(map[string]*syncItem),
+		slots:   make(chan struct{}, config.Capacity),
+		flushCh: make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+}
+
+// Start begins flushing the queue in the background
+func (q *SyncQueue) Start() {
+	go func() {
+		defer close(q.doneCh)
+
+		ticker := time.NewTicker(q.config.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				q.flushAll(context.Background())
+			case <-q.flushCh:
+				q.flushAll(context.Background())
+			case <-q.stopCh:
+				q.flushAll(context.Background())
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops accepting new work and writes everything still pending
+func (q *SyncQueue) Stop() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stopCh)
+	<-q.doneCh
+}
+
+// Enqueue schedules obj to be synced. It blocks while the queue is full and
+// returns ctx.Err() if the context ends first.
+func (q *SyncQueue) Enqueue(ctx context.Context, obj interface{}) error {
+	return q.enqueue(ctx, obj, false)
+}
+
+// EnqueueRemove schedules obj to be removed from the permission system. A
+// pending write for the same entity is superseded.
+func (q *SyncQueue) EnqueueRemove(ctx context.Context, obj interface{}) error {
+	return q.enqueue(ctx, obj, true)
+}
+
+func (q *SyncQueue) enqueue(ctx context.Context, obj interface{}, remove bool) error {
+	mapped, err := q.sync.mappers.Map(obj)
+	if err != nil {
+		return err
+	}
+	item := &syncItem{mapped: mapped, remove: remove}
+
+	// Debounce: replace an entity that is already waiting without taking a slot
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrSyncQueueClosed
+	}
+	if _, ok := q.pending[item.key()]; ok {
+		q.pending[item.key()] = item
+		q.mu.Unlock()
+		return nil
+	}
+	q.mu.Unlock()
+
+	// Backpressure: wait for room in the queue
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		<-q.slots
+		return ErrSyncQueueClosed
+	}
+	if _, ok := q.pending[item.key()]; ok {
+		// Another caller queued the same entity while we waited
+		q.pending[item.key()] = item
+		q.mu.Unlock()
+		<-q.slots
+		return nil
+	}
+	q.pending[item.key()] = item
+	q.order = append(q.order, item.key())
+	full := len(q.order) >= q.config.BatchSize
+	q.mu.Unlock()
+
+	if full {
+		select {
+		case q.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of entities waiting to be written
+func (q *SyncQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.order)
+}
+
+// Flush synchronously writes everything currently pending
+func (q *SyncQueue) Flush(ctx context.Context) {
+	q.flushAll(ctx)
+}
+
+// flushAll drains the queue one batch at a time
+func (q *SyncQueue) flushAll(ctx context.Context) {
+	for {
+		batch := q.takeBatch()
+		if len(batch) == 0 {
+			return
+		}
+		q.writeBatch(ctx, batch)
+	}
+}
+
+// takeBatch removes up to BatchSize items from the head of the queue
+func (q *SyncQueue) takeBatch() []*syncItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.order)
+	if n > q.config.BatchSize {
+		n = q.config.BatchSize
+	}
+
+	batch := make([]*syncItem, 0, n)
+	for _, key := range q.order[:n] {
+		batch = append(batch, q.pending[key])
+		delete(q.pending, key)
+	}
+	q.order = q.order[n:]
+
+	return batch
+}
+
+// writeBatch writes entities first so that relation endpoints exist, then
+// applies removals and sends the batch's relation writes in one bulk
+// request. Failures are logged per item and do not affect the rest.
+func (q *SyncQueue) writeBatch(ctx context.Context, batch []*syncItem) {
+	defer func() {
+		for range batch {
+			<-q.slots
+		}
+	}()
+
+	var failed int
+	for _, item := range batch {
+		if item.remove || item.mapped.RelationsOnly {
+			continue
+		}
+		if err := q.sync.WriteEntity(ctx, item.mapped.Type, item.mapped.ID, item.mapped.Attributes); err != nil {
+			q.logger.Error("failed to sync entity",
+				"entity_type", item.mapped.Type,
+				"entity_id", item.mapped.ID,
+				"error", err,
+			)
+			failed++
+		}
+	}
+
+	// Relation-only models are removed by deleting their relations, which go
+	// in the bulk request with the creates; entities are deleted one by one
+	var writes []auth.RelationshipWrite
+	for _, item := range batch {
+		if item.remove && !item.mapped.RelationsOnly {
+			if err := q.sync.removeMapped(ctx, item.mapped); err != nil {
+				q.logger.Error("failed to remove entity",
+					"entity_type", item.mapped.Type,
+					"entity_id", item.mapped.ID,
+					"error", err,
+				)
+				failed++
+			}
+			continue
+		}
+
+		for _, rel := range item.mapped.Relations {
+			writes = append(writes, auth.RelationshipWrite{
+				Delete:   item.remove,
+				Object:   rel.Object,
+				Relation: rel.Relation,
+				Subject:  rel.Subject,
+			})
+		}
+	}
+
+	if len(writes) > 0 {
+		errs, err := q.sync.WriteRelations(ctx, writes)
+		if err != nil {
+			q.logger.Error("failed to sync relations", "count", len(writes), "error", err)
+			failed += len(writes)
+		}
+		for i, err := range errs {
+			if err == nil {
+				continue
+			}
+			message := "failed to sync relation"
+			if writes[i].Delete {
+				message = "failed to remove relation"
+			}
+			q.logger.Error(message,
+				"object", fmt.Sprintf("%s:%s", writes[i].Object.Type, writes[i].Object.ID),
+				"relation", writes[i].Relation,
+				"subject", fmt.Sprintf("%s:%s", writes[i].Subject.Type, writes[i].Subject.ID),
+				"error", err,
+			)
+			failed++
+		}
+	}
+
+	q.logger.Debug("flushed sync batch", "size", len(batch), "failed", failed)
+}
@@ -0,0 +1,187 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relationBatch is the body of a /relations/batch request
+type relationBatch struct {
+	Operations []struct {
+		Op          string `json:"op"`
+		SubjectType string `json:"subject_type"`
+		SubjectID   string `json:"subject_id"`
+		Relation    string `json:"relation"`
+		ObjectType  string `json:"object_type"`
+		ObjectID    string `json:"object_id"`
+	} `json:"operations"`
+	ContinueOnError bool `json:"continue_on_error"`
+}
+
+// newRecordingEntitySync returns an entity sync service whose permission
+// service records entity writes and relation batches. exists reports the
+// subjects whose relations already exist.
+func newRecordingEntitySync(t *testing.T, exists ...string) (*service.EntitySyncService, func() []map[string]interface{}, func() []relationBatch) {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		writes  []map[string]interface{}
+		batches []relationBatch
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/relations/batch" {
+			var batch relationBatch
+			_ = json.NewDecoder(r.Body).Decode(&batch)
+			mu.Lock()
+			batches = append(batches, batch)
+			mu.Unlock()
+
+			results := make([]map[string]interface{}, len(batch.Operations))
+			for i, op := range batch.Operations {
+				results[i] = map[string]interface{}{"op": op.Op, "relation": op}
+				if slices.Contains(exists, op.SubjectID) {
+					results[i] = map[string]interface{}{"op": op.Op, "code": "relation_exists", "error": "relation already exists"}
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+			return
+		}
+
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path == "/entity" {
+			mu.Lock()
+			writes = append(writes, body)
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{})
+	}))
+	t.Cleanup(server.Close)
+
+	supra, err := auth.NewSupraService(server.URL)
+	require.NoError(t, err)
+
+	return service.NewEntitySyncService(supra), func() []map[string]interface{} {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]map[string]interface{}(nil), writes...)
+		}, func() []relationBatch {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]relationBatch(nil), batches...)
+		}
+}
+
+func TestSyncQueue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("debounces repeated updates to the same entity", func(t *testing.T) {
+		entitySync, writes, _ := newRecordingEntitySync(t)
+		queue := service.NewSyncQueue(entitySync, service.SyncQueueConfig{FlushInterval: time.Hour}, logger)
+
+		user := &model.User{ID: uuid.New(), Email: "a@example.com", Status: model.StatusPending}
+		require.NoError(t, queue.Enqueue(context.Background(), user))
+
+		updated := *user
+		updated.Status = model.StatusActive
+		require.NoError(t, queue.Enqueue(context.Background(), &updated))
+		assert.Equal(t, 1, queue.Len())
+
+		queue.Flush(context.Background())
+
+		got := writes()
+		require.Len(t, got, 1)
+		props := got[0]["properties"].(map[string]interface{})
+		assert.Equal(t, true, props["is_verified"])
+	})
+
+	t.Run("blocks when full until the context ends", func(t *testing.T) {
+		entitySync, _, _ := newRecordingEntitySync(t)
+		queue := service.NewSyncQueue(entitySync, service.SyncQueueConfig{Capacity: 1, FlushInterval: time.Hour}, logger)
+
+		require.NoError(t, queue.Enqueue(context.Background(), &model.User{ID: uuid.New()}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := queue.Enqueue(ctx, &model.User{ID: uuid.New()})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("stop flushes pending writes", func(t *testing.T) {
+		entitySync, writes, _ := newRecordingEntitySync(t)
+		queue := service.NewSyncQueue(entitySync, service.SyncQueueConfig{BatchSize: 2, FlushInterval: time.Hour}, logger)
+		queue.Start()
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, queue.Enqueue(context.Background(), &model.User{ID: uuid.New()}))
+		}
+		queue.Stop()
+
+		assert.Len(t, writes(), 3)
+		assert.ErrorIs(t, queue.Enqueue(context.Background(), &model.User{ID: uuid.New()}), service.ErrSyncQueueClosed)
+	})
+
+	t.Run("writes a batch's relations in one request", func(t *testing.T) {
+		entitySync, writes, batches := newRecordingEntitySync(t)
+		queue := service.NewSyncQueue(entitySync, service.SyncQueueConfig{FlushInterval: time.Hour}, logger)
+
+		users := []*model.User{{ID: uuid.New()}, {ID: uuid.New()}}
+		for _, user := range users {
+			require.NoError(t, queue.Enqueue(context.Background(), user))
+		}
+		membership := &model.OrganizationUser{ID: uuid.New(), OrganizationID: uuid.New(), UserID: users[0].ID, Role: "member"}
+		require.NoError(t, queue.EnqueueRemove(context.Background(), membership))
+
+		queue.Flush(context.Background())
+
+		assert.Len(t, writes(), 2)
+		got := batches()
+		require.Len(t, got, 1)
+		assert.True(t, got[0].ContinueOnError)
+		require.Len(t, got[0].Operations, 3)
+		for i, user := range users {
+			assert.Equal(t, "create", got[0].Operations[i].Op)
+			assert.Equal(t, user.ID.String(), got[0].Operations[i].ObjectID)
+			assert.Equal(t, "owner", got[0].Operations[i].Relation)
+		}
+		removal := got[0].Operations[2]
+		assert.Equal(t, "delete", removal.Op)
+		assert.Equal(t, membership.OrganizationID.String(), removal.ObjectID)
+		assert.Equal(t, "member", removal.Relation)
+		assert.Equal(t, users[0].ID.String(), removal.SubjectID)
+	})
+
+	t.Run("relations that already exist are not failures", func(t *testing.T) {
+		user := &model.User{ID: uuid.New()}
+		entitySync, _, batches := newRecordingEntitySync(t, user.ID.String())
+		var logs bytes.Buffer
+		queue := service.NewSyncQueue(entitySync, service.SyncQueueConfig{FlushInterval: time.Hour},
+			slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+		require.NoError(t, queue.Enqueue(context.Background(), user))
+		queue.Flush(context.Background())
+
+		require.Len(t, batches(), 1)
+		assert.NotContains(t, logs.String(), "failed to sync relation")
+		assert.Contains(t, logs.String(), "failed=0")
+	})
+}
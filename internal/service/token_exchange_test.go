@@ -0,0 +1,70 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/domain"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOrgs map[uuid.UUID]*model.Organization
+
+func (f fakeOrgs) FindByID(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	if org, ok := f[id]; ok {
+		return org, nil
+	}
+	return nil, domain.ErrOrganizationNotFound
+}
+
+// fakeRelations holds "user:relation:org" triples
+type fakeRelations map[string]bool
+
+func (f fakeRelations) TestRelationship(ctx context.Context, subject auth.Subject, relation string, object auth.Entity) (bool, error) {
+	return f[subject.ID+":"+relation+":"+object.ID], nil
+}
+
+func TestTokenExchange(t *testing.T) {
+	tokens := auth.NewTokenManager("jwt-secret", time.Hour)
+	orgID := uuid.New()
+	orgs := fakeOrgs{orgID: {ID: orgID, Name: "Acme"}}
+	relations := fakeRelations{
+		"u1:admin:" + orgID.String():  true,
+		"u1:member:" + orgID.String(): true,
+	}
+	svc := service.NewTokenExchangeService(orgs, relations, tokens, 15*time.Minute)
+	user := &auth.Claims{UserID: "u1", Email: "u1@example.com"}
+
+	t.Run("issues a token for the organization with the user's roles", func(t *testing.T) {
+		out, err := svc.Exchange(context.Background(), user, service.TokenExchangeInput{OrganizationID: orgID.String()})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"admin", "member"}, out.Roles)
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), out.ExpiresAt, 5*time.Second)
+
+		claims, err := tokens.Validate(out.Token)
+		require.NoError(t, err)
+		assert.Equal(t, orgID.String(), claims.Organization())
+		assert.Equal(t, "u1", claims.UserID)
+		assert.Equal(t, []string{"admin", "member"}, claims.Roles)
+
+		// Org-scoped tokens can't be exchanged again
+		_, err = svc.Exchange(context.Background(), claims, service.TokenExchangeInput{OrganizationID: orgID.String()})
+		assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	})
+
+	t.Run("refuses users without a role", func(t *testing.T) {
+		_, err := svc.Exchange(context.Background(), &auth.Claims{UserID: "u2"}, service.TokenExchangeInput{OrganizationID: orgID.String()})
+		assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	})
+
+	t.Run("refuses unknown organizations", func(t *testing.T) {
+		_, err := svc.Exchange(context.Background(), user, service.TokenExchangeInput{OrganizationID: uuid.NewString()})
+		assert.ErrorIs(t, err, domain.ErrOrganizationNotFound)
+	})
+}
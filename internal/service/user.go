@@ -27,12 +27,14 @@ type UserService struct {
 	orgRepo        *repository.OrganizationRepository
 	passwordHasher *auth.PasswordHasher
 	tokenManager   *auth.TokenManager
-	emailService   *email.Service
-	factorService  *UserFactorService
-	cacheService   *CacheService
-	entitySync     *EntitySyncService
-	config         *config.Config
-	validate       *validator.Validate
+	// verificationTokens signs the links that verify email addresses
+	verificationTokens  *auth.VerificationTokenManager
+	verificationMetrics *VerificationMetrics
+	emailService        *email.Service
+	factorService       *UserFactorService
+	cacheService        *CacheService
+	config              *config.Config
+	validate            *validator.Validate
 }
 
 func NewUserService(
@@ -41,24 +43,25 @@ func NewUserService(
 	orgRepo *repository.OrganizationRepository,
 	passwordHasher *auth.PasswordHasher,
 	tokenManager *auth.TokenManager,
+	verificationTokens *auth.VerificationTokenManager,
 	emailService *email.Service,
 	factorService *UserFactorService,
 	cacheService *CacheService,
-	entitySync *EntitySyncService,
 	config *config.Config,
 ) *UserService {
 	return &UserService{
-		repo:           repo,
-		factorRepo:     factorRepo,
-		orgRepo:        orgRepo,
-		passwordHasher: passwordHasher,
-		tokenManager:   tokenManager,
-		emailService:   emailService,
-		factorService:  factorService,
-		cacheService:   cacheService,
-		entitySync:     entitySync,
-		config:         config,
-		validate:       validator.New(),
+		repo:                repo,
+		factorRepo:          factorRepo,
+		orgRepo:             orgRepo,
+		passwordHasher:      passwordHasher,
+		tokenManager:        tokenManager,
+		verificationTokens:  verificationTokens,
+		verificationMetrics: NewVerificationMetrics(),
+		emailService:        emailService,
+		factorService:       factorService,
+		cacheService:        cacheService,
+		config:              config,
+		validate:            validator.New(),
 	}
 }
 
@@ -121,23 +124,35 @@ func (s *UserService) GetActiveFactors(ctx context.Context, userID uuid.UUID) ([
 	return s.factorRepo.FindActiveByUser(ctx, userID)
 }
 
-// GenerateAndStoreNonce generates a new nonce and stores it in the cache
+// GenerateNonce generates a new nonce and stores it in the cache, where it
+// is valid for one use until the cache's TTL passes
 func (s *UserService) GenerateNonce(ctx context.Context) (string, error) {
-	nonce := make([]byte, 32)
-	if _, err := rand.Read(nonce); err != nil {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", fmt.Errorf("generating random nonce: %w", err)
 	}
 
-	return hex.EncodeToString(nonce), nil
+	nonce := hex.EncodeToString(b)
+	if err := s.cacheService.StoreNonce(ctx, nonce); err != nil {
+		return "", fmt.Errorf("storing nonce: %w", err)
+	}
+	return nonce, nil
 }
 
+// ValidateNonce checks that nonce was generated by GenerateNonce and uses it
+// up, so a replayed request carrying it is rejected with
+// domain.ErrInvalidNonce
 func (s *UserService) ValidateNonce(ctx context.Context, nonce string) error {
-	err := s.cacheService.Get(ctx, nonce, nil)
+	if nonce == "" {
+		return domain.ErrInvalidNonce
+	}
+
+	found, err := s.cacheService.CheckNonce(ctx, nonce)
 	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			return domain.ErrInvalidNonce
-		}
-		return fmt.Errorf("getting nonce: %w", err)
+		return fmt.Errorf("checking nonce: %w", err)
+	}
+	if !found {
+		return domain.ErrInvalidNonce
 	}
 	return nil
 }
@@ -182,13 +197,17 @@ func (s *UserService) Signup(ctx context.Context, input SignupInput) (*SignupOut
 		return nil, fmt.Errorf("creating user: %w", err)
 	}
 
-	// Create verification factor
-	verificationCode := generateVerificationCode()
+	// Create verification factor, holding the nonce of the link's token
+	verification, err := s.verificationTokens.Generate(user.ID)
+	if err != nil {
+		return nil, err
+	}
 	verificationFactor := &model.UserFactor{
 		UserID:     user.ID,
 		FactorType: model.FactorVerificationCode,
-		Material:   verificationCode,
+		Material:   verification.Nonce,
 		IsActive:   true,
+		ExpiresAt:  &verification.ExpiresAt,
 	}
 
 	if err := s.factorRepo.Create(ctx, verificationFactor); err != nil {
@@ -233,37 +252,12 @@ func (s *UserService) Signup(ctx context.Context, input SignupInput) (*SignupOut
 	if err := s.orgRepo.CreateOrganizationUser(ctx, orgUser); err != nil {
 		return nil, fmt.Errorf("creating organization user: %w", err)
 	}
-	
-	// Sync entities and relationships to permission system
-	if s.entitySync != nil {
-		// Sync user entity and attributes
-		if err := s.entitySync.SyncUserToPermissions(ctx, user); err != nil {
-			return nil, fmt.Errorf("syncing user to permission system: %w", err)
-		}
-		
-		// Sync organization entity and attributes
-		if err := s.entitySync.SyncOrganizationToPermissions(ctx, org); err != nil {
-			return nil, fmt.Errorf("syncing organization to permission system: %w", err)
-		}
-		
-		// Establish ownership relationship
-		if err := s.entitySync.EstablishUserOrganizationRelation(ctx, org.ID, user.ID, "owner"); err != nil {
-			return nil, fmt.Errorf("establishing owner relationship: %w", err)
-		}
-	}
-
-	// Generate verification URL
-	verificationLink := fmt.Sprintf(
-		"%s/api/auth/signup/verify?code=%s&user=%s",
-		s.config.BaseURL,
-		verificationCode,
-		user.ID.String(),
-	)
 
 	// Send verification email
-	if err := mailer.SendVerificationEmail(s.emailService, user.Email, user.FirstName, verificationLink); err != nil {
+	if err := mailer.SendVerificationEmail(s.emailService, user.Email, user.FirstName, s.verificationLink(verification)); err != nil {
 		return nil, fmt.Errorf("sending verification email: %w", err)
 	}
+	s.verificationMetrics.linkSent(verificationSentSignup)
 
 	// Generate JWT token
 	token, err := s.tokenManager.Generate(user.ID.String(), user.Email)
@@ -281,81 +275,6 @@ func (s *UserService) Signup(ctx context.Context, input SignupInput) (*SignupOut
 	}, nil
 }
 
-type VerifyInput struct {
-	UserID string `json:"user_id"`
-	Code   string `json:"code"`
-}
-
-// VerifyEmail handles email verification
-func (s *UserService) VerifyEmail(ctx context.Context, input VerifyInput) error {
-	userID, err := uuid.Parse(input.UserID)
-	if err != nil {
-		return fmt.Errorf("%w: invalid user ID", domain.ErrInvalidInput)
-	}
-
-	// Start transaction
-	tx, err := s.repo.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("starting transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Find user
-	user, err := s.repo.FindByID(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	if user.Status == model.StatusActive {
-		return domain.ErrAlreadyVerified
-	}
-
-	// Find verification factor
-	factor, err := s.factorRepo.FindByUserAndType(ctx, userID, model.FactorVerificationCode)
-	if err != nil {
-		return fmt.Errorf("finding verification factor: %w", err)
-	}
-
-	if !factor.IsActive {
-		return domain.ErrVerificationExpired
-	}
-
-	if factor.Material != input.Code {
-		return domain.ErrInvalidVerificationCode
-	}
-
-	// Update user status
-	user.Status = model.StatusActive
-	if err := s.repo.Update(ctx, user); err != nil {
-		return fmt.Errorf("updating user: %w", err)
-	}
-	
-	// Sync updated user status to permission system
-	if s.entitySync != nil {
-		if err := s.entitySync.SyncUserToPermissions(ctx, user); err != nil {
-			// Log but don't fail the verification if sync fails
-			// We can recover from this through background reconciliation
-			fmt.Printf("Warning: Failed to sync verified user status to permission system: %v\n", err)
-		}
-	}
-
-	// Update factor
-	now := time.Now()
-	factor.VerifiedAt = &now
-	factor.LastUsedAt = &now
-	factor.IsActive = false
-
-	if err := s.factorRepo.Update(ctx, factor); err != nil {
-		return fmt.Errorf("updating factor: %w", err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("committing transaction: %w", err)
-	}
-
-	return nil
-}
-
 // Authenticate verifies user credentials and returns a token
 func (s *UserService) Authenticate(ctx context.Context, email, password string) (*SignupOutput, error) {
 	// Find user by email
@@ -502,67 +421,3 @@ func (s *UserService) validateSignupInput(input SignupInput) error {
 
 	return nil
 }
-
-// generateVerificationCode creates a secure random verification code
-func generateVerificationCode() string {
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		panic(err) // This should never happen
-	}
-	return hex.EncodeToString(bytes)
-}
-
-// ResendVerification resends the verification email
-func (s *UserService) ResendVerification(ctx context.Context, userID uuid.UUID) error {
-	user, err := s.repo.FindByID(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	if user.Status == model.StatusActive {
-		return domain.ErrAlreadyVerified
-	}
-
-	// Generate new verification code
-	verificationCode := generateVerificationCode()
-
-	// Create or update verification factor
-	factor, err := s.factorRepo.FindByUserAndType(ctx, userID, model.FactorVerificationCode)
-	if err != nil && !errors.Is(err, domain.ErrFactorNotFound) {
-		return err
-	}
-
-	if factor == nil {
-		factor = &model.UserFactor{
-			UserID:     userID,
-			FactorType: model.FactorVerificationCode,
-			Material:   verificationCode,
-			IsActive:   true,
-		}
-		if err := s.factorRepo.Create(ctx, factor); err != nil {
-			return fmt.Errorf("creating verification factor: %w", err)
-		}
-	} else {
-		factor.Material = verificationCode
-		factor.IsActive = true
-		factor.VerifiedAt = nil
-		if err := s.factorRepo.Update(ctx, factor); err != nil {
-			return fmt.Errorf("updating verification factor: %w", err)
-		}
-	}
-
-	// Generate verification URL
-	verificationLink := fmt.Sprintf(
-		"%s/api/verify?code=%s&user=%s",
-		s.config.BaseURL,
-		verificationCode,
-		user.ID.String(),
-	)
-
-	// Send verification email
-	if err := mailer.SendVerificationEmail(s.emailService, user.Email, user.FirstName, verificationLink); err != nil {
-		return fmt.Errorf("sending verification email: %w", err)
-	}
-
-	return nil
-}
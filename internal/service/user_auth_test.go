@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/domain"
 	"github.com/dangerclosesec/supra/internal/mocks"
 	"github.com/dangerclosesec/supra/internal/model"
 	"github.com/dangerclosesec/supra/internal/service"
@@ -91,13 +92,13 @@ func TestUserLogin(t *testing.T) {
 			hasher,
 			auth.NewTokenManager("test_secret", time.Hour),
 			nil,
+			nil,
 			service.NewUserFactorService(factorRepo),
 			service.NewCacheService(service.CacheConfig{
 				TTL:         5 * time.Minute,
 				CleanupFreq: time.Minute,
 			}),
 			nil,
-			nil,
 		)
 
 		// Phase 1: Password verification
@@ -123,3 +124,32 @@ func TestUserLogin(t *testing.T) {
 		assert.Equal(t, testUser.ID, finalResult.User.ID)
 	})
 }
+
+func TestNonce(t *testing.T) {
+	cacheService := service.NewCacheService(service.CacheConfig{
+		TTL:         5 * time.Minute,
+		CleanupFreq: time.Minute,
+	})
+	svc := service.NewUserService(nil, nil, nil, nil, nil, nil, nil, nil, cacheService, nil)
+	ctx := context.Background()
+
+	nonce, err := svc.GenerateNonce(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, nonce, 64)
+
+	assert.NoError(t, svc.ValidateNonce(ctx, nonce))
+	assert.ErrorIs(t, svc.ValidateNonce(ctx, nonce), domain.ErrInvalidNonce, "a nonce can only be used once")
+	assert.ErrorIs(t, svc.ValidateNonce(ctx, "unknown"), domain.ErrInvalidNonce)
+	assert.ErrorIs(t, svc.ValidateNonce(ctx, ""), domain.ErrInvalidNonce)
+
+	t.Run("rejects other cache keys", func(t *testing.T) {
+		key := "mfa_nonce:" + uuid.New().String()
+		assert.NoError(t, cacheService.Set(ctx, key, "stored"))
+
+		assert.ErrorIs(t, svc.ValidateNonce(ctx, key), domain.ErrInvalidNonce)
+
+		var stored string
+		assert.NoError(t, cacheService.Get(ctx, key, &stored), "the entry isn't consumed")
+		assert.Equal(t, "stored", stored)
+	})
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/domain"
+	"github.com/dangerclosesec/supra/internal/email/mailer"
+	"github.com/dangerclosesec/supra/internal/model"
+)
+
+// Defaults for a UserService without verification settings
+const (
+	defaultVerificationMaxAttempts    = 5
+	defaultVerificationResendInterval = time.Minute
+)
+
+// VerifyInput is read from the query of the link sent to verify an email
+type VerifyInput struct {
+	Token string `json:"token" query:"token" validate:"required"`
+}
+
+// ResendVerificationInput asks for a new verification link
+type ResendVerificationInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// VerifyEmail activates the user a verification link was sent to. The
+// link's token must be signed, unexpired and the latest one sent; a token
+// that is signed but superseded counts against the factor, which locks
+// after too many invalid attempts until a new link is requested.
+func (s *UserService) VerifyEmail(ctx context.Context, input VerifyInput) error {
+	token, err := s.verificationTokens.Validate(input.Token)
+	switch {
+	case errors.Is(err, auth.ErrVerificationTokenExpired):
+		s.verificationMetrics.attempt(verificationExpired)
+		return domain.ErrVerificationExpired
+	case err != nil:
+		s.verificationMetrics.attempt(verificationInvalid)
+		return domain.ErrInvalidVerificationCode
+	}
+
+	// Start transaction
+	tx, err := s.repo.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Find user
+	user, err := s.repo.FindByID(ctx, token.UserID)
+	if err != nil {
+		return err
+	}
+
+	if user.Status == model.StatusActive {
+		s.verificationMetrics.attempt(verificationAlreadyVerified)
+		return domain.ErrAlreadyVerified
+	}
+
+	// Find verification factor
+	factor, err := s.factorRepo.FindByUserAndType(ctx, token.UserID, model.FactorVerificationCode)
+	if err != nil {
+		return fmt.Errorf("finding verification factor: %w", err)
+	}
+
+	if factor.FailedAttempts >= s.verificationMaxAttempts() {
+		s.verificationMetrics.attempt(verificationLocked)
+		return domain.ErrTooManyVerificationAttempts
+	}
+
+	if !factor.IsActive || !token.MatchesNonce(factor.Material) {
+		factor.FailedAttempts++
+		if err := s.factorRepo.Update(ctx, factor); err != nil {
+			return fmt.Errorf("updating factor: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing transaction: %w", err)
+		}
+		s.verificationMetrics.attempt(verificationInvalid)
+		return domain.ErrInvalidVerificationCode
+	}
+
+	// Update user status
+	user.Status = model.StatusActive
+	if err := s.repo.Update(ctx, user); err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+
+	// Use up the factor so the link can't be followed again
+	now := time.Now()
+	factor.VerifiedAt = &now
+	factor.LastUsedAt = &now
+	factor.IsActive = false
+
+	if err := s.factorRepo.Update(ctx, factor); err != nil {
+		return fmt.Errorf("updating factor: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	s.verificationMetrics.attempt(verificationVerified)
+	return nil
+}
+
+// ResendVerification sends a new verification link to a user who hasn't
+// verified their email yet, superseding the links sent before and
+// clearing the factor's failed attempts. It returns domain.ErrUserNotFound
+// or domain.ErrAlreadyVerified when there is nothing to send, and
+// domain.ErrResendTooSoon when the last link went out less than the resend
+// interval ago.
+func (s *UserService) ResendVerification(ctx context.Context, input ResendVerificationInput) error {
+	user, err := s.repo.FindByEmail(ctx, input.Email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			s.verificationMetrics.resend(verificationResendIgnored)
+		}
+		return err
+	}
+
+	if user.Status == model.StatusActive {
+		s.verificationMetrics.resend(verificationResendIgnored)
+		return domain.ErrAlreadyVerified
+	}
+
+	// Throttle by the time of the last resend
+	throttleKey := "verification_resent:" + user.ID.String()
+	var lastSent time.Time
+	if err := s.cacheService.Get(ctx, throttleKey, &lastSent); err == nil && time.Since(lastSent) < s.verificationResendInterval() {
+		s.verificationMetrics.resend(verificationResendThrottled)
+		return domain.ErrResendTooSoon
+	}
+
+	verification, err := s.verificationTokens.Generate(user.ID)
+	if err != nil {
+		return err
+	}
+
+	factor, err := s.factorRepo.FindByUserAndType(ctx, user.ID, model.FactorVerificationCode)
+	if err != nil {
+		return fmt.Errorf("finding verification factor: %w", err)
+	}
+	factor.Material = verification.Nonce
+	factor.ExpiresAt = &verification.ExpiresAt
+	factor.FailedAttempts = 0
+	factor.IsActive = true
+	factor.VerifiedAt = nil
+	if err := s.factorRepo.Update(ctx, factor); err != nil {
+		return fmt.Errorf("updating verification factor: %w", err)
+	}
+
+	// Send verification email
+	if err := mailer.SendVerificationEmail(s.emailService, user.Email, user.FirstName, s.verificationLink(verification)); err != nil {
+		return fmt.Errorf("sending verification email: %w", err)
+	}
+	s.cacheService.Set(ctx, throttleKey, time.Now())
+	s.verificationMetrics.resend(verificationResendSent)
+	s.verificationMetrics.linkSent(verificationSentResend)
+
+	return nil
+}
+
+// VerificationMetrics returns the counters of the verification funnel
+func (s *UserService) VerificationMetrics() *VerificationMetrics {
+	return s.verificationMetrics
+}
+
+// verificationLink is the URL emailed to verify an address
+func (s *UserService) verificationLink(verification *auth.VerificationToken) string {
+	return fmt.Sprintf("%s/api/auth/signup/verify?token=%s", s.config.BaseURL, url.QueryEscape(verification.Token))
+}
+
+func (s *UserService) verificationMaxAttempts() int {
+	if s.config != nil && s.config.Verification.MaxAttempts > 0 {
+		return s.config.Verification.MaxAttempts
+	}
+	return defaultVerificationMaxAttempts
+}
+
+func (s *UserService) verificationResendInterval() time.Duration {
+	if s.config != nil && s.config.Verification.ResendInterval > 0 {
+		return s.config.Verification.ResendInterval.Std()
+	}
+	return defaultVerificationResendInterval
+}
+
+// Why a verification link was sent
+const (
+	verificationSentSignup = "signup"
+	verificationSentResend = "resend"
+)
+
+// Results of following a verification link
+const (
+	verificationVerified        = "verified"
+	verificationInvalid         = "invalid"
+	verificationExpired         = "expired"
+	verificationLocked          = "locked"
+	verificationAlreadyVerified = "already_verified"
+)
+
+// Results of asking for a new link
+const (
+	verificationResendSent      = "sent"
+	verificationResendThrottled = "throttled"
+	verificationResendIgnored   = "ignored"
+)
+
+// VerificationMetrics counts each step of email verification: links sent,
+// links followed by result, and resend requests. Links sent less links
+// verified is the funnel's drop-off.
+type VerificationMetrics struct {
+	mu       sync.Mutex
+	sent     map[string]int64
+	attempts map[string]int64
+	resends  map[string]int64
+}
+
+func NewVerificationMetrics() *VerificationMetrics {
+	return &VerificationMetrics{
+		sent:     make(map[string]int64),
+		attempts: make(map[string]int64),
+		resends:  make(map[string]int64),
+	}
+}
+
+func (m *VerificationMetrics) linkSent(reason string) { m.inc(m.sent, reason) }
+func (m *VerificationMetrics) attempt(result string)  { m.inc(m.attempts, result) }
+func (m *VerificationMetrics) resend(result string)   { m.inc(m.resends, result) }
+
+func (m *VerificationMetrics) inc(counts map[string]int64, key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts[key]++
+}
+
+// WriteMetrics writes the counters in the Prometheus text format
+func (m *VerificationMetrics) WriteMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	writeCounter := func(name, help, label string, counts map[string]int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s counter\n", name)
+		keys := make([]string, 0, len(counts))
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s{%s=\"%s\"} %d\n", name, label, k, counts[k])
+		}
+	}
+	writeCounter("supra_verification_links_sent_total", "Email verification links sent by reason.", "reason", m.sent)
+	writeCounter("supra_verification_attempts_total", "Email verification links followed by result.", "result", m.attempts)
+	writeCounter("supra_verification_resends_total", "Requests for a new verification link by result.", "result", m.resends)
+
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,99 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/auth"
+	"github.com/dangerclosesec/supra/internal/domain"
+	"github.com/dangerclosesec/supra/internal/mocks"
+	"github.com/dangerclosesec/supra/internal/model"
+	"github.com/dangerclosesec/supra/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type noopTx struct{}
+
+func (noopTx) Commit() error   { return nil }
+func (noopTx) Rollback() error { return nil }
+
+func TestVerifyEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tokens := auth.NewVerificationTokenManager("verification-secret", time.Hour)
+	userID := uuid.New()
+
+	setup := func(factor *model.UserFactor) (*service.UserService, *mocks.MockUserRepositoryIface, *mocks.MockUserFactorRepositoryIface) {
+		userRepo := mocks.NewMockUserRepositoryIface(ctrl)
+		factorRepo := mocks.NewMockUserFactorRepositoryIface(ctrl)
+		userRepo.EXPECT().Begin(gomock.Any()).Return(noopTx{}, nil).AnyTimes()
+		userRepo.EXPECT().FindByID(gomock.Any(), userID).
+			Return(&model.User{ID: userID, Status: model.StatusPending}, nil).AnyTimes()
+		factorRepo.EXPECT().FindByUserAndType(gomock.Any(), userID, model.FactorVerificationCode).
+			Return(factor, nil).AnyTimes()
+
+		svc := service.NewUserService(userRepo, factorRepo, nil, nil, nil, tokens, nil, nil, nil, nil)
+		return svc, userRepo, factorRepo
+	}
+
+	t.Run("verifies the latest link once", func(t *testing.T) {
+		issued, err := tokens.Generate(userID)
+		require.NoError(t, err)
+		factor := &model.UserFactor{UserID: userID, FactorType: model.FactorVerificationCode, Material: issued.Nonce, IsActive: true}
+		svc, userRepo, factorRepo := setup(factor)
+
+		userRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, user *model.User) error {
+			assert.Equal(t, model.StatusActive, user.Status)
+			return nil
+		})
+		factorRepo.EXPECT().Update(gomock.Any(), factor).Return(nil)
+
+		require.NoError(t, svc.VerifyEmail(context.Background(), service.VerifyInput{Token: issued.Token}))
+		assert.False(t, factor.IsActive)
+		assert.NotNil(t, factor.VerifiedAt)
+
+		// Following the link again fails
+		err = svc.VerifyEmail(context.Background(), service.VerifyInput{Token: issued.Token})
+		assert.ErrorIs(t, err, domain.ErrAlreadyVerified)
+	})
+
+	t.Run("locks after too many superseded links", func(t *testing.T) {
+		latest, err := tokens.Generate(userID)
+		require.NoError(t, err)
+		stale, err := tokens.Generate(userID)
+		require.NoError(t, err)
+		factor := &model.UserFactor{UserID: userID, FactorType: model.FactorVerificationCode, Material: latest.Nonce, IsActive: true}
+		svc, _, factorRepo := setup(factor)
+		factorRepo.EXPECT().Update(gomock.Any(), factor).Return(nil).Times(5)
+
+		for i := 0; i < 5; i++ {
+			err := svc.VerifyEmail(context.Background(), service.VerifyInput{Token: stale.Token})
+			assert.ErrorIs(t, err, domain.ErrInvalidVerificationCode)
+		}
+		err = svc.VerifyEmail(context.Background(), service.VerifyInput{Token: latest.Token})
+		assert.ErrorIs(t, err, domain.ErrTooManyVerificationAttempts)
+
+		var metrics bytes.Buffer
+		svc.VerificationMetrics().WriteMetrics(&metrics)
+		assert.Contains(t, metrics.String(), `supra_verification_attempts_total{result="invalid"} 5`)
+		assert.Contains(t, metrics.String(), `supra_verification_attempts_total{result="locked"} 1`)
+	})
+
+	t.Run("rejects unsigned and expired links without a lookup", func(t *testing.T) {
+		svc := service.NewUserService(nil, nil, nil, nil, nil, tokens, nil, nil, nil, nil)
+
+		err := svc.VerifyEmail(context.Background(), service.VerifyInput{Token: "forged"})
+		assert.ErrorIs(t, err, domain.ErrInvalidVerificationCode)
+
+		expired, err := auth.NewVerificationTokenManager("verification-secret", -time.Minute).Generate(userID)
+		require.NoError(t, err)
+		err = svc.VerifyEmail(context.Background(), service.VerifyInput{Token: expired.Token})
+		assert.ErrorIs(t, err, domain.ErrVerificationExpired)
+	})
+}
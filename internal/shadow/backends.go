@@ -0,0 +1,194 @@
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Backend kinds accepted by NewBackend
+const (
+	// KindSupra is another supra authorization service
+	KindSupra = "supra"
+	// KindSpiceDB is SpiceDB's HTTP gateway
+	KindSpiceDB = "spicedb"
+	// KindHTTP is any service taking supra's check body at its URL and
+	// answering {"allowed": bool}, such as an adapter for a legacy system
+	KindHTTP = "http"
+)
+
+// Kinds lists every backend kind
+var Kinds = []string{KindSupra, KindSpiceDB, KindHTTP}
+
+// NewBackend returns the backend of the given kind at rawURL. token, when
+// set, is sent as a bearer token: supra's admin token, needed for
+// dual-writes when it enforces admin scopes, or SpiceDB's preshared key.
+func NewBackend(kind, rawURL, token string) (Backend, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("shadow backend URL %q must be an absolute http(s) URL", rawURL)
+	}
+	base := strings.TrimSuffix(rawURL, "/")
+	c := httpClient{client: &http.Client{}, token: token}
+
+	switch kind {
+	case KindSupra:
+		return &supraBackend{httpClient: c, base: base}, nil
+	case KindSpiceDB:
+		return &spiceDBBackend{httpClient: c, base: base}, nil
+	case KindHTTP:
+		return &webhookBackend{httpClient: c, url: rawURL}, nil
+	default:
+		return nil, fmt.Errorf("shadow backend kind must be one of %s, got %q", strings.Join(Kinds, ", "), kind)
+	}
+}
+
+type httpClient struct {
+	client *http.Client
+	token  string
+}
+
+// post sends body as JSON and decodes a 2xx response into out, which may be
+// nil. ok lists other statuses that count as success.
+func (c httpClient) post(ctx context.Context, endpoint string, body, out interface{}, ok ...int) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		for _, status := range ok {
+			if resp.StatusCode == status {
+				return nil
+			}
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+type allowedResponse struct {
+	Allowed bool `json:"allowed"`
+}
+
+// supraBackend calls another supra instance's HTTP API
+type supraBackend struct {
+	httpClient
+	base string
+}
+
+func (b *supraBackend) Check(ctx context.Context, c Check) (bool, error) {
+	var resp allowedResponse
+	err := b.post(ctx, b.base+"/check", c, &resp)
+	return resp.Allowed, err
+}
+
+// WriteEntity treats an entity the secondary already has as written
+func (b *supraBackend) WriteEntity(ctx context.Context, e Entity) error {
+	if e.Properties == nil {
+		e.Properties = map[string]interface{}{}
+	}
+	return b.post(ctx, b.base+"/entity", e, nil, http.StatusConflict)
+}
+
+func (b *supraBackend) WriteRelation(ctx context.Context, r Relation) error {
+	return b.post(ctx, b.base+"/relation", r, nil)
+}
+
+// webhookBackend posts checks to a URL that answers like supra's /check
+type webhookBackend struct {
+	httpClient
+	url string
+}
+
+func (b *webhookBackend) Check(ctx context.Context, c Check) (bool, error) {
+	var resp allowedResponse
+	err := b.post(ctx, b.url, c, &resp)
+	return resp.Allowed, err
+}
+
+// spiceDBBackend calls SpiceDB's HTTP gateway. Types, permissions and
+// relations are passed through by name, so the SpiceDB schema must mirror
+// the supra one; check context is sent as caveat context.
+type spiceDBBackend struct {
+	httpClient
+	base string
+}
+
+type spiceDBObject struct {
+	ObjectType string `json:"objectType"`
+	ObjectID   string `json:"objectId"`
+}
+
+type spiceDBSubject struct {
+	Object spiceDBObject `json:"object"`
+}
+
+// spiceDBHasPermission is the permissionship of an allowed check
+const spiceDBHasPermission = "PERMISSIONSHIP_HAS_PERMISSION"
+
+func (b *spiceDBBackend) Check(ctx context.Context, c Check) (bool, error) {
+	body := map[string]interface{}{
+		"consistency": map[string]bool{"fullyConsistent": true},
+		"resource":    spiceDBObject{ObjectType: c.ObjectType, ObjectID: c.ObjectID},
+		"permission":  c.Permission,
+		"subject":     spiceDBSubject{Object: spiceDBObject{ObjectType: c.SubjectType, ObjectID: c.SubjectID}},
+	}
+	if len(c.Context) > 0 {
+		body["context"] = c.Context
+	}
+
+	var resp struct {
+		Permissionship string `json:"permissionship"`
+	}
+	if err := b.post(ctx, b.base+"/v1/permissions/check", body, &resp); err != nil {
+		return false, err
+	}
+	return resp.Permissionship == spiceDBHasPermission, nil
+}
+
+// WriteEntity does nothing: SpiceDB only stores relationships
+func (b *spiceDBBackend) WriteEntity(ctx context.Context, e Entity) error {
+	return nil
+}
+
+// WriteRelation touches the relationship, so replays are harmless
+func (b *spiceDBBackend) WriteRelation(ctx context.Context, r Relation) error {
+	body := map[string]interface{}{
+		"updates": []map[string]interface{}{{
+			"operation": "OPERATION_TOUCH",
+			"relationship": map[string]interface{}{
+				"resource": spiceDBObject{ObjectType: r.ObjectType, ObjectID: r.ObjectID},
+				"relation": r.Relation,
+				"subject":  spiceDBSubject{Object: spiceDBObject{ObjectType: r.SubjectType, ObjectID: r.SubjectID}},
+			},
+		}},
+	}
+	return b.post(ctx, b.base+"/v1/relationships/write", body, nil)
+}
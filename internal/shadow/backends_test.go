@@ -0,0 +1,101 @@
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupraBackend(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, "Bearer admin", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/check":
+			var c Check
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&c))
+			json.NewEncoder(w).Encode(map[string]bool{"allowed": c.ObjectID == "1"})
+		case "/entity":
+			// The secondary already has the entity
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	backend, err := NewBackend(KindSupra, srv.URL+"/", "admin")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	allowed, err := backend.Check(ctx, Check{ObjectType: "document", ObjectID: "1"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	w := backend.(Writer)
+	assert.NoError(t, w.WriteEntity(ctx, Entity{Type: "user", ExternalID: "alice"}))
+	assert.NoError(t, w.WriteRelation(ctx, Relation{SubjectType: "user", SubjectID: "alice"}))
+	assert.Equal(t, []string{"/check", "/entity", "/relation"}, paths)
+}
+
+func TestSpiceDBBackend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/permissions/check", r.URL.Path)
+		var body struct {
+			Resource   spiceDBObject  `json:"resource"`
+			Permission string         `json:"permission"`
+			Subject    spiceDBSubject `json:"subject"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, spiceDBObject{"document", "1"}, body.Resource)
+		assert.Equal(t, spiceDBObject{"user", "alice"}, body.Subject.Object)
+
+		permissionship := "PERMISSIONSHIP_NO_PERMISSION"
+		if body.Permission == "view" {
+			permissionship = spiceDBHasPermission
+		}
+		json.NewEncoder(w).Encode(map[string]string{"permissionship": permissionship})
+	}))
+	defer srv.Close()
+
+	backend, err := NewBackend(KindSpiceDB, srv.URL, "")
+	require.NoError(t, err)
+
+	check := Check{SubjectType: "user", SubjectID: "alice", Permission: "view", ObjectType: "document", ObjectID: "1"}
+	allowed, err := backend.Check(context.Background(), check)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	check.Permission = "edit"
+	allowed, err = backend.Check(context.Background(), check)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestHTTPBackendReportsFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "legacy system down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	backend, err := NewBackend(KindHTTP, srv.URL+"/authorize", "")
+	require.NoError(t, err)
+	_, err = backend.Check(context.Background(), Check{})
+	assert.ErrorContains(t, err, "legacy system down")
+
+	_, ok := backend.(Writer)
+	assert.False(t, ok, "http backends can't take writes")
+}
+
+func TestNewBackendValidates(t *testing.T) {
+	_, err := NewBackend("zanzibar", "http://localhost", "")
+	assert.ErrorContains(t, err, "kind")
+	_, err = NewBackend(KindSupra, "localhost:4780", "")
+	assert.ErrorContains(t, err, "absolute")
+}
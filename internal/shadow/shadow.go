@@ -0,0 +1,292 @@
+// Package shadow replays permission checks, and optionally writes, against a
+// second authorization backend and counts where its answers differ. It is
+// meant for migrations: shadow traffic builds confidence in the new backend
+// before cutover without ever changing what callers are told.
+package shadow
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check is one permission check as the primary backend answered it. It
+// encodes as the body of supra's POST /check.
+type Check struct {
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Permission  string                 `json:"permission"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+}
+
+// Entity is an entity written to the primary backend
+type Entity struct {
+	Type       string                 `json:"type"`
+	ExternalID string                 `json:"external_id"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Relation is a relation written to the primary backend
+type Relation struct {
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Relation    string                 `json:"relation"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Backend answers permission checks
+type Backend interface {
+	Check(ctx context.Context, c Check) (bool, error)
+}
+
+// Writer is implemented by backends that can also take the primary's
+// writes, for dual-writing while the secondary catches up
+type Writer interface {
+	WriteEntity(ctx context.Context, e Entity) error
+	WriteRelation(ctx context.Context, r Relation) error
+}
+
+// Options tune how much traffic is shadowed
+type Options struct {
+	// SampleRate is the fraction of checks shadowed, from 0 to 1; zero
+	// shadows all of them
+	SampleRate float64
+	// Concurrency bounds the shadow calls in flight; calls beyond it are
+	// skipped rather than queued, so a slow backend can't build a backlog
+	Concurrency int
+	// Timeout bounds each shadow call
+	Timeout time.Duration
+	// DualWrite forwards writes too, when the backend is a Writer
+	DualWrite bool
+}
+
+// DefaultOptions returns the options used for fields left zero
+func DefaultOptions() Options {
+	return Options{
+		Concurrency: 64,
+		Timeout:     2 * time.Second,
+	}
+}
+
+// Key groups results by what was checked
+type Key struct {
+	ObjectType string `json:"object_type"`
+	Permission string `json:"permission"`
+}
+
+// Counts are the shadowed checks for one key
+type Counts struct {
+	Matches    int64 `json:"matches"`
+	Mismatches int64 `json:"mismatches"`
+	Errors     int64 `json:"errors"`
+	Skipped    int64 `json:"skipped"`
+}
+
+// Entry is the counts for one key
+type Entry struct {
+	Key
+	Counts
+}
+
+// Stats reports what a Shadower has compared since it started
+type Stats struct {
+	Checks      []Entry `json:"checks"`
+	Writes      int64   `json:"writes"`
+	WriteErrors int64   `json:"write_errors"`
+}
+
+// Shadower sends checks to a backend in the background and compares its
+// answers with the primary's. A nil Shadower does nothing.
+type Shadower struct {
+	backend Backend
+	opts    Options
+	slots   chan struct{}
+	wg      sync.WaitGroup
+
+	mu          sync.Mutex
+	counts      map[Key]*Counts
+	writes      int64
+	writeErrors int64
+}
+
+// New returns a Shadower comparing checks against backend
+func New(backend Backend, opts Options) *Shadower {
+	defaults := DefaultOptions()
+	if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+		opts.SampleRate = 1
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaults.Concurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	return &Shadower{
+		backend: backend,
+		opts:    opts,
+		slots:   make(chan struct{}, opts.Concurrency),
+		counts:  make(map[Key]*Counts),
+	}
+}
+
+// Compare checks c against the backend in the background and records
+// whether it agrees that the check is allowed. Mismatches are logged with
+// the check, so they can be replayed.
+func (s *Shadower) Compare(c Check, allowed bool) {
+	if s == nil {
+		return
+	}
+	if s.opts.SampleRate < 1 && rand.Float64() >= s.opts.SampleRate {
+		return
+	}
+	key := Key{ObjectType: c.ObjectType, Permission: c.Permission}
+	if !s.acquire() {
+		s.count(key, func(n *Counts) { n.Skipped++ })
+		return
+	}
+
+	go func() {
+		defer s.release()
+		ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+		defer cancel()
+
+		shadowed, err := s.backend.Check(ctx, c)
+		switch {
+		case err != nil:
+			s.count(key, func(n *Counts) { n.Errors++ })
+			log.Printf("Shadow check %s:%s %s %s:%s failed: %v",
+				c.SubjectType, c.SubjectID, c.Permission, c.ObjectType, c.ObjectID, err)
+		case shadowed != allowed:
+			s.count(key, func(n *Counts) { n.Mismatches++ })
+			log.Printf("Shadow check mismatch: %s:%s %s %s:%s allowed=%v, shadow allowed=%v",
+				c.SubjectType, c.SubjectID, c.Permission, c.ObjectType, c.ObjectID, allowed, shadowed)
+		default:
+			s.count(key, func(n *Counts) { n.Matches++ })
+		}
+	}()
+}
+
+// WriteEntity forwards an entity the primary stored, when dual-writing
+func (s *Shadower) WriteEntity(e Entity) {
+	s.write(func(ctx context.Context, w Writer) error { return w.WriteEntity(ctx, e) },
+		"entity "+e.Type+":"+e.ExternalID)
+}
+
+// WriteRelation forwards a relation the primary stored, when dual-writing
+func (s *Shadower) WriteRelation(r Relation) {
+	s.write(func(ctx context.Context, w Writer) error { return w.WriteRelation(ctx, r) },
+		"relation "+r.SubjectType+":"+r.SubjectID+" "+r.Relation+" "+r.ObjectType+":"+r.ObjectID)
+}
+
+// write runs a forwarded write in the background. Writes aren't sampled,
+// since a missed one shows up later as mismatches; one dropped because the
+// backend is saturated is counted as an error and logged so it can be
+// replayed.
+func (s *Shadower) write(fn func(context.Context, Writer) error, what string) {
+	if s == nil || !s.opts.DualWrite {
+		return
+	}
+	w, ok := s.backend.(Writer)
+	if !ok {
+		return
+	}
+
+	if !s.acquire() {
+		s.mu.Lock()
+		s.writes++
+		s.writeErrors++
+		s.mu.Unlock()
+		log.Printf("Shadow write of %s dropped: too many shadow calls in flight", what)
+		return
+	}
+	go func() {
+		defer s.release()
+		ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+		defer cancel()
+
+		err := fn(ctx, w)
+		s.mu.Lock()
+		s.writes++
+		if err != nil {
+			s.writeErrors++
+		}
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("Shadow write of %s failed: %v", what, err)
+		}
+	}()
+}
+
+func (s *Shadower) acquire() bool {
+	select {
+	case s.slots <- struct{}{}:
+		s.wg.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Shadower) release() {
+	<-s.slots
+	s.wg.Done()
+}
+
+func (s *Shadower) count(key Key, update func(*Counts)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.counts[key]
+	if !ok {
+		n = &Counts{}
+		s.counts[key] = n
+	}
+	update(n)
+}
+
+// Stats returns the counts so far, ordered by object type and permission
+func (s *Shadower) Stats() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := Stats{Writes: s.writes, WriteErrors: s.writeErrors}
+	for key, n := range s.counts {
+		stats.Checks = append(stats.Checks, Entry{Key: key, Counts: *n})
+	}
+	sort.Slice(stats.Checks, func(i, j int) bool {
+		a, b := stats.Checks[i], stats.Checks[j]
+		if a.ObjectType != b.ObjectType {
+			return a.ObjectType < b.ObjectType
+		}
+		return a.Permission < b.Permission
+	})
+	return stats
+}
+
+// Close waits for shadow calls in flight to finish, or for ctx to expire
+func (s *Shadower) Close(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,68 @@
+package shadow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend allows checks on the objects it lists
+type fakeBackend struct {
+	allowed map[string]bool
+	err     error
+	block   chan struct{}
+}
+
+func (f *fakeBackend) Check(ctx context.Context, c Check) (bool, error) {
+	if f.block != nil {
+		<-f.block
+	}
+	return f.allowed[c.ObjectID], f.err
+}
+
+func TestShadowerCountsMismatches(t *testing.T) {
+	s := New(&fakeBackend{allowed: map[string]bool{"1": true}}, Options{})
+
+	s.Compare(Check{Permission: "view", ObjectType: "document", ObjectID: "1"}, true)
+	s.Compare(Check{Permission: "view", ObjectType: "document", ObjectID: "2"}, true)
+	s.Compare(Check{Permission: "edit", ObjectType: "document", ObjectID: "2"}, false)
+	require.NoError(t, s.Close(context.Background()))
+
+	stats := s.Stats()
+	require.Len(t, stats.Checks, 2)
+	assert.Equal(t, Entry{Key{"document", "edit"}, Counts{Matches: 1}}, stats.Checks[0])
+	assert.Equal(t, Entry{Key{"document", "view"}, Counts{Matches: 1, Mismatches: 1}}, stats.Checks[1])
+}
+
+func TestShadowerCountsErrors(t *testing.T) {
+	s := New(&fakeBackend{err: errors.New("unavailable")}, Options{})
+
+	s.Compare(Check{Permission: "view", ObjectType: "document", ObjectID: "1"}, false)
+	require.NoError(t, s.Close(context.Background()))
+
+	assert.Equal(t, Counts{Errors: 1}, s.Stats().Checks[0].Counts)
+}
+
+func TestShadowerSkipsWhenSaturated(t *testing.T) {
+	backend := &fakeBackend{block: make(chan struct{})}
+	s := New(backend, Options{Concurrency: 1, Timeout: time.Minute})
+
+	s.Compare(Check{Permission: "view", ObjectType: "document", ObjectID: "1"}, false)
+	s.Compare(Check{Permission: "view", ObjectType: "document", ObjectID: "2"}, false)
+	close(backend.block)
+	require.NoError(t, s.Close(context.Background()))
+
+	assert.Equal(t, Counts{Matches: 1, Skipped: 1}, s.Stats().Checks[0].Counts)
+}
+
+func TestNilShadower(t *testing.T) {
+	var s *Shadower
+	s.Compare(Check{}, true)
+	s.WriteRelation(Relation{})
+	assert.Empty(t, s.Stats().Checks)
+	assert.NoError(t, s.Close(context.Background()))
+}
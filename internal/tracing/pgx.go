@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxStatement is how much of a query's SQL a span records
+const maxStatement = 500
+
+// QueryTracer returns a pgx tracer that traces every query as a child of
+// the span in its context, then hands off to next if it is set
+func QueryTracer(next pgx.QueryTracer) pgx.QueryTracer {
+	return &queryTracer{next: next}
+}
+
+type queryTracer struct {
+	next pgx.QueryTracer
+}
+
+type querySpanKey struct{}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.next != nil {
+		ctx = t.next.TraceQueryStart(ctx, conn, data)
+	}
+	// Queries outside a trace, such as the audit writer's, aren't traced
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	statement := data.SQL
+	if len(statement) > maxStatement {
+		statement = statement[:maxStatement]
+	}
+	ctx, span := tracer.Start(ctx, queryName(data.SQL), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBQueryText(statement)))
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if span, ok := ctx.Value(querySpanKey{}).(trace.Span); ok {
+		End(span, data.Err)
+	}
+	if t.next != nil {
+		t.next.TraceQueryEnd(ctx, conn, data)
+	}
+}
+
+// queryName names a query's span: a prepared statement by its name, such
+// as graph_check_indirect_relation, and other SQL by its first keyword
+func queryName(sql string) string {
+	fields := strings.Fields(sql)
+	switch {
+	case len(fields) == 0:
+		return "query"
+	case len(fields) == 1:
+		return fields[0]
+	default:
+		return strings.ToUpper(fields[0])
+	}
+}
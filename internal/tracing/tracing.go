@@ -0,0 +1,86 @@
+// Package tracing exports OpenTelemetry traces of the authz service's
+// requests. Spans start at the HTTP handler or gRPC method, continuing a
+// trace the caller propagated in its traceparent header, and go down
+// through condition parsing, relation lookups and rule evaluation to each
+// database query, so a slow check shows which part of it dominates.
+//
+// Until Setup installs an exporter every span is a no-op, but trace
+// context is still passed through.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer spans are started with
+const instrumentation = "github.com/dangerclosesec/supra"
+
+// tracer is resolved through the global provider, so spans started before
+// Setup runs, or without it, are no-ops
+var tracer = otel.Tracer(instrumentation)
+
+// Options configure Setup
+type Options struct {
+	// Service and Version identify the process in its spans, e.g.
+	// supra-authz and v1.4.0
+	Service string
+	Version string
+	// Endpoint is the OTLP/HTTP collector URL, e.g.
+	// http://otel-collector:4318; empty exports nothing
+	Endpoint string
+	// SampleRatio is the fraction of traces started here that are
+	// recorded, from 0 to 1. Traces a caller started follow the caller's
+	// decision.
+	SampleRatio float64
+}
+
+// Setup installs the W3C trace context propagator and, with an endpoint,
+// a tracer provider exporting spans to it. The returned function flushes
+// the spans still buffered and stops exporting.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(opts.Service),
+			semconv.ServiceVersion(opts.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the one in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it failed when err is set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
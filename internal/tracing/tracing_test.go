@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// exporter holds the spans tests end. The package's tracer keeps the first
+// provider installed, so there is one for every test.
+var exporter = tracetest.NewInMemoryExporter()
+
+func TestMain(m *testing.M) {
+	if _, err := Setup(context.Background(), Options{}); err != nil {
+		panic(err)
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	os.Exit(m.Run())
+}
+
+// record forgets the spans earlier tests ended
+func record(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter.Reset()
+	return exporter
+}
+
+func attr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestHandler(t *testing.T) {
+	recorder := record(t)
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "graph.DecideCondition")
+		End(span, errors.New("budget exceeded"))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), func(r *http.Request) string { return "POST /check" })
+
+	req := httptest.NewRequest(http.MethodPost, "/check", nil)
+	req.Header.Set("Traceparent", traceparent)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.GetSpans()
+	require.Len(t, spans, 2)
+	child, server := spans[0], spans[1]
+
+	assert.Equal(t, "POST /check", server.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String(),
+		"the caller's trace is continued")
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Equal(t, int64(http.StatusServiceUnavailable), attr(server, "http.response.status_code").AsInt64())
+	assert.Equal(t, codes.Error, server.Status.Code)
+
+	assert.Equal(t, server.SpanContext.SpanID(), child.Parent.SpanID())
+	assert.Equal(t, codes.Error, child.Status.Code)
+	assert.Equal(t, "budget exceeded", child.Status.Description)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	recorder := record(t)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/supra.authz.v1.AuthzService/Check"}
+
+	_, err := UnaryServerInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	spans := recorder.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, info.FullMethod, spans[0].Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+}
+
+func TestQueryTracer(t *testing.T) {
+	recorder := record(t)
+	qt := QueryTracer(nil)
+
+	// Outside a trace queries aren't traced
+	ctx := qt.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	assert.Empty(t, recorder.GetSpans())
+
+	ctx, span := Start(context.Background(), "graph.IndirectRelation")
+	qctx := qt.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "graph_check_indirect_relation"})
+	qt.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{Err: errors.New("canceling statement")})
+	span.End()
+
+	spans := recorder.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "graph_check_indirect_relation", spans[0].Name)
+	assert.Equal(t, "postgresql", attr(spans[0], "db.system").AsString())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, span.SpanContext().SpanID(), spans[0].Parent.SpanID())
+}
+
+func TestQueryName(t *testing.T) {
+	assert.Equal(t, "graph_check_direct_relation", queryName("graph_check_direct_relation"))
+	assert.Equal(t, "SELECT", queryName("\n\t\tselect id FROM relations WHERE source = $1"))
+	assert.Equal(t, "query", queryName("  "))
+}
@@ -0,0 +1,382 @@
+// Package lint finds mistakes in a permission model that parse cleanly but
+// would fail or never grant anything once migrated.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// Severity of a Diagnostic
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is one problem found in a model, at the line of the
+// declaration it concerns
+type Diagnostic struct {
+	Line     int
+	Severity string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %s: %s", d.Line, d.Severity, d.Message)
+}
+
+// Lint checks a parsed model, returning its diagnostics by line:
+//
+//   - errors for permissions referring to relations, permissions or
+//     attributes their entity doesn't declare
+//   - errors for relations whose target isn't a declared entity
+//   - errors for calls to undefined rules, or with the wrong number of
+//     arguments
+//   - errors for permissions that depend on themselves within an entity
+//   - warnings for permissions that can never be granted
+func Lint(m *model.PermissionModel) []Diagnostic {
+	l := &linter{model: m}
+	for _, name := range sortedEntities(m) {
+		l.lintEntity(m.Entities[name])
+	}
+	l.lintCycles()
+	l.lintReachability()
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		return l.diagnostics[i].Line < l.diagnostics[j].Line
+	})
+	return l.diagnostics
+}
+
+type linter struct {
+	model       *model.PermissionModel
+	diagnostics []Diagnostic
+	// flagged are the entity#permission keys already given an error, so
+	// they aren't also reported as unreachable
+	flagged map[string]bool
+}
+
+func (l *linter) report(line int, severity, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+// flag reports an error in a permission
+func (l *linter) flag(entity *model.Entity, perm model.Permission, format string, args ...interface{}) {
+	if l.flagged == nil {
+		l.flagged = make(map[string]bool)
+	}
+	l.flagged[entity.Name+"#"+perm.Name] = true
+	l.report(perm.LineNumber, SeverityError, "%s.%s: %s", entity.Name, perm.Name, fmt.Sprintf(format, args...))
+}
+
+func (l *linter) lintEntity(entity *model.Entity) {
+	for _, rel := range entity.Relations {
+		if l.model.GetEntity(rel.Target) == nil {
+			l.report(rel.LineNumber, SeverityError, "%s.%s: relation target @%s is not a declared entity", entity.Name, rel.Name, rel.Target)
+		}
+	}
+	for _, derived := range entity.DerivedRelations {
+		if l.model.GetEntity(derived.SubjectType) == nil {
+			l.report(derived.LineNumber, SeverityError, "%s.%s: relation target @%s is not a declared entity", entity.Name, derived.Name, derived.SubjectType)
+		}
+		if memberOf(entity, derived.Attribute) != memberAttribute {
+			l.report(derived.LineNumber, SeverityError, "%s.%s: %s is not a declared attribute of %s", entity.Name, derived.Name, derived.Attribute, entity.Name)
+		}
+	}
+	for _, perm := range entity.Permissions {
+		if perm.ParsedExpr != nil {
+			l.lintExpression(entity, perm, perm.ParsedExpr)
+		}
+	}
+}
+
+func (l *linter) lintExpression(entity *model.Entity, perm model.Permission, expr model.Expression) {
+	switch e := expr.(type) {
+	case *model.And:
+		l.lintExpression(entity, perm, e.Left)
+		l.lintExpression(entity, perm, e.Right)
+	case *model.Or:
+		l.lintExpression(entity, perm, e.Left)
+		l.lintExpression(entity, perm, e.Right)
+	case *model.Not:
+		l.lintExpression(entity, perm, e.Expr)
+	case *model.Parentheses:
+		l.lintExpression(entity, perm, e.Expr)
+	case *model.RelationRef:
+		l.lintReference(entity, perm, e.Entity, e.Name)
+	case *model.AttributeRef:
+		l.lintReference(entity, perm, e.Entity, e.Name)
+	case *model.RuleCall:
+		want, ok := l.arity(entity, e.Name)
+		if !ok {
+			l.flag(entity, perm, "calls %s, which is not a declared rule or built-in function", e.Name)
+		} else if len(e.Arguments) != want {
+			l.flag(entity, perm, "calls %s with %d argument(s), but it takes %d", e.Name, len(e.Arguments), want)
+		}
+		for _, arg := range e.Arguments {
+			l.lintExpression(entity, perm, arg)
+		}
+	}
+}
+
+// lintReference checks a reference to name, or to via.name through the
+// relation via
+func (l *linter) lintReference(entity *model.Entity, perm model.Permission, via, name string) {
+	switch via {
+	case "":
+		if memberOf(entity, name) == memberNone {
+			l.flag(entity, perm, "%s is not a relation, permission or attribute of %s", name, entity.Name)
+		}
+		return
+	case graph.AttributeOfSubject:
+		// The subject's type is only known at check time
+		return
+	case graph.AttributeOfObject:
+		if memberOf(entity, name) != memberAttribute {
+			l.flag(entity, perm, "%s is not a declared attribute of %s", name, entity.Name)
+		}
+		return
+	}
+
+	target := relationTarget(entity, via)
+	if target == "" {
+		l.flag(entity, perm, "%s.%s: %s is not a relation of %s", via, name, via, entity.Name)
+		return
+	}
+	targetEntity := l.model.GetEntity(target)
+	if targetEntity == nil {
+		// Reported with the relation
+		return
+	}
+	if memberOf(targetEntity, name) == memberNone {
+		l.flag(entity, perm, "%s.%s: %s is not a relation, permission or attribute of %s", via, name, name, target)
+	}
+}
+
+// arity returns how many arguments the rule or built-in function named
+// name takes, looking in the entity's own rules first
+func (l *linter) arity(entity *model.Entity, name string) (int, bool) {
+	for _, rule := range entity.Rules {
+		if rule.Name == name {
+			return len(rule.Parameters), true
+		}
+	}
+	if rule := l.model.GetRule(name); rule != nil {
+		return len(rule.Parameters), true
+	}
+	return graph.BuiltinArity(name)
+}
+
+// lintCycles reports permissions that refer back to themselves through
+// other permissions of their entity, without following a relation. They
+// can't be evaluated. Cycles through relations, like parent.view, follow
+// the data and end where it does.
+func (l *linter) lintCycles() {
+	for _, name := range sortedEntities(l.model) {
+		entity := l.model.Entities[name]
+		deps := make(map[string][]string)
+		for _, perm := range entity.Permissions {
+			deps[perm.Name] = localPermissionRefs(entity, perm.ParsedExpr, nil)
+		}
+
+		const (
+			unvisited = iota
+			visiting
+			done
+		)
+		state := make(map[string]int)
+		var path []string
+		var visit func(name string)
+		visit = func(name string) {
+			state[name] = visiting
+			path = append(path, name)
+			for _, dep := range deps[name] {
+				switch state[dep] {
+				case visiting:
+					start := 0
+					for path[start] != dep {
+						start++
+					}
+					cycle := append(append([]string(nil), path[start:]...), dep)
+					perm := findPermission(entity, dep)
+					l.flag(entity, perm, "permissions depend on each other: %s", strings.Join(cycle, " -> "))
+				case unvisited:
+					visit(dep)
+				}
+			}
+			path = path[:len(path)-1]
+			state[name] = done
+		}
+		for _, perm := range entity.Permissions {
+			if state[perm.Name] == unvisited {
+				visit(perm.Name)
+			}
+		}
+	}
+}
+
+// lintReachability warns about permissions that can never be granted:
+// every way to satisfy them goes through an undefined reference or a
+// cycle. Permissions already reported are skipped.
+func (l *linter) lintReachability() {
+	grantable := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, entity := range l.model.Entities {
+			for _, perm := range entity.Permissions {
+				key := entity.Name + "#" + perm.Name
+				if !grantable[key] && perm.ParsedExpr != nil && l.satisfiable(entity, perm.ParsedExpr, grantable) {
+					grantable[key] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	for _, name := range sortedEntities(l.model) {
+		entity := l.model.Entities[name]
+		for _, perm := range entity.Permissions {
+			key := entity.Name + "#" + perm.Name
+			if perm.ParsedExpr != nil && !grantable[key] && !l.flagged[key] {
+				l.report(perm.LineNumber, SeverityWarning, "%s.%s can never be granted: everything it depends on is undefined or depends on itself", entity.Name, perm.Name)
+			}
+		}
+	}
+}
+
+// satisfiable reports whether expr can hold, given the permissions known
+// to be grantable so far
+func (l *linter) satisfiable(entity *model.Entity, expr model.Expression, grantable map[string]bool) bool {
+	switch e := expr.(type) {
+	case *model.And:
+		return l.satisfiable(entity, e.Left, grantable) && l.satisfiable(entity, e.Right, grantable)
+	case *model.Or:
+		return l.satisfiable(entity, e.Left, grantable) || l.satisfiable(entity, e.Right, grantable)
+	case *model.Parentheses:
+		return l.satisfiable(entity, e.Expr, grantable)
+	case *model.RelationRef:
+		return l.referenceSatisfiable(entity, e.Entity, e.Name, grantable)
+	case *model.AttributeRef:
+		return l.referenceSatisfiable(entity, e.Entity, e.Name, grantable)
+	case *model.RuleCall:
+		_, ok := l.arity(entity, e.Name)
+		return ok
+	default:
+		// Negations, context values and literals may hold
+		return true
+	}
+}
+
+func (l *linter) referenceSatisfiable(entity *model.Entity, via, name string, grantable map[string]bool) bool {
+	if via == graph.AttributeOfSubject || via == graph.AttributeOfObject {
+		return true
+	}
+	if via != "" {
+		target := l.model.GetEntity(relationTarget(entity, via))
+		if target == nil {
+			return false
+		}
+		entity = target
+	}
+	switch memberOf(entity, name) {
+	case memberNone:
+		return false
+	case memberPermission:
+		return grantable[entity.Name+"#"+name]
+	default:
+		return true
+	}
+}
+
+// localPermissionRefs appends the permissions of entity expr refers to
+// directly, without following a relation
+func localPermissionRefs(entity *model.Entity, expr model.Expression, refs []string) []string {
+	switch e := expr.(type) {
+	case *model.And:
+		refs = localPermissionRefs(entity, e.Left, refs)
+		return localPermissionRefs(entity, e.Right, refs)
+	case *model.Or:
+		refs = localPermissionRefs(entity, e.Left, refs)
+		return localPermissionRefs(entity, e.Right, refs)
+	case *model.Not:
+		return localPermissionRefs(entity, e.Expr, refs)
+	case *model.Parentheses:
+		return localPermissionRefs(entity, e.Expr, refs)
+	case *model.RelationRef:
+		if e.Entity == "" && memberOf(entity, e.Name) == memberPermission {
+			refs = append(refs, e.Name)
+		}
+	}
+	return refs
+}
+
+// What a name declared in an entity is
+const (
+	memberNone = iota
+	memberRelation
+	memberAttribute
+	memberPermission
+)
+
+// memberOf returns what name is declared as in entity
+func memberOf(entity *model.Entity, name string) int {
+	for _, rel := range entity.Relations {
+		if rel.Name == name {
+			return memberRelation
+		}
+	}
+	for _, derived := range entity.DerivedRelations {
+		if derived.Name == name {
+			return memberRelation
+		}
+	}
+	for _, attr := range entity.Attributes {
+		if attr.Name == name {
+			return memberAttribute
+		}
+	}
+	for _, perm := range entity.Permissions {
+		if perm.Name == name {
+			return memberPermission
+		}
+	}
+	return memberNone
+}
+
+// relationTarget returns the entity type the relation named name points
+// to, or "" if entity has no such relation
+func relationTarget(entity *model.Entity, name string) string {
+	for _, rel := range entity.Relations {
+		if rel.Name == name {
+			return rel.Target
+		}
+	}
+	for _, derived := range entity.DerivedRelations {
+		if derived.Name == name {
+			return derived.SubjectType
+		}
+	}
+	return ""
+}
+
+func findPermission(entity *model.Entity, name string) model.Permission {
+	for _, perm := range entity.Permissions {
+		if perm.Name == name {
+			return perm
+		}
+	}
+	return model.Permission{Name: name}
+}
+
+func sortedEntities(m *model.PermissionModel) []string {
+	names := make([]string, 0, len(m.Entities))
+	for name := range m.Entities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
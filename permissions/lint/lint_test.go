@@ -0,0 +1,85 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dangerclosesec/supra/permissions/parser"
+)
+
+func lintSchema(t *testing.T, schema string) []Diagnostic {
+	t.Helper()
+	p := parser.NewParser(parser.NewLexer(schema))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+	return Lint(m)
+}
+
+func TestLintClean(t *testing.T) {
+	assert.Empty(t, lintSchema(t, `entity user {}
+
+entity organization {
+    relation parent @organization
+    relation admin @user
+    permission manage = admin or parent.manage
+}
+
+entity document {
+    relation organization @organization
+    relation owner @user
+    attribute public boolean
+    attribute limit integer
+    attribute title string
+    permission edit = owner or organization.manage
+    permission view = edit or public or lower(object.title)
+    permission spend = within_limit(request.amount, limit)
+}
+
+rule within_limit(amount integer, limit integer) {
+    amount <= limit
+}`))
+}
+
+func TestLint(t *testing.T) {
+	diagnostics := lintSchema(t, `entity user {}
+
+entity document {
+    relation owner @user
+    relation folder @folder
+    relation team @team
+    permission view = owner or editor
+    permission edit = owner.admin
+    permission share = parent.view
+    permission spend = within_limit(request.amount)
+    permission audit = audited(owner)
+    permission a = b or owner
+    permission b = a
+    permission never = view and edit
+}
+
+entity team {
+    permission join = missing
+}
+
+rule within_limit(amount integer, limit integer) {
+    amount <= limit
+}`)
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		"line 5: error: document.folder: relation target @folder is not a declared entity",
+		"line 7: error: document.view: editor is not a relation, permission or attribute of document",
+		"line 8: error: document.edit: owner.admin: admin is not a relation, permission or attribute of user",
+		"line 9: error: document.share: parent.view: parent is not a relation of document",
+		"line 10: error: document.spend: calls within_limit with 1 argument(s), but it takes 2",
+		"line 11: error: document.audit: calls audited, which is not a declared rule or built-in function",
+		"line 12: error: document.a: permissions depend on each other: a -> b -> a",
+		"line 14: warning: document.never can never be granted: everything it depends on is undefined or depends on itself",
+		"line 18: error: team.join: missing is not a relation, permission or attribute of team",
+	}, got)
+}
@@ -23,6 +23,14 @@ type EntityDiff struct {
 	AddedPermissions    []model.Permission
 	RemovedPermissions  []string
 	ModifiedPermissions map[string]*PermissionDiff
+	// DeprecatedPermissions are newly deprecated or have a new deprecation
+	// message; RestoredPermissions are no longer deprecated
+	DeprecatedPermissions []model.Permission
+	RestoredPermissions   []string
+	// SensitivePermissions are newly marked sensitive or have a new label;
+	// UnmarkedSensitive are no longer sensitive
+	SensitivePermissions []model.Permission
+	UnmarkedSensitive    []string
 }
 
 // PermissionDiff represents the differences between two permissions
@@ -186,6 +194,20 @@ func compareEntityPermissions(oldEntity, newEntity *model.Entity) *EntityDiff {
 				NewExpression: newPerm.Expression,
 			}
 		}
+
+		switch {
+		case newPerm.Deprecated && (!oldPerm.Deprecated || oldPerm.DeprecationMessage != newPerm.DeprecationMessage):
+			diff.DeprecatedPermissions = append(diff.DeprecatedPermissions, newPerm)
+		case oldPerm.Deprecated && !newPerm.Deprecated:
+			diff.RestoredPermissions = append(diff.RestoredPermissions, name)
+		}
+
+		switch {
+		case newPerm.Sensitive && (!oldPerm.Sensitive || oldPerm.SensitiveLabel != newPerm.SensitiveLabel):
+			diff.SensitivePermissions = append(diff.SensitivePermissions, newPerm)
+		case oldPerm.Sensitive && !newPerm.Sensitive:
+			diff.UnmarkedSensitive = append(diff.UnmarkedSensitive, name)
+		}
 	}
 
 	return diff
@@ -195,7 +217,11 @@ func compareEntityPermissions(oldEntity, newEntity *model.Entity) *EntityDiff {
 func (d *EntityDiff) IsEmpty() bool {
 	return len(d.AddedPermissions) == 0 &&
 		len(d.RemovedPermissions) == 0 &&
-		len(d.ModifiedPermissions) == 0
+		len(d.ModifiedPermissions) == 0 &&
+		len(d.DeprecatedPermissions) == 0 &&
+		len(d.RestoredPermissions) == 0 &&
+		len(d.SensitivePermissions) == 0 &&
+		len(d.UnmarkedSensitive) == 0
 }
 
 // String returns a string representation of the model diff
@@ -247,6 +273,42 @@ func (d *ModelDiff) String() string {
 					sb.WriteString(fmt.Sprintf("        + %s\n", permDiff.NewExpression))
 				}
 			}
+
+			if len(diff.DeprecatedPermissions) > 0 {
+				sb.WriteString("    Deprecated Permissions:\n")
+				for _, perm := range diff.DeprecatedPermissions {
+					if perm.DeprecationMessage == "" {
+						sb.WriteString(fmt.Sprintf("      ~ %s\n", perm.Name))
+						continue
+					}
+					sb.WriteString(fmt.Sprintf("      ~ %s (%s)\n", perm.Name, perm.DeprecationMessage))
+				}
+			}
+
+			if len(diff.RestoredPermissions) > 0 {
+				sb.WriteString("    No Longer Deprecated:\n")
+				for _, perm := range diff.RestoredPermissions {
+					sb.WriteString(fmt.Sprintf("      ~ %s\n", perm))
+				}
+			}
+
+			if len(diff.SensitivePermissions) > 0 {
+				sb.WriteString("    Sensitive Permissions:\n")
+				for _, perm := range diff.SensitivePermissions {
+					if perm.SensitiveLabel == "" {
+						sb.WriteString(fmt.Sprintf("      ! %s\n", perm.Name))
+						continue
+					}
+					sb.WriteString(fmt.Sprintf("      ! %s (%s)\n", perm.Name, perm.SensitiveLabel))
+				}
+			}
+
+			if len(diff.UnmarkedSensitive) > 0 {
+				sb.WriteString("    No Longer Sensitive:\n")
+				for _, perm := range diff.UnmarkedSensitive {
+					sb.WriteString(fmt.Sprintf("      ! %s\n", perm))
+				}
+			}
 		}
 	}
 	
@@ -0,0 +1,219 @@
+package migration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+)
+
+// ExportModel rebuilds the permission model the database holds, from the
+// permission and rule definitions and the relation, attribute, derived
+// relation and relation limit declarations the last migration wrote, so it
+// can be written back out as a .perm file. Entities a relation points to
+// are included even when they declare nothing. Databases migrated before
+// relations were declared have their relations inferred from the stored
+// relation tuples.
+func (m *Migrator) ExportModel() (*model.PermissionModel, error) {
+	e := &exporter{db: m.DB, model: model.NewPermissionModel()}
+	for _, load := range []func() error{
+		e.loadRelations,
+		e.loadDerivedRelations,
+		e.loadAttributes,
+		e.loadPermissions,
+		e.loadRules,
+	} {
+		if err := load(); err != nil {
+			return nil, err
+		}
+	}
+	for _, entity := range e.model.Entities {
+		for _, rel := range entity.Relations {
+			e.entity(rel.Target)
+		}
+		for _, derived := range entity.DerivedRelations {
+			e.entity(derived.SubjectType)
+		}
+	}
+	return e.model, nil
+}
+
+type exporter struct {
+	db    *sql.DB
+	model *model.PermissionModel
+}
+
+// entity returns the entity named name, adding it to the model if needed
+func (e *exporter) entity(name string) *model.Entity {
+	if entity := e.model.GetEntity(name); entity != nil {
+		return entity
+	}
+	entity := &model.Entity{Name: name}
+	e.model.Entities[name] = entity
+	return entity
+}
+
+func (e *exporter) loadRelations() error {
+	var declared int
+	if err := e.db.QueryRow(`SELECT COUNT(*) FROM relation_declarations`).Scan(&declared); err != nil {
+		return fmt.Errorf("failed to count relation declarations: %w", err)
+	}
+
+	query := `
+		SELECT d.entity_type, d.relation, d.subject_type, COALESCE(l.max_subjects, 0)
+		FROM relation_declarations d
+		LEFT JOIN relation_limits l ON l.entity_type = d.entity_type AND l.relation = d.relation
+		WHERE NOT EXISTS (
+			SELECT 1 FROM derived_relations r
+			WHERE r.entity_type = d.entity_type AND r.relation = d.relation AND r.subject_type = d.subject_type
+		)
+		ORDER BY d.entity_type, d.relation, d.subject_type
+	`
+	if declared == 0 {
+		query = `
+			SELECT DISTINCT t.object_type, t.relation, t.subject_type, COALESCE(l.max_subjects, 0)
+			FROM relations t
+			LEFT JOIN relation_limits l ON l.entity_type = t.object_type AND l.relation = t.relation
+			ORDER BY t.object_type, t.relation, t.subject_type
+		`
+	}
+
+	rows, err := e.db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query relations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entityType string
+		var rel model.Relation
+		if err := rows.Scan(&entityType, &rel.Name, &rel.Target, &rel.MaxSubjects); err != nil {
+			return fmt.Errorf("failed to scan relation: %w", err)
+		}
+		entity := e.entity(entityType)
+		entity.Relations = append(entity.Relations, rel)
+	}
+	return rows.Err()
+}
+
+func (e *exporter) loadDerivedRelations() error {
+	rows, err := e.db.Query(`
+		SELECT entity_type, relation, subject_type, attribute, value
+		FROM derived_relations
+		ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query derived relations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entityType string
+		var derived model.DerivedRelation
+		var valueJSON []byte
+		if err := rows.Scan(&entityType, &derived.Name, &derived.SubjectType, &derived.Attribute, &valueJSON); err != nil {
+			return fmt.Errorf("failed to scan derived relation: %w", err)
+		}
+		if valueJSON != nil {
+			if err := json.Unmarshal(valueJSON, &derived.Value); err != nil {
+				return fmt.Errorf("derived relation %s.%s: %w", entityType, derived.Name, err)
+			}
+		}
+		entity := e.entity(entityType)
+		entity.DerivedRelations = append(entity.DerivedRelations, derived)
+	}
+	return rows.Err()
+}
+
+func (e *exporter) loadAttributes() error {
+	rows, err := e.db.Query(`
+		SELECT entity_type, attribute, data_type
+		FROM attribute_declarations
+		ORDER BY entity_type, attribute
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query attribute declarations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entityType, dataType string
+		var attr model.Attribute
+		if err := rows.Scan(&entityType, &attr.Name, &dataType); err != nil {
+			return fmt.Errorf("failed to scan attribute declaration: %w", err)
+		}
+		attr.DataType = model.AttributeDataType(dataType)
+		entity := e.entity(entityType)
+		entity.Attributes = append(entity.Attributes, attr)
+	}
+	return rows.Err()
+}
+
+func (e *exporter) loadPermissions() error {
+	rows, err := e.db.Query(`
+		SELECT entity_type, permission_name, condition_expression, COALESCE(description, ''), deprecated, sensitive
+		FROM permission_definitions
+		ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query permissions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entityType, description string
+		var deprecated, sensitive sql.NullString
+		var perm model.Permission
+		if err := rows.Scan(&entityType, &perm.Name, &perm.Expression, &description, &deprecated, &sensitive); err != nil {
+			return fmt.Errorf("failed to scan permission: %w", err)
+		}
+		if description != "" {
+			perm.Comments = strings.Split(description, "\n")
+		}
+		perm.Deprecated = deprecated.Valid
+		perm.DeprecationMessage = deprecated.String
+		perm.Sensitive = sensitive.Valid
+		perm.SensitiveLabel = sensitive.String
+		entity := e.entity(entityType)
+		entity.Permissions = append(entity.Permissions, perm)
+	}
+	return rows.Err()
+}
+
+func (e *exporter) loadRules() error {
+	rows, err := e.db.Query(`
+		SELECT rule_name, parameters, expression, COALESCE(description, '')
+		FROM rule_definitions
+		ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query rules: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule model.Rule
+		var parametersJSON []byte
+		var description string
+		if err := rows.Scan(&rule.Name, &parametersJSON, &rule.Expression, &description); err != nil {
+			return fmt.Errorf("failed to scan rule: %w", err)
+		}
+		var params []map[string]string
+		if err := json.Unmarshal(parametersJSON, &params); err != nil {
+			return fmt.Errorf("rule %s: failed to parse parameters: %w", rule.Name, err)
+		}
+		for _, p := range params {
+			rule.Parameters = append(rule.Parameters, model.RuleParameter{
+				Name:     p["name"],
+				DataType: model.AttributeDataType(p["data_type"]),
+			})
+		}
+		if description != "" {
+			rule.Comments = strings.Split(description, "\n")
+		}
+		e.model.Rules[rule.Name] = &rule
+	}
+	return rows.Err()
+}
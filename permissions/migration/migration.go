@@ -2,67 +2,42 @@
 package migration
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
+	"sort"
 
+	"github.com/dangerclosesec/supra/internal/migrate"
 	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/pkg/graph"
 	_ "github.com/lib/pq"
 )
 
 // Migrator handles database migrations for permission models
 type Migrator struct {
 	DB *sql.DB
+	// ConditionLimits bound the permission conditions a migration may
+	// write, as they do permissions written through the API
+	ConditionLimits graph.ConditionLimits
 }
 
 // NewMigrator creates a new migrator
 func NewMigrator(db *sql.DB) *Migrator {
-	return &Migrator{DB: db}
+	return &Migrator{DB: db, ConditionLimits: graph.DefaultConditionLimits()}
 }
 
-// InitializeSchema initializes the database schema
+// InitializeSchema brings the authz database schema up to date by applying the
+// versioned authz migrations
 func (m *Migrator) InitializeSchema() error {
-	// Create the schema if it doesn't exist
-	_, err := m.DB.Exec(`
-	-- Create tables if they don't exist
-	CREATE TABLE IF NOT EXISTS entity_types (
-		id SERIAL PRIMARY KEY,
-		name TEXT NOT NULL UNIQUE,
-		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	);
-
-	CREATE TABLE IF NOT EXISTS permission_definitions (
-		id SERIAL PRIMARY KEY,
-		entity_type TEXT NOT NULL,
-		permission_name TEXT NOT NULL,
-		condition_expression TEXT NOT NULL,
-		description TEXT,
-		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		UNIQUE(entity_type, permission_name)
-	);
-
-	CREATE TABLE IF NOT EXISTS permission_versions (
-		id SERIAL PRIMARY KEY,
-		version INT NOT NULL,
-		description TEXT,
-		source_file TEXT,
-		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	);
-
-	CREATE TABLE IF NOT EXISTS migration_history (
-		id SERIAL PRIMARY KEY,
-		version INT NOT NULL,
-		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		success BOOLEAN NOT NULL,
-		errors TEXT,
-		diff TEXT
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_entity_type_name ON permission_definitions(entity_type);
-	`)
+	migrator, err := migrate.New(m.DB, migrate.TargetAuthz)
+	if err != nil {
+		return err
+	}
 
+	_, err = migrator.Up(context.Background())
 	return err
 }
 
@@ -75,34 +50,19 @@ func (m *Migrator) GetCurrentVersion() (int, error) {
 	return version, err
 }
 
-// ApplyMigration applies a permission model to the database
+// ApplyMigration applies a permission model to the database, executing
+// the statements PlanMigration plans in one transaction
 func (m *Migrator) ApplyMigration(model *model.PermissionModel, description string) (string, error) {
-	// Get current version
-	currentVersion, err := m.GetCurrentVersion()
-	if err != nil {
-		return "", fmt.Errorf("failed to get current version: %w", err)
-	}
-
-	// Load current model from database for diffing
-	currentModel, err := m.LoadCurrentModel()
+	plan, err := m.PlanMigration(model, description)
 	if err != nil {
-		return "", fmt.Errorf("failed to load current model: %w", err)
+		return "", err
 	}
 
-	// Generate diff
-	diff := GenerateDiff(currentModel, model)
-	diffText := diff.String()
-
-	// Check if there are actual changes
-	hasChanges := !diff.IsEmpty()
-
 	// If no changes, skip the migration process
-	if !hasChanges {
+	if plan.IsEmpty() {
 		return "No changes detected. Migration skipped.", nil
 	}
-
-	// Calculate new version only if changes are detected
-	newVersion := currentVersion + 1
+	diffText := plan.Diff.String()
 
 	// Start transaction
 	tx, err := m.DB.Begin()
@@ -115,23 +75,13 @@ func (m *Migrator) ApplyMigration(model *model.PermissionModel, description stri
 		}
 	}()
 
-	// Apply changes
-	err = m.applyModelInTransaction(tx, model)
-	if err != nil {
-		tx.Rollback()
-		// Record failed migration
-		m.recordMigrationHistory(newVersion, false, err.Error(), diffText)
-		return "", fmt.Errorf("failed to apply model: %w", err)
-	}
-
-	// Record version
-	_, err = tx.Exec(`
-		INSERT INTO permission_versions (version, description, source_file)
-		VALUES ($1, $2, $3)
-	`, newVersion, description, model.Source)
-	if err != nil {
-		tx.Rollback()
-		return "", fmt.Errorf("failed to record version: %w", err)
+	for _, stmt := range plan.Statements {
+		if _, err := tx.Exec(stmt.SQL, stmt.Args...); err != nil {
+			tx.Rollback()
+			// Record failed migration
+			m.recordMigrationHistory(plan.Version, false, err.Error(), diffText)
+			return "", fmt.Errorf("failed to %s: %w", stmt.purpose, err)
+		}
 	}
 
 	// Commit transaction
@@ -141,11 +91,31 @@ func (m *Migrator) ApplyMigration(model *model.PermissionModel, description stri
 	}
 
 	// Record successful migration
-	m.recordMigrationHistory(newVersion, true, "", diffText)
+	m.recordMigrationHistory(plan.Version, true, "", diffText)
 
 	return diffText, nil
 }
 
+// checkConditions holds every permission of the model to the migrator's
+// ConditionLimits, before anything is written
+func (m *Migrator) checkConditions(model *model.PermissionModel) error {
+	names := make([]string, 0, len(model.Entities))
+	for name := range model.Entities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		for _, perm := range model.Entities[name].Permissions {
+			if err := m.ConditionLimits.Check(perm.Expression); err != nil {
+				errs = append(errs, fmt.Errorf("permission %s.%s (line %d): %w", name, perm.Name, perm.LineNumber, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // convertRuleParameters converts model.Rule.Parameters to a format suitable for JSON storage
 func convertRuleParameters(rule *model.Rule) []map[string]string {
 	params := make([]map[string]string, len(rule.Parameters))
@@ -164,7 +134,7 @@ func (m *Migrator) LoadCurrentModel() (*model.PermissionModel, error) {
 
 	// Load permissions
 	permRows, err := m.DB.Query(`
-		SELECT entity_type, permission_name, condition_expression
+		SELECT entity_type, permission_name, condition_expression, deprecated, sensitive
 		FROM permission_definitions
 	`)
 	if err != nil {
@@ -176,7 +146,8 @@ func (m *Migrator) LoadCurrentModel() (*model.PermissionModel, error) {
 
 	for permRows.Next() {
 		var entityType, permName, expr string
-		if err := permRows.Scan(&entityType, &permName, &expr); err != nil {
+		var deprecated, sensitive sql.NullString
+		if err := permRows.Scan(&entityType, &permName, &expr, &deprecated, &sensitive); err != nil {
 			return nil, err
 		}
 
@@ -191,8 +162,12 @@ func (m *Migrator) LoadCurrentModel() (*model.PermissionModel, error) {
 		// Add permission
 		entity := entityMap[entityType]
 		entity.Permissions = append(entity.Permissions, model.Permission{
-			Name:       permName,
-			Expression: expr,
+			Name:               permName,
+			Expression:         expr,
+			Deprecated:         deprecated.Valid,
+			DeprecationMessage: deprecated.String,
+			Sensitive:          sensitive.Valid,
+			SensitiveLabel:     sensitive.String,
 		})
 	}
 	
@@ -262,126 +237,6 @@ func (m *Migrator) LoadCurrentModel() (*model.PermissionModel, error) {
 	return permModel, nil
 }
 
-// applyModelInTransaction applies the model changes within a transaction
-func (m *Migrator) applyModelInTransaction(tx *sql.Tx, model *model.PermissionModel) error {
-	// Clear existing permissions
-	_, err := tx.Exec(`DELETE FROM permission_definitions`)
-	if err != nil {
-		return fmt.Errorf("failed to clear permissions: %w", err)
-	}
-
-	// Check if rule_definitions table exists
-	var ruleTableExists bool
-	err = tx.QueryRow(`
-		SELECT EXISTS (
-			SELECT FROM information_schema.tables 
-			WHERE table_schema = 'public'
-			AND table_name = 'rule_definitions'
-		)
-	`).Scan(&ruleTableExists)
-
-	if err != nil {
-		return fmt.Errorf("failed to check if rule_definitions table exists: %w", err)
-	}
-
-	// Create rule_definitions table if it doesn't exist
-	if !ruleTableExists {
-		_, err = tx.Exec(`
-			CREATE TABLE rule_definitions (
-				id SERIAL PRIMARY KEY,
-				rule_name TEXT NOT NULL UNIQUE,
-				parameters JSONB NOT NULL,
-				expression TEXT NOT NULL,
-				description TEXT,
-				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-			)
-		`)
-		if err != nil {
-			return fmt.Errorf("failed to create rule_definitions table: %w", err)
-		}
-		log.Println("Created rule_definitions table")
-	} else {
-		// Clear existing rules if table exists
-		_, err = tx.Exec(`DELETE FROM rule_definitions`)
-		if err != nil {
-			return fmt.Errorf("failed to clear rules: %w", err)
-		}
-	}
-
-	// Insert global rules
-	for _, rule := range model.Rules {
-		// Skip nil rules (shouldn't happen but just in case)
-		if rule == nil {
-			continue
-		}
-
-		// Convert rule parameters to JSON
-		parametersJSON, err := json.Marshal(convertRuleParameters(rule))
-		if err != nil {
-			return fmt.Errorf("failed to marshal rule parameters: %w", err)
-		}
-
-		// Insert rule
-		_, err = tx.Exec(`
-			INSERT INTO rule_definitions (rule_name, parameters, expression, description)
-			VALUES ($1, $2, $3, $4)
-		`, rule.Name, parametersJSON, rule.Expression, "")
-		if err != nil {
-			return fmt.Errorf("failed to insert rule definition: %w", err)
-		}
-	}
-
-	// Insert entities and permissions
-	for _, entity := range model.Entities {
-		// Insert entity-level rules
-		for i := range entity.Rules {
-			rule := &entity.Rules[i]
-			
-			// Convert rule parameters to JSON
-			parametersJSON, err := json.Marshal(convertRuleParameters(rule))
-			if err != nil {
-				return fmt.Errorf("failed to marshal rule parameters: %w", err)
-			}
-
-			// Check if rule already exists in global rules (skip if it does)
-			var exists bool
-			err = tx.QueryRow(`
-				SELECT EXISTS (
-					SELECT 1 FROM rule_definitions WHERE rule_name = $1
-				)
-			`, rule.Name).Scan(&exists)
-
-			if err != nil {
-				return fmt.Errorf("failed to check if rule exists: %w", err)
-			}
-
-			if !exists {
-				// Insert rule
-				_, err = tx.Exec(`
-					INSERT INTO rule_definitions (rule_name, parameters, expression, description)
-					VALUES ($1, $2, $3, $4)
-				`, rule.Name, parametersJSON, rule.Expression, "")
-				if err != nil {
-					return fmt.Errorf("failed to insert entity rule definition: %w", err)
-				}
-			}
-		}
-
-		// Insert permissions
-		for _, perm := range entity.Permissions {
-			_, err := tx.Exec(`
-				INSERT INTO permission_definitions (entity_type, permission_name, condition_expression, description)
-				VALUES ($1, $2, $3, $4)
-			`, entity.Name, perm.Name, perm.Expression, strings.Join(perm.Comments, "\n"))
-			if err != nil {
-				return fmt.Errorf("failed to insert permission %s.%s: %w", entity.Name, perm.Name, err)
-			}
-		}
-	}
-
-	return nil
-}
-
 // recordMigrationHistory records migration history
 func (m *Migrator) recordMigrationHistory(version int, success bool, errorMsg string, diff string) {
 	_, err := m.DB.Exec(`
@@ -392,3 +247,15 @@ func (m *Migrator) recordMigrationHistory(version int, success bool, errorMsg st
 		log.Printf("Failed to record migration history: %v", err)
 	}
 }
+
+// deprecation is the deprecated column of a permission: NULL unless the
+// schema deprecates it
+func deprecation(perm model.Permission) sql.NullString {
+	return sql.NullString{String: perm.DeprecationMessage, Valid: perm.Deprecated}
+}
+
+// sensitivity is the sensitive column of a permission: NULL unless the
+// schema marks it sensitive
+func sensitivity(perm model.Permission) sql.NullString {
+	return sql.NullString{String: perm.SensitiveLabel, Valid: perm.Sensitive}
+}
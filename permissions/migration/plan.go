@@ -0,0 +1,233 @@
+package migration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// Statement is one SQL statement of a migration
+type Statement struct {
+	SQL  string
+	Args []interface{}
+	// purpose describes the statement in the error returned when it fails
+	purpose string
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// String returns the statement with its arguments written in as SQL
+// literals, for review
+func (s Statement) String() string {
+	query := placeholder.ReplaceAllStringFunc(strings.TrimSpace(s.SQL), func(p string) string {
+		n, _ := strconv.Atoi(p[1:])
+		if n < 1 || n > len(s.Args) {
+			return p
+		}
+		return literal(s.Args[n-1])
+	})
+	return dedent(query) + ";"
+}
+
+// literal writes an argument as a SQL literal
+func literal(arg interface{}) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case sql.NullString:
+		if !v.Valid {
+			return "NULL"
+		}
+		return literal(v.String)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []byte:
+		return literal(string(v))
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// dedent removes the indentation the statement's continuation lines share
+func dedent(query string) string {
+	lines := strings.Split(query, "\n")
+	if len(lines) == 1 {
+		return query
+	}
+	common := -1
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, "\t "))
+		if common < 0 || indent < common {
+			common = indent
+		}
+	}
+	for i, line := range lines[1:] {
+		if len(line) >= common && common > 0 {
+			lines[i+1] = line[common:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Plan is what applying a permission model would change
+type Plan struct {
+	// Version is the permission model version the migration creates
+	Version int
+	Diff    *ModelDiff
+	// Statements are executed in one transaction, in order. There are none
+	// when the model matches the database's.
+	Statements []Statement
+}
+
+// IsEmpty reports whether the model matches the database's, so applying it
+// would do nothing
+func (p *Plan) IsEmpty() bool {
+	return len(p.Statements) == 0
+}
+
+// SQL returns the plan's statements as a script
+func (p *Plan) SQL() string {
+	if p.IsEmpty() {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("BEGIN;\n\n")
+	for _, stmt := range p.Statements {
+		b.WriteString(stmt.String())
+		b.WriteString("\n\n")
+	}
+	b.WriteString("COMMIT;\n")
+	return b.String()
+}
+
+// PlanMigration works out the diff and the statements applying permModel
+// would execute, reading but not changing the database
+func (m *Migrator) PlanMigration(permModel *model.PermissionModel, description string) (*Plan, error) {
+	if err := m.checkConditions(permModel); err != nil {
+		return nil, err
+	}
+
+	currentVersion, err := m.GetCurrentVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current version: %w", err)
+	}
+
+	currentModel, err := m.LoadCurrentModel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load current model: %w", err)
+	}
+
+	plan := &Plan{
+		Version: currentVersion + 1,
+		Diff:    GenerateDiff(currentModel, permModel),
+	}
+	if plan.Diff.IsEmpty() {
+		return plan, nil
+	}
+
+	plan.Statements, err = modelStatements(permModel)
+	if err != nil {
+		return nil, err
+	}
+	plan.Statements = append(plan.Statements,
+		// Snapshot the model, so checks pinned to the version before this
+		// one keep evaluating against it and Rollback can restore this one.
+		// Nothing is inserted when the latest snapshot already matches,
+		// e.g. after a change made through the API.
+		Statement{SQL: graph.SnapshotSchemaSQL, Args: []interface{}{permModel.Source}, purpose: "record schema version"},
+		Statement{
+			SQL: `
+				INSERT INTO permission_versions (version, description, source_file, schema_version)
+				VALUES ($1, $2, $3, (SELECT MAX(version) FROM schema_versions))
+			`,
+			Args:    []interface{}{plan.Version, description, permModel.Source},
+			purpose: "record version",
+		},
+	)
+	return plan, nil
+}
+
+// modelStatements replace the stored permissions and rules with the
+// model's. Global rules are written before entity rules, and an entity
+// rule named like one already written is skipped.
+func modelStatements(permModel *model.PermissionModel) ([]Statement, error) {
+	statements := []Statement{
+		{SQL: `DELETE FROM permission_definitions`, purpose: "clear permissions"},
+		// The table is created by the authz migrations
+		{SQL: `DELETE FROM rule_definitions`, purpose: "clear rules (run `supra migrate up --target authz` first)"},
+	}
+
+	written := make(map[string]bool)
+	insertRule := func(rule *model.Rule) error {
+		if written[rule.Name] {
+			return nil
+		}
+		written[rule.Name] = true
+
+		parametersJSON, err := json.Marshal(convertRuleParameters(rule))
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule parameters: %w", err)
+		}
+		statements = append(statements, Statement{
+			SQL: `
+				INSERT INTO rule_definitions (rule_name, parameters, expression, description)
+				VALUES ($1, $2, $3, $4)
+			`,
+			Args:    []interface{}{rule.Name, parametersJSON, rule.Expression, ""},
+			purpose: "insert rule " + rule.Name,
+		})
+		return nil
+	}
+
+	ruleNames := make([]string, 0, len(permModel.Rules))
+	for name, rule := range permModel.Rules {
+		// Skip nil rules (shouldn't happen but just in case)
+		if rule != nil {
+			ruleNames = append(ruleNames, name)
+		}
+	}
+	sort.Strings(ruleNames)
+	for _, name := range ruleNames {
+		if err := insertRule(permModel.Rules[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	entityNames := make([]string, 0, len(permModel.Entities))
+	for name := range permModel.Entities {
+		entityNames = append(entityNames, name)
+	}
+	sort.Strings(entityNames)
+
+	for _, name := range entityNames {
+		entity := permModel.Entities[name]
+		for i := range entity.Rules {
+			if err := insertRule(&entity.Rules[i]); err != nil {
+				return nil, err
+			}
+		}
+		for _, perm := range entity.Permissions {
+			statements = append(statements, Statement{
+				SQL: `
+					INSERT INTO permission_definitions (entity_type, permission_name, condition_expression, description, deprecated, sensitive)
+					VALUES ($1, $2, $3, $4, $5, $6)
+				`,
+				Args:    []interface{}{entity.Name, perm.Name, perm.Expression, strings.Join(perm.Comments, "\n"), deprecation(perm), sensitivity(perm)},
+				purpose: fmt.Sprintf("insert permission %s.%s", entity.Name, perm.Name),
+			})
+		}
+	}
+	return statements, nil
+}
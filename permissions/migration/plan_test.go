@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+)
+
+func TestModelStatements(t *testing.T) {
+	permModel := model.NewPermissionModel()
+	permModel.AddEntity(&model.Entity{
+		Name: "document",
+		Rules: []model.Rule{
+			{Name: "within_limit", Parameters: []model.RuleParameter{{Name: "amount", DataType: "integer"}}, Expression: "amount <= 100"},
+		},
+		Permissions: []model.Permission{
+			{Name: "view", Expression: "owner or viewer"},
+			{Name: "read", Expression: "view", Deprecated: true, DeprecationMessage: "use 'view'"},
+			{Name: "purge", Expression: "owner", Sensitive: true, SensitiveLabel: "break-glass"},
+		},
+	})
+	permModel.AddEntity(&model.Entity{
+		Name:        "account",
+		Permissions: []model.Permission{{Name: "withdraw", Expression: "owner and within_limit(request.amount)"}},
+	})
+
+	statements, err := modelStatements(permModel)
+	require.NoError(t, err)
+	require.Len(t, statements, 7)
+
+	assert.Equal(t, "DELETE FROM permission_definitions;", statements[0].String())
+	assert.Equal(t, "DELETE FROM rule_definitions;", statements[1].String())
+	// The entity rule is global once added, and is written once
+	assert.Equal(t, `INSERT INTO rule_definitions (rule_name, parameters, expression, description)
+VALUES ('within_limit', '[{"data_type":"integer","name":"amount"}]', 'amount <= 100', '');`, statements[2].String())
+	// Entities are written by name
+	assert.Equal(t, []interface{}{"account", "withdraw", "owner and within_limit(request.amount)", "", sql.NullString{}, sql.NullString{}}, statements[3].Args)
+	assert.Equal(t, `INSERT INTO permission_definitions (entity_type, permission_name, condition_expression, description, deprecated, sensitive)
+VALUES ('document', 'read', 'view', '', 'use ''view''', NULL);`, statements[5].String())
+	assert.Equal(t, `INSERT INTO permission_definitions (entity_type, permission_name, condition_expression, description, deprecated, sensitive)
+VALUES ('document', 'purge', 'owner', '', NULL, 'break-glass');`, statements[6].String())
+}
+
+func TestPlanSQL(t *testing.T) {
+	assert.Equal(t, "", (&Plan{}).SQL())
+
+	plan := &Plan{Statements: []Statement{
+		{SQL: `DELETE FROM permission_definitions`},
+		{SQL: `
+			INSERT INTO permission_versions (version, source_file)
+			VALUES ($1, $2)
+		`, Args: []interface{}{3, nil}},
+	}}
+	assert.False(t, plan.IsEmpty())
+	assert.Equal(t, `BEGIN;
+
+DELETE FROM permission_definitions;
+
+INSERT INTO permission_versions (version, source_file)
+VALUES (3, NULL);
+
+COMMIT;
+`, plan.SQL())
+}
@@ -0,0 +1,113 @@
+package migration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+)
+
+// ErrVersionNotFound is returned for a permission model version that was
+// never applied
+var ErrVersionNotFound = errors.New("permission model version not found")
+
+// ErrNoSnapshot is returned for a version applied before models were
+// snapshotted, which can't be restored
+var ErrNoSnapshot = errors.New("permission model version has no snapshot")
+
+// LoadVersion loads the permission model as a past migration left it
+func (m *Migrator) LoadVersion(version int) (*model.PermissionModel, error) {
+	var schemaVersion sql.NullInt64
+	err := m.DB.QueryRow(`
+		SELECT schema_version FROM permission_versions WHERE version = $1
+	`, version).Scan(&schemaVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version %d: %w", version, err)
+	}
+	if !schemaVersion.Valid {
+		return nil, fmt.Errorf("%w: %d", ErrNoSnapshot, version)
+	}
+
+	var permissionsJSON, rulesJSON []byte
+	err = m.DB.QueryRow(`
+		SELECT permissions, rules FROM schema_versions WHERE version = $1
+	`, schemaVersion.Int64).Scan(&permissionsJSON, &rulesJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the snapshot of version %d: %w", version, err)
+	}
+
+	permModel, err := snapshotModel(permissionsJSON, rulesJSON)
+	if err != nil {
+		return nil, fmt.Errorf("version %d: %w", version, err)
+	}
+	return permModel, nil
+}
+
+// Rollback restores the permission model of a past version by applying it
+// as a new version, so the history keeps the version being rolled back. It
+// returns the diff applied. Derived relations, relation declarations and
+// attribute declarations are not versioned and are left as they are.
+func (m *Migrator) Rollback(version int) (string, error) {
+	permModel, err := m.LoadVersion(version)
+	if err != nil {
+		return "", err
+	}
+	permModel.Source = fmt.Sprintf("rollback to version %d", version)
+	return m.ApplyMigration(permModel, fmt.Sprintf("Rollback to version %d", version))
+}
+
+// snapshotModel builds a permission model from the permissions and rules
+// stored in schema_versions
+func snapshotModel(permissionsJSON, rulesJSON []byte) (*model.PermissionModel, error) {
+	var permissions []struct {
+		EntityType          string  `json:"entity_type"`
+		PermissionName      string  `json:"permission_name"`
+		ConditionExpression string  `json:"condition_expression"`
+		Deprecated          *string `json:"deprecated"`
+		Sensitive           *string `json:"sensitive"`
+	}
+	if err := json.Unmarshal(permissionsJSON, &permissions); err != nil {
+		return nil, fmt.Errorf("failed to parse permissions: %w", err)
+	}
+	var rules []struct {
+		RuleName   string              `json:"rule_name"`
+		Parameters []map[string]string `json:"parameters"`
+		Expression string              `json:"expression"`
+	}
+	if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	permModel := model.NewPermissionModel()
+	for _, p := range permissions {
+		entity := permModel.GetEntity(p.EntityType)
+		if entity == nil {
+			entity = &model.Entity{Name: p.EntityType}
+			permModel.AddEntity(entity)
+		}
+		perm := model.Permission{Name: p.PermissionName, Expression: p.ConditionExpression}
+		if p.Deprecated != nil {
+			perm.Deprecated, perm.DeprecationMessage = true, *p.Deprecated
+		}
+		if p.Sensitive != nil {
+			perm.Sensitive, perm.SensitiveLabel = true, *p.Sensitive
+		}
+		entity.Permissions = append(entity.Permissions, perm)
+	}
+	for _, r := range rules {
+		rule := &model.Rule{Name: r.RuleName, Expression: r.Expression}
+		for _, p := range r.Parameters {
+			rule.Parameters = append(rule.Parameters, model.RuleParameter{
+				Name:     p["name"],
+				DataType: model.AttributeDataType(p["data_type"]),
+			})
+		}
+		permModel.AddRule(rule)
+	}
+	return permModel, nil
+}
@@ -0,0 +1,38 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+)
+
+func TestSnapshotModel(t *testing.T) {
+	permModel, err := snapshotModel(
+		[]byte(`[{"entity_type":"document","permission_name":"view","condition_expression":"owner or viewer","deprecated":null},
+			{"entity_type":"document","permission_name":"read","condition_expression":"viewer","deprecated":"use view"},
+			{"entity_type":"document","permission_name":"purge","condition_expression":"owner","deprecated":null,"sensitive":""}]`),
+		[]byte(`[{"rule_name":"within_limit","parameters":[{"name":"amount","data_type":"integer"}],"expression":"amount <= 100"}]`))
+	require.NoError(t, err)
+
+	document := permModel.GetEntity("document")
+	require.NotNil(t, document)
+	assert.Equal(t, []model.Permission{
+		{Name: "view", Expression: "owner or viewer"},
+		{Name: "read", Expression: "viewer", Deprecated: true, DeprecationMessage: "use view"},
+		{Name: "purge", Expression: "owner", Sensitive: true},
+	}, document.Permissions)
+	assert.Equal(t, &model.Rule{
+		Name:       "within_limit",
+		Parameters: []model.RuleParameter{{Name: "amount", DataType: model.AttributeTypeInteger}},
+		Expression: "amount <= 100",
+	}, permModel.Rules["within_limit"])
+
+	// A snapshot applied back is no change
+	assert.True(t, GenerateDiff(permModel, permModel).IsEmpty())
+
+	_, err = snapshotModel([]byte(`{}`), []byte(`[]`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format writes the model as a .perm schema: entities by name, each with
+// its relations, derived relations, attributes and permissions in
+// declaration order, then the global rules by name. Comments are written
+// above the declarations they document.
+func Format(m *PermissionModel) string {
+	var b strings.Builder
+
+	names := make([]string, 0, len(m.Entities))
+	for name := range m.Entities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		formatEntity(&b, m.Entities[name])
+	}
+
+	ruleNames := make([]string, 0, len(m.Rules))
+	for name, rule := range m.Rules {
+		if rule != nil {
+			ruleNames = append(ruleNames, name)
+		}
+	}
+	sort.Strings(ruleNames)
+
+	for _, name := range ruleNames {
+		rule := m.Rules[name]
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		writeComments(&b, "", rule.Comments)
+		params := make([]string, len(rule.Parameters))
+		for i, param := range rule.Parameters {
+			params[i] = param.Name + " " + string(param.DataType)
+		}
+		b.WriteString("rule " + rule.Name + "(" + strings.Join(params, ", ") + ") {\n")
+		b.WriteString("    " + rule.Expression + "\n")
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+func formatEntity(b *strings.Builder, entity *Entity) {
+	writeComments(b, "", entity.Comments)
+	if len(entity.Relations) == 0 && len(entity.DerivedRelations) == 0 &&
+		len(entity.Attributes) == 0 && len(entity.Permissions) == 0 {
+		b.WriteString("entity " + entity.Name + " {}\n")
+		return
+	}
+
+	const indent = "    "
+	b.WriteString("entity " + entity.Name + " {\n")
+
+	for _, rel := range entity.Relations {
+		writeComments(b, indent, rel.Comments)
+		b.WriteString(indent + "relation " + rel.Name + " @" + rel.Target)
+		if rel.MaxSubjects > 0 {
+			b.WriteString(" max " + strconv.Itoa(rel.MaxSubjects))
+		}
+		b.WriteString("\n")
+	}
+	for _, derived := range entity.DerivedRelations {
+		b.WriteString(indent + "relation " + derived.String() + "\n")
+	}
+
+	hasRelations := len(entity.Relations) > 0 || len(entity.DerivedRelations) > 0
+	if len(entity.Attributes) > 0 {
+		if hasRelations {
+			b.WriteString("\n")
+		}
+		for _, attr := range entity.Attributes {
+			writeComments(b, indent, attr.Comments)
+			b.WriteString(indent + "attribute " + attr.Name + " " + string(attr.DataType) + "\n")
+		}
+	}
+
+	if len(entity.Permissions) > 0 && (hasRelations || len(entity.Attributes) > 0) {
+		b.WriteString("\n")
+	}
+	for _, perm := range entity.Permissions {
+		writeComments(b, indent, perm.Comments)
+		if perm.Deprecated {
+			b.WriteString(indent + "@deprecated")
+			if perm.DeprecationMessage != "" {
+				b.WriteString("(" + strconv.Quote(perm.DeprecationMessage) + ")")
+			}
+			b.WriteString("\n")
+		}
+		if perm.Sensitive {
+			b.WriteString(indent + "@sensitive")
+			if perm.SensitiveLabel != "" {
+				b.WriteString("(" + strconv.Quote(perm.SensitiveLabel) + ")")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "permission " + perm.Name + " = " + perm.Expression + "\n")
+	}
+
+	b.WriteString("}\n")
+}
+
+// writeComments writes each line of comments as a // comment
+func writeComments(b *strings.Builder, indent string, comments []string) {
+	for _, comment := range comments {
+		for _, line := range strings.Split(comment, "\n") {
+			line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "//"))
+			if line == "" {
+				b.WriteString(indent + "//\n")
+				continue
+			}
+			b.WriteString(indent + "// " + line + "\n")
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/permissions/parser"
+)
+
+func TestFormat(t *testing.T) {
+	m := model.NewPermissionModel()
+	m.AddEntity(&model.Entity{Name: "user"})
+	m.AddEntity(&model.Entity{
+		Name: "document",
+		Relations: []model.Relation{
+			{Name: "owner", Target: "user", MaxSubjects: 1},
+			{Name: "editor", Target: "user"},
+		},
+		DerivedRelations: []model.DerivedRelation{
+			{Name: "reader", SubjectType: "user", Attribute: "status", Value: "published"},
+		},
+		Attributes: []model.Attribute{
+			{Name: "status", DataType: model.AttributeTypeString},
+			{Name: "limit", DataType: model.AttributeTypeInteger},
+		},
+		Permissions: []model.Permission{
+			{Name: "edit", Expression: "owner or editor", Comments: []string{"Owners and editors", "may edit"}},
+			{Name: "view", Expression: "edit or reader"},
+			{Name: "read", Expression: "view", Deprecated: true, DeprecationMessage: "use view"},
+			{Name: "spend", Expression: "within_limit(request.amount, limit)", Sensitive: true, SensitiveLabel: "finance"},
+		},
+	})
+	m.Rules["within_limit"] = &model.Rule{
+		Name:       "within_limit",
+		Parameters: []model.RuleParameter{{Name: "amount", DataType: "integer"}, {Name: "limit", DataType: "integer"}},
+		Expression: "amount <= limit",
+	}
+
+	source := model.Format(m)
+	assert.Equal(t, `entity document {
+    relation owner @user max 1
+    relation editor @user
+    relation reader @user:* when status == "published"
+
+    attribute status string
+    attribute limit integer
+
+    // Owners and editors
+    // may edit
+    permission edit = owner or editor
+    permission view = edit or reader
+    @deprecated("use view")
+    permission read = view
+    @sensitive("finance")
+    permission spend = within_limit(request.amount, limit)
+}
+
+entity user {}
+
+rule within_limit(amount integer, limit integer) {
+    amount <= limit
+}
+`, source)
+
+	p := parser.NewParser(parser.NewLexer(source))
+	parsed := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	document := parsed.GetEntity("document")
+	require.NotNil(t, document)
+	assert.Equal(t, 1, document.Relations[0].MaxSubjects)
+	assert.Equal(t, "published", document.DerivedRelations[0].Value)
+	assert.Len(t, document.Attributes, 2)
+	require.Len(t, document.Permissions, 4)
+	assert.True(t, document.Permissions[2].Deprecated)
+	assert.Equal(t, "use view", document.Permissions[2].DeprecationMessage)
+	assert.True(t, document.Permissions[3].Sensitive)
+	assert.Equal(t, "finance", document.Permissions[3].SensitiveLabel)
+	assert.NotNil(t, parsed.GetEntity("user"))
+	assert.NotNil(t, parsed.GetRule("within_limit"))
+}
+
+func TestFormatSchema(t *testing.T) {
+	m, errs, err := parser.ParseFile("../schema.perm")
+	require.NoError(t, err)
+	require.Empty(t, errs)
+
+	p := parser.NewParser(parser.NewLexer(model.Format(m)))
+	formatted := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	// Formatting the reparsed model gives the same schema
+	assert.Equal(t, model.Format(m), model.Format(formatted))
+	assert.Len(t, formatted.Entities, len(m.Entities))
+	assert.Len(t, formatted.Rules, len(m.Rules))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -14,7 +15,9 @@ type Entity struct {
 	Permissions []Permission
 	Attributes  []Attribute
 	Rules       []Rule
-	Comments    []string
+	// DerivedRelations are relations implied by the entity's attributes
+	DerivedRelations []DerivedRelation
+	Comments         []string
 }
 
 // AttributeDataType defines the supported data types for attributes
@@ -188,10 +191,40 @@ func IsValidAttributeDataType(dataType string) bool {
 
 // Relation represents a relationship to another entity
 type Relation struct {
-	Name       string
-	Target     string // The entity type this relation refers to
-	Comments   []string
-	LineNumber int
+	Name   string
+	Target string // The entity type this relation refers to
+	// MaxSubjects caps how many subjects may hold the relation on one
+	// entity, declared as "relation owner @user max 1"; zero is no cap
+	MaxSubjects int
+	Comments    []string
+	LineNumber  int
+}
+
+// DerivedRelation gives every subject of SubjectType the relation on
+// entities whose Attribute is truthy, or equal to Value when one is given:
+//
+//	relation viewer @user:* when public
+//	relation viewer @user:* when status == "published"
+type DerivedRelation struct {
+	Name        string
+	SubjectType string
+	Attribute   string
+	Value       interface{} // nil when the attribute only has to be truthy
+	LineNumber  int
+}
+
+// String returns the declaration as written in a schema, without the
+// "relation" keyword
+func (d DerivedRelation) String() string {
+	s := d.Name + " @" + d.SubjectType + ":* when " + d.Attribute
+	switch v := d.Value.(type) {
+	case nil:
+		return s
+	case string:
+		return s + " == " + strconv.Quote(v)
+	default:
+		return s + fmt.Sprintf(" == %v", v)
+	}
 }
 
 // Permission represents an access control rule
@@ -201,6 +234,15 @@ type Permission struct {
 	ParsedExpr Expression
 	Comments   []string
 	LineNumber int
+	// Deprecated permissions are still checked, but callers are warned and
+	// their checks are always audited so they can be found before removal
+	Deprecated         bool
+	DeprecationMessage string
+	// Sensitive permissions, such as break-glass access, notify the
+	// configured webhook or SIEM log of every check that allows them.
+	// SensitiveLabel is the annotation's message, empty when it has none.
+	Sensitive      bool
+	SensitiveLabel string
 }
 
 // Expression interface for permission expressions
@@ -228,6 +270,15 @@ func (o *Or) String() string {
 	return "(" + o.Left.String() + " or " + o.Right.String() + ")"
 }
 
+// Not represents the negation of an expression, as in "editor and not banned"
+type Not struct {
+	Expr Expression
+}
+
+func (n *Not) String() string {
+	return "(not " + n.Expr.String() + ")"
+}
+
 // RelationRef refers to a relation, can be direct or nested (e.g., organization.owner)
 type RelationRef struct {
 	Entity string // Empty for direct relations
@@ -279,6 +330,20 @@ type RuleParameter struct {
 	DataType AttributeDataType
 }
 
+// RuleTest is a test block declared in the schema for a rule
+type RuleTest struct {
+	Rule       string
+	Cases      []RuleTestCase
+	LineNumber int
+}
+
+// RuleTestCase gives a rule's parameters and the result expected for them
+type RuleTestCase struct {
+	Inputs     map[string]interface{}
+	Expected   bool
+	LineNumber int
+}
+
 // RuleCall represents a call to a rule with arguments
 type RuleCall struct {
 	Name      string
@@ -321,6 +386,7 @@ func (l *LiteralValue) String() string {
 type PermissionModel struct {
 	Entities map[string]*Entity
 	Rules    map[string]*Rule  // Global rules indexed by name
+	Tests    []RuleTest        // Rule tests in declaration order
 	Source   string // Source file path
 }
 
@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelationMaxSubjects(t *testing.T) {
+	input := `entity document {
+    relation owner @user max 1
+    relation parent @folder max 1
+    relation viewer @user
+    permission view = owner or viewer
+}`
+
+	p := NewParser(NewLexer(input))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	document := m.GetEntity("document")
+	require.NotNil(t, document)
+	require.Len(t, document.Relations, 3)
+	assert.Equal(t, 1, document.Relations[0].MaxSubjects)
+	assert.Equal(t, "folder", document.Relations[1].Target)
+	assert.Equal(t, 1, document.Relations[1].MaxSubjects)
+	assert.Zero(t, document.Relations[2].MaxSubjects)
+	assert.Len(t, document.Permissions, 1)
+}
+
+func TestRelationMaxSubjectsMustBePositive(t *testing.T) {
+	for _, decl := range []string{"relation owner @user max 0", "relation owner @user max 1.5", "relation owner @user max"} {
+		p := NewParser(NewLexer("entity doc {\n    " + decl + "\n    relation viewer @user\n}"))
+		m := p.ParsePermissionModel()
+		require.Len(t, p.Errors(), 1, decl)
+		assert.Contains(t, p.Errors()[0], "max must be a whole number", decl)
+		relations := m.GetEntity("doc").Relations
+		require.Len(t, relations, 2, "the relation is kept without a cap")
+		assert.Zero(t, relations[0].MaxSubjects, decl)
+	}
+}
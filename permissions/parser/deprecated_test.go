@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeprecatedPermission(t *testing.T) {
+	input := `entity document {
+    relation owner @user
+    relation viewer @user
+    @deprecated("use view_v2")
+    permission view = owner
+    @deprecated
+    permission read = viewer
+    permission view_v2 = owner or viewer
+}`
+
+	p := NewParser(NewLexer(input))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	document := m.GetEntity("document")
+	require.NotNil(t, document)
+	require.Len(t, document.Relations, 2)
+	require.Len(t, document.Permissions, 3)
+
+	assert.Equal(t, "view", document.Permissions[0].Name)
+	assert.True(t, document.Permissions[0].Deprecated)
+	assert.Equal(t, "use view_v2", document.Permissions[0].DeprecationMessage)
+
+	assert.Equal(t, "read", document.Permissions[1].Name)
+	assert.True(t, document.Permissions[1].Deprecated)
+	assert.Empty(t, document.Permissions[1].DeprecationMessage)
+
+	assert.Equal(t, "owner or viewer", document.Permissions[2].Expression)
+	assert.False(t, document.Permissions[2].Deprecated)
+}
+
+func TestDeprecatedMustPrecedePermission(t *testing.T) {
+	for _, tc := range []struct {
+		decl string
+		err  string
+	}{
+		{`@deprecated("gone") relation owner @user`, "@deprecated must precede a permission"},
+		{`@internal permission edit = viewer`, "unknown annotation @internal"},
+	} {
+		p := NewParser(NewLexer("entity doc {\n    relation viewer @user\n    " + tc.decl + "\n    permission view = viewer\n}"))
+		m := p.ParsePermissionModel()
+		require.Len(t, p.Errors(), 1, tc.decl)
+		assert.Contains(t, p.Errors()[0], tc.err, tc.decl)
+
+		doc := m.GetEntity("doc")
+		require.NotNil(t, doc)
+		require.NotEmpty(t, doc.Permissions, tc.decl)
+		assert.Equal(t, "view", doc.Permissions[len(doc.Permissions)-1].Name, tc.decl)
+	}
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerivedRelations(t *testing.T) {
+	input := `entity project {
+    relation owner @user
+    attribute visibility string
+    attribute archived boolean
+    relation viewer @user:* when visibility == "public"
+    relation auditor @team:* when archived
+    permission view = owner or viewer
+}`
+
+	p := NewParser(NewLexer(input))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	project := m.GetEntity("project")
+	require.NotNil(t, project)
+	assert.Len(t, project.Relations, 1, "derived relations are kept apart from declared ones")
+	assert.Len(t, project.Permissions, 1)
+	assert.Equal(t, []model.DerivedRelation{
+		{Name: "viewer", SubjectType: "user", Attribute: "visibility", Value: "public", LineNumber: 5},
+		{Name: "auditor", SubjectType: "team", Attribute: "archived", LineNumber: 6},
+	}, project.DerivedRelations)
+
+	assert.Equal(t, `viewer @user:* when visibility == "public"`, project.DerivedRelations[0].String())
+	assert.Equal(t, "auditor @team:* when archived", project.DerivedRelations[1].String())
+}
+
+func TestDerivedRelationNeedsAttribute(t *testing.T) {
+	p := NewParser(NewLexer("entity doc {\n    relation viewer @user:*\n    relation owner @user\n}"))
+	m := p.ParsePermissionModel()
+	require.Len(t, p.Errors(), 1)
+	assert.Contains(t, p.Errors()[0], "expected 'when' after @user:*")
+	assert.Empty(t, m.GetEntity("doc").DerivedRelations)
+	assert.Len(t, m.GetEntity("doc").Relations, 1, "parsing continues with the next declaration")
+}
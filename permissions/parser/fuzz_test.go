@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// FuzzParsePermissionModel checks that no input panics or hangs the .perm
+// parser. It is seeded with the example schema, whole and split into its
+// entity and rule blocks. Failing inputs are saved under testdata/fuzz and
+// rerun by go test as regression cases.
+func FuzzParsePermissionModel(f *testing.F) {
+	schema, err := os.ReadFile("../schema.perm")
+	if err != nil {
+		f.Fatalf("failed to read example schema: %v", err)
+	}
+	f.Add(string(schema))
+	for _, block := range strings.Split(string(schema), "\n}") {
+		f.Add(block + "\n}")
+	}
+	for _, seed := range []string{
+		"",
+		"entity user {}",
+		"entity doc { relation owner @user permission view = owner }",
+		"entity doc { attribute tags string[] }",
+		"rule r(a integer) { a > 1 }",
+		"entity doc { permission view = (owner or",
+		"rule r(a integer { a",
+		"rule r(s string) { s == 'it\\'s' }",
+		"entity doc { @deprecated(\"unterminated permission view = owner }",
+		"entity { relation @ }",
+		"// comment only",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := NewParser(NewLexer(input))
+		if p.ParsePermissionModel() == nil {
+			t.Fatalf("ParsePermissionModel(%q) returned nil", input)
+		}
+	})
+}
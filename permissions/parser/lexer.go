@@ -2,6 +2,8 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
 	"unicode"
 )
 
@@ -13,6 +15,7 @@ type Lexer struct {
 	ch           rune // current char under examination
 	line         int
 	column       int
+	errors       []string
 }
 
 // NewLexer creates a new Lexer
@@ -78,7 +81,10 @@ func (l *Lexer) NextToken() Token {
 	case '@':
 		tok = Token{Type: TokenAt, Literal: string(l.ch), Line: l.line, Column: l.column}
 	case '=':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = Token{Type: TokenArrow, Literal: "=>", Line: l.line, Column: l.column - 1}
+		} else if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
@@ -121,10 +127,24 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: TokenDot, Literal: string(l.ch), Line: l.line, Column: l.column}
 	case ',':
 		tok = Token{Type: TokenComma, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case ':':
+		tok = Token{Type: TokenColon, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '*':
+		tok = Token{Type: TokenStar, Literal: string(l.ch), Line: l.line, Column: l.column}
+	case '"', '\'':
+		line, column := l.line, l.column
+		literal, ok := l.readString()
+		if !ok {
+			return Token{Type: TokenIllegal, Literal: literal, Line: line, Column: column}
+		}
+		return Token{Type: TokenString, Literal: literal, Line: line, Column: column}
 	case 0:
 		tok = Token{Type: TokenEOF, Literal: "", Line: l.line, Column: l.column}
 	default:
-		if isLetter(l.ch) {
+		if isDigit(l.ch) || (l.ch == '-' && isDigit(l.peekChar())) {
+			line, column := l.line, l.column
+			return Token{Type: TokenNumber, Literal: l.readNumber(), Line: line, Column: column}
+		} else if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = lookupIdent(tok.Literal)
 			tok.Line = l.line
@@ -148,6 +168,96 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// readNumber reads an integer or decimal, with an optional leading minus
+func (l *Lexer) readNumber() string {
+	position := l.position
+	if l.ch == '-' {
+		l.readChar()
+	}
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+	return l.input[position:l.position]
+}
+
+// readString reads a string in single or double quotes, including its
+// quotes, so rule bodies rebuilt from token literals keep them. The escapes
+// are those unquote decodes. It reports false, recording the error, for a
+// string not closed on its line or with an unknown escape.
+func (l *Lexer) readString() (string, bool) {
+	position, line, column := l.position, l.line, l.column
+	quote := l.ch
+	l.readChar() // opening quote
+	valid := true
+	for l.ch != quote {
+		if l.ch == 0 || l.ch == '\n' {
+			l.addError(fmt.Sprintf("unterminated string starting at line %d, column %d", line, column))
+			return l.input[position:l.position], false
+		}
+		if l.ch == '\\' && l.peekChar() != 0 && l.peekChar() != '\n' {
+			if _, ok := stringEscapes[l.peekChar()]; !ok && valid {
+				l.addError(fmt.Sprintf("invalid escape \\%c in string (line %d, column %d)", l.peekChar(), l.line, l.column))
+				valid = false
+			}
+			l.readChar()
+		}
+		l.readChar()
+	}
+	l.readChar() // closing quote
+	return l.input[position:l.position], valid
+}
+
+// stringEscapes maps the character after a backslash in a string to the
+// character it stands for
+var stringEscapes = map[rune]byte{
+	'\\': '\\',
+	'\'': '\'',
+	'"':  '"',
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+}
+
+// unquote returns the value of a string literal read by readString
+func unquote(literal string) (string, error) {
+	if len(literal) < 2 || (literal[0] != '"' && literal[0] != '\'') || literal[len(literal)-1] != literal[0] {
+		return "", fmt.Errorf("invalid string %s", literal)
+	}
+	body := literal[1 : len(literal)-1]
+	var sb strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' {
+			sb.WriteByte(body[i])
+			continue
+		}
+		i++
+		if i == len(body) {
+			return "", fmt.Errorf("invalid string %s", literal)
+		}
+		c, ok := stringEscapes[rune(body[i])]
+		if !ok {
+			return "", fmt.Errorf("invalid escape \\%c in string %s", body[i], literal)
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String(), nil
+}
+
+// Errors returns the errors found reading strings, in the order found
+func (l *Lexer) Errors() []string {
+	return l.errors
+}
+
+func (l *Lexer) addError(msg string) {
+	l.errors = append(l.errors, msg)
+}
+
 // skipComment skips over a comment line
 func (l *Lexer) skipComment() {
 	// Skip the initial //
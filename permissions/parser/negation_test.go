@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotExpressions(t *testing.T) {
+	input := `entity document {
+    relation editor @user
+    relation viewer @user
+    relation banned @user
+    permission edit = editor and not banned
+    permission view = not banned and (editor or viewer)
+    permission hidden = not (editor or viewer)
+}`
+
+	p := NewParser(NewLexer(input))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	doc := m.GetEntity("document")
+	require.NotNil(t, doc)
+	require.Len(t, doc.Permissions, 3)
+
+	edit := doc.Permissions[0]
+	assert.Equal(t, "editor and not banned", edit.Expression)
+	assert.Equal(t, &model.And{
+		Left:  &model.RelationRef{Name: "editor"},
+		Right: &model.Not{Expr: &model.RelationRef{Name: "banned"}},
+	}, edit.ParsedExpr)
+
+	assert.Equal(t, "not banned and (editor or viewer)", doc.Permissions[1].Expression)
+	assert.Equal(t, "((not banned) and ((editor or viewer)))", doc.Permissions[1].ParsedExpr.String())
+	assert.Equal(t, "(not ((editor or viewer)))", doc.Permissions[2].ParsedExpr.String())
+}
+
+func TestNotNeedsOperand(t *testing.T) {
+	p := NewParser(NewLexer("entity doc {\n    relation banned @user\n    permission view = not\n}"))
+	p.ParsePermissionModel()
+	assert.NotEmpty(t, p.Errors())
+}
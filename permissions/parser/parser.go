@@ -3,6 +3,7 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/dangerclosesec/supra/permissions/model"
@@ -14,6 +15,8 @@ type Parser struct {
 	curToken  Token
 	peekToken Token
 	errors    []string
+	// lexErrors is how many of the lexer's errors are in errors
+	lexErrors int
 	// We'll use a different approach for comments that doesn't interfere with parsing
 	currentComments []string
 }
@@ -37,6 +40,11 @@ func NewParser(l *Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	if p.peekToken.Type == TokenIllegal {
+		// The lexer records why a string is illegal, with its position
+		p.errors = append(p.errors, p.l.Errors()[p.lexErrors:]...)
+		p.lexErrors = len(p.l.Errors())
+	}
 }
 
 // Errors returns the parser errors
@@ -49,6 +57,7 @@ func (p *Parser) ParsePermissionModel() *model.PermissionModel {
 	permModel := model.NewPermissionModel()
 
 	for p.curToken.Type != TokenEOF {
+		start := p.curToken
 		if p.curToken.Type == TokenEntity {
 			entity := p.parseEntity()
 			if entity != nil {
@@ -60,10 +69,17 @@ func (p *Parser) ParsePermissionModel() *model.PermissionModel {
 				// Add the rule to the global rules map
 				permModel.AddRule(rule)
 			}
+		} else if p.curTokenIs(TokenIdent) && p.curToken.Literal == "test" && p.peekTokenIs(TokenIdent) {
+			// "test" is only a keyword here, so it stays usable as a name
+			test := p.parseRuleTest()
+			if test != nil {
+				permModel.Tests = append(permModel.Tests, *test)
+			}
 		} else {
 			// Skip any unexpected tokens at the top level
 			p.nextToken()
 		}
+		p.skipIfStuck(start)
 	}
 
 	return permModel
@@ -88,11 +104,15 @@ func (p *Parser) parseEntity() *model.Entity {
 
 	// Parse relations, permissions, attributes, and rules
 	for p.curToken.Type != TokenRBrace && p.curToken.Type != TokenEOF {
+		start := p.curToken
 		if p.curToken.Type == TokenRelation {
-			relation := p.parseRelation()
+			relation, derived := p.parseRelation()
 			if relation != nil {
 				entity.Relations = append(entity.Relations, *relation)
 			}
+			if derived != nil {
+				entity.DerivedRelations = append(entity.DerivedRelations, *derived)
+			}
 		} else if p.curToken.Type == TokenPermission {
 			permission := p.parsePermission()
 			if permission != nil {
@@ -108,10 +128,16 @@ func (p *Parser) parseEntity() *model.Entity {
 			if rule != nil {
 				entity.Rules = append(entity.Rules, *rule)
 			}
+		} else if p.curToken.Type == TokenAt {
+			permission := p.parseAnnotated()
+			if permission != nil {
+				entity.Permissions = append(entity.Permissions, *permission)
+			}
 		} else {
 			// Skip unexpected tokens within entity body
 			p.nextToken()
 		}
+		p.skipIfStuck(start)
 	}
 
 	// Consume the closing brace
@@ -122,13 +148,14 @@ func (p *Parser) parseEntity() *model.Entity {
 	return entity
 }
 
-// parseRelation parses a relation declaration
-func (p *Parser) parseRelation() *model.Relation {
+// parseRelation parses a relation declaration, or a derived relation when
+// the target is a wildcard such as @user:*
+func (p *Parser) parseRelation() (*model.Relation, *model.DerivedRelation) {
 	startLine := p.curToken.Line
 
 	// "relation" keyword is already consumed
 	if !p.expectPeek(TokenIdent) {
-		return nil
+		return nil, nil
 	}
 
 	relation := &model.Relation{
@@ -137,19 +164,39 @@ func (p *Parser) parseRelation() *model.Relation {
 	}
 
 	if !p.expectPeek(TokenAt) {
-		return nil
+		return nil, nil
 	}
 
 	if !p.expectPeek(TokenIdent) {
-		return nil
+		return nil, nil
 	}
 
 	relation.Target = p.curToken.Literal
 
+	if p.peekTokenIs(TokenColon) {
+		derived := p.parseDerivedRelation(relation)
+		p.skipToNextStatement()
+		return nil, derived
+	}
+
+	if p.peekTokenIs(TokenIdent) && p.peekToken.Literal == "max" {
+		p.nextToken()
+		limit := p.peekToken.Literal
+		if p.peekTokenIs(TokenNumber) {
+			p.nextToken()
+		}
+		if n, err := strconv.Atoi(limit); err != nil || n < 1 {
+			p.addError(fmt.Sprintf("relation %s: max must be a whole number of at least 1, got %q", relation.Name, limit))
+		} else {
+			relation.MaxSubjects = n
+		}
+	}
+
 	// Consume any tokens until we reach a new statement or the end of the entity
 	for p.peekToken.Type != TokenRelation &&
 		p.peekToken.Type != TokenPermission &&
 		p.peekToken.Type != TokenAttribute &&
+		p.peekToken.Type != TokenAt &&
 		p.peekToken.Type != TokenRBrace &&
 		p.peekToken.Type != TokenEOF {
 		p.nextToken()
@@ -158,7 +205,57 @@ func (p *Parser) parseRelation() *model.Relation {
 	// Move to the next token to prepare for the next statement
 	p.nextToken()
 
-	return relation
+	return relation, nil
+}
+
+// parseDerivedRelation parses the ":* when attribute [== value]" that
+// follows a relation's target type, leaving the current token on its last
+// token
+func (p *Parser) parseDerivedRelation(relation *model.Relation) *model.DerivedRelation {
+	derived := &model.DerivedRelation{
+		Name:        relation.Name,
+		SubjectType: relation.Target,
+		LineNumber:  relation.LineNumber,
+	}
+
+	if !p.expectPeek(TokenColon) || !p.expectPeek(TokenStar) {
+		return nil
+	}
+	if !p.peekTokenIs(TokenIdent) || p.peekToken.Literal != "when" {
+		p.addError(fmt.Sprintf("expected 'when' after @%s:*; a wildcard relation must name the attribute it derives from", relation.Target))
+		return nil
+	}
+	p.nextToken()
+	if !p.expectPeek(TokenIdent) {
+		return nil
+	}
+	derived.Attribute = p.curToken.Literal
+
+	if p.peekTokenIs(TokenEQ) {
+		p.nextToken()
+		p.nextToken()
+		value, ok := p.parseLiteral()
+		if !ok {
+			return nil
+		}
+		derived.Value = value
+	}
+	return derived
+}
+
+// skipToNextStatement moves to the first token of the next declaration in
+// an entity body
+func (p *Parser) skipToNextStatement() {
+	for p.peekToken.Type != TokenRelation &&
+		p.peekToken.Type != TokenPermission &&
+		p.peekToken.Type != TokenAttribute &&
+		p.peekToken.Type != TokenRule &&
+		p.peekToken.Type != TokenAt &&
+		p.peekToken.Type != TokenRBrace &&
+		p.peekToken.Type != TokenEOF {
+		p.nextToken()
+	}
+	p.nextToken()
 }
 
 // parsePermission parses a permission declaration
@@ -191,6 +288,7 @@ func (p *Parser) parsePermission() *model.Permission {
 		for p.peekToken.Type != TokenRelation &&
 			p.peekToken.Type != TokenPermission &&
 			p.peekToken.Type != TokenAttribute &&
+			p.peekToken.Type != TokenAt &&
 			p.peekToken.Type != TokenRBrace &&
 			p.peekToken.Type != TokenEOF {
 			p.nextToken()
@@ -206,6 +304,7 @@ func (p *Parser) parsePermission() *model.Permission {
 	for p.curToken.Type != TokenRelation &&
 		p.curToken.Type != TokenPermission &&
 		p.curToken.Type != TokenAttribute &&
+		p.curToken.Type != TokenAt &&
 		p.curToken.Type != TokenRBrace &&
 		p.curToken.Type != TokenEOF {
 		p.nextToken()
@@ -214,6 +313,74 @@ func (p *Parser) parsePermission() *model.Permission {
 	return nil
 }
 
+// parseAnnotated parses the annotations preceding a permission and the
+// permission they mark: @deprecated("message"), whose message usually names
+// the replacement, and @sensitive("label"), whose label says what the
+// permission guards. Both messages are optional, and the two may be
+// stacked.
+func (p *Parser) parseAnnotated() *model.Permission {
+	var annotations model.Permission
+	var last string
+	for p.curToken.Type == TokenAt {
+		// "@" is the current token
+		if !p.expectPeek(TokenIdent) {
+			return nil
+		}
+		name := p.curToken.Literal
+		if name != "deprecated" && name != "sensitive" {
+			p.addError(fmt.Sprintf("unknown annotation @%s", name))
+			p.skipToNextStatement()
+			return nil
+		}
+
+		var message string
+		if p.peekTokenIs(TokenLParen) {
+			p.nextToken()
+			if !p.expectPeek(TokenString) {
+				p.skipToNextStatement()
+				return nil
+			}
+			unquoted, err := unquote(p.curToken.Literal)
+			if err != nil {
+				p.addError(fmt.Sprintf("invalid @%s message %s", name, p.curToken.Literal))
+			}
+			message = unquoted
+			if !p.expectPeek(TokenRParen) {
+				p.skipToNextStatement()
+				return nil
+			}
+		}
+
+		switch name {
+		case "deprecated":
+			annotations.Deprecated, annotations.DeprecationMessage = true, message
+		case "sensitive":
+			annotations.Sensitive, annotations.SensitiveLabel = true, message
+		}
+		last = name
+
+		if p.peekTokenIs(TokenAt) {
+			p.nextToken()
+		}
+	}
+
+	if !p.peekTokenIs(TokenPermission) {
+		p.addError(fmt.Sprintf("@%s must precede a permission, got %q", last, p.peekToken.Literal))
+		p.skipToNextStatement()
+		return nil
+	}
+	p.nextToken()
+
+	permission := p.parsePermission()
+	if permission != nil {
+		permission.Deprecated = annotations.Deprecated
+		permission.DeprecationMessage = annotations.DeprecationMessage
+		permission.Sensitive = annotations.Sensitive
+		permission.SensitiveLabel = annotations.SensitiveLabel
+	}
+	return permission
+}
+
 // parseAttribute parses an attribute declaration
 func (p *Parser) parseAttribute() *model.Attribute {
 	startLine := p.curToken.Line
@@ -262,6 +429,7 @@ func (p *Parser) parseAttribute() *model.Attribute {
 		p.peekToken.Type != TokenPermission &&
 		p.peekToken.Type != TokenAttribute &&
 		p.peekToken.Type != TokenRule &&
+		p.peekToken.Type != TokenAt &&
 		p.peekToken.Type != TokenRBrace &&
 		p.peekToken.Type != TokenEOF {
 		p.nextToken()
@@ -394,6 +562,174 @@ func (p *Parser) parseRule() *model.Rule {
 	return rule
 }
 
+// parseRuleTest parses a test block for a rule. Each case names the rule's
+// parameters and the result expected for them:
+//
+//	test check_balance {
+//	    balance = 100, amount = 50 => true
+//	    balance = 10, amount = 50 => false
+//	}
+func (p *Parser) parseRuleTest() *model.RuleTest {
+	// "test" is the current token
+	test := &model.RuleTest{LineNumber: p.curToken.Line}
+
+	p.nextToken()
+	test.Rule = p.curToken.Literal
+
+	if !p.expectPeek(TokenLBrace) {
+		return nil
+	}
+	p.nextToken()
+
+	for p.curToken.Type != TokenRBrace && p.curToken.Type != TokenEOF {
+		start := p.curToken
+		if testCase, ok := p.parseRuleTestCase(); ok {
+			test.Cases = append(test.Cases, testCase)
+		}
+		p.skipIfStuck(start)
+	}
+
+	if p.curToken.Type != TokenRBrace {
+		p.addError(fmt.Sprintf("expected closing brace for test of rule %s", test.Rule))
+		return nil
+	}
+	p.nextToken()
+
+	return test
+}
+
+// parseRuleTestCase parses "name = value, ... => true|false", leaving the
+// current token after the expected result. A malformed case is skipped up
+// to its result so parsing resumes with the next one.
+func (p *Parser) parseRuleTestCase() (model.RuleTestCase, bool) {
+	testCase, ok := p.parseRuleTestInputs()
+	if !ok {
+		for !p.curTokenIs(TokenArrow) && !p.curTokenIs(TokenRBrace) && !p.curTokenIs(TokenEOF) {
+			p.nextToken()
+		}
+		if !p.curTokenIs(TokenArrow) {
+			return testCase, false
+		}
+	}
+
+	p.nextToken() // Move past =>
+	switch {
+	case p.curTokenIs(TokenIdent) && p.curToken.Literal == "true":
+		testCase.Expected = true
+	case p.curTokenIs(TokenIdent) && p.curToken.Literal == "false":
+		testCase.Expected = false
+	default:
+		if ok {
+			p.addError(fmt.Sprintf("expected true or false after '=>', got %q", p.curToken.Literal))
+		}
+		if !p.curTokenIs(TokenRBrace) && !p.curTokenIs(TokenEOF) {
+			p.nextToken()
+		}
+		return testCase, false
+	}
+	p.nextToken()
+
+	return testCase, ok
+}
+
+// parseRuleTestInputs parses a case's "name = value" list, leaving the
+// current token on the =>
+func (p *Parser) parseRuleTestInputs() (model.RuleTestCase, bool) {
+	testCase := model.RuleTestCase{
+		Inputs:     make(map[string]interface{}),
+		LineNumber: p.curToken.Line,
+	}
+
+	for !p.curTokenIs(TokenArrow) {
+		if !p.curTokenIs(TokenIdent) {
+			p.addError(fmt.Sprintf("expected parameter name in rule test, got %q", p.curToken.Literal))
+			return testCase, false
+		}
+		name := p.curToken.Literal
+		if _, dup := testCase.Inputs[name]; dup {
+			p.addError(fmt.Sprintf("parameter %s is given twice", name))
+			return testCase, false
+		}
+		if !p.expectPeek(TokenEquals) {
+			return testCase, false
+		}
+		p.nextToken()
+
+		value, ok := p.parseLiteral()
+		if !ok {
+			return testCase, false
+		}
+		testCase.Inputs[name] = value
+		p.nextToken()
+
+		if p.curTokenIs(TokenComma) {
+			p.nextToken()
+		} else if !p.curTokenIs(TokenArrow) {
+			p.addError(fmt.Sprintf("expected ',' or '=>' after parameter %s", name))
+			return testCase, false
+		}
+	}
+	return testCase, true
+}
+
+// parseLiteral parses a literal value, as given to rule tests and derived
+// relations: a number, string, boolean or a bracketed list of them. The current token is left on the
+// value's last token.
+func (p *Parser) parseLiteral() (interface{}, bool) {
+	switch p.curToken.Type {
+	case TokenNumber:
+		if !strings.Contains(p.curToken.Literal, ".") {
+			if n, err := strconv.ParseInt(p.curToken.Literal, 10, 64); err == nil {
+				return n, true
+			}
+		}
+		f, err := strconv.ParseFloat(p.curToken.Literal, 64)
+		if err != nil {
+			p.addError(fmt.Sprintf("invalid number %s", p.curToken.Literal))
+			return nil, false
+		}
+		return f, true
+	case TokenString:
+		s, err := unquote(p.curToken.Literal)
+		if err != nil {
+			p.addError(err.Error())
+			return nil, false
+		}
+		return s, true
+	case TokenIdent:
+		switch p.curToken.Literal {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+	case TokenLBracket:
+		values := []interface{}{}
+		if p.peekTokenIs(TokenRBracket) {
+			p.nextToken()
+			return values, true
+		}
+		for {
+			p.nextToken()
+			value, ok := p.parseLiteral()
+			if !ok {
+				return nil, false
+			}
+			values = append(values, value)
+			if p.peekTokenIs(TokenComma) {
+				p.nextToken()
+				continue
+			}
+			if !p.expectPeek(TokenRBracket) {
+				return nil, false
+			}
+			return values, true
+		}
+	}
+	p.addError(fmt.Sprintf("expected a number, string, boolean or list, got %q", p.curToken.Literal))
+	return nil, false
+}
+
 // parseRuleExpression parses the expression within a rule
 func (p *Parser) parseRuleExpression() (model.Expression, string) {
 	// For simplicity in testing, just capture the expression as a string
@@ -522,6 +858,16 @@ func (p *Parser) parseExpression(precedence int) (model.Expression, string) {
 			}
 			leftStr = p.curToken.Literal
 		}
+	case TokenNot:
+		p.nextToken() // Move past not
+		// The operand binds tighter than and/or, so "not a and b" negates
+		// only a
+		operand, operandStr := p.parseExpression(NOT)
+		if operand == nil {
+			return nil, ""
+		}
+		leftExpr = &model.Not{Expr: operand}
+		leftStr = "not " + operandStr
 	case TokenLParen:
 		p.nextToken() // Move past the opening parenthesis
 		innerExpr, innerStr := p.parseExpression(LOWEST)
@@ -544,6 +890,7 @@ func (p *Parser) parseExpression(precedence int) (model.Expression, string) {
 
 		p.nextToken() // Move to the operator
 		infix := p.curToken.Literal
+		operator := p.curToken.Type
 
 		precedence := p.curPrecedence()
 		p.nextToken() // Move past the operator
@@ -553,7 +900,9 @@ func (p *Parser) parseExpression(precedence int) (model.Expression, string) {
 			return nil, ""
 		}
 
-		if p.curTokenIs(TokenAnd) {
+		// The right operand has been consumed, so the operator is
+		// remembered rather than read from the current token
+		if operator == TokenAnd {
 			leftExpr = &model.And{Left: leftExpr, Right: rightExpr}
 		} else {
 			leftExpr = &model.Or{Left: leftExpr, Right: rightExpr}
@@ -570,7 +919,8 @@ const (
 	LOWEST  = 1
 	OR      = 2
 	AND     = 3
-	PRIMARY = 4
+	NOT     = 4
+	PRIMARY = 5
 )
 
 // peekPrecedence returns the precedence of the peek token
@@ -616,6 +966,14 @@ func (p *Parser) expectPeek(t TokenType) bool {
 	return false
 }
 
+// skipIfStuck moves past start when a declaration failed without consuming
+// it, so malformed input such as a bare "entity" can't loop forever
+func (p *Parser) skipIfStuck(start Token) {
+	if p.curToken == start {
+		p.nextToken()
+	}
+}
+
 // addError adds an error to the parser errors
 func (p *Parser) addError(msg string) {
 	errorMsg := fmt.Sprintf("%s (line %d, column %d)", msg, p.curToken.Line, p.curToken.Column)
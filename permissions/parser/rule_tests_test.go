@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleTestBlocks(t *testing.T) {
+	input := `rule within_limit(amount double, limit integer, regions string[]) {
+    amount <= limit
+}
+
+// A relation may still be called test
+entity doc {
+    relation test @user
+}
+
+test within_limit {
+    amount = 10.5, limit = 20, regions = ["eu", "us"] => true
+    amount = -1, limit = 0, regions = [] => false
+}`
+
+	p := NewParser(NewLexer(input))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	assert.Equal(t, "test", m.GetEntity("doc").Relations[0].Name)
+	assert.Equal(t, "amount <= limit", m.GetRule("within_limit").Expression)
+
+	require.Len(t, m.Tests, 1)
+	test := m.Tests[0]
+	assert.Equal(t, "within_limit", test.Rule)
+	assert.Equal(t, []model.RuleTestCase{
+		{
+			Inputs:     map[string]interface{}{"amount": 10.5, "limit": int64(20), "regions": []interface{}{"eu", "us"}},
+			Expected:   true,
+			LineNumber: 11,
+		},
+		{
+			Inputs:     map[string]interface{}{"amount": int64(-1), "limit": int64(0), "regions": []interface{}{}},
+			Expected:   false,
+			LineNumber: 12,
+		},
+	}, test.Cases)
+}
+
+func TestRuleTestBlockErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"missing result", "test r {\n a = 1 =>\n}", "expected true or false"},
+		{"bad value", "test r {\n a = maybe => true\n}", "expected a number, string, boolean or list"},
+		{"duplicate parameter", "test r {\n a = 1, a = 2 => true\n}", "parameter a is given twice"},
+		{"unterminated", "test r {\n a = 1 => true\n", "expected closing brace"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser(NewLexer(tt.input))
+			p.ParsePermissionModel()
+			require.NotEmpty(t, p.Errors())
+			assert.Contains(t, p.Errors()[0], tt.err)
+		})
+	}
+}
+
+func TestRuleTestCaseRecovery(t *testing.T) {
+	p := NewParser(NewLexer("test r {\n a = oops => true\n a = 1 => false\n}"))
+	m := p.ParsePermissionModel()
+	assert.Len(t, p.Errors(), 1)
+	require.Len(t, m.Tests, 1)
+	assert.Len(t, m.Tests[0].Cases, 1, "parsing resumes with the next case")
+}
+
+func TestLexNumbersAndStrings(t *testing.T) {
+	l := NewLexer(`10 -2.5 "a \"b\"" "open` + "\n")
+	for _, want := range []Token{
+		{Type: TokenNumber, Literal: "10"},
+		{Type: TokenNumber, Literal: "-2.5"},
+		{Type: TokenString, Literal: `"a \"b\""`},
+		{Type: TokenIllegal, Literal: `"open`},
+	} {
+		tok := l.NextToken()
+		assert.Equal(t, want.Type, tok.Type, want.Literal)
+		assert.Equal(t, want.Literal, tok.Literal)
+	}
+}
+
+func TestRuleBodyKeepsNumbers(t *testing.T) {
+	p := NewParser(NewLexer("rule r(a integer) {\n    a >= 10 and a != 12.5\n}"))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+	assert.Equal(t, "a >= 10 and a != 12.5", m.GetRule("r").Expression)
+}
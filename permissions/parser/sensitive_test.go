@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSensitivePermission(t *testing.T) {
+	input := `entity account {
+    relation owner @user
+    relation responder @user
+    @sensitive("break-glass")
+    permission emergency_access = responder
+    @deprecated("use emergency_access") @sensitive
+    permission override = responder
+    @sensitive
+    @deprecated
+    permission close = owner
+    permission view = owner
+}`
+
+	p := NewParser(NewLexer(input))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	account := m.GetEntity("account")
+	require.NotNil(t, account)
+	require.Len(t, account.Permissions, 4)
+
+	assert.True(t, account.Permissions[0].Sensitive)
+	assert.Equal(t, "break-glass", account.Permissions[0].SensitiveLabel)
+	assert.False(t, account.Permissions[0].Deprecated)
+
+	assert.True(t, account.Permissions[1].Sensitive)
+	assert.Empty(t, account.Permissions[1].SensitiveLabel)
+	assert.True(t, account.Permissions[1].Deprecated)
+	assert.Equal(t, "use emergency_access", account.Permissions[1].DeprecationMessage)
+
+	assert.True(t, account.Permissions[2].Sensitive)
+	assert.True(t, account.Permissions[2].Deprecated)
+
+	assert.Equal(t, "view", account.Permissions[3].Name)
+	assert.False(t, account.Permissions[3].Sensitive)
+}
+
+func TestSensitiveMustPrecedePermission(t *testing.T) {
+	p := NewParser(NewLexer("entity doc {\n    relation viewer @user\n    @sensitive relation owner @user\n    permission view = viewer\n}"))
+	m := p.ParsePermissionModel()
+	require.Len(t, p.Errors(), 1)
+	assert.Contains(t, p.Errors()[0], "@sensitive must precede a permission")
+	require.NotNil(t, m.GetEntity("doc"))
+}
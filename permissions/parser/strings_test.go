@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLexStrings(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		value string
+	}{
+		{`"plain"`, "plain"},
+		{`'plain'`, "plain"},
+		{`'it\'s'`, "it's"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`'say "hi"'`, `say "hi"`},
+		{`"a\\b\tc\nd\re"`, "a\\b\tc\nd\re"},
+		{`''`, ""},
+	} {
+		l := NewLexer(tc.input)
+		tok := l.NextToken()
+		require.Equal(t, TokenString, tok.Type, tc.input)
+		assert.Equal(t, tc.input, tok.Literal, tc.input)
+		assert.Empty(t, l.Errors(), tc.input)
+
+		value, err := unquote(tok.Literal)
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, tc.value, value, tc.input)
+		assert.Equal(t, TokenEOF, l.NextToken().Type, tc.input)
+	}
+}
+
+func TestLexStringErrors(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		err   string
+	}{
+		{"x = 'open", "unterminated string starting at line 1, column 5"},
+		{"x = \"open\ny", "unterminated string starting at line 1, column 5"},
+		{"\n  'ends with escape\\", "unterminated string starting at line 2, column 3"},
+		{`"bad \q escape"`, `invalid escape \q in string (line 1, column 6)`},
+	} {
+		l := NewLexer(tc.input)
+		var illegal bool
+		for tok := l.NextToken(); tok.Type != TokenEOF; tok = l.NextToken() {
+			illegal = illegal || tok.Type == TokenIllegal
+		}
+		assert.True(t, illegal, tc.input)
+		require.Len(t, l.Errors(), 1, tc.input)
+		assert.Equal(t, tc.err, l.Errors()[0], tc.input)
+	}
+}
+
+func TestParseQuotedStrings(t *testing.T) {
+	input := `entity document {
+    relation owner @user
+    @deprecated('use "edit" instead')
+    permission write = owner
+}
+
+rule named(name string) {
+    name == 'O\'Brien'
+}
+
+test named {
+    name = 'O\'Brien' => true
+    name = "tab\there" => false
+}`
+
+	p := NewParser(NewLexer(input))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	document := m.GetEntity("document")
+	require.NotNil(t, document)
+	require.Len(t, document.Permissions, 1)
+	assert.Equal(t, `use "edit" instead`, document.Permissions[0].DeprecationMessage)
+
+	rule := m.Rules["named"]
+	require.NotNil(t, rule)
+	assert.Equal(t, `name == 'O\'Brien'`, rule.Expression)
+
+	require.Len(t, m.Tests, 1)
+	require.Len(t, m.Tests[0].Cases, 2)
+	assert.Equal(t, "O'Brien", m.Tests[0].Cases[0].Inputs["name"])
+	assert.Equal(t, "tab\there", m.Tests[0].Cases[1].Inputs["name"])
+}
+
+func TestParseUnterminatedString(t *testing.T) {
+	input := `entity document {
+    relation owner @user
+    @deprecated('never closed)
+    permission write = owner
+}`
+
+	p := NewParser(NewLexer(input))
+	p.ParsePermissionModel()
+	require.NotEmpty(t, p.Errors())
+	assert.Equal(t, "unterminated string starting at line 3, column 17", p.Errors()[0])
+}
@@ -20,6 +20,8 @@ const (
 
 	// Identifiers and literals
 	TokenIdent
+	TokenNumber // 42, -1.5
+	TokenString // "quoted", kept with its quotes
 
 	// Keywords
 	TokenEntity
@@ -37,11 +39,14 @@ const (
 	TokenEquals    // =
 	TokenOr        // or
 	TokenAnd       // and
+	TokenNot       // not
 	TokenLParen    // (
 	TokenRParen    // )
 	TokenDot       // .
 	TokenComma     // ,
 	TokenSemicolon // ;
+	TokenColon     // :
+	TokenStar      // *
 	
 	// Comparison operators
 	TokenGT        // >
@@ -50,6 +55,9 @@ const (
 	TokenLTE       // <=
 	TokenEQ        // ==
 	TokenNEQ       // !=
+
+	// Rule tests
+	TokenArrow // =>
 )
 
 // Keywords maps keyword strings to token types
@@ -61,4 +69,5 @@ var Keywords = map[string]TokenType{
 	"rule":       TokenRule,
 	"or":         TokenOr,
 	"and":        TokenAnd,
+	"not":        TokenNot,
 }
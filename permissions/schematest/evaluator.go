@@ -0,0 +1,537 @@
+package schematest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// Ref names an entity, written type:id
+type Ref struct {
+	Type string
+	ID   string
+}
+
+// ParseRef parses a type:id reference
+func ParseRef(s string) (Ref, error) {
+	entityType, id, ok := strings.Cut(s, ":")
+	if !ok || entityType == "" || id == "" {
+		return Ref{}, fmt.Errorf("%q is not in type:id form", s)
+	}
+	return Ref{Type: entityType, ID: id}, nil
+}
+
+func (r Ref) String() string {
+	return r.Type + ":" + r.ID
+}
+
+// relationship is a stored object#relation@subject, with SubjectRelation
+// set when the subject is a subject set
+type relationship struct {
+	Relation        string
+	Subject         Ref
+	SubjectRelation string
+}
+
+// Evaluator decides checks against a permission model and relationships
+// and attributes held in memory. Permissions are evaluated from the model's
+// parsed expressions: a name is the entity's relation, permission or
+// attribute, parent.name is name on each entity related through parent,
+// subject.name and object.name are attributes, request.name is true when
+// the check's context sets it, and rules are evaluated as the graph does.
+type Evaluator struct {
+	model         *model.PermissionModel
+	relationships map[Ref][]relationship
+	attributes    map[Ref]map[string]interface{}
+}
+
+// NewEvaluator returns an Evaluator with no relationships or attributes
+func NewEvaluator(m *model.PermissionModel) *Evaluator {
+	return &Evaluator{
+		model:         m,
+		relationships: make(map[Ref][]relationship),
+		attributes:    make(map[Ref]map[string]interface{}),
+	}
+}
+
+// AddRelationship adds a relationship written object#relation@subject, or
+// object#relation@subject#relation for a subject set. The relation must be
+// declared by the object's entity.
+func (e *Evaluator) AddRelationship(s string) error {
+	objectPart, subjectPart, ok := strings.Cut(s, "@")
+	if !ok {
+		return fmt.Errorf("relationship %q is not in object#relation@subject form", s)
+	}
+	objectRef, relation, ok := strings.Cut(objectPart, "#")
+	if !ok || relation == "" {
+		return fmt.Errorf("relationship %q has no relation", s)
+	}
+	object, err := e.entityRef(objectRef)
+	if err != nil {
+		return fmt.Errorf("relationship %q: %w", s, err)
+	}
+	if !declaresRelation(e.model.GetEntity(object.Type), relation) {
+		return fmt.Errorf("relationship %q: %s is not a relation of %s", s, relation, object.Type)
+	}
+
+	subjectRef, subjectRelation, _ := strings.Cut(subjectPart, "#")
+	subject, err := e.entityRef(subjectRef)
+	if err != nil {
+		return fmt.Errorf("relationship %q: %w", s, err)
+	}
+	if subjectRelation != "" && memberOf(e.model.GetEntity(subject.Type), subjectRelation) == memberNone {
+		return fmt.Errorf("relationship %q: %s is not a relation or permission of %s", s, subjectRelation, subject.Type)
+	}
+
+	e.relationships[object] = append(e.relationships[object], relationship{
+		Relation:        relation,
+		Subject:         subject,
+		SubjectRelation: subjectRelation,
+	})
+	return nil
+}
+
+// SetAttribute sets an attribute written entity$attribute|type:value. The
+// attribute must be declared by the entity, with that type.
+func (e *Evaluator) SetAttribute(s string) error {
+	entityRef, rest, ok := strings.Cut(s, "$")
+	if !ok {
+		return fmt.Errorf("attribute %q is not in entity$attribute|type:value form", s)
+	}
+	name, typedValue, ok := strings.Cut(rest, "|")
+	if !ok {
+		return fmt.Errorf("attribute %q has no value", s)
+	}
+	dataType, value, ok := strings.Cut(typedValue, ":")
+	if !ok {
+		return fmt.Errorf("attribute %q has no type", s)
+	}
+
+	ref, err := e.entityRef(entityRef)
+	if err != nil {
+		return fmt.Errorf("attribute %q: %w", s, err)
+	}
+	declared, ok := declaredAttribute(e.model.GetEntity(ref.Type), name)
+	if !ok {
+		return fmt.Errorf("attribute %q: %s is not an attribute of %s", s, name, ref.Type)
+	}
+	if string(declared.DataType) != dataType {
+		return fmt.Errorf("attribute %q: %s.%s is declared %s", s, ref.Type, name, declared.DataType)
+	}
+	parsed, err := model.ParseAttributeValue(declared.DataType, value)
+	if err != nil {
+		return fmt.Errorf("attribute %q: %w", s, err)
+	}
+
+	if e.attributes[ref] == nil {
+		e.attributes[ref] = make(map[string]interface{})
+	}
+	e.attributes[ref][name] = parsed
+	return nil
+}
+
+// entityRef parses a reference to an entity of a declared type
+func (e *Evaluator) entityRef(s string) (Ref, error) {
+	ref, err := ParseRef(s)
+	if err != nil {
+		return Ref{}, err
+	}
+	if e.model.GetEntity(ref.Type) == nil {
+		return Ref{}, fmt.Errorf("%s is not a declared entity", ref.Type)
+	}
+	return ref, nil
+}
+
+// evaluation is the state of one check
+type evaluation struct {
+	ctx     context.Context
+	subject Ref
+	request map[string]interface{}
+	// visiting are the entity#name keys being evaluated. A permission or
+	// subject set reached again through itself doesn't grant anything.
+	visiting map[string]bool
+}
+
+// Check reports whether subject has permission on object. request holds
+// the values the permission reads as request.<name>.
+func (e *Evaluator) Check(ctx context.Context, subject, object Ref, permission string, request map[string]interface{}) (bool, error) {
+	entity := e.model.GetEntity(object.Type)
+	if entity == nil {
+		return false, fmt.Errorf("%s is not a declared entity", object.Type)
+	}
+	if memberOf(entity, permission) != memberPermission {
+		return false, fmt.Errorf("%s is not a permission of %s", permission, object.Type)
+	}
+	ev := &evaluation{ctx: ctx, subject: subject, request: request, visiting: make(map[string]bool)}
+	return e.has(ev, object, permission)
+}
+
+// has reports whether the subject has name, a relation, permission or
+// attribute of object's entity, on object
+func (e *Evaluator) has(ev *evaluation, object Ref, name string) (bool, error) {
+	entity := e.model.GetEntity(object.Type)
+	if entity == nil {
+		return false, fmt.Errorf("%s is not a declared entity", object.Type)
+	}
+
+	kind := memberOf(entity, name)
+	switch kind {
+	case memberNone:
+		return false, fmt.Errorf("%s is not a relation, permission or attribute of %s", name, entity.Name)
+	case memberAttribute:
+		return truthy(e.attributes[object][name]), nil
+	}
+
+	key := object.String() + "#" + name
+	if ev.visiting[key] {
+		return false, nil
+	}
+	ev.visiting[key] = true
+	defer delete(ev.visiting, key)
+
+	if kind == memberPermission {
+		perm := findPermission(entity, name)
+		if perm.ParsedExpr == nil {
+			return false, fmt.Errorf("%s.%s has no expression", entity.Name, name)
+		}
+		return e.eval(ev, object, perm.ParsedExpr)
+	}
+	return e.holds(ev, entity, object, name)
+}
+
+// holds reports whether the subject holds relation on object directly,
+// through a subject set or through a derived relation
+func (e *Evaluator) holds(ev *evaluation, entity *model.Entity, object Ref, relation string) (bool, error) {
+	for _, r := range e.relationships[object] {
+		if r.Relation != relation {
+			continue
+		}
+		if r.SubjectRelation == "" {
+			if r.Subject == ev.subject {
+				return true, nil
+			}
+			continue
+		}
+		member, err := e.has(ev, r.Subject, r.SubjectRelation)
+		if err != nil || member {
+			return member, err
+		}
+	}
+
+	for _, derived := range entity.DerivedRelations {
+		if derived.Name != relation || derived.SubjectType != ev.subject.Type {
+			continue
+		}
+		value := e.attributes[object][derived.Attribute]
+		if derived.Value == nil && truthy(value) || derived.Value != nil && equal(value, derived.Value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// eval evaluates a permission expression on object
+func (e *Evaluator) eval(ev *evaluation, object Ref, expr model.Expression) (bool, error) {
+	if err := ev.ctx.Err(); err != nil {
+		return false, err
+	}
+
+	switch x := expr.(type) {
+	case *model.And:
+		left, err := e.eval(ev, object, x.Left)
+		if err != nil || !left {
+			return false, err
+		}
+		return e.eval(ev, object, x.Right)
+	case *model.Or:
+		left, err := e.eval(ev, object, x.Left)
+		if err != nil || left {
+			return left, err
+		}
+		return e.eval(ev, object, x.Right)
+	case *model.Not:
+		operand, err := e.eval(ev, object, x.Expr)
+		return !operand, err
+	case *model.Parentheses:
+		return e.eval(ev, object, x.Expr)
+	case *model.RelationRef:
+		return e.reference(ev, object, x.Entity, x.Name)
+	case *model.AttributeRef:
+		return e.reference(ev, object, x.Entity, x.Name)
+	case *model.RuleCall:
+		return e.call(ev, object, x)
+	case *model.ContextRef:
+		_, ok := ev.contextValue(x.Path)
+		return ok, nil
+	case *model.LiteralValue:
+		return truthy(x.Value), nil
+	default:
+		return false, fmt.Errorf("unsupported expression %s", expr)
+	}
+}
+
+// reference evaluates name, or via.name through the relation via
+func (e *Evaluator) reference(ev *evaluation, object Ref, via, name string) (bool, error) {
+	switch via {
+	case "":
+		return e.has(ev, object, name)
+	case graph.AttributeOfSubject:
+		return truthy(e.attributes[ev.subject][name]), nil
+	case graph.AttributeOfObject:
+		return truthy(e.attributes[object][name]), nil
+	}
+
+	if !declaresRelation(e.model.GetEntity(object.Type), via) {
+		return false, fmt.Errorf("%s is not a relation of %s", via, object.Type)
+	}
+	for _, related := range e.related(object, via) {
+		ok, err := e.has(ev, related, name)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// related returns the entities object is related to through relation
+func (e *Evaluator) related(object Ref, relation string) []Ref {
+	var refs []Ref
+	for _, r := range e.relationships[object] {
+		if r.Relation == relation {
+			refs = append(refs, r.Subject)
+		}
+	}
+	return refs
+}
+
+// call evaluates a rule or built-in function call. A call whose argument
+// is an unset attribute or context value is denied, as the graph denies it.
+func (e *Evaluator) call(ev *evaluation, object Ref, call *model.RuleCall) (bool, error) {
+	args, ok, err := e.args(ev, object, call)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if graph.IsBuiltinFunction(call.Name) {
+		result, err := graph.CallBuiltin(call.Name, args)
+		if err != nil {
+			return false, err
+		}
+		b, isBool := result.(bool)
+		if !isBool {
+			return false, fmt.Errorf("%s returns a %T, not a boolean", call.Name, result)
+		}
+		return b, nil
+	}
+
+	rule := e.rule(e.model.GetEntity(object.Type), call.Name)
+	if rule == nil {
+		return false, fmt.Errorf("rule not found: %s", call.Name)
+	}
+	if len(args) != len(rule.Parameters) {
+		return false, fmt.Errorf("rule %s requires %d arguments, got %d", call.Name, len(rule.Parameters), len(args))
+	}
+	params := make(map[string]interface{}, len(args))
+	for i, param := range rule.Parameters {
+		params[param.Name] = args[i]
+	}
+	return graph.EvaluateRuleExpression(ev.ctx, rule.Expression, params)
+}
+
+// args evaluates a call's arguments. ok is false when one is unset.
+func (e *Evaluator) args(ev *evaluation, object Ref, call *model.RuleCall) ([]interface{}, bool, error) {
+	args := make([]interface{}, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		value, ok, err := e.value(ev, object, arg)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: argument %d: %w", call.Name, i+1, err)
+		}
+		if !ok {
+			return nil, false, nil
+		}
+		args[i] = value
+	}
+	return args, true, nil
+}
+
+// value evaluates a call argument. References to attributes pass the
+// attribute's value and other references whether they hold.
+func (e *Evaluator) value(ev *evaluation, object Ref, expr model.Expression) (interface{}, bool, error) {
+	var via, name string
+	switch x := expr.(type) {
+	case *model.LiteralValue:
+		return x.Value, true, nil
+	case *model.ContextRef:
+		value, ok := ev.contextValue(x.Path)
+		return value, ok, nil
+	case *model.RuleCall:
+		if graph.IsBuiltinFunction(x.Name) {
+			args, ok, err := e.args(ev, object, x)
+			if err != nil || !ok {
+				return nil, ok, err
+			}
+			result, err := graph.CallBuiltin(x.Name, args)
+			return result, err == nil, err
+		}
+		return nil, false, fmt.Errorf("rule %s cannot be passed as an argument", x.Name)
+	case *model.RelationRef:
+		via, name = x.Entity, x.Name
+	case *model.AttributeRef:
+		via, name = x.Entity, x.Name
+	default:
+		result, err := e.eval(ev, object, expr)
+		return result, err == nil, err
+	}
+
+	switch via {
+	case graph.AttributeOfSubject:
+		value, ok := e.attributes[ev.subject][name]
+		return value, ok, nil
+	case graph.AttributeOfObject:
+		value, ok := e.attributes[object][name]
+		return value, ok, nil
+	case "":
+		if memberOf(e.model.GetEntity(object.Type), name) == memberAttribute {
+			value, ok := e.attributes[object][name]
+			return value, ok, nil
+		}
+	default:
+		for _, related := range e.related(object, via) {
+			if memberOf(e.model.GetEntity(related.Type), name) != memberAttribute {
+				continue
+			}
+			if value, ok := e.attributes[related][name]; ok {
+				return value, true, nil
+			}
+		}
+	}
+	result, err := e.reference(ev, object, via, name)
+	return result, err == nil, err
+}
+
+// rule returns the rule named name, looking in the entity's own rules first
+func (e *Evaluator) rule(entity *model.Entity, name string) *model.Rule {
+	if entity != nil {
+		for i := range entity.Rules {
+			if entity.Rules[i].Name == name {
+				return &entity.Rules[i]
+			}
+		}
+	}
+	return e.model.GetRule(name)
+}
+
+// contextValue looks up request.<name> in the check's context
+func (ev *evaluation) contextValue(path []string) (interface{}, bool) {
+	if len(path) == 0 || path[0] != "request" {
+		return nil, false
+	}
+	var value interface{} = ev.request
+	for _, part := range path[1:] {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// truthy reports whether a value satisfies a condition on its own: a
+// boolean when true, anything else when set
+func truthy(value interface{}) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return value != nil
+}
+
+// equal compares an attribute value with a literal, numbers by value
+func equal(value, literal interface{}) bool {
+	a, aNumber := number(value)
+	b, bNumber := number(literal)
+	if aNumber && bNumber {
+		return a == b
+	}
+	return value == literal
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// What a name declared in an entity is
+const (
+	memberNone = iota
+	memberRelation
+	memberAttribute
+	memberPermission
+)
+
+// memberOf returns what name is declared as in entity
+func memberOf(entity *model.Entity, name string) int {
+	switch {
+	case entity == nil:
+		return memberNone
+	case declaresRelation(entity, name):
+		return memberRelation
+	case findPermission(entity, name) != nil:
+		return memberPermission
+	}
+	if _, ok := declaredAttribute(entity, name); ok {
+		return memberAttribute
+	}
+	return memberNone
+}
+
+func declaresRelation(entity *model.Entity, name string) bool {
+	if entity == nil {
+		return false
+	}
+	for _, rel := range entity.Relations {
+		if rel.Name == name {
+			return true
+		}
+	}
+	for _, derived := range entity.DerivedRelations {
+		if derived.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func declaredAttribute(entity *model.Entity, name string) (model.Attribute, bool) {
+	if entity == nil {
+		return model.Attribute{}, false
+	}
+	for _, attr := range entity.Attributes {
+		if attr.Name == name {
+			return attr, true
+		}
+	}
+	return model.Attribute{}, false
+}
+
+func findPermission(entity *model.Entity, name string) *model.Permission {
+	for i := range entity.Permissions {
+		if entity.Permissions[i].Name == name {
+			return &entity.Permissions[i]
+		}
+	}
+	return nil
+}
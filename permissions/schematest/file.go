@@ -0,0 +1,143 @@
+// Package schematest checks a permission model against assertion files
+// without a database. The relationships and attributes a file declares are
+// held in memory and its checks are evaluated from the model's parsed
+// permission expressions, so permission regressions can fail CI before a
+// schema is migrated.
+package schematest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/permissions/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// File is an assertion file:
+//
+//	schema: !include permissions/schema.perm
+//	relationships:
+//	  - organization:acme#owner@user:alice
+//	  - group:eng#member@organization:acme#member
+//	attributes:
+//	  - organization:acme$verified|boolean:true
+//	scenarios:
+//	  - name: "Owners manage their organization"
+//	    checks:
+//	      - entity: "organization:acme"
+//	        subject: "user:alice"
+//	        context:
+//	          amount: 500
+//	        assertions:
+//	          manage_organization: true
+//
+// The schema is a .perm file included by path, relative to the assertion
+// file or the working directory, or the schema's source inline.
+type File struct {
+	Schema Schema `yaml:"schema"`
+	// Relationships are written object#relation@subject, where the subject
+	// may be a subject set such as group:eng#member
+	Relationships []string `yaml:"relationships"`
+	// Attributes are written entity$attribute|type:value. Array values are
+	// JSON, e.g. document:1$tags|string[]:["a","b"].
+	Attributes []string   `yaml:"attributes"`
+	Scenarios  []Scenario `yaml:"scenarios"`
+
+	path string
+}
+
+// Schema is the schema an assertion file tests
+type Schema struct {
+	// Include is the path of a .perm file, set by !include
+	Include string
+	// Source is an inline schema
+	Source string
+}
+
+// UnmarshalYAML reads a scalar tagged !include as a path and any other
+// scalar as the schema's source
+func (s *Schema) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: schema must be a string or !include path", node.Line)
+	}
+	if node.Tag == "!include" {
+		s.Include = strings.TrimSpace(node.Value)
+		return nil
+	}
+	s.Source = node.Value
+	return nil
+}
+
+// Scenario groups related checks
+type Scenario struct {
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description"`
+	Checks      []Check `yaml:"checks"`
+}
+
+// Check asserts which permissions a subject has on an entity
+type Check struct {
+	Entity  string `yaml:"entity"`
+	Subject string `yaml:"subject"`
+	// Context holds the request values the permissions read as
+	// request.<name>
+	Context map[string]interface{} `yaml:"context"`
+	// Assertions map permission names to whether they are granted
+	Assertions map[string]bool `yaml:"assertions"`
+}
+
+// ReadFile reads an assertion file
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	f.path = path
+	return &f, nil
+}
+
+// SchemaPath returns the path of the .perm file the file includes, or ""
+// when its schema is inline or missing. An include is resolved against the
+// assertion file's directory, then the working directory.
+func (f *File) SchemaPath() string {
+	if f.Schema.Include == "" || filepath.IsAbs(f.Schema.Include) {
+		return f.Schema.Include
+	}
+	if f.path != "" {
+		relative := filepath.Join(filepath.Dir(f.path), f.Schema.Include)
+		if _, err := os.Stat(relative); err == nil {
+			return relative
+		}
+	}
+	return f.Schema.Include
+}
+
+// LoadModel parses the file's schema
+func (f *File) LoadModel() (*model.PermissionModel, error) {
+	if path := f.SchemaPath(); path != "" {
+		m, parseErrors, err := parser.ParseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if len(parseErrors) > 0 {
+			return nil, fmt.Errorf("parsing %s:\n  - %s", path, strings.Join(parseErrors, "\n  - "))
+		}
+		return m, nil
+	}
+	if strings.TrimSpace(f.Schema.Source) == "" {
+		return nil, fmt.Errorf("%s doesn't declare a schema", f.path)
+	}
+	p := parser.NewParser(parser.NewLexer(f.Schema.Source))
+	m := p.ParsePermissionModel()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("parsing the inline schema:\n  - %s", strings.Join(p.Errors(), "\n  - "))
+	}
+	return m, nil
+}
@@ -0,0 +1,83 @@
+package schematest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+)
+
+// Result is the outcome of one assertion of an assertion file
+type Result struct {
+	Scenario   string
+	Subject    string
+	Entity     string
+	Permission string
+	Expected   bool
+	Got        bool
+	// Err is set when the check could not be evaluated, e.g. because the
+	// entity's type doesn't define the permission
+	Err error
+}
+
+// Passed reports whether the check returned the expected result
+func (r Result) Passed() bool {
+	return r.Err == nil && r.Got == r.Expected
+}
+
+// String describes the assertion as "scenario: subject permission entity"
+func (r Result) String() string {
+	return fmt.Sprintf("%s: %s %s %s", r.Scenario, r.Subject, r.Permission, r.Entity)
+}
+
+// Run loads the file's relationships and attributes into an Evaluator for
+// m and evaluates every assertion of its scenarios, in order. Assertions
+// of one check are evaluated by permission name. It fails if a
+// relationship or attribute is malformed or doesn't match the model.
+func Run(ctx context.Context, m *model.PermissionModel, f *File) ([]Result, error) {
+	e := NewEvaluator(m)
+	for _, r := range f.Relationships {
+		if err := e.AddRelationship(r); err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range f.Attributes {
+		if err := e.SetAttribute(a); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []Result
+	for _, scenario := range f.Scenarios {
+		for _, check := range scenario.Checks {
+			permissions := make([]string, 0, len(check.Assertions))
+			for permission := range check.Assertions {
+				permissions = append(permissions, permission)
+			}
+			sort.Strings(permissions)
+
+			subject, subjectErr := ParseRef(check.Subject)
+			entity, entityErr := ParseRef(check.Entity)
+			for _, permission := range permissions {
+				result := Result{
+					Scenario:   scenario.Name,
+					Subject:    check.Subject,
+					Entity:     check.Entity,
+					Permission: permission,
+					Expected:   check.Assertions[permission],
+				}
+				switch {
+				case subjectErr != nil:
+					result.Err = fmt.Errorf("subject: %w", subjectErr)
+				case entityErr != nil:
+					result.Err = fmt.Errorf("entity: %w", entityErr)
+				default:
+					result.Got, result.Err = e.Check(ctx, subject, entity, permission, check.Context)
+				}
+				results = append(results, result)
+			}
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,218 @@
+package schematest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `entity user {
+    attribute level integer
+}
+
+entity group {
+    relation member @user
+}
+
+entity organization {
+    relation parent @organization
+    relation admin @user
+    relation member @user
+    attribute verified boolean
+    permission manage = admin or parent.manage
+}
+
+entity document {
+    relation organization @organization
+    relation owner @user
+    relation editor @user
+    relation banned @user
+    attribute status string
+    attribute limit integer
+    attribute min_level integer
+    relation reader @user:* when status == "published"
+    permission edit = (owner or editor) and not banned
+    permission view = edit or reader or organization.member
+    permission admin_view = organization.manage and organization.verified
+    permission spend = within_limit(request.amount, limit)
+    permission approve = request.approved
+    permission senior = at_least(subject.level, min_level)
+    permission loop = loop or owner
+}
+
+rule within_limit(amount integer, limit integer) {
+    amount <= limit
+}
+
+rule at_least(level integer, required integer) {
+    level >= required
+}
+`
+
+const testAssertions = `schema: !include schema.perm
+relationships:
+  - organization:root#admin@user:alice
+  - organization:acme#parent@organization:root
+  - organization:acme#member@group:eng#member
+  - group:eng#member@user:carol
+  - document:1#organization@organization:acme
+  - document:1#owner@user:bob
+  - document:1#editor@user:dave
+  - document:1#banned@user:dave
+attributes:
+  - organization:acme$verified|boolean:true
+  - document:1$limit|integer:100
+  - document:1$status|string:published
+  - document:1$min_level|integer:3
+  - user:erin$level|integer:5
+scenarios:
+  - name: "Documents"
+    checks:
+      - entity: "document:1"
+        subject: "user:bob"
+        context:
+          amount: 50
+        assertions:
+          edit: true
+          view: true
+          spend: true
+          loop: true
+      - entity: "document:1"
+        subject: "user:dave"
+        assertions:
+          edit: false
+          spend: false
+      - entity: "document:1"
+        subject: "user:carol"
+        assertions:
+          view: true
+          edit: false
+      - entity: "document:1"
+        subject: "user:alice"
+        context:
+          approved: true
+          amount: 500
+        assertions:
+          admin_view: true
+          approve: true
+          spend: false
+      - entity: "document:1"
+        subject: "user:erin"
+        assertions:
+          senior: true
+          view: true
+          edit: false
+`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"schema.perm": testSchema, "assertions.yaml": testAssertions})
+
+	f, err := ReadFile(filepath.Join(dir, "assertions.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "schema.perm"), f.SchemaPath())
+	m, err := f.LoadModel()
+	require.NoError(t, err)
+
+	results, err := Run(context.Background(), m, f)
+	require.NoError(t, err)
+	require.Len(t, results, 14)
+	for _, result := range results {
+		assert.True(t, result.Passed(), "%s: got %v, want %v, err %v", result, result.Got, result.Expected, result.Err)
+	}
+	assert.Equal(t, "Documents: user:bob edit document:1", results[0].String())
+}
+
+func TestRunFailures(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"schema.perm": testSchema})
+	f := &File{
+		Schema:        Schema{Include: filepath.Join(dir, "schema.perm")},
+		Relationships: []string{"document:1#owner@user:bob"},
+		Scenarios: []Scenario{{
+			Name: "Wrong",
+			Checks: []Check{{
+				Entity:     "document:1",
+				Subject:    "user:bob",
+				Assertions: map[string]bool{"edit": false, "destroy": true},
+			}, {
+				Entity:     "document",
+				Subject:    "user:bob",
+				Assertions: map[string]bool{"edit": true},
+			}},
+		}},
+	}
+	m, err := f.LoadModel()
+	require.NoError(t, err)
+
+	results, err := Run(context.Background(), m, f)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	assert.EqualError(t, results[0].Err, "destroy is not a permission of document")
+	assert.NoError(t, results[1].Err)
+	assert.True(t, results[1].Got)
+	assert.False(t, results[1].Passed())
+	assert.ErrorContains(t, results[2].Err, "entity")
+}
+
+func TestInlineSchema(t *testing.T) {
+	f := &File{
+		Schema: Schema{Source: `entity user {}
+entity doc {
+    relation owner @user
+    permission view = owner
+}`},
+		Relationships: []string{"doc:1#owner@user:a"},
+	}
+	m, err := f.LoadModel()
+	require.NoError(t, err)
+
+	e := NewEvaluator(m)
+	require.NoError(t, e.AddRelationship(f.Relationships[0]))
+	allowed, err := e.Check(context.Background(), Ref{"user", "a"}, Ref{"doc", "1"}, "view", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	_, err = (&File{}).LoadModel()
+	assert.Error(t, err)
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"schema.perm": testSchema})
+	f := &File{Schema: Schema{Include: filepath.Join(dir, "schema.perm")}}
+	m, err := f.LoadModel()
+	require.NoError(t, err)
+	e := NewEvaluator(m)
+
+	for _, relationship := range []string{
+		"document:1#owner",
+		"document:1@user:bob",
+		"folder:1#owner@user:bob",
+		"document:1#viewer@user:bob",
+		"document:1#owner@robot:1",
+		"organization:acme#member@group:eng#admin",
+	} {
+		assert.Error(t, e.AddRelationship(relationship), relationship)
+	}
+	for _, attribute := range []string{
+		"document:1$limit",
+		"document:1$limit|100",
+		"document:1$size|integer:100",
+		"document:1$limit|string:100",
+		"document:1$limit|integer:lots",
+	} {
+		assert.Error(t, e.SetAttribute(attribute), attribute)
+	}
+}
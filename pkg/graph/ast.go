@@ -0,0 +1,208 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+)
+
+// Kinds of ConditionNode, one per kind of Expression
+const (
+	NodeAnd        = "and"
+	NodeOr         = "or"
+	NodeNot        = "not"
+	NodeRelation   = "relation"
+	NodeContext    = "context"
+	NodeAttribute  = "attribute"
+	NodeRule       = "rule"
+	NodeLiteral    = "literal"
+	NodeComparison = "comparison"
+	NodeIn         = "in"
+	NodeQuantified = "quantified"
+)
+
+// Span is where a node was written in its condition, as byte offsets of
+// its first character and of the one after its last
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// ConditionNode is a node of a parsed condition in a form that can be
+// rendered as a tree. Only the fields of its Type are set: Relation and
+// Path for relations, Path for context references, Entity and Attribute
+// for attributes, Rule for rule calls, Value for literals, Operator for
+// comparisons and Quantifier for quantified comparisons.
+type ConditionNode struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text"`
+	Span       Span        `json:"span"`
+	Relation   string      `json:"relation,omitempty"`
+	Path       string      `json:"path,omitempty"`
+	Entity     string      `json:"entity,omitempty"`
+	Attribute  string      `json:"attribute,omitempty"`
+	Rule       string      `json:"rule,omitempty"`
+	Value      interface{} `json:"value,omitempty"`
+	Operator   string      `json:"operator,omitempty"`
+	Quantifier string      `json:"quantifier,omitempty"`
+	// Children are the operands in the order they were written: the two
+	// sides of and, or and comparisons, a rule's arguments, the value and
+	// list of in, and the list and value of quantified comparisons
+	Children []*ConditionNode `json:"children,omitempty"`
+
+	// Decision is how the node decided the check ExplainCondition
+	// evaluated. Operands that are values rather than conditions, such as
+	// rule arguments, have none.
+	Decision *Decision `json:"decision,omitempty"`
+	// Decisive marks the nodes the check's outcome followed from: the
+	// operand of an "or" that granted access, the operand of an "and" that
+	// denied it, and every operand that had to hold or fail for the rest
+	Decisive bool `json:"decisive,omitempty"`
+
+	expr Expression
+}
+
+// ParseConditionTree parses a condition into a tree of nodes with the
+// spans they were written at
+func ParseConditionTree(condition string) (*ConditionNode, error) {
+	expr, spans, err := NewConditionParser(condition).ParseWithSpans()
+	if err != nil {
+		return nil, err
+	}
+	return conditionNode(expr, spans), nil
+}
+
+func conditionNode(expr Expression, spans map[Expression]Span) *ConditionNode {
+	node := &ConditionNode{Text: expr.String(), Span: spans[expr], expr: expr}
+	children := func(operands ...Expression) {
+		for _, operand := range operands {
+			node.Children = append(node.Children, conditionNode(operand, spans))
+		}
+	}
+
+	switch e := expr.(type) {
+	case *AndExpression:
+		node.Type = NodeAnd
+		children(e.Left, e.Right)
+	case *OrExpression:
+		node.Type = NodeOr
+		children(e.Left, e.Right)
+	case *NotExpression:
+		node.Type = NodeNot
+		children(e.Operand)
+	case *RelationExpression:
+		node.Type = NodeRelation
+		node.Relation, node.Path = e.RelationName, e.RelationPath
+	case *ContextExpression:
+		node.Type = NodeContext
+		node.Path = e.String()
+	case *AttributeExpression:
+		node.Type = NodeAttribute
+		node.Entity, node.Attribute = e.Entity, e.AttributeName
+	case *RuleExpression:
+		node.Type = NodeRule
+		node.Rule = e.RuleName
+		children(e.Arguments...)
+	case *LiteralExpression:
+		node.Type = NodeLiteral
+		node.Value = e.Value
+	case *ComparisonExpression:
+		node.Type = NodeComparison
+		node.Operator = operatorString(e.Operator)
+		children(e.Left, e.Right)
+	case *InExpression:
+		node.Type = NodeIn
+		children(e.Value, e.List)
+	case *QuantifiedExpression:
+		node.Type = NodeQuantified
+		node.Quantifier = "any"
+		if e.Quantifier == tokenAll {
+			node.Quantifier = "all"
+		}
+		node.Operator = operatorString(e.Operator)
+		children(e.List, e.Right)
+	}
+	return node
+}
+
+// ExplainCondition parses a condition into a tree, as ParseConditionTree
+// does, and decides it for a subject and object, recording each node's own
+// decision and marking the ones the outcome followed from. Unlike a check,
+// both operands of every and and or are evaluated.
+func (g *IdentityGraph) ExplainCondition(ctx context.Context, condition,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (*ConditionNode, error) {
+
+	root, err := ParseConditionTree(condition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse condition: %w", err)
+	}
+	if err := g.explainNode(ctx, root, subjectType, subjectID, objectType, objectID, contextData); err != nil {
+		return nil, err
+	}
+	markDecisive(root)
+	return root, nil
+}
+
+// explainNode decides node. The operands of and, or and not are decided
+// first and combined the way decideExpression combines them.
+func (g *IdentityGraph) explainNode(ctx context.Context, node *ConditionNode,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) error {
+
+	switch node.Type {
+	case NodeAnd, NodeOr, NodeNot:
+		for _, child := range node.Children {
+			if err := g.explainNode(ctx, child, subjectType, subjectID, objectType, objectID, contextData); err != nil {
+				return err
+			}
+		}
+	}
+
+	var d Decision
+	switch node.Type {
+	case NodeAnd:
+		d = *node.Children[1].Decision
+		if left := *node.Children[0].Decision; !left.Allowed {
+			d = left
+		}
+	case NodeOr:
+		d = *node.Children[0].Decision
+		if !d.Allowed {
+			d, _ = decideOr(d, *node.Children[1].Decision, nil)
+		}
+	case NodeNot:
+		d = decision(!node.Children[0].Decision.Allowed, ReasonMatchedNegation, ReasonDeniedByExclusion)
+	default:
+		var err error
+		d, err = g.decideExpression(ctx, node.expr, subjectType, subjectID, objectType, objectID, contextData)
+		if err != nil {
+			return fmt.Errorf("failed to decide %s: %w", node.Text, err)
+		}
+	}
+	node.Decision = &d
+	return nil
+}
+
+// markDecisive marks node and the operands its decision followed from
+func markDecisive(node *ConditionNode) {
+	node.Decisive = true
+	if node.Decision == nil {
+		return
+	}
+	allowed := node.Decision.Allowed
+	switch node.Type {
+	case NodeAnd, NodeOr:
+		// An "or" that allowed, or an "and" that denied, followed from its
+		// first operand to do the same; otherwise from both
+		short := allowed == (node.Type == NodeOr)
+		for _, child := range node.Children {
+			if short && child.Decision.Allowed != allowed {
+				continue
+			}
+			markDecisive(child)
+			if short {
+				return
+			}
+		}
+	case NodeNot:
+		markDecisive(node.Children[0])
+	}
+}
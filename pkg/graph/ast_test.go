@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConditionTree(t *testing.T) {
+	condition := `owner or (editor and not banned) or isAdmin(request.role, "admin")`
+	root, err := ParseConditionTree(condition)
+	require.NoError(t, err)
+
+	text := func(n *ConditionNode) string { return condition[n.Span.Start:n.Span.End] }
+
+	assert.Equal(t, NodeOr, root.Type)
+	assert.Equal(t, condition, text(root))
+	require.Len(t, root.Children, 2)
+
+	inner := root.Children[0]
+	assert.Equal(t, NodeOr, inner.Type)
+	assert.Equal(t, `owner or (editor and not banned)`, text(inner))
+	assert.Equal(t, NodeRelation, inner.Children[0].Type)
+	assert.Equal(t, "owner", inner.Children[0].Relation)
+
+	and := inner.Children[1]
+	assert.Equal(t, NodeAnd, and.Type)
+	assert.Equal(t, "editor and not banned", text(and), "parentheses are left out")
+	assert.Equal(t, NodeNot, and.Children[1].Type)
+	assert.Equal(t, "not banned", text(and.Children[1]))
+
+	rule := root.Children[1]
+	assert.Equal(t, NodeRule, rule.Type)
+	assert.Equal(t, "isAdmin", rule.Rule)
+	require.Len(t, rule.Children, 2)
+	assert.Equal(t, NodeContext, rule.Children[0].Type)
+	assert.Equal(t, "request.role", rule.Children[0].Path)
+	assert.Equal(t, NodeLiteral, rule.Children[1].Type)
+	assert.Equal(t, "admin", rule.Children[1].Value)
+	assert.Equal(t, `"admin"`, text(rule.Children[1]), "string spans include their quotes")
+}
+
+func TestParseConditionTreeComparisons(t *testing.T) {
+	condition := `subject.level >= 3 and request.region in object.regions and all request.scores > 0.5`
+	root, err := ParseConditionTree(condition)
+	require.NoError(t, err)
+
+	var nodes []*ConditionNode
+	var walk func(*ConditionNode)
+	walk = func(n *ConditionNode) {
+		nodes = append(nodes, n)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	byText := map[string]*ConditionNode{}
+	for _, n := range nodes {
+		byText[condition[n.Span.Start:n.Span.End]] = n
+	}
+	cmp := byText["subject.level >= 3"]
+	require.NotNil(t, cmp)
+	assert.Equal(t, NodeComparison, cmp.Type)
+	assert.Equal(t, ">=", cmp.Operator)
+	assert.Equal(t, NodeAttribute, cmp.Children[0].Type)
+	assert.Equal(t, "subject", cmp.Children[0].Entity)
+	assert.Equal(t, 3.0, cmp.Children[1].Value)
+
+	in := byText["request.region in object.regions"]
+	require.NotNil(t, in)
+	assert.Equal(t, NodeIn, in.Type)
+
+	quantified := byText["all request.scores > 0.5"]
+	require.NotNil(t, quantified)
+	assert.Equal(t, NodeQuantified, quantified.Type)
+	assert.Equal(t, "all", quantified.Quantifier)
+	assert.Equal(t, ">", quantified.Operator)
+
+	_, err = ParseConditionTree("owner or")
+	assert.Error(t, err)
+}
+
+func TestExplainCondition(t *testing.T) {
+	g := &IdentityGraph{}
+	ctx := context.Background()
+	request := map[string]interface{}{"request": map[string]interface{}{"ticket": "INC-7", "region": "eu"}}
+
+	root, err := g.ExplainCondition(ctx, `request.escalated or (request.ticket and not request.frozen)`,
+		"user", "alice", "doc", "1", request)
+	require.NoError(t, err)
+	assert.True(t, root.Decision.Allowed)
+	assert.True(t, root.Decisive)
+
+	escalated, granting := root.Children[0], root.Children[1]
+	assert.False(t, escalated.Decision.Allowed)
+	assert.False(t, escalated.Decisive, "a denied operand of an allowed or is not decisive")
+	assert.True(t, granting.Decision.Allowed)
+	assert.True(t, granting.Decisive)
+	assert.True(t, granting.Children[0].Decisive, "both operands of an allowed and are")
+	assert.True(t, granting.Children[1].Decisive)
+	assert.True(t, granting.Children[1].Children[0].Decisive)
+	assert.False(t, granting.Children[1].Children[0].Decision.Allowed)
+
+	root, err = g.ExplainCondition(ctx, `request.frozen and request.ticket`, "user", "alice", "doc", "1", request)
+	require.NoError(t, err)
+	assert.False(t, root.Decision.Allowed)
+	assert.Equal(t, ReasonDeniedMissingContext, root.Decision.Reason)
+	assert.True(t, root.Children[0].Decisive)
+	assert.False(t, root.Children[1].Decisive, "only the operand that denied an and is")
+	assert.True(t, root.Children[1].Decision.Allowed, "both operands are evaluated")
+
+	root, err = g.ExplainCondition(ctx, `request.region == "eu"`, "user", "alice", "doc", "1", request)
+	require.NoError(t, err)
+	assert.True(t, root.Decision.Allowed)
+	assert.Nil(t, root.Children[0].Decision, "value operands are not decided")
+	assert.False(t, root.Children[0].Decisive)
+}
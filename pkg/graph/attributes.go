@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrAttributeNotFound is returned when a condition reads an attribute the
+// entity does not have. Checks treat it as a denial, not a failure.
+var ErrAttributeNotFound = errors.New("attribute not found")
+
+// Entities whose attributes a condition can address
+const (
+	AttributeOfSubject = "subject"
+	AttributeOfObject  = "object"
+)
+
+// attributeValue reads the attribute an AttributeExpression addresses on the
+// checked subject or object
+func (g *IdentityGraph) attributeValue(ctx context.Context, e *AttributeExpression,
+	subjectType, subjectID, objectType, objectID string) (interface{}, error) {
+
+	if e.Entity == AttributeOfSubject {
+		return g.getEntityAttribute(ctx, subjectType, subjectID, e.AttributeName)
+	}
+	return g.getEntityAttribute(ctx, objectType, objectID, e.AttributeName)
+}
+
+// relatedEntities returns the entities the object reaches through
+// relationPath, in either direction of the relation. Between entities of the
+// same type, such as an organization and its parent, only the related
+// entity as subject counts: "organization:acme parent organization:sales"
+// makes acme the parent of sales, and the reverse would walk down the
+// hierarchy instead of up.
+func (g *IdentityGraph) relatedEntities(ctx context.Context, relationPath,
+	objectType, objectID string) ([]entityRef, error) {
+
+	rows, err := g.store.Query(ctx, `
+		SELECT e.type, e.external_id
+		FROM relations r
+		JOIN entities e ON
+			(r.object_type = $1 AND r.object_id = $2 AND e.type = r.subject_type AND e.external_id = r.subject_id)
+			OR (r.subject_type = $1 AND r.subject_id = $2 AND r.object_type <> $1
+				AND e.type = r.object_type AND e.external_id = r.object_id)
+		WHERE r.relation = $3
+		ORDER BY e.id
+	`, objectType, objectID, relationPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find related entities: %w", err)
+	}
+	defer rows.Close()
+
+	var related []entityRef
+	for rows.Next() {
+		var ref entityRef
+		if err := rows.Scan(&ref.Type, &ref.ID); err != nil {
+			return nil, fmt.Errorf("failed to scan related entity: %w", err)
+		}
+		related = append(related, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find related entities: %w", err)
+	}
+	return related, nil
+}
+
+// relatedAttributes reads an attribute from the entities the object reaches
+// through relationPath, as in organization.verified. It returns the values
+// of those entities that have the attribute, so an empty result means the
+// name is not an attribute there and should be treated as a relation.
+func (g *IdentityGraph) relatedAttributes(ctx context.Context, relationPath, attributeName,
+	objectType, objectID string) ([]interface{}, error) {
+
+	related, err := g.relatedEntities(ctx, relationPath, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read through getEntityAttribute so as-of checks see historic values
+	var values []interface{}
+	for _, ref := range related {
+		value, err := g.getEntityAttribute(ctx, ref.Type, ref.ID, attributeName)
+		if errors.Is(err, ErrAttributeNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// relatedAttributeValue reads an attribute of the single entity the object
+// reaches through relationPath, for use as a comparison operand. A bare
+// name, as in balance >= request.amount, is an attribute of the object.
+func (g *IdentityGraph) relatedAttributeValue(ctx context.Context, e *RelationExpression,
+	objectType, objectID string) (interface{}, error) {
+
+	if e.RelationPath == "" {
+		return g.getEntityAttribute(ctx, objectType, objectID, e.RelationName)
+	}
+
+	values, err := g.relatedAttributes(ctx, e.RelationPath, e.RelationName, objectType, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrAttributeNotFound, e.String())
+	}
+	for _, v := range values[1:] {
+		if !reflect.DeepEqual(v, values[0]) {
+			return nil, fmt.Errorf("%s is ambiguous: the object has several %s entities with different values",
+				e.String(), e.RelationPath)
+		}
+	}
+	return values[0], nil
+}
+
+// declaresAttribute reports whether the schema declares name as an
+// attribute of entityType, so that a bare name in its conditions, as in
+// "public or owner", reads the attribute instead of checking a relation
+func (g *IdentityGraph) declaresAttribute(entityType, name string) bool {
+	_, ok := g.AttributeType(entityType, name)
+	return ok
+}
+
+// attributeTruthy interprets an attribute used as a condition on its own:
+// booleans are taken as they are, and any other value counts as present
+func attributeTruthy(value interface{}) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return value != nil
+}
+
+// attributeDecision decides a bare attribute condition
+func attributeDecision(value interface{}) Decision {
+	switch {
+	case value == nil:
+		return decision(false, "", ReasonDeniedMissingAttribute)
+	case attributeTruthy(value):
+		return decision(true, ReasonMatchedAttribute, "")
+	default:
+		return decision(false, "", ReasonDeniedByCondition)
+	}
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseEntityAttributes(t *testing.T) {
+	expr, err := NewConditionParser("subject.clearance >= object.classification").Parse()
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	cmp, ok := expr.(*ComparisonExpression)
+	if !ok {
+		t.Fatalf("Parse() = %T, want *ComparisonExpression", expr)
+	}
+	left, ok := cmp.Left.(*AttributeExpression)
+	if !ok || left.Entity != AttributeOfSubject || left.AttributeName != "clearance" {
+		t.Errorf("left operand = %#v, want subject.clearance", cmp.Left)
+	}
+	right, ok := cmp.Right.(*AttributeExpression)
+	if !ok || right.Entity != AttributeOfObject || right.AttributeName != "classification" {
+		t.Errorf("right operand = %#v, want object.classification", cmp.Right)
+	}
+
+	// Other dotted names are still relation traversals
+	expr, err = NewConditionParser("organization.admin").Parse()
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if _, ok := expr.(*RelationExpression); !ok {
+		t.Errorf("Parse(organization.admin) = %T, want *RelationExpression", expr)
+	}
+}
+
+func TestDecideComparison(t *testing.T) {
+	g := &IdentityGraph{}
+	contextData := map[string]interface{}{
+		"request": map[string]interface{}{"amount": 50.0, "region": "eu"},
+	}
+
+	tests := []struct {
+		condition string
+		allowed   bool
+		reason    string
+	}{
+		{"request.amount <= 100", true, ReasonMatchedCondition},
+		{"request.amount > 100", false, ReasonDeniedByCondition},
+		{`request.region == "eu"`, true, ReasonMatchedCondition},
+		{`request.region != "eu" or request.amount < 10`, false, ReasonDeniedByCondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			decision, err := g.DecideCondition(context.Background(), tt.condition, "user", "alice", "document", "plan", contextData)
+			if err != nil {
+				t.Fatalf("DecideCondition(%q) returned error: %v", tt.condition, err)
+			}
+			if decision.Allowed != tt.allowed || decision.Reason != tt.reason {
+				t.Errorf("DecideCondition(%q) = %+v, want allowed=%v reason=%q", tt.condition, decision, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+func TestAttributeDecision(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  Decision
+	}{
+		{true, Decision{Allowed: true, Reason: ReasonMatchedAttribute}},
+		{false, Decision{Allowed: false, Reason: ReasonDeniedByCondition}},
+		{"premium", Decision{Allowed: true, Reason: ReasonMatchedAttribute}},
+		{nil, Decision{Allowed: false, Reason: ReasonDeniedMissingAttribute}},
+	}
+	for _, tt := range tests {
+		if got := attributeDecision(tt.value); got != tt.want {
+			t.Errorf("attributeDecision(%v) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// RelationOp is what a write in a relation batch does
+type RelationOp string
+
+const (
+	// RelationCreate creates a relation, and its endpoints as stub entities
+	// when they don't exist yet
+	RelationCreate RelationOp = "create"
+	// RelationDelete deletes a relation; deleting one that doesn't exist is
+	// not an error
+	RelationDelete RelationOp = "delete"
+)
+
+// RelationWrite is one operation of a WriteRelations batch
+type RelationWrite struct {
+	Op          RelationOp
+	SubjectType string
+	SubjectID   string
+	Relation    string
+	ObjectType  string
+	ObjectID    string
+	// Metadata is stored with created relations and may be nil
+	Metadata map[string]interface{}
+	// Source tags created relations, SourceManual when empty
+	Source string
+}
+
+// RelationWriteResult is the relation a batch operation created or deleted.
+// Relation is nil for a delete that matched nothing.
+type RelationWriteResult struct {
+	Op       RelationOp
+	Relation *Relation
+}
+
+// ErrRelationExists is returned when creating a relation that exists
+var ErrRelationExists = errors.New("relation already exists")
+
+// BatchError is the operation that failed a batch, which was rolled back
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// WriteRelations applies writes in order in one transaction, so either
+// every operation takes effect or, when one fails, none do and a
+// *BatchError names it. Relation limits are enforced as by CreateRelation,
+// counting the batch's own earlier writes.
+func (g *IdentityGraph) WriteRelations(ctx context.Context, writes []RelationWrite) ([]RelationWriteResult, error) {
+	results := make([]RelationWriteResult, len(writes))
+	err := pgx.BeginFunc(ctx, g.store, func(tx pgx.Tx) error {
+		for i, w := range writes {
+			var rel *Relation
+			var err error
+			switch w.Op {
+			case RelationCreate:
+				rel, err = g.createRelationTx(ctx, tx, w)
+			case RelationDelete:
+				rel, err = deleteRelationTx(ctx, tx, w)
+			default:
+				err = fmt.Errorf("unknown operation %q", w.Op)
+			}
+			if err != nil {
+				return &BatchError{Index: i, Err: err}
+			}
+			results[i] = RelationWriteResult{Op: w.Op, Relation: rel}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (g *IdentityGraph) createRelationTx(ctx context.Context, tx pgx.Tx, w RelationWrite) (*Relation, error) {
+	if err := g.ValidateRelation(w.SubjectType, w.SubjectID, w.Relation, w.ObjectType); err != nil {
+		return nil, err
+	}
+	source, err := normalizeSource(w.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Missing endpoints become stubs, as when relations are written one at
+	// a time
+	for _, ref := range []entityRef{{w.SubjectType, SubjectEntityID(w.SubjectID)}, {w.ObjectType, w.ObjectID}} {
+		stub, err := json.Marshal(map[string]interface{}{"name": ref.ID, "auto_created": true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal properties: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO entities (type, external_id, properties)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (type, external_id) DO NOTHING
+		`, ref.Type, ref.ID, stub); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", ref, err)
+		}
+	}
+
+	if max := g.relationLimit(w.ObjectType, w.Relation); max > 0 {
+		if err := checkRelationLimit(ctx, tx, max, w.SubjectType, w.SubjectID, w.Relation, w.ObjectType, w.ObjectID); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := w.Metadata
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal relation metadata: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO relations (subject_type, subject_id, relation, object_type, object_id, metadata, source)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+	`, w.SubjectType, w.SubjectID, w.Relation, w.ObjectType, w.ObjectID, metadataJSON, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create relation: %w", err)
+	}
+	created, err := collectRelations(rows)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, fmt.Errorf("%w: %s:%s %s %s:%s", ErrRelationExists,
+			w.SubjectType, w.SubjectID, w.Relation, w.ObjectType, w.ObjectID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &created[0], nil
+}
+
+func deleteRelationTx(ctx context.Context, tx pgx.Tx, w RelationWrite) (*Relation, error) {
+	rows, err := tx.Query(ctx, `
+		DELETE FROM relations
+		WHERE subject_type = $1 AND subject_id = $2 AND relation = $3
+			AND object_type = $4 AND object_id = $5
+		RETURNING id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+	`, w.SubjectType, w.SubjectID, w.Relation, w.ObjectType, w.ObjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete relation: %w", err)
+	}
+	deleted, err := collectRelations(rows)
+	if err != nil || len(deleted) == 0 {
+		return nil, err
+	}
+	return &deleted[0], nil
+}
@@ -0,0 +1,182 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RelationLimit caps how many subjects may hold Relation on one entity of
+// EntityType, declared in the schema as "relation owner @user max 1"
+type RelationLimit struct {
+	EntityType  string `json:"entity_type" yaml:"entity_type"`
+	Relation    string `json:"relation" yaml:"relation"`
+	MaxSubjects int    `json:"max_subjects" yaml:"max_subjects"`
+}
+
+// relationKey identifies a relation declared on an entity type
+type relationKey struct {
+	entityType, relation string
+}
+
+// ErrCardinalityExceeded is matched by a *CardinalityError
+var ErrCardinalityExceeded = errors.New("relation cardinality exceeded")
+
+// CardinalityError is returned for a relation write that would give an
+// entity more subjects than its relation allows
+type CardinalityError struct {
+	Limit  RelationLimit
+	Object string
+	// Holders are the subjects that already hold the relation, as type:id
+	Holders []string
+}
+
+func (e *CardinalityError) Error() string {
+	return fmt.Sprintf("%s allows at most %d %s, and %s already has %s",
+		e.Limit.EntityType, e.Limit.MaxSubjects, e.Limit.Relation, e.Object, strings.Join(e.Holders, ", "))
+}
+
+func (e *CardinalityError) Is(target error) bool {
+	return target == ErrCardinalityExceeded
+}
+
+// loadRelationLimits replaces the cached relation limits with those in the
+// database
+func (g *IdentityGraph) loadRelationLimits(ctx context.Context) error {
+	rows, err := g.store.Query(ctx, `
+		SELECT entity_type, relation, max_subjects
+		FROM relation_limits
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query relation limits: %w", err)
+	}
+	defer rows.Close()
+
+	var limits []RelationLimit
+	for rows.Next() {
+		var l RelationLimit
+		if err := rows.Scan(&l.EntityType, &l.Relation, &l.MaxSubjects); err != nil {
+			return fmt.Errorf("failed to scan relation limit: %w", err)
+		}
+		limits = append(limits, l)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating relation limits: %w", err)
+	}
+
+	g.setRelationLimits(limits)
+	return nil
+}
+
+func (g *IdentityGraph) setRelationLimits(limits []RelationLimit) {
+	byKey := make(map[relationKey]int, len(limits))
+	for _, l := range limits {
+		byKey[relationKey{l.EntityType, l.Relation}] = l.MaxSubjects
+	}
+
+	g.limitsMu.Lock()
+	g.limits = byKey
+	g.limitsMu.Unlock()
+}
+
+// relationLimit returns the cap on a relation's subjects, or zero
+func (g *IdentityGraph) relationLimit(entityType, relation string) int {
+	g.limitsMu.RLock()
+	defer g.limitsMu.RUnlock()
+	return g.limits[relationKey{entityType, relation}]
+}
+
+// RelationLimits returns the relation limits in effect, ordered by entity
+// type and relation
+func (g *IdentityGraph) RelationLimits() []RelationLimit {
+	g.limitsMu.RLock()
+	defer g.limitsMu.RUnlock()
+
+	all := make([]RelationLimit, 0, len(g.limits))
+	for key, max := range g.limits {
+		all = append(all, RelationLimit{EntityType: key.entityType, Relation: key.relation, MaxSubjects: max})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].EntityType != all[j].EntityType {
+			return all[i].EntityType < all[j].EntityType
+		}
+		return all[i].Relation < all[j].Relation
+	})
+	return all
+}
+
+// SyncRelationLimits replaces the stored relation limits with limits, as
+// declared by the current schema, and starts enforcing them. Relations
+// written before a limit was declared are left alone, even when they
+// exceed it.
+func (g *IdentityGraph) SyncRelationLimits(ctx context.Context, limits []RelationLimit) error {
+	err := pgx.BeginFunc(ctx, g.store, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM relation_limits`); err != nil {
+			return err
+		}
+		for _, l := range limits {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO relation_limits (entity_type, relation, max_subjects)
+				VALUES ($1, $2, $3)
+			`, l.EntityType, l.Relation, l.MaxSubjects); err != nil {
+				return fmt.Errorf("failed to store relation limit %s.%s: %w", l.EntityType, l.Relation, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync relation limits: %w", err)
+	}
+
+	g.setRelationLimits(limits)
+	return nil
+}
+
+// checkRelationLimit fails with a *CardinalityError when the object already
+// has max subjects other than the one being written. It holds a transaction
+// lock on the object's relation until tx ends, so concurrent writes are
+// counted one after the other.
+func checkRelationLimit(ctx context.Context, tx pgx.Tx, max int, subjectType, subjectID, relation, objectType, objectID string) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`,
+		objectType+":"+objectID+"#"+relation); err != nil {
+		return fmt.Errorf("failed to lock %s:%s#%s: %w", objectType, objectID, relation, err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT subject_type, subject_id
+		FROM relations
+		WHERE object_type = $1 AND object_id = $2 AND relation = $3
+			AND NOT (subject_type = $4 AND subject_id = $5)
+		ORDER BY id
+		LIMIT $6
+	`, objectType, objectID, relation, subjectType, subjectID, max)
+	if err != nil {
+		return fmt.Errorf("failed to count %s subjects: %w", relation, err)
+	}
+	defer rows.Close()
+
+	var holders []string
+	for rows.Next() {
+		var ref entityRef
+		if err := rows.Scan(&ref.Type, &ref.ID); err != nil {
+			return fmt.Errorf("failed to scan %s subject: %w", relation, err)
+		}
+		holders = append(holders, ref.String())
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(holders) >= max {
+		return &CardinalityError{
+			Limit:   RelationLimit{EntityType: objectType, Relation: relation, MaxSubjects: max},
+			Object:  objectType + ":" + objectID,
+			Holders: holders,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCardinalityError(t *testing.T) {
+	err := fmt.Errorf("failed to create relation: %w", &CardinalityError{
+		Limit:   RelationLimit{EntityType: "document", Relation: "owner", MaxSubjects: 1},
+		Object:  "document:d1",
+		Holders: []string{"user:alice"},
+	})
+
+	assert.ErrorIs(t, err, ErrCardinalityExceeded)
+	assert.Contains(t, err.Error(), "document allows at most 1 owner, and document:d1 already has user:alice")
+}
+
+func TestRelationLimits(t *testing.T) {
+	g := &IdentityGraph{}
+	assert.Zero(t, g.relationLimit("document", "owner"))
+
+	g.setRelationLimits([]RelationLimit{
+		{EntityType: "folder", Relation: "parent", MaxSubjects: 1},
+		{EntityType: "document", Relation: "reviewer", MaxSubjects: 3},
+		{EntityType: "document", Relation: "owner", MaxSubjects: 1},
+	})
+
+	assert.Equal(t, 3, g.relationLimit("document", "reviewer"))
+	assert.Zero(t, g.relationLimit("document", "viewer"))
+	assert.Equal(t, []RelationLimit{
+		{EntityType: "document", Relation: "owner", MaxSubjects: 1},
+		{EntityType: "document", Relation: "reviewer", MaxSubjects: 3},
+		{EntityType: "folder", Relation: "parent", MaxSubjects: 1},
+	}, g.RelationLimits())
+}
@@ -0,0 +1,148 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrConditionTooComplex is matched by a *ConditionLimitError
+var ErrConditionTooComplex = errors.New("permission condition too complex")
+
+// ConditionLimits bound the permission conditions that may be written, so
+// one definition can't make every check of its permission slow. A zero
+// limit is not enforced.
+type ConditionLimits struct {
+	// MaxLength is the longest condition, in bytes
+	MaxLength int
+	// MaxDepth is the deepest nesting of the condition's expressions. A
+	// chain of the same operator, like a or b or c, counts as one level.
+	MaxDepth int
+	// MaxRuleCalls is the most rule calls a condition may make, counting
+	// calls nested in the arguments of others
+	MaxRuleCalls int
+}
+
+// DefaultConditionLimits returns the limits used when the configuration
+// sets none
+func DefaultConditionLimits() ConditionLimits {
+	return ConditionLimits{
+		MaxLength:    4096,
+		MaxDepth:     32,
+		MaxRuleCalls: 16,
+	}
+}
+
+// ConditionLimitError is returned for a condition over one of the limits
+type ConditionLimitError struct {
+	// Limit is "length", "depth" or "rule calls"
+	Limit string
+	Max   int
+	Got   int
+}
+
+func (e *ConditionLimitError) Error() string {
+	return fmt.Sprintf("condition %s is %d, over the limit of %d", e.Limit, e.Got, e.Max)
+}
+
+func (e *ConditionLimitError) Is(target error) bool {
+	return target == ErrConditionTooComplex
+}
+
+// Check fails with a *ConditionLimitError when expr is over a limit. A
+// condition the parser rejects is only held to MaxLength; it fails when it
+// is evaluated, as it always has.
+func (l ConditionLimits) Check(expr string) error {
+	if l.MaxLength > 0 && len(expr) > l.MaxLength {
+		return &ConditionLimitError{Limit: "length", Max: l.MaxLength, Got: len(expr)}
+	}
+	if l.MaxDepth <= 0 && l.MaxRuleCalls <= 0 {
+		return nil
+	}
+
+	parsed, err := NewConditionParser(expr).Parse()
+	if err != nil {
+		return nil
+	}
+	if depth := expressionDepth(parsed); l.MaxDepth > 0 && depth > l.MaxDepth {
+		return &ConditionLimitError{Limit: "depth", Max: l.MaxDepth, Got: depth}
+	}
+	if calls := ruleCalls(parsed); l.MaxRuleCalls > 0 && calls > l.MaxRuleCalls {
+		return &ConditionLimitError{Limit: "rule calls", Max: l.MaxRuleCalls, Got: calls}
+	}
+	return nil
+}
+
+// SetConditionLimits sets the limits AddPermissionDefinition holds
+// conditions to
+func (g *IdentityGraph) SetConditionLimits(limits ConditionLimits) {
+	g.conditionLimits = limits
+}
+
+// expressionDepth is the nesting depth of expr, with a leaf at depth one.
+// The parser nests a chain of ands or ors one level per operator, so an
+// operand of the same operator as its parent stays at the parent's level.
+func expressionDepth(expr Expression) int {
+	switch e := expr.(type) {
+	case *AndExpression:
+		return max(chainDepth(e.Left, e), chainDepth(e.Right, e))
+	case *OrExpression:
+		return max(chainDepth(e.Left, e), chainDepth(e.Right, e))
+	case *NotExpression:
+		return 1 + expressionDepth(e.Operand)
+	case *RuleExpression:
+		deepest := 0
+		for _, arg := range e.Arguments {
+			deepest = max(deepest, expressionDepth(arg))
+		}
+		return 1 + deepest
+	case *ComparisonExpression:
+		return 1 + max(expressionDepth(e.Left), expressionDepth(e.Right))
+	case *InExpression:
+		return 1 + max(expressionDepth(e.Value), expressionDepth(e.List))
+	case *QuantifiedExpression:
+		return 1 + max(expressionDepth(e.List), expressionDepth(e.Right))
+	default:
+		return 1
+	}
+}
+
+// chainDepth is the depth of an operand of parent counting parent's level
+func chainDepth(operand, parent Expression) int {
+	switch operand.(type) {
+	case *AndExpression:
+		if _, ok := parent.(*AndExpression); ok {
+			return expressionDepth(operand)
+		}
+	case *OrExpression:
+		if _, ok := parent.(*OrExpression); ok {
+			return expressionDepth(operand)
+		}
+	}
+	return 1 + expressionDepth(operand)
+}
+
+// ruleCalls counts the rule calls in expr
+func ruleCalls(expr Expression) int {
+	switch e := expr.(type) {
+	case *AndExpression:
+		return ruleCalls(e.Left) + ruleCalls(e.Right)
+	case *OrExpression:
+		return ruleCalls(e.Left) + ruleCalls(e.Right)
+	case *NotExpression:
+		return ruleCalls(e.Operand)
+	case *RuleExpression:
+		calls := 1
+		for _, arg := range e.Arguments {
+			calls += ruleCalls(arg)
+		}
+		return calls
+	case *ComparisonExpression:
+		return ruleCalls(e.Left) + ruleCalls(e.Right)
+	case *InExpression:
+		return ruleCalls(e.Value) + ruleCalls(e.List)
+	case *QuantifiedExpression:
+		return ruleCalls(e.List) + ruleCalls(e.Right)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionLimits(t *testing.T) {
+	limits := ConditionLimits{MaxLength: 200, MaxDepth: 4, MaxRuleCalls: 2}
+
+	for _, expr := range []string{
+		"owner or editor or viewer or org.admin",
+		"owner and not (banned or suspended)",
+		"is_weekday(request.day) and within_budget(subject.limit, request.amount)",
+		// The parser's errors are left to evaluation
+		"owner and (",
+	} {
+		assert.NoError(t, limits.Check(expr), expr)
+	}
+
+	tests := map[string]string{
+		strings.Repeat("owner or ", 30) + "owner":      "length",
+		"a and (b or (c and (d or not e)))":            "depth",
+		"f(request.x) or g(request.y) or h(request.z)": "rule calls",
+		"f(g(h(request.x)))":                           "rule calls",
+	}
+	for expr, limit := range tests {
+		err := limits.Check(expr)
+		require.ErrorIs(t, err, ErrConditionTooComplex, expr)
+		var limitErr *ConditionLimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, limit, limitErr.Limit, expr)
+	}
+
+	assert.NoError(t, ConditionLimits{}.Check(strings.Repeat("(", 100)+"a"+strings.Repeat(")", 100)),
+		"zero limits are not enforced")
+}
+
+func TestExpressionDepth(t *testing.T) {
+	tests := map[string]int{
+		"owner":                         1,
+		"owner or editor or viewer":     2,
+		"owner and (editor or viewer)":  3,
+		"not banned":                    2,
+		"request.amount < 100":          2,
+		"check(request.amount < 100)":   3,
+		"any subject.tags == \"admin\"": 2,
+	}
+	for expr, want := range tests {
+		parsed, err := NewConditionParser(expr).Parse()
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, expressionDepth(parsed), expr)
+	}
+}
@@ -0,0 +1,162 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ContextAny is the data type of a context field whose type the schema
+// doesn't pin down, e.g. one only passed to a built-in function
+const ContextAny = "any"
+
+// ContextField is a request context value a permission reads, written
+// request.<name> in its condition. Its data type is the type of the rule
+// parameter it's passed to, or of the literal it's compared with.
+type ContextField struct {
+	EntityType string `json:"entity_type"`
+	Permission string `json:"permission"`
+	Name       string `json:"name"`
+	DataType   string `json:"data_type"`
+}
+
+// ContextFields lists the context fields the permissions read, sorted by
+// entity type, permission and name. A check pinned with WithSchemaVersion
+// lists that version's.
+func (g *IdentityGraph) ContextFields(ctx context.Context) ([]ContextField, error) {
+	type permission struct{ entityType, name, condition string }
+	var permissions []permission
+
+	if version, ok := PinnedSchemaVersion(ctx); ok {
+		snapshot, err := g.schemaSnapshot(ctx, version)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range snapshot.permissions {
+			permissions = append(permissions, permission{p.EntityType, p.PermissionName, p.ConditionExpression})
+		}
+	} else {
+		rows, err := g.store.Query(ctx, `
+			SELECT entity_type, permission_name, condition_expression FROM permission_definitions
+		`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list permission definitions: %w", err)
+		}
+		for rows.Next() {
+			var p permission
+			if err := rows.Scan(&p.entityType, &p.name, &p.condition); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan permission definition: %w", err)
+			}
+			permissions = append(permissions, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list permission definitions: %w", err)
+		}
+	}
+
+	fields := []ContextField{}
+	for _, p := range permissions {
+		expr, err := NewConditionParser(p.condition).Parse()
+		if err != nil {
+			// A condition that doesn't parse reads nothing; checking it
+			// reports the error
+			continue
+		}
+		types := make(map[string]string)
+		g.collectContextFields(ctx, expr, types)
+		for name, dataType := range types {
+			fields = append(fields, ContextField{EntityType: p.entityType, Permission: p.name, Name: name, DataType: dataType})
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i], fields[j]
+		if a.EntityType != b.EntityType {
+			return a.EntityType < b.EntityType
+		}
+		if a.Permission != b.Permission {
+			return a.Permission < b.Permission
+		}
+		return a.Name < b.Name
+	})
+	return fields, nil
+}
+
+// collectContextFields records the type of each context field expr reads.
+// A field used as two different types is recorded as ContextAny.
+func (g *IdentityGraph) collectContextFields(ctx context.Context, expr Expression, types map[string]string) {
+	note := func(e Expression, dataType string) {
+		field, ok := e.(*ContextExpression)
+		if !ok || len(field.Path) != 2 {
+			return
+		}
+		name := field.Path[1]
+		if was, seen := types[name]; seen && was != dataType {
+			if was == ContextAny {
+				types[name] = dataType
+			} else if dataType != ContextAny {
+				types[name] = ContextAny
+			}
+			return
+		}
+		types[name] = dataType
+	}
+
+	switch e := expr.(type) {
+	case *ContextExpression:
+		note(e, ContextAny)
+	case *AndExpression:
+		g.collectContextFields(ctx, e.Left, types)
+		g.collectContextFields(ctx, e.Right, types)
+	case *OrExpression:
+		g.collectContextFields(ctx, e.Left, types)
+		g.collectContextFields(ctx, e.Right, types)
+	case *NotExpression:
+		g.collectContextFields(ctx, e.Operand, types)
+	case *ComparisonExpression:
+		g.collectContextFields(ctx, e.Left, types)
+		g.collectContextFields(ctx, e.Right, types)
+		note(e.Left, literalType(e.Right, ""))
+		note(e.Right, literalType(e.Left, ""))
+	case *InExpression:
+		g.collectContextFields(ctx, e.Value, types)
+		g.collectContextFields(ctx, e.List, types)
+		note(e.List, literalType(e.Value, "[]"))
+	case *QuantifiedExpression:
+		g.collectContextFields(ctx, e.List, types)
+		g.collectContextFields(ctx, e.Right, types)
+		note(e.List, literalType(e.Right, "[]"))
+	case *RuleExpression:
+		var params []RuleParameter
+		if !IsBuiltinFunction(e.RuleName) {
+			if rule, err := g.schemaRule(ctx, e.RuleName); err == nil {
+				params = rule.Parameters
+			}
+		}
+		for i, arg := range e.Arguments {
+			g.collectContextFields(ctx, arg, types)
+			if i < len(params) && validAttributeType(params[i].DataType) {
+				note(arg, params[i].DataType)
+			}
+		}
+	}
+}
+
+// literalType returns the data type of a literal with suffix appended, or
+// ContextAny for anything else. Numbers are doubles, since the condition
+// language doesn't tell 1 from 1.0.
+func literalType(expr Expression, suffix string) string {
+	literal, ok := expr.(*LiteralExpression)
+	if !ok {
+		return ContextAny
+	}
+	switch literal.Value.(type) {
+	case string:
+		return AttributeString + suffix
+	case float64:
+		return AttributeDouble + suffix
+	}
+	return ContextAny
+}
@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectContextFields(t *testing.T) {
+	g := &IdentityGraph{
+		ruleCache: map[string]*RuleDefinition{
+			"within_limit": {Name: "within_limit", Parameters: []RuleParameter{
+				{Name: "amount", DataType: AttributeInteger},
+				{Name: "limit", DataType: AttributeInteger},
+			}},
+		},
+	}
+
+	for condition, want := range map[string]map[string]string{
+		"owner": {},
+		"within_limit(request.amount, object.limit)":     {"amount": AttributeInteger},
+		`request.region == "eu" and lower(request.name)`: {"region": AttributeString, "name": ContextAny},
+		"not request.score > 0.5":                        {"score": AttributeDouble},
+		`any request.roles == "admin"`:                   {"roles": AttributeStringArray},
+		`request.x == "a" or within_limit(request.x, 1)`: {"x": ContextAny},
+		"unknown_rule(request.amount)":                   {"amount": ContextAny},
+	} {
+		expr, err := NewConditionParser(condition).Parse()
+		require.NoError(t, err, condition)
+		types := make(map[string]string)
+		g.collectContextFields(context.Background(), expr, types)
+		assert.Equal(t, want, types, condition)
+	}
+}
@@ -0,0 +1,340 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Decision reason codes. They are stable so clients can map them to
+// user-facing messages; rule reasons carry the rule name after a colon.
+const (
+	// ReasonMatchedRelation means a direct or indirect relation granted access
+	ReasonMatchedRelation = "matched_relation"
+	// ReasonMatchedRule prefixes the name of the rule that granted access
+	ReasonMatchedRule = "matched_rule"
+	// ReasonMatchedAttribute means a required entity attribute was present
+	ReasonMatchedAttribute = "matched_attribute"
+	// ReasonMatchedContext means a required context value was present
+	ReasonMatchedContext = "matched_context"
+	// ReasonMatchedCondition means a comparison, membership or quantified
+	// comparison held
+	ReasonMatchedCondition = "matched_condition"
+	// ReasonMatchedNegation means a negated operand, as in "not banned", did
+	// not hold
+	ReasonMatchedNegation = "matched_negation"
+
+	// ReasonDeniedNoPath means no relation connects the subject to the object
+	ReasonDeniedNoPath = "denied_no_path"
+	// ReasonDeniedByRule prefixes the name of the rule that denied access
+	ReasonDeniedByRule = "denied_by_rule"
+	// ReasonDeniedMissingAttribute means a required attribute was not set
+	ReasonDeniedMissingAttribute = "denied_missing_attribute"
+	// ReasonDeniedMissingContext means a required context value was absent
+	ReasonDeniedMissingContext = "denied_missing_context"
+	// ReasonDeniedByCondition means a comparison, membership or quantified
+	// comparison did not hold
+	ReasonDeniedByCondition = "denied_by_condition"
+	// ReasonDeniedByExclusion means a negated operand held, e.g. the subject
+	// has the relation "not banned" excludes
+	ReasonDeniedByExclusion = "denied_by_exclusion"
+	// ReasonUnknownPermission means the permission is not defined for the
+	// object's type
+	ReasonUnknownPermission = "unknown_permission"
+	// ReasonHook prefixes the name of the check hook that decided or
+	// overrode the check without giving a reason of its own
+	ReasonHook = "hook"
+)
+
+// Decision is the outcome of a permission check and the reason for it
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+func ruleReason(prefix, ruleName string) string {
+	return prefix + ":" + ruleName
+}
+
+// DecideCondition evaluates a permission condition expression and reports
+// why it was allowed or denied
+func (g *IdentityGraph) DecideCondition(ctx context.Context, conditionExpr,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (d Decision, err error) {
+
+	ctx, span := tracing.Start(ctx, "graph.DecideCondition", attribute.String("object_type", objectType))
+	defer func() {
+		span.SetAttributes(attribute.Bool("allowed", d.Allowed), attribute.String("reason", d.Reason))
+		tracing.End(span, err)
+	}()
+
+	_, parseSpan := tracing.Start(ctx, "graph.ParseCondition")
+	expr, err := NewConditionParser(conditionExpr).Parse()
+	tracing.End(parseSpan, err)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to parse condition: %w", err)
+	}
+
+	// Checks are counted under each evaluator flag, on or off for the object
+	arms := g.flagArms(objectType, objectID)
+	ctx, walk, outermost := startWalk(ctx)
+	start := time.Now()
+	d, err = g.decideExpression(ctx, g.planExpression(expr, objectType), subjectType, subjectID, objectType, objectID, contextData)
+	g.recordFlagCheck(arms, d, err, time.Since(start))
+	if outermost {
+		g.recordWalk(walk)
+	}
+	return d, err
+}
+
+// decideOr combines the operands of a denied "or" whose left operand denied
+func decideOr(left, right Decision, err error) (Decision, error) {
+	if err != nil || right.Allowed {
+		return right, err
+	}
+	if left.Reason == ReasonDeniedNoPath {
+		return left, nil
+	}
+	return right, nil
+}
+
+// decideOrParallel evaluates both operands of an "or" at once. It decides
+// as the sequential evaluation does: the left operand wins when it allows
+// or fails, and the right one is abandoned.
+func (g *IdentityGraph) decideOrParallel(ctx context.Context, e *OrExpression,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (Decision, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		d   Decision
+		err error
+	}
+	rightDone := make(chan result, 1)
+	go func() {
+		d, err := g.decideExpression(ctx, e.Right, subjectType, subjectID, objectType, objectID, contextData)
+		rightDone <- result{d, err}
+	}()
+
+	left, err := g.decideExpression(ctx, e.Left, subjectType, subjectID, objectType, objectID, contextData)
+	if err != nil || left.Allowed {
+		return left, err
+	}
+	right := <-rightDone
+	return decideOr(left, right.d, right.err)
+}
+
+// decideExpression evaluates a parsed condition. An allowed "and" reports its
+// last operand's reason; a denied "or" prefers denied_no_path so clients can
+// tell the user which relationship they lack.
+func (g *IdentityGraph) decideExpression(ctx context.Context, expr Expression,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (Decision, error) {
+
+	// Every node may query the graph, so a request out of time stops here
+	// rather than starting another query
+	if err := budget.Check(ctx); err != nil {
+		return Decision{}, err
+	}
+
+	switch e := expr.(type) {
+	case *AndExpression:
+		left, err := g.decideExpression(ctx, e.Left, subjectType, subjectID, objectType, objectID, contextData)
+		if err != nil || !left.Allowed {
+			return left, err
+		}
+		return g.decideExpression(ctx, e.Right, subjectType, subjectID, objectType, objectID, contextData)
+
+	case *OrExpression:
+		if g.flagEnabled(FlagParallelOr, objectType, objectID) && g.concurrent {
+			return g.decideOrParallel(ctx, e, subjectType, subjectID, objectType, objectID, contextData)
+		}
+		left, err := g.decideExpression(ctx, e.Left, subjectType, subjectID, objectType, objectID, contextData)
+		if err != nil || left.Allowed {
+			return left, err
+		}
+		right, err := g.decideExpression(ctx, e.Right, subjectType, subjectID, objectType, objectID, contextData)
+		return decideOr(left, right, err)
+
+	case *NotExpression:
+		operand, err := g.decideExpression(ctx, e.Operand, subjectType, subjectID, objectType, objectID, contextData)
+		if err != nil {
+			return Decision{}, err
+		}
+		return decision(!operand.Allowed, ReasonMatchedNegation, ReasonDeniedByExclusion), nil
+
+	case *RelationExpression:
+		if e.RelationPath == "" && g.declaresAttribute(objectType, e.RelationName) {
+			value, err := g.getEntityAttribute(ctx, objectType, objectID, e.RelationName)
+			if err != nil && !errors.Is(err, ErrAttributeNotFound) {
+				return Decision{}, fmt.Errorf("failed to get attribute: %w", err)
+			}
+			return attributeDecision(value), nil
+		}
+		if e.RelationPath != "" {
+			// organization.verified reads an attribute of the related
+			// organization when it has one; otherwise it is a relation
+			values, err := g.relatedAttributes(ctx, e.RelationPath, e.RelationName, objectType, objectID)
+			if err != nil {
+				return Decision{}, err
+			}
+			if len(values) > 0 {
+				for _, v := range values {
+					if attributeTruthy(v) {
+						return attributeDecision(v), nil
+					}
+				}
+				return attributeDecision(values[0]), nil
+			}
+
+			// parent.view is the view permission of the parent, when the
+			// parent's type defines one
+			inherited, handled, err := g.decideInherited(ctx, e, subjectType, subjectID, objectType, objectID, contextData)
+			if err != nil || handled {
+				return inherited, err
+			}
+		}
+
+		var allowed bool
+		var err error
+		if e.RelationPath == "" {
+			// Direct relation check (e.g., "owner")
+			allowed, err = g.checkDirectRelation(ctx, subjectType, subjectID, e.RelationName, objectType, objectID)
+		} else {
+			// Indirect relation check (e.g., "organization.owner")
+			allowed, err = g.checkIndirectRelation(ctx, subjectType, subjectID, e.RelationPath, e.RelationName, objectType, objectID)
+		}
+		return decision(allowed, ReasonMatchedRelation, ReasonDeniedNoPath), err
+
+	case *ContextExpression:
+		exists, err := contextValueExists(contextData, e.Path)
+		return decision(exists, ReasonMatchedContext, ReasonDeniedMissingContext), err
+
+	case *AttributeExpression:
+		attributeValue, err := g.attributeValue(ctx, e, subjectType, subjectID, objectType, objectID)
+		if err != nil && !errors.Is(err, ErrAttributeNotFound) {
+			return Decision{}, fmt.Errorf("failed to get attribute: %w", err)
+		}
+		return attributeDecision(attributeValue), nil
+
+	case *RuleExpression:
+		if IsBuiltinFunction(e.RuleName) {
+			args, err := g.evaluateBuiltinArgs(ctx, e, subjectType, subjectID, objectType, objectID, contextData)
+			if errors.Is(err, ErrAttributeNotFound) {
+				return decision(false, "", ReasonDeniedMissingAttribute), nil
+			}
+			if err != nil {
+				return Decision{}, err
+			}
+			allowed, err := callBuiltinPredicate(e.RuleName, args)
+			return decision(allowed, ruleReason(ReasonMatchedRule, e.RuleName), ruleReason(ReasonDeniedByRule, e.RuleName)), err
+		}
+		ruleCtx, cancel := budget.Rules(ctx)
+		allowed, err := g.evaluateRule(ruleCtx, e, subjectType, subjectID, objectType, objectID, contextData)
+		cancel()
+		if errors.Is(err, ErrAttributeNotFound) {
+			return decision(false, "", ReasonDeniedMissingAttribute), nil
+		}
+		return decision(allowed, ruleReason(ReasonMatchedRule, e.RuleName), ruleReason(ReasonDeniedByRule, e.RuleName)), err
+
+	case *ComparisonExpression, *InExpression, *QuantifiedExpression:
+		matched, err := g.compareCondition(ctx, expr, subjectType, subjectID, objectType, objectID, contextData)
+		if errors.Is(err, ErrAttributeNotFound) {
+			return decision(false, "", ReasonDeniedMissingAttribute), nil
+		}
+		return decision(matched, ReasonMatchedCondition, ReasonDeniedByCondition), err
+
+	default:
+		return Decision{}, fmt.Errorf("unknown expression type: %T", expr)
+	}
+}
+
+// compareCondition evaluates a comparison, membership test or quantified
+// comparison in a permission condition
+func (g *IdentityGraph) compareCondition(ctx context.Context, expr Expression,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (bool, error) {
+
+	value := func(operand Expression) (interface{}, error) {
+		return g.conditionValue(ctx, operand, subjectType, subjectID, objectType, objectID, contextData)
+	}
+
+	switch e := expr.(type) {
+	case *ComparisonExpression:
+		left, err := value(e.Left)
+		if err != nil {
+			return false, err
+		}
+		right, err := value(e.Right)
+		if err != nil {
+			return false, err
+		}
+		return g.compareValues(left, e.Operator, right)
+
+	case *InExpression:
+		member, err := value(e.Value)
+		if err != nil {
+			return false, err
+		}
+		list, err := value(e.List)
+		if err != nil {
+			return false, err
+		}
+		return g.memberOf(member, list)
+
+	case *QuantifiedExpression:
+		list, err := value(e.List)
+		if err != nil {
+			return false, err
+		}
+		right, err := value(e.Right)
+		if err != nil {
+			return false, err
+		}
+		return g.quantify(e.Quantifier, list, e.Operator, right)
+
+	default:
+		return false, fmt.Errorf("not a comparison: %T", expr)
+	}
+}
+
+func decision(allowed bool, allowReason, denyReason string) Decision {
+	if allowed {
+		return Decision{Allowed: true, Reason: allowReason}
+	}
+	return Decision{Allowed: false, Reason: denyReason}
+}
+
+// contextValueExists reports whether the context holds a value at path
+func contextValueExists(contextData map[string]interface{}, path []string) (bool, error) {
+	if contextData == nil {
+		return false, fmt.Errorf("context data required but not provided")
+	}
+
+	currentValue := contextData
+	for i, pathPart := range path {
+		if i == len(path)-1 {
+			// For comparison purposes, we just return true if the key exists
+			_, exists := currentValue[pathPart]
+			return exists, nil
+		}
+
+		nextValue, exists := currentValue[pathPart]
+		if !exists {
+			return false, fmt.Errorf("context path not found: %s", strings.Join(path, "."))
+		}
+
+		nextMap, ok := nextValue.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("context path is not a map: %s", strings.Join(path[:i+1], "."))
+		}
+
+		currentValue = nextMap
+	}
+
+	return false, fmt.Errorf("invalid context path: %s", strings.Join(path, "."))
+}
@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDecideCondition(t *testing.T) {
+	g := &IdentityGraph{ruleCache: map[string]*RuleDefinition{
+		"withinLimit": {
+			Name:       "withinLimit",
+			Parameters: []RuleParameter{{Name: "amount", DataType: "number"}, {Name: "limit", DataType: "number"}},
+			Expression: "amount <= limit",
+		},
+	}}
+
+	contextData := map[string]interface{}{
+		"request": map[string]interface{}{
+			"approved": true,
+			"amount":   50.0,
+			"large":    500.0,
+			"limit":    100.0,
+		},
+	}
+
+	tests := []struct {
+		condition string
+		allowed   bool
+		reason    string
+	}{
+		{"request.approved", true, ReasonMatchedContext},
+		{"request.missing", false, ReasonDeniedMissingContext},
+		{"withinLimit(request.amount, request.limit)", true, "matched_rule:withinLimit"},
+		{"withinLimit(request.large, request.limit)", false, "denied_by_rule:withinLimit"},
+		{"request.missing or withinLimit(request.amount, request.limit)", true, "matched_rule:withinLimit"},
+		{"request.approved and withinLimit(request.large, request.limit)", false, "denied_by_rule:withinLimit"},
+		{"request.missing and withinLimit(request.amount, request.limit)", false, ReasonDeniedMissingContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			decision, err := g.DecideCondition(context.Background(), tt.condition, "user", "alice", "document", "plan", contextData)
+			if err != nil {
+				t.Fatalf("DecideCondition(%q) returned error: %v", tt.condition, err)
+			}
+			if decision.Allowed != tt.allowed || decision.Reason != tt.reason {
+				t.Errorf("DecideCondition(%q) = %+v, want allowed=%v reason=%q", tt.condition, decision, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+// failingInjector fails every point it's asked about and records them
+type failingInjector struct{ points []string }
+
+func (f *failingInjector) Inject(ctx context.Context, point string) error {
+	f.points = append(f.points, point)
+	return errors.New("injected")
+}
+
+func TestFaultInjector(t *testing.T) {
+	g := &IdentityGraph{ruleCache: map[string]*RuleDefinition{
+		"withinLimit": {
+			Name:       "withinLimit",
+			Parameters: []RuleParameter{{Name: "amount", DataType: "number"}, {Name: "limit", DataType: "number"}},
+			Expression: "amount <= limit",
+		},
+	}}
+	injector := &failingInjector{}
+	g.SetFaultInjector(injector)
+
+	contextData := map[string]interface{}{"request": map[string]interface{}{"amount": 50.0, "limit": 100.0}}
+	_, err := g.DecideCondition(context.Background(), "withinLimit(request.amount, request.limit)", "user", "alice", "document", "1", contextData)
+	if err == nil {
+		t.Fatal("DecideCondition succeeded despite an injected rule lookup failure")
+	}
+	if len(injector.points) != 1 || injector.points[0] != FaultPointRuleCache {
+		t.Errorf("injector asked about %v, want [%s]", injector.points, FaultPointRuleCache)
+	}
+
+	g.SetFaultInjector(nil)
+	if _, err := g.DecideCondition(context.Background(), "withinLimit(request.amount, request.limit)", "user", "alice", "document", "1", contextData); err != nil {
+		t.Errorf("DecideCondition() with injection off returned error: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidRelation is matched by a *RelationValidationError
+var ErrInvalidRelation = errors.New("relation not declared by the schema")
+
+// RelationValidationError is returned for a relation write the schema
+// doesn't allow: ObjectType declares no such relation, or the relation
+// takes other subject types
+type RelationValidationError struct {
+	SubjectType string
+	Relation    string
+	ObjectType  string
+	// Allowed are the subject types the relation takes, empty when
+	// ObjectType doesn't declare it
+	Allowed []string
+	// Reversed is set when the schema declares the relation the other way
+	// round, with SubjectType declaring it on ObjectType
+	Reversed bool
+}
+
+func (e *RelationValidationError) Error() string {
+	var msg string
+	if len(e.Allowed) == 0 {
+		msg = fmt.Sprintf("%s declares no relation %q", e.ObjectType, e.Relation)
+	} else {
+		msg = fmt.Sprintf("%s.%s takes %s subjects, not %s",
+			e.ObjectType, e.Relation, strings.Join(e.Allowed, " or "), e.SubjectType)
+	}
+	if e.Reversed {
+		msg += fmt.Sprintf("; %s declares %s @%s, so the subject and object may be swapped",
+			e.SubjectType, e.Relation, e.ObjectType)
+	}
+	return msg
+}
+
+func (e *RelationValidationError) Is(target error) bool {
+	return target == ErrInvalidRelation
+}
+
+// loadRelationDeclarations replaces the cached relation declarations with
+// those in the database
+func (g *IdentityGraph) loadRelationDeclarations(ctx context.Context) error {
+	rows, err := g.store.Query(ctx, `
+		SELECT entity_type, relation, subject_type
+		FROM relation_declarations
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query relation declarations: %w", err)
+	}
+	defer rows.Close()
+
+	var declared []RelationDeclaration
+	for rows.Next() {
+		var d RelationDeclaration
+		if err := rows.Scan(&d.EntityType, &d.Relation, &d.TargetType); err != nil {
+			return fmt.Errorf("failed to scan relation declaration: %w", err)
+		}
+		declared = append(declared, d)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating relation declarations: %w", err)
+	}
+
+	g.setRelationDeclarations(declared)
+	return nil
+}
+
+// ReloadRelationDeclarations re-reads the relation declarations, e.g.
+// after another replica synced the schema
+func (g *IdentityGraph) ReloadRelationDeclarations(ctx context.Context) error {
+	return g.loadRelationDeclarations(ctx)
+}
+
+func (g *IdentityGraph) setRelationDeclarations(declared []RelationDeclaration) {
+	byKey := make(map[relationKey][]string)
+	for _, d := range declared {
+		key := relationKey{d.EntityType, d.Relation}
+		byKey[key] = append(byKey[key], d.TargetType)
+	}
+	for _, targets := range byKey {
+		sort.Strings(targets)
+	}
+
+	g.declaredMu.Lock()
+	g.declared = byKey
+	g.declaredMu.Unlock()
+}
+
+// SyncRelationDeclarations replaces the stored relation declarations with
+// declared, as in the current schema, and validates relation writes against
+// them. Relations already stored are left alone.
+func (g *IdentityGraph) SyncRelationDeclarations(ctx context.Context, declared []RelationDeclaration) error {
+	err := pgx.BeginFunc(ctx, g.store, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM relation_declarations`); err != nil {
+			return err
+		}
+		for _, d := range declared {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO relation_declarations (entity_type, relation, subject_type)
+				VALUES ($1, $2, $3)
+				ON CONFLICT DO NOTHING
+			`, d.EntityType, d.Relation, d.TargetType); err != nil {
+				return fmt.Errorf("failed to store relation declaration %s.%s: %w", d.EntityType, d.Relation, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync relation declarations: %w", err)
+	}
+
+	g.setRelationDeclarations(declared)
+	return nil
+}
+
+// SetRelationValidation turns validation of relation writes against the
+// schema on or off. It is on by default.
+func (g *IdentityGraph) SetRelationValidation(enabled bool) {
+	g.declaredMu.Lock()
+	g.skipValidation = !enabled
+	g.declaredMu.Unlock()
+}
+
+// ValidateRelation fails with a *RelationValidationError when the schema
+// doesn't declare the relation on objectType for subjects of subjectType.
+// A subject set's relation, e.g. member in group:eng#member, must be
+// declared on the subject's type too. Every write is allowed until a
+// schema with relations has been synced.
+func (g *IdentityGraph) ValidateRelation(subjectType, subjectID, relation, objectType string) error {
+	g.declaredMu.RLock()
+	defer g.declaredMu.RUnlock()
+	if g.skipValidation || len(g.declared) == 0 {
+		return nil
+	}
+
+	if err := g.validateDeclared(subjectType, relation, objectType); err != nil {
+		return err
+	}
+	if _, setRelation, ok := ParseSubjectSet(subjectID); ok {
+		if _, declared := g.declared[relationKey{subjectType, setRelation}]; !declared {
+			return fmt.Errorf("subject set %s:%s: %w", subjectType, subjectID,
+				&RelationValidationError{Relation: setRelation, ObjectType: subjectType})
+		}
+	}
+	return nil
+}
+
+// validateDeclared checks one relation against the declarations; the
+// caller holds declaredMu
+func (g *IdentityGraph) validateDeclared(subjectType, relation, objectType string) error {
+	allowed := g.declared[relationKey{objectType, relation}]
+	for _, target := range allowed {
+		if target == subjectType {
+			return nil
+		}
+	}
+
+	reversed := false
+	for _, target := range g.declared[relationKey{subjectType, relation}] {
+		reversed = reversed || target == objectType
+	}
+	return &RelationValidationError{
+		SubjectType: subjectType,
+		Relation:    relation,
+		ObjectType:  objectType,
+		Allowed:     allowed,
+		Reversed:    reversed,
+	}
+}
@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRelation(t *testing.T) {
+	g := &IdentityGraph{}
+	assert.NoError(t, g.ValidateRelation("user", "alice", "anything", "document"), "nothing is validated before a schema is synced")
+
+	g.setRelationDeclarations([]RelationDeclaration{
+		{EntityType: "document", Relation: "viewer", TargetType: "user"},
+		{EntityType: "document", Relation: "viewer", TargetType: "group"},
+		{EntityType: "group", Relation: "member", TargetType: "user"},
+	})
+
+	assert.NoError(t, g.ValidateRelation("user", "alice", "viewer", "document"))
+	assert.NoError(t, g.ValidateRelation("group", "eng", "viewer", "document"))
+	assert.NoError(t, g.ValidateRelation("group", "eng#member", "viewer", "document"))
+
+	tests := []struct {
+		name                                     string
+		subjectType, subjectID, relation, object string
+		want                                     string
+	}{
+		{"unknown relation", "user", "alice", "veiwer", "document", `document declares no relation "veiwer"`},
+		{"wrong subject type", "team", "t1", "viewer", "document", "document.viewer takes group or user subjects, not team"},
+		{"undeclared subject set", "group", "eng#admin", "viewer", "document", `subject set group:eng#admin: group declares no relation "admin"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.ValidateRelation(tt.subjectType, tt.subjectID, tt.relation, tt.object)
+			require.ErrorIs(t, err, ErrInvalidRelation)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+
+	g.SetRelationValidation(false)
+	assert.NoError(t, g.ValidateRelation("team", "t1", "viewer", "document"))
+}
+
+func TestRelationValidationErrorReversed(t *testing.T) {
+	g := &IdentityGraph{}
+	g.setRelationDeclarations([]RelationDeclaration{
+		{EntityType: "document", Relation: "owner", TargetType: "user"},
+	})
+
+	err := fmt.Errorf("failed to create relation: %w", g.ValidateRelation("document", "d1", "owner", "user"))
+	assert.ErrorIs(t, err, ErrInvalidRelation)
+	assert.Contains(t, err.Error(), `user declares no relation "owner"; document declares owner @user, so the subject and object may be swapped`)
+}
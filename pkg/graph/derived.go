@@ -0,0 +1,191 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DerivedRelation gives every subject of SubjectType the relation on
+// entities of EntityType whose Attribute is truthy, or equal to Value when
+// it is set. It is evaluated during checks rather than written as tuples.
+type DerivedRelation struct {
+	EntityType  string      `json:"entity_type" yaml:"entity_type"`
+	Relation    string      `json:"relation" yaml:"relation"`
+	SubjectType string      `json:"subject_type" yaml:"subject_type"`
+	Attribute   string      `json:"attribute" yaml:"attribute"`
+	Value       interface{} `json:"value,omitempty" yaml:"value"`
+}
+
+// derivedKey finds the derived relations that can satisfy a direct relation
+// check
+type derivedKey struct {
+	entityType, relation string
+}
+
+// loadDerivedRelations replaces the cached derived relations with those in
+// the database
+func (g *IdentityGraph) loadDerivedRelations(ctx context.Context) error {
+	rows, err := g.store.Query(ctx, `
+		SELECT entity_type, relation, subject_type, attribute, value
+		FROM derived_relations
+		ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query derived relations: %w", err)
+	}
+	defer rows.Close()
+
+	var derived []DerivedRelation
+	for rows.Next() {
+		var d DerivedRelation
+		var valueJSON []byte
+		if err := rows.Scan(&d.EntityType, &d.Relation, &d.SubjectType, &d.Attribute, &valueJSON); err != nil {
+			return fmt.Errorf("failed to scan derived relation: %w", err)
+		}
+		if valueJSON != nil {
+			if err := json.Unmarshal(valueJSON, &d.Value); err != nil {
+				return fmt.Errorf("failed to parse derived relation value: %w", err)
+			}
+		}
+		derived = append(derived, d)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating derived relations: %w", err)
+	}
+
+	g.setDerivedRelations(derived)
+	return nil
+}
+
+func (g *IdentityGraph) setDerivedRelations(derived []DerivedRelation) {
+	byKey := make(map[derivedKey][]DerivedRelation)
+	for _, d := range derived {
+		key := derivedKey{d.EntityType, d.Relation}
+		byKey[key] = append(byKey[key], d)
+	}
+
+	g.derivedMu.Lock()
+	g.derived = byKey
+	g.derivedMu.Unlock()
+}
+
+// DerivedRelations returns the derived relations in effect, ordered by
+// entity type and relation
+func (g *IdentityGraph) DerivedRelations() []DerivedRelation {
+	g.derivedMu.RLock()
+	defer g.derivedMu.RUnlock()
+
+	all := []DerivedRelation{}
+	for _, derived := range g.derived {
+		all = append(all, derived...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].EntityType != all[j].EntityType {
+			return all[i].EntityType < all[j].EntityType
+		}
+		return all[i].Relation < all[j].Relation
+	})
+	return all
+}
+
+// SyncDerivedRelations replaces the stored derived relations with derived,
+// as declared by the current schema, and starts using them
+func (g *IdentityGraph) SyncDerivedRelations(ctx context.Context, derived []DerivedRelation) error {
+	err := pgx.BeginFunc(ctx, g.store, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM derived_relations`); err != nil {
+			return err
+		}
+		for _, d := range derived {
+			var valueJSON []byte
+			if d.Value != nil {
+				var err error
+				if valueJSON, err = json.Marshal(d.Value); err != nil {
+					return fmt.Errorf("derived relation %s.%s: %w", d.EntityType, d.Relation, err)
+				}
+			}
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO derived_relations (entity_type, relation, subject_type, attribute, value)
+				VALUES ($1, $2, $3, $4, $5)
+			`, d.EntityType, d.Relation, d.SubjectType, d.Attribute, valueJSON); err != nil {
+				return fmt.Errorf("failed to store derived relation %s.%s: %w", d.EntityType, d.Relation, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync derived relations: %w", err)
+	}
+
+	g.setDerivedRelations(derived)
+	return nil
+}
+
+// checkDerivedRelation reports whether a derived relation gives subjects of
+// subjectType the relation on the object, from the object's attributes
+func (g *IdentityGraph) checkDerivedRelation(ctx context.Context,
+	subjectType, relation, objectType, objectID string) (bool, error) {
+
+	g.derivedMu.RLock()
+	candidates := g.derived[derivedKey{objectType, relation}]
+	g.derivedMu.RUnlock()
+
+	for _, d := range candidates {
+		if d.SubjectType != subjectType {
+			continue
+		}
+		value, err := g.getEntityAttribute(ctx, objectType, objectID, d.Attribute)
+		if errors.Is(err, ErrAttributeNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if derivedValueMatches(d, value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// derivedValueMatches compares an attribute with a derived relation's
+// value. Numbers compare by value, since stored attributes come back from
+// JSON as float64 while the schema may give an integer.
+func derivedValueMatches(d DerivedRelation, value interface{}) bool {
+	if d.Value == nil {
+		return attributeTruthy(value)
+	}
+	want, wantNumber := number(d.Value)
+	got, gotNumber := number(value)
+	if wantNumber && gotNumber {
+		return want == got
+	}
+	return reflect.DeepEqual(normalizeJSON(d.Value), normalizeJSON(value))
+}
+
+// number converts numeric values, but not numeric strings, to float64
+func number(value interface{}) (float64, bool) {
+	if _, isString := value.(string); isString {
+		return 0, false
+	}
+	return toFloat64(value)
+}
+
+// normalizeJSON gives a value the types it would have after a JSON round
+// trip, so typed slices compare equal to decoded ones
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
@@ -0,0 +1,48 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDerivedValueMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  interface{}
+		value interface{}
+		match bool
+	}{
+		{"truthy boolean", nil, true, true},
+		{"false boolean", nil, false, false},
+		{"present value", nil, "draft", true},
+		{"equal string", "public", "public", true},
+		{"different string", "public", "private", false},
+		{"integer against stored number", int64(2), float64(2), true},
+		{"numeric string is not a number", int64(2), "2", false},
+		{"boolean value", false, false, true},
+		{"list", []interface{}{"a"}, []interface{}{"a"}, true},
+		{"typed list", []string{"a"}, []interface{}{"a"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DerivedRelation{Attribute: "attr", Value: tt.want}
+			assert.Equal(t, tt.match, derivedValueMatches(d, tt.value))
+		})
+	}
+}
+
+func TestDerivedRelationsSorted(t *testing.T) {
+	g := &IdentityGraph{}
+	g.setDerivedRelations([]DerivedRelation{
+		{EntityType: "project", Relation: "viewer", SubjectType: "user", Attribute: "visibility", Value: "public"},
+		{EntityType: "document", Relation: "reader", SubjectType: "user", Attribute: "published"},
+		{EntityType: "document", Relation: "reader", SubjectType: "team", Attribute: "published"},
+	})
+
+	derived := g.DerivedRelations()
+	assert.Equal(t, []string{"document", "document", "project"},
+		[]string{derived[0].EntityType, derived[1].EntityType, derived[2].EntityType})
+	assert.Equal(t, "user", derived[0].SubjectType, "declaration order is kept within a relation")
+}
@@ -0,0 +1,98 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+)
+
+// StrictDirectionAll makes every object type strict
+const StrictDirectionAll = "*"
+
+// SetStrictRelationDirection sets the object types whose direct relations
+// only match subject->object. Other types also accept a tuple written the
+// other way round, which hides mistakes and costs a wider query.
+func (g *IdentityGraph) SetStrictRelationDirection(objectTypes []string) {
+	strict := make(map[string]bool, len(objectTypes))
+	for _, objectType := range objectTypes {
+		strict[objectType] = true
+	}
+
+	g.strictDirectionMu.Lock()
+	g.strictDirection = strict
+	g.strictDirectionMu.Unlock()
+}
+
+// strictRelationDirection reports whether relations on every object of
+// objectType must be stored subject->object. A partial strict_direction
+// rollout only applies to checks; lookups keep matching both directions
+// and verify their candidates with checks.
+func (g *IdentityGraph) strictRelationDirection(objectType string) bool {
+	g.strictDirectionMu.RLock()
+	strict := g.strictDirection[objectType] || g.strictDirection[StrictDirectionAll]
+	g.strictDirectionMu.RUnlock()
+	return strict || g.flagFullyEnabled(FlagStrictDirection, objectType)
+}
+
+// RelationDeclaration is a relation a schema declares on an entity type,
+// e.g. "relation owner @user" on document
+type RelationDeclaration struct {
+	EntityType string
+	Relation   string
+	TargetType string
+}
+
+// ReverseOnlyRelations finds tuples stored object->subject for the declared
+// relations, with no subject->object counterpart. They only satisfy checks
+// through the bidirectional fallback and stop matching once their object
+// type is strict. At most limit tuples are returned per declaration.
+func (g *IdentityGraph) ReverseOnlyRelations(ctx context.Context, declared []RelationDeclaration, limit int) ([]Relation, error) {
+	// A reversed tuple is only recognisable when the reverse reading isn't
+	// itself declared, e.g. not for "relation manager @user" on user
+	valid := make(map[RelationDeclaration]bool, len(declared))
+	for _, d := range declared {
+		valid[d] = true
+	}
+
+	relations := []Relation{}
+	for _, d := range declared {
+		if valid[RelationDeclaration{EntityType: d.TargetType, Relation: d.Relation, TargetType: d.EntityType}] {
+			continue
+		}
+
+		rows, err := g.store.Query(ctx, `
+			SELECT r.id, r.subject_type, r.subject_id, r.relation, r.object_type, r.object_id, r.created_at
+			FROM relations r
+			WHERE r.relation = $1 AND r.subject_type = $2 AND r.object_type = $3
+			AND NOT EXISTS (
+				SELECT 1
+				FROM relations f
+				WHERE f.subject_type = r.object_type
+				AND f.subject_id = r.object_id
+				AND f.relation = r.relation
+				AND f.object_type = r.subject_type
+				AND f.object_id = r.subject_id
+			)
+			ORDER BY r.id
+			LIMIT $4
+		`, d.Relation, d.EntityType, d.TargetType, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find reversed %s.%s relations: %w", d.EntityType, d.Relation, err)
+		}
+
+		for rows.Next() {
+			var rel Relation
+			if err := rows.Scan(&rel.ID, &rel.SubjectType, &rel.SubjectID, &rel.Relation,
+				&rel.ObjectType, &rel.ObjectID, &rel.CreatedAt); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan relation: %w", err)
+			}
+			relations = append(relations, rel)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating relations: %w", err)
+		}
+	}
+
+	return relations, nil
+}
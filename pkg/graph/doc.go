@@ -0,0 +1,23 @@
+// Package graph is supra's permission engine: the identity graph of
+// entities and the relations between them, and the evaluator that decides
+// permission conditions such as "owner or organization.admin" over it.
+//
+// The authz service serves it over HTTP and gRPC, but a Go service that
+// can't afford a network call per check can embed it over its own
+// Postgres connection:
+//
+//	pool, err := pgxpool.New(ctx, os.Getenv("DATABASE_URL"))
+//	...
+//	if err := graph.Migrate(ctx, stdlib.OpenDBFromPool(pool)); err != nil {
+//		...
+//	}
+//	g, err := graph.New(ctx, pool)
+//	...
+//	allowed, err := g.CheckPermission(ctx, "user", "alice", "edit", "document", "d1", nil)
+//
+// A graph over a pool serves concurrent checks. One can also be built over
+// a pgx.Tx, so writes to the graph commit or roll back with the service's
+// own, but like the transaction it is used from one goroutine at a time.
+// The database is shared with an authz service pointed at it, which serves
+// the same relations and permission definitions.
+package graph
@@ -0,0 +1,394 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Data types an attribute can be declared with, as in the schema's
+// "attribute public boolean"
+const (
+	AttributeBoolean      = string(model.AttributeTypeBoolean)
+	AttributeBooleanArray = string(model.AttributeTypeBooleanArray)
+	AttributeString       = string(model.AttributeTypeString)
+	AttributeStringArray  = string(model.AttributeTypeStringArray)
+	AttributeInteger      = string(model.AttributeTypeInteger)
+	AttributeIntegerArray = string(model.AttributeTypeIntegerArray)
+	AttributeDouble       = string(model.AttributeTypeDouble)
+	AttributeDoubleArray  = string(model.AttributeTypeDoubleArray)
+)
+
+// ErrUndeclaredAttribute is returned for a typed attribute write the schema
+// doesn't declare on the entity's type
+var ErrUndeclaredAttribute = errors.New("attribute not declared by the schema")
+
+// ErrAttributeType is returned for an attribute value that isn't of, and
+// can't be read as, the attribute's declared data type
+var ErrAttributeType = errors.New("attribute value does not match its data type")
+
+// AttributeDeclaration is an attribute the schema declares on an entity type
+type AttributeDeclaration struct {
+	EntityType string
+	Attribute  string
+	DataType   string
+}
+
+// TypedAttribute is a declared attribute's value on an entity
+type TypedAttribute struct {
+	EntityType string      `json:"entity_type"`
+	EntityID   string      `json:"entity_id"`
+	Attribute  string      `json:"attribute"`
+	DataType   string      `json:"data_type"`
+	Value      interface{} `json:"value"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+type attributeKey struct {
+	entityType string
+	attribute  string
+}
+
+// loadAttributeDeclarations replaces the cached attribute declarations with
+// those in the database
+func (g *IdentityGraph) loadAttributeDeclarations(ctx context.Context) error {
+	rows, err := g.store.Query(ctx, `
+		SELECT entity_type, attribute, data_type
+		FROM attribute_declarations
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query attribute declarations: %w", err)
+	}
+	defer rows.Close()
+
+	var declared []AttributeDeclaration
+	for rows.Next() {
+		var d AttributeDeclaration
+		if err := rows.Scan(&d.EntityType, &d.Attribute, &d.DataType); err != nil {
+			return fmt.Errorf("failed to scan attribute declaration: %w", err)
+		}
+		declared = append(declared, d)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating attribute declarations: %w", err)
+	}
+
+	g.setAttributeDeclarations(declared)
+	return nil
+}
+
+// ReloadAttributeDeclarations re-reads the attribute declarations, e.g.
+// after another replica synced the schema
+func (g *IdentityGraph) ReloadAttributeDeclarations(ctx context.Context) error {
+	return g.loadAttributeDeclarations(ctx)
+}
+
+func (g *IdentityGraph) setAttributeDeclarations(declared []AttributeDeclaration) {
+	byKey := make(map[attributeKey]string, len(declared))
+	for _, d := range declared {
+		byKey[attributeKey{d.EntityType, d.Attribute}] = d.DataType
+	}
+
+	g.attributeTypesMu.Lock()
+	g.attributeTypes = byKey
+	g.attributeTypesMu.Unlock()
+}
+
+// SyncAttributeDeclarations replaces the stored attribute declarations with
+// declared, as in the current schema. Attribute values already stored are
+// left alone and are read as their new type where they can be.
+func (g *IdentityGraph) SyncAttributeDeclarations(ctx context.Context, declared []AttributeDeclaration) error {
+	for _, d := range declared {
+		if !validAttributeType(d.DataType) {
+			return fmt.Errorf("attribute %s.%s: unknown data type %q", d.EntityType, d.Attribute, d.DataType)
+		}
+	}
+
+	err := pgx.BeginFunc(ctx, g.store, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM attribute_declarations`); err != nil {
+			return err
+		}
+		for _, d := range declared {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO attribute_declarations (entity_type, attribute, data_type)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (entity_type, attribute) DO UPDATE SET data_type = EXCLUDED.data_type
+			`, d.EntityType, d.Attribute, d.DataType); err != nil {
+				return fmt.Errorf("failed to store attribute declaration %s.%s: %w", d.EntityType, d.Attribute, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync attribute declarations: %w", err)
+	}
+
+	g.setAttributeDeclarations(declared)
+	return nil
+}
+
+// AttributeType returns the data type the schema declares the attribute
+// with on entityType
+func (g *IdentityGraph) AttributeType(entityType, attribute string) (string, bool) {
+	g.attributeTypesMu.RLock()
+	defer g.attributeTypesMu.RUnlock()
+	dataType, ok := g.attributeTypes[attributeKey{entityType, attribute}]
+	return dataType, ok
+}
+
+// SetAttribute stores the value of a declared attribute of an entity,
+// replacing any it had. The value is converted to the attribute's data
+// type, so "true" is accepted for a boolean and 3.0 for an integer, and
+// fails with ErrAttributeType when it can't be. Typed attributes take
+// precedence over properties of the same name in checks; as-of checks
+// still read the properties' history.
+func (g *IdentityGraph) SetAttribute(ctx context.Context, entityType, entityID, attribute string,
+	value interface{}) (*TypedAttribute, error) {
+
+	dataType, ok := g.AttributeType(entityType, attribute)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s.%s", ErrUndeclaredAttribute, entityType, attribute)
+	}
+	typed, err := coerceAttribute(dataType, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s.%s: %w", entityType, attribute, err)
+	}
+
+	var columns struct {
+		Bool   *bool
+		Int    *int64
+		Double *float64
+		String *string
+		Array  []byte
+	}
+	switch v := typed.(type) {
+	case bool:
+		columns.Bool = &v
+	case int64:
+		columns.Int = &v
+	case float64:
+		columns.Double = &v
+	case string:
+		columns.String = &v
+	default:
+		if columns.Array, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("failed to marshal attribute %s: %w", attribute, err)
+		}
+	}
+
+	stored := TypedAttribute{EntityType: entityType, EntityID: entityID, Attribute: attribute, DataType: dataType, Value: typed}
+	err = g.store.QueryRow(ctx, `
+		INSERT INTO entity_attributes (entity_type, entity_id, attribute, data_type,
+			bool_value, int_value, double_value, string_value, array_value)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (entity_type, entity_id, attribute) DO UPDATE SET
+			data_type = EXCLUDED.data_type,
+			bool_value = EXCLUDED.bool_value,
+			int_value = EXCLUDED.int_value,
+			double_value = EXCLUDED.double_value,
+			string_value = EXCLUDED.string_value,
+			array_value = EXCLUDED.array_value,
+			updated_at = NOW()
+		RETURNING updated_at
+	`, entityType, entityID, attribute, dataType,
+		columns.Bool, columns.Int, columns.Double, columns.String, columns.Array).Scan(&stored.UpdatedAt)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return nil, fmt.Errorf("%w: %s:%s", ErrEntityNotFound, entityType, entityID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set attribute %s: %w", attribute, err)
+	}
+	return &stored, nil
+}
+
+// DeleteAttribute removes a typed attribute from an entity, failing with
+// ErrAttributeNotFound when it has none
+func (g *IdentityGraph) DeleteAttribute(ctx context.Context, entityType, entityID, attribute string) error {
+	tag, err := g.store.Exec(ctx, `
+		DELETE FROM entity_attributes
+		WHERE entity_type = $1 AND entity_id = $2 AND attribute = $3
+	`, entityType, entityID, attribute)
+	if err != nil {
+		return fmt.Errorf("failed to delete attribute %s: %w", attribute, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s on %s:%s", ErrAttributeNotFound, attribute, entityType, entityID)
+	}
+	return nil
+}
+
+// GetAttributes returns the typed attributes of an entity by name
+func (g *IdentityGraph) GetAttributes(ctx context.Context, entityType, entityID string) ([]TypedAttribute, error) {
+	rows, err := g.store.Query(ctx, `
+		SELECT attribute, data_type, bool_value, int_value, double_value, string_value, array_value, updated_at
+		FROM entity_attributes
+		WHERE entity_type = $1 AND entity_id = $2
+		ORDER BY attribute
+	`, entityType, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attributes: %w", err)
+	}
+	defer rows.Close()
+
+	attributes := []TypedAttribute{}
+	for rows.Next() {
+		a := TypedAttribute{EntityType: entityType, EntityID: entityID}
+		var stored storedAttribute
+		if err := rows.Scan(&a.Attribute, &stored.DataType, &stored.Bool, &stored.Int,
+			&stored.Double, &stored.String, &stored.Array, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan attribute: %w", err)
+		}
+		if a.Value, err = stored.value(); err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", a.Attribute, err)
+		}
+		a.DataType = *stored.DataType
+		attributes = append(attributes, a)
+	}
+	return attributes, rows.Err()
+}
+
+// storedAttribute is a row of entity_attributes; DataType is nil when a
+// join found no row
+type storedAttribute struct {
+	DataType *string
+	Bool     *bool
+	Int      *int64
+	Double   *float64
+	String   *string
+	Array    []byte
+}
+
+// value returns the value held in the column of the attribute's data type
+func (a storedAttribute) value() (interface{}, error) {
+	switch {
+	case a.Bool != nil:
+		return *a.Bool, nil
+	case a.Int != nil:
+		return *a.Int, nil
+	case a.Double != nil:
+		return *a.Double, nil
+	case a.String != nil:
+		return *a.String, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(a.Array)))
+	decoder.UseNumber()
+	var list []interface{}
+	if err := decoder.Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse attribute array: %w", err)
+	}
+	return coerceAttribute(*a.DataType, list)
+}
+
+// entityAttribute reads an attribute for a check: the typed attribute when
+// the entity has one, else the property of that name, converted to the
+// declared data type where it can be so that e.g. a property written as
+// "true" compares as a boolean
+func (g *IdentityGraph) entityAttribute(entityType, attribute string, stored storedAttribute,
+	properties map[string]interface{}) (interface{}, error) {
+
+	if stored.DataType != nil {
+		return stored.value()
+	}
+
+	value, exists := properties[attribute]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrAttributeNotFound, attribute)
+	}
+	if dataType, ok := g.AttributeType(entityType, attribute); ok {
+		if typed, err := coerceAttribute(dataType, value); err == nil {
+			return typed, nil
+		}
+	}
+	return value, nil
+}
+
+func validAttributeType(dataType string) bool {
+	switch dataType {
+	case AttributeBoolean, AttributeBooleanArray, AttributeString, AttributeStringArray,
+		AttributeInteger, AttributeIntegerArray, AttributeDouble, AttributeDoubleArray:
+		return true
+	}
+	return false
+}
+
+// coerceAttribute converts value to dataType: bool, int64, float64 or
+// string, or a []interface{} of them for an array type
+func coerceAttribute(dataType string, value interface{}) (interface{}, error) {
+	if !validAttributeType(dataType) {
+		return nil, fmt.Errorf("unknown data type %q", dataType)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%w: null is not a %s", ErrAttributeType, dataType)
+	}
+
+	elemType, isArray := strings.CutSuffix(dataType, "[]")
+	if !isArray {
+		return coerceScalar(elemType, value)
+	}
+
+	items, ok := toList(value)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not a %s", ErrAttributeType, value, dataType)
+	}
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		typed, err := coerceScalar(elemType, item)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		list[i] = typed
+	}
+	return list, nil
+}
+
+func coerceScalar(dataType string, value interface{}) (interface{}, error) {
+	mismatch := fmt.Errorf("%w: %v (%T) is not a %s", ErrAttributeType, value, value, dataType)
+
+	switch dataType {
+	case AttributeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	case AttributeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case AttributeInteger:
+		if s, ok := value.(string); ok {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+			return nil, mismatch
+		}
+		if n, ok := value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		}
+		if f, ok := toFloat64(value); ok && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return int64(f), nil
+		}
+	case AttributeDouble:
+		if f, ok := toFloat64(value); ok {
+			return f, nil
+		}
+	}
+	return nil, mismatch
+}
@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoerceAttribute(t *testing.T) {
+	tests := []struct {
+		dataType string
+		value    interface{}
+		want     interface{}
+	}{
+		{AttributeBoolean, true, true},
+		{AttributeBoolean, "false", false},
+		{AttributeString, "draft", "draft"},
+		{AttributeInteger, 3.0, int64(3)},
+		{AttributeInteger, "42", int64(42)},
+		{AttributeInteger, json.Number("9007199254740993"), int64(9007199254740993)},
+		{AttributeDouble, 2, 2.0},
+		{AttributeDouble, "0.5", 0.5},
+		{AttributeStringArray, []string{"a", "b"}, []interface{}{"a", "b"}},
+		{AttributeIntegerArray, []interface{}{1.0, "2"}, []interface{}{int64(1), int64(2)}},
+		{AttributeBooleanArray, []interface{}{}, []interface{}{}},
+	}
+	for _, tt := range tests {
+		got, err := coerceAttribute(tt.dataType, tt.value)
+		require.NoError(t, err, "%s %v", tt.dataType, tt.value)
+		assert.Equal(t, tt.want, got, "%s %v", tt.dataType, tt.value)
+	}
+
+	invalid := []struct {
+		dataType string
+		value    interface{}
+	}{
+		{AttributeBoolean, "yes please"},
+		{AttributeBoolean, nil},
+		{AttributeString, 3.0},
+		{AttributeInteger, 2.5},
+		{AttributeInteger, "2.5"},
+		{AttributeDouble, true},
+		{AttributeStringArray, "a"},
+		{AttributeIntegerArray, []interface{}{1, "x"}},
+	}
+	for _, tt := range invalid {
+		_, err := coerceAttribute(tt.dataType, tt.value)
+		assert.ErrorIs(t, err, ErrAttributeType, "%s %v", tt.dataType, tt.value)
+	}
+
+	_, err := coerceAttribute("date", "2026-01-01")
+	assert.Error(t, err)
+}
+
+func TestEntityAttribute(t *testing.T) {
+	g := &IdentityGraph{}
+	g.setAttributeDeclarations([]AttributeDeclaration{
+		{EntityType: "document", Attribute: "public", DataType: AttributeBoolean},
+		{EntityType: "document", Attribute: "level", DataType: AttributeInteger},
+	})
+	properties := map[string]interface{}{"public": "true", "level": "high", "owner": "alice"}
+
+	value, err := g.entityAttribute("document", "public", storedAttribute{}, properties)
+	require.NoError(t, err)
+	assert.Equal(t, true, value, "a property is read as its declared type")
+
+	value, err = g.entityAttribute("document", "level", storedAttribute{}, properties)
+	require.NoError(t, err)
+	assert.Equal(t, "high", value, "a property that can't be converted is read as it is")
+
+	value, err = g.entityAttribute("document", "owner", storedAttribute{}, properties)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", value)
+
+	dataType, public := AttributeBoolean, false
+	value, err = g.entityAttribute("document", "public", storedAttribute{DataType: &dataType, Bool: &public}, properties)
+	require.NoError(t, err)
+	assert.Equal(t, false, value, "the typed attribute takes precedence")
+
+	arrayType := AttributeIntegerArray
+	value, err = g.entityAttribute("document", "levels", storedAttribute{DataType: &arrayType, Array: []byte(`[1, 2]`)}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, value)
+
+	_, err = g.entityAttribute("document", "missing", storedAttribute{}, properties)
+	assert.ErrorIs(t, err, ErrAttributeNotFound)
+}
@@ -0,0 +1,102 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph/graphtest"
+)
+
+// TestPermAndRuntimeAgree generates conditions over request context values,
+// which the runtime evaluates without a database, and checks the condition
+// synced from a .perm schema decides the same as the schema's parsed tree.
+// Relations are covered by the integration suite.
+func TestPermAndRuntimeAgree(t *testing.T) {
+	atoms := []string{"request.a", "request.b", "request.c", "request.d"}
+	g := &IdentityGraph{}
+
+	for seed := uint64(1); seed <= 500; seed++ {
+		gen := graphtest.NewGenerator(seed, atoms)
+		condition := gen.Expression()
+
+		parsed, synced, err := graphtest.ParsePermission(condition)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+
+		for i := 0; i < 4; i++ {
+			set := gen.Subset()
+			request := make(map[string]interface{})
+			for atom := range set {
+				request[atom[len("request."):]] = true
+			}
+
+			want, err := graphtest.Eval(parsed, func(atom string) bool { return set[atom] })
+			if err != nil {
+				t.Fatalf("seed %d: %v", seed, err)
+			}
+			decision, err := g.DecideCondition(context.Background(), synced, "user", "alice", "doc", "1",
+				map[string]interface{}{"request": request})
+			if err != nil {
+				t.Fatalf("seed %d: DecideCondition(%q) returned error: %v", seed, synced, err)
+			}
+			if decision.Allowed != want {
+				t.Fatalf("seed %d: %q with %v set: runtime allowed=%v, .perm tree %s gives %v",
+					seed, condition, set, decision.Allowed, parsed, want)
+			}
+		}
+	}
+}
+
+// TestGrammarParity lists constructs of the condition language and checks
+// each is accepted by both parsers, or by neither. A construct the .perm
+// parser accepts must also sync a condition the runtime reads the same way.
+// knownGaps are divergences still to close; a gap that closes fails the
+// test so the list stays accurate.
+func TestGrammarParity(t *testing.T) {
+	knownGaps := map[string]string{
+		`subject.level >= 3`:            "comparisons are runtime only",
+		`object.owner_id == subject.id`: "comparisons are runtime only",
+		`"admin" in subject.roles`:      "string literals and in are runtime only",
+		`any subject.scores >= 90`:      "quantifiers are runtime only",
+	}
+
+	constructs := []string{
+		"owner",
+		"organization.owner",
+		"owner and (editor or viewer)",
+		"owner or editor and viewer",
+		"editor and not banned",
+		"not (owner or editor) and not organization.suspended",
+		"request.approved",
+		"object.public",
+		"withinLimit(request.amount, request.limit)",
+		"subject.level >= 3",
+		"object.owner_id == subject.id",
+		`"admin" in subject.roles`,
+		"any subject.scores >= 90",
+	}
+
+	for _, construct := range constructs {
+		t.Run(construct, func(t *testing.T) {
+			runtimeExpr, runtimeErr := NewConditionParser(construct).Parse()
+
+			permOK := false
+			if _, synced, err := graphtest.ParsePermission(construct); err == nil {
+				syncedExpr, err := NewConditionParser(synced).Parse()
+				permOK = err == nil && runtimeErr == nil && syncedExpr.String() == runtimeExpr.String()
+			}
+
+			runtimeOK := runtimeErr == nil
+			if gap, known := knownGaps[construct]; known {
+				if permOK == runtimeOK {
+					t.Errorf("known gap %q (%s) no longer diverges; remove it from knownGaps", construct, gap)
+				}
+				return
+			}
+			if permOK != runtimeOK {
+				t.Errorf(".perm accepts=%v, runtime accepts=%v", permOK, runtimeOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Expand node kinds
+const (
+	// ExpandPermission is a permission evaluated on an object; its one
+	// child is the permission's condition
+	ExpandPermission = "permission"
+	// ExpandUnion holds when any child does
+	ExpandUnion = "union"
+	// ExpandIntersection holds when every child does
+	ExpandIntersection = "intersection"
+	// ExpandExclusion holds when its one child does not; the child's
+	// subjects are the ones excluded
+	ExpandExclusion = "exclusion"
+	// ExpandRelation is a relation on an object, listing the subjects
+	// holding it
+	ExpandRelation = "relation"
+	// ExpandInherited is a reference like parent.view, with a child for
+	// each entity the path reaches
+	ExpandInherited = "inherited"
+	// ExpandCondition is a rule, attribute, context value or comparison,
+	// which depends on the subject or the request and so has no subjects
+	// of its own
+	ExpandCondition = "condition"
+)
+
+// maxExpandSubjects bounds the subjects listed on one relation leaf
+const maxExpandSubjects = 1000
+
+// ExpandNode is one node of an expanded permission tree
+type ExpandNode struct {
+	Kind       string `json:"kind"`
+	Expression string `json:"expression"`
+	// Object is the type:id the node is evaluated on
+	Object string `json:"object"`
+	// Permission names the permission of an ExpandPermission node
+	Permission string `json:"permission,omitempty"`
+	// Subjects lists type:id of the subjects holding an ExpandRelation,
+	// with type:* for every subject of a type granted it by a derived
+	// relation
+	Subjects []string      `json:"subjects,omitempty"`
+	Children []*ExpandNode `json:"children,omitempty"`
+	// Truncated is set when subjects were left out past maxExpandSubjects,
+	// or when a permission wasn't expanded because it is already being
+	// expanded further up the tree or lies beyond maxInheritanceDepth
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Expand evaluates the permission with the given condition on an object
+// into a tree of its unions, intersections and relations, with the
+// subjects holding each relation, as Zanzibar's Expand does. References
+// through related entities expand the related entity's permission in turn.
+func (g *IdentityGraph) Expand(ctx context.Context, conditionExpr,
+	objectType, objectID, permission string) (*ExpandNode, error) {
+
+	expr, err := NewConditionParser(conditionExpr).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse condition: %w", err)
+	}
+
+	ref := entityRef{Type: objectType, ID: objectID}
+	memo := inheritanceFrom(context.Background()).memo
+	onPath := map[string]bool{ref.String() + "#" + permission: true}
+	child, err := g.expandExpression(ctx, expr, ref, 0, memo, onPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ExpandNode{
+		Kind:       ExpandPermission,
+		Expression: conditionExpr,
+		Object:     ref.String(),
+		Permission: permission,
+		Children:   []*ExpandNode{child},
+	}, nil
+}
+
+func (g *IdentityGraph) expandExpression(ctx context.Context, expr Expression, object entityRef,
+	depth int, memo *inheritanceMemo, onPath map[string]bool) (*ExpandNode, error) {
+
+	node := &ExpandNode{Expression: expr.String(), Object: object.String()}
+
+	switch e := expr.(type) {
+	case *AndExpression, *OrExpression:
+		node.Kind = ExpandUnion
+		if _, ok := e.(*AndExpression); ok {
+			node.Kind = ExpandIntersection
+		}
+		// a or b or c is one union of three, not two nested ones
+		for _, operand := range flattenOperands(expr) {
+			child, err := g.expandExpression(ctx, operand, object, depth, memo, onPath)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+
+	case *NotExpression:
+		node.Kind = ExpandExclusion
+		child, err := g.expandExpression(ctx, e.Operand, object, depth, memo, onPath)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = []*ExpandNode{child}
+
+	case *RelationExpression:
+		if e.RelationPath == "" && g.declaresAttribute(object.Type, e.RelationName) {
+			node.Kind = ExpandCondition
+			return node, nil
+		}
+		if e.RelationPath == "" {
+			node.Kind = ExpandRelation
+			if err := g.expandSubjects(ctx, node, e.RelationName, object); err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+
+		node.Kind = ExpandInherited
+		related, err := g.relatedEntities(ctx, e.RelationPath, object.Type, object.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range related {
+			child, err := g.expandRelated(ctx, e.RelationName, ref, depth, memo, onPath)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+
+	default:
+		node.Kind = ExpandCondition
+	}
+	return node, nil
+}
+
+// expandRelated expands the name in a reference like parent.view on one
+// related entity: the entity's permission when its type defines one, or
+// else its relation
+func (g *IdentityGraph) expandRelated(ctx context.Context, name string, ref entityRef,
+	depth int, memo *inheritanceMemo, onPath map[string]bool) (*ExpandNode, error) {
+
+	// organization.verified reads the attribute when the entity has it
+	if _, err := g.getEntityAttribute(ctx, ref.Type, ref.ID, name); err == nil {
+		return &ExpandNode{Kind: ExpandCondition, Expression: name, Object: ref.String()}, nil
+	} else if !errors.Is(err, ErrAttributeNotFound) {
+		return nil, err
+	}
+
+	condition, ok, err := g.permissionCondition(ctx, memo, ref.Type, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		node := &ExpandNode{Kind: ExpandRelation, Expression: name, Object: ref.String()}
+		return node, g.expandSubjects(ctx, node, name, ref)
+	}
+
+	node := &ExpandNode{Kind: ExpandPermission, Expression: condition, Object: ref.String(), Permission: name}
+	key := ref.String() + "#" + name
+	if onPath[key] || depth >= maxInheritanceDepth {
+		node.Truncated = true
+		return node, nil
+	}
+
+	expr, err := NewConditionParser(condition).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse condition of %s.%s: %w", ref.Type, name, err)
+	}
+	onPath[key] = true
+	child, err := g.expandExpression(ctx, expr, ref, depth+1, memo, onPath)
+	delete(onPath, key)
+	if err != nil {
+		return nil, err
+	}
+	node.Children = []*ExpandNode{child}
+	return node, nil
+}
+
+// expandSubjects lists the subjects holding the relation on a leaf
+func (g *IdentityGraph) expandSubjects(ctx context.Context, node *ExpandNode, relation string, object entityRef) error {
+	subjects, err := g.relationSubjects(ctx, relation, object.Type, object.ID)
+	if err != nil {
+		return err
+	}
+	for _, s := range subjects {
+		node.Subjects = append(node.Subjects, s.ref.String())
+	}
+	sort.Strings(node.Subjects)
+	if len(node.Subjects) > maxExpandSubjects {
+		node.Subjects = node.Subjects[:maxExpandSubjects]
+		node.Truncated = true
+	}
+	return nil
+}
+
+// flattenOperands returns the operands of a chain of the same operator,
+// left to right
+func flattenOperands(expr Expression) []Expression {
+	switch e := expr.(type) {
+	case *AndExpression:
+		return append(flattenSame(e.Left, isAnd), flattenSame(e.Right, isAnd)...)
+	case *OrExpression:
+		return append(flattenSame(e.Left, isOr), flattenSame(e.Right, isOr)...)
+	}
+	return []Expression{expr}
+}
+
+func flattenSame(expr Expression, same func(Expression) bool) []Expression {
+	if same(expr) {
+		return flattenOperands(expr)
+	}
+	return []Expression{expr}
+}
+
+func isAnd(expr Expression) bool {
+	_, ok := expr.(*AndExpression)
+	return ok
+}
+
+func isOr(expr Expression) bool {
+	_, ok := expr.(*OrExpression)
+	return ok
+}
@@ -0,0 +1,31 @@
+package graph
+
+import (
+	"testing"
+)
+
+func TestFlattenOperands(t *testing.T) {
+	tests := map[string][]string{
+		`owner or viewer or parent.view`:          {"owner", "viewer", "parent.view"},
+		`owner and (viewer or editor) and active`: {"owner", "(viewer or editor)", "active"},
+		`(owner and viewer) or editor`:            {"(owner and viewer)", "editor"},
+		`owner`:                                   {"owner"},
+	}
+
+	for condition, want := range tests {
+		expr, err := NewConditionParser(condition).Parse()
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", condition, err)
+		}
+		operands := flattenOperands(expr)
+		if len(operands) != len(want) {
+			t.Errorf("%q: got %d operands, want %d", condition, len(operands), len(want))
+			continue
+		}
+		for i, operand := range operands {
+			if operand.String() != want[i] {
+				t.Errorf("%q: operand %d is %s, want %s", condition, i, operand, want[i])
+			}
+		}
+	}
+}
@@ -2,8 +2,10 @@ package graph
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Expression interface for all condition expressions
@@ -31,6 +33,15 @@ func (e *OrExpression) String() string {
 	return fmt.Sprintf("(%s or %s)", e.Left.String(), e.Right.String())
 }
 
+// NotExpression negates its operand, as in "editor and not banned"
+type NotExpression struct {
+	Operand Expression
+}
+
+func (e *NotExpression) String() string {
+	return fmt.Sprintf("(not %s)", e.Operand.String())
+}
+
 // RelationExpression represents a direct or indirect relation check
 type RelationExpression struct {
 	RelationPath string // Empty for direct relations, entity type for indirect
@@ -53,17 +64,18 @@ func (e *ContextExpression) String() string {
 	return strings.Join(e.Path, ".")
 }
 
-// AttributeExpression represents a reference to an entity attribute
+// AttributeExpression represents a reference to an attribute of the checked
+// subject or object, written subject.attr or object.attr
 type AttributeExpression struct {
-	EntityType   string // The entity type that has the attribute
+	Entity        string // AttributeOfSubject or AttributeOfObject; empty means the object
 	AttributeName string // The attribute name
 }
 
 func (e *AttributeExpression) String() string {
-	if e.EntityType == "" {
+	if e.Entity == "" {
 		return e.AttributeName
 	}
-	return fmt.Sprintf("%s.%s", e.EntityType, e.AttributeName)
+	return fmt.Sprintf("%s.%s", e.Entity, e.AttributeName)
 }
 
 // RuleExpression represents a call to a rule function
@@ -102,24 +114,57 @@ type ComparisonExpression struct {
 }
 
 func (e *ComparisonExpression) String() string {
-	var op string
-	switch e.Operator {
+	return fmt.Sprintf("%s %s %s", e.Left.String(), operatorString(e.Operator), e.Right.String())
+}
+
+// operatorString writes a comparison operator as it is written in
+// conditions
+func operatorString(op tokenType) string {
+	switch op {
 	case tokenEQ:
-		op = "=="
+		return "=="
 	case tokenNEQ:
-		op = "!="
+		return "!="
 	case tokenGT:
-		op = ">"
+		return ">"
 	case tokenGTE:
-		op = ">="
+		return ">="
 	case tokenLT:
-		op = "<"
+		return "<"
 	case tokenLTE:
-		op = "<="
+		return "<="
 	default:
-		op = "??"
+		return "??"
 	}
-	return fmt.Sprintf("%s %s %s", e.Left.String(), op, e.Right.String())
+}
+
+// InExpression tests whether a value is an element of a list
+type InExpression struct {
+	Value Expression
+	List  Expression
+}
+
+func (e *InExpression) String() string {
+	return fmt.Sprintf("%s in %s", e.Value.String(), e.List.String())
+}
+
+// QuantifiedExpression compares the elements of a list against a value:
+// "any" needs one element to match and "all" needs every element to, so
+// "all" is false for an empty list
+type QuantifiedExpression struct {
+	Quantifier tokenType // tokenAny or tokenAll
+	List       Expression
+	Operator   tokenType
+	Right      Expression
+}
+
+func (e *QuantifiedExpression) String() string {
+	quantifier := "any"
+	if e.Quantifier == tokenAll {
+		quantifier = "all"
+	}
+	comparison := &ComparisonExpression{Left: e.List, Operator: e.Operator, Right: e.Right}
+	return quantifier + " " + comparison.String()
 }
 
 // Token types for the lexer
@@ -140,12 +185,29 @@ const (
 	tokenLT  // <
 	tokenLTE // <=
 	tokenEOF
+	tokenString // "quoted"
+	tokenIn     // in
+	tokenAny    // any
+	tokenAll    // all
+	tokenNumber // 42, 1.5
+	tokenNot    // not
 )
 
 // Token represents a lexical token
 type Token struct {
 	Type  tokenType
 	Value string
+	// Pos and End are the byte offsets of the token's first character and
+	// of the one after its last
+	Pos, End int
+}
+
+// describe names a token for error messages
+func (t Token) describe() string {
+	if t.Type == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.Value)
 }
 
 // ConditionParser parses boolean expressions for permission conditions
@@ -153,6 +215,9 @@ type ConditionParser struct {
 	input   string
 	tokens  []Token
 	current int
+	// spans records where each node was written, when ParseWithSpans
+	// asked for them
+	spans map[Expression]Span
 }
 
 // NewConditionParser creates a new parser for condition expressions
@@ -172,7 +237,35 @@ func (p *ConditionParser) Parse() (Expression, error) {
 	}
 
 	// Parse the tokens into an expression tree
-	return p.parseExpression()
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isAtEnd() {
+		return nil, fmt.Errorf("unexpected %s after complete expression", p.peek().describe())
+	}
+	return expr, nil
+}
+
+// ParseWithSpans is Parse that also returns where in the input each node of
+// the expression was written. The spans of parenthesized expressions
+// exclude the parentheses.
+func (p *ConditionParser) ParseWithSpans() (Expression, map[Expression]Span, error) {
+	p.spans = make(map[Expression]Span)
+	expr, err := p.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	return expr, p.spans, nil
+}
+
+// mark records that expr was written from the token at index first to the
+// last token consumed
+func (p *ConditionParser) mark(first int, expr Expression) Expression {
+	if p.spans != nil {
+		p.spans[expr] = Span{Start: p.tokens[first].Pos, End: p.previous().End}
+	}
+	return expr
 }
 
 // tokenize breaks the input string into tokens
@@ -181,6 +274,7 @@ func (p *ConditionParser) tokenize() error {
 	pos := 0
 
 	for pos < len(input) {
+		tokenStart, n := pos, len(p.tokens)
 		switch {
 		case unicode.IsSpace(rune(input[pos])):
 			// Skip whitespace
@@ -202,6 +296,38 @@ func (p *ConditionParser) tokenize() error {
 			p.tokens = append(p.tokens, Token{Type: tokenDot, Value: "."})
 			pos++
 
+		case input[pos] == '"' || input[pos] == '\'':
+			// Parse a string literal in single or double quotes. \n, \t
+			// and \r are escapes; a backslash before any other character
+			// stands for that character.
+			start, quote := pos, input[pos]
+			pos++
+			var sb strings.Builder
+			for pos < len(input) && input[pos] != quote {
+				if input[pos] == '\\' && pos+1 < len(input) {
+					pos++
+					switch input[pos] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					case 'r':
+						sb.WriteByte('\r')
+					default:
+						sb.WriteByte(input[pos])
+					}
+					pos++
+					continue
+				}
+				sb.WriteByte(input[pos])
+				pos++
+			}
+			if pos >= len(input) {
+				return fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			pos++
+			p.tokens = append(p.tokens, Token{Type: tokenString, Value: sb.String()})
+
 		case input[pos] == '=':
 			if pos+1 < len(input) && input[pos+1] == '=' {
 				p.tokens = append(p.tokens, Token{Type: tokenEQ, Value: "=="})
@@ -236,11 +362,19 @@ func (p *ConditionParser) tokenize() error {
 				pos++
 			}
 
-		case unicode.IsLetter(rune(input[pos])) || unicode.IsDigit(rune(input[pos])) || input[pos] == '_':
+		case unicode.IsDigit(rune(input[pos])):
+			// Parse a number literal
+			start := pos
+			for pos < len(input) && (unicode.IsDigit(rune(input[pos])) ||
+				(input[pos] == '.' && pos+1 < len(input) && unicode.IsDigit(rune(input[pos+1])))) {
+				pos++
+			}
+			p.tokens = append(p.tokens, Token{Type: tokenNumber, Value: input[start:pos]})
+
+		case isIdentifierStart(input[pos]):
 			// Parse identifier (relation name or operator)
 			start := pos
-			for pos < len(input) && (unicode.IsLetter(rune(input[pos])) ||
-				unicode.IsDigit(rune(input[pos])) || input[pos] == '_') {
+			for pos < len(input) && (isIdentifierStart(input[pos]) || unicode.IsDigit(rune(input[pos]))) {
 				pos++
 			}
 			word := input[start:pos]
@@ -251,20 +385,38 @@ func (p *ConditionParser) tokenize() error {
 				p.tokens = append(p.tokens, Token{Type: tokenAnd, Value: word})
 			case "or":
 				p.tokens = append(p.tokens, Token{Type: tokenOr, Value: word})
+			case "not":
+				p.tokens = append(p.tokens, Token{Type: tokenNot, Value: word})
+			case "in":
+				p.tokens = append(p.tokens, Token{Type: tokenIn, Value: word})
+			case "any":
+				p.tokens = append(p.tokens, Token{Type: tokenAny, Value: word})
+			case "all":
+				p.tokens = append(p.tokens, Token{Type: tokenAll, Value: word})
 			default:
 				p.tokens = append(p.tokens, Token{Type: tokenIdentifier, Value: word})
 			}
 
 		default:
-			return fmt.Errorf("unexpected character: %c at position %d", input[pos], pos)
+			ch, _ := utf8.DecodeRuneInString(input[pos:])
+			return fmt.Errorf("unexpected character: %q at position %d", ch, pos)
+		}
+		if len(p.tokens) > n {
+			p.tokens[n].Pos, p.tokens[n].End = tokenStart, pos
 		}
 	}
 
 	// Add EOF token
-	p.tokens = append(p.tokens, Token{Type: tokenEOF})
+	p.tokens = append(p.tokens, Token{Type: tokenEOF, Pos: len(input), End: len(input)})
 	return nil
 }
 
+// isIdentifierStart reports whether b can start an identifier. Identifiers
+// are ASCII; checking bytes of multi-byte characters as runes would split them.
+func isIdentifierStart(b byte) bool {
+	return b < utf8.RuneSelf && (unicode.IsLetter(rune(b)) || b == '_')
+}
+
 // parseExpression parses a boolean expression
 func (p *ConditionParser) parseExpression() (Expression, error) {
 	// Start with OR-level precedence
@@ -273,6 +425,7 @@ func (p *ConditionParser) parseExpression() (Expression, error) {
 
 // parseOr parses expressions connected with OR
 func (p *ConditionParser) parseOr() (Expression, error) {
+	first := p.current
 	left, err := p.parseAnd()
 	if err != nil {
 		return nil, err
@@ -283,7 +436,7 @@ func (p *ConditionParser) parseOr() (Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &OrExpression{Left: left, Right: right}
+		left = p.mark(first, &OrExpression{Left: left, Right: right})
 	}
 
 	return left, nil
@@ -291,29 +444,72 @@ func (p *ConditionParser) parseOr() (Expression, error) {
 
 // parseAnd parses expressions connected with AND
 func (p *ConditionParser) parseAnd() (Expression, error) {
-	left, err := p.parseComparison()
+	first := p.current
+	left, err := p.parseNot()
 	if err != nil {
 		return nil, err
 	}
 
 	for p.match(tokenAnd) {
-		right, err := p.parseComparison()
+		right, err := p.parseNot()
 		if err != nil {
 			return nil, err
 		}
-		left = &AndExpression{Left: left, Right: right}
+		left = p.mark(first, &AndExpression{Left: left, Right: right})
 	}
 
 	return left, nil
 }
 
-// parseComparison parses comparison expressions (==, !=, >, >=, <, <=)
+// parseNot parses negations. NOT binds tighter than AND and looser than
+// comparisons, so "not a and b" is (not a) and b and "not x == 1" negates
+// the comparison.
+func (p *ConditionParser) parseNot() (Expression, error) {
+	first := p.current
+	if p.match(tokenNot) {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return p.mark(first, &NotExpression{Operand: operand}), nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses comparison expressions (==, !=, >, >=, <, <=),
+// list membership (x in list) and quantified comparisons (any list > x)
 func (p *ConditionParser) parseComparison() (Expression, error) {
+	first := p.current
+	if p.match(tokenAny, tokenAll) {
+		quantifier := p.previous().Type
+		list, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if !p.match(tokenEQ, tokenNEQ, tokenGT, tokenGTE, tokenLT, tokenLTE) {
+			return nil, fmt.Errorf("expected comparison operator after quantified list, got %s", p.peek().describe())
+		}
+		operator := p.previous().Type
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return p.mark(first, &QuantifiedExpression{Quantifier: quantifier, List: list, Operator: operator, Right: right}), nil
+	}
+
 	left, err := p.parsePrimary()
 	if err != nil {
 		return nil, err
 	}
 
+	if p.match(tokenIn) {
+		list, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return p.mark(first, &InExpression{Value: left, List: list}), nil
+	}
+
 	// Check for comparison operators
 	if p.match(tokenEQ, tokenNEQ, tokenGT, tokenGTE, tokenLT, tokenLTE) {
 		operator := p.previous().Type
@@ -323,11 +519,11 @@ func (p *ConditionParser) parseComparison() (Expression, error) {
 		}
 
 		// Create a comparison expression based on the operator
-		return &ComparisonExpression{
+		return p.mark(first, &ComparisonExpression{
 			Left:     left,
 			Operator: operator,
 			Right:    right,
-		}, nil
+		}), nil
 	}
 
 	return left, nil
@@ -335,6 +531,8 @@ func (p *ConditionParser) parseComparison() (Expression, error) {
 
 // parsePrimary parses primary expressions (identifiers, literals, or parenthesized expressions)
 func (p *ConditionParser) parsePrimary() (Expression, error) {
+	first := p.current
+
 	// Parse parenthesized expression
 	if p.match(tokenLeftParen) {
 		expr, err := p.parseExpression()
@@ -349,6 +547,20 @@ func (p *ConditionParser) parsePrimary() (Expression, error) {
 		return expr, nil
 	}
 
+	// Parse string literal
+	if p.match(tokenString) {
+		return p.mark(first, &LiteralExpression{Value: p.previous().Value}), nil
+	}
+
+	// Parse number literal
+	if p.match(tokenNumber) {
+		value, err := strconv.ParseFloat(p.previous().Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %w", p.previous().Value, err)
+		}
+		return p.mark(first, &LiteralExpression{Value: value}), nil
+	}
+
 	// Parse identifier (relation, attribute, rule call, or context reference)
 	if p.check(tokenIdentifier) {
 		identName := p.advance().Value
@@ -383,7 +595,7 @@ func (p *ConditionParser) parsePrimary() (Expression, error) {
 				return nil, fmt.Errorf("expected closing parenthesis for rule call")
 			}
 
-			return ruleExpr, nil
+			return p.mark(first, ruleExpr), nil
 		}
 
 		// Check for dot notation (e.g., "organization.owner" or "request.amount")
@@ -396,30 +608,38 @@ func (p *ConditionParser) parsePrimary() (Expression, error) {
 
 			// Special handling for request context
 			if identName == "request" {
-				return &ContextExpression{
+				return p.mark(first, &ContextExpression{
 					Path: []string{identName, secondPart},
-				}, nil
+				}), nil
+			}
+
+			// subject.attr and object.attr read the checked entities' attributes
+			if identName == AttributeOfSubject || identName == AttributeOfObject {
+				return p.mark(first, &AttributeExpression{
+					Entity:        identName,
+					AttributeName: secondPart,
+				}), nil
 			}
 
 			// For now, treat all other dotted references as relation references
 			// In a complete implementation, this would check the schema to determine
 			// if this is a relation or attribute reference
-			return &RelationExpression{
+			return p.mark(first, &RelationExpression{
 				RelationPath: identName,
 				RelationName: secondPart,
-			}, nil
+			}), nil
 		}
 
 		// Simple identifier - treat as relation reference
 		// In a complete implementation, this would check the schema to determine
 		// if this is a relation or attribute reference
-		return &RelationExpression{
+		return p.mark(first, &RelationExpression{
 			RelationPath: "",
 			RelationName: identName,
-		}, nil
+		}), nil
 	}
 
-	return nil, fmt.Errorf("unexpected token: %v", p.peek())
+	return nil, fmt.Errorf("unexpected %s", p.peek().describe())
 }
 
 // Helper methods for the parser
@@ -0,0 +1,210 @@
+package graph
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Evaluator flags gate changes to how checks are evaluated, so a change can
+// be turned on for a fraction of the objects of some types and its latency
+// and results compared with the existing path before it becomes the default
+const (
+	// FlagParallelOr evaluates both operands of an "or" at once rather than
+	// the right one only after the left one denies
+	FlagParallelOr = "parallel_or"
+	// FlagStrictDirection only matches direct relations stored
+	// subject->object, as SetStrictRelationDirection does for whole types
+	FlagStrictDirection = "strict_direction"
+)
+
+// Flags lists the evaluator flags
+var Flags = []string{FlagParallelOr, FlagStrictDirection}
+
+// FlagRollout is the share of objects a flag is on for. Rollout is the
+// fraction, from 0 to 1, for every entity type and EntityTypes overrides it
+// for some. Each object stays on the same side of a partial rollout, so its
+// checks don't flip between behaviors.
+type FlagRollout struct {
+	Rollout     float64            `json:"rollout"`
+	EntityTypes map[string]float64 `json:"entity_types,omitempty"`
+}
+
+// fraction is the rollout for objects of objectType
+func (r FlagRollout) fraction(objectType string) float64 {
+	if f, ok := r.EntityTypes[objectType]; ok {
+		return f
+	}
+	return r.Rollout
+}
+
+// FlagArmStats counts the checks evaluated with a flag on, or off
+type FlagArmStats struct {
+	Checks  int64   `json:"checks"`
+	Allowed int64   `json:"allowed"`
+	Errors  int64   `json:"errors"`
+	Seconds float64 `json:"seconds"`
+}
+
+// FlagStats compares the checks of objects a flag was on for with the rest
+type FlagStats struct {
+	Flag    string       `json:"flag"`
+	Rollout FlagRollout  `json:"rollout"`
+	On      FlagArmStats `json:"on"`
+	Off     FlagArmStats `json:"off"`
+}
+
+// evaluatorFlags holds the flag rollouts and the checks counted under them.
+// The zero value has every flag off.
+type evaluatorFlags struct {
+	mu       sync.RWMutex
+	rollouts map[string]FlagRollout
+	stats    map[string]*[2]FlagArmStats // off, on
+}
+
+// SetFlags replaces the evaluator flag rollouts. Flags left out are off.
+// Counts are kept for flags that stay configured, so a rollout can be
+// widened without losing the comparison so far.
+func (g *IdentityGraph) SetFlags(rollouts map[string]FlagRollout) error {
+	for flag, rollout := range rollouts {
+		if !knownFlag(flag) {
+			return fmt.Errorf("unknown evaluator flag %q", flag)
+		}
+		if err := validFraction(rollout.Rollout); err != nil {
+			return fmt.Errorf("flag %s: %w", flag, err)
+		}
+		for entityType, f := range rollout.EntityTypes {
+			if err := validFraction(f); err != nil {
+				return fmt.Errorf("flag %s for %s: %w", flag, entityType, err)
+			}
+		}
+	}
+
+	f := &g.flags
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := make(map[string]*[2]FlagArmStats, len(rollouts))
+	for flag := range rollouts {
+		if s, ok := f.stats[flag]; ok {
+			stats[flag] = s
+		} else {
+			stats[flag] = &[2]FlagArmStats{}
+		}
+	}
+	f.rollouts = rollouts
+	f.stats = stats
+	return nil
+}
+
+// FlagStats returns the configured flags with their checks, by name
+func (g *IdentityGraph) FlagStats() []FlagStats {
+	f := &g.flags
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	stats := make([]FlagStats, 0, len(f.rollouts))
+	for flag, rollout := range f.rollouts {
+		arms := f.stats[flag]
+		stats = append(stats, FlagStats{Flag: flag, Rollout: rollout, Off: arms[0], On: arms[1]})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Flag < stats[j].Flag })
+	return stats
+}
+
+// flagEnabled reports whether flag is on for an object
+func (g *IdentityGraph) flagEnabled(flag, objectType, objectID string) bool {
+	f := &g.flags
+	f.mu.RLock()
+	rollout, ok := f.rollouts[flag]
+	f.mu.RUnlock()
+	return ok && inRollout(flag, objectType, objectID, rollout.fraction(objectType))
+}
+
+// flagFullyEnabled reports whether flag is on for every object of a type,
+// for queries that span objects, like lookups
+func (g *IdentityGraph) flagFullyEnabled(flag, objectType string) bool {
+	f := &g.flags
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	rollout, ok := f.rollouts[flag]
+	return ok && rollout.fraction(objectType) >= 1
+}
+
+// flagArms returns which side of each configured flag an object is on,
+// indexed like the stats
+func (g *IdentityGraph) flagArms(objectType, objectID string) map[string]int {
+	f := &g.flags
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.rollouts) == 0 {
+		return nil
+	}
+	arms := make(map[string]int, len(f.rollouts))
+	for flag, rollout := range f.rollouts {
+		arms[flag] = 0
+		if inRollout(flag, objectType, objectID, rollout.fraction(objectType)) {
+			arms[flag] = 1
+		}
+	}
+	return arms
+}
+
+// recordFlagCheck counts a check under the side of each flag it ran on
+func (g *IdentityGraph) recordFlagCheck(arms map[string]int, d Decision, err error, elapsed time.Duration) {
+	if len(arms) == 0 {
+		return
+	}
+	f := &g.flags
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for flag, arm := range arms {
+		stats, ok := f.stats[flag]
+		if !ok {
+			// The flag was removed during the check
+			continue
+		}
+		s := &stats[arm]
+		s.Checks++
+		s.Seconds += elapsed.Seconds()
+		switch {
+		case err != nil:
+			s.Errors++
+		case d.Allowed:
+			s.Allowed++
+		}
+	}
+}
+
+// inRollout places an object by a hash of the flag and the object, so
+// raising the fraction only adds objects and different flags pick
+// different objects
+func inRollout(flag, objectType, objectID string, fraction float64) bool {
+	if fraction <= 0 {
+		return false
+	}
+	if fraction >= 1 {
+		return true
+	}
+	sum := sha256.Sum256([]byte(flag + "\x00" + objectType + ":" + objectID))
+	return float64(binary.BigEndian.Uint64(sum[:8]))/math.MaxUint64 < fraction
+}
+
+func knownFlag(flag string) bool {
+	for _, known := range Flags {
+		if flag == known {
+			return true
+		}
+	}
+	return false
+}
+
+func validFraction(f float64) error {
+	if f < 0 || f > 1 || math.IsNaN(f) {
+		return fmt.Errorf("rollout must be between 0 and 1, got %v", f)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestSetFlags(t *testing.T) {
+	g := &IdentityGraph{}
+
+	if err := g.SetFlags(map[string]FlagRollout{"closure_tables": {Rollout: 1}}); err == nil {
+		t.Error("SetFlags accepted an unknown flag")
+	}
+	if err := g.SetFlags(map[string]FlagRollout{FlagParallelOr: {Rollout: 1.5}}); err == nil {
+		t.Error("SetFlags accepted a rollout above 1")
+	}
+	if err := g.SetFlags(map[string]FlagRollout{FlagParallelOr: {EntityTypes: map[string]float64{"doc": -1}}}); err == nil {
+		t.Error("SetFlags accepted a negative entity type rollout")
+	}
+
+	err := g.SetFlags(map[string]FlagRollout{
+		FlagStrictDirection: {Rollout: 0, EntityTypes: map[string]float64{"document": 1}},
+	})
+	if err != nil {
+		t.Fatalf("SetFlags returned error: %v", err)
+	}
+	if !g.flagEnabled(FlagStrictDirection, "document", "1") || g.flagEnabled(FlagStrictDirection, "folder", "1") {
+		t.Error("entity type rollout not applied")
+	}
+	if !g.strictRelationDirection("document") || g.strictRelationDirection("folder") {
+		t.Error("a full rollout should make the type strict for lookups")
+	}
+	if g.flagEnabled(FlagParallelOr, "document", "1") {
+		t.Error("unconfigured flag is on")
+	}
+}
+
+func TestFlagRolloutIsStable(t *testing.T) {
+	on := func(fraction float64) map[string]bool {
+		ids := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			id := fmt.Sprint(i)
+			if inRollout(FlagParallelOr, "document", id, fraction) {
+				ids[id] = true
+			}
+		}
+		return ids
+	}
+
+	tenth, half := on(0.1), on(0.5)
+	if len(tenth) < 50 || len(tenth) > 150 {
+		t.Errorf("10%% rollout picked %d of 1000 objects", len(tenth))
+	}
+	for id := range tenth {
+		if !half[id] {
+			t.Errorf("widening the rollout dropped document:%s", id)
+		}
+	}
+	if len(on(0)) != 0 || len(on(1)) != 1000 {
+		t.Error("rollouts of 0 and 1 should pick none and all objects")
+	}
+}
+
+// TestParallelOr checks the parallel evaluation of "or" decides, and gives
+// the same reasons, as the sequential one, and counts checks on each side
+func TestParallelOr(t *testing.T) {
+	contextData := map[string]interface{}{
+		"request": map[string]interface{}{"approved": true, "amount": 50.0, "limit": 100.0},
+	}
+	conditions := []string{
+		"request.approved or request.missing",
+		"request.missing or request.approved",
+		"request.missing or request.absent",
+		"request.missing or request.amount > request.limit or not request.approved",
+		"(request.missing or request.approved) and (request.absent or request.amount <= request.limit)",
+	}
+
+	sequential := &IdentityGraph{}
+	parallel := &IdentityGraph{concurrent: true}
+	if err := parallel.SetFlags(map[string]FlagRollout{FlagParallelOr: {Rollout: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, condition := range conditions {
+		want, err := sequential.DecideCondition(context.Background(), condition, "user", "alice", "document", "1", contextData)
+		if err != nil {
+			t.Fatalf("DecideCondition(%q) returned error: %v", condition, err)
+		}
+		got, err := parallel.DecideCondition(context.Background(), condition, "user", "alice", "document", "1", contextData)
+		if err != nil {
+			t.Fatalf("parallel DecideCondition(%q) returned error: %v", condition, err)
+		}
+		if got != want {
+			t.Errorf("parallel DecideCondition(%q) = %+v, sequential gives %+v", condition, got, want)
+		}
+	}
+
+	stats := parallel.FlagStats()
+	if len(stats) != 1 || stats[0].On.Checks != int64(len(conditions)) || stats[0].Off.Checks != 0 {
+		t.Errorf("FlagStats() = %+v, want %d checks with the flag on", stats, len(conditions))
+	}
+	if stats[0].On.Allowed != 3 {
+		t.Errorf("counted %d allowed checks, want 3", stats[0].On.Allowed)
+	}
+	if len(sequential.FlagStats()) != 0 {
+		t.Error("checks were counted with no flags configured")
+	}
+}
@@ -0,0 +1,223 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// builtinFunc implements a function callable from conditions and rules
+type builtinFunc func(args []interface{}) (interface{}, error)
+
+// builtinFunctions are called like rules but need no definition. Their names
+// are reserved, so a rule can't shadow them.
+var builtinFunctions = map[string]struct {
+	arity int
+	fn    builtinFunc
+}{
+	"starts_with": {2, stringPredicate("starts_with", strings.HasPrefix)},
+	"ends_with":   {2, stringPredicate("ends_with", strings.HasSuffix)},
+	"contains":    {2, containsFunc},
+	"lower":       {1, lowerFunc},
+	"regex_match": {2, regexMatchFunc},
+}
+
+// IsBuiltinFunction reports whether name is a built-in function
+func IsBuiltinFunction(name string) bool {
+	_, ok := builtinFunctions[name]
+	return ok
+}
+
+// BuiltinArity returns how many arguments a built-in function takes
+func BuiltinArity(name string) (int, bool) {
+	builtin, ok := builtinFunctions[name]
+	return builtin.arity, ok
+}
+
+// CallBuiltin applies a built-in function to argument values, for
+// evaluators that read them from somewhere other than the graph
+func CallBuiltin(name string, args []interface{}) (interface{}, error) {
+	return callBuiltin(name, args)
+}
+
+// callBuiltin applies a built-in function to evaluated arguments
+func callBuiltin(name string, args []interface{}) (interface{}, error) {
+	builtin, ok := builtinFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+	if len(args) != builtin.arity {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name, builtin.arity, len(args))
+	}
+	return builtin.fn(args)
+}
+
+// callBuiltinPredicate calls a built-in function that must return a boolean
+func callBuiltinPredicate(name string, args []interface{}) (bool, error) {
+	result, err := callBuiltin(name, args)
+	if err != nil {
+		return false, err
+	}
+	b, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s returns a %T, not a boolean", name, result)
+	}
+	return b, nil
+}
+
+// evaluateBuiltinArgs evaluates the arguments of a built-in call made from
+// a permission condition
+func (g *IdentityGraph) evaluateBuiltinArgs(ctx context.Context, call *RuleExpression,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) ([]interface{}, error) {
+
+	args := make([]interface{}, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		value, err := g.conditionValue(ctx, arg, subjectType, subjectID, objectType, objectID, contextData)
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %w", call.RuleName, i+1, err)
+		}
+		args[i] = value
+	}
+	return args, nil
+}
+
+// conditionValue evaluates an operand of a permission condition to a value
+func (g *IdentityGraph) conditionValue(ctx context.Context, expr Expression,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (interface{}, error) {
+
+	switch e := expr.(type) {
+	case *LiteralExpression:
+		return e.Value, nil
+	case *ContextExpression:
+		return contextValue(contextData, e.Path)
+	case *AttributeExpression:
+		return g.attributeValue(ctx, e, subjectType, subjectID, objectType, objectID)
+	case *RelationExpression:
+		return g.relatedAttributeValue(ctx, e, objectType, objectID)
+	case *RuleExpression:
+		if !IsBuiltinFunction(e.RuleName) {
+			return nil, fmt.Errorf("rule %s is not a value", e.RuleName)
+		}
+		args, err := g.evaluateBuiltinArgs(ctx, e, subjectType, subjectID, objectType, objectID, contextData)
+		if err != nil {
+			return nil, err
+		}
+		return callBuiltin(e.RuleName, args)
+	default:
+		return nil, fmt.Errorf("%s is not a value", expr.String())
+	}
+}
+
+// contextValue reads the value at path from the check's context
+func contextValue(contextData map[string]interface{}, path []string) (interface{}, error) {
+	if contextData == nil {
+		return nil, fmt.Errorf("context data required but not provided")
+	}
+
+	var current interface{} = contextData
+	for i, part := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("context path is not a map: %s", strings.Join(path[:i], "."))
+		}
+		if current, ok = m[part]; !ok {
+			return nil, fmt.Errorf("context path not found: %s", strings.Join(path, "."))
+		}
+	}
+	return current, nil
+}
+
+func stringArgs(name string, args []interface{}) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: argument %d must be a string, got %T", name, i+1, arg)
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+func stringPredicate(name string, pred func(s, affix string) bool) builtinFunc {
+	return func(args []interface{}) (interface{}, error) {
+		strs, err := stringArgs(name, args)
+		if err != nil {
+			return nil, err
+		}
+		return pred(strs[0], strs[1]), nil
+	}
+}
+
+// containsFunc checks for a substring, or for an element when the first
+// argument is a list
+func containsFunc(args []interface{}) (interface{}, error) {
+	if list, ok := args[0].([]interface{}); ok {
+		for _, item := range list {
+			if reflect.DeepEqual(item, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	strs, err := stringArgs("contains", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Contains(strs[0], strs[1]), nil
+}
+
+func lowerFunc(args []interface{}) (interface{}, error) {
+	strs, err := stringArgs("lower", args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(strs[0]), nil
+}
+
+// maxCachedRegexes bounds regexCache, since patterns may come from request
+// context rather than the schema
+const maxCachedRegexes = 1024
+
+var (
+	regexCacheMu sync.RWMutex
+	regexCache   = make(map[string]*regexp.Regexp)
+)
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCacheMu.RLock()
+	re, ok := regexCache[pattern]
+	regexCacheMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexCacheMu.Lock()
+	if len(regexCache) < maxCachedRegexes {
+		regexCache[pattern] = re
+	}
+	regexCacheMu.Unlock()
+	return re, nil
+}
+
+func regexMatchFunc(args []interface{}) (interface{}, error) {
+	strs, err := stringArgs("regex_match", args)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := compileRegex(strs[1])
+	if err != nil {
+		return nil, fmt.Errorf("regex_match: invalid pattern %q: %w", strs[1], err)
+	}
+	return re.MatchString(strs[0]), nil
+}
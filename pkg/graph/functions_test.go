@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBuiltinFunctionsInConditions(t *testing.T) {
+	g := &IdentityGraph{ruleCache: map[string]*RuleDefinition{
+		"corporateEmail": {
+			Name:       "corporateEmail",
+			Parameters: []RuleParameter{{Name: "email", DataType: "string"}},
+			Expression: `ends_with(lower(email), "@acme.com")`,
+		},
+	}}
+
+	contextData := map[string]interface{}{
+		"request": map[string]interface{}{
+			"path":   "/admin/users",
+			"email":  "Alice@ACME.com",
+			"groups": []interface{}{"finance", "ops"},
+			"count":  3.0,
+		},
+	}
+
+	tests := []struct {
+		condition string
+		allowed   bool
+		reason    string
+	}{
+		{`starts_with(request.path, "/admin")`, true, "matched_rule:starts_with"},
+		{`starts_with(request.path, "/billing")`, false, "denied_by_rule:starts_with"},
+		{`ends_with(lower(request.email), "@acme.com")`, true, "matched_rule:ends_with"},
+		{`contains(request.path, "users")`, true, "matched_rule:contains"},
+		{`contains(request.groups, "finance")`, true, "matched_rule:contains"},
+		{`contains(request.groups, "legal")`, false, "denied_by_rule:contains"},
+		{`regex_match(request.path, "^/admin/[a-z]+$")`, true, "matched_rule:regex_match"},
+		{`corporateEmail(request.email)`, true, "matched_rule:corporateEmail"},
+		{`request.path and starts_with(request.path, "/billing")`, false, "denied_by_rule:starts_with"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			decision, err := g.DecideCondition(context.Background(), tt.condition, "user", "alice", "document", "plan", contextData)
+			if err != nil {
+				t.Fatalf("DecideCondition(%q) returned error: %v", tt.condition, err)
+			}
+			if decision.Allowed != tt.allowed || decision.Reason != tt.reason {
+				t.Errorf("DecideCondition(%q) = %+v, want allowed=%v reason=%q", tt.condition, decision, tt.allowed, tt.reason)
+			}
+		})
+	}
+
+	errors := []string{
+		`starts_with(request.count, "3")`,
+		`lower(request.email)`,
+		`regex_match(request.path, "[")`,
+		`starts_with(request.path)`,
+	}
+	for _, condition := range errors {
+		if _, err := g.DecideCondition(context.Background(), condition, "user", "alice", "document", "plan", contextData); err == nil {
+			t.Errorf("DecideCondition(%q) should fail", condition)
+		}
+	}
+}
+
+func TestParseStringLiteral(t *testing.T) {
+	expr, err := NewConditionParser(`starts_with(request.path, "/a \"b\" \\c")`).Parse()
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	call, ok := expr.(*RuleExpression)
+	if !ok || len(call.Arguments) != 2 {
+		t.Fatalf("Parse() = %#v, want a two-argument call", expr)
+	}
+	literal, ok := call.Arguments[1].(*LiteralExpression)
+	if !ok || literal.Value != `/a "b" \c` {
+		t.Errorf("second argument = %#v, want the unescaped string", call.Arguments[1])
+	}
+
+	expr, err = NewConditionParser(`subject.name == 'O\'Brien\tjr'`).Parse()
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	comparison, ok := expr.(*ComparisonExpression)
+	if !ok {
+		t.Fatalf("Parse() = %#v, want a comparison", expr)
+	}
+	literal, ok = comparison.Right.(*LiteralExpression)
+	if !ok || literal.Value != "O'Brien\tjr" {
+		t.Errorf("right side = %#v, want the unescaped single-quoted string", comparison.Right)
+	}
+
+	for _, condition := range []string{`starts_with(request.path, "/admin)`, `subject.name == 'admin`} {
+		if _, err := NewConditionParser(condition).Parse(); err == nil {
+			t.Errorf("Parse(%q) should reject an unterminated string", condition)
+		}
+	}
+}
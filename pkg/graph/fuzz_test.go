@@ -0,0 +1,107 @@
+package graph
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+// schemaConditions returns the permission conditions and rule bodies of the
+// example schema, to seed the fuzzer with expressions written in practice
+func schemaConditions(f *testing.F) []string {
+	file, err := os.Open("../../permissions/schema.perm")
+	if err != nil {
+		f.Fatalf("failed to open example schema: %v", err)
+	}
+	defer file.Close()
+
+	var conditions []string
+	inRule := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "permission "):
+			if _, condition, ok := strings.Cut(line, "="); ok {
+				conditions = append(conditions, strings.TrimSpace(condition))
+			}
+		case strings.HasPrefix(line, "rule "):
+			inRule = true
+		case line == "}":
+			inRule = false
+		case inRule && line != "" && !strings.HasPrefix(line, "//"):
+			conditions = append(conditions, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Fatalf("failed to read example schema: %v", err)
+	}
+	return conditions
+}
+
+// FuzzConditionParser checks that no input panics the parser or the
+// planner that runs on every parsed condition. Failing inputs are saved
+// under testdata/fuzz and rerun by go test as regression cases.
+func FuzzConditionParser(f *testing.F) {
+	for _, condition := range schemaConditions(f) {
+		f.Add(condition)
+	}
+	for _, seed := range []string{
+		"",
+		"owner",
+		"organization.owner and request.approved",
+		"(owner or editor) and not_blocked",
+		`subject.department == "engineering"`,
+		"object.level >= 3 and subject.level < 10",
+		`"admin" in subject.roles`,
+		"any subject.scores >= 90",
+		"all object.tags != \"secret\"",
+		"withinLimit(request.amount, object.limit)",
+		"ends_with(lower(subject.email), \"@acme.com\")",
+		"((((owner))))",
+		"owner or",
+		"f(",
+		`"unterminated`,
+		`subject.name == 'it\'s'`,
+		"a.b.c.d",
+		"1.5 == 1.50",
+	} {
+		f.Add(seed)
+	}
+
+	g := &IdentityGraph{}
+	f.Fuzz(func(t *testing.T, input string) {
+		expr, err := NewConditionParser(input).Parse()
+		if err != nil {
+			return
+		}
+		if expr == nil {
+			t.Fatalf("Parse(%q) returned neither an expression nor an error", input)
+		}
+		_ = expr.String()
+		_ = g.planExpression(expr, "document").String()
+	})
+}
+
+func TestConditionParserErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"owner )", `unexpected ")" after complete expression`},
+		{"owner editor", `unexpected "editor" after complete expression`},
+		{"owner or", "unexpected end of expression"},
+		{"any subject.scores", "got end of expression"},
+		{"owner é", `unexpected character: 'é' at position 6`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := NewConditionParser(tt.input).Parse()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) error = %v, want it to contain %q", tt.input, err, tt.want)
+			}
+		})
+	}
+}
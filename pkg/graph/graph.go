@@ -0,0 +1,1330 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+	"github.com/dangerclosesec/supra/internal/chaos"
+	"github.com/dangerclosesec/supra/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Entity represents a node in the graph
+type Entity struct {
+	ID         int64                  `json:"id"`
+	Type       string                 `json:"type"`
+	ExternalID string                 `json:"external_id"`
+	Properties map[string]interface{} `json:"properties"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+}
+
+// Relation represents an edge in the graph
+type Relation struct {
+	ID          int64  `json:"id"`
+	SubjectType string `json:"subject_type"`
+	SubjectID   string `json:"subject_id"`
+	Relation    string `json:"relation"`
+	ObjectType  string `json:"object_type"`
+	ObjectID    string `json:"object_id"`
+	// Metadata records the grant's provenance, e.g. granted_by and reason
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Source names what wrote the relation, e.g. manual, scim or
+	// import:batch-42, so its writes can be listed and revoked together
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PermissionDefinition defines a permission rule with a condition expression
+type PermissionDefinition struct {
+	ID                  int64     `json:"id"`
+	EntityType          string    `json:"entity_type"`
+	PermissionName      string    `json:"permission_name"`
+	ConditionExpression string    `json:"condition_expression"`
+	Description         string    `json:"description"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// RuleDefinition represents a rule definition with parameters and expression
+type RuleDefinition struct {
+	ID         int64             `json:"id"`
+	Name       string            `json:"name"`
+	Parameters []RuleParameter   `json:"parameters"`
+	Expression string            `json:"expression"`
+	Description string           `json:"description,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// RuleParameter represents a parameter for a rule
+type RuleParameter struct {
+	Name     string `json:"name"`
+	DataType string `json:"data_type"`
+}
+
+// IdentityGraph manages the identity graph operations
+type IdentityGraph struct {
+	// Pool is the connection pool NewIdentityGraph opened, for callers
+	// sharing it; it is nil for a graph New built over another Store
+	Pool  *pgxpool.Pool
+	store Store
+	// prepared is set when every connection of store has the hot-path
+	// statements prepared by name
+	prepared bool
+	// concurrent is set when store is a pool, which can run queries at
+	// once; over a single connection or transaction "or" operands are
+	// evaluated in turn and relation counts aren't loaded in the background
+	concurrent  bool
+	ruleCache   map[string]*RuleDefinition
+	ruleCacheMu sync.RWMutex
+
+	// relationStats feeds the check planner's cost estimates
+	relationStats relationStats
+
+	strictDirection   map[string]bool
+	strictDirectionMu sync.RWMutex
+
+	// flags rolls out evaluator changes and compares them with the
+	// existing behavior
+	flags evaluatorFlags
+
+	// faults is set in chaos mode to slow down or fail rule lookups
+	faults FaultInjector
+
+	// derived holds the relations implied by attributes, by object type and
+	// relation name
+	derived   map[derivedKey][]DerivedRelation
+	derivedMu sync.RWMutex
+
+	// limits caps the subjects of relations declared with max, by object
+	// type and relation name
+	limits   map[relationKey]int
+	limitsMu sync.RWMutex
+
+	// declared holds the subject types of the relations the schema
+	// declares, by object type and relation name. Writes are validated
+	// against them unless skipValidation is set.
+	declared       map[relationKey][]string
+	skipValidation bool
+	declaredMu     sync.RWMutex
+
+	// conditionLimits bound the conditions of permission definitions
+	conditionLimits ConditionLimits
+
+	// attributeTypes holds the data types of the attributes the schema
+	// declares, by entity type and attribute name
+	attributeTypes   map[attributeKey]string
+	attributeTypesMu sync.RWMutex
+
+	// tenantRules holds the rules tenants define, by rule name and tenant
+	tenantRules      map[string]map[string]*TenantRule
+	tenantRulesMu    sync.RWMutex
+	tenantRuleLimits TenantRuleLimits
+
+	// schemaVersions caches the snapshots of schema versions checks have
+	// been pinned to
+	schemaVersions   map[int]*schemaSnapshot
+	schemaVersionsMu sync.RWMutex
+
+	// metrics counts cache lookups and how deep checks go
+	metrics graphMetrics
+}
+
+// NewIdentityGraph creates a new instance of IdentityGraph
+func NewIdentityGraph(ctx context.Context, connString string) (*IdentityGraph, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+
+	return NewIdentityGraphWithConfig(ctx, poolConfig)
+}
+
+// NewIdentityGraphWithConfig creates a new instance of IdentityGraph from a pool
+// configuration, e.g. one with a BeforeConnect hook supplying rotated credentials
+func NewIdentityGraphWithConfig(ctx context.Context, poolConfig *pgxpool.Config) (*IdentityGraph, error) {
+	usePreparedStatements(poolConfig)
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+
+	// Validates the database connection
+	if err := pool.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	graph, err := newGraph(ctx, pool, true)
+	if err != nil {
+		return nil, err
+	}
+	graph.Pool = pool
+	return graph, nil
+}
+
+// New creates an IdentityGraph over store, such as a *pgxpool.Pool, a
+// *pgx.Conn or a pgx.Tx, on a database with the authz migrations applied.
+// The rules and schema declarations it caches are loaded from store now.
+// Closing the store is left to the caller.
+//
+// A connection or transaction runs one query at a time, so a graph over
+// one must not be shared between goroutines; it evaluates FlagParallelOr
+// conditions sequentially and plans checks by static cost alone. Use a
+// pool for a graph serving concurrent checks.
+func New(ctx context.Context, store Store) (*IdentityGraph, error) {
+	return newGraph(ctx, store, false)
+}
+
+func newGraph(ctx context.Context, store Store, prepared bool) (*IdentityGraph, error) {
+	_, concurrent := store.(*pgxpool.Pool)
+	graph := &IdentityGraph{
+		store:            store,
+		prepared:         prepared,
+		concurrent:       concurrent,
+		ruleCache:        make(map[string]*RuleDefinition),
+		conditionLimits:  DefaultConditionLimits(),
+		tenantRuleLimits: DefaultTenantRuleLimits(),
+	}
+
+	// Pre-load rules from the database
+	if err := graph.loadRules(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load rules: %w", err)
+	}
+	if err := graph.loadDerivedRelations(ctx); err != nil {
+		return nil, err
+	}
+	if err := graph.loadRelationLimits(ctx); err != nil {
+		return nil, err
+	}
+	if err := graph.loadRelationDeclarations(ctx); err != nil {
+		return nil, err
+	}
+	if err := graph.loadAttributeDeclarations(ctx); err != nil {
+		return nil, err
+	}
+	if err := graph.loadTenantRules(ctx); err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
+
+// loadRules loads all rule definitions from the database into the cache
+func (g *IdentityGraph) loadRules(ctx context.Context) error {
+	rows, err := g.store.Query(ctx, `
+		SELECT id, rule_name, parameters, expression, description, created_at
+		FROM rule_definitions
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query rule definitions: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make(map[string]*RuleDefinition)
+	for rows.Next() {
+		var rule RuleDefinition
+		var parametersJSON []byte
+
+		err := rows.Scan(&rule.ID, &rule.Name, &parametersJSON, &rule.Expression, &rule.Description, &rule.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to scan rule definition: %w", err)
+		}
+
+		// Parse parameters JSON
+		if err := json.Unmarshal(parametersJSON, &rule.Parameters); err != nil {
+			return fmt.Errorf("failed to unmarshal rule parameters: %w", err)
+		}
+
+		rules[rule.Name] = &rule
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rule definitions: %w", err)
+	}
+
+	// Replace the cache, dropping rules deleted from the database
+	g.ruleCacheMu.Lock()
+	g.ruleCache = rules
+	g.ruleCacheMu.Unlock()
+
+	return nil
+}
+
+// FaultPointRuleCache is the point a FaultInjector is asked about before
+// each rule lookup
+const FaultPointRuleCache = chaos.PointRuleCache
+
+// FaultInjector slows down or fails the graph's work on purpose, so
+// timeouts and failure handling can be exercised. Inject is called with
+// the point about to run and returns the error to fail it with, if any.
+// The authz service's chaos mode provides one.
+type FaultInjector interface {
+	Inject(ctx context.Context, point string) error
+}
+
+// SetFaultInjector injects the faults set on injector into rule lookups;
+// nil turns injection off. Database faults are injected by the pool's
+// query tracer instead.
+func (g *IdentityGraph) SetFaultInjector(injector FaultInjector) {
+	g.faults = injector
+}
+
+// ReloadRules replaces the rule cache with the rules now in the database,
+// e.g. after another replica synced the permission model
+func (g *IdentityGraph) ReloadRules(ctx context.Context) error {
+	return g.loadRules(ctx)
+}
+
+// GetRule retrieves a rule definition by name
+func (g *IdentityGraph) GetRule(ruleName string) (*RuleDefinition, error) {
+	g.ruleCacheMu.RLock()
+	defer g.ruleCacheMu.RUnlock()
+
+	rule, exists := g.ruleCache[ruleName]
+	if !exists {
+		return nil, fmt.Errorf("rule not found: %s", ruleName)
+	}
+	return rule, nil
+}
+
+// AddRule adds a new rule definition to the database and cache
+func (g *IdentityGraph) AddRule(ctx context.Context, rule *RuleDefinition) error {
+	if IsBuiltinFunction(rule.Name) {
+		return fmt.Errorf("rule name %s is reserved for a built-in function", rule.Name)
+	}
+
+	// Convert parameters to JSON
+	parametersJSON, err := json.Marshal(rule.Parameters)
+	if err != nil {
+		return fmt.Errorf("failed to marshal parameters: %w", err)
+	}
+
+	// Insert rule into database
+	err = g.store.QueryRow(ctx, `
+		INSERT INTO rule_definitions (rule_name, parameters, expression, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, rule.Name, parametersJSON, rule.Expression, rule.Description).Scan(&rule.ID, &rule.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to insert rule definition: %w", err)
+	}
+
+	// Add to cache
+	g.ruleCacheMu.Lock()
+	g.ruleCache[rule.Name] = rule
+	g.ruleCacheMu.Unlock()
+
+	_, err = g.SnapshotSchema(ctx, "api")
+	return err
+}
+
+// Close releases the connection pool NewIdentityGraph opened
+func (g *IdentityGraph) Close() {
+	if g.Pool != nil {
+		g.Pool.Close()
+	}
+}
+
+// CreateEntity adds a new entity to the graph
+func (g *IdentityGraph) CreateEntity(ctx context.Context, entityType, externalID string,
+	properties map[string]interface{}) (*Entity, error) {
+
+	// Converts properties to JSON
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal properties: %w", err)
+	}
+
+	var entity Entity
+	err = g.store.QueryRow(ctx, `
+		INSERT INTO entities (type, external_id, properties)
+		VALUES ($1, $2, $3)
+		RETURNING id, type, external_id, properties, created_at, updated_at
+	`, entityType, externalID, propertiesJSON).Scan(
+		&entity.ID, &entity.Type, &entity.ExternalID, &propertiesJSON, &entity.CreatedAt, &entity.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entity: %w", err)
+	}
+
+	// Deserializes the JSON properties back to map
+	if err := json.Unmarshal(propertiesJSON, &entity.Properties); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal properties: %w", err)
+	}
+
+	return &entity, nil
+}
+
+// GetEntity retrieves an entity by type and external ID
+func (g *IdentityGraph) GetEntity(ctx context.Context, entityType, externalID string) (*Entity, error) {
+	var entity Entity
+	var propertiesJSON []byte
+
+	err := g.store.QueryRow(ctx, `
+		SELECT id, type, external_id, properties, created_at, updated_at
+		FROM entities
+		WHERE type = $1 AND external_id = $2
+	`, entityType, externalID).Scan(
+		&entity.ID, &entity.Type, &entity.ExternalID, &propertiesJSON, &entity.CreatedAt, &entity.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("entity not found: %s:%s", entityType, externalID)
+		}
+		return nil, fmt.Errorf("failed to get entity: %w", err)
+	}
+
+	// Deserializes the JSON properties
+	if err := json.Unmarshal(propertiesJSON, &entity.Properties); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal properties: %w", err)
+	}
+
+	return &entity, nil
+}
+
+// EntityKey names an entity by type and external ID
+type EntityKey struct {
+	Type       string `json:"type"`
+	ExternalID string `json:"id"`
+}
+
+// GetEntities retrieves the entities named by keys in one query, in no
+// particular order. Keys that match no entity are left out, and a key
+// given twice is returned once.
+func (g *IdentityGraph) GetEntities(ctx context.Context, keys []EntityKey) ([]Entity, error) {
+	seen := make(map[EntityKey]bool, len(keys))
+	types := make([]string, 0, len(keys))
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		types, ids = append(types, key.Type), append(ids, key.ExternalID)
+	}
+
+	rows, err := g.store.Query(ctx, `
+		SELECT e.id, e.type, e.external_id, e.properties, e.created_at, e.updated_at
+		FROM entities e
+		JOIN unnest($1::text[], $2::text[]) AS k(type, external_id)
+			ON e.type = k.type AND e.external_id = k.external_id
+	`, types, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entities: %w", err)
+	}
+	defer rows.Close()
+
+	entities := []Entity{}
+	for rows.Next() {
+		var entity Entity
+		var propertiesJSON []byte
+		if err := rows.Scan(&entity.ID, &entity.Type, &entity.ExternalID, &propertiesJSON, &entity.CreatedAt, &entity.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan entity: %w", err)
+		}
+		if err := json.Unmarshal(propertiesJSON, &entity.Properties); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal properties: %w", err)
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
+
+// ErrEntityNotFound is returned when deleting an entity that doesn't exist
+var ErrEntityNotFound = errors.New("entity not found")
+
+// ErrEntityInUse is returned when deleting an entity that relations still
+// refer to without cascading the delete to them
+var ErrEntityInUse = errors.New("entity has relations")
+
+// DeleteEntity deletes an entity in one transaction with, when cascade is
+// set, every relation it is the subject or object of, returning those
+// relations. Without cascade an entity that relations still refer to is
+// kept and ErrEntityInUse returned, so no relation is orphaned.
+func (g *IdentityGraph) DeleteEntity(ctx context.Context, entityType, externalID string, cascade bool) ([]Relation, error) {
+	var deleted []Relation
+	err := pgx.BeginFunc(ctx, g.store, func(tx pgx.Tx) error {
+		// Lock the entity so concurrent deletes of it run one at a time
+		var id int64
+		err := tx.QueryRow(ctx, `
+			SELECT id FROM entities
+			WHERE type = $1 AND external_id = $2
+			FOR UPDATE
+		`, entityType, externalID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %s:%s", ErrEntityNotFound, entityType, externalID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find entity: %w", err)
+		}
+
+		if cascade {
+			rows, err := tx.Query(ctx, `
+				DELETE FROM relations
+				WHERE (subject_type = $1 AND subject_id = $2) OR (object_type = $1 AND object_id = $2)
+				RETURNING id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+			`, entityType, externalID)
+			if err != nil {
+				return fmt.Errorf("failed to delete relations: %w", err)
+			}
+			if deleted, err = collectRelations(rows); err != nil {
+				return err
+			}
+		} else {
+			var count int64
+			if err := tx.QueryRow(ctx, `
+				SELECT COUNT(*) FROM relations
+				WHERE (subject_type = $1 AND subject_id = $2) OR (object_type = $1 AND object_id = $2)
+			`, entityType, externalID).Scan(&count); err != nil {
+				return fmt.Errorf("failed to count relations: %w", err)
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: %s:%s appears in %d relations", ErrEntityInUse, entityType, externalID, count)
+			}
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM entities WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("failed to delete entity: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// CreateRelation adds a new relation between entities. metadata is stored
+// alongside the relation and may be nil; source defaults to SourceManual. A
+// relation the schema doesn't declare fails with a *RelationValidationError.
+func (g *IdentityGraph) CreateRelation(ctx context.Context, subjectType, subjectID,
+	relation, objectType, objectID string, metadata map[string]interface{}, source string) (*Relation, error) {
+
+	if err := g.ValidateRelation(subjectType, subjectID, relation, objectType); err != nil {
+		return nil, err
+	}
+	source, err := normalizeSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal relation metadata: %w", err)
+	}
+
+	var rel Relation
+	insert := func(q interface {
+		QueryRow(context.Context, string, ...interface{}) pgx.Row
+	}) error {
+		return q.QueryRow(ctx, `
+			INSERT INTO relations (subject_type, subject_id, relation, object_type, object_id, metadata, source)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+		`, subjectType, subjectID, relation, objectType, objectID, metadataJSON, source).Scan(
+			&rel.ID, &rel.SubjectType, &rel.SubjectID, &rel.Relation,
+			&rel.ObjectType, &rel.ObjectID, &metadataJSON, &rel.Source, &rel.CreatedAt,
+		)
+	}
+
+	// Relations declared with a max are counted and written in one
+	// transaction, so concurrent writes can't both take the last place
+	if max := g.relationLimit(objectType, relation); max > 0 {
+		err = pgx.BeginFunc(ctx, g.store, func(tx pgx.Tx) error {
+			if err := checkRelationLimit(ctx, tx, max, subjectType, subjectID, relation, objectType, objectID); err != nil {
+				return err
+			}
+			return insert(tx)
+		})
+	} else {
+		err = insert(g.store)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create relation: %w", err)
+	}
+
+	if err := json.Unmarshal(metadataJSON, &rel.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal relation metadata: %w", err)
+	}
+
+	return &rel, nil
+}
+
+// RelationFilter selects relations by their fields; empty fields match any
+// value
+type RelationFilter struct {
+	SubjectType string
+	SubjectID   string
+	Relation    string
+	ObjectType  string
+	ObjectID    string
+	Source      string
+}
+
+// where returns the SQL condition selecting the filter's relations and its
+// arguments, refusing an empty filter
+func (f RelationFilter) where() (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	for _, field := range []struct {
+		column, value string
+	}{
+		{"subject_type", f.SubjectType},
+		{"subject_id", f.SubjectID},
+		{"relation", f.Relation},
+		{"object_type", f.ObjectType},
+		{"object_id", f.ObjectID},
+		{"source", f.Source},
+	} {
+		if field.value == "" {
+			continue
+		}
+		args = append(args, field.value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", field.column, len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", nil, errors.New("a relation filter is required")
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// FindRelations returns the relations matching filter, oldest first. An
+// empty filter is refused rather than listing every relation.
+func (g *IdentityGraph) FindRelations(ctx context.Context, filter RelationFilter) ([]Relation, error) {
+	where, args, err := filter.where()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := g.store.Query(ctx, `
+		SELECT id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+		FROM relations
+		WHERE `+where+`
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find relations: %w", err)
+	}
+	return collectRelations(rows)
+}
+
+// DeleteRelations deletes the relations matching filter and returns them.
+// An empty filter is refused rather than deleting every relation.
+func (g *IdentityGraph) DeleteRelations(ctx context.Context, filter RelationFilter) ([]Relation, error) {
+	where, args, err := filter.where()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := g.store.Query(ctx, `
+		DELETE FROM relations
+		WHERE `+where+`
+		RETURNING id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete relations: %w", err)
+	}
+	return collectRelations(rows)
+}
+
+// collectRelations scans and closes rows of id, subject_type, subject_id,
+// relation, object_type, object_id, metadata, source and created_at
+func collectRelations(rows pgx.Rows) ([]Relation, error) {
+	defer rows.Close()
+
+	var relations []Relation
+	for rows.Next() {
+		var rel Relation
+		var metadataJSON []byte
+		if err := rows.Scan(
+			&rel.ID, &rel.SubjectType, &rel.SubjectID, &rel.Relation,
+			&rel.ObjectType, &rel.ObjectID, &metadataJSON, &rel.Source, &rel.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan relation: %w", err)
+		}
+		if err := json.Unmarshal(metadataJSON, &rel.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal relation metadata: %w", err)
+		}
+		relations = append(relations, rel)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read relations: %w", err)
+	}
+	return relations, nil
+}
+
+// GetRelations retrieves all relations for a subject
+func (g *IdentityGraph) GetRelations(ctx context.Context, subjectType, subjectID string) ([]Relation, error) {
+	rows, err := g.store.Query(ctx, `
+		SELECT id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+		FROM relations
+		WHERE subject_type = $1 AND subject_id = $2
+	`, subjectType, subjectID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relations: %w", err)
+	}
+	defer rows.Close()
+
+	var relations []Relation
+	for rows.Next() {
+		var rel Relation
+		var metadataJSON []byte
+		if err := rows.Scan(
+			&rel.ID, &rel.SubjectType, &rel.SubjectID, &rel.Relation,
+			&rel.ObjectType, &rel.ObjectID, &metadataJSON, &rel.Source, &rel.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan relation: %w", err)
+		}
+		if err := json.Unmarshal(metadataJSON, &rel.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal relation metadata: %w", err)
+		}
+		relations = append(relations, rel)
+	}
+
+	return relations, nil
+}
+
+// CheckPermission determines if a subject has a permission on an object
+func (g *IdentityGraph) CheckPermission(ctx context.Context, subjectType, subjectID,
+	permission, objectType, objectID string, contextData map[string]interface{}) (bool, error) {
+
+	// First, get the permission definition to find the condition expression
+	conditionExpr, _, err := g.PermissionCondition(ctx, objectType, permission)
+	if err != nil {
+		return false, err
+	}
+
+	// Evaluates the condition expression
+	return g.EvaluateCondition(ctx, conditionExpr, subjectType, subjectID, objectType, objectID, contextData)
+}
+
+// EvaluateCondition evaluates a permission condition expression
+func (g *IdentityGraph) EvaluateCondition(ctx context.Context, conditionExpr,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (bool, error) {
+
+	// Create a parser for the condition expression
+	parser := NewConditionParser(conditionExpr)
+	expr, err := parser.Parse()
+	if err != nil {
+		return false, fmt.Errorf("failed to parse condition: %w", err)
+	}
+
+	// Evaluate the parsed expression
+	return g.evaluateExpression(ctx, g.planExpression(expr, objectType), subjectType, subjectID, objectType, objectID, contextData)
+}
+
+// evaluateExpression evaluates a parsed condition expression
+func (g *IdentityGraph) evaluateExpression(ctx context.Context, expr Expression,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (bool, error) {
+
+	decision, err := g.decideExpression(ctx, expr, subjectType, subjectID, objectType, objectID, contextData)
+	return decision.Allowed, err
+}
+
+// evaluateRule evaluates a rule expression by calling the appropriate rule function
+func (g *IdentityGraph) evaluateRule(ctx context.Context, rule *RuleExpression,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (allowed bool, err error) {
+
+	ctx, span := tracing.Start(ctx, "graph.EvaluateRule", attribute.String("rule", rule.RuleName))
+	defer func() { tracing.End(span, err) }()
+
+	if g.faults != nil {
+		if err := g.faults.Inject(ctx, FaultPointRuleCache); err != nil {
+			return false, fmt.Errorf("failed to get rule definition: %w", err)
+		}
+	}
+
+	// Get the rule definition from the registry, or the object's tenant's
+	ruleDef, tenantRule, err := g.resolveRule(ctx, rule.RuleName, objectType, objectID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get rule definition: %w", err)
+	}
+	
+	// Evaluate the arguments first
+	argValues := make([]interface{}, len(rule.Arguments))
+	for i, argExpr := range rule.Arguments {
+		switch e := argExpr.(type) {
+		case *ContextExpression:
+			// Get value from context
+			if contextData == nil {
+				return false, fmt.Errorf("context data required for rule argument but not provided")
+			}
+			
+			// Navigate path to get value
+			currentValue := contextData
+			for j, pathPart := range e.Path {
+				if j == len(e.Path)-1 {
+					// Last path segment - extract the value
+					val, exists := currentValue[pathPart]
+					if !exists {
+						return false, fmt.Errorf("context path not found for rule argument: %s", strings.Join(e.Path, "."))
+					}
+					argValues[i] = val
+					break
+				}
+				
+				// Get the next level of the path
+				nextValue, exists := currentValue[pathPart]
+				if !exists {
+					return false, fmt.Errorf("context path not found for rule argument: %s", strings.Join(e.Path, "."))
+				}
+				
+				// Check if the next value is a map
+				nextMap, ok := nextValue.(map[string]interface{})
+				if !ok {
+					return false, fmt.Errorf("context path is not a map for rule argument: %s", strings.Join(e.Path[:j+1], "."))
+				}
+				
+				currentValue = nextMap
+			}
+			
+		case *AttributeExpression:
+			// Get attribute value from the database
+			attributeValue, err := g.attributeValue(ctx, e, subjectType, subjectID, objectType, objectID)
+			if err != nil {
+				return false, fmt.Errorf("failed to get attribute for rule argument: %w", err)
+			}
+			argValues[i] = attributeValue
+			
+		case *LiteralExpression:
+			// Just use the literal value
+			argValues[i] = e.Value
+
+		case *RelationExpression:
+			// organization.tier and balance pass the related entity's or
+			// the object's attribute when it has one, otherwise whether
+			// the relation holds
+			attributeValue, err := g.relatedAttributeValue(ctx, e, objectType, objectID)
+			if err == nil {
+				argValues[i] = attributeValue
+				break
+			}
+			if !errors.Is(err, ErrAttributeNotFound) {
+				return false, err
+			}
+			result, err := g.evaluateExpression(ctx, argExpr, subjectType, subjectID, objectType, objectID, contextData)
+			if err != nil {
+				return false, err
+			}
+			argValues[i] = result
+
+		case *RuleExpression:
+			if !IsBuiltinFunction(e.RuleName) {
+				return false, fmt.Errorf("rule %s cannot be passed as an argument", e.RuleName)
+			}
+			builtinArgs, err := g.evaluateBuiltinArgs(ctx, e, subjectType, subjectID, objectType, objectID, contextData)
+			if err != nil {
+				return false, err
+			}
+			if argValues[i], err = callBuiltin(e.RuleName, builtinArgs); err != nil {
+				return false, err
+			}
+			
+		default:
+			// For other expression types, evaluate them first
+			result, err := g.evaluateExpression(ctx, argExpr, subjectType, subjectID, objectType, objectID, contextData)
+			if err != nil {
+				return false, err
+			}
+			argValues[i] = result
+		}
+	}
+	
+	// Verify that we have the correct number of arguments
+	if len(argValues) != len(ruleDef.Parameters) {
+		return false, fmt.Errorf("rule %s requires %d arguments, got %d", 
+			rule.RuleName, len(ruleDef.Parameters), len(argValues))
+	}
+	
+	// Create a parser for the rule expression
+	ruleCtx := make(map[string]interface{})
+	
+	// Add arguments to rule context
+	for i, param := range ruleDef.Parameters {
+		ruleCtx[param.Name] = argValues[i]
+	}
+	
+	if tenantRule != nil {
+		return g.evaluateTenantRule(ctx, tenantRule, ruleCtx), nil
+	}
+
+	// Parse the rule expression
+	parser := NewConditionParser(ruleDef.Expression)
+	ruleExpr, err := parser.Parse()
+	if err != nil {
+		return false, fmt.Errorf("failed to parse rule expression: %w", err)
+	}
+	
+	// Evaluate the rule expression with the rule context
+	return g.evaluateRuleExpression(ctx, ruleExpr, ruleCtx)
+}
+
+// evaluateRuleExpression evaluates a rule expression with the given context
+func (g *IdentityGraph) evaluateRuleExpression(ctx context.Context, expr Expression, ruleCtx map[string]interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	switch e := expr.(type) {
+	case *AndExpression:
+		// Evaluate left expression
+		leftResult, err := g.evaluateRuleExpression(ctx, e.Left, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		
+		// Short-circuit if left expression is false
+		if !leftResult {
+			return false, nil
+		}
+		
+		// Evaluate right expression
+		return g.evaluateRuleExpression(ctx, e.Right, ruleCtx)
+		
+	case *OrExpression:
+		// Evaluate left expression
+		leftResult, err := g.evaluateRuleExpression(ctx, e.Left, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		
+		// Short-circuit if left expression is true
+		if leftResult {
+			return true, nil
+		}
+		
+		// Evaluate right expression
+		return g.evaluateRuleExpression(ctx, e.Right, ruleCtx)
+		
+	case *NotExpression:
+		result, err := g.evaluateRuleExpression(ctx, e.Operand, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		return !result, nil
+		
+	case *ComparisonExpression:
+		// Evaluate left and right expressions to get their values
+		leftValue, err := g.evaluateRuleValue(ctx, e.Left, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		
+		rightValue, err := g.evaluateRuleValue(ctx, e.Right, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		
+		// Perform the comparison based on the operator
+		return g.compareValues(leftValue, e.Operator, rightValue)
+		
+	case *RelationExpression:
+		// In rule context, relation expressions are treated as variable references
+		value, exists := ruleCtx[e.RelationName]
+		if !exists {
+			return false, fmt.Errorf("variable not found in rule context: %s", e.RelationName)
+		}
+		
+		// Convert value to boolean
+		boolValue, ok := value.(bool)
+		if ok {
+			return boolValue, nil
+		}
+		
+		// Non-boolean values are treated as "exists" checks
+		return value != nil, nil
+		
+	case *ContextExpression:
+		// Extract variable from context
+		value, exists := ruleCtx[e.Path[0]]
+		if !exists {
+			return false, fmt.Errorf("variable not found in rule context: %s", e.Path[0])
+		}
+		
+		// Convert value to boolean if possible
+		boolValue, ok := value.(bool)
+		if ok {
+			return boolValue, nil
+		}
+		
+		// Non-boolean values are treated as "exists" checks
+		return value != nil, nil
+		
+	case *LiteralExpression:
+		// Convert literal value to boolean if possible
+		boolValue, ok := e.Value.(bool)
+		if ok {
+			return boolValue, nil
+		}
+		
+		// Non-boolean values are treated as "exists" checks
+		return e.Value != nil, nil
+
+	case *RuleExpression:
+		args, err := g.evaluateRuleArgs(ctx, e, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		return callBuiltinPredicate(e.RuleName, args)
+
+	case *InExpression:
+		value, err := g.evaluateRuleValue(ctx, e.Value, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		list, err := g.evaluateRuleValue(ctx, e.List, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		return g.memberOf(value, list)
+
+	case *QuantifiedExpression:
+		list, err := g.evaluateRuleValue(ctx, e.List, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		right, err := g.evaluateRuleValue(ctx, e.Right, ruleCtx)
+		if err != nil {
+			return false, err
+		}
+		return g.quantify(e.Quantifier, list, e.Operator, right)
+		
+	default:
+		return false, fmt.Errorf("unsupported expression type in rule: %T", expr)
+	}
+}
+
+// evaluateRuleValue evaluates an expression to extract its value (not boolean result)
+func (g *IdentityGraph) evaluateRuleValue(ctx context.Context, expr Expression, ruleCtx map[string]interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case *RelationExpression:
+		// Treat as variable reference
+		value, exists := ruleCtx[e.RelationName]
+		if !exists {
+			return nil, fmt.Errorf("variable not found in rule context: %s", e.RelationName)
+		}
+		return value, nil
+		
+	case *ContextExpression:
+		// Extract variable from context
+		value, exists := ruleCtx[e.Path[0]]
+		if !exists {
+			return nil, fmt.Errorf("variable not found in rule context: %s", e.Path[0])
+		}
+		return value, nil
+		
+	case *LiteralExpression:
+		return e.Value, nil
+
+	case *RuleExpression:
+		args, err := g.evaluateRuleArgs(ctx, e, ruleCtx)
+		if err != nil {
+			return nil, err
+		}
+		return callBuiltin(e.RuleName, args)
+		
+	default:
+		// For complex expressions, evaluate them to a boolean result
+		result, err := g.evaluateRuleExpression(ctx, expr, ruleCtx)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+// evaluateRuleArgs evaluates the arguments of a built-in function called
+// inside a rule; rules can't call other rules
+func (g *IdentityGraph) evaluateRuleArgs(ctx context.Context, call *RuleExpression, ruleCtx map[string]interface{}) ([]interface{}, error) {
+	if !IsBuiltinFunction(call.RuleName) {
+		return nil, fmt.Errorf("rules cannot call other rules: %s", call.RuleName)
+	}
+
+	args := make([]interface{}, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		value, err := g.evaluateRuleValue(ctx, arg, ruleCtx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return args, nil
+}
+
+// EvaluateRuleExpression evaluates a rule body against parameter values
+// without loading anything from the database
+func EvaluateRuleExpression(ctx context.Context, expression string, params map[string]interface{}) (bool, error) {
+	expr, err := NewConditionParser(expression).Parse()
+	if err != nil {
+		return false, fmt.Errorf("failed to parse rule expression: %w", err)
+	}
+	return (&IdentityGraph{}).evaluateRuleExpression(ctx, expr, params)
+}
+
+// EvaluateRule directly evaluates a rule with provided parameter values
+func (g *IdentityGraph) EvaluateRule(ctx context.Context, ruleName string, params map[string]interface{}) (bool, error) {
+	// Check rule cache for the rule
+	g.ruleCacheMu.RLock()
+	rule, exists := g.ruleCache[ruleName]
+	g.ruleCacheMu.RUnlock()
+	g.recordCacheLookup(CacheRules, exists)
+	
+	if !exists {
+		// Try to load rule from database
+		if err := g.loadRules(ctx); err != nil {
+			return false, fmt.Errorf("failed to load rules: %w", err)
+		}
+		
+		// Check again after loading
+		g.ruleCacheMu.RLock()
+		rule, exists = g.ruleCache[ruleName]
+		g.ruleCacheMu.RUnlock()
+		
+		if !exists {
+			return false, fmt.Errorf("rule not found: %s", ruleName)
+		}
+	}
+	
+	// Parse rule expression
+	parser := NewConditionParser(rule.Expression)
+	expr, err := parser.Parse()
+	if err != nil {
+		return false, fmt.Errorf("failed to parse rule expression: %w", err)
+	}
+	
+	// Evaluate rule expression with parameters
+	return g.evaluateRuleExpression(ctx, expr, params)
+}
+
+// compareValues compares two values based on the comparison operator
+func (g *IdentityGraph) compareValues(left interface{}, op tokenType, right interface{}) (bool, error) {
+	// Convert both values to a common type for comparison if needed
+	leftFloat, leftIsFloat := toFloat64(left)
+	rightFloat, rightIsFloat := toFloat64(right)
+	
+	// If both values can be converted to numbers, compare them as numbers
+	if leftIsFloat && rightIsFloat {
+		switch op {
+		case tokenEQ:
+			return leftFloat == rightFloat, nil
+		case tokenNEQ:
+			return leftFloat != rightFloat, nil
+		case tokenGT:
+			return leftFloat > rightFloat, nil
+		case tokenGTE:
+			return leftFloat >= rightFloat, nil
+		case tokenLT:
+			return leftFloat < rightFloat, nil
+		case tokenLTE:
+			return leftFloat <= rightFloat, nil
+		default:
+			return false, fmt.Errorf("unsupported comparison operator: %v", op)
+		}
+	}
+	
+	// Try string comparison if one of the values is a string
+	leftStr, leftIsStr := left.(string)
+	rightStr, rightIsStr := right.(string)
+	
+	if leftIsStr && rightIsStr {
+		switch op {
+		case tokenEQ:
+			return leftStr == rightStr, nil
+		case tokenNEQ:
+			return leftStr != rightStr, nil
+		case tokenGT:
+			return leftStr > rightStr, nil
+		case tokenGTE:
+			return leftStr >= rightStr, nil
+		case tokenLT:
+			return leftStr < rightStr, nil
+		case tokenLTE:
+			return leftStr <= rightStr, nil
+		default:
+			return false, fmt.Errorf("unsupported comparison operator: %v", op)
+		}
+	}
+	
+	// For mixed types, == and != can still be applied
+	if op == tokenEQ {
+		// For equality, just compare if the values are equal
+		return left == right, nil
+	} else if op == tokenNEQ {
+		// For inequality, just compare if the values are not equal
+		return left != right, nil
+	}
+	
+	// For other comparison operators with incompatible types, return an error
+	return false, fmt.Errorf("cannot compare values of different types: %T and %T", left, right)
+}
+
+// getEntityAttribute gets an attribute value for an entity from the database
+func (g *IdentityGraph) getEntityAttribute(ctx context.Context, entityType, entityID, attributeName string) (interface{}, error) {
+	if asOf, ok := AsOf(ctx); ok {
+		return g.getEntityAttributeAsOf(ctx, entityType, entityID, attributeName, asOf)
+	}
+
+	ctx, cancel := budget.Database(ctx)
+	defer cancel()
+
+	// Fetch the entity's properties along with the typed attribute, if any
+	var propertiesJSON []byte
+	var stored storedAttribute
+	err := g.store.QueryRow(ctx, g.statement(stmtEntityAttribute), entityType, entityID, attributeName).Scan(
+		&propertiesJSON, &stored.DataType, &stored.Bool, &stored.Int,
+		&stored.Double, &stored.String, &stored.Array)
+	
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: entity %s:%s not found", ErrAttributeNotFound, entityType, entityID)
+		}
+		return nil, fmt.Errorf("failed to get entity properties: %w", err)
+	}
+	
+	// Parse the properties JSON
+	var properties map[string]interface{}
+	if err := json.Unmarshal(propertiesJSON, &properties); err != nil {
+		return nil, fmt.Errorf("failed to parse entity properties: %w", err)
+	}
+	
+	return g.entityAttribute(entityType, attributeName, stored, properties)
+}
+
+// Helper function to convert various numeric types to float64
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// checkDirectRelation checks if subject has a direct relation to the object.
+// Unless the object's type is strict, the relation may be stored in either
+// direction, subject->object or object->subject. A derived relation declared
+// for the object's type also satisfies it, as does holding the relation
+// through a subject set such as group:eng#member.
+func (g *IdentityGraph) checkDirectRelation(ctx context.Context,
+	subjectType, subjectID, relation, objectType, objectID string) (bool, error) {
+
+	return g.checkDirectRelationDepth(ctx, subjectType, subjectID, relation, objectType, objectID, 0)
+}
+
+// checkDirectRelationDepth is checkDirectRelation for a subject set depth
+// sets deep
+func (g *IdentityGraph) checkDirectRelationDepth(ctx context.Context,
+	subjectType, subjectID, relation, objectType, objectID string, depth int) (found bool, err error) {
+
+	ctx, span := tracing.Start(ctx, "graph.DirectRelation",
+		attribute.String("relation", relation), attribute.Int("depth", depth))
+	defer func() { tracing.End(span, err) }()
+
+	stmt := stmtDirectRelation
+	if g.strictRelationDirection(objectType) || g.flagEnabled(FlagStrictDirection, objectType, objectID) {
+		stmt = stmtDirectRelationStrict
+	}
+
+	dbCtx, cancel := budget.Database(ctx)
+	defer cancel()
+
+	var exists bool
+	err = g.store.QueryRow(dbCtx, g.statement(stmt),
+		subjectType, subjectID, relation, objectType, objectID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check direct relation: %w", err)
+	}
+	if exists {
+		return true, nil
+	}
+
+	// Without a tuple, the object's attributes may still imply the relation
+	derived, err := g.checkDerivedRelation(ctx, subjectType, relation, objectType, objectID)
+	if err != nil || derived {
+		return derived, err
+	}
+
+	return g.checkSubjectSets(ctx, subjectType, subjectID, relation, objectType, objectID, depth)
+}
+
+// checkIndirectRelation checks for relations through intermediate entities,
+// following the graph from the related entity (e.g. the organization in
+// organization.owner) as both subject and object
+func (g *IdentityGraph) checkIndirectRelation(ctx context.Context,
+	subjectType, subjectID, relationPath, relationName, objectType, objectID string) (found bool, err error) {
+
+	ctx, span := tracing.Start(ctx, "graph.IndirectRelation",
+		attribute.String("relation_path", relationPath), attribute.String("relation", relationName))
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := budget.Database(ctx)
+	defer cancel()
+
+	var exists bool
+	err = g.store.QueryRow(ctx, g.statement(stmtIndirectRelation),
+		relationPath, objectID, relationName, subjectType, subjectID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check indirect relation: %w", err)
+	}
+
+	return exists, nil
+}
+
+// AddPermissionDefinition adds a new permission definition. A condition over
+// the graph's ConditionLimits fails with a *ConditionLimitError.
+func (g *IdentityGraph) AddPermissionDefinition(ctx context.Context, entityType, permissionName,
+	conditionExpr, description string) (*PermissionDefinition, error) {
+
+	if err := g.conditionLimits.Check(conditionExpr); err != nil {
+		return nil, fmt.Errorf("%s.%s: %w", entityType, permissionName, err)
+	}
+
+	var def PermissionDefinition
+	err := g.store.QueryRow(ctx, `
+		INSERT INTO permission_definitions (entity_type, permission_name, condition_expression, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, entity_type, permission_name, condition_expression, description, created_at
+	`, entityType, permissionName, conditionExpr, description).Scan(
+		&def.ID, &def.EntityType, &def.PermissionName, &def.ConditionExpression,
+		&def.Description, &def.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to add permission definition: %w", err)
+	}
+	if _, err := g.SnapshotSchema(ctx, "api"); err != nil {
+		return nil, err
+	}
+
+	return &def, nil
+}
@@ -0,0 +1,119 @@
+// Package graphtest generates permission conditions for property tests and
+// evaluates them with the .perm model's semantics, the reference the graph
+// evaluator has to agree with.
+package graphtest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+	"github.com/dangerclosesec/supra/permissions/parser"
+)
+
+// Generator builds random conditions over a fixed set of atoms, such as
+// relation names or request.* context references
+type Generator struct {
+	rand  *rand.Rand
+	atoms []string
+	// MaxDepth bounds how deeply subexpressions are parenthesized
+	MaxDepth int
+}
+
+// NewGenerator returns a generator whose output is determined by seed, so a
+// failing case can be replayed
+func NewGenerator(seed uint64, atoms []string) *Generator {
+	return &Generator{
+		rand:     rand.New(rand.NewPCG(seed, seed)),
+		atoms:    atoms,
+		MaxDepth: 3,
+	}
+}
+
+// Expression returns a condition such as "a or not (b and c) and d".
+// Operands are chained without parentheses as often as not, so operator
+// precedence is exercised as well as grouping, and some are negated.
+func (g *Generator) Expression() string {
+	return g.expression(0)
+}
+
+func (g *Generator) expression(depth int) string {
+	operands := 1 + g.rand.IntN(4)
+	var b strings.Builder
+	for i := 0; i < operands; i++ {
+		if i > 0 {
+			if g.rand.IntN(2) == 0 {
+				b.WriteString(" and ")
+			} else {
+				b.WriteString(" or ")
+			}
+		}
+		if g.rand.IntN(4) == 0 {
+			b.WriteString("not ")
+		}
+		if depth < g.MaxDepth && g.rand.IntN(3) == 0 {
+			b.WriteString("(" + g.expression(depth+1) + ")")
+		} else {
+			b.WriteString(g.atoms[g.rand.IntN(len(g.atoms))])
+		}
+	}
+	return b.String()
+}
+
+// Subset picks each atom with even odds, e.g. the tuples that exist or the
+// context keys that are set for one case
+func (g *Generator) Subset() map[string]bool {
+	set := make(map[string]bool)
+	for _, atom := range g.atoms {
+		if g.rand.IntN(2) == 0 {
+			set[atom] = true
+		}
+	}
+	return set
+}
+
+// ParsePermission parses condition as a permission in a .perm schema and
+// returns the parsed tree and the expression string synced to the database
+func ParsePermission(condition string) (model.Expression, string, error) {
+	p := parser.NewParser(parser.NewLexer("entity doc {\n    permission check = " + condition + "\n}\n"))
+	m := p.ParsePermissionModel()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, "", fmt.Errorf("failed to parse %q: %s", condition, strings.Join(errs, "; "))
+	}
+
+	entity := m.GetEntity("doc")
+	if entity == nil || len(entity.Permissions) != 1 {
+		return nil, "", fmt.Errorf("failed to parse %q: no permission produced", condition)
+	}
+	permission := entity.Permissions[0]
+	return permission.ParsedExpr, permission.Expression, nil
+}
+
+// Eval evaluates a parsed .perm condition. holds reports whether a relation
+// or context reference, named as written in the schema, is satisfied.
+func Eval(expr model.Expression, holds func(atom string) bool) (bool, error) {
+	switch e := expr.(type) {
+	case *model.And:
+		left, err := Eval(e.Left, holds)
+		if err != nil || !left {
+			return false, err
+		}
+		return Eval(e.Right, holds)
+	case *model.Or:
+		left, err := Eval(e.Left, holds)
+		if err != nil || left {
+			return left, err
+		}
+		return Eval(e.Right, holds)
+	case *model.Not:
+		operand, err := Eval(e.Expr, holds)
+		return !operand, err
+	case *model.Parentheses:
+		return Eval(e.Expr, holds)
+	case *model.RelationRef, *model.ContextRef:
+		return holds(e.String()), nil
+	default:
+		return false, fmt.Errorf("no reference semantics for %T", expr)
+	}
+}
@@ -0,0 +1,159 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// maxInheritanceDepth bounds how many levels a reference like parent.view
+// climbs, the same depth the indirect relation query walks
+const maxInheritanceDepth = 10
+
+// entityRef names an entity by type and external ID
+type entityRef struct{ Type, ID string }
+
+func (r entityRef) String() string {
+	return r.Type + ":" + r.ID
+}
+
+type inheritanceKey struct{}
+
+// inheritanceFrame is one permission being evaluated on a related entity,
+// as in parent.view, linked to the frames that led to it. Frames are pushed
+// onto the check's context, so the chain is the current path up the
+// hierarchy and a permission already on it is a cycle.
+type inheritanceFrame struct {
+	key    string // type:id#permission, empty for the checked object
+	parent *inheritanceFrame
+	depth  int
+	memo   *inheritanceMemo
+}
+
+// inheritanceMemo is shared by every frame under one inherited reference,
+// so an ancestor reached along several paths is only looked up and granted
+// once
+type inheritanceMemo struct {
+	// mu guards the maps, which the operands of a parallel "or" share
+	mu sync.Mutex
+	// conditions caches permission definitions by type#permission; an empty
+	// string means the type doesn't define the permission
+	conditions map[string]string
+	allowed    map[string]Decision
+}
+
+// inheritanceFrom returns the frame being evaluated, or a root frame with
+// a fresh memo at the start of a check
+func inheritanceFrom(ctx context.Context) *inheritanceFrame {
+	if frame, ok := ctx.Value(inheritanceKey{}).(*inheritanceFrame); ok {
+		return frame
+	}
+	return &inheritanceFrame{memo: &inheritanceMemo{
+		conditions: make(map[string]string),
+		allowed:    make(map[string]Decision),
+	}}
+}
+
+// onPath reports whether key is being evaluated further down the path
+func (f *inheritanceFrame) onPath(key string) bool {
+	for ; f != nil; f = f.parent {
+		if f.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *inheritanceFrame) push(ctx context.Context, key string) context.Context {
+	reachedDepth(ctx, f.depth+1)
+	return context.WithValue(ctx, inheritanceKey{}, &inheritanceFrame{
+		key:    key,
+		parent: f,
+		depth:  f.depth + 1,
+		memo:   f.memo,
+	})
+}
+
+// permissionCondition returns the condition of a permission defined on
+// entityType, and false when the type has no such permission
+func (g *IdentityGraph) permissionCondition(ctx context.Context, memo *inheritanceMemo,
+	entityType, permission string) (string, bool, error) {
+
+	key := entityType + "#" + permission
+	memo.mu.Lock()
+	condition, ok := memo.conditions[key]
+	memo.mu.Unlock()
+	g.recordCacheLookup(CacheInheritance, ok)
+	if ok {
+		return condition, condition != "", nil
+	}
+
+	condition, _, err := g.PermissionCondition(ctx, entityType, permission)
+	if err != nil && !errors.Is(err, ErrPermissionNotDefined) {
+		return "", false, err
+	}
+
+	memo.mu.Lock()
+	memo.conditions[key] = condition
+	memo.mu.Unlock()
+	return condition, condition != "", nil
+}
+
+// decideInherited evaluates a reference like parent.view as the view
+// permission of the object's parents. handled is false when no entity
+// reached through the path defines the permission, so the reference is a
+// relation after all. The walk stops at cycles and at maxInheritanceDepth,
+// treating either as a path that grants nothing.
+func (g *IdentityGraph) decideInherited(ctx context.Context, e *RelationExpression,
+	subjectType, subjectID, objectType, objectID string, contextData map[string]interface{}) (Decision, bool, error) {
+
+	related, err := g.relatedEntities(ctx, e.RelationPath, objectType, objectID)
+	if err != nil {
+		return Decision{}, false, err
+	}
+
+	frame := inheritanceFrom(ctx)
+	memo := frame.memo
+
+	handled := false
+	for _, ref := range related {
+		condition, ok, err := g.permissionCondition(ctx, memo, ref.Type, e.RelationName)
+		if err != nil {
+			return Decision{}, false, err
+		}
+		if !ok {
+			continue
+		}
+		handled = true
+
+		key := ref.String() + "#" + e.RelationName
+		memo.mu.Lock()
+		known, ok := memo.allowed[key]
+		memo.mu.Unlock()
+		if ok {
+			return known, true, nil
+		}
+		if frame.onPath(key) || frame.depth >= maxInheritanceDepth {
+			continue
+		}
+
+		expr, err := NewConditionParser(condition).Parse()
+		if err != nil {
+			return Decision{}, true, fmt.Errorf("failed to parse condition of %s.%s: %w", ref.Type, e.RelationName, err)
+		}
+		d, err := g.decideExpression(frame.push(ctx, key), g.planExpression(expr, ref.Type),
+			subjectType, subjectID, ref.Type, ref.ID, contextData)
+		if err != nil {
+			return Decision{}, true, err
+		}
+		if d.Allowed {
+			memo.mu.Lock()
+			memo.allowed[key] = d
+			memo.mu.Unlock()
+			return d, true, nil
+		}
+	}
+
+	return decision(false, "", ReasonDeniedNoPath), handled, nil
+}
@@ -0,0 +1,27 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInheritanceFrames(t *testing.T) {
+	root := inheritanceFrom(context.Background())
+	assert.Equal(t, 0, root.depth)
+	assert.False(t, root.onPath("organization:acme#view"))
+
+	ctx := root.push(context.Background(), "organization:sales#view")
+	ctx = inheritanceFrom(ctx).push(ctx, "organization:acme#view")
+	frame := inheritanceFrom(ctx)
+
+	assert.Equal(t, 2, frame.depth)
+	assert.True(t, frame.onPath("organization:sales#view"))
+	assert.True(t, frame.onPath("organization:acme#view"))
+	assert.False(t, frame.onPath("organization:acme#manage"))
+	assert.Same(t, root.memo, frame.memo, "frames of one walk share their memo")
+
+	fresh := inheritanceFrom(context.Background())
+	assert.NotSame(t, root.memo, fresh.memo)
+}
@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AttributeVersion is one value an entity attribute held and the range it
+// was valid for. ValidTo is nil for the current value.
+type AttributeVersion struct {
+	Attribute string      `json:"attribute"`
+	Value     interface{} `json:"value"`
+	ValidFrom time.Time   `json:"valid_from"`
+	ValidTo   *time.Time  `json:"valid_to,omitempty"`
+}
+
+type asOfKey struct{}
+
+// WithAsOf makes checks evaluated with ctx read entity attributes as they
+// were at t. Relations are always read as they are now.
+func WithAsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, asOfKey{}, t)
+}
+
+// AsOf returns the time set by WithAsOf
+func AsOf(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(asOfKey{}).(time.Time)
+	return t, ok
+}
+
+// GetAttributeHistory returns every recorded value of an entity's
+// attributes, oldest first. An empty attribute returns all of them.
+func (g *IdentityGraph) GetAttributeHistory(ctx context.Context, entityType, entityID, attribute string) ([]AttributeVersion, error) {
+	rows, err := g.store.Query(ctx, `
+		SELECT attribute, value, valid_from, valid_to
+		FROM entity_attribute_history
+		WHERE entity_type = $1 AND entity_id = $2
+		  AND ($3 = '' OR attribute = $3)
+		ORDER BY attribute, valid_from, id
+	`, entityType, entityID, attribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attribute history: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []AttributeVersion{}
+	for rows.Next() {
+		var v AttributeVersion
+		var valueJSON []byte
+		if err := rows.Scan(&v.Attribute, &valueJSON, &v.ValidFrom, &v.ValidTo); err != nil {
+			return nil, fmt.Errorf("failed to scan attribute version: %w", err)
+		}
+		if err := json.Unmarshal(valueJSON, &v.Value); err != nil {
+			return nil, fmt.Errorf("failed to parse attribute value: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// getEntityAttributeAsOf reads an attribute's value at asOf from its history
+func (g *IdentityGraph) getEntityAttributeAsOf(ctx context.Context, entityType, entityID, attributeName string, asOf time.Time) (interface{}, error) {
+	var valueJSON []byte
+	err := g.store.QueryRow(ctx, `
+		SELECT value
+		FROM entity_attribute_history
+		WHERE entity_type = $1 AND entity_id = $2 AND attribute = $3
+		  AND valid_from <= $4 AND (valid_to IS NULL OR valid_to > $4)
+		ORDER BY valid_from DESC, id DESC
+		LIMIT 1
+	`, entityType, entityID, attributeName, asOf).Scan(&valueJSON)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s as of %s", ErrAttributeNotFound, attributeName, asOf.Format(time.RFC3339))
+		}
+		return nil, fmt.Errorf("failed to get attribute history: %w", err)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(valueJSON, &value); err != nil {
+		return nil, fmt.Errorf("failed to parse attribute value: %w", err)
+	}
+	return value, nil
+}
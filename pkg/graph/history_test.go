@@ -0,0 +1,19 @@
+package graph
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAsOf(t *testing.T) {
+	if _, ok := AsOf(context.Background()); ok {
+		t.Fatal("expected no as-of time on a plain context")
+	}
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	got, ok := AsOf(WithAsOf(context.Background(), at))
+	if !ok || !got.Equal(at) {
+		t.Fatalf("AsOf() = %v, %v; want %v, true", got, ok, at)
+	}
+}
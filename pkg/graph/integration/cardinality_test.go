@@ -0,0 +1,75 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+func TestRelationLimits(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	if err := g.SyncRelationLimits(ctx, []graph.RelationLimit{
+		{EntityType: "document", Relation: "owner", MaxSubjects: 1},
+		{EntityType: "document", Relation: "reviewer", MaxSubjects: 2},
+	}); err != nil {
+		t.Fatalf("SyncRelationLimits returned error: %v", err)
+	}
+
+	if _, err := g.CreateRelation(ctx, "user", "alice", "owner", "document", "d1", nil, ""); err != nil {
+		t.Fatalf("first owner: %v", err)
+	}
+	_, err := g.CreateRelation(ctx, "user", "bob", "owner", "document", "d1", nil, "")
+	var limitErr *graph.CardinalityError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("second owner: expected a CardinalityError, got %v", err)
+	}
+	if len(limitErr.Holders) != 1 || limitErr.Holders[0] != "user:alice" {
+		t.Errorf("holders = %v, want [user:alice]", limitErr.Holders)
+	}
+
+	// The limit is per object and per relation
+	if _, err := g.CreateRelation(ctx, "user", "bob", "owner", "document", "d2", nil, ""); err != nil {
+		t.Errorf("owner of another document: %v", err)
+	}
+	if _, err := g.CreateRelation(ctx, "user", "bob", "viewer", "document", "d1", nil, ""); err != nil {
+		t.Errorf("unlimited relation: %v", err)
+	}
+
+	// Concurrent writes are counted one after the other
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for _, id := range []string{"u1", "u2", "u3", "u4", "u5"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			_, err := g.CreateRelation(ctx, "user", id, "reviewer", "document", "d1", nil, "")
+			errs <- err
+		}(id)
+	}
+	wg.Wait()
+	close(errs)
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, graph.ErrCardinalityExceeded):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if created != 2 {
+		t.Errorf("created %d reviewers, want 2", created)
+	}
+
+	limits := g.RelationLimits()
+	if len(limits) != 2 || limits[0].Relation != "owner" {
+		t.Errorf("RelationLimits() = %v", limits)
+	}
+}
@@ -0,0 +1,12 @@
+// Package integration runs the identity graph against a real Postgres,
+// covering the SQL paths the unit tests stub out. The tests are behind the
+// integration build tag:
+//
+//	go test -tags integration ./pkg/graph/integration
+//
+// They start a disposable postgres:16-alpine container with testcontainers-go,
+// or use SUPRA_TEST_DATABASE_URL when it is set. That database is migrated
+// and its graph tables are truncated between tests, so never point it at one
+// holding data you want to keep. Without a docker daemon or the variable the
+// run fails; set SUPRA_TEST_SKIP_DATABASE=1 to skip the tests instead.
+package integration
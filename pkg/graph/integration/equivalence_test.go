@@ -0,0 +1,65 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph/graphtest"
+)
+
+// TestPermAndGraphAgree generates conditions over relations and random
+// tuples, stored in either direction, and checks the graph decides as the
+// .perm tree does
+func TestPermAndGraphAgree(t *testing.T) {
+	const cases = 200
+	atoms := []string{"owner", "editor", "viewer", "commenter"}
+
+	type generated struct {
+		condition string
+		object    string
+		want      bool
+	}
+
+	f := fixture{Permissions: map[string]map[string]string{"doc": {}}}
+	var all []generated
+	for seed := uint64(1); seed <= cases; seed++ {
+		gen := graphtest.NewGenerator(seed, atoms)
+		condition := gen.Expression()
+		parsed, synced, err := graphtest.ParsePermission(condition)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+
+		object := fmt.Sprintf("doc:%d", seed)
+		tuples := gen.Subset()
+		for relation := range tuples {
+			if seed%2 == 0 {
+				f.Relations = append(f.Relations, fmt.Sprintf("user:alice %s %s", relation, object))
+			} else {
+				f.Relations = append(f.Relations, fmt.Sprintf("%s %s user:alice", object, relation))
+			}
+		}
+
+		want, err := graphtest.Eval(parsed, func(atom string) bool { return tuples[atom] })
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		f.Permissions["doc"][fmt.Sprintf("check_%d", seed)] = synced
+		all = append(all, generated{condition: condition, object: object, want: want})
+	}
+	for i, c := range all {
+		f.Checks = append(f.Checks, checkCase{
+			Name:       fmt.Sprintf("seed %d: %s", i+1, c.condition),
+			Subject:    "user:alice",
+			Permission: fmt.Sprintf("check_%d", i+1),
+			Object:     c.object,
+			Allowed:    c.want,
+		})
+	}
+
+	g := newGraph(t)
+	f.load(t, g)
+	f.run(t, g)
+}
@@ -0,0 +1,78 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+func TestExpand(t *testing.T) {
+	f := fixture{
+		Relations: []string{
+			"user:alice owner document:d1",
+			"user:bob viewer document:d1",
+			"document:d1 parent folder:f1",
+			"user:carol viewer folder:f1",
+			"folder:f1 parent folder:f1",
+		},
+		Permissions: map[string]map[string]string{
+			"document": {"view": "owner or viewer or parent.view"},
+			"folder":   {"view": "viewer or parent.view"},
+		},
+	}
+	g := newGraph(t)
+	f.load(t, g)
+
+	tree, err := g.Expand(context.Background(), f.Permissions["document"]["view"], "document", "d1", "view")
+	if err != nil {
+		t.Fatalf("Expand returned error: %v", err)
+	}
+
+	want := &graph.ExpandNode{
+		Kind: graph.ExpandPermission, Expression: "owner or viewer or parent.view", Object: "document:d1", Permission: "view",
+		Children: []*graph.ExpandNode{{
+			Kind: graph.ExpandUnion, Expression: "((owner or viewer) or parent.view)", Object: "document:d1",
+			Children: []*graph.ExpandNode{
+				{Kind: graph.ExpandRelation, Expression: "owner", Object: "document:d1", Subjects: []string{"user:alice"}},
+				{Kind: graph.ExpandRelation, Expression: "viewer", Object: "document:d1", Subjects: []string{"user:bob"}},
+				{Kind: graph.ExpandInherited, Expression: "parent.view", Object: "document:d1", Children: []*graph.ExpandNode{{
+					Kind: graph.ExpandPermission, Expression: "viewer or parent.view", Object: "folder:f1", Permission: "view",
+					Children: []*graph.ExpandNode{{
+						Kind: graph.ExpandUnion, Expression: "(viewer or parent.view)", Object: "folder:f1",
+						Children: []*graph.ExpandNode{
+							{Kind: graph.ExpandRelation, Expression: "viewer", Object: "folder:f1", Subjects: []string{"user:carol"}},
+							// The folder is its own parent, so the cycle stops here
+							{Kind: graph.ExpandInherited, Expression: "parent.view", Object: "folder:f1", Children: []*graph.ExpandNode{{
+								Kind: graph.ExpandPermission, Expression: "viewer or parent.view", Object: "folder:f1",
+								Permission: "view", Truncated: true,
+							}}},
+						},
+					}},
+				}}},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("unexpected tree:\n%s", dumpTree(tree, ""))
+	}
+}
+
+func dumpTree(n *graph.ExpandNode, indent string) string {
+	s := indent + n.Kind + " " + n.Object + " " + n.Expression
+	if len(n.Subjects) > 0 {
+		s += fmt.Sprint(" ", n.Subjects)
+	}
+	if n.Truncated {
+		s += " (truncated)"
+	}
+	s += "\n"
+	for _, c := range n.Children {
+		s += dumpTree(c, indent+"  ")
+	}
+	return s
+}
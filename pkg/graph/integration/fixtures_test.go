@@ -0,0 +1,203 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"gopkg.in/yaml.v3"
+)
+
+// fixture is a graph and the checks to run against it, loaded from
+// testdata/*.yaml
+type fixture struct {
+	Entities []fixtureEntity `yaml:"entities"`
+	// AttributeTypes maps "type.attribute" to the attribute's data type
+	AttributeTypes map[string]string `yaml:"attribute_types"`
+	// Relations are written "type:id relation type:id", subject first. The
+	// subject may be a subject set, "type:id#relation".
+	Relations []string `yaml:"relations"`
+	// Permissions maps an entity type to its permissions' conditions
+	Permissions map[string]map[string]string `yaml:"permissions"`
+	Rules       []graph.RuleDefinition       `yaml:"rules"`
+	Derived     []graph.DerivedRelation      `yaml:"derived"`
+	Checks      []checkCase                  `yaml:"checks"`
+}
+
+type fixtureEntity struct {
+	Ref        string                 `yaml:"ref"`
+	Properties map[string]interface{} `yaml:"properties"`
+	// Attributes are stored as typed attributes, which must be declared in
+	// the fixture's AttributeTypes
+	Attributes map[string]interface{} `yaml:"attributes"`
+}
+
+type checkCase struct {
+	Name       string                 `yaml:"name"`
+	Subject    string                 `yaml:"subject"`
+	Permission string                 `yaml:"permission"`
+	Object     string                 `yaml:"object"`
+	Context    map[string]interface{} `yaml:"context"`
+	Allowed    bool                   `yaml:"allowed"`
+	// Reason, when set, is the decision reason the check must report
+	Reason string `yaml:"reason"`
+}
+
+func readFixture(t *testing.T, path string) fixture {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var f fixture
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		t.Fatalf("failed to parse fixture %s: %v", path, err)
+	}
+	return f
+}
+
+// splitRef parses a type:id reference
+func splitRef(t *testing.T, ref string) (string, string) {
+	t.Helper()
+	entityType, id, ok := strings.Cut(ref, ":")
+	if !ok || entityType == "" || id == "" {
+		t.Fatalf("reference %q is not in type:id form", ref)
+	}
+	return entityType, id
+}
+
+// load writes the fixture's graph. Relation endpoints that aren't listed as
+// entities are created without properties, as the service does.
+func (f fixture) load(t *testing.T, g *graph.IdentityGraph) {
+	t.Helper()
+	ctx := context.Background()
+
+	created := make(map[string]bool)
+	createEntity := func(ref string, properties map[string]interface{}) {
+		if created[ref] {
+			return
+		}
+		entityType, id := splitRef(t, ref)
+		if properties == nil {
+			properties = map[string]interface{}{}
+		}
+		if _, err := g.CreateEntity(ctx, entityType, id, properties); err != nil {
+			t.Fatalf("failed to create %s: %v", ref, err)
+		}
+		created[ref] = true
+	}
+
+	var declared []graph.AttributeDeclaration
+	for name, dataType := range f.AttributeTypes {
+		entityType, attribute, _ := strings.Cut(name, ".")
+		declared = append(declared, graph.AttributeDeclaration{EntityType: entityType, Attribute: attribute, DataType: dataType})
+	}
+	if err := g.SyncAttributeDeclarations(ctx, declared); err != nil {
+		t.Fatalf("failed to declare attributes: %v", err)
+	}
+
+	for _, e := range f.Entities {
+		createEntity(e.Ref, e.Properties)
+		entityType, id := splitRef(t, e.Ref)
+		for attribute, value := range e.Attributes {
+			if _, err := g.SetAttribute(ctx, entityType, id, attribute, value); err != nil {
+				t.Fatalf("failed to set %s.%s: %v", e.Ref, attribute, err)
+			}
+		}
+	}
+	for _, line := range f.Relations {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			t.Fatalf("relation %q is not in \"subject relation object\" form", line)
+		}
+		subjectType, subjectID := splitRef(t, fields[0])
+		createEntity(subjectType+":"+graph.SubjectEntityID(subjectID), nil)
+		createEntity(fields[2], nil)
+		objectType, objectID := splitRef(t, fields[2])
+		if _, err := g.CreateRelation(ctx, subjectType, subjectID, fields[1], objectType, objectID, nil, ""); err != nil {
+			t.Fatalf("failed to create relation %q: %v", line, err)
+		}
+	}
+
+	for entityType, permissions := range f.Permissions {
+		for name, condition := range permissions {
+			if _, err := g.AddPermissionDefinition(ctx, entityType, name, condition, ""); err != nil {
+				t.Fatalf("failed to define %s.%s: %v", entityType, name, err)
+			}
+		}
+	}
+	for i := range f.Rules {
+		if err := g.AddRule(ctx, &f.Rules[i]); err != nil {
+			t.Fatalf("failed to add rule %s: %v", f.Rules[i].Name, err)
+		}
+	}
+	if len(f.Derived) > 0 {
+		if err := g.SyncDerivedRelations(ctx, f.Derived); err != nil {
+			t.Fatalf("failed to add derived relations: %v", err)
+		}
+	}
+}
+
+// run checks every case through CheckPermission, which reads the stored
+// definition, and through DecideCondition for the reason
+func (f fixture) run(t *testing.T, g *graph.IdentityGraph) {
+	for _, c := range f.Checks {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("%s %s %s", c.Subject, c.Permission, c.Object)
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			subjectType, subjectID := splitRef(t, c.Subject)
+			objectType, objectID := splitRef(t, c.Object)
+
+			allowed, err := g.CheckPermission(ctx, subjectType, subjectID, c.Permission, objectType, objectID, c.Context)
+			if err != nil {
+				t.Fatalf("CheckPermission returned error: %v", err)
+			}
+			if allowed != c.Allowed {
+				t.Errorf("CheckPermission = %v, want %v", allowed, c.Allowed)
+			}
+
+			if c.Reason == "" {
+				return
+			}
+			condition := f.Permissions[objectType][c.Permission]
+			decision, err := g.DecideCondition(ctx, condition, subjectType, subjectID, objectType, objectID, c.Context)
+			if err != nil {
+				t.Fatalf("DecideCondition returned error: %v", err)
+			}
+			if decision.Reason != c.Reason {
+				t.Errorf("reason = %q, want %q", decision.Reason, c.Reason)
+			}
+		})
+	}
+}
+
+// TestFixtures runs every scenario in testdata against a fresh graph
+func TestFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 {
+		t.Fatal("no fixtures found in testdata")
+	}
+
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".yaml"), func(t *testing.T) {
+			f := readFixture(t, path)
+			g := newGraph(t)
+			f.load(t, g)
+			f.run(t, g)
+		})
+	}
+}
@@ -0,0 +1,334 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// maxRelationDepth is how many edges the indirect relation query follows
+const maxRelationDepth = 10
+
+// nestTeams writes a chain user:alice member team:t1 member team:t2 ... and
+// returns the outermost team
+func nestTeams(t *testing.T, f *fixture, depth int) string {
+	t.Helper()
+	f.Relations = append(f.Relations, "user:alice member team:t1")
+	for i := 1; i < depth; i++ {
+		f.Relations = append(f.Relations, fmt.Sprintf("team:t%d member team:t%d", i, i+1))
+	}
+	return fmt.Sprintf("team:t%d", depth)
+}
+
+func TestDeepNesting(t *testing.T) {
+	tests := []struct {
+		depth   int
+		allowed bool
+	}{
+		{1, true},
+		{maxRelationDepth, true},
+		{maxRelationDepth + 1, false},
+		{50, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("depth %d", tt.depth), func(t *testing.T) {
+			f := fixture{Permissions: map[string]map[string]string{
+				"team": {"view": "member or team.member"},
+			}}
+			outer := nestTeams(t, &f, tt.depth)
+			f.Checks = []checkCase{{Subject: "user:alice", Permission: "view", Object: outer, Allowed: tt.allowed}}
+
+			g := newGraph(t)
+			f.load(t, g)
+			f.run(t, g)
+		})
+	}
+}
+
+func TestLargeCycleTerminates(t *testing.T) {
+	f := fixture{Permissions: map[string]map[string]string{
+		"team": {"view": "team.member"},
+	}}
+	for i := 0; i < 25; i++ {
+		f.Relations = append(f.Relations, fmt.Sprintf("team:c%d member team:c%d", i, (i+1)%25))
+	}
+
+	g := newGraph(t)
+	f.load(t, g)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	allowed, err := g.CheckPermission(ctx, "user", "mallory", "view", "team", "c0", nil)
+	if err != nil {
+		t.Fatalf("CheckPermission returned error: %v", err)
+	}
+	if allowed {
+		t.Error("a user outside the cycle was allowed")
+	}
+}
+
+func TestStrictRelationDirection(t *testing.T) {
+	f := fixture{
+		Permissions: map[string]map[string]string{
+			"document": {"view": "owner"},
+		},
+		Relations: []string{
+			"user:alice owner document:forward",
+			"document:reversed owner user:alice",
+		},
+		Checks: []checkCase{
+			{Subject: "user:alice", Permission: "view", Object: "document:forward", Allowed: true},
+			{Subject: "user:alice", Permission: "view", Object: "document:reversed", Allowed: false},
+		},
+	}
+
+	g := newGraph(t)
+	f.load(t, g)
+	g.SetStrictRelationDirection([]string{"document"})
+	f.run(t, g)
+}
+
+func TestDeepOrganizationHierarchy(t *testing.T) {
+	tests := []struct {
+		levels  int
+		allowed bool
+	}{
+		{1, true},
+		{maxRelationDepth, true},
+		{maxRelationDepth + 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d levels", tt.levels), func(t *testing.T) {
+			f := fixture{Permissions: map[string]map[string]string{
+				"organization": {"view": "member or parent.view"},
+			}}
+			// user:alice is a member of o0, and each o(i) is the parent of o(i+1)
+			f.Relations = append(f.Relations, "user:alice member organization:o0")
+			for i := 0; i < tt.levels; i++ {
+				f.Relations = append(f.Relations, fmt.Sprintf("organization:o%d parent organization:o%d", i, i+1))
+			}
+			leaf := fmt.Sprintf("organization:o%d", tt.levels)
+			f.Checks = []checkCase{{Subject: "user:alice", Permission: "view", Object: leaf, Allowed: tt.allowed}}
+
+			g := newGraph(t)
+			f.load(t, g)
+			f.run(t, g)
+		})
+	}
+}
+
+func TestDeleteRelations(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	for _, r := range []struct{ subject, relation, object string }{
+		{"alice", "viewer", "d1"},
+		{"alice", "editor", "d1"},
+		{"alice", "viewer", "d2"},
+		{"bob", "viewer", "d1"},
+	} {
+		if _, err := g.CreateRelation(ctx, "user", r.subject, r.relation, "document", r.object, nil, ""); err != nil {
+			t.Fatalf("CreateRelation returned error: %v", err)
+		}
+	}
+
+	if _, err := g.DeleteRelations(ctx, graph.RelationFilter{}); err == nil {
+		t.Fatal("an empty filter should be refused")
+	}
+
+	deleted, err := g.DeleteRelations(ctx, graph.RelationFilter{
+		SubjectType: "user", SubjectID: "alice", ObjectType: "document", ObjectID: "d1",
+	})
+	if err != nil {
+		t.Fatalf("DeleteRelations returned error: %v", err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("deleted %d relations, want alice's 2 on d1", len(deleted))
+	}
+
+	remaining, err := g.GetRelations(ctx, "user", "alice")
+	if err != nil {
+		t.Fatalf("GetRelations returned error: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].ObjectID != "d2" {
+		t.Errorf("alice's remaining relations = %+v, want only d2", remaining)
+	}
+}
+
+func TestFindRelations(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	for _, r := range []struct{ subject, relation, source string }{
+		{"alice", "owner", "entity-sync"},
+		{"bob", "member", "entity-sync"},
+		{"carol", "member", "manual"},
+	} {
+		if _, err := g.CreateRelation(ctx, "user", r.subject, r.relation, "organization", "acme", nil, r.source); err != nil {
+			t.Fatalf("CreateRelation returned error: %v", err)
+		}
+	}
+
+	if _, err := g.FindRelations(ctx, graph.RelationFilter{}); err == nil {
+		t.Fatal("an empty filter should be refused")
+	}
+
+	found, err := g.FindRelations(ctx, graph.RelationFilter{
+		ObjectType: "organization", ObjectID: "acme", Source: "entity-sync",
+	})
+	if err != nil {
+		t.Fatalf("FindRelations returned error: %v", err)
+	}
+	if len(found) != 2 || found[0].SubjectID != "alice" || found[1].SubjectID != "bob" {
+		t.Errorf("found %+v, want alice's and bob's synced relations in order", found)
+	}
+}
+
+func TestDeleteEntity(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	for _, id := range []string{"alice", "bob"} {
+		if _, err := g.CreateEntity(ctx, "user", id, map[string]interface{}{}); err != nil {
+			t.Fatalf("CreateEntity returned error: %v", err)
+		}
+	}
+	if _, err := g.CreateEntity(ctx, "document", "d1", map[string]interface{}{}); err != nil {
+		t.Fatalf("CreateEntity returned error: %v", err)
+	}
+	for _, subject := range []string{"alice", "bob"} {
+		if _, err := g.CreateRelation(ctx, "user", subject, "viewer", "document", "d1", nil, ""); err != nil {
+			t.Fatalf("CreateRelation returned error: %v", err)
+		}
+	}
+
+	if _, err := g.DeleteEntity(ctx, "user", "carol", false); !errors.Is(err, graph.ErrEntityNotFound) {
+		t.Errorf("deleting a missing entity returned %v, want ErrEntityNotFound", err)
+	}
+	if _, err := g.DeleteEntity(ctx, "document", "d1", false); !errors.Is(err, graph.ErrEntityInUse) {
+		t.Fatalf("deleting an entity with relations returned %v, want ErrEntityInUse", err)
+	}
+	if _, err := g.GetEntity(ctx, "document", "d1"); err != nil {
+		t.Fatalf("a refused delete should keep the entity: %v", err)
+	}
+
+	deleted, err := g.DeleteEntity(ctx, "document", "d1", true)
+	if err != nil {
+		t.Fatalf("DeleteEntity returned error: %v", err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("cascade deleted %d relations, want 2", len(deleted))
+	}
+	if remaining, err := g.GetRelations(ctx, "user", "alice"); err != nil || len(remaining) != 0 {
+		t.Errorf("alice's relations after cascade = %+v (%v), want none", remaining, err)
+	}
+
+	if _, err := g.DeleteEntity(ctx, "user", "alice", false); err != nil {
+		t.Errorf("deleting an entity without relations returned %v", err)
+	}
+}
+
+func TestWriteRelations(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	if _, err := g.CreateRelation(ctx, "user", "bob", "viewer", "document", "d1", nil, ""); err != nil {
+		t.Fatalf("CreateRelation returned error: %v", err)
+	}
+
+	results, err := g.WriteRelations(ctx, []graph.RelationWrite{
+		{Op: graph.RelationCreate, SubjectType: "user", SubjectID: "alice", Relation: "viewer", ObjectType: "document", ObjectID: "d1"},
+		{Op: graph.RelationDelete, SubjectType: "user", SubjectID: "bob", Relation: "viewer", ObjectType: "document", ObjectID: "d1"},
+		{Op: graph.RelationDelete, SubjectType: "user", SubjectID: "carol", Relation: "viewer", ObjectType: "document", ObjectID: "d1"},
+	})
+	if err != nil {
+		t.Fatalf("WriteRelations returned error: %v", err)
+	}
+	if results[0].Relation == nil || results[1].Relation == nil || results[2].Relation != nil {
+		t.Errorf("results = %+v, want a created, a deleted and an unmatched relation", results)
+	}
+	if _, err := g.GetEntity(ctx, "user", "alice"); err != nil {
+		t.Errorf("the batch should have created alice as a stub entity: %v", err)
+	}
+
+	// A failing operation rolls back the ones before it
+	_, err = g.WriteRelations(ctx, []graph.RelationWrite{
+		{Op: graph.RelationCreate, SubjectType: "user", SubjectID: "dave", Relation: "viewer", ObjectType: "document", ObjectID: "d1"},
+		{Op: graph.RelationCreate, SubjectType: "user", SubjectID: "alice", Relation: "viewer", ObjectType: "document", ObjectID: "d1"},
+	})
+	var batchErr *graph.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, graph.ErrRelationExists) {
+		t.Fatalf("a duplicate create returned %v, want ErrRelationExists at operation 1", err)
+	}
+	if relations, err := g.GetRelations(ctx, "user", "dave"); err != nil || len(relations) != 0 {
+		t.Errorf("dave's relations after the rolled back batch = %+v (%v), want none", relations, err)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	entity, created, err := g.UpsertEntity(ctx, "user", "alice", map[string]interface{}{"name": "Alice"})
+	if err != nil || !created {
+		t.Fatalf("UpsertEntity of a new entity = %v, %v; want created", created, err)
+	}
+	updated, created, err := g.UpsertEntity(ctx, "user", "alice", map[string]interface{}{"name": "Alice B"})
+	if err != nil || created {
+		t.Fatalf("UpsertEntity of an existing entity = %v, %v; want updated", created, err)
+	}
+	if updated.ID != entity.ID || updated.Properties["name"] != "Alice B" {
+		t.Errorf("upserted entity = %+v, want entity %d with the new name", updated, entity.ID)
+	}
+
+	rel, created, err := g.UpsertRelation(ctx, "user", "alice", "viewer", "document", "d1",
+		map[string]interface{}{"source": "sync"}, "entity-sync")
+	if err != nil || !created {
+		t.Fatalf("UpsertRelation of a new relation = %v, %v; want created", created, err)
+	}
+	again, created, err := g.UpsertRelation(ctx, "user", "alice", "viewer", "document", "d1", nil, "")
+	if err != nil || created {
+		t.Fatalf("UpsertRelation of an existing relation = %v, %v; want existing", created, err)
+	}
+	if again.ID != rel.ID || again.Metadata["source"] != "sync" || again.Source != "entity-sync" {
+		t.Errorf("existing relation = %+v, want relation %d with its metadata and source", again, rel.ID)
+	}
+}
+
+func TestGetEntities(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	for _, id := range []string{"d1", "d2"} {
+		if _, err := g.CreateEntity(ctx, "document", id, map[string]interface{}{"title": id}); err != nil {
+			t.Fatalf("CreateEntity(%s) returned error: %v", id, err)
+		}
+	}
+
+	entities, err := g.GetEntities(ctx, []graph.EntityKey{
+		{Type: "document", ExternalID: "d1"},
+		{Type: "document", ExternalID: "d1"},
+		{Type: "document", ExternalID: "d2"},
+		{Type: "document", ExternalID: "missing"},
+		{Type: "folder", ExternalID: "d1"},
+	})
+	if err != nil {
+		t.Fatalf("GetEntities returned error: %v", err)
+	}
+	if len(entities) != 2 {
+		t.Fatalf("GetEntities returned %d entities, want 2", len(entities))
+	}
+	for _, entity := range entities {
+		if entity.Properties["title"] != entity.ExternalID {
+			t.Errorf("entity %s has properties %v", entity.ExternalID, entity.Properties)
+		}
+	}
+}
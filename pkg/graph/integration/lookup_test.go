@@ -0,0 +1,155 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+// lookupAll pages through LookupObjects, limit IDs at a time
+func lookupAll(t *testing.T, g *graph.IdentityGraph, condition, subject, objectType string, limit int) []string {
+	t.Helper()
+	subjectType, subjectID := splitRef(t, subject)
+
+	var ids []string
+	page := graph.LookupPage{Limit: limit}
+	for {
+		result, err := g.LookupObjects(context.Background(), condition, subjectType, subjectID, objectType, nil, page)
+		if err != nil {
+			t.Fatalf("LookupObjects returned error: %v", err)
+		}
+		if len(result.ObjectIDs) > limit {
+			t.Fatalf("page of %d IDs exceeds the limit of %d", len(result.ObjectIDs), limit)
+		}
+		ids = append(ids, result.ObjectIDs...)
+		if result.NextCursor == "" {
+			return ids
+		}
+		page.Cursor = result.NextCursor
+	}
+}
+
+func TestLookupObjects(t *testing.T) {
+	f := fixture{
+		Entities: []fixtureEntity{
+			{Ref: "document:public", Properties: map[string]interface{}{"public": true}},
+		},
+		Relations: []string{
+			"user:alice owner document:a",
+			"user:alice viewer document:b",
+			"user:alice viewer document:c",
+			"user:bob owner document:c",
+			"user:alice member team:t1",
+			"team:t1 parent document:d",
+			"user:bob viewer document:e",
+			"user:carol member group:eng",
+			"group:eng#member viewer document:f",
+		},
+	}
+	g := newGraph(t)
+	f.load(t, g)
+
+	tests := []struct {
+		name      string
+		condition string
+		subject   string
+		want      []string
+	}{
+		{"relation", "owner", "user:alice", []string{"a"}},
+		{"union", "owner or viewer", "user:alice", []string{"a", "b", "c"}},
+		{"intersection", "viewer and owner", "user:bob", nil},
+		{"path falls back to a scan", "viewer or parent.member", "user:alice", []string{"b", "c", "d"}},
+		{"attribute falls back to a scan", "public == true", "user:alice", []string{"public"}},
+		{"subject set", "viewer", "user:carol", []string{"f"}},
+		{"no access", "owner", "user:mallory", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Pages of one exercise the cursor on every result
+			for _, limit := range []int{1, graph.DefaultLookupLimit} {
+				got := lookupAll(t, g, tt.condition, tt.subject, "document", limit)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("limit %d: got %v, want %v", limit, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupSubjects(t *testing.T) {
+	f := fixture{
+		Entities: []fixtureEntity{
+			{Ref: "document:d1", Properties: map[string]interface{}{"public": true}},
+		},
+		Relations: []string{
+			"user:alice owner document:d1",
+			"user:bob viewer document:d1",
+			"user:alice viewer document:d1",
+			"document:d1 parent folder:f1",
+			"user:carol viewer folder:f1",
+			"user:dave member team:t1",
+			"team:t1 viewer document:d1",
+		},
+		Permissions: map[string]map[string]string{
+			"document": {"view": "owner or viewer or parent.view"},
+			"folder":   {"view": "viewer"},
+		},
+		Derived: []graph.DerivedRelation{
+			{EntityType: "document", Relation: "viewer", SubjectType: "guest", Attribute: "public"},
+		},
+	}
+	g := newGraph(t)
+	f.load(t, g)
+
+	ctx := context.Background()
+	condition := f.Permissions["document"]["view"]
+	result, err := g.LookupSubjects(ctx, condition, "document", "d1", "", nil, graph.LookupPage{})
+	if err != nil {
+		t.Fatalf("LookupSubjects returned error: %v", err)
+	}
+	want := []graph.LookupSubject{
+		{Type: "guest", ID: graph.AnySubjectID, Grants: []string{"viewer (derived from public)"}},
+		{Type: "team", ID: "t1", Grants: []string{"viewer"}},
+		{Type: "user", ID: "alice", Grants: []string{"owner", "viewer"}},
+		{Type: "user", ID: "bob", Grants: []string{"viewer"}},
+		{Type: "user", ID: "carol", Grants: []string{"parent -> folder:f1#view -> viewer"}},
+	}
+	if !reflect.DeepEqual(result.Subjects, want) {
+		t.Errorf("got %+v, want %+v", result.Subjects, want)
+	}
+
+	// Only users, a page at a time
+	var users []string
+	page := graph.LookupPage{Limit: 1}
+	for {
+		result, err := g.LookupSubjects(ctx, condition, "document", "d1", "user", nil, page)
+		if err != nil {
+			t.Fatalf("LookupSubjects returned error: %v", err)
+		}
+		for _, s := range result.Subjects {
+			users = append(users, s.ID)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		page.Cursor = result.NextCursor
+	}
+	if !reflect.DeepEqual(users, []string{"alice", "bob", "carol"}) {
+		t.Errorf("got users %v", users)
+	}
+
+	// A subject the relation reaches is still checked against the rest of
+	// the condition
+	result, err = g.LookupSubjects(ctx, "owner and viewer", "document", "d1", "", nil, graph.LookupPage{})
+	if err != nil {
+		t.Fatalf("LookupSubjects returned error: %v", err)
+	}
+	if len(result.Subjects) != 1 || result.Subjects[0].ID != "alice" {
+		t.Errorf("got %+v, want only alice", result.Subjects)
+	}
+}
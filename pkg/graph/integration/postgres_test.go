@@ -0,0 +1,126 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/jackc/pgx/v5"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+const (
+	databaseURLEnv  = "SUPRA_TEST_DATABASE_URL"
+	skipDatabaseEnv = "SUPRA_TEST_SKIP_DATABASE"
+	postgresImage   = "postgres:16-alpine"
+)
+
+// databaseURL is the migrated database every test runs against
+var databaseURL string
+
+func TestMain(m *testing.M) {
+	url, stop, err := startPostgres()
+	if err != nil {
+		// A missing database fails the run unless it was asked to be skipped,
+		// so CI can't pass without running a single test
+		if os.Getenv(skipDatabaseEnv) == "1" {
+			fmt.Fprintf(os.Stderr, "skipping graph integration tests: %v\n", err)
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "failed to start the test database (set %s=1 to skip): %v\n", skipDatabaseEnv, err)
+		os.Exit(1)
+	}
+
+	code := 1
+	if err := migrateAuthz(url); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate test database: %v\n", err)
+	} else {
+		databaseURL = url
+		code = m.Run()
+	}
+	stop()
+	os.Exit(code)
+}
+
+// startPostgres returns the URL of a database to test against and a function
+// that removes it
+func startPostgres() (url string, stop func(), err error) {
+	if url := os.Getenv(databaseURLEnv); url != "" {
+		return url, func() {}, nil
+	}
+	// testcontainers panics rather than failing when it finds no docker host
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("set %s or start docker: %v", databaseURLEnv, r)
+		}
+	}()
+
+	ctx := context.Background()
+	ctr, err := postgres.Run(ctx, postgresImage,
+		postgres.WithDatabase("supra_authz_test"),
+		postgres.WithPassword("supra"),
+		postgres.BasicWaitStrategies(),
+	)
+	stop = func() {
+		if err := testcontainers.TerminateContainer(ctr); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remove %s container: %v\n", postgresImage, err)
+		}
+	}
+	if err != nil {
+		stop()
+		return "", nil, fmt.Errorf("failed to start %s (set %s to use an existing database): %w", postgresImage, databaseURLEnv, err)
+	}
+
+	url, err = ctr.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		stop()
+		return "", nil, fmt.Errorf("failed to find the postgres address: %w", err)
+	}
+	return url, stop, nil
+}
+
+func migrateAuthz(url string) error {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return graph.Migrate(context.Background(), db)
+}
+
+// newGraph empties the graph tables and connects a fresh identity graph, so
+// no rule, statistic or row leaks between tests
+func newGraph(t *testing.T) *graph.IdentityGraph {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	_, err = conn.Exec(ctx, `
+		TRUNCATE entities, relations, permission_definitions, rule_definitions,
+			entity_attribute_history, derived_relations, relation_limits,
+			relation_declarations, attribute_declarations, entity_attributes,
+			tenant_rules, schema_versions
+		RESTART IDENTITY CASCADE
+	`)
+	conn.Close(ctx)
+	if err != nil {
+		t.Fatalf("failed to reset test database: %v", err)
+	}
+
+	g, err := graph.NewIdentityGraph(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("failed to create identity graph: %v", err)
+	}
+	t.Cleanup(g.Close)
+	return g
+}
@@ -0,0 +1,71 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+func TestSchemaVersionPinning(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	if _, err := g.AddPermissionDefinition(ctx, "document", "view", "owner", ""); err != nil {
+		t.Fatalf("AddPermissionDefinition returned error: %v", err)
+	}
+	v1, err := g.CurrentSchemaVersion(ctx)
+	if err != nil || v1 == 0 {
+		t.Fatalf("CurrentSchemaVersion = %d, %v; want a recorded version", v1, err)
+	}
+	if _, err := g.CreateEntity(ctx, "user", "alice", nil); err != nil {
+		t.Fatalf("CreateEntity returned error: %v", err)
+	}
+	if _, err := g.CreateEntity(ctx, "document", "d1", nil); err != nil {
+		t.Fatalf("CreateEntity returned error: %v", err)
+	}
+	if _, err := g.CreateRelation(ctx, "user", "alice", "viewer", "document", "d1", nil, ""); err != nil {
+		t.Fatalf("CreateRelation returned error: %v", err)
+	}
+
+	// Widen the permission in place, as a schema sync would
+	if _, err := g.AddPermissionDefinition(ctx, "document", "view", "owner or viewer", ""); err != nil {
+		t.Fatalf("AddPermissionDefinition returned error: %v", err)
+	}
+	v2, err := g.SnapshotSchema(ctx, "test")
+	if err != nil || v2 <= v1 {
+		t.Fatalf("SnapshotSchema = %d, %v; want a version after %d", v2, err, v1)
+	}
+	if again, err := g.SnapshotSchema(ctx, "test"); err != nil || again != v2 {
+		t.Errorf("SnapshotSchema of an unchanged model = %d, %v; want %d", again, err, v2)
+	}
+
+	for _, tc := range []struct {
+		version int
+		want    bool
+	}{
+		{v1, false},
+		{v2, true},
+	} {
+		allowed, err := g.CheckPermission(graph.WithSchemaVersion(ctx, tc.version), "user", "alice", "view", "document", "d1", nil)
+		if err != nil {
+			t.Fatalf("CheckPermission at version %d returned error: %v", tc.version, err)
+		}
+		if allowed != tc.want {
+			t.Errorf("CheckPermission at version %d = %v, want %v", tc.version, allowed, tc.want)
+		}
+	}
+
+	_, err = g.CheckPermission(graph.WithSchemaVersion(ctx, v2+100), "user", "alice", "view", "document", "d1", nil)
+	if !errors.Is(err, graph.ErrSchemaVersionNotFound) {
+		t.Errorf("CheckPermission at an unknown version: expected ErrSchemaVersionNotFound, got %v", err)
+	}
+
+	versions, err := g.SchemaVersions(ctx, 10)
+	if err != nil || len(versions) < 2 || versions[0].Version != v2 {
+		t.Errorf("SchemaVersions = %v, %v", versions, err)
+	}
+}
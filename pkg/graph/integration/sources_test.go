@@ -0,0 +1,60 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+func TestRelationSources(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	for _, id := range []string{"d1", "d2", "d3"} {
+		if _, err := g.CreateRelation(ctx, "user", "alice", "viewer", "document", id, nil, "import:batch-42"); err != nil {
+			t.Fatalf("CreateRelation(%s) returned error: %v", id, err)
+		}
+	}
+	manual, err := g.CreateRelation(ctx, "user", "bob", "viewer", "document", "d1", nil, "")
+	if err != nil {
+		t.Fatalf("CreateRelation without a source returned error: %v", err)
+	}
+	if manual.Source != graph.SourceManual {
+		t.Errorf("source = %q, want %q", manual.Source, graph.SourceManual)
+	}
+	if _, err := g.CreateRelation(ctx, "user", "bob", "viewer", "document", "d2", nil, "bad source"); !errors.Is(err, graph.ErrInvalidSource) {
+		t.Errorf("CreateRelation with an invalid source: expected ErrInvalidSource, got %v", err)
+	}
+
+	sources, err := g.RelationSources(ctx)
+	if err != nil {
+		t.Fatalf("RelationSources returned error: %v", err)
+	}
+	if len(sources) != 2 || sources[0].Source != "import:batch-42" || sources[0].Relations != 3 ||
+		sources[1].Source != graph.SourceManual || sources[1].Relations != 1 {
+		t.Errorf("sources = %+v, want import:batch-42 with 3 relations then manual with 1", sources)
+	}
+
+	deleted, err := g.DeleteSourceRelations(ctx, "import:batch-42", 2)
+	if err != nil {
+		t.Fatalf("DeleteSourceRelations returned error: %v", err)
+	}
+	if len(deleted) != 2 || deleted[0].ObjectID != "d1" || deleted[1].ObjectID != "d2" {
+		t.Errorf("first batch = %+v, want the relations on d1 and d2", deleted)
+	}
+	if deleted, err = g.DeleteSourceRelations(ctx, "import:batch-42", 2); err != nil || len(deleted) != 1 {
+		t.Errorf("second batch = %d relations, %v; want the last one", len(deleted), err)
+	}
+	if deleted, err = g.DeleteSourceRelations(ctx, "import:batch-42", 2); err != nil || len(deleted) != 0 {
+		t.Errorf("third batch = %d relations, %v; want none", len(deleted), err)
+	}
+
+	kept, err := g.GetRelations(ctx, "user", "bob")
+	if err != nil || len(kept) != 1 || kept[0].ID != manual.ID {
+		t.Errorf("relations of other sources = %+v, %v; want bob's manual relation kept", kept, err)
+	}
+}
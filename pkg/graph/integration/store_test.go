@@ -0,0 +1,58 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+	"github.com/jackc/pgx/v5"
+)
+
+// TestEmbeddedInTransaction runs a graph New built over a caller's
+// transaction: its writes are checked inside it and gone after a rollback
+func TestEmbeddedInTransaction(t *testing.T) {
+	ctx := context.Background()
+	pooled := newGraph(t)
+
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	defer conn.Close(ctx)
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin returned error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	g, err := graph.New(ctx, tx)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if _, err := g.AddPermissionDefinition(ctx, "document", "edit", "owner", ""); err != nil {
+		t.Fatalf("AddPermissionDefinition returned error: %v", err)
+	}
+	// A batch write runs in a savepoint of the transaction
+	if _, err := g.WriteRelations(ctx, []graph.RelationWrite{
+		{Op: graph.RelationCreate, SubjectType: "user", SubjectID: "alice", Relation: "owner", ObjectType: "document", ObjectID: "d1"},
+	}); err != nil {
+		t.Fatalf("WriteRelations returned error: %v", err)
+	}
+
+	allowed, err := g.CheckPermission(ctx, "user", "alice", "edit", "document", "d1", nil)
+	if err != nil || !allowed {
+		t.Errorf("CheckPermission in the transaction = %v, %v; want allowed", allowed, err)
+	}
+	if relations, err := pooled.GetRelations(ctx, "user", "alice"); err != nil || len(relations) != 0 {
+		t.Errorf("relations outside the transaction = %+v, %v; want none before commit", relations, err)
+	}
+
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback returned error: %v", err)
+	}
+	if relations, err := pooled.GetRelations(ctx, "user", "alice"); err != nil || len(relations) != 0 {
+		t.Errorf("relations after rollback = %+v, %v; want none", relations, err)
+	}
+}
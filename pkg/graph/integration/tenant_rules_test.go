@@ -0,0 +1,76 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dangerclosesec/supra/pkg/graph"
+)
+
+func TestTenantRules(t *testing.T) {
+	ctx := context.Background()
+	g := newGraph(t)
+
+	if err := g.AddRule(ctx, &graph.RuleDefinition{
+		Name:       "within_limit",
+		Parameters: []graph.RuleParameter{{Name: "amount", DataType: "integer"}},
+		Expression: "amount <= 100",
+	}); err != nil {
+		t.Fatalf("AddRule returned error: %v", err)
+	}
+	if _, err := g.AddPermissionDefinition(ctx, "invoice", "approve", "within_limit(request.amount)", ""); err != nil {
+		t.Fatalf("AddPermissionDefinition returned error: %v", err)
+	}
+	for tenant, id := range map[string]string{"acme": "i1", "globex": "i2"} {
+		if _, err := g.CreateEntity(ctx, "invoice", id, map[string]interface{}{"tenant": tenant}); err != nil {
+			t.Fatalf("CreateEntity(%s) returned error: %v", id, err)
+		}
+	}
+
+	if _, err := g.SetTenantRule(ctx, graph.TenantRule{
+		Tenant:     "acme",
+		Name:       "within_limit",
+		Parameters: []graph.RuleParameter{{Name: "amount", DataType: "integer"}},
+		Expression: "amount <= 1000",
+	}); err != nil {
+		t.Fatalf("SetTenantRule returned error: %v", err)
+	}
+
+	request := map[string]interface{}{"request": map[string]interface{}{"amount": 500}}
+	for _, tc := range []struct {
+		invoice string
+		want    bool
+	}{
+		{"i1", true},  // acme's own limit
+		{"i2", false}, // the schema's limit
+	} {
+		allowed, err := g.CheckPermission(ctx, "user", "alice", "approve", "invoice", tc.invoice, request)
+		if err != nil {
+			t.Fatalf("CheckPermission(%s) returned error: %v", tc.invoice, err)
+		}
+		if allowed != tc.want {
+			t.Errorf("CheckPermission(%s) = %v, want %v", tc.invoice, allowed, tc.want)
+		}
+	}
+
+	// The rule survives a reload and is gone once deleted
+	if err := g.ReloadTenantRules(ctx); err != nil {
+		t.Fatalf("ReloadTenantRules returned error: %v", err)
+	}
+	if rules := g.TenantRules("acme"); len(rules) != 1 || rules[0].Expression != "amount <= 1000" {
+		t.Errorf("TenantRules(acme) = %v", rules)
+	}
+	if err := g.DeleteTenantRule(ctx, "acme", "within_limit"); err != nil {
+		t.Fatalf("DeleteTenantRule returned error: %v", err)
+	}
+	if err := g.DeleteTenantRule(ctx, "acme", "within_limit"); !errors.Is(err, graph.ErrTenantRuleNotFound) {
+		t.Errorf("second DeleteTenantRule: expected ErrTenantRuleNotFound, got %v", err)
+	}
+	allowed, err := g.CheckPermission(ctx, "user", "alice", "approve", "invoice", "i1", request)
+	if err != nil || allowed {
+		t.Errorf("CheckPermission(i1) after delete = %v, %v; want false", allowed, err)
+	}
+}
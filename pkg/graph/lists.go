@@ -0,0 +1,63 @@
+package graph
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// toList returns the elements of a slice value, whether it was decoded from
+// JSON ([]interface{}) or passed in by a Go caller ([]string, []int, ...)
+func toList(value interface{}) ([]interface{}, bool) {
+	if list, ok := value.([]interface{}); ok {
+		return list, true
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	list := make([]interface{}, v.Len())
+	for i := range list {
+		list[i] = v.Index(i).Interface()
+	}
+	return list, true
+}
+
+// memberOf reports whether value equals an element of list. Numbers compare
+// by value, so 3 is in [1.0, 3.0].
+func (g *IdentityGraph) memberOf(value, list interface{}) (bool, error) {
+	items, ok := toList(list)
+	if !ok {
+		return false, fmt.Errorf("right side of in must be a list, got %T", list)
+	}
+	for _, item := range items {
+		if equal, err := g.compareValues(item, tokenEQ, value); err == nil && equal {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// quantify compares each element of list against right
+func (g *IdentityGraph) quantify(quantifier tokenType, list interface{}, op tokenType, right interface{}) (bool, error) {
+	items, ok := toList(list)
+	if !ok {
+		return false, fmt.Errorf("quantified value must be a list, got %T", list)
+	}
+
+	for _, item := range items {
+		matched, err := g.compareValues(item, op, right)
+		if err != nil {
+			return false, err
+		}
+		if quantifier == tokenAny && matched {
+			return true, nil
+		}
+		if quantifier == tokenAll && !matched {
+			return false, nil
+		}
+	}
+
+	// any found no match; all matched every element, provided there was one
+	return quantifier == tokenAll && len(items) > 0, nil
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListConditions(t *testing.T) {
+	g := &IdentityGraph{ruleCache: map[string]*RuleDefinition{
+		"allPassing": {
+			Name:       "allPassing",
+			Parameters: []RuleParameter{{Name: "scores", DataType: "integer[]"}, {Name: "threshold", DataType: "integer"}},
+			Expression: "all scores >= threshold",
+		},
+		"inFinance": {
+			Name:       "inFinance",
+			Parameters: []RuleParameter{{Name: "departments", DataType: "string[]"}},
+			Expression: `"finance" in departments`,
+		},
+	}}
+
+	contextData := map[string]interface{}{
+		"request": map[string]interface{}{
+			"departments": []interface{}{"finance", "ops"},
+			"scores":      []interface{}{70.0, 85.0, 90.0},
+			"empty":       []interface{}{},
+			"threshold":   60.0,
+			"department":  "ops",
+		},
+	}
+
+	tests := []struct {
+		condition string
+		allowed   bool
+		reason    string
+	}{
+		{`"finance" in request.departments`, true, ReasonMatchedCondition},
+		{`"legal" in request.departments`, false, ReasonDeniedByCondition},
+		{`request.department in request.departments`, true, ReasonMatchedCondition},
+		{`any request.scores > 95`, false, ReasonDeniedByCondition},
+		{`any request.scores >= request.threshold`, true, ReasonMatchedCondition},
+		{`all request.scores >= request.threshold`, true, ReasonMatchedCondition},
+		{`all request.departments == "finance"`, false, ReasonDeniedByCondition},
+		{`all request.empty == "finance"`, false, ReasonDeniedByCondition},
+		{`any request.empty == "finance"`, false, ReasonDeniedByCondition},
+		{`allPassing(request.scores, request.threshold)`, true, "matched_rule:allPassing"},
+		{`inFinance(request.departments)`, true, "matched_rule:inFinance"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			decision, err := g.DecideCondition(context.Background(), tt.condition, "user", "alice", "document", "plan", contextData)
+			if err != nil {
+				t.Fatalf("DecideCondition(%q) returned error: %v", tt.condition, err)
+			}
+			if decision.Allowed != tt.allowed || decision.Reason != tt.reason {
+				t.Errorf("DecideCondition(%q) = %+v, want allowed=%v reason=%q", tt.condition, decision, tt.allowed, tt.reason)
+			}
+		})
+	}
+
+	if _, err := g.DecideCondition(context.Background(), `"ops" in request.department`, "user", "alice", "document", "plan", contextData); err == nil {
+		t.Error("in should fail when the right side is not a list")
+	}
+}
+
+func TestEvaluateRuleWithGoSlices(t *testing.T) {
+	g := &IdentityGraph{ruleCache: map[string]*RuleDefinition{
+		"hasRole": {Name: "hasRole", Expression: `role in roles`},
+	}}
+
+	allowed, err := g.EvaluateRule(context.Background(), "hasRole", map[string]interface{}{
+		"role":  "admin",
+		"roles": []string{"viewer", "admin"},
+	})
+	if err != nil || !allowed {
+		t.Errorf("EvaluateRule() = %v, %v; want true, nil", allowed, err)
+	}
+}
+
+func TestParseListExpressions(t *testing.T) {
+	tests := map[string]string{
+		`"finance" in request.departments`:              `"finance" in request.departments`,
+		`all request.scores >= 50 and request.approved`: `(all request.scores >= 50 and request.approved)`,
+		`any request.tags == "urgent" or owner`:         `(any request.tags == "urgent" or owner)`,
+	}
+	for input, want := range tests {
+		expr, err := NewConditionParser(input).Parse()
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", input, err)
+		}
+		if got := expr.String(); got != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", input, got, want)
+		}
+	}
+
+	if _, err := NewConditionParser(`any request.tags`).Parse(); err == nil {
+		t.Error("a quantifier without a comparison should not parse")
+	}
+}
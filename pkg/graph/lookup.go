@@ -0,0 +1,507 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lookup page sizes
+const (
+	DefaultLookupLimit = 100
+	MaxLookupLimit     = 1000
+)
+
+// lookupScanBatch is how many entities are read at a time when a condition
+// can't be narrowed to the subject's relations and every entity of the type
+// has to be checked
+const lookupScanBatch = 500
+
+// LookupPage selects a page of lookup results. Cursor is the NextCursor of
+// the previous page, empty for the first.
+type LookupPage struct {
+	Cursor string
+	Limit  int
+}
+
+// LookupResult is a page of the objects a subject has a permission on,
+// ordered by ID. NextCursor is empty on the last page.
+type LookupResult struct {
+	ObjectIDs  []string `json:"object_ids"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// LookupObjects lists the objects of objectType on which the condition
+// grants the subject a permission. Relations in the condition are expanded
+// in reverse, from the subject to the objects it is related to, and every
+// candidate is then checked, so results always agree with DecideCondition.
+// Conditions that can't be expanded that way, such as a rule or attribute
+// on its own, fall back to checking each entity of the type.
+func (g *IdentityGraph) LookupObjects(ctx context.Context, conditionExpr,
+	subjectType, subjectID, objectType string, contextData map[string]interface{}, page LookupPage) (LookupResult, error) {
+
+	expr, err := NewConditionParser(conditionExpr).Parse()
+	if err != nil {
+		return LookupResult{}, fmt.Errorf("failed to parse condition: %w", err)
+	}
+	expr = g.planExpression(expr, objectType)
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultLookupLimit
+	}
+	limit = min(limit, MaxLookupLimit)
+
+	candidates, narrowed, err := g.lookupCandidates(ctx, expr, subjectType, subjectID, objectType)
+	if err != nil {
+		return LookupResult{}, err
+	}
+
+	var result LookupResult
+	allowed := func(ids []string) (bool, error) {
+		for _, id := range ids {
+			d, err := g.decideExpression(ctx, expr, subjectType, subjectID, objectType, id, contextData)
+			if err != nil {
+				return false, fmt.Errorf("failed to check %s:%s: %w", objectType, id, err)
+			}
+			if !d.Allowed {
+				continue
+			}
+			if len(result.ObjectIDs) == limit {
+				// Another match exists, so there is a next page
+				result.NextCursor = result.ObjectIDs[limit-1]
+				return true, nil
+			}
+			result.ObjectIDs = append(result.ObjectIDs, id)
+		}
+		return false, nil
+	}
+
+	if narrowed {
+		ids := make([]string, 0, len(candidates))
+		for id := range candidates {
+			if id > page.Cursor {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		if _, err := allowed(ids); err != nil {
+			return LookupResult{}, err
+		}
+		return result, nil
+	}
+
+	cursor := page.Cursor
+	for {
+		ids, err := g.entityIDsAfter(ctx, objectType, cursor, lookupScanBatch)
+		if err != nil {
+			return LookupResult{}, err
+		}
+		full, err := allowed(ids)
+		if err != nil {
+			return LookupResult{}, err
+		}
+		if full || len(ids) < lookupScanBatch {
+			return result, nil
+		}
+		cursor = ids[len(ids)-1]
+	}
+}
+
+// lookupCandidates returns the objects a condition could grant the subject
+// access to. narrowed is false when any object of the type could qualify.
+func (g *IdentityGraph) lookupCandidates(ctx context.Context, expr Expression,
+	subjectType, subjectID, objectType string) (map[string]bool, bool, error) {
+
+	switch e := expr.(type) {
+	case *AndExpression:
+		left, leftNarrowed, err := g.lookupCandidates(ctx, e.Left, subjectType, subjectID, objectType)
+		if err != nil {
+			return nil, false, err
+		}
+		right, rightNarrowed, err := g.lookupCandidates(ctx, e.Right, subjectType, subjectID, objectType)
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case leftNarrowed && rightNarrowed:
+			for id := range left {
+				if !right[id] {
+					delete(left, id)
+				}
+			}
+			return left, true, nil
+		case leftNarrowed:
+			return left, true, nil
+		default:
+			return right, rightNarrowed, nil
+		}
+
+	case *OrExpression:
+		left, leftNarrowed, err := g.lookupCandidates(ctx, e.Left, subjectType, subjectID, objectType)
+		if err != nil || !leftNarrowed {
+			return nil, false, err
+		}
+		right, rightNarrowed, err := g.lookupCandidates(ctx, e.Right, subjectType, subjectID, objectType)
+		if err != nil || !rightNarrowed {
+			return nil, false, err
+		}
+		for id := range right {
+			left[id] = true
+		}
+		return left, true, nil
+
+	case *RelationExpression:
+		// Paths may read attributes or inherit a related entity's
+		// permission, derived relations hold without tuples and declared
+		// attributes aren't relations at all
+		if e.RelationPath != "" || g.hasDerivedRelation(subjectType, e.RelationName, objectType) ||
+			g.declaresAttribute(objectType, e.RelationName) {
+			return nil, false, nil
+		}
+		ids, err := g.relatedObjectIDs(ctx, subjectType, subjectID, e.RelationName, objectType)
+		return ids, err == nil, err
+
+	default:
+		// Conditions and negations hold for objects no tuple names, like
+		// "not banned" for every object the subject isn't banned from
+		return nil, false, nil
+	}
+}
+
+// hasDerivedRelation reports whether attributes of objectType can give
+// subjects of subjectType the relation
+func (g *IdentityGraph) hasDerivedRelation(subjectType, relation, objectType string) bool {
+	g.derivedMu.RLock()
+	defer g.derivedMu.RUnlock()
+	for _, d := range g.derived[derivedKey{objectType, relation}] {
+		if d.SubjectType == subjectType {
+			return true
+		}
+	}
+	return false
+}
+
+// relatedObjectIDs returns the objects of objectType the subject has the
+// relation with, in whichever directions checkDirectRelation accepts. Every
+// object granting the relation to a subject set is a candidate too, as
+// finding the sets the subject belongs to would take a check each.
+func (g *IdentityGraph) relatedObjectIDs(ctx context.Context,
+	subjectType, subjectID, relation, objectType string) (map[string]bool, error) {
+
+	query := `
+		SELECT object_id FROM relations
+		WHERE subject_type = $1 AND subject_id = $2 AND relation = $3 AND object_type = $4
+		UNION
+		SELECT subject_id FROM relations
+		WHERE object_type = $1 AND object_id = $2 AND relation = $3 AND subject_type = $4
+		UNION
+		SELECT object_id FROM relations
+		WHERE relation = $3 AND object_type = $4 AND subject_id LIKE '%#%'`
+	if g.strictRelationDirection(objectType) {
+		query = `
+			SELECT object_id FROM relations
+			WHERE subject_type = $1 AND subject_id = $2 AND relation = $3 AND object_type = $4
+			UNION
+			SELECT object_id FROM relations
+			WHERE relation = $3 AND object_type = $4 AND subject_id LIKE '%#%'`
+	}
+
+	rows, err := g.store.Query(ctx, query, subjectType, subjectID, relation, objectType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find related objects: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan related object: %w", err)
+		}
+		ids[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find related objects: %w", err)
+	}
+	return ids, nil
+}
+
+// entityIDsAfter returns up to limit IDs of entities of entityType that
+// sort after cursor
+func (g *IdentityGraph) entityIDsAfter(ctx context.Context, entityType, cursor string, limit int) ([]string, error) {
+	rows, err := g.store.Query(ctx, `
+		SELECT external_id FROM entities
+		WHERE type = $1 AND external_id > $2
+		ORDER BY external_id
+		LIMIT $3
+	`, entityType, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entities: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan entity: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list entities: %w", err)
+	}
+	return ids, nil
+}
+
+// AnySubjectID stands for every subject of a type in LookupSubjects
+// results, when a derived relation grants the permission from the object's
+// attributes rather than to particular subjects
+const AnySubjectID = "*"
+
+// LookupSubject is a subject holding a permission. Grants lists the
+// relations that connect it to the object, one path each: a relation name
+// for a direct relation, and hops separated by " -> " for one reached
+// through a related entity, e.g. "parent -> folder:f1#view -> viewer".
+type LookupSubject struct {
+	Type   string   `json:"type"`
+	ID     string   `json:"id"`
+	Grants []string `json:"grants"`
+}
+
+// LookupSubjectsResult is a page of the subjects holding a permission on an
+// object, ordered by type and ID. NextCursor is empty on the last page.
+type LookupSubjectsResult struct {
+	Subjects   []LookupSubject `json:"subjects"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// LookupSubjects lists the subjects the condition grants a permission on
+// the object, limited to subjectType when it is set. Candidates are the
+// subjects the condition's relations connect to the object, directly or
+// through related entities and the permissions they define, and each is
+// then checked, so a subject that also needs a rule or attribute to hold is
+// only listed when it does. Subjects a condition admits without any
+// relation, such as through a rule alone, can't be enumerated and are not
+// listed.
+func (g *IdentityGraph) LookupSubjects(ctx context.Context, conditionExpr,
+	objectType, objectID, subjectType string, contextData map[string]interface{}, page LookupPage) (LookupSubjectsResult, error) {
+
+	expr, err := NewConditionParser(conditionExpr).Parse()
+	if err != nil {
+		return LookupSubjectsResult{}, fmt.Errorf("failed to parse condition: %w", err)
+	}
+	expr = g.planExpression(expr, objectType)
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultLookupLimit
+	}
+	limit = min(limit, MaxLookupLimit)
+
+	grants := make(map[entityRef][]string)
+	memo := inheritanceFrom(context.Background()).memo
+	if err := g.subjectGrants(ctx, expr, objectType, objectID, "", 0, memo, make(map[string]bool), grants); err != nil {
+		return LookupSubjectsResult{}, err
+	}
+
+	var cursor entityRef
+	if page.Cursor != "" {
+		cursor.Type, cursor.ID, _ = strings.Cut(page.Cursor, ":")
+	}
+	candidates := make([]entityRef, 0, len(grants))
+	for ref := range grants {
+		if subjectType != "" && ref.Type != subjectType {
+			continue
+		}
+		if page.Cursor != "" && !refAfter(ref, cursor) {
+			continue
+		}
+		candidates = append(candidates, ref)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return refAfter(candidates[j], candidates[i]) })
+
+	var result LookupSubjectsResult
+	for _, ref := range candidates {
+		d, err := g.decideExpression(ctx, expr, ref.Type, ref.ID, objectType, objectID, contextData)
+		if err != nil {
+			return LookupSubjectsResult{}, fmt.Errorf("failed to check %s: %w", ref, err)
+		}
+		if !d.Allowed {
+			continue
+		}
+		if len(result.Subjects) == limit {
+			last := result.Subjects[limit-1]
+			result.NextCursor = last.Type + ":" + last.ID
+			break
+		}
+		paths := grants[ref]
+		sort.Strings(paths)
+		result.Subjects = append(result.Subjects, LookupSubject{Type: ref.Type, ID: ref.ID, Grants: paths})
+	}
+	return result, nil
+}
+
+// refAfter reports whether a sorts after b, by type and then ID
+func refAfter(a, b entityRef) bool {
+	if a.Type != b.Type {
+		return a.Type > b.Type
+	}
+	return a.ID > b.ID
+}
+
+// subjectGrants adds the subjects the relations in expr connect to the
+// object to grants, each path prefixed by how the object was reached.
+// References like parent.view follow the parent's own view condition, as
+// decideInherited does, up to maxInheritanceDepth.
+func (g *IdentityGraph) subjectGrants(ctx context.Context, expr Expression, objectType, objectID, prefix string,
+	depth int, memo *inheritanceMemo, visited map[string]bool, grants map[entityRef][]string) error {
+
+	switch e := expr.(type) {
+	case *AndExpression:
+		if err := g.subjectGrants(ctx, e.Left, objectType, objectID, prefix, depth, memo, visited, grants); err != nil {
+			return err
+		}
+		return g.subjectGrants(ctx, e.Right, objectType, objectID, prefix, depth, memo, visited, grants)
+
+	case *OrExpression:
+		if err := g.subjectGrants(ctx, e.Left, objectType, objectID, prefix, depth, memo, visited, grants); err != nil {
+			return err
+		}
+		return g.subjectGrants(ctx, e.Right, objectType, objectID, prefix, depth, memo, visited, grants)
+
+	case *RelationExpression:
+		if e.RelationPath == "" {
+			return g.relatedSubjects(ctx, e.RelationName, objectType, objectID, prefix, grants)
+		}
+
+		related, err := g.relatedEntities(ctx, e.RelationPath, objectType, objectID)
+		if err != nil {
+			return err
+		}
+		for _, ref := range related {
+			hop := prefix + e.RelationPath + " -> " + ref.String()
+			condition, ok, err := g.permissionCondition(ctx, memo, ref.Type, e.RelationName)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// A relation on the related entity, as in team.member
+				if err := g.relatedSubjects(ctx, e.RelationName, ref.Type, ref.ID, hop+" -> ", grants); err != nil {
+					return err
+				}
+				continue
+			}
+
+			key := ref.String() + "#" + e.RelationName
+			if visited[key] || depth >= maxInheritanceDepth {
+				continue
+			}
+			visited[key] = true
+			inherited, err := NewConditionParser(condition).Parse()
+			if err != nil {
+				return fmt.Errorf("failed to parse condition of %s.%s: %w", ref.Type, e.RelationName, err)
+			}
+			err = g.subjectGrants(ctx, g.planExpression(inherited, ref.Type), ref.Type, ref.ID,
+				hop+"#"+e.RelationName+" -> ", depth+1, memo, visited, grants)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// relatedSubject is a subject holding a relation on an entity. derivedFrom
+// names the attribute when a derived relation grants it to every subject
+// of the type.
+type relatedSubject struct {
+	ref         entityRef
+	derivedFrom string
+}
+
+// relationSubjects returns the subjects holding the relation on an entity,
+// in whichever directions checkDirectRelation accepts, and a wildcard
+// subject for each type a derived relation currently grants it to
+func (g *IdentityGraph) relationSubjects(ctx context.Context, relation, objectType, objectID string) ([]relatedSubject, error) {
+	query := `
+		SELECT subject_type, subject_id FROM relations
+		WHERE object_type = $1 AND object_id = $2 AND relation = $3
+		UNION
+		SELECT object_type, object_id FROM relations
+		WHERE subject_type = $1 AND subject_id = $2 AND relation = $3`
+	if g.strictRelationDirection(objectType) {
+		query = `
+			SELECT subject_type, subject_id FROM relations
+			WHERE object_type = $1 AND object_id = $2 AND relation = $3`
+	}
+
+	rows, err := g.store.Query(ctx, query, objectType, objectID, relation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find related subjects: %w", err)
+	}
+	defer rows.Close()
+
+	var subjects []relatedSubject
+	for rows.Next() {
+		var s relatedSubject
+		if err := rows.Scan(&s.ref.Type, &s.ref.ID); err != nil {
+			return nil, fmt.Errorf("failed to scan related subject: %w", err)
+		}
+		subjects = append(subjects, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find related subjects: %w", err)
+	}
+
+	g.derivedMu.RLock()
+	derived := g.derived[derivedKey{objectType, relation}]
+	g.derivedMu.RUnlock()
+	for _, d := range derived {
+		value, err := g.getEntityAttribute(ctx, objectType, objectID, d.Attribute)
+		if errors.Is(err, ErrAttributeNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if derivedValueMatches(d, value) {
+			subjects = append(subjects, relatedSubject{
+				ref:         entityRef{Type: d.SubjectType, ID: AnySubjectID},
+				derivedFrom: d.Attribute,
+			})
+		}
+	}
+	return subjects, nil
+}
+
+// relatedSubjects adds the subjects holding the relation on an entity to
+// grants
+func (g *IdentityGraph) relatedSubjects(ctx context.Context, relation, objectType, objectID, prefix string,
+	grants map[entityRef][]string) error {
+
+	subjects, err := g.relationSubjects(ctx, relation, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	for _, s := range subjects {
+		grant := prefix + relation
+		if s.derivedFrom != "" {
+			grant += " (derived from " + s.derivedFrom + ")"
+		}
+		grants[s.ref] = appendUnique(grants[s.ref], grant)
+	}
+	return nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,117 @@
+package graph
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Caches the graph counts lookups of
+const (
+	// CacheRules is the rule definitions rule references evaluate
+	CacheRules = "rules"
+	// CacheSchemaVersions is the snapshots of schema versions checks are
+	// pinned to
+	CacheSchemaVersions = "schema_versions"
+	// CacheInheritance is the permission definitions looked up while a
+	// check climbs a hierarchy, as in parent.view. It lives for one check,
+	// so hits are lookups an ancestor reached along another path saved.
+	CacheInheritance = "inheritance"
+)
+
+// Caches lists the caches counted in Stats
+var Caches = []string{CacheRules, CacheSchemaVersions, CacheInheritance}
+
+// MaxWalkDepth is the deepest a check dereferences subject sets or climbs
+// inherited permissions
+const MaxWalkDepth = max(maxSubjectSetDepth, maxInheritanceDepth)
+
+// CacheStats counts the lookups of one cache
+type CacheStats struct {
+	Cache  string `json:"cache"`
+	Hits   int64  `json:"hits"`
+	Misses int64  `json:"misses"`
+}
+
+// Stats counts cache lookups and how deep checks recursed
+type Stats struct {
+	Caches []CacheStats `json:"caches"`
+	// Depths counts checks by the deepest level of subject sets or
+	// inherited permissions they reached, indexed by depth; checks
+	// answered without either are at 0
+	Depths []int64 `json:"depths"`
+}
+
+// graphMetrics holds the counts behind Stats. The zero value is ready.
+type graphMetrics struct {
+	hits   [3]atomic.Int64 // indexed like Caches
+	misses [3]atomic.Int64
+	depths [MaxWalkDepth + 1]atomic.Int64
+}
+
+// Stats returns the cache lookups and check depths counted since start
+func (g *IdentityGraph) Stats() Stats {
+	m := &g.metrics
+	stats := Stats{
+		Caches: make([]CacheStats, len(Caches)),
+		Depths: make([]int64, len(m.depths)),
+	}
+	for i, cache := range Caches {
+		stats.Caches[i] = CacheStats{Cache: cache, Hits: m.hits[i].Load(), Misses: m.misses[i].Load()}
+	}
+	for depth := range m.depths {
+		stats.Depths[depth] = m.depths[depth].Load()
+	}
+	return stats
+}
+
+// recordCacheLookup counts a lookup of cache
+func (g *IdentityGraph) recordCacheLookup(cache string, hit bool) {
+	for i, name := range Caches {
+		if name == cache {
+			if hit {
+				g.metrics.hits[i].Add(1)
+			} else {
+				g.metrics.misses[i].Add(1)
+			}
+			return
+		}
+	}
+}
+
+type walkDepthKey struct{}
+
+// walkDepth is the deepest level a check has reached. The operands of a
+// parallel "or" share it.
+type walkDepth struct {
+	deepest atomic.Int64
+}
+
+// startWalk gives a check somewhere to note how deep it goes. ok is false
+// when ctx is already part of a check, which records the depth instead.
+func startWalk(ctx context.Context) (context.Context, *walkDepth, bool) {
+	if w, ok := ctx.Value(walkDepthKey{}).(*walkDepth); ok {
+		return ctx, w, false
+	}
+	w := &walkDepth{}
+	return context.WithValue(ctx, walkDepthKey{}, w), w, true
+}
+
+// reachedDepth notes that the check in ctx got depth levels down
+func reachedDepth(ctx context.Context, depth int) {
+	w, ok := ctx.Value(walkDepthKey{}).(*walkDepth)
+	if !ok {
+		return
+	}
+	for {
+		deepest := w.deepest.Load()
+		if int64(depth) <= deepest || w.deepest.CompareAndSwap(deepest, int64(depth)) {
+			return
+		}
+	}
+}
+
+// recordWalk counts a finished check under the deepest level it reached
+func (g *IdentityGraph) recordWalk(w *walkDepth) {
+	depth := min(int(w.deepest.Load()), MaxWalkDepth)
+	g.metrics.depths[depth].Add(1)
+}
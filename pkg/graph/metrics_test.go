@@ -0,0 +1,53 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsCountCacheLookups(t *testing.T) {
+	g := &IdentityGraph{}
+	g.recordCacheLookup(CacheRules, true)
+	g.recordCacheLookup(CacheRules, false)
+	g.recordCacheLookup(CacheInheritance, true)
+	g.recordCacheLookup("unknown", true)
+
+	stats := g.Stats()
+	assert.Equal(t, []CacheStats{
+		{Cache: CacheRules, Hits: 1, Misses: 1},
+		{Cache: CacheSchemaVersions},
+		{Cache: CacheInheritance, Hits: 1},
+	}, stats.Caches)
+}
+
+func TestStatsCountWalkDepths(t *testing.T) {
+	g := &IdentityGraph{}
+
+	ctx, walk, outermost := startWalk(context.Background())
+	require.True(t, outermost)
+	_, same, outermost := startWalk(ctx)
+	assert.False(t, outermost, "a check within a check is counted once")
+	assert.Same(t, walk, same)
+
+	root := inheritanceFrom(ctx)
+	inner := root.push(ctx, "organization:sales#view")
+	inheritanceFrom(inner).push(inner, "organization:acme#view")
+	reachedDepth(ctx, 1)
+	g.recordWalk(walk)
+
+	// Without subject sets or inheritance a check is at depth 0
+	d, err := g.DecideCondition(context.Background(), "request.ticket", "user", "alice", "doc", "1",
+		map[string]interface{}{"request": map[string]interface{}{"ticket": "INC-7"}})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+
+	stats := g.Stats()
+	require.Len(t, stats.Depths, MaxWalkDepth+1)
+	assert.Equal(t, int64(1), stats.Depths[0])
+	assert.Equal(t, int64(1), stats.Depths[2])
+
+	reachedDepth(context.Background(), 3) // outside a check, ignored
+}
@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseNot(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      string
+	}{
+		{"not banned", "(not banned)"},
+		{"editor and not banned", "(editor and (not banned))"},
+		{"not banned and editor", "((not banned) and editor)"},
+		{"not editor or viewer", "((not editor) or viewer)"},
+		{"not (editor or viewer)", "(not (editor or viewer))"},
+		{"not not banned", "(not (not banned))"},
+		{"NOT banned", "(not banned)"},
+		{"owner or editor and not banned", "(owner or (editor and (not banned)))"},
+		{"not subject.level >= 3", "(not subject.level >= 3)"},
+		{`not "admin" in subject.roles`, `(not "admin" in subject.roles)`},
+		{"not organization.suspended", "(not organization.suspended)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			expr, err := NewConditionParser(tt.condition).Parse()
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.condition, err)
+			}
+			if got := expr.String(); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.condition, got, tt.want)
+			}
+		})
+	}
+
+	for _, condition := range []string{"not", "editor and not", "editor not banned"} {
+		if _, err := NewConditionParser(condition).Parse(); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", condition)
+		}
+	}
+}
+
+func TestDecideNot(t *testing.T) {
+	g := &IdentityGraph{ruleCache: map[string]*RuleDefinition{
+		"withinLimit": {
+			Name:       "withinLimit",
+			Parameters: []RuleParameter{{Name: "amount", DataType: "number"}, {Name: "limit", DataType: "number"}},
+			Expression: "not amount > limit",
+		},
+	}}
+
+	contextData := map[string]interface{}{
+		"request": map[string]interface{}{
+			"approved": true,
+			"amount":   50.0,
+			"large":    500.0,
+			"limit":    100.0,
+		},
+	}
+
+	tests := []struct {
+		condition string
+		allowed   bool
+		reason    string
+	}{
+		{"not request.missing", true, ReasonMatchedNegation},
+		{"not request.approved", false, ReasonDeniedByExclusion},
+		{"not not request.approved", true, ReasonMatchedNegation},
+		{"request.approved and not request.missing", true, ReasonMatchedNegation},
+		{"request.approved and not request.approved", false, ReasonDeniedByExclusion},
+		{"not request.approved or request.approved", true, ReasonMatchedContext},
+		{"not (request.approved or request.missing)", false, ReasonDeniedByExclusion},
+		{"not request.amount > request.limit", true, ReasonMatchedNegation},
+		{"withinLimit(request.amount, request.limit)", true, "matched_rule:withinLimit"},
+		{"withinLimit(request.large, request.limit)", false, "denied_by_rule:withinLimit"},
+		{"not withinLimit(request.large, request.limit)", true, ReasonMatchedNegation},
+		// The relations would need a database; reaching them would fail
+		{"request.missing and not banned", false, ReasonDeniedMissingContext},
+		{"not request.missing or not banned", true, ReasonMatchedNegation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			decision, err := g.DecideCondition(context.Background(), tt.condition, "user", "alice", "document", "plan", contextData)
+			if err != nil {
+				t.Fatalf("DecideCondition(%q) returned error: %v", tt.condition, err)
+			}
+			if decision.Allowed != tt.allowed || decision.Reason != tt.reason {
+				t.Errorf("DecideCondition(%q) = %+v, want allowed=%v reason=%q", tt.condition, decision, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package graph
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// relationStatsTTL is how long cached relation counts are used before the
+// planner refreshes them in the background
+const relationStatsTTL = 5 * time.Minute
+
+// Estimated cost of evaluating each kind of expression, in rough units of
+// one indexed query. Context reads and literals need no database at all.
+const (
+	costInMemory         = 0.1
+	costAttribute        = 1
+	costDirectRelation   = 2
+	costIndirectRelation = 8
+	costRule             = 4
+)
+
+// Bounds on estimated probabilities, so stale counts never make a branch
+// look certain either way
+const (
+	minSelectivity = 0.01
+	maxSelectivity = 0.99
+)
+
+type relationStatKey struct {
+	relation   string
+	objectType string
+}
+
+type relationStat struct {
+	tuples  int64
+	objects int64
+}
+
+// relationStats caches relation counts per (relation, object_type). The zero
+// value is empty and refreshes on first use when the graph has a pool.
+type relationStats struct {
+	mu         sync.RWMutex
+	counts     map[relationStatKey]relationStat
+	loadedAt   time.Time
+	refreshing bool
+}
+
+// lookup returns the cached count for a relation on an object type. ok is
+// false until counts have been loaded.
+func (s *relationStats) lookup(relation, objectType string) (stat relationStat, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.counts == nil {
+		return relationStat{}, false
+	}
+	return s.counts[relationStatKey{relation, objectType}], true
+}
+
+// set replaces the cached counts
+func (s *relationStats) set(counts map[relationStatKey]relationStat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts = counts
+	s.loadedAt = time.Now()
+	s.refreshing = false
+}
+
+// startRefresh reports whether the caller should reload the counts, marking
+// a refresh in progress so only one runs at a time
+func (s *relationStats) startRefresh() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refreshing || (s.counts != nil && time.Since(s.loadedAt) < relationStatsTTL) {
+		return false
+	}
+	s.refreshing = true
+	return true
+}
+
+func (s *relationStats) abortRefresh() {
+	s.mu.Lock()
+	s.refreshing = false
+	s.mu.Unlock()
+}
+
+// InvalidateRelationStats drops the cached relation counts so the next check
+// reloads them
+func (g *IdentityGraph) InvalidateRelationStats() {
+	g.relationStats.mu.Lock()
+	g.relationStats.loadedAt = time.Time{}
+	g.relationStats.mu.Unlock()
+}
+
+// refreshRelationStats reloads relation counts in the background when they
+// are missing or stale. Checks never wait for it; until the first load
+// completes the planner orders branches by static cost alone, as it always
+// does over a store that can't run the load alongside a check.
+func (g *IdentityGraph) refreshRelationStats() {
+	if g.store == nil || !g.concurrent || !g.relationStats.startRefresh() {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		counts, err := g.loadRelationStats(ctx)
+		if err != nil {
+			log.Printf("Failed to load relation counts for the check planner: %v", err)
+			g.relationStats.abortRefresh()
+			return
+		}
+		g.relationStats.set(counts)
+	}()
+}
+
+// loadRelationStats counts relation tuples and distinct objects per
+// (relation, object_type)
+func (g *IdentityGraph) loadRelationStats(ctx context.Context) (map[relationStatKey]relationStat, error) {
+	rows, err := g.store.Query(ctx, `
+		SELECT relation, object_type, COUNT(*), COUNT(DISTINCT object_id)
+		FROM relations
+		GROUP BY relation, object_type
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[relationStatKey]relationStat)
+	for rows.Next() {
+		var key relationStatKey
+		var stat relationStat
+		if err := rows.Scan(&key.relation, &key.objectType, &stat.tuples, &stat.objects); err != nil {
+			return nil, err
+		}
+		counts[key] = stat
+	}
+	return counts, rows.Err()
+}
+
+// planExpression reorders the operands of and/or chains so that cheap,
+// decisive branches run first: an "or" tries the branch most likely to allow
+// per unit of cost, an "and" the branch most likely to deny. The result is
+// logically equivalent, but an allowed "and" may report a different
+// operand's reason than the written order would.
+func (g *IdentityGraph) planExpression(expr Expression, objectType string) Expression {
+	g.refreshRelationStats()
+	return g.plan(expr, objectType).expr
+}
+
+// plannedExpression is an expression with its estimated cost and the
+// estimated probability that it allows
+type plannedExpression struct {
+	expr        Expression
+	cost        float64
+	selectivity float64
+}
+
+func (g *IdentityGraph) plan(expr Expression, objectType string) plannedExpression {
+	switch e := expr.(type) {
+	case *AndExpression:
+		return g.planChain(expr, objectType, true)
+	case *OrExpression:
+		return g.planChain(expr, objectType, false)
+	case *RelationExpression:
+		if e.RelationPath == "" && g.declaresAttribute(objectType, e.RelationName) {
+			return plannedExpression{e, costAttribute, 0.5}
+		}
+		if e.RelationPath == "" {
+			return plannedExpression{e, costDirectRelation, g.relationSelectivity(e.RelationName, objectType)}
+		}
+		// The related entities are of an unknown type, so only the first
+		// hop can be estimated
+		return plannedExpression{e, costIndirectRelation, g.relationSelectivity(e.RelationPath, objectType)}
+	case *NotExpression:
+		// The operand's chains are planned on their own; negating flips the
+		// chance of allowing but not the cost
+		operand := g.plan(e.Operand, objectType)
+		return plannedExpression{&NotExpression{Operand: operand.expr}, operand.cost, clampSelectivity(1 - operand.selectivity)}
+	default:
+		return plannedExpression{expr, operandCost(expr), 0.5}
+	}
+}
+
+// planChain flattens a run of the same operator, plans each operand and
+// rebuilds the chain in evaluation order
+func (g *IdentityGraph) planChain(expr Expression, objectType string, isAnd bool) plannedExpression {
+	var operands []plannedExpression
+	for _, operand := range flattenChain(expr, isAnd, nil) {
+		operands = append(operands, g.plan(operand, objectType))
+	}
+
+	// Rank by cost per chance of settling the chain; the stable sort keeps
+	// the written order for ties
+	rank := func(p plannedExpression) float64 {
+		if isAnd {
+			return p.cost / (1 - p.selectivity)
+		}
+		return p.cost / p.selectivity
+	}
+	sort.SliceStable(operands, func(i, j int) bool {
+		return rank(operands[i]) < rank(operands[j])
+	})
+
+	result := operands[0]
+	for _, operand := range operands[1:] {
+		if isAnd {
+			result = plannedExpression{
+				expr:        &AndExpression{Left: result.expr, Right: operand.expr},
+				cost:        result.cost + operand.cost,
+				selectivity: clampSelectivity(result.selectivity * operand.selectivity),
+			}
+		} else {
+			result = plannedExpression{
+				expr:        &OrExpression{Left: result.expr, Right: operand.expr},
+				cost:        result.cost + operand.cost,
+				selectivity: clampSelectivity(1 - (1-result.selectivity)*(1-operand.selectivity)),
+			}
+		}
+	}
+	return result
+}
+
+// flattenChain collects the operands of nested and (or or) expressions
+func flattenChain(expr Expression, isAnd bool, operands []Expression) []Expression {
+	switch e := expr.(type) {
+	case *AndExpression:
+		if isAnd {
+			return flattenChain(e.Right, isAnd, flattenChain(e.Left, isAnd, operands))
+		}
+	case *OrExpression:
+		if !isAnd {
+			return flattenChain(e.Right, isAnd, flattenChain(e.Left, isAnd, operands))
+		}
+	}
+	return append(operands, expr)
+}
+
+// relationSelectivity estimates how likely a subject is to hold a relation on
+// an object of objectType from the average number of tuples per object. A
+// relation no object of the type has is almost certainly absent.
+func (g *IdentityGraph) relationSelectivity(relation, objectType string) float64 {
+	stat, ok := g.relationStats.lookup(relation, objectType)
+	if !ok {
+		return 0.5
+	}
+	if stat.tuples == 0 || stat.objects == 0 {
+		return minSelectivity
+	}
+	perObject := float64(stat.tuples) / float64(stat.objects)
+	return clampSelectivity(perObject / (perObject + 1))
+}
+
+// operandCost estimates the cost of a leaf expression or value
+func operandCost(expr Expression) float64 {
+	switch e := expr.(type) {
+	case *LiteralExpression, *ContextExpression:
+		return costInMemory
+	case *AttributeExpression:
+		return costAttribute
+	case *RelationExpression:
+		if e.RelationPath == "" {
+			return costDirectRelation
+		}
+		return costIndirectRelation
+	case *ComparisonExpression:
+		return operandCost(e.Left) + operandCost(e.Right)
+	case *InExpression:
+		return operandCost(e.Value) + operandCost(e.List)
+	case *QuantifiedExpression:
+		return operandCost(e.List) + operandCost(e.Right)
+	case *RuleExpression:
+		cost := 0.0
+		if !IsBuiltinFunction(e.RuleName) {
+			cost = costRule
+		}
+		for _, arg := range e.Arguments {
+			cost += operandCost(arg)
+		}
+		return cost
+	case *AndExpression:
+		return operandCost(e.Left) + operandCost(e.Right)
+	case *OrExpression:
+		return operandCost(e.Left) + operandCost(e.Right)
+	case *NotExpression:
+		return operandCost(e.Operand)
+	default:
+		return costRule
+	}
+}
+
+func clampSelectivity(p float64) float64 {
+	if p < minSelectivity {
+		return minSelectivity
+	}
+	if p > maxSelectivity {
+		return maxSelectivity
+	}
+	return p
+}
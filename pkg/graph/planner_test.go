@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"testing"
+)
+
+func TestPlanExpressionOrdersBranches(t *testing.T) {
+	g := &IdentityGraph{}
+	g.relationStats.set(map[relationStatKey]relationStat{
+		{"viewer", "document"}: {tuples: 900, objects: 100},
+		{"owner", "document"}:  {tuples: 100, objects: 100},
+		{"parent", "document"}: {tuples: 100, objects: 100},
+	})
+
+	tests := map[string]string{
+		// direct relations run before recursive paths and rules
+		`parent.viewer or isPublic(request.flag) or owner`: `((owner or isPublic(request.flag)) or parent.viewer)`,
+		// among direct relations, an "or" tries the commoner one first...
+		`owner or viewer`: `(viewer or owner)`,
+		// ...and an "and" the rarer one
+		`viewer and owner`: `(owner and viewer)`,
+		// a relation no document has settles an "and" at once
+		`viewer and editor`: `(editor and viewer)`,
+		// context reads need no query
+		`owner and request.approved`: `(request.approved and owner)`,
+		// ties keep the written order
+		`request.a or request.b`: `(request.a or request.b)`,
+		// nested chains are planned independently
+		`(parent.viewer and owner) or (viewer and request.approved)`: `((request.approved and viewer) or (owner and parent.viewer))`,
+	}
+
+	for input, want := range tests {
+		expr, err := NewConditionParser(input).Parse()
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", input, err)
+		}
+		if got := g.plan(expr, "document").expr.String(); got != want {
+			t.Errorf("plan(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestPlanExpressionWithoutStats(t *testing.T) {
+	g := &IdentityGraph{}
+
+	expr, err := NewConditionParser(`organization.admin or owner or editor`).Parse()
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	want := `((owner or editor) or organization.admin)`
+	if got := g.planExpression(expr, "document").String(); got != want {
+		t.Errorf("planExpression() = %q, want %q", got, want)
+	}
+}
+
+func TestPlanExpressionDeclaredAttribute(t *testing.T) {
+	g := &IdentityGraph{}
+	g.setAttributeDeclarations([]AttributeDeclaration{
+		{EntityType: "document", Attribute: "public", DataType: AttributeBoolean},
+	})
+
+	// A declared attribute is one read, cheaper than a relation check
+	expr, err := NewConditionParser(`owner or public`).Parse()
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	want := `(public or owner)`
+	if got := g.planExpression(expr, "document").String(); got != want {
+		t.Errorf("planExpression() = %q, want %q", got, want)
+	}
+
+	// On a type that doesn't declare it, the name is still a relation
+	want = `(owner or public)`
+	if got := g.planExpression(expr, "folder").String(); got != want {
+		t.Errorf("planExpression() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dangerclosesec/supra/permissions/model"
+)
+
+// RuleTestResult is the outcome of one case of a rule test declared in a
+// .perm schema
+type RuleTestResult struct {
+	Rule     string
+	Line     int
+	Inputs   map[string]interface{}
+	Expected bool
+	Got      bool
+	// Err is set when the case could not be evaluated, e.g. because an
+	// input is missing or has the wrong type
+	Err error
+}
+
+// Passed reports whether the rule returned the expected result
+func (r RuleTestResult) Passed() bool {
+	return r.Err == nil && r.Got == r.Expected
+}
+
+// String describes the case as "rule(name=value, ...) at line N"
+func (r RuleTestResult) String() string {
+	names := make([]string, 0, len(r.Inputs))
+	for name := range r.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := make([]string, len(names))
+	for i, name := range names {
+		args[i] = fmt.Sprintf("%s=%v", name, r.Inputs[name])
+	}
+	return fmt.Sprintf("%s(%s) at line %d", r.Rule, strings.Join(args, ", "), r.Line)
+}
+
+// RunRuleTests evaluates every rule test case in the model against the
+// model's own rule bodies, so a schema can be checked before it is synced
+func RunRuleTests(ctx context.Context, m *model.PermissionModel) []RuleTestResult {
+	var results []RuleTestResult
+	for _, test := range m.Tests {
+		rule := m.GetRule(test.Rule)
+		for _, c := range test.Cases {
+			result := RuleTestResult{
+				Rule:     test.Rule,
+				Line:     c.LineNumber,
+				Inputs:   c.Inputs,
+				Expected: c.Expected,
+			}
+			if rule == nil {
+				result.Err = fmt.Errorf("unknown rule %s", test.Rule)
+			} else if params, err := ruleTestParams(rule, c.Inputs); err != nil {
+				result.Err = err
+			} else {
+				result.Got, result.Err = EvaluateRuleExpression(ctx, rule.Expression, params)
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// ruleTestParams checks a case's inputs against the rule's parameters and
+// converts them to the parameter types
+func ruleTestParams(rule *model.Rule, inputs map[string]interface{}) (map[string]interface{}, error) {
+	params := make(map[string]interface{}, len(rule.Parameters))
+	for _, param := range rule.Parameters {
+		value, ok := inputs[param.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing parameter %s", param.Name)
+		}
+		converted, err := convertTestInput(param.DataType, value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", param.Name, err)
+		}
+		params[param.Name] = converted
+	}
+	for name := range inputs {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("rule %s has no parameter %s", rule.Name, name)
+		}
+	}
+	return params, nil
+}
+
+// convertTestInput gives a parsed literal the Go type the parameter holds at
+// runtime: integers are accepted for doubles, and lists become typed slices
+func convertTestInput(dataType model.AttributeDataType, value interface{}) (interface{}, error) {
+	if n, ok := value.(int64); ok && dataType == model.AttributeTypeDouble {
+		value = float64(n)
+	}
+	if list, ok := value.([]interface{}); ok {
+		elemType := model.AttributeDataType(strings.TrimSuffix(string(dataType), "[]"))
+		if elemType == dataType {
+			return nil, fmt.Errorf("expected %s, got a list", dataType)
+		}
+		var err error
+		if value, err = typedList(elemType, list); err != nil {
+			return nil, err
+		}
+	}
+	if err := model.ValidateAttributeValue(dataType, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func typedList(elemType model.AttributeDataType, list []interface{}) (interface{}, error) {
+	converted := make([]interface{}, len(list))
+	for i, elem := range list {
+		v, err := convertTestInput(elemType, elem)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		converted[i] = v
+	}
+
+	switch elemType {
+	case model.AttributeTypeString:
+		return toTyped[string](converted), nil
+	case model.AttributeTypeInteger:
+		return toTyped[int64](converted), nil
+	case model.AttributeTypeDouble:
+		return toTyped[float64](converted), nil
+	case model.AttributeTypeBoolean:
+		return toTyped[bool](converted), nil
+	default:
+		return nil, fmt.Errorf("unsupported list type %s[]", elemType)
+	}
+}
+
+func toTyped[T any](values []interface{}) []T {
+	typed := make([]T, len(values))
+	for i, v := range values {
+		typed[i] = v.(T)
+	}
+	return typed
+}
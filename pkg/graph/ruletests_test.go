@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dangerclosesec/supra/permissions/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunRuleTests(t *testing.T) {
+	p := parser.NewParser(parser.NewLexer(`
+rule can_spend(balance double, amount double, roles string[]) {
+    balance >= amount and "finance" in roles
+}
+
+test can_spend {
+    balance = 100, amount = 50, roles = ["finance"] => true
+    balance = 100, amount = 50, roles = ["sales"] => true
+    balance = 100, amount = 50 => true
+    balance = "lots", amount = 50, roles = [] => false
+    balance = 1, amount = 2, roles = [], extra = 1 => false
+}
+
+test missing_rule {
+    a = 1 => true
+}
+`))
+	m := p.ParsePermissionModel()
+	require.Empty(t, p.Errors())
+
+	results := RunRuleTests(context.Background(), m)
+	require.Len(t, results, 6)
+
+	assert.True(t, results[0].Passed(), "%v", results[0].Err)
+
+	assert.False(t, results[1].Passed())
+	assert.NoError(t, results[1].Err)
+	assert.False(t, results[1].Got)
+
+	assert.ErrorContains(t, results[2].Err, "missing parameter roles")
+	assert.ErrorContains(t, results[3].Err, "parameter balance")
+	assert.ErrorContains(t, results[4].Err, "has no parameter extra")
+	assert.ErrorContains(t, results[5].Err, "unknown rule missing_rule")
+
+	assert.Equal(t, "can_spend(amount=50, balance=100, roles=[finance]) at line 7", results[0].String())
+}
+
+func TestSchemaRuleTestsPass(t *testing.T) {
+	m, errs, err := parser.ParseFile("../../permissions/schema.perm")
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.NotEmpty(t, m.Tests)
+
+	for _, result := range RunRuleTests(context.Background(), m) {
+		assert.True(t, result.Passed(), "%s: got %v, err %v", result, result.Got, result.Err)
+	}
+}
@@ -0,0 +1,280 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrPermissionNotDefined is returned for a permission the object's type
+// doesn't define
+var ErrPermissionNotDefined = errors.New("permission definition not found")
+
+// ErrSchemaVersionNotFound is returned for a check pinned to a schema
+// version that was never recorded
+var ErrSchemaVersionNotFound = errors.New("schema version not found")
+
+// SnapshotSchemaSQL records the permission definitions and rules in the
+// database as a new schema version, unless they are the same as the latest
+// version's. $1 is the source of the change, e.g. the schema file. It
+// returns the new version, or no row when nothing changed. Run it in the
+// transaction that changes the model, as the migrator does.
+const SnapshotSchemaSQL = `
+	WITH current AS (
+		SELECT
+			COALESCE((
+				SELECT jsonb_agg(jsonb_build_object(
+					'entity_type', entity_type,
+					'permission_name', permission_name,
+					'condition_expression', condition_expression,
+					'deprecated', deprecated)
+					-- Left out unless set, so versions recorded before
+					-- permissions could be sensitive still compare equal
+					|| jsonb_strip_nulls(jsonb_build_object('sensitive', sensitive))
+					ORDER BY entity_type, permission_name)
+				FROM permission_definitions), '[]'::jsonb) AS permissions,
+			COALESCE((
+				SELECT jsonb_agg(jsonb_build_object(
+					'rule_name', rule_name,
+					'parameters', parameters,
+					'expression', expression) ORDER BY rule_name)
+				FROM rule_definitions), '[]'::jsonb) AS rules
+	), latest AS (
+		SELECT version, permissions, rules
+		FROM schema_versions
+		ORDER BY version DESC
+		LIMIT 1
+	)
+	INSERT INTO schema_versions (version, permissions, rules, source)
+	SELECT COALESCE((SELECT version FROM latest), 0) + 1, c.permissions, c.rules, $1
+	FROM current c
+	WHERE NOT EXISTS (
+		SELECT 1 FROM latest l WHERE l.permissions = c.permissions AND l.rules = c.rules
+	)
+	ON CONFLICT (version) DO NOTHING
+	RETURNING version
+`
+
+type schemaVersionKey struct{}
+
+// WithSchemaVersion pins the checks made with ctx to a schema version, so
+// permission definitions and rules are read from its snapshot. Requests in
+// flight while the schema changes can then finish against one model.
+func WithSchemaVersion(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, schemaVersionKey{}, version)
+}
+
+// PinnedSchemaVersion returns the version set by WithSchemaVersion
+func PinnedSchemaVersion(ctx context.Context) (int, bool) {
+	version, ok := ctx.Value(schemaVersionKey{}).(int)
+	return version, ok
+}
+
+// SchemaVersion describes a recorded version of the permission model
+type SchemaVersion struct {
+	Version     int       `json:"version"`
+	Source      string    `json:"source,omitempty"`
+	Permissions int       `json:"permissions"`
+	Rules       int       `json:"rules"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// schemaSnapshot is the permission model of one schema version. Versions
+// never change once recorded, so snapshots are cached for good.
+type schemaSnapshot struct {
+	permissions map[string]snapshotPermission
+	rules       map[string]*RuleDefinition
+}
+
+type snapshotPermission struct {
+	EntityType          string  `json:"entity_type"`
+	PermissionName      string  `json:"permission_name"`
+	ConditionExpression string  `json:"condition_expression"`
+	Deprecated          *string `json:"deprecated"`
+	Sensitive           *string `json:"sensitive,omitempty"`
+}
+
+type snapshotRule struct {
+	RuleName   string          `json:"rule_name"`
+	Parameters []RuleParameter `json:"parameters"`
+	Expression string          `json:"expression"`
+}
+
+// SnapshotSchema records the permission model now in the database as a new
+// schema version if it changed, returning the latest version either way
+func (g *IdentityGraph) SnapshotSchema(ctx context.Context, source string) (int, error) {
+	var version int
+	err := g.store.QueryRow(ctx, SnapshotSchemaSQL, source).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return g.CurrentSchemaVersion(ctx)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to record schema version: %w", err)
+	}
+	return version, nil
+}
+
+// CurrentSchemaVersion returns the latest recorded schema version, or zero
+// when none has been recorded
+func (g *IdentityGraph) CurrentSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := g.store.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_versions`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// SchemaVersions lists the recorded schema versions, newest first
+func (g *IdentityGraph) SchemaVersions(ctx context.Context, limit int) ([]SchemaVersion, error) {
+	rows, err := g.store.Query(ctx, `
+		SELECT version, source, jsonb_array_length(permissions), jsonb_array_length(rules), created_at
+		FROM schema_versions
+		ORDER BY version DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []SchemaVersion{}
+	for rows.Next() {
+		var v SchemaVersion
+		if err := rows.Scan(&v.Version, &v.Source, &v.Permissions, &v.Rules, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// schemaSnapshot returns the permission model of a schema version
+func (g *IdentityGraph) schemaSnapshot(ctx context.Context, version int) (*schemaSnapshot, error) {
+	g.schemaVersionsMu.RLock()
+	snapshot, ok := g.schemaVersions[version]
+	g.schemaVersionsMu.RUnlock()
+	g.recordCacheLookup(CacheSchemaVersions, ok)
+	if ok {
+		return snapshot, nil
+	}
+
+	var permissionsJSON, rulesJSON []byte
+	err := g.store.QueryRow(ctx, `
+		SELECT permissions, rules FROM schema_versions WHERE version = $1
+	`, version).Scan(&permissionsJSON, &rulesJSON)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrSchemaVersionNotFound, version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema version %d: %w", version, err)
+	}
+
+	snapshot, err = parseSchemaSnapshot(permissionsJSON, rulesJSON)
+	if err != nil {
+		return nil, fmt.Errorf("schema version %d: %w", version, err)
+	}
+
+	g.schemaVersionsMu.Lock()
+	if g.schemaVersions == nil {
+		g.schemaVersions = make(map[int]*schemaSnapshot)
+	}
+	g.schemaVersions[version] = snapshot
+	g.schemaVersionsMu.Unlock()
+	return snapshot, nil
+}
+
+// parseSchemaSnapshot reads the permissions and rules stored by
+// SnapshotSchemaSQL
+func parseSchemaSnapshot(permissionsJSON, rulesJSON []byte) (*schemaSnapshot, error) {
+	var permissions []snapshotPermission
+	if err := json.Unmarshal(permissionsJSON, &permissions); err != nil {
+		return nil, fmt.Errorf("failed to parse permissions: %w", err)
+	}
+	var rules []snapshotRule
+	if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	snapshot := &schemaSnapshot{
+		permissions: make(map[string]snapshotPermission, len(permissions)),
+		rules:       make(map[string]*RuleDefinition, len(rules)),
+	}
+	for _, p := range permissions {
+		snapshot.permissions[p.EntityType+"#"+p.PermissionName] = p
+	}
+	for _, r := range rules {
+		snapshot.rules[r.RuleName] = &RuleDefinition{Name: r.RuleName, Parameters: r.Parameters, Expression: r.Expression}
+	}
+	return snapshot, nil
+}
+
+// ResolvedPermission is a permission as a check resolves it
+type ResolvedPermission struct {
+	Condition string
+	// Deprecated is the deprecation message of a deprecated permission,
+	// empty when the schema gave none, and nil otherwise
+	Deprecated *string
+	// Sensitive is the label of a sensitive permission, empty when the
+	// schema gave none, and nil otherwise
+	Sensitive *string
+}
+
+// PermissionCondition returns the condition of a permission and, when the
+// schema deprecates it, the deprecation message
+func (g *IdentityGraph) PermissionCondition(ctx context.Context, entityType, permission string) (string, *string, error) {
+	def, err := g.ResolvePermission(ctx, entityType, permission)
+	return def.Condition, def.Deprecated, err
+}
+
+// ResolvePermission returns the condition and annotations of a permission.
+// A check pinned with WithSchemaVersion reads them from that version. A
+// permission the type doesn't define fails with ErrPermissionNotDefined.
+func (g *IdentityGraph) ResolvePermission(ctx context.Context, entityType, permission string) (ResolvedPermission, error) {
+	if version, ok := PinnedSchemaVersion(ctx); ok {
+		snapshot, err := g.schemaSnapshot(ctx, version)
+		if err != nil {
+			return ResolvedPermission{}, err
+		}
+		p, ok := snapshot.permissions[entityType+"#"+permission]
+		if !ok {
+			return ResolvedPermission{}, fmt.Errorf("%w: %s.%s in schema version %d", ErrPermissionNotDefined, entityType, permission, version)
+		}
+		return ResolvedPermission{Condition: p.ConditionExpression, Deprecated: p.Deprecated, Sensitive: p.Sensitive}, nil
+	}
+
+	var def ResolvedPermission
+	err := g.store.QueryRow(ctx, `
+		SELECT condition_expression, deprecated, sensitive
+		FROM permission_definitions
+		WHERE entity_type = $1 AND permission_name = $2
+	`, entityType, permission).Scan(&def.Condition, &def.Deprecated, &def.Sensitive)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ResolvedPermission{}, fmt.Errorf("%w: %s.%s", ErrPermissionNotDefined, entityType, permission)
+	}
+	if err != nil {
+		return ResolvedPermission{}, fmt.Errorf("failed to get permission definition: %w", err)
+	}
+	return def, nil
+}
+
+// schemaRule returns the schema's rule named name, from the pinned schema
+// version if there is one
+func (g *IdentityGraph) schemaRule(ctx context.Context, name string) (*RuleDefinition, error) {
+	version, ok := PinnedSchemaVersion(ctx)
+	if !ok {
+		return g.GetRule(name)
+	}
+	snapshot, err := g.schemaSnapshot(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	rule, ok := snapshot.rules[name]
+	if !ok {
+		return nil, fmt.Errorf("rule not found in schema version %d: %s", version, name)
+	}
+	return rule, nil
+}
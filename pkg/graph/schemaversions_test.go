@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchemaSnapshot(t *testing.T) {
+	snapshot, err := parseSchemaSnapshot(
+		[]byte(`[{"entity_type":"document","permission_name":"view","condition_expression":"owner","deprecated":null},
+			{"entity_type":"document","permission_name":"read","condition_expression":"viewer","deprecated":"use view"}]`),
+		[]byte(`[{"rule_name":"within_limit","parameters":[{"name":"amount","data_type":"integer"}],"expression":"amount <= 100"}]`))
+	require.NoError(t, err)
+
+	assert.Len(t, snapshot.permissions, 2)
+	assert.Equal(t, "owner", snapshot.permissions["document#view"].ConditionExpression)
+	require.NotNil(t, snapshot.permissions["document#read"].Deprecated)
+	assert.Equal(t, "use view", *snapshot.permissions["document#read"].Deprecated)
+	assert.Equal(t, "amount <= 100", snapshot.rules["within_limit"].Expression)
+	assert.Len(t, snapshot.rules["within_limit"].Parameters, 1)
+
+	_, err = parseSchemaSnapshot([]byte(`{}`), []byte(`[]`))
+	assert.Error(t, err)
+}
+
+func TestPinnedSchemaVersion(t *testing.T) {
+	old, err := parseSchemaSnapshot(
+		[]byte(`[{"entity_type":"document","permission_name":"view","condition_expression":"owner"},
+			{"entity_type":"document","permission_name":"purge","condition_expression":"owner","deprecated":null,"sensitive":"break-glass"}]`),
+		[]byte(`[{"rule_name":"within_limit","parameters":[],"expression":"amount <= 100"}]`))
+	require.NoError(t, err)
+	g := &IdentityGraph{
+		ruleCache:      map[string]*RuleDefinition{"within_limit": {Name: "within_limit", Expression: "amount <= 1000"}},
+		schemaVersions: map[int]*schemaSnapshot{1: old},
+	}
+
+	_, ok := PinnedSchemaVersion(context.Background())
+	assert.False(t, ok)
+
+	ctx := WithSchemaVersion(context.Background(), 1)
+	version, ok := PinnedSchemaVersion(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 1, version)
+
+	condition, deprecated, err := g.PermissionCondition(ctx, "document", "view")
+	require.NoError(t, err)
+	assert.Equal(t, "owner", condition)
+	assert.Nil(t, deprecated)
+
+	def, err := g.ResolvePermission(ctx, "document", "purge")
+	require.NoError(t, err)
+	require.NotNil(t, def.Sensitive)
+	assert.Equal(t, "break-glass", *def.Sensitive)
+
+	_, _, err = g.PermissionCondition(ctx, "document", "edit")
+	assert.ErrorIs(t, err, ErrPermissionNotDefined)
+
+	// The pinned version's rule wins over the one in the cache
+	rule, err := g.schemaRule(ctx, "within_limit")
+	require.NoError(t, err)
+	assert.Equal(t, "amount <= 100", rule.Expression)
+	rule, err = g.schemaRule(context.Background(), "within_limit")
+	require.NoError(t, err)
+	assert.Equal(t, "amount <= 1000", rule.Expression)
+
+	_, err = g.schemaRule(ctx, "missing")
+	assert.Error(t, err)
+}
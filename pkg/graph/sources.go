@@ -0,0 +1,104 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SourceManual is the source of relations written without one, including
+// those stored before relations had sources
+const SourceManual = "manual"
+
+// maxSourceLength bounds a relation source
+const maxSourceLength = 128
+
+// ErrInvalidSource is returned for a relation source that is too long or
+// has characters other than letters, digits and - _ . : @
+var ErrInvalidSource = errors.New("invalid relation source")
+
+// ValidateSource reports whether source can tag relations. Sources are
+// short identifiers like scim, entity-sync or import:batch-42, safe in a
+// URL path.
+func ValidateSource(source string) error {
+	if source == "" || len(source) > maxSourceLength {
+		return fmt.Errorf("%w: must be 1 to %d characters", ErrInvalidSource, maxSourceLength)
+	}
+	for _, c := range source {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '@':
+		default:
+			return fmt.Errorf("%w: %q may only contain letters, digits and - _ . : @", ErrInvalidSource, source)
+		}
+	}
+	return nil
+}
+
+// normalizeSource validates source, defaulting an empty one to SourceManual
+func normalizeSource(source string) (string, error) {
+	if source == "" {
+		return SourceManual, nil
+	}
+	return source, ValidateSource(source)
+}
+
+// RelationSource counts the relations one source wrote
+type RelationSource struct {
+	Source    string    `json:"source"`
+	Relations int64     `json:"relations"`
+	FirstAt   time.Time `json:"first_at"`
+	LastAt    time.Time `json:"last_at"`
+}
+
+// RelationSources lists the sources of stored relations with their counts,
+// largest first
+func (g *IdentityGraph) RelationSources(ctx context.Context) ([]RelationSource, error) {
+	rows, err := g.store.Query(ctx, `
+		SELECT source, COUNT(*), MIN(created_at), MAX(created_at)
+		FROM relations
+		GROUP BY source
+		ORDER BY COUNT(*) DESC, source
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relation sources: %w", err)
+	}
+	defer rows.Close()
+
+	var sources []RelationSource
+	for rows.Next() {
+		var s RelationSource
+		if err := rows.Scan(&s.Source, &s.Relations, &s.FirstAt, &s.LastAt); err != nil {
+			return nil, fmt.Errorf("failed to scan relation source: %w", err)
+		}
+		sources = append(sources, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list relation sources: %w", err)
+	}
+	return sources, nil
+}
+
+// DeleteSourceRelations deletes up to limit of the relations source wrote,
+// oldest first, and returns them. Callers revoking a whole source repeat it
+// until nothing is returned, so no one statement holds locks on every row.
+func (g *IdentityGraph) DeleteSourceRelations(ctx context.Context, source string, limit int) ([]Relation, error) {
+	if err := ValidateSource(source); err != nil {
+		return nil, err
+	}
+	rows, err := g.store.Query(ctx, `
+		DELETE FROM relations
+		WHERE id IN (
+			SELECT id FROM relations
+			WHERE source = $1
+			ORDER BY id
+			LIMIT $2
+		)
+		RETURNING id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+	`, source, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete relations of %s: %w", source, err)
+	}
+	return collectRelations(rows)
+}
@@ -0,0 +1,30 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSource(t *testing.T) {
+	for _, source := range []string{"manual", "scim", "entity-sync", "import:batch-42", "sync@okta.com", "hr_feed.v2"} {
+		assert.NoError(t, ValidateSource(source), source)
+	}
+	for _, source := range []string{"", "import batch", "scim/okta", "a?b", strings.Repeat("x", maxSourceLength+1)} {
+		assert.ErrorIs(t, ValidateSource(source), ErrInvalidSource, source)
+	}
+}
+
+func TestNormalizeSource(t *testing.T) {
+	source, err := normalizeSource("")
+	assert.NoError(t, err)
+	assert.Equal(t, SourceManual, source)
+
+	source, err = normalizeSource("scim")
+	assert.NoError(t, err)
+	assert.Equal(t, "scim", source)
+
+	_, err = normalizeSource("not valid")
+	assert.ErrorIs(t, err, ErrInvalidSource)
+}
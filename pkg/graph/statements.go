@@ -0,0 +1,146 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// statementCacheCapacity sizes pgx's per-connection cache for the statements
+// that aren't prepared by name, e.g. graph and audit queries
+const statementCacheCapacity = 1024
+
+// Named statements for the queries every check runs. They are prepared once
+// per connection of the pool NewIdentityGraph opens and executed by name, so
+// Postgres reuses their plans. Over another Store their SQL runs instead.
+const (
+	stmtDirectRelation       = "graph_check_direct_relation"
+	stmtDirectRelationStrict = "graph_check_direct_relation_strict"
+	stmtIndirectRelation     = "graph_check_indirect_relation"
+	stmtSubjectSets          = "graph_subject_sets"
+	stmtEntityAttribute      = "graph_entity_attribute"
+)
+
+var preparedStatements = map[string]string{
+	// Either direction of the relation satisfies the check; both branches
+	// are answered by the relations unique index
+	stmtDirectRelation: `
+		SELECT EXISTS (
+			SELECT 1
+			FROM relations
+			WHERE relation = $3
+			AND (
+				(subject_type = $1 AND subject_id = $2 AND object_type = $4 AND object_id = $5)
+				OR (subject_type = $4 AND subject_id = $5 AND object_type = $1 AND object_id = $2)
+			)
+		)`,
+
+	stmtDirectRelationStrict: `
+		SELECT EXISTS (
+			SELECT 1
+			FROM relations
+			WHERE subject_type = $1
+			AND subject_id = $2
+			AND relation = $3
+			AND object_type = $4
+			AND object_id = $5
+		)`,
+
+	// Walks the graph both away from and towards the related entity in one
+	// round trip
+	stmtIndirectRelation: `
+		WITH RECURSIVE forward(subject_type, subject_id, relation, object_type, object_id, depth) AS (
+			SELECT subject_type, subject_id, relation, object_type, object_id, 1
+			FROM relations
+			WHERE subject_type = $1
+			AND subject_id = $2
+
+			UNION ALL
+
+			SELECT r.subject_type, r.subject_id, r.relation, r.object_type, r.object_id, p.depth + 1
+			FROM relations r
+			JOIN forward p ON r.subject_type = p.object_type AND r.subject_id = p.object_id
+			WHERE p.depth < 10  -- Prevents infinite recursion
+		),
+		reverse(subject_type, subject_id, relation, object_type, object_id, depth) AS (
+			SELECT subject_type, subject_id, relation, object_type, object_id, 1
+			FROM relations
+			WHERE object_type = $1
+			AND object_id = $2
+
+			UNION ALL
+
+			SELECT r.subject_type, r.subject_id, r.relation, r.object_type, r.object_id, p.depth + 1
+			FROM relations r
+			JOIN reverse p ON r.object_type = p.subject_type AND r.object_id = p.subject_id
+			WHERE p.depth < 10  -- Prevents infinite recursion
+		)
+		SELECT EXISTS (
+			SELECT 1
+			FROM forward
+			WHERE relation = $3
+			AND object_type = $4
+			AND object_id = $5
+		) OR EXISTS (
+			SELECT 1
+			FROM reverse
+			WHERE relation = $3
+			AND subject_type = $4
+			AND subject_id = $5
+		)`,
+
+	// The subject sets granted a relation on an object, answered by the
+	// partial index on subject set tuples
+	stmtSubjectSets: `
+		SELECT subject_type, subject_id
+		FROM relations
+		WHERE relation = $1
+		AND object_type = $2
+		AND object_id = $3
+		AND subject_id LIKE '%#%'`,
+
+	// The entity's properties and, when it has one, its typed attribute
+	stmtEntityAttribute: `
+		SELECT e.properties, a.data_type, a.bool_value, a.int_value,
+			a.double_value, a.string_value, a.array_value
+		FROM entities e
+		LEFT JOIN entity_attributes a
+			ON a.entity_type = e.type AND a.entity_id = e.external_id AND a.attribute = $3
+		WHERE e.type = $1 AND e.external_id = $2`,
+}
+
+// usePreparedStatements tunes the statement cache and prepares the hot-path
+// statements on each new connection, after any AfterConnect hook already set
+func usePreparedStatements(poolConfig *pgxpool.Config) {
+	poolConfig.ConnConfig.StatementCacheCapacity = statementCacheCapacity
+
+	afterConnect := poolConfig.AfterConnect
+	poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if afterConnect != nil {
+			if err := afterConnect(ctx, conn); err != nil {
+				return err
+			}
+		}
+		return prepareStatements(ctx, conn)
+	}
+}
+
+// statement returns what to run for a hot-path query: its name when every
+// connection has it prepared, otherwise its SQL
+func (g *IdentityGraph) statement(name string) string {
+	if g.prepared {
+		return name
+	}
+	return preparedStatements[name]
+}
+
+func prepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	for name, sql := range preparedStatements {
+		if _, err := conn.Prepare(ctx, name, sql); err != nil {
+			return fmt.Errorf("failed to prepare %s: %w", name, err)
+		}
+	}
+	return nil
+}
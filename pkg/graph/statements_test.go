@@ -0,0 +1,35 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestUsePreparedStatementsKeepsAfterConnect(t *testing.T) {
+	poolConfig, err := pgxpool.ParseConfig("postgres://localhost/authz")
+	if err != nil {
+		t.Fatalf("ParseConfig() returned error: %v", err)
+	}
+
+	hookErr := errors.New("hook failed")
+	called := false
+	poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		called = true
+		return hookErr
+	}
+
+	usePreparedStatements(poolConfig)
+
+	if poolConfig.ConnConfig.StatementCacheCapacity != statementCacheCapacity {
+		t.Errorf("StatementCacheCapacity = %d, want %d", poolConfig.ConnConfig.StatementCacheCapacity, statementCacheCapacity)
+	}
+	// The existing hook runs first and its failure stops the connection
+	// before any statement is prepared
+	if err := poolConfig.AfterConnect(context.Background(), nil); !errors.Is(err, hookErr) || !called {
+		t.Errorf("AfterConnect() = %v, called = %v; want the existing hook's error", err, called)
+	}
+}
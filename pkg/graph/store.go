@@ -0,0 +1,39 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/dangerclosesec/supra/internal/migrate"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Store is the Postgres connection the graph reads and writes through.
+// *pgxpool.Pool, *pgx.Conn and pgx.Tx satisfy it, so a service embedding
+// the graph can share its own pool, or run graph writes inside one of its
+// transactions; Begin on a pgx.Tx starts a savepoint. Only a pool runs
+// queries concurrently, so a graph over anything else serves one check at
+// a time (see New).
+type Store interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Migrate creates or upgrades the tables the graph needs in db, applying
+// the same migrations as supra migrate up --target authz. A service embedding
+// the graph over its own pool can run it at startup through
+// stdlib.OpenDBFromPool.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	m, err := migrate.New(db, migrate.TargetAuthz)
+	if err != nil {
+		return err
+	}
+	if _, err := m.Up(ctx); err != nil {
+		return fmt.Errorf("failed to migrate the graph tables: %w", err)
+	}
+	return nil
+}
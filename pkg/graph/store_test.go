@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	_ Store = (*pgxpool.Pool)(nil)
+	_ Store = (*pgx.Conn)(nil)
+	_ Store = pgx.Tx(nil)
+)
+
+func TestStatementOverAnotherStore(t *testing.T) {
+	pooled := &IdentityGraph{prepared: true}
+	if got := pooled.statement(stmtSubjectSets); got != stmtSubjectSets {
+		t.Errorf("statement() = %q, want the prepared statement's name", got)
+	}
+
+	embedded := &IdentityGraph{}
+	if got := embedded.statement(stmtSubjectSets); got != preparedStatements[stmtSubjectSets] {
+		t.Errorf("statement() = %q, want its SQL", got)
+	}
+}
+
+func TestNoBackgroundQueriesOverAConnection(t *testing.T) {
+	g := &IdentityGraph{store: (*pgx.Conn)(nil)}
+	g.refreshRelationStats()
+	if g.relationStats.refreshing {
+		t.Error("relation counts were loaded alongside checks over a single connection")
+	}
+}
@@ -0,0 +1,359 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	// TenantEntityType is the entity type that represents a tenant
+	TenantEntityType = "organization"
+	// TenantProperty is the entity property holding an entity's tenant
+	TenantProperty = "tenant"
+)
+
+var (
+	// ErrInvalidTenantRule is returned for a tenant rule that can't be
+	// stored as written
+	ErrInvalidTenantRule = errors.New("invalid tenant rule")
+	// ErrTenantRuleLimit is returned when a tenant already has as many
+	// rules as it may
+	ErrTenantRuleLimit = errors.New("tenant rule limit reached")
+	// ErrTenantRuleNotFound is returned for a tenant rule that doesn't exist
+	ErrTenantRuleNotFound = errors.New("tenant rule not found")
+)
+
+// TenantRule is a rule a tenant defines for its own entities. It is used in
+// place of the schema's rule of the same name in checks whose object
+// belongs to the tenant; checks of other tenants never see it.
+type TenantRule struct {
+	Tenant      string          `json:"tenant"`
+	Name        string          `json:"name"`
+	Parameters  []RuleParameter `json:"parameters"`
+	Expression  string          `json:"expression"`
+	Description string          `json:"description,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// TenantRuleLimits sandbox tenant rules. Their bodies are also held to the
+// graph's condition limits. A zero limit is not enforced.
+type TenantRuleLimits struct {
+	// MaxRules is the most rules one tenant may define
+	MaxRules int
+	// Timeout caps each evaluation of a tenant rule's body. A body that
+	// runs over it, or fails, denies the check instead of failing it.
+	Timeout time.Duration
+}
+
+// DefaultTenantRuleLimits returns the limits used when the configuration
+// sets none
+func DefaultTenantRuleLimits() TenantRuleLimits {
+	return TenantRuleLimits{
+		MaxRules: 50,
+		Timeout:  100 * time.Millisecond,
+	}
+}
+
+// SetTenantRuleLimits sets the limits tenant rules are held to
+func (g *IdentityGraph) SetTenantRuleLimits(limits TenantRuleLimits) {
+	g.tenantRuleLimits = limits
+}
+
+// loadTenantRules replaces the cached tenant rules with those in the
+// database
+func (g *IdentityGraph) loadTenantRules(ctx context.Context) error {
+	rows, err := g.store.Query(ctx, `
+		SELECT tenant_id, rule_name, parameters, expression, description, created_at, updated_at
+		FROM tenant_rules
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query tenant rules: %w", err)
+	}
+	defer rows.Close()
+
+	byName := make(map[string]map[string]*TenantRule)
+	for rows.Next() {
+		var rule TenantRule
+		var parametersJSON []byte
+		if err := rows.Scan(&rule.Tenant, &rule.Name, &parametersJSON, &rule.Expression,
+			&rule.Description, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+			return fmt.Errorf("failed to scan tenant rule: %w", err)
+		}
+		if err := json.Unmarshal(parametersJSON, &rule.Parameters); err != nil {
+			return fmt.Errorf("failed to unmarshal parameters of tenant %s rule %s: %w", rule.Tenant, rule.Name, err)
+		}
+		if byName[rule.Name] == nil {
+			byName[rule.Name] = make(map[string]*TenantRule)
+		}
+		byName[rule.Name][rule.Tenant] = &rule
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating tenant rules: %w", err)
+	}
+
+	g.tenantRulesMu.Lock()
+	g.tenantRules = byName
+	g.tenantRulesMu.Unlock()
+	return nil
+}
+
+// ReloadTenantRules re-reads the tenant rules, e.g. after another replica
+// changed one
+func (g *IdentityGraph) ReloadTenantRules(ctx context.Context) error {
+	return g.loadTenantRules(ctx)
+}
+
+// TenantRules lists the rules tenant defines, by name
+func (g *IdentityGraph) TenantRules(tenant string) []TenantRule {
+	g.tenantRulesMu.RLock()
+	defer g.tenantRulesMu.RUnlock()
+
+	rules := []TenantRule{}
+	for _, byTenant := range g.tenantRules {
+		if rule, ok := byTenant[tenant]; ok {
+			rules = append(rules, *rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// tenantRule returns the rule named name that tenant defines, if any
+func (g *IdentityGraph) tenantRule(tenant, name string) (*TenantRule, bool) {
+	g.tenantRulesMu.RLock()
+	defer g.tenantRulesMu.RUnlock()
+	rule, ok := g.tenantRules[name][tenant]
+	return rule, ok
+}
+
+// hasTenantRules reports whether any tenant defines a rule named name, so
+// checks calling other rules skip looking up their object's tenant
+func (g *IdentityGraph) hasTenantRules(name string) bool {
+	g.tenantRulesMu.RLock()
+	defer g.tenantRulesMu.RUnlock()
+	return len(g.tenantRules[name]) > 0
+}
+
+// SetTenantRule creates or replaces one of a tenant's rules. The body may
+// only call built-in functions, and a rule replacing one of the schema's
+// must take the same parameters so the schema's calls to it stay valid.
+func (g *IdentityGraph) SetTenantRule(ctx context.Context, rule TenantRule) (*TenantRule, error) {
+	if err := g.validateTenantRule(rule); err != nil {
+		return nil, err
+	}
+
+	_, exists := g.tenantRule(rule.Tenant, rule.Name)
+	if max := g.tenantRuleLimits.MaxRules; !exists && max > 0 && len(g.TenantRules(rule.Tenant)) >= max {
+		return nil, fmt.Errorf("%w: tenant %s already has %d rules", ErrTenantRuleLimit, rule.Tenant, max)
+	}
+
+	if rule.Parameters == nil {
+		rule.Parameters = []RuleParameter{}
+	}
+	parametersJSON, err := json.Marshal(rule.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal parameters: %w", err)
+	}
+	err = g.store.QueryRow(ctx, `
+		INSERT INTO tenant_rules (tenant_id, rule_name, parameters, expression, description)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, rule_name) DO UPDATE SET
+			parameters = EXCLUDED.parameters,
+			expression = EXCLUDED.expression,
+			description = EXCLUDED.description,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`, rule.Tenant, rule.Name, parametersJSON, rule.Expression, rule.Description).Scan(&rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store tenant rule: %w", err)
+	}
+
+	g.tenantRulesMu.Lock()
+	if g.tenantRules == nil {
+		g.tenantRules = make(map[string]map[string]*TenantRule)
+	}
+	if g.tenantRules[rule.Name] == nil {
+		g.tenantRules[rule.Name] = make(map[string]*TenantRule)
+	}
+	stored := rule
+	g.tenantRules[rule.Name][rule.Tenant] = &stored
+	g.tenantRulesMu.Unlock()
+
+	return &rule, nil
+}
+
+// DeleteTenantRule removes one of a tenant's rules, so its entities use the
+// schema's rule again
+func (g *IdentityGraph) DeleteTenantRule(ctx context.Context, tenant, name string) error {
+	tag, err := g.store.Exec(ctx, `DELETE FROM tenant_rules WHERE tenant_id = $1 AND rule_name = $2`, tenant, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant rule: %w", err)
+	}
+
+	g.tenantRulesMu.Lock()
+	delete(g.tenantRules[name], tenant)
+	g.tenantRulesMu.Unlock()
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: tenant %s has no rule %s", ErrTenantRuleNotFound, tenant, name)
+	}
+	return nil
+}
+
+// validateTenantRule checks a tenant rule can be stored: its name, its
+// parameters, its body against the condition limits and, where it replaces
+// a rule of the schema, its signature
+func (g *IdentityGraph) validateTenantRule(rule TenantRule) error {
+	switch {
+	case rule.Tenant == "" || rule.Name == "" || rule.Expression == "":
+		return fmt.Errorf("%w: tenant, name and expression are required", ErrInvalidTenantRule)
+	case IsBuiltinFunction(rule.Name):
+		return fmt.Errorf("%w: the name %s is reserved for a built-in function", ErrInvalidTenantRule, rule.Name)
+	}
+
+	seen := make(map[string]bool, len(rule.Parameters))
+	for _, param := range rule.Parameters {
+		if param.Name == "" || seen[param.Name] {
+			return fmt.Errorf("%w: parameter names must be given and unique", ErrInvalidTenantRule)
+		}
+		seen[param.Name] = true
+		if !validAttributeType(param.DataType) {
+			return fmt.Errorf("%w: parameter %s has unknown data type %q", ErrInvalidTenantRule, param.Name, param.DataType)
+		}
+	}
+
+	if err := g.conditionLimits.Check(rule.Expression); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTenantRule, err)
+	}
+	body, err := NewConditionParser(rule.Expression).Parse()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTenantRule, err)
+	}
+	if name, ok := calledRule(body); ok {
+		return fmt.Errorf("%w: rules cannot call other rules: %s", ErrInvalidTenantRule, name)
+	}
+
+	if schemaRule, err := g.GetRule(rule.Name); err == nil {
+		if !sameParameters(schemaRule.Parameters, rule.Parameters) {
+			return fmt.Errorf("%w: rule %s must take the same parameters as the schema's", ErrInvalidTenantRule, rule.Name)
+		}
+	}
+	return nil
+}
+
+// calledRule returns the first rule, other than a built-in function, that
+// expr calls
+func calledRule(expr Expression) (string, bool) {
+	switch e := expr.(type) {
+	case *AndExpression:
+		return firstCalledRule(e.Left, e.Right)
+	case *OrExpression:
+		return firstCalledRule(e.Left, e.Right)
+	case *NotExpression:
+		return calledRule(e.Operand)
+	case *RuleExpression:
+		if !IsBuiltinFunction(e.RuleName) {
+			return e.RuleName, true
+		}
+		return firstCalledRule(e.Arguments...)
+	case *ComparisonExpression:
+		return firstCalledRule(e.Left, e.Right)
+	case *InExpression:
+		return firstCalledRule(e.Value, e.List)
+	case *QuantifiedExpression:
+		return firstCalledRule(e.List, e.Right)
+	default:
+		return "", false
+	}
+}
+
+func firstCalledRule(exprs ...Expression) (string, bool) {
+	for _, expr := range exprs {
+		if name, ok := calledRule(expr); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// sameParameters reports whether two rules take the same parameters, by
+// position and data type
+func sameParameters(a, b []RuleParameter) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].DataType != b[i].DataType {
+			return false
+		}
+	}
+	return true
+}
+
+// objectTenant returns the tenant an object belongs to: the object itself
+// when it is a tenant, otherwise its tenant property. It is empty for an
+// object outside any tenant.
+func (g *IdentityGraph) objectTenant(ctx context.Context, objectType, objectID string) (string, error) {
+	if objectType == TenantEntityType {
+		return objectID, nil
+	}
+	value, err := g.getEntityAttribute(ctx, objectType, objectID, TenantProperty)
+	if errors.Is(err, ErrAttributeNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	tenant, _ := value.(string)
+	return tenant, nil
+}
+
+// resolveRule returns the definition a call of the rule named name uses
+// for the object: its tenant's rule, if the tenant defines one, or the
+// schema's
+func (g *IdentityGraph) resolveRule(ctx context.Context, name, objectType, objectID string) (*RuleDefinition, *TenantRule, error) {
+	if g.hasTenantRules(name) {
+		tenant, err := g.objectTenant(ctx, objectType, objectID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find the tenant of %s:%s: %w", objectType, objectID, err)
+		}
+		if rule, ok := g.tenantRule(tenant, name); ok {
+			return &RuleDefinition{
+				Name:        rule.Name,
+				Parameters:  rule.Parameters,
+				Expression:  rule.Expression,
+				Description: rule.Description,
+				CreatedAt:   rule.CreatedAt,
+			}, rule, nil
+		}
+	}
+	rule, err := g.schemaRule(ctx, name)
+	return rule, nil, err
+}
+
+// evaluateTenantRule evaluates the body of a tenant rule within its
+// timeout. A body that fails or runs out of time denies the check, so one
+// tenant's rule can't fail checks beyond its own tenant's outcome.
+func (g *IdentityGraph) evaluateTenantRule(ctx context.Context, rule *TenantRule, ruleCtx map[string]interface{}) bool {
+	if timeout := g.tenantRuleLimits.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	body, err := NewConditionParser(rule.Expression).Parse()
+	if err == nil {
+		var allowed bool
+		if allowed, err = g.evaluateRuleExpression(ctx, body, ruleCtx); err == nil {
+			return allowed
+		}
+	}
+	log.Printf("Tenant %s rule %s denied the check: %v", rule.Tenant, rule.Name, err)
+	return false
+}
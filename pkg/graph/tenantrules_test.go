@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTenantRule(t *testing.T) {
+	g := &IdentityGraph{
+		ruleCache: map[string]*RuleDefinition{
+			"within_limit": {Name: "within_limit", Parameters: []RuleParameter{{Name: "amount", DataType: "integer"}}},
+		},
+		conditionLimits: ConditionLimits{MaxLength: 64},
+	}
+	param := func(name, dataType string) []RuleParameter {
+		return []RuleParameter{{Name: name, DataType: dataType}}
+	}
+
+	assert.NoError(t, g.validateTenantRule(TenantRule{Tenant: "acme", Name: "within_limit",
+		Parameters: param("limit", "integer"), Expression: "limit <= 1000"}))
+	assert.NoError(t, g.validateTenantRule(TenantRule{Tenant: "acme", Name: "is_vip",
+		Parameters: param("email", "string"), Expression: `ends_with(email, "@acme.com")`}))
+
+	for reason, rule := range map[string]TenantRule{
+		"missing tenant":     {Name: "r", Expression: "true"},
+		"built-in name":      {Tenant: "acme", Name: "lower", Expression: "true"},
+		"unknown type":       {Tenant: "acme", Name: "r", Parameters: param("x", "money"), Expression: "x > 1"},
+		"over the limits":    {Tenant: "acme", Name: "r", Expression: "a or b or c or d or e or f or g or h or i or j or k or l or m or n"},
+		"parse error":        {Tenant: "acme", Name: "r", Expression: "x >"},
+		"calls another rule": {Tenant: "acme", Name: "r", Expression: "not other_rule(x)"},
+		"changed signature":  {Tenant: "acme", Name: "within_limit", Parameters: param("amount", "double"), Expression: "amount < 1"},
+	} {
+		assert.ErrorIs(t, g.validateTenantRule(rule), ErrInvalidTenantRule, reason)
+	}
+}
+
+func TestResolveTenantRule(t *testing.T) {
+	acme := &TenantRule{Tenant: "acme", Name: "within_limit", Expression: "amount <= 1000"}
+	g := &IdentityGraph{
+		ruleCache: map[string]*RuleDefinition{
+			"within_limit": {Name: "within_limit", Expression: "amount <= 100"},
+		},
+		tenantRules: map[string]map[string]*TenantRule{"within_limit": {"acme": acme}},
+	}
+	ctx := context.Background()
+
+	// An organization is its own tenant, so no lookup is needed
+	def, rule, err := g.resolveRule(ctx, "within_limit", TenantEntityType, "acme")
+	require.NoError(t, err)
+	assert.Same(t, acme, rule)
+	assert.Equal(t, "amount <= 1000", def.Expression)
+
+	def, rule, err = g.resolveRule(ctx, "within_limit", TenantEntityType, "globex")
+	require.NoError(t, err)
+	assert.Nil(t, rule)
+	assert.Equal(t, "amount <= 100", def.Expression)
+
+	assert.Equal(t, []TenantRule{*acme}, g.TenantRules("acme"))
+	assert.Empty(t, g.TenantRules("globex"))
+}
+
+func TestEvaluateTenantRuleDenies(t *testing.T) {
+	g := &IdentityGraph{tenantRuleLimits: DefaultTenantRuleLimits()}
+	params := map[string]interface{}{"amount": 500}
+
+	assert.True(t, g.evaluateTenantRule(context.Background(),
+		&TenantRule{Tenant: "acme", Name: "r", Expression: "amount <= 1000"}, params))
+	assert.False(t, g.evaluateTenantRule(context.Background(),
+		&TenantRule{Tenant: "acme", Name: "r", Expression: "missing <= 1000"}, params),
+		"a body that fails denies")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, g.evaluateTenantRule(ctx,
+		&TenantRule{Tenant: "acme", Name: "r", Expression: "amount <= 1000"}, params),
+		"a body out of time denies")
+}
@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UpsertEntity creates an entity, or replaces the properties of the one with
+// the same type and external ID. created reports which happened.
+func (g *IdentityGraph) UpsertEntity(ctx context.Context, entityType, externalID string,
+	properties map[string]interface{}) (entity *Entity, created bool, err error) {
+
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal properties: %w", err)
+	}
+
+	// xmax is only zero for a row this statement inserted
+	entity = &Entity{}
+	err = g.store.QueryRow(ctx, `
+		INSERT INTO entities (type, external_id, properties)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (type, external_id) DO UPDATE
+			SET properties = EXCLUDED.properties, updated_at = NOW()
+		RETURNING id, type, external_id, properties, created_at, updated_at, xmax = 0
+	`, entityType, externalID, propertiesJSON).Scan(
+		&entity.ID, &entity.Type, &entity.ExternalID, &propertiesJSON, &entity.CreatedAt, &entity.UpdatedAt, &created,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to upsert entity: %w", err)
+	}
+
+	if err := json.Unmarshal(propertiesJSON, &entity.Properties); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal properties: %w", err)
+	}
+	return entity, created, nil
+}
+
+// UpsertRelation creates a relation unless it exists, in which case the
+// existing one is returned unchanged, metadata and source included, and
+// created is false. Relation limits only apply when the relation is created.
+func (g *IdentityGraph) UpsertRelation(ctx context.Context, subjectType, subjectID,
+	relation, objectType, objectID string, metadata map[string]interface{}, source string) (rel *Relation, created bool, err error) {
+
+	if err := g.ValidateRelation(subjectType, subjectID, relation, objectType); err != nil {
+		return nil, false, err
+	}
+	if source, err = normalizeSource(source); err != nil {
+		return nil, false, err
+	}
+
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal relation metadata: %w", err)
+	}
+
+	err = pgx.BeginFunc(ctx, g.store, func(tx pgx.Tx) error {
+		existing := func() error {
+			rows, err := tx.Query(ctx, `
+				SELECT id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+				FROM relations
+				WHERE subject_type = $1 AND subject_id = $2 AND relation = $3
+					AND object_type = $4 AND object_id = $5
+			`, subjectType, subjectID, relation, objectType, objectID)
+			if err != nil {
+				return fmt.Errorf("failed to get relation: %w", err)
+			}
+			found, err := collectRelations(rows)
+			if err != nil {
+				return err
+			}
+			if len(found) > 0 {
+				rel = &found[0]
+			}
+			return nil
+		}
+
+		if err := existing(); err != nil || rel != nil {
+			return err
+		}
+
+		if max := g.relationLimit(objectType, relation); max > 0 {
+			if err := checkRelationLimit(ctx, tx, max, subjectType, subjectID, relation, objectType, objectID); err != nil {
+				return err
+			}
+		}
+
+		rows, err := tx.Query(ctx, `
+			INSERT INTO relations (subject_type, subject_id, relation, object_type, object_id, metadata, source)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (subject_type, subject_id, relation, object_type, object_id) DO NOTHING
+			RETURNING id, subject_type, subject_id, relation, object_type, object_id, metadata, source, created_at
+		`, subjectType, subjectID, relation, objectType, objectID, metadataJSON, source)
+		if err != nil {
+			return fmt.Errorf("failed to create relation: %w", err)
+		}
+		inserted, err := collectRelations(rows)
+		if err != nil {
+			return err
+		}
+		if len(inserted) > 0 {
+			rel, created = &inserted[0], true
+			return nil
+		}
+
+		// A concurrent write created it after the lookup above
+		return existing()
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if rel == nil {
+		return nil, false, fmt.Errorf("relation %s:%s %s %s:%s was deleted during the upsert",
+			subjectType, subjectID, relation, objectType, objectID)
+	}
+	return rel, created, nil
+}
@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dangerclosesec/supra/internal/budget"
+)
+
+// maxSubjectSetDepth bounds how many subject sets a check dereferences in a
+// chain, e.g. a group nested in a group, so a cycle of sets can't recurse
+// forever
+const maxSubjectSetDepth = 10
+
+// SubjectSet writes the subject ID of a relation granted to everyone holding
+// relation on an entity, e.g. SubjectSet("eng", "member") is "eng#member"
+// and (group:eng#member, viewer, document:d1) makes the members of group eng
+// viewers of d1
+func SubjectSet(id, relation string) string {
+	return id + "#" + relation
+}
+
+// ParseSubjectSet splits a subject ID written by SubjectSet into the
+// entity's ID and the relation. ok is false for a plain subject ID.
+func ParseSubjectSet(subjectID string) (id, relation string, ok bool) {
+	id, relation, ok = strings.Cut(subjectID, "#")
+	if !ok || id == "" || relation == "" {
+		return subjectID, "", false
+	}
+	return id, relation, true
+}
+
+// SubjectEntityID is the ID of the entity a relation's subject names, which
+// for a subject set is the entity whose relation holders it stands for
+func SubjectEntityID(subjectID string) string {
+	id, _, _ := ParseSubjectSet(subjectID)
+	return id
+}
+
+// checkSubjectSets reports whether the subject holds the relation on the
+// object through a subject set, by checking it holds the set's relation on
+// the set's entity. Sets are dereferenced the way direct relations are
+// checked, so sets of sets, e.g. a team's members added to a group, work to
+// maxSubjectSetDepth.
+func (g *IdentityGraph) checkSubjectSets(ctx context.Context,
+	subjectType, subjectID, relation, objectType, objectID string, depth int) (bool, error) {
+
+	if depth >= maxSubjectSetDepth {
+		return false, nil
+	}
+
+	if err := budget.Check(ctx); err != nil {
+		return false, err
+	}
+	dbCtx, cancel := budget.Database(ctx)
+	defer cancel()
+
+	rows, err := g.store.Query(dbCtx, g.statement(stmtSubjectSets), relation, objectType, objectID)
+	if err != nil {
+		return false, fmt.Errorf("failed to find subject sets: %w", err)
+	}
+	type subjectSet struct{ entityType, id, relation string }
+	var sets []subjectSet
+	for rows.Next() {
+		var setType, setID string
+		if err := rows.Scan(&setType, &setID); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan subject set: %w", err)
+		}
+		if id, setRelation, ok := ParseSubjectSet(setID); ok {
+			sets = append(sets, subjectSet{setType, id, setRelation})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to find subject sets: %w", err)
+	}
+
+	for _, set := range sets {
+		reachedDepth(ctx, depth+1)
+		member, err := g.checkDirectRelationDepth(ctx, subjectType, subjectID, set.relation, set.entityType, set.id, depth+1)
+		if err != nil || member {
+			return member, err
+		}
+	}
+	return false, nil
+}
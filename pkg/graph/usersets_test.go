@@ -0,0 +1,29 @@
+package graph
+
+import "testing"
+
+func TestParseSubjectSet(t *testing.T) {
+	tests := []struct {
+		subjectID    string
+		wantID       string
+		wantRelation string
+		wantOK       bool
+	}{
+		{"eng#member", "eng", "member", true},
+		{SubjectSet("eng", "member"), "eng", "member", true},
+		{"alice", "alice", "", false},
+		{"eng#", "eng#", "", false},
+		{"#member", "#member", "", false},
+	}
+
+	for _, tt := range tests {
+		id, relation, ok := ParseSubjectSet(tt.subjectID)
+		if id != tt.wantID || relation != tt.wantRelation || ok != tt.wantOK {
+			t.Errorf("ParseSubjectSet(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.subjectID, id, relation, ok, tt.wantID, tt.wantRelation, tt.wantOK)
+		}
+		if got := SubjectEntityID(tt.subjectID); got != tt.wantID {
+			t.Errorf("SubjectEntityID(%q) = %q, want %q", tt.subjectID, got, tt.wantID)
+		}
+	}
+}
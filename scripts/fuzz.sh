@@ -0,0 +1,31 @@
+#!/bin/bash
+# Runs every fuzz target for FUZZTIME (default 30s each). Go saves an input
+# that fails under the package's testdata/fuzz/<target> directory, where
+# plain `go test` replays it from then on: commit the file with the fix and
+# it stays a regression test.
+
+set -uo pipefail
+
+FUZZTIME="${FUZZTIME:-30s}"
+TARGETS=(
+  "./pkg/graph FuzzConditionParser"
+  "./permissions/parser FuzzParsePermissionModel"
+)
+
+cd "$(dirname "$0")/.."
+
+failed=0
+for entry in "${TARGETS[@]}"; do
+  read -r pkg target <<<"$entry"
+  echo "==> $target ($pkg, $FUZZTIME)"
+  if ! go test "$pkg" -run '^$' -fuzz "^${target}\$" -fuzztime "$FUZZTIME"; then
+    failed=1
+    echo "$target failed; new crashers:"
+    git status --porcelain --untracked-files=all -- "$pkg/testdata/fuzz/$target" | sed 's/^?? /  /'
+  fi
+done
+
+if [ "$failed" -ne 0 ]; then
+  echo "Reproduce with: go test <pkg> -run '<target>/<file>' -v"
+fi
+exit "$failed"
@@ -0,0 +1,249 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load balancing strategies
+const (
+	// StrategyRoundRobin sends requests to each healthy replica in turn
+	StrategyRoundRobin = "round_robin"
+	// StrategyLeastLoaded sends each request to the healthy replica with the
+	// fewest requests in flight
+	StrategyLeastLoaded = "least_loaded"
+)
+
+// LoadBalancerConfig controls how requests are spread over Config.BaseURLs
+type LoadBalancerConfig struct {
+	// Strategy picks the replica for each request; defaults to
+	// StrategyRoundRobin
+	Strategy string
+	// HealthCheckPath is probed on every replica; defaults to /health
+	HealthCheckPath string
+	// HealthCheckInterval is how often replicas are probed; defaults to 10s,
+	// and a negative value disables probing
+	HealthCheckInterval time.Duration
+	// FailureThreshold is how many consecutive failed requests or probes
+	// eject a replica; defaults to 3
+	FailureThreshold int
+	// EjectionTime is how long an ejected replica is skipped, unless a probe
+	// finds it healthy sooner; defaults to 30s
+	EjectionTime time.Duration
+}
+
+// DefaultLoadBalancerConfig returns the settings used for fields left zero
+func DefaultLoadBalancerConfig() *LoadBalancerConfig {
+	return &LoadBalancerConfig{
+		Strategy:            StrategyRoundRobin,
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: 10 * time.Second,
+		FailureThreshold:    3,
+		EjectionTime:        30 * time.Second,
+	}
+}
+
+// replica is one base URL and its health
+type replica struct {
+	base     *url.URL
+	inFlight atomic.Int64
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+}
+
+func (r *replica) available(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !now.Before(r.ejectedUntil)
+}
+
+// record updates the replica's health after a request or probe
+func (r *replica) record(ok bool, threshold int, ejection time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ok {
+		r.failures = 0
+		r.ejectedUntil = time.Time{}
+		return
+	}
+	r.failures++
+	if r.failures >= threshold {
+		r.ejectedUntil = time.Now().Add(ejection)
+	}
+}
+
+// balancer is an http.RoundTripper that sends each request to one of
+// several replicas. Requests are built against the first base URL and
+// rewritten to the chosen replica.
+type balancer struct {
+	config    LoadBalancerConfig
+	replicas  []*replica
+	transport http.RoundTripper
+	next      atomic.Uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newBalancer(baseURLs []string, config *LoadBalancerConfig, transport http.RoundTripper) (*balancer, error) {
+	defaults := DefaultLoadBalancerConfig()
+	cfg := *defaults
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.Strategy == "" {
+		cfg.Strategy = defaults.Strategy
+	}
+	if cfg.Strategy != StrategyRoundRobin && cfg.Strategy != StrategyLeastLoaded {
+		return nil, fmt.Errorf("unknown load balancing strategy %q", cfg.Strategy)
+	}
+	if cfg.HealthCheckPath == "" {
+		cfg.HealthCheckPath = defaults.HealthCheckPath
+	}
+	if cfg.HealthCheckInterval == 0 {
+		cfg.HealthCheckInterval = defaults.HealthCheckInterval
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaults.FailureThreshold
+	}
+	if cfg.EjectionTime <= 0 {
+		cfg.EjectionTime = defaults.EjectionTime
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	b := &balancer{config: cfg, transport: transport}
+	for _, raw := range baseURLs {
+		base, err := url.Parse(strings.TrimSuffix(raw, "/"))
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("invalid base URL %q", raw)
+		}
+		b.replicas = append(b.replicas, &replica{base: base})
+	}
+	if len(b.replicas) == 0 {
+		return nil, errors.New("at least one base URL is required")
+	}
+
+	if cfg.HealthCheckInterval > 0 {
+		b.stop = make(chan struct{})
+		b.done = make(chan struct{})
+		go b.probe()
+	}
+	return b, nil
+}
+
+// RoundTrip sends req to a replica. Connection errors and 502, 503 and 504
+// responses count against the replica's health.
+func (b *balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := b.pick()
+
+	out := req.Clone(req.Context())
+	out.URL.Scheme = r.base.Scheme
+	out.URL.Host = r.base.Host
+	out.URL.Path = r.base.Path + strings.TrimPrefix(req.URL.Path, b.replicas[0].base.Path)
+	out.URL.RawPath = ""
+	out.Host = ""
+
+	r.inFlight.Add(1)
+	resp, err := b.transport.RoundTrip(out)
+	r.inFlight.Add(-1)
+
+	failed := err != nil && req.Context().Err() == nil
+	if resp != nil {
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			failed = true
+		}
+	}
+	if err == nil || failed {
+		r.record(!failed, b.config.FailureThreshold, b.config.EjectionTime)
+	}
+	return resp, err
+}
+
+// pick chooses a replica that isn't ejected. When every replica is ejected
+// requests still go out, round robin, rather than failing outright.
+func (b *balancer) pick() *replica {
+	now := time.Now()
+	start := b.next.Add(1) - 1
+
+	var chosen *replica
+	for i := range b.replicas {
+		r := b.replicas[(start+uint64(i))%uint64(len(b.replicas))]
+		if !r.available(now) {
+			continue
+		}
+		if b.config.Strategy == StrategyRoundRobin {
+			return r
+		}
+		if chosen == nil || r.inFlight.Load() < chosen.inFlight.Load() {
+			chosen = r
+		}
+	}
+	if chosen == nil {
+		chosen = b.replicas[start%uint64(len(b.replicas))]
+	}
+	return chosen
+}
+
+// probe checks every replica's health endpoint until close is called
+func (b *balancer) probe() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var wg sync.WaitGroup
+		for _, r := range b.replicas {
+			wg.Add(1)
+			go func(r *replica) {
+				defer wg.Done()
+				r.record(b.healthy(r), b.config.FailureThreshold, b.config.EjectionTime)
+			}(r)
+		}
+		wg.Wait()
+	}
+}
+
+// healthy probes one replica, giving it up to the probe interval to answer
+func (b *balancer) healthy(r *replica) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.HealthCheckInterval)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.base.String()+b.config.HealthCheckPath, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := b.transport.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+func (b *balancer) close() {
+	if b.stop == nil {
+		return
+	}
+	close(b.stop)
+	<-b.done
+	b.stop = nil
+}
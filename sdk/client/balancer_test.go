@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// replicaServer answers permission checks and counts the ones it served
+func replicaServer(t *testing.T, status *atomic.Int32, served *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		served.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CheckPermissionResponse{Allowed: true})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func checkOnce(c *Client) error {
+	_, err := c.CheckPermission(context.Background(), &CheckPermissionRequest{
+		SubjectType: "user", SubjectID: "1", Permission: "read", ObjectType: "document", ObjectID: "2",
+	})
+	return err
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	var statusA, statusB, servedA, servedB atomic.Int32
+	statusA.Store(http.StatusOK)
+	statusB.Store(http.StatusOK)
+	a := replicaServer(t, &statusA, &servedA)
+	b := replicaServer(t, &statusB, &servedB)
+
+	c := NewClient(&Config{
+		BaseURLs:     []string{a.URL, b.URL},
+		LoadBalancer: &LoadBalancerConfig{HealthCheckInterval: -1},
+	})
+	defer c.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := checkOnce(c); err != nil {
+			t.Fatalf("CheckPermission() returned error: %v", err)
+		}
+	}
+	if servedA.Load() != 5 || servedB.Load() != 5 {
+		t.Errorf("served %d and %d requests, want 5 each", servedA.Load(), servedB.Load())
+	}
+}
+
+func TestLoadBalancerEjectsFailingReplica(t *testing.T) {
+	var statusA, statusB, servedA, servedB atomic.Int32
+	statusA.Store(http.StatusOK)
+	statusB.Store(http.StatusServiceUnavailable)
+	a := replicaServer(t, &statusA, &servedA)
+	b := replicaServer(t, &statusB, &servedB)
+
+	c := NewClient(&Config{
+		BaseURLs: []string{a.URL, b.URL},
+		LoadBalancer: &LoadBalancerConfig{
+			HealthCheckInterval: -1,
+			FailureThreshold:    2,
+			EjectionTime:        time.Hour,
+		},
+	})
+	defer c.Close()
+
+	failures := 0
+	for i := 0; i < 20; i++ {
+		if checkOnce(c) != nil {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Errorf("%d requests failed, want 2 before the replica is ejected", failures)
+	}
+	if servedA.Load() != 18 {
+		t.Errorf("healthy replica served %d requests, want 18", servedA.Load())
+	}
+}
+
+func TestLoadBalancerProbeRestoresReplica(t *testing.T) {
+	var statusA, statusB, servedA, servedB atomic.Int32
+	statusA.Store(http.StatusOK)
+	statusB.Store(http.StatusServiceUnavailable)
+	a := replicaServer(t, &statusA, &servedA)
+	b := replicaServer(t, &statusB, &servedB)
+
+	c := NewClient(&Config{
+		BaseURLs: []string{a.URL, b.URL},
+		LoadBalancer: &LoadBalancerConfig{
+			HealthCheckInterval: 10 * time.Millisecond,
+			FailureThreshold:    1,
+			EjectionTime:        time.Hour,
+		},
+	})
+	defer c.Close()
+
+	// The probe ejects the failing replica, then lets it back once it
+	// recovers
+	waitFor(t, func() bool { return !c.balancer.replicas[1].available(time.Now()) })
+	statusB.Store(http.StatusOK)
+	waitFor(t, func() bool { return c.balancer.replicas[1].available(time.Now()) })
+
+	for i := 0; i < 4; i++ {
+		if err := checkOnce(c); err != nil {
+			t.Fatalf("CheckPermission() returned error: %v", err)
+		}
+	}
+	if servedB.Load() == 0 {
+		t.Error("recovered replica served no requests")
+	}
+}
+
+func TestLoadBalancerLeastLoaded(t *testing.T) {
+	release := make(chan struct{})
+	var slowServed, fastServed atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowServed.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(CheckPermissionResponse{Allowed: true})
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastServed.Add(1)
+		json.NewEncoder(w).Encode(CheckPermissionResponse{Allowed: true})
+	}))
+	defer fast.Close()
+
+	c := NewClient(&Config{
+		BaseURLs:     []string{slow.URL, fast.URL},
+		LoadBalancer: &LoadBalancerConfig{Strategy: StrategyLeastLoaded, HealthCheckInterval: -1},
+	})
+	defer c.Close()
+
+	// Holds one request open on the slow replica
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		checkOnce(c)
+	}()
+	waitFor(t, func() bool { return slowServed.Load() == 1 })
+
+	for i := 0; i < 5; i++ {
+		if err := checkOnce(c); err != nil {
+			t.Fatalf("CheckPermission() returned error: %v", err)
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if fastServed.Load() != 5 {
+		t.Errorf("idle replica served %d requests, want all 5", fastServed.Load())
+	}
+}
+
+func TestLoadBalancerKeepsPathPrefix(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewEncoder(w).Encode(CheckPermissionResponse{Allowed: true})
+	}))
+	defer server.Close()
+
+	c := NewClient(&Config{
+		BaseURLs:     []string{"http://replica-a.invalid/authz", server.URL + "/authz/"},
+		LoadBalancer: &LoadBalancerConfig{HealthCheckInterval: -1, FailureThreshold: 1, EjectionTime: time.Hour},
+	})
+	defer c.Close()
+
+	// The first request fails on the unreachable replica and ejects it
+	checkOnce(c)
+	if err := checkOnce(c); err != nil {
+		t.Fatalf("CheckPermission() returned error: %v", err)
+	}
+	if path != "/authz/check" {
+		t.Errorf("request path = %q, want /authz/check", path)
+	}
+}
+
+func TestLoadBalancerInvalidConfig(t *testing.T) {
+	c := NewClient(&Config{
+		BaseURLs:     []string{"http://a.example.com"},
+		LoadBalancer: &LoadBalancerConfig{Strategy: "random"},
+	})
+	defer c.Close()
+
+	if err := checkOnce(c); err == nil {
+		t.Error("expected an invalid strategy to fail every call")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// maxCheckBatch is the most checks the service makes in one request
+const maxCheckBatch = 100
+
+// BatchItemError is why one item of a batch failed. Code is the service's
+// error code for it, such as permission_not_found or relation_exists.
+type BatchItemError struct {
+	Index   int
+	Code    string
+	Message string
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("item %d: %s: %s", e.Index, e.Code, e.Message)
+}
+
+// CheckResult is the decision of one check of a batch. Code and Error are
+// set when the check couldn't be made, in which case Allowed is false.
+type CheckResult struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CheckPermissionsResponse has one result per check, in request order
+type CheckPermissionsResponse struct {
+	Results []CheckResult `json:"results"`
+	// Failed counts the checks that couldn't be made
+	Failed int `json:"failed"`
+}
+
+// Err returns a *BatchItemError for each check that couldn't be made,
+// joined, or nil when every check was made
+func (r *CheckPermissionsResponse) Err() error {
+	var errs []error
+	for i, result := range r.Results {
+		if result.Code != "" || result.Error != "" {
+			errs = append(errs, &BatchItemError{Index: i, Code: result.Code, Message: result.Error})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckPermissions makes up to 100 checks in one request. A check that
+// can't be made, e.g. because its permission isn't defined, is reported in
+// its result without failing the others; the error returned is for the
+// request as a whole.
+func (c *Client) CheckPermissions(ctx context.Context, checks []CheckPermissionRequest) (*CheckPermissionsResponse, error) {
+	if len(checks) == 0 {
+		return nil, errors.New("checks cannot be empty")
+	}
+	if len(checks) > maxCheckBatch {
+		return nil, fmt.Errorf("at most %d checks can be made at once", maxCheckBatch)
+	}
+	for i, req := range checks {
+		if req.SubjectType == "" || req.SubjectID == "" || req.Permission == "" ||
+			req.ObjectType == "" || req.ObjectID == "" {
+			return nil, fmt.Errorf("checks[%d]: subject_type, subject_id, permission, object_type, and object_id are required", i)
+		}
+	}
+
+	var resp CheckPermissionsResponse
+	endpoint := c.endpointURL("/check/batch", nil)
+	if err := c.postIdempotent(ctx, endpoint, map[string]interface{}{"checks": checks}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RelationWrite creates or deletes one relation in a WriteRelations batch
+type RelationWrite = RelationshipOperation
+
+// Err returns a *BatchItemError for each operation WriteRelations couldn't
+// apply, joined, or nil when every operation was applied
+func (r *WriteRelationshipsResponse) Err() error {
+	var errs []error
+	for i, result := range r.Results {
+		if result.Code != "" || result.Error != "" {
+			errs = append(errs, &BatchItemError{Index: i, Code: result.Code, Message: result.Error})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteRelations applies up to 1000 relation creates and deletes, each on
+// its own: unlike WriteRelationships, an operation that fails, e.g. because
+// the relation already exists, is reported in its result and the others
+// are still applied.
+func (c *Client) WriteRelations(ctx context.Context, writes []RelationWrite) (*WriteRelationshipsResponse, error) {
+	if err := validateRelationshipOps(writes); err != nil {
+		return nil, err
+	}
+
+	endpoint := c.endpointURL("/relations/batch", nil)
+	req := struct {
+		Operations      []RelationWrite `json:"operations"`
+		ContinueOnError bool            `json:"continue_on_error"`
+	}{writes, true}
+	var resp WriteRelationshipsResponse
+	if err := c.post(ctx, endpoint, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
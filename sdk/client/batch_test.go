@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/check/batch" {
+			t.Errorf("Expected POST /check/batch, got %s %s", r.Method, r.URL.Path)
+		}
+
+		var req struct {
+			Checks []CheckPermissionRequest `json:"checks"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		resp := CheckPermissionsResponse{}
+		for _, check := range req.Checks {
+			switch check.Permission {
+			case "view":
+				resp.Results = append(resp.Results, CheckResult{Allowed: true, Reason: ReasonMatchedRelation})
+			default:
+				resp.Results = append(resp.Results, CheckResult{Code: "permission_not_found",
+					Error: "Permission definition not found: document." + check.Permission})
+				resp.Failed++
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	resp, err := client.CheckPermissions(context.Background(), []CheckPermissionRequest{
+		{SubjectType: "user", SubjectID: "123", Permission: "view", ObjectType: "document", ObjectID: "456"},
+		{SubjectType: "user", SubjectID: "123", Permission: "destroy", ObjectType: "document", ObjectID: "456"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(resp.Results) != 2 || !resp.Results[0].Allowed || resp.Results[1].Allowed || resp.Failed != 1 {
+		t.Errorf("Expected the first check allowed and the second failed, got %+v", resp)
+	}
+
+	var itemErr *BatchItemError
+	if err := resp.Err(); !errors.As(err, &itemErr) || itemErr.Index != 1 || itemErr.Code != "permission_not_found" {
+		t.Errorf("Expected a permission_not_found error for item 1, got %v", err)
+	}
+
+	if _, err := client.CheckPermissions(context.Background(), nil); err == nil {
+		t.Error("Expected error for no checks")
+	}
+	if _, err := client.CheckPermissions(context.Background(), []CheckPermissionRequest{{SubjectType: "user"}}); err == nil {
+		t.Error("Expected error for a check missing fields")
+	}
+	if _, err := client.CheckPermissions(context.Background(), make([]CheckPermissionRequest, maxCheckBatch+1)); err == nil {
+		t.Error("Expected error for too many checks")
+	}
+}
+
+func TestWriteRelations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/relations/batch" {
+			t.Errorf("Expected POST /relations/batch, got %s %s", r.Method, r.URL.Path)
+		}
+
+		var req struct {
+			Operations      []RelationWrite `json:"operations"`
+			ContinueOnError bool            `json:"continue_on_error"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if !req.ContinueOnError {
+			t.Error("Expected continue_on_error to be set")
+		}
+
+		resp := WriteRelationshipsResponse{}
+		for i, op := range req.Operations {
+			if i == 1 {
+				resp.Results = append(resp.Results, RelationshipResult{Op: op.Op, Code: "relation_exists",
+					Error: "relation already exists"})
+				resp.Failed++
+				continue
+			}
+			rel := &RelationResponse{SubjectType: op.SubjectType, SubjectID: op.SubjectID, Relation: op.Relation,
+				ObjectType: op.ObjectType, ObjectID: op.ObjectID}
+			resp.Results = append(resp.Results, RelationshipResult{Op: op.Op, Relation: rel})
+			resp.Created++
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	resp, err := client.WriteRelations(context.Background(), []RelationWrite{
+		{Op: RelationshipCreate, SubjectType: "user", SubjectID: "123", Relation: "owner", ObjectType: "document", ObjectID: "456"},
+		{Op: RelationshipCreate, SubjectType: "user", SubjectID: "123", Relation: "owner", ObjectType: "document", ObjectID: "456"},
+		{Op: RelationshipCreate, SubjectType: "user", SubjectID: "789", Relation: "viewer", ObjectType: "document", ObjectID: "456"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.Created != 2 || resp.Failed != 1 || resp.Results[2].Relation == nil {
+		t.Errorf("Expected 2 created and 1 failed, got %+v", resp)
+	}
+
+	var itemErr *BatchItemError
+	if err := resp.Err(); !errors.As(err, &itemErr) || itemErr.Index != 1 || itemErr.Code != "relation_exists" {
+		t.Errorf("Expected a relation_exists error for item 1, got %v", err)
+	}
+
+	if _, err := client.WriteRelations(context.Background(), []RelationWrite{{Op: "upsert"}}); err == nil {
+		t.Error("Expected error for an unknown op")
+	}
+}
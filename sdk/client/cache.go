@@ -0,0 +1,202 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CheckCacheConfig enables caching CheckPermission results in the client.
+// Cached decisions can be up to TTL old: writes made through the same
+// client clear the cache, but writes made elsewhere show up only once the
+// entries expire, so keep TTL short.
+type CheckCacheConfig struct {
+	// TTL is how long a result is reused; defaults to 5s
+	TTL time.Duration
+	// MaxEntries bounds the cache, evicting the least recently used
+	// results; defaults to 10000
+	MaxEntries int
+}
+
+// DefaultCheckCacheConfig returns the settings used for fields left zero
+func DefaultCheckCacheConfig() *CheckCacheConfig {
+	return &CheckCacheConfig{
+		TTL:        5 * time.Second,
+		MaxEntries: 10000,
+	}
+}
+
+// checkCache is an LRU of check results that also lets concurrent
+// identical checks share one request
+type checkCache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu sync.Mutex
+	// lru holds *cacheEntry values, most recently used first
+	lru      *list.List
+	entries  map[string]*list.Element
+	inflight map[string]*inflightCheck
+	// generation is bumped by purge so results of checks that were in
+	// flight during a write aren't cached
+	generation uint64
+}
+
+type cacheEntry struct {
+	key       string
+	resp      CheckPermissionResponse
+	expiresAt time.Time
+}
+
+type inflightCheck struct {
+	done chan struct{}
+	resp *CheckPermissionResponse
+	err  error
+}
+
+func newCheckCache(cfg *CheckCacheConfig) *checkCache {
+	defaults := DefaultCheckCacheConfig()
+	c := &checkCache{
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		inflight:   make(map[string]*inflightCheck),
+	}
+	if c.ttl <= 0 {
+		c.ttl = defaults.TTL
+	}
+	if c.maxEntries <= 0 {
+		c.maxEntries = defaults.MaxEntries
+	}
+	return c
+}
+
+// checkKey identifies a check by everything that affects its result. JSON
+// encodes map keys sorted, so equal contexts give equal keys.
+func checkKey(req *CheckPermissionRequest) (string, error) {
+	key, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// do returns the cached result for key, or runs check to get it. Callers
+// asking for a key while its check is in flight wait for that check rather
+// than sending their own. Only allowed and denied decisions are cached,
+// not errors.
+func (c *checkCache) do(ctx context.Context, key string, check func() (*CheckPermissionResponse, error)) (*CheckPermissionResponse, error) {
+	for {
+		c.mu.Lock()
+		if resp, ok := c.get(key); ok {
+			c.mu.Unlock()
+			return resp, nil
+		}
+
+		if call, ok := c.inflight[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-call.done:
+			}
+			// A check cut short by its caller's context says nothing about
+			// this caller's, so it makes its own
+			if errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded) {
+				continue
+			}
+			return copyCheckResponse(call.resp), call.err
+		}
+
+		call := &inflightCheck{done: make(chan struct{})}
+		c.inflight[key] = call
+		generation := c.generation
+		c.mu.Unlock()
+
+		call.resp, call.err = check()
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if call.err == nil && call.resp.Error == "" && generation == c.generation {
+			c.set(key, *call.resp)
+		}
+		c.mu.Unlock()
+		close(call.done)
+
+		return copyCheckResponse(call.resp), call.err
+	}
+}
+
+// get returns an unexpired entry, marking it recently used; c.mu is held
+func (c *checkCache) get(key string) (*CheckPermissionResponse, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return copyCheckResponse(&entry.resp), true
+}
+
+// set stores a result, evicting the least recently used entries over the
+// limit; c.mu is held
+func (c *checkCache) set(key string, resp CheckPermissionResponse) {
+	expiresAt := c.now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.resp, entry.expiresAt = resp, expiresAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, resp: resp, expiresAt: expiresAt})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// purge drops every cached result
+func (c *checkCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	clear(c.entries)
+	c.generation++
+}
+
+func (c *checkCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// copyCheckResponse keeps callers from changing a cached or shared result
+func copyCheckResponse(resp *CheckPermissionResponse) *CheckPermissionResponse {
+	if resp == nil {
+		return nil
+	}
+	dup := *resp
+	return &dup
+}
+
+// PurgeCheckCache drops the CheckPermission results the client has cached,
+// e.g. after writing relations through another client. It does nothing
+// when CheckCache isn't set.
+func (c *Client) PurgeCheckCache() {
+	if c.checkCache != nil {
+		c.checkCache.purge()
+	}
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// checkServer answers checks, counting them, and blocks each until release
+// is closed when it's set
+func checkServer(t *testing.T, release chan struct{}) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if release != nil {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"allowed":true}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestCheckCache(t *testing.T) {
+	server, calls := checkServer(t, nil)
+	client := NewClient(&Config{BaseURL: server.URL, CheckCache: &CheckCacheConfig{TTL: time.Minute}})
+	now := time.Now()
+	client.checkCache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.CheckPermission(context.Background(), checkReq)
+		if err != nil || !resp.Allowed {
+			t.Fatalf("Expected an allowed check, got %+v, %v", resp, err)
+		}
+		// Changing a result doesn't change the cached one
+		resp.Allowed = false
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected repeated checks to be served from the cache, got %d requests", calls.Load())
+	}
+
+	// A different context is a different check
+	withContext := *checkReq
+	withContext.Context = map[string]interface{}{"ip": "10.0.0.1"}
+	client.CheckPermission(context.Background(), &withContext)
+	if calls.Load() != 2 {
+		t.Errorf("Expected a check with context to miss the cache, got %d requests", calls.Load())
+	}
+
+	now = now.Add(time.Minute)
+	client.CheckPermission(context.Background(), checkReq)
+	if calls.Load() != 3 {
+		t.Errorf("Expected an expired result to be checked again, got %d requests", calls.Load())
+	}
+
+	// Writes through the client clear the cache
+	client.DeleteRelation(context.Background(), &DeleteRelationRequest{
+		SubjectType: "user", SubjectID: "alice", Relation: "viewer", ObjectType: "document", ObjectID: "doc1",
+	})
+	if client.checkCache.len() != 0 {
+		t.Errorf("Expected a write to clear the cache, got %d entries", client.checkCache.len())
+	}
+}
+
+func TestCheckCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	server, calls := checkServer(t, nil)
+	client := NewClient(&Config{BaseURL: server.URL, CheckCache: &CheckCacheConfig{MaxEntries: 2}})
+
+	check := func(objectID string) {
+		req := *checkReq
+		req.ObjectID = objectID
+		if _, err := client.CheckPermission(context.Background(), &req); err != nil {
+			t.Fatalf("Expected the check to succeed, got %v", err)
+		}
+	}
+
+	check("doc1")
+	check("doc2")
+	check("doc1")
+	check("doc3") // evicts doc2
+	check("doc1")
+	if calls.Load() != 3 {
+		t.Errorf("Expected doc1 to stay cached, got %d requests", calls.Load())
+	}
+	check("doc2")
+	if calls.Load() != 4 {
+		t.Errorf("Expected doc2 to have been evicted, got %d requests", calls.Load())
+	}
+}
+
+func TestCheckCacheSharesConcurrentChecks(t *testing.T) {
+	release := make(chan struct{})
+	server, calls := checkServer(t, release)
+	client := NewClient(&Config{BaseURL: server.URL, CheckCache: &CheckCacheConfig{}})
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := client.CheckPermission(context.Background(), checkReq); err == nil && resp.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+
+	// Let the first check reach the server before releasing it
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 || allowed.Load() != 10 {
+		t.Errorf("Expected 10 allowed checks from 1 request, got %d from %d", allowed.Load(), calls.Load())
+	}
+}
+
+func TestCheckCacheSkipsErrors(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusBadRequest, nil)
+	client := NewClient(&Config{BaseURL: server.URL, CheckCache: &CheckCacheConfig{}})
+
+	if _, err := client.CheckPermission(context.Background(), checkReq); err == nil {
+		t.Fatal("Expected the first check to fail")
+	}
+	if resp, err := client.CheckPermission(context.Background(), checkReq); err != nil || !resp.Allowed {
+		t.Errorf("Expected the failed check not to be cached, got %+v, %v", resp, err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 requests, got %d", calls.Load())
+	}
+}
@@ -7,7 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // Config represents the configuration for the permission client
@@ -18,6 +24,37 @@ type Config struct {
 	HTTPClient *http.Client
 	// Timeout is the default request timeout
 	Timeout time.Duration
+	// AdminToken is sent as a bearer token for administrative writes
+	AdminToken string
+	// APIKey authenticates the client to a service that enforces API keys;
+	// its scope decides whether the client may write or change the schema
+	APIKey string
+	// Principal is the type:id subject a delegated admin acts as; the
+	// service allows writes its admin scopes cover
+	Principal string
+	// Tenant is sent with every request so the service can meter usage
+	// per tenant
+	Tenant string
+	// BaseURLs lists replicas of the service to spread requests over,
+	// ejecting replicas that fail; when set it replaces BaseURL
+	BaseURLs []string
+	// LoadBalancer tunes how requests are spread over BaseURLs
+	LoadBalancer *LoadBalancerConfig
+	// RequiredContextFields are the context fields the application was
+	// built against, usually the ContextFields written by
+	// GenerateContextKeys. Connect fails if the server's schema no longer
+	// has one of them with the same type.
+	RequiredContextFields []ContextField
+	// Retry retries requests that are safe to repeat when they fail on a
+	// network error, a 429 or a 5xx; nil disables retries. Timeout bounds
+	// all attempts of a request together.
+	Retry *RetryPolicy
+	// Interceptors wrap every HTTP request, the first outermost, e.g. to
+	// add headers or tracing without replacing HTTPClient
+	Interceptors []RequestInterceptor
+	// CheckCache caches CheckPermission results and shares one request
+	// between concurrent identical checks; nil disables caching
+	CheckCache *CheckCacheConfig
 }
 
 // DefaultConfig returns the default configuration
@@ -26,16 +63,29 @@ func DefaultConfig() *Config {
 		BaseURL:    "http://localhost:4780",
 		HTTPClient: http.DefaultClient,
 		Timeout:    10 * time.Second,
+		Retry:      DefaultRetryPolicy(),
 	}
 }
 
 // Client is the permission service client
 type Client struct {
-	config *Config
-	client *http.Client
+	config   *Config
+	client   *http.Client
+	balancer *balancer
+	// invoke sends a request through the interceptors and client
+	invoke Invoker
+	// configErr is returned by every call when the configuration is invalid
+	configErr error
+	// checkCache is nil unless Config.CheckCache is set
+	checkCache *checkCache
+
+	schemaMu sync.RWMutex
+	schema   *ContextSchema
 }
 
-// NewClient creates a new permission client with the given configuration
+// NewClient creates a new permission client with the given configuration.
+// A client with several BaseURLs probes their health in the background
+// until Close is called.
 func NewClient(config *Config) *Client {
 	if config == nil {
 		config = DefaultConfig()
@@ -46,10 +96,41 @@ func NewClient(config *Config) *Client {
 		client = http.DefaultClient
 	}
 
-	return &Client{
+	c := &Client{
 		config: config,
 		client: client,
 	}
+	if config.CheckCache != nil {
+		c.checkCache = newCheckCache(config.CheckCache)
+	}
+
+	if len(config.BaseURLs) > 0 {
+		b, err := newBalancer(config.BaseURLs, config.LoadBalancer, client.Transport)
+		if err != nil {
+			c.configErr = fmt.Errorf("invalid load balancer configuration: %w", err)
+			return c
+		}
+
+		// Requests are built against the first replica and rewritten by
+		// the balancer
+		balanced := *client
+		balanced.Transport = b
+		cfg := *config
+		cfg.BaseURL = b.replicas[0].base.String()
+
+		c.config, c.client, c.balancer = &cfg, &balanced, b
+	}
+
+	c.invoke = chainInterceptors(c.client.Do, config.Interceptors)
+	return c
+}
+
+// Close stops background health probing. The client must not be used
+// afterwards.
+func (c *Client) Close() {
+	if c.balancer != nil {
+		c.balancer.close()
+	}
 }
 
 // CheckPermissionRequest represents a permission check request
@@ -60,15 +141,44 @@ type CheckPermissionRequest struct {
 	ObjectType  string                 `json:"object_type"`
 	ObjectID    string                 `json:"object_id"`
 	Context     map[string]interface{} `json:"context,omitempty"`
+	// AsOf evaluates entity attributes as they were at this time
+	AsOf *time.Time `json:"as_of,omitempty"`
+	// SchemaVersion pins the check to a schema version, so checks made
+	// while the schema changes agree with each other; see SchemaVersions
+	SchemaVersion int `json:"schema_version,omitempty"`
 }
 
 // CheckPermissionResponse represents a permission check response
 type CheckPermissionResponse struct {
-	Allowed bool   `json:"allowed"`
-	Error   string `json:"error,omitempty"`
+	Allowed bool `json:"allowed"`
+	// Reason is a stable code explaining the decision; see the Reason
+	// constants
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
 }
 
-// CheckPermission checks if a subject has permission on an object
+// Decision reason codes returned in CheckPermissionResponse.Reason. Rule and
+// hook reasons are followed by a colon and the rule or hook name, e.g.
+// matched_rule:isOwner.
+const (
+	ReasonMatchedRelation        = "matched_relation"
+	ReasonMatchedRule            = "matched_rule"
+	ReasonMatchedAttribute       = "matched_attribute"
+	ReasonMatchedContext         = "matched_context"
+	ReasonMatchedCondition       = "matched_condition"
+	ReasonMatchedNegation        = "matched_negation"
+	ReasonDeniedNoPath           = "denied_no_path"
+	ReasonDeniedByRule           = "denied_by_rule"
+	ReasonDeniedMissingAttribute = "denied_missing_attribute"
+	ReasonDeniedMissingContext   = "denied_missing_context"
+	ReasonDeniedByCondition      = "denied_by_condition"
+	ReasonDeniedByExclusion      = "denied_by_exclusion"
+	ReasonUnknownPermission      = "unknown_permission"
+	ReasonHook                   = "hook"
+)
+
+// CheckPermission checks if a subject has permission on an object. With
+// CheckCache set, recent results are reused.
 func (c *Client) CheckPermission(ctx context.Context, req *CheckPermissionRequest) (*CheckPermissionResponse, error) {
 	if req == nil {
 		return nil, errors.New("request cannot be nil")
@@ -80,8 +190,186 @@ func (c *Client) CheckPermission(ctx context.Context, req *CheckPermissionReques
 		return nil, errors.New("subject_type, subject_id, permission, object_type, and object_id are required")
 	}
 
-	endpoint := fmt.Sprintf("%s/check", c.config.BaseURL)
-	return c.doRequest(ctx, endpoint, req)
+	endpoint := c.endpointURL("/check", nil)
+	if c.checkCache == nil {
+		return c.doRequest(ctx, endpoint, req)
+	}
+
+	key, err := checkKey(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return c.checkCache.do(ctx, key, func() (*CheckPermissionResponse, error) {
+		return c.doRequest(ctx, endpoint, req)
+	})
+}
+
+// WarmChecksResponse reports how many distinct checks the service is warming
+type WarmChecksResponse struct {
+	Accepted int `json:"accepted"`
+}
+
+// WarmChecks asks the service to run checks the caller expects to make soon,
+// e.g. before rendering a page, so caches are loaded by the time they are
+// made. It returns as soon as the service has accepted them; the results
+// are not reported.
+func (c *Client) WarmChecks(ctx context.Context, checks []CheckPermissionRequest) (*WarmChecksResponse, error) {
+	if len(checks) == 0 {
+		return nil, errors.New("checks cannot be empty")
+	}
+	for i, req := range checks {
+		if req.SubjectType == "" || req.SubjectID == "" || req.Permission == "" ||
+			req.ObjectType == "" || req.ObjectID == "" {
+			return nil, fmt.Errorf("checks[%d]: subject_type, subject_id, permission, object_type, and object_id are required", i)
+		}
+	}
+
+	var resp WarmChecksResponse
+	endpoint := c.endpointURL("/check/warm", nil)
+	if err := c.postIdempotent(ctx, endpoint, map[string]interface{}{"checks": checks}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LookupObjectsRequest asks which objects of a type a subject has a
+// permission on
+type LookupObjectsRequest struct {
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Permission  string                 `json:"permission"`
+	ObjectType  string                 `json:"object_type"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	// Limit is the page size; the service defaults to 100 and allows up
+	// to 1000
+	Limit int `json:"limit,omitempty"`
+	// Cursor is the NextCursor of the previous page
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// LookupObjectsResponse is a page of object IDs in ascending order.
+// NextCursor is empty on the last page.
+type LookupObjectsResponse struct {
+	ObjectIDs  []string `json:"object_ids"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// LookupObjects lists the objects of a type the subject has a permission
+// on, one page at a time, e.g. to filter a list view without checking each
+// row
+func (c *Client) LookupObjects(ctx context.Context, req *LookupObjectsRequest) (*LookupObjectsResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	if req.SubjectType == "" || req.SubjectID == "" || req.Permission == "" || req.ObjectType == "" {
+		return nil, errors.New("subject_type, subject_id, permission, and object_type are required")
+	}
+
+	var resp LookupObjectsResponse
+	endpoint := c.endpointURL("/lookup-objects", nil)
+	if err := c.postIdempotent(ctx, endpoint, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LookupSubjectsRequest asks who has a permission on an object.
+// SubjectType, when set, limits the results to subjects of that type.
+type LookupSubjectsRequest struct {
+	Permission  string                 `json:"permission"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	SubjectType string                 `json:"subject_type,omitempty"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	Limit       int                    `json:"limit,omitempty"`
+	Cursor      string                 `json:"cursor,omitempty"`
+}
+
+// AnySubjectID is the ID of a LookupSubject standing for every subject of
+// its type, granted the permission by the object's attributes
+const AnySubjectID = "*"
+
+// LookupSubject is a subject holding the permission, with the relation
+// paths that grant it, e.g. "owner" or "parent -> folder:f1#view -> viewer"
+type LookupSubject struct {
+	Type   string   `json:"type"`
+	ID     string   `json:"id"`
+	Grants []string `json:"grants"`
+}
+
+// LookupSubjectsResponse is a page of subjects ordered by type and ID.
+// NextCursor is empty on the last page.
+type LookupSubjectsResponse struct {
+	Subjects   []LookupSubject `json:"subjects"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// LookupSubjects lists who holds a permission on an object and how, one
+// page at a time, e.g. for an access review
+func (c *Client) LookupSubjects(ctx context.Context, req *LookupSubjectsRequest) (*LookupSubjectsResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	if req.Permission == "" || req.ObjectType == "" || req.ObjectID == "" {
+		return nil, errors.New("permission, object_type, and object_id are required")
+	}
+
+	var resp LookupSubjectsResponse
+	endpoint := c.endpointURL("/lookup-subjects", nil)
+	if err := c.postIdempotent(ctx, endpoint, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExpandRequest names the object#permission to expand
+type ExpandRequest struct {
+	ObjectType string `json:"object_type"`
+	ObjectID   string `json:"object_id"`
+	Permission string `json:"permission"`
+}
+
+// Expand node kinds
+const (
+	ExpandPermission   = "permission"
+	ExpandUnion        = "union"
+	ExpandIntersection = "intersection"
+	ExpandExclusion    = "exclusion"
+	ExpandRelation     = "relation"
+	ExpandInherited    = "inherited"
+	ExpandCondition    = "condition"
+)
+
+// ExpandNode is one node of an expanded permission tree. Relation nodes
+// list the subjects holding the relation as type:id, with type:* when
+// every subject of the type holds it; condition nodes (rules, attributes,
+// context) depend on the subject and list none.
+type ExpandNode struct {
+	Kind       string        `json:"kind"`
+	Expression string        `json:"expression"`
+	Object     string        `json:"object"`
+	Permission string        `json:"permission,omitempty"`
+	Subjects   []string      `json:"subjects,omitempty"`
+	Children   []*ExpandNode `json:"children,omitempty"`
+	Truncated  bool          `json:"truncated,omitempty"`
+}
+
+// Expand returns the evaluated tree of a permission on an object: its
+// unions, intersections and relations, with the subjects at each relation
+func (c *Client) Expand(ctx context.Context, req *ExpandRequest) (*ExpandNode, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	if req.ObjectType == "" || req.ObjectID == "" || req.Permission == "" {
+		return nil, errors.New("object_type, object_id, and permission are required")
+	}
+
+	var resp ExpandNode
+	endpoint := c.endpointURL("/expand", nil)
+	if err := c.postIdempotent(ctx, endpoint, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
 }
 
 // CreateEntityRequest represents an entity creation request
@@ -89,6 +377,9 @@ type CreateEntityRequest struct {
 	Type       string                 `json:"type"`
 	ExternalID string                 `json:"external_id"`
 	Properties map[string]interface{} `json:"properties"`
+	// Upsert replaces the properties of an existing entity; UpsertEntity
+	// sets it
+	Upsert bool `json:"upsert,omitempty"`
 }
 
 // EntityResponse represents an entity response
@@ -99,9 +390,19 @@ type EntityResponse struct {
 	Properties map[string]interface{} `json:"properties"`
 	CreatedAt  time.Time              `json:"created_at"`
 	UpdatedAt  time.Time              `json:"updated_at"`
-	Error      string                 `json:"error,omitempty"`
+	// Status is WriteCreated, or WriteUpdated when UpsertEntity replaced
+	// the properties of an existing entity
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
 }
 
+// Write statuses of entity and relation responses
+const (
+	WriteCreated  = "created"
+	WriteUpdated  = "updated"
+	WriteExisting = "existing"
+)
+
 // CreateEntity creates a new entity
 func (c *Client) CreateEntity(ctx context.Context, req *CreateEntityRequest) (*EntityResponse, error) {
 	if req == nil {
@@ -113,7 +414,7 @@ func (c *Client) CreateEntity(ctx context.Context, req *CreateEntityRequest) (*E
 		return nil, errors.New("type and external_id are required")
 	}
 
-	endpoint := fmt.Sprintf("%s/entity", c.config.BaseURL)
+	endpoint := c.endpointURL("/entity", nil)
 	var resp EntityResponse
 	err := c.post(ctx, endpoint, req, &resp)
 
@@ -141,13 +442,41 @@ func (c *Client) CreateEntity(ctx context.Context, req *CreateEntityRequest) (*E
 	return &resp, nil
 }
 
+// UpsertEntity creates an entity, or replaces the properties of the
+// existing one with the same type and external ID
+func (c *Client) UpsertEntity(ctx context.Context, req *CreateEntityRequest) (*EntityResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+
+	if req.Type == "" || req.ExternalID == "" {
+		return nil, errors.New("type and external_id are required")
+	}
+
+	upsert := *req
+	upsert.Upsert = true
+
+	endpoint := c.endpointURL("/entity", nil)
+	var resp EntityResponse
+	defer c.PurgeCheckCache()
+	if err := c.postIdempotent(ctx, endpoint, &upsert, &resp); err != nil {
+		return nil, fmt.Errorf("failed to upsert entity: %w", err)
+	}
+
+	if resp.Error != "" {
+		return &resp, errors.New(resp.Error)
+	}
+
+	return &resp, nil
+}
+
 // GetEntity retrieves an entity by type and external ID
 func (c *Client) GetEntity(ctx context.Context, entityType, externalID string) (*EntityResponse, error) {
 	if entityType == "" || externalID == "" {
 		return nil, errors.New("entity_type and external_id are required")
 	}
 
-	endpoint := fmt.Sprintf("%s/entity?type=%s&id=%s", c.config.BaseURL, entityType, externalID)
+	endpoint := c.endpointURL("/entity", entityQuery(entityType, externalID))
 	var resp EntityResponse
 	err := c.get(ctx, endpoint, &resp)
 	if err != nil {
@@ -161,6 +490,169 @@ func (c *Client) GetEntity(ctx context.Context, entityType, externalID string) (
 	return &resp, nil
 }
 
+// EntityKey names an entity by type and external ID
+type EntityKey struct {
+	Type       string `json:"type"`
+	ExternalID string `json:"id"`
+}
+
+// GetEntitiesResponse has the entities found, in request order, and the
+// keys that matched none
+type GetEntitiesResponse struct {
+	Entities []EntityResponse `json:"entities"`
+	Missing  []EntityKey      `json:"missing"`
+}
+
+// maxEntityBatch is the most entities the service retrieves at once
+const maxEntityBatch = 1000
+
+// GetEntities retrieves many entities in as few round trips as possible,
+// splitting keys into batches the service accepts. A missing entity is
+// listed in Missing rather than failing the call.
+func (c *Client) GetEntities(ctx context.Context, keys []EntityKey) (*GetEntitiesResponse, error) {
+	for i, key := range keys {
+		if key.Type == "" || key.ExternalID == "" {
+			return nil, fmt.Errorf("keys[%d]: type and id are required", i)
+		}
+	}
+
+	endpoint := c.endpointURL("/entities/batch", nil)
+	result := &GetEntitiesResponse{Entities: []EntityResponse{}, Missing: []EntityKey{}}
+	for start := 0; start < len(keys); start += maxEntityBatch {
+		end := min(start+maxEntityBatch, len(keys))
+		req := struct {
+			Entities []EntityKey `json:"entities"`
+		}{keys[start:end]}
+		var resp GetEntitiesResponse
+		if err := c.postIdempotent(ctx, endpoint, req, &resp); err != nil {
+			return nil, err
+		}
+		result.Entities = append(result.Entities, resp.Entities...)
+		result.Missing = append(result.Missing, resp.Missing...)
+	}
+	return result, nil
+}
+
+// AttributeVersion is one value an entity attribute held and the range it
+// was valid for. ValidTo is nil for the current value.
+type AttributeVersion struct {
+	Attribute string      `json:"attribute"`
+	Value     interface{} `json:"value"`
+	ValidFrom time.Time   `json:"valid_from"`
+	ValidTo   *time.Time  `json:"valid_to,omitempty"`
+}
+
+// AttributeHistoryResponse lists the values an entity's attributes have held
+type AttributeHistoryResponse struct {
+	Type       string             `json:"type"`
+	ExternalID string             `json:"external_id"`
+	Versions   []AttributeVersion `json:"versions"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// GetAttributeHistory retrieves the recorded values of an entity's
+// attributes, oldest first. An empty attribute returns all of them.
+func (c *Client) GetAttributeHistory(ctx context.Context, entityType, externalID, attribute string) (*AttributeHistoryResponse, error) {
+	if entityType == "" || externalID == "" {
+		return nil, errors.New("entity_type and external_id are required")
+	}
+
+	query := entityQuery(entityType, externalID)
+	if attribute != "" {
+		query.Set("attribute", attribute)
+	}
+	endpoint := c.endpointURL("/entity/attributes/history", query)
+	var resp AttributeHistoryResponse
+	if err := c.get(ctx, endpoint, &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Error != "" {
+		return &resp, errors.New(resp.Error)
+	}
+
+	return &resp, nil
+}
+
+// SetAttributeRequest sets an attribute the schema declares on an entity's
+// type, e.g. "attribute public boolean". Value must be of the declared data
+// type or convertible to it, like "true" for a boolean.
+type SetAttributeRequest struct {
+	Type       string      `json:"type"`
+	ExternalID string      `json:"external_id"`
+	Attribute  string      `json:"attribute"`
+	Value      interface{} `json:"value"`
+}
+
+// TypedAttribute is the stored value of a declared attribute. Integers come
+// back as float64, as JSON numbers do.
+type TypedAttribute struct {
+	EntityType string      `json:"entity_type"`
+	EntityID   string      `json:"entity_id"`
+	Attribute  string      `json:"attribute"`
+	DataType   string      `json:"data_type"`
+	Value      interface{} `json:"value"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// AttributesResponse lists the typed attributes of an entity
+type AttributesResponse struct {
+	Type       string           `json:"type"`
+	ExternalID string           `json:"external_id"`
+	Attributes []TypedAttribute `json:"attributes"`
+}
+
+// SetAttribute stores a typed attribute of an entity, which checks read in
+// preference to a property of the same name
+func (c *Client) SetAttribute(ctx context.Context, req *SetAttributeRequest) (*TypedAttribute, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	if req.Type == "" || req.ExternalID == "" || req.Attribute == "" {
+		return nil, errors.New("type, external_id and attribute are required")
+	}
+
+	endpoint := c.endpointURL("/attribute", nil)
+	var resp TypedAttribute
+	if err := c.post(ctx, endpoint, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetAttributes retrieves the typed attributes of an entity
+func (c *Client) GetAttributes(ctx context.Context, entityType, externalID string) (*AttributesResponse, error) {
+	if entityType == "" || externalID == "" {
+		return nil, errors.New("entity_type and external_id are required")
+	}
+
+	endpoint := c.endpointURL("/attribute", entityQuery(entityType, externalID))
+	var resp AttributesResponse
+	if err := c.get(ctx, endpoint, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteAttribute removes a typed attribute from an entity
+func (c *Client) DeleteAttribute(ctx context.Context, entityType, externalID, attribute string) error {
+	if entityType == "" || externalID == "" || attribute == "" {
+		return errors.New("entity_type, external_id and attribute are required")
+	}
+
+	query := entityQuery(entityType, externalID)
+	query.Set("attribute", attribute)
+	endpoint := c.endpointURL("/attribute", query)
+	return c.delete(ctx, endpoint)
+}
+
+// SubjectSet is the SubjectID of a subject set, the subjects holding
+// relation on an entity, e.g. SubjectSet("eng", "member") with SubjectType
+// "group" grants a relation to every member of group eng
+func SubjectSet(id, relation string) string {
+	return id + "#" + relation
+}
+
 // CreateRelationRequest represents a relation creation request
 type CreateRelationRequest struct {
 	SubjectType string `json:"subject_type"`
@@ -168,18 +660,33 @@ type CreateRelationRequest struct {
 	Relation    string `json:"relation"`
 	ObjectType  string `json:"object_type"`
 	ObjectID    string `json:"object_id"`
+	// Metadata records who granted the relation and why, e.g. granted_by,
+	// reason, ticket_url and source
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Source names the integration writing the relation, e.g. scim or
+	// import:batch-42, so RevokeRelationSource can remove its relations
+	// together. The service defaults it to manual.
+	Source string `json:"source,omitempty"`
+	// Upsert returns an existing relation instead of failing;
+	// UpsertRelation sets it
+	Upsert bool `json:"upsert,omitempty"`
 }
 
 // RelationResponse represents a relation response
 type RelationResponse struct {
-	ID          int64     `json:"id"`
-	SubjectType string    `json:"subject_type"`
-	SubjectID   string    `json:"subject_id"`
-	Relation    string    `json:"relation"`
-	ObjectType  string    `json:"object_type"`
-	ObjectID    string    `json:"object_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	Error       string    `json:"error,omitempty"`
+	ID          int64                  `json:"id"`
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Relation    string                 `json:"relation"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Source      string                 `json:"source,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	// Status is WriteCreated, or WriteExisting when UpsertRelation found
+	// the relation already stored
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
 }
 
 // CreateRelation creates a new relation between entities
@@ -194,7 +701,7 @@ func (c *Client) CreateRelation(ctx context.Context, req *CreateRelationRequest)
 		return nil, errors.New("subject_type, subject_id, relation, object_type, and object_id are required")
 	}
 
-	endpoint := fmt.Sprintf("%s/relation", c.config.BaseURL)
+	endpoint := c.endpointURL("/relation", nil)
 	var resp RelationResponse
 	err := c.post(ctx, endpoint, req, &resp)
 	if err != nil {
@@ -208,6 +715,36 @@ func (c *Client) CreateRelation(ctx context.Context, req *CreateRelationRequest)
 	return &resp, nil
 }
 
+// UpsertRelation creates a relation, or returns the stored one when it
+// already exists, so writes can be retried and replayed safely. The
+// stored relation's metadata is kept.
+func (c *Client) UpsertRelation(ctx context.Context, req *CreateRelationRequest) (*RelationResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+
+	if req.SubjectType == "" || req.SubjectID == "" || req.Relation == "" ||
+		req.ObjectType == "" || req.ObjectID == "" {
+		return nil, errors.New("subject_type, subject_id, relation, object_type, and object_id are required")
+	}
+
+	upsert := *req
+	upsert.Upsert = true
+
+	endpoint := c.endpointURL("/relation", nil)
+	var resp RelationResponse
+	defer c.PurgeCheckCache()
+	if err := c.postIdempotent(ctx, endpoint, &upsert, &resp); err != nil {
+		return nil, fmt.Errorf("failed to upsert relation: %w", err)
+	}
+
+	if resp.Error != "" {
+		return &resp, errors.New(resp.Error)
+	}
+
+	return &resp, nil
+}
+
 // TestRelationRequest represents a relation test request
 type TestRelationRequest struct {
 	SubjectType string `json:"subject_type"`
@@ -238,9 +775,9 @@ func (c *Client) TestRelation(ctx context.Context, req *TestRelationRequest) (*T
 		return nil, errors.New("subject_type, subject_id, relation, object_type, and object_id are required")
 	}
 
-	endpoint := fmt.Sprintf("%s/test-relation", c.config.BaseURL)
+	endpoint := c.endpointURL("/test-relation", nil)
 	var resp TestRelationResponse
-	err := c.post(ctx, endpoint, req, &resp)
+	err := c.postIdempotent(ctx, endpoint, req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -282,7 +819,7 @@ func (c *Client) CreatePermission(ctx context.Context, req *CreatePermissionRequ
 		return nil, errors.New("entity_type, permission_name, and condition_expression are required")
 	}
 
-	endpoint := fmt.Sprintf("%s/permission", c.config.BaseURL)
+	endpoint := c.endpointURL("/permission", nil)
 	var resp PermissionResponse
 	err := c.post(ctx, endpoint, req, &resp)
 	if err != nil {
@@ -319,9 +856,9 @@ func (c *Client) TestRule(ctx context.Context, req *TestRuleRequest) (*TestRuleR
 		return nil, errors.New("rule_name is required")
 	}
 
-	endpoint := fmt.Sprintf("%s/api/test-rule", c.config.BaseURL)
+	endpoint := c.endpointURL("/api/test-rule", nil)
 	var resp TestRuleResponse
-	err := c.post(ctx, endpoint, req, &resp)
+	err := c.postIdempotent(ctx, endpoint, req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -350,7 +887,7 @@ type PermissionDefinition struct {
 
 // ListPermissionDefinitions lists all permission definitions
 func (c *Client) ListPermissionDefinitions(ctx context.Context) ([]PermissionDefinition, error) {
-	endpoint := fmt.Sprintf("%s/api/permission-definitions", c.config.BaseURL)
+	endpoint := c.endpointURL("/api/permission-definitions", nil)
 	var resp []PermissionDefinition
 	err := c.get(ctx, endpoint, &resp)
 	if err != nil {
@@ -383,7 +920,7 @@ type ParameterDefinition struct {
 
 // ListRuleDefinitions lists all rule definitions
 func (c *Client) ListRuleDefinitions(ctx context.Context) ([]RuleDefinition, error) {
-	endpoint := fmt.Sprintf("%s/api/rule-definitions", c.config.BaseURL)
+	endpoint := c.endpointURL("/api/rule-definitions", nil)
 	var resp []RuleDefinition
 	err := c.get(ctx, endpoint, &resp)
 	if err != nil {
@@ -405,10 +942,73 @@ func (c *Client) DeleteEntity(ctx context.Context, entityType, externalID string
 		return errors.New("entity_type and external_id are required")
 	}
 
-	endpoint := fmt.Sprintf("%s/entity?type=%s&id=%s", c.config.BaseURL, entityType, externalID)
+	endpoint := c.endpointURL("/entity", entityQuery(entityType, externalID))
 	return c.delete(ctx, endpoint)
 }
 
+// DeleteEntityCascade deletes an entity together with every relation it is
+// the subject or object of, in one transaction. DeleteEntity fails with a
+// conflict for an entity that relations still refer to.
+func (c *Client) DeleteEntityCascade(ctx context.Context, entityType, externalID string) error {
+	if entityType == "" || externalID == "" {
+		return errors.New("entity_type and external_id are required")
+	}
+
+	query := entityQuery(entityType, externalID)
+	query.Set("cascade", "true")
+	endpoint := c.endpointURL("/entity", query)
+	return c.delete(ctx, endpoint)
+}
+
+// ListRelationsRequest selects relations by subject, object or both;
+// Relation and Source narrow the selection
+type ListRelationsRequest struct {
+	SubjectType string
+	SubjectID   string
+	Relation    string
+	ObjectType  string
+	ObjectID    string
+	Source      string
+}
+
+// ListRelationsResponse has the relations a ListRelations call matched
+type ListRelationsResponse struct {
+	Relations []RelationResponse `json:"relations"`
+}
+
+// ListRelations lists the relations of a subject or an object, oldest first
+func (c *Client) ListRelations(ctx context.Context, req *ListRelationsRequest) ([]RelationResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+
+	hasSubject := req.SubjectType != "" && req.SubjectID != ""
+	hasObject := req.ObjectType != "" && req.ObjectID != ""
+	if !hasSubject && !hasObject {
+		return nil, errors.New("subject_type and subject_id, or object_type and object_id, are required")
+	}
+
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"subject_type": req.SubjectType,
+		"subject_id":   req.SubjectID,
+		"relation":     req.Relation,
+		"object_type":  req.ObjectType,
+		"object_id":    req.ObjectID,
+		"source":       req.Source,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	var resp ListRelationsResponse
+	if err := c.get(ctx, c.endpointURL("/relation", query), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Relations, nil
+}
+
 // DeleteRelationRequest represents a relation deletion request
 type DeleteRelationRequest struct {
 	SubjectType string `json:"subject_type"`
@@ -431,12 +1031,99 @@ func (c *Client) DeleteRelation(ctx context.Context, req *DeleteRelationRequest)
 	}
 
 	// Construct query parameters
-	endpoint := fmt.Sprintf("%s/relation?subject_type=%s&subject_id=%s&relation=%s&object_type=%s&object_id=%s",
-		c.config.BaseURL, req.SubjectType, req.SubjectID, req.Relation, req.ObjectType, req.ObjectID)
+	endpoint := c.endpointURL("/relation", url.Values{
+		"subject_type": {req.SubjectType},
+		"subject_id":   {req.SubjectID},
+		"relation":     {req.Relation},
+		"object_type":  {req.ObjectType},
+		"object_id":    {req.ObjectID},
+	})
 
 	return c.delete(ctx, endpoint)
 }
 
+// Relationship operations for WriteRelationships
+const (
+	RelationshipCreate = "create"
+	RelationshipDelete = "delete"
+)
+
+// RelationshipOperation creates or deletes one relation in a
+// WriteRelationships batch. Metadata and Source are only stored by
+// creates.
+type RelationshipOperation struct {
+	Op          string                 `json:"op"`
+	SubjectType string                 `json:"subject_type"`
+	SubjectID   string                 `json:"subject_id"`
+	Relation    string                 `json:"relation"`
+	ObjectType  string                 `json:"object_type"`
+	ObjectID    string                 `json:"object_id"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Source      string                 `json:"source,omitempty"`
+}
+
+// WriteRelationshipsResponse has one result per operation, in order
+type WriteRelationshipsResponse struct {
+	Created int                  `json:"created"`
+	Deleted int                  `json:"deleted"`
+	Results []RelationshipResult `json:"results"`
+	// Failed counts the operations WriteRelations couldn't apply
+	Failed int `json:"failed,omitempty"`
+}
+
+// RelationshipResult is the relation an operation created or deleted;
+// Relation is nil for a delete of a relation that didn't exist. Code and
+// Error are set on an operation WriteRelations couldn't apply.
+type RelationshipResult struct {
+	Op       string            `json:"op"`
+	Relation *RelationResponse `json:"relation,omitempty"`
+	Code     string            `json:"code,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// maxRelationshipBatch is the most operations the service applies at once
+const maxRelationshipBatch = 1000
+
+// WriteRelationships applies up to 1000 relation creates and deletes
+// atomically: if one fails, the service applies none of them and the
+// returned *APIError names the failing operation.
+func (c *Client) WriteRelationships(ctx context.Context, ops []RelationshipOperation) (*WriteRelationshipsResponse, error) {
+	if err := validateRelationshipOps(ops); err != nil {
+		return nil, err
+	}
+
+	endpoint := c.endpointURL("/relations/batch", nil)
+	req := struct {
+		Operations []RelationshipOperation `json:"operations"`
+	}{ops}
+	var resp WriteRelationshipsResponse
+	if err := c.post(ctx, endpoint, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// validateRelationshipOps checks a batch of relation writes before it is
+// sent
+func validateRelationshipOps(ops []RelationshipOperation) error {
+	if len(ops) == 0 {
+		return errors.New("at least one operation is required")
+	}
+	if len(ops) > maxRelationshipBatch {
+		return fmt.Errorf("at most %d operations can be written at once", maxRelationshipBatch)
+	}
+	for i, op := range ops {
+		if op.Op != RelationshipCreate && op.Op != RelationshipDelete {
+			return fmt.Errorf("operation %d: op must be %q or %q", i, RelationshipCreate, RelationshipDelete)
+		}
+		if op.SubjectType == "" || op.SubjectID == "" || op.Relation == "" ||
+			op.ObjectType == "" || op.ObjectID == "" {
+			return fmt.Errorf("operation %d: subject_type, subject_id, relation, object_type, and object_id are required", i)
+		}
+	}
+	return nil
+}
+
 // DeletePermissionRequest represents a permission deletion request
 type DeletePermissionRequest struct {
 	EntityType     string `json:"entity_type"`
@@ -449,16 +1136,33 @@ func (c *Client) DeletePermission(ctx context.Context, entityType, permissionNam
 		return errors.New("entity_type and permission_name are required")
 	}
 
-	endpoint := fmt.Sprintf("%s/permission?entity_type=%s&permission_name=%s", 
-		c.config.BaseURL, entityType, permissionName)
-	
+	endpoint := c.endpointURL("/permission", url.Values{
+		"entity_type":     {entityType},
+		"permission_name": {permissionName},
+	})
+
 	return c.delete(ctx, endpoint)
 }
 
+// endpointURL joins the base URL, path and query. Query values are escaped,
+// so IDs may contain '&', '#' or spaces.
+func (c *Client) endpointURL(path string, query url.Values) string {
+	endpoint := c.config.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+// entityQuery is the query naming an entity on the entity endpoints
+func entityQuery(entityType, externalID string) url.Values {
+	return url.Values{"type": {entityType}, "id": {externalID}}
+}
+
 // doRequest performs a POST request to the specified endpoint with the given request and unmarshals the response into a CheckPermissionResponse
 func (c *Client) doRequest(ctx context.Context, endpoint string, req interface{}) (*CheckPermissionResponse, error) {
 	var resp CheckPermissionResponse
-	err := c.post(ctx, endpoint, req, &resp)
+	err := c.postIdempotent(ctx, endpoint, req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -485,8 +1189,60 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("%s (Status: %d)", e.Message, e.StatusCode)
 }
 
+// setAuthHeaders adds the configured admin credentials and tenant to a
+// request
+func (c *Client) setAuthHeaders(req *http.Request) {
+	if c.config.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.AdminToken)
+	}
+	if c.config.APIKey != "" {
+		req.Header.Set("X-API-Key", c.config.APIKey)
+	}
+	if c.config.Principal != "" {
+		req.Header.Set("X-Supra-Principal", c.config.Principal)
+	}
+	if c.config.Tenant != "" {
+		req.Header.Set("X-Supra-Tenant", c.config.Tenant)
+	}
+}
+
+// setDeadlineHeader passes what is left of the request context's deadline
+// to the server as X-Request-Timeout, so it gives up when the caller does
+// rather than at its own default budget
+func setDeadlineHeader(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	if remaining := time.Until(deadline).Milliseconds(); remaining > 0 {
+		req.Header.Set("X-Request-Timeout", strconv.FormatInt(remaining, 10)+"ms")
+	}
+}
+
+// injectTraceContext propagates the trace in the request context, if the
+// application traces with OpenTelemetry, so the server's spans join it
+func injectTraceContext(req *http.Request) {
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+}
+
 // post performs a POST request to the specified endpoint with the given request and unmarshals the response into the specified response object
 func (c *Client) post(ctx context.Context, endpoint string, req interface{}, resp interface{}) error {
+	// Everything posted without being safe to repeat is a write
+	defer c.PurgeCheckCache()
+	return c.postJSON(ctx, endpoint, req, resp, false)
+}
+
+// postIdempotent is post for requests that are safe to repeat, such as
+// checks and upserts, which the retry policy may resend
+func (c *Client) postIdempotent(ctx context.Context, endpoint string, req interface{}, resp interface{}) error {
+	return c.postJSON(ctx, endpoint, req, resp, true)
+}
+
+func (c *Client) postJSON(ctx context.Context, endpoint string, req interface{}, resp interface{}, idempotent bool) error {
+	if c.configErr != nil {
+		return c.configErr
+	}
+
 	// Set up context with timeout
 	if c.config.Timeout > 0 {
 		var cancel context.CancelFunc
@@ -500,17 +1256,20 @@ func (c *Client) post(ctx context.Context, endpoint string, req interface{}, res
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
-
 	// Send request
-	httpResp, err := c.client.Do(httpReq)
+	httpResp, err := c.send(ctx, idempotent, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		c.setAuthHeaders(httpReq)
+		setDeadlineHeader(httpReq)
+		return httpReq, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
 	defer httpResp.Body.Close()
 
@@ -540,6 +1299,10 @@ func (c *Client) post(ctx context.Context, endpoint string, req interface{}, res
 
 // get performs a GET request to the specified endpoint and unmarshals the response into the specified response object
 func (c *Client) get(ctx context.Context, endpoint string, resp interface{}) error {
+	if c.configErr != nil {
+		return c.configErr
+	}
+
 	// Set up context with timeout
 	if c.config.Timeout > 0 {
 		var cancel context.CancelFunc
@@ -547,17 +1310,20 @@ func (c *Client) get(ctx context.Context, endpoint string, resp interface{}) err
 		defer cancel()
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	httpReq.Header.Set("Accept", "application/json")
-
 	// Send request
-	httpResp, err := c.client.Do(httpReq)
+	httpResp, err := c.send(ctx, true, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Accept", "application/json")
+
+		c.setAuthHeaders(httpReq)
+		setDeadlineHeader(httpReq)
+		return httpReq, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
 	defer httpResp.Body.Close()
 
@@ -587,6 +1353,11 @@ func (c *Client) get(ctx context.Context, endpoint string, resp interface{}) err
 
 // delete performs a DELETE request to the specified endpoint
 func (c *Client) delete(ctx context.Context, endpoint string) error {
+	if c.configErr != nil {
+		return c.configErr
+	}
+	defer c.PurgeCheckCache()
+
 	// Set up context with timeout
 	if c.config.Timeout > 0 {
 		var cancel context.CancelFunc
@@ -594,16 +1365,19 @@ func (c *Client) delete(ctx context.Context, endpoint string) error {
 		defer cancel()
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
 	// Send request
-	httpResp, err := c.client.Do(httpReq)
+	httpResp, err := c.send(ctx, true, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		c.setAuthHeaders(httpReq)
+		setDeadlineHeader(httpReq)
+		return httpReq, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
 	defer httpResp.Body.Close()
 
@@ -3,10 +3,16 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestNewClient(t *testing.T) {
@@ -826,4 +832,578 @@ func TestListRuleDefinitions(t *testing.T) {
 	if rules[1].Name != "hasRole" || len(rules[1].Parameters) != 2 {
 		t.Errorf("Unexpected rule: %+v", rules[1])
 	}
-}
\ No newline at end of file
+}
+func TestGetAttributeHistory(t *testing.T) {
+	premiumSince := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/entity/attributes/history" {
+			t.Errorf("Expected /entity/attributes/history path, got %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("attribute"); got != "tier" {
+			t.Errorf("Expected attribute tier, got %q", got)
+		}
+
+		resp := AttributeHistoryResponse{
+			Type:       r.URL.Query().Get("type"),
+			ExternalID: r.URL.Query().Get("id"),
+			Versions: []AttributeVersion{
+				{Attribute: "tier", Value: "free", ValidFrom: premiumSince.AddDate(-1, 0, 0), ValidTo: &premiumSince},
+				{Attribute: "tier", Value: "premium", ValidFrom: premiumSince},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	resp, err := client.GetAttributeHistory(context.Background(), "account", "acme", "tier")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(resp.Versions) != 2 {
+		t.Fatalf("Expected 2 versions, got %d", len(resp.Versions))
+	}
+	if resp.Versions[0].ValidTo == nil || !resp.Versions[0].ValidTo.Equal(premiumSince) {
+		t.Errorf("Expected first version to end at %s, got %v", premiumSince, resp.Versions[0].ValidTo)
+	}
+	if resp.Versions[1].ValidTo != nil {
+		t.Errorf("Expected current version to be open, got %v", resp.Versions[1].ValidTo)
+	}
+
+	if _, err := client.GetAttributeHistory(context.Background(), "account", "", "tier"); err == nil {
+		t.Error("Expected error for missing external ID")
+	}
+}
+
+func TestWarmChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/check/warm" {
+			t.Errorf("Expected POST /check/warm, got %s %s", r.Method, r.URL.Path)
+		}
+
+		var req struct {
+			Checks []CheckPermissionRequest `json:"checks"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(WarmChecksResponse{Accepted: len(req.Checks)})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	resp, err := client.WarmChecks(context.Background(), []CheckPermissionRequest{
+		{SubjectType: "user", SubjectID: "123", Permission: "read", ObjectType: "document", ObjectID: "456"},
+		{SubjectType: "user", SubjectID: "123", Permission: "edit", ObjectType: "document", ObjectID: "456"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.Accepted != 2 {
+		t.Errorf("Expected 2 accepted checks, got %d", resp.Accepted)
+	}
+
+	if _, err := client.WarmChecks(context.Background(), nil); err == nil {
+		t.Error("Expected error for no checks")
+	}
+	if _, err := client.WarmChecks(context.Background(), []CheckPermissionRequest{{SubjectType: "user"}}); err == nil {
+		t.Error("Expected error for an incomplete check")
+	}
+}
+
+func TestLookupObjects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		if r.URL.Path != "/lookup-objects" {
+			t.Errorf("Expected /lookup-objects path, got %s", r.URL.Path)
+		}
+
+		var req LookupObjectsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		// Two pages: d1, d2 then d3
+		resp := LookupObjectsResponse{ObjectIDs: []string{"d1", "d2"}, NextCursor: "d2"}
+		if req.Cursor == "d2" {
+			resp = LookupObjectsResponse{ObjectIDs: []string{"d3"}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	req := &LookupObjectsRequest{
+		SubjectType: "user",
+		SubjectID:   "123",
+		Permission:  "read",
+		ObjectType:  "document",
+		Limit:       2,
+	}
+	var ids []string
+	for {
+		resp, err := client.LookupObjects(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ids = append(ids, resp.ObjectIDs...)
+		if resp.NextCursor == "" {
+			break
+		}
+		req.Cursor = resp.NextCursor
+	}
+	if len(ids) != 3 || ids[0] != "d1" || ids[2] != "d3" {
+		t.Errorf("Expected d1, d2, d3, got %v", ids)
+	}
+
+	if _, err := client.LookupObjects(context.Background(), nil); err == nil {
+		t.Error("Expected error for nil request")
+	}
+	if _, err := client.LookupObjects(context.Background(), &LookupObjectsRequest{SubjectType: "user"}); err == nil {
+		t.Error("Expected error for missing required fields")
+	}
+}
+
+func TestLookupSubjects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lookup-subjects" {
+			t.Errorf("Expected /lookup-subjects path, got %s", r.URL.Path)
+		}
+		var req LookupSubjectsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.SubjectType != "user" {
+			t.Errorf("Expected subject_type user, got %q", req.SubjectType)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subjects":[{"type":"user","id":"alice","grants":["owner","parent -> folder:f1#view -> viewer"]}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+	resp, err := client.LookupSubjects(context.Background(), &LookupSubjectsRequest{
+		Permission:  "view",
+		ObjectType:  "document",
+		ObjectID:    "d1",
+		SubjectType: "user",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(resp.Subjects) != 1 || resp.Subjects[0].ID != "alice" || len(resp.Subjects[0].Grants) != 2 {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if resp.NextCursor != "" {
+		t.Errorf("Expected the last page, got cursor %q", resp.NextCursor)
+	}
+
+	if _, err := client.LookupSubjects(context.Background(), &LookupSubjectsRequest{Permission: "view"}); err == nil {
+		t.Error("Expected error for missing required fields")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/expand" {
+			t.Errorf("Expected /expand path, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind":"permission","expression":"owner or viewer","object":"document:d1","permission":"read",
+			"children":[{"kind":"union","expression":"(owner or viewer)","object":"document:d1","children":[
+				{"kind":"relation","expression":"owner","object":"document:d1","subjects":["user:alice"]},
+				{"kind":"relation","expression":"viewer","object":"document:d1","subjects":["user:bob","user:carol"]}]}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+	tree, err := client.Expand(context.Background(), &ExpandRequest{ObjectType: "document", ObjectID: "d1", Permission: "read"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if tree.Kind != ExpandPermission || len(tree.Children) != 1 || tree.Children[0].Kind != ExpandUnion {
+		t.Fatalf("Unexpected tree %+v", tree)
+	}
+	if viewers := tree.Children[0].Children[1].Subjects; len(viewers) != 2 {
+		t.Errorf("Expected two viewers, got %v", viewers)
+	}
+
+	if _, err := client.Expand(context.Background(), &ExpandRequest{ObjectType: "document"}); err == nil {
+		t.Error("Expected error for missing required fields")
+	}
+}
+
+func TestWriteRelationships(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/relations/batch" {
+			t.Errorf("Expected POST /relations/batch, got %s %s", r.Method, r.URL.Path)
+		}
+
+		var req struct {
+			Operations []RelationshipOperation `json:"operations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.Operations[1].Op == RelationshipCreate {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(APIError{Code: "relation_exists", Message: "Relation already exists",
+				Details: "operation 1: relation already exists"})
+			return
+		}
+
+		resp := WriteRelationshipsResponse{}
+		for _, op := range req.Operations {
+			rel := &RelationResponse{SubjectType: op.SubjectType, SubjectID: op.SubjectID, Relation: op.Relation,
+				ObjectType: op.ObjectType, ObjectID: op.ObjectID}
+			resp.Results = append(resp.Results, RelationshipResult{Op: op.Op, Relation: rel})
+			if op.Op == RelationshipCreate {
+				resp.Created++
+			} else {
+				resp.Deleted++
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	resp, err := client.WriteRelationships(context.Background(), []RelationshipOperation{
+		{Op: RelationshipCreate, SubjectType: "user", SubjectID: "123", Relation: "owner", ObjectType: "document", ObjectID: "456"},
+		{Op: RelationshipDelete, SubjectType: "user", SubjectID: "789", Relation: "owner", ObjectType: "document", ObjectID: "456"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.Created != 1 || resp.Deleted != 1 || len(resp.Results) != 2 {
+		t.Errorf("Expected 1 created and 1 deleted, got %+v", resp)
+	}
+
+	_, err = client.WriteRelationships(context.Background(), []RelationshipOperation{
+		{Op: RelationshipCreate, SubjectType: "user", SubjectID: "123", Relation: "owner", ObjectType: "document", ObjectID: "456"},
+		{Op: RelationshipCreate, SubjectType: "user", SubjectID: "123", Relation: "owner", ObjectType: "document", ObjectID: "456"},
+	})
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.Code != "relation_exists" {
+		t.Errorf("Expected a relation_exists APIError, got %v", err)
+	}
+
+	if _, err := client.WriteRelationships(context.Background(), nil); err == nil {
+		t.Error("Expected error for no operations")
+	}
+	if _, err := client.WriteRelationships(context.Background(), []RelationshipOperation{
+		{Op: "upsert", SubjectType: "user", SubjectID: "123", Relation: "owner", ObjectType: "document", ObjectID: "456"},
+	}); err == nil {
+		t.Error("Expected error for an unknown op")
+	}
+}
+
+func TestUpsertEntityAndRelation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/entity":
+			var req CreateEntityRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if !req.Upsert {
+				t.Error("Expected upsert to be set")
+			}
+			json.NewEncoder(w).Encode(EntityResponse{ID: 1, Type: req.Type, ExternalID: req.ExternalID,
+				Properties: req.Properties, Status: WriteUpdated})
+		case "/relation":
+			var req CreateRelationRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if !req.Upsert {
+				t.Error("Expected upsert to be set")
+			}
+			json.NewEncoder(w).Encode(RelationResponse{ID: 2, SubjectType: req.SubjectType, SubjectID: req.SubjectID,
+				Relation: req.Relation, ObjectType: req.ObjectType, ObjectID: req.ObjectID, Status: WriteExisting})
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	entity, err := client.UpsertEntity(context.Background(), &CreateEntityRequest{
+		Type: "user", ExternalID: "123", Properties: map[string]interface{}{"name": "Alice"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if entity.Status != WriteUpdated || entity.Properties["name"] != "Alice" {
+		t.Errorf("Expected the updated entity, got %+v", entity)
+	}
+
+	relation, err := client.UpsertRelation(context.Background(), &CreateRelationRequest{
+		SubjectType: "user", SubjectID: "123", Relation: "owner", ObjectType: "document", ObjectID: "456",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if relation.Status != WriteExisting || relation.ID != 2 {
+		t.Errorf("Expected the existing relation, got %+v", relation)
+	}
+
+	if _, err := client.UpsertEntity(context.Background(), &CreateEntityRequest{Type: "user"}); err == nil {
+		t.Error("Expected error for missing external_id")
+	}
+	if _, err := client.UpsertRelation(context.Background(), nil); err == nil {
+		t.Error("Expected error for nil request")
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Request-Timeout")
+		json.NewEncoder(w).Encode(CheckPermissionResponse{Allowed: true})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL, Timeout: 2 * time.Second})
+	req := &CheckPermissionRequest{SubjectType: "user", SubjectID: "123", Permission: "read", ObjectType: "document", ObjectID: "456"}
+
+	if _, err := client.CheckPermission(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	budget, err := time.ParseDuration(header)
+	if err != nil || budget <= time.Second || budget > 2*time.Second {
+		t.Errorf("Expected the client timeout as the budget, got %q", header)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := client.CheckPermission(ctx, req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if budget, _ := time.ParseDuration(header); budget > 500*time.Millisecond {
+		t.Errorf("Expected the caller's shorter deadline as the budget, got %q", header)
+	}
+}
+
+func TestTraceContextHeader(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("Traceparent")
+		json.NewEncoder(w).Encode(CheckPermissionResponse{Allowed: true})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+	req := &CheckPermissionRequest{SubjectType: "user", SubjectID: "123", Permission: "read", ObjectType: "document", ObjectID: "456"}
+
+	if _, err := client.CheckPermission(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if header != "" {
+		t.Errorf("Expected no traceparent outside a trace, got %q", header)
+	}
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	if _, err := client.CheckPermission(ctx, req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; header != want {
+		t.Errorf("Expected traceparent %q, got %q", want, header)
+	}
+}
+
+func TestSetAttribute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/attribute" || r.Method != http.MethodPost {
+			t.Errorf("Expected POST /attribute, got %s %s", r.Method, r.URL.Path)
+		}
+		var req SetAttributeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.Value != true {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(APIError{Code: "invalid_attribute_value", Message: "Attribute value does not match its data type"})
+			return
+		}
+		json.NewEncoder(w).Encode(TypedAttribute{
+			EntityType: req.Type, EntityID: req.ExternalID, Attribute: req.Attribute,
+			DataType: "boolean", Value: req.Value,
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	attr, err := client.SetAttribute(context.Background(), &SetAttributeRequest{
+		Type: "document", ExternalID: "d1", Attribute: "public", Value: true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if attr.DataType != "boolean" || attr.Value != true {
+		t.Errorf("Expected boolean true, got %s %v", attr.DataType, attr.Value)
+	}
+
+	_, err = client.SetAttribute(context.Background(), &SetAttributeRequest{
+		Type: "document", ExternalID: "d1", Attribute: "public", Value: "maybe",
+	})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "invalid_attribute_value" {
+		t.Errorf("Expected invalid_attribute_value, got %v", err)
+	}
+
+	if _, err := client.SetAttribute(context.Background(), &SetAttributeRequest{Type: "document"}); err == nil {
+		t.Error("Expected error for missing fields")
+	}
+}
+
+func TestQueryEscaping(t *testing.T) {
+	const id = "a&b #c/d"
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		got = append(got, query.Get("id")+"|"+query.Get("subject_id")+"|"+query.Get("attribute"))
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		json.NewEncoder(w).Encode(EntityResponse{Type: query.Get("type"), ExternalID: query.Get("id")})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+	ctx := context.Background()
+
+	entity, err := client.GetEntity(ctx, "document", id)
+	if err != nil {
+		t.Fatalf("GetEntity returned error: %v", err)
+	}
+	if entity.ExternalID != id {
+		t.Errorf("Expected external ID %q, got %q", id, entity.ExternalID)
+	}
+	if err := client.DeleteAttribute(ctx, "document", id, "a=b"); err != nil {
+		t.Fatalf("DeleteAttribute returned error: %v", err)
+	}
+	if err := client.DeleteRelation(ctx, &DeleteRelationRequest{
+		SubjectType: "user", SubjectID: id, Relation: "owner", ObjectType: "document", ObjectID: id,
+	}); err != nil {
+		t.Fatalf("DeleteRelation returned error: %v", err)
+	}
+
+	want := []string{id + "||", id + "||a=b", "|" + id + "|"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d requests, got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Request %d: expected query values %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestGetEntities(t *testing.T) {
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/entities/batch" || r.Method != http.MethodPost {
+			t.Errorf("Expected POST /entities/batch, got %s %s", r.Method, r.URL.Path)
+		}
+		var req struct {
+			Entities []EntityKey `json:"entities"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		batches = append(batches, len(req.Entities))
+
+		resp := GetEntitiesResponse{}
+		for _, key := range req.Entities {
+			if key.ExternalID == "missing" {
+				resp.Missing = append(resp.Missing, key)
+				continue
+			}
+			resp.Entities = append(resp.Entities, EntityResponse{Type: key.Type, ExternalID: key.ExternalID})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	keys := make([]EntityKey, 0, 1501)
+	for i := 0; i < 1500; i++ {
+		keys = append(keys, EntityKey{Type: "document", ExternalID: fmt.Sprintf("d%d", i)})
+	}
+	keys = append(keys, EntityKey{Type: "document", ExternalID: "missing"})
+
+	resp, err := client.GetEntities(context.Background(), keys)
+	if err != nil {
+		t.Fatalf("GetEntities returned error: %v", err)
+	}
+	if len(batches) != 2 || batches[0] != 1000 || batches[1] != 501 {
+		t.Errorf("Expected batches of 1000 and 501, got %v", batches)
+	}
+	if len(resp.Entities) != 1500 || resp.Entities[1499].ExternalID != "d1499" {
+		t.Errorf("Expected 1500 entities in order, got %d", len(resp.Entities))
+	}
+	if len(resp.Missing) != 1 || resp.Missing[0].ExternalID != "missing" {
+		t.Errorf("Expected the missing key, got %v", resp.Missing)
+	}
+
+	if _, err := client.GetEntities(context.Background(), []EntityKey{{Type: "document"}}); err == nil {
+		t.Error("Expected error for a key without an ID")
+	}
+}
+
+func TestListRelations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/relation" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		want := "object_id=acme&object_type=organization&source=entity-sync"
+		if r.URL.RawQuery != want {
+			t.Errorf("Expected query %q, got %q", want, r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(ListRelationsResponse{Relations: []RelationResponse{
+			{ID: 7, SubjectType: "user", SubjectID: "alice", Relation: "owner", ObjectType: "organization", ObjectID: "acme", Source: "entity-sync"},
+		}})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+	relations, err := client.ListRelations(context.Background(), &ListRelationsRequest{
+		ObjectType: "organization", ObjectID: "acme", Source: "entity-sync",
+	})
+	if err != nil {
+		t.Fatalf("ListRelations returned error: %v", err)
+	}
+	if len(relations) != 1 || relations[0].SubjectID != "alice" || relations[0].Relation != "owner" {
+		t.Errorf("Expected alice's owner relation, got %+v", relations)
+	}
+
+	if _, err := client.ListRelations(context.Background(), &ListRelationsRequest{Relation: "owner"}); err == nil {
+		t.Error("Expected error without a subject or an object")
+	}
+}
@@ -0,0 +1,273 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidContext is returned by ContextBuilder.Build for a context
+// field the permission doesn't read or a value of the wrong type
+var ErrInvalidContext = errors.New("invalid check context")
+
+// Context field data types, as declared by rule parameters
+const (
+	ContextBoolean      = "boolean"
+	ContextBooleanArray = "boolean[]"
+	ContextString       = "string"
+	ContextStringArray  = "string[]"
+	ContextInteger      = "integer"
+	ContextIntegerArray = "integer[]"
+	ContextDouble       = "double"
+	ContextDoubleArray  = "double[]"
+	ContextAny          = "any"
+)
+
+// ContextField is a request context value a permission reads, written
+// request.<name> in its condition
+type ContextField struct {
+	EntityType string `json:"entity_type"`
+	Permission string `json:"permission"`
+	Name       string `json:"name"`
+	DataType   string `json:"data_type"`
+}
+
+// ContextSchema lists the context fields the permissions of a schema
+// version read
+type ContextSchema struct {
+	SchemaVersion int            `json:"schema_version"`
+	Fields        []ContextField `json:"fields"`
+}
+
+// GetContextSchema retrieves the context fields of the current schema
+// version, or of schemaVersion when it isn't zero
+func (c *Client) GetContextSchema(ctx context.Context, schemaVersion int) (*ContextSchema, error) {
+	query := url.Values{}
+	if schemaVersion != 0 {
+		query.Set("schema_version", strconv.Itoa(schemaVersion))
+	}
+	endpoint := c.endpointURL("/api/schema/context", query)
+	var resp ContextSchema
+	if err := c.get(ctx, endpoint, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PermissionFields returns the data types of the context fields a
+// permission reads, by name
+func (s *ContextSchema) PermissionFields(objectType, permission string) map[string]string {
+	fields := make(map[string]string)
+	for _, f := range s.Fields {
+		if f.EntityType == objectType && f.Permission == permission {
+			fields[f.Name] = f.DataType
+		}
+	}
+	return fields
+}
+
+// Builder returns a ContextBuilder that checks values against the fields
+// the permission reads
+func (s *ContextSchema) Builder(objectType, permission string) *ContextBuilder {
+	return &ContextBuilder{
+		target: objectType + "." + permission,
+		fields: s.PermissionFields(objectType, permission),
+		values: make(map[string]interface{}),
+	}
+}
+
+// Key names a context field whose values are T. Keys written by
+// GenerateContextKeys let the compiler catch a misspelt field or a value
+// of the wrong type.
+type Key[T any] string
+
+// ContextBuilder builds the context of a check, the request.<name> values
+// its permission reads. A builder from ContextSchema.Builder validates each
+// value as it's set; one from NewContextBuilder accepts anything.
+type ContextBuilder struct {
+	target string
+	fields map[string]string
+	values map[string]interface{}
+	errs   []error
+}
+
+// NewContextBuilder returns a ContextBuilder that doesn't validate values
+func NewContextBuilder() *ContextBuilder {
+	return &ContextBuilder{values: make(map[string]interface{})}
+}
+
+// Set sets a context field. An invalid value is reported by Build.
+func (b *ContextBuilder) Set(name string, value interface{}) *ContextBuilder {
+	if b.fields != nil {
+		dataType, ok := b.fields[name]
+		if !ok {
+			b.errs = append(b.errs, fmt.Errorf("%w: %s doesn't read request.%s", ErrInvalidContext, b.target, name))
+			return b
+		}
+		if err := checkContextValue(dataType, value); err != nil {
+			b.errs = append(b.errs, fmt.Errorf("%w: request.%s: %v", ErrInvalidContext, name, err))
+			return b
+		}
+	}
+	b.values[name] = value
+	return b
+}
+
+// Set sets the context field key names
+func Set[T any](b *ContextBuilder, key Key[T], value T) *ContextBuilder {
+	return b.Set(string(key), value)
+}
+
+// Build returns the context to send as CheckPermissionRequest.Context, or
+// every error found while setting it
+func (b *ContextBuilder) Build() (map[string]interface{}, error) {
+	if len(b.errs) > 0 {
+		return nil, errors.Join(b.errs...)
+	}
+	request := make(map[string]interface{}, len(b.values))
+	for name, value := range b.values {
+		request[name] = value
+	}
+	return map[string]interface{}{"request": request}, nil
+}
+
+// checkContextValue reports whether value can be sent for a field of
+// dataType. An integer accepts a whole float, as JSON decoding makes one.
+func checkContextValue(dataType string, value interface{}) error {
+	if strings.HasSuffix(dataType, "[]") {
+		v := reflect.ValueOf(value)
+		if value == nil || (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) {
+			return fmt.Errorf("expected %s, got %T", dataType, value)
+		}
+		elemType := strings.TrimSuffix(dataType, "[]")
+		for i := 0; i < v.Len(); i++ {
+			if err := checkContextValue(elemType, v.Index(i).Interface()); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	ok := false
+	switch dataType {
+	case ContextAny:
+		ok = true
+	case ContextBoolean:
+		ok = v.Kind() == reflect.Bool
+	case ContextString:
+		ok = v.Kind() == reflect.String
+	case ContextInteger:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			ok = true
+		case reflect.Float32, reflect.Float64:
+			ok = v.Float() == math.Trunc(v.Float())
+		}
+	case ContextDouble:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			ok = true
+		}
+	default:
+		return fmt.Errorf("unknown data type %q", dataType)
+	}
+	if !ok {
+		return fmt.Errorf("expected %s, got %T", dataType, value)
+	}
+	return nil
+}
+
+// contextGoTypes are the Go types of the values of each data type
+var contextGoTypes = map[string]string{
+	ContextBoolean:      "bool",
+	ContextBooleanArray: "[]bool",
+	ContextString:       "string",
+	ContextStringArray:  "[]string",
+	ContextInteger:      "int64",
+	ContextIntegerArray: "[]int64",
+	ContextDouble:       "float64",
+	ContextDoubleArray:  "[]float64",
+	ContextAny:          "interface{}",
+}
+
+// GenerateContextKeys writes Go source declaring a Key for each field of
+// the schema, named after its entity type, permission and field, e.g.
+// InvoiceApproveAmount for request.amount read by invoice.approve. Run it
+// from a go:generate program against a server to keep the keys current.
+// The source also declares SchemaVersion, the version generated from, and
+// ContextFields, to set as Config.RequiredContextFields so Connect rejects
+// a server whose schema broke the keys.
+func GenerateContextKeys(schema *ContextSchema, pkg string) ([]byte, error) {
+	fields := append([]ContextField(nil), schema.Fields...)
+	sort.Slice(fields, func(i, j int) bool {
+		return contextKeyName(fields[i]) < contextKeyName(fields[j])
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by client.GenerateContextKeys from schema version %d; DO NOT EDIT.\n\n", schema.SchemaVersion)
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if len(fields) > 0 {
+		buf.WriteString("import \"github.com/dangerclosesec/supra/sdk/client\"\n\n")
+	}
+	buf.WriteString("// SchemaVersion is the schema version the keys were generated from\n")
+	fmt.Fprintf(&buf, "const SchemaVersion = %d\n\n", schema.SchemaVersion)
+	if len(fields) > 0 {
+		buf.WriteString("const (\n")
+		seen := make(map[string]bool)
+		for _, f := range fields {
+			name := contextKeyName(f)
+			if seen[name] {
+				return nil, fmt.Errorf("context fields of %s.%s and another permission both map to %s", f.EntityType, f.Permission, name)
+			}
+			seen[name] = true
+			goType, ok := contextGoTypes[f.DataType]
+			if !ok {
+				return nil, fmt.Errorf("context field %s of %s.%s has unknown data type %q", f.Name, f.EntityType, f.Permission, f.DataType)
+			}
+			fmt.Fprintf(&buf, "\t// %s reads request.%s of %s.%s\n", name, f.Name, f.EntityType, f.Permission)
+			fmt.Fprintf(&buf, "\t%s client.Key[%s] = %q\n", name, goType, f.Name)
+		}
+		buf.WriteString(")\n\n")
+		buf.WriteString("// ContextFields are the context fields the keys were generated from\n")
+		buf.WriteString("var ContextFields = []client.ContextField{\n")
+		for _, f := range fields {
+			fmt.Fprintf(&buf, "\t{EntityType: %q, Permission: %q, Name: %q, DataType: %q},\n", f.EntityType, f.Permission, f.Name, f.DataType)
+		}
+		buf.WriteString("}\n")
+	}
+	return format.Source(buf.Bytes())
+}
+
+// contextKeyName joins a field's entity type, permission and name in
+// CamelCase
+func contextKeyName(f ContextField) string {
+	var name strings.Builder
+	for _, part := range []string{f.EntityType, f.Permission, f.Name} {
+		upper := true
+		for _, r := range part {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				upper = true
+				continue
+			}
+			if upper {
+				r = unicode.ToUpper(r)
+				upper = false
+			}
+			name.WriteRune(r)
+		}
+	}
+	return name.String()
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var invoiceSchema = &ContextSchema{
+	SchemaVersion: 3,
+	Fields: []ContextField{
+		{EntityType: "invoice", Permission: "approve", Name: "amount", DataType: ContextInteger},
+		{EntityType: "invoice", Permission: "approve", Name: "currencies", DataType: ContextStringArray},
+		{EntityType: "invoice", Permission: "view", Name: "ip_address", DataType: ContextAny},
+	},
+}
+
+const (
+	testAmount     Key[int64]    = "amount"
+	testCurrencies Key[[]string] = "currencies"
+)
+
+func TestContextBuilder(t *testing.T) {
+	b := invoiceSchema.Builder("invoice", "approve")
+	Set(b, testAmount, 500)
+	Set(b, testCurrencies, []string{"USD", "EUR"})
+	got, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build returned error: %v", err)
+	}
+	request, ok := got["request"].(map[string]interface{})
+	if !ok || request["amount"] != int64(500) || len(request["currencies"].([]string)) != 2 {
+		t.Errorf("Build = %v", got)
+	}
+
+	// A whole float is an integer, as decoded JSON numbers are
+	if _, err := invoiceSchema.Builder("invoice", "approve").Set("amount", 500.0).Build(); err != nil {
+		t.Errorf("whole float: unexpected error %v", err)
+	}
+
+	for name, b := range map[string]*ContextBuilder{
+		"unread field":       invoiceSchema.Builder("invoice", "approve").Set("ip_address", "10.0.0.1"),
+		"fractional integer": invoiceSchema.Builder("invoice", "approve").Set("amount", 1.5),
+		"string integer":     invoiceSchema.Builder("invoice", "approve").Set("amount", "500"),
+		"mixed array":        invoiceSchema.Builder("invoice", "approve").Set("currencies", []interface{}{"USD", 1}),
+		"unknown permission": invoiceSchema.Builder("invoice", "pay").Set("amount", 1),
+	} {
+		if _, err := b.Build(); !errors.Is(err, ErrInvalidContext) {
+			t.Errorf("%s: expected ErrInvalidContext, got %v", name, err)
+		}
+	}
+
+	// Unchecked builders take anything
+	if _, err := NewContextBuilder().Set("anything", struct{}{}).Build(); err != nil {
+		t.Errorf("NewContextBuilder: unexpected error %v", err)
+	}
+}
+
+func TestGetContextSchema(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/schema/context" {
+			t.Errorf("Expected /api/schema/context path, got %s", r.URL.Path)
+		}
+		if v := r.URL.Query().Get("schema_version"); v != "3" {
+			t.Errorf("Expected schema_version=3, got %q", v)
+		}
+		json.NewEncoder(w).Encode(invoiceSchema)
+	}))
+	defer server.Close()
+
+	c := NewClient(&Config{BaseURL: server.URL})
+	schema, err := c.GetContextSchema(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("GetContextSchema returned error: %v", err)
+	}
+	if schema.SchemaVersion != 3 || len(schema.Fields) != 3 {
+		t.Errorf("GetContextSchema = %+v", schema)
+	}
+}
+
+func TestGenerateContextKeys(t *testing.T) {
+	src, err := GenerateContextKeys(invoiceSchema, "authzkeys")
+	if err != nil {
+		t.Fatalf("GenerateContextKeys returned error: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "keys.go", src, 0); err != nil {
+		t.Fatalf("generated source doesn't parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		`InvoiceApproveAmount client.Key[int64] = "amount"`,
+		`InvoiceApproveCurrencies client.Key[[]string] = "currencies"`,
+		`InvoiceViewIpAddress client.Key[interface{}] = "ip_address"`,
+		`const SchemaVersion = 3`,
+		`{EntityType: "invoice", Permission: "approve", Name: "amount", DataType: "integer"},`,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated source is missing %q:\n%s", want, src)
+		}
+	}
+
+	_, err = GenerateContextKeys(&ContextSchema{Fields: []ContextField{{EntityType: "a", Permission: "b", Name: "c", DataType: "money"}}}, "keys")
+	if err == nil {
+		t.Error("expected an error for an unknown data type")
+	}
+}
@@ -0,0 +1,38 @@
+package client
+
+import "net/http"
+
+// Invoker sends a request, through the interceptors after the current one
+// and then the HTTP client
+type Invoker func(req *http.Request) (*http.Response, error)
+
+// RequestInterceptor wraps every HTTP request the client sends, to add
+// headers, start tracing spans, record metrics or log. It calls next to
+// send the request on, and may change the request first or the response
+// after, or answer without calling next at all, but must return a response
+// or an error. A retried request passes through the interceptors once per
+// attempt.
+type RequestInterceptor interface {
+	Intercept(req *http.Request, next Invoker) (*http.Response, error)
+}
+
+// InterceptorFunc is a RequestInterceptor written as a function
+type InterceptorFunc func(req *http.Request, next Invoker) (*http.Response, error)
+
+func (f InterceptorFunc) Intercept(req *http.Request, next Invoker) (*http.Response, error) {
+	return f(req, next)
+}
+
+// chainInterceptors wraps send in the interceptors, the first outermost
+func chainInterceptors(send Invoker, interceptors []RequestInterceptor) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], send
+		if interceptor == nil {
+			continue
+		}
+		send = func(req *http.Request) (*http.Response, error) {
+			return interceptor.Intercept(req, next)
+		}
+	}
+	return send
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Trace-Id"); got != "trace-1" {
+			t.Errorf("Expected the interceptor's trace header, got %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"allowed":true}`))
+	}))
+	defer server.Close()
+
+	var order []string
+	record := func(name string) RequestInterceptor {
+		return InterceptorFunc(func(req *http.Request, next Invoker) (*http.Response, error) {
+			order = append(order, name+" before")
+			resp, err := next(req)
+			order = append(order, name+" after")
+			return resp, err
+		})
+	}
+	tracing := InterceptorFunc(func(req *http.Request, next Invoker) (*http.Response, error) {
+		req.Header.Set("X-Trace-Id", "trace-1")
+		return next(req)
+	})
+
+	client := NewClient(&Config{
+		BaseURL:      server.URL,
+		Interceptors: []RequestInterceptor{record("outer"), tracing, nil, record("inner")},
+	})
+	resp, err := client.CheckPermission(context.Background(), checkReq)
+	if err != nil || !resp.Allowed {
+		t.Fatalf("Expected an allowed check, got %+v, %v", resp, err)
+	}
+
+	want := []string{"outer before", "inner before", "inner after", "outer after"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected interceptors to run in order %v, got %v", want, order)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	stub := InterceptorFunc(func(req *http.Request, next Invoker) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"allowed":true,"reason":"stubbed"}`)),
+		}, nil
+	})
+
+	client := NewClient(&Config{BaseURL: "http://unreachable.invalid", Interceptors: []RequestInterceptor{stub}})
+	resp, err := client.CheckPermission(context.Background(), checkReq)
+	if err != nil || resp.Reason != "stubbed" {
+		t.Fatalf("Expected the interceptor's response, got %+v, %v", resp, err)
+	}
+
+	failing := InterceptorFunc(func(req *http.Request, next Invoker) (*http.Response, error) {
+		return nil, errors.New("blocked")
+	})
+	client = NewClient(&Config{BaseURL: "http://unreachable.invalid", Interceptors: []RequestInterceptor{failing}})
+	if _, err := client.CheckPermission(context.Background(), checkReq); err == nil || !strings.Contains(err.Error(), "blocked") {
+		t.Errorf("Expected the interceptor's error, got %v", err)
+	}
+}
+
+func TestInterceptorsSeeEachAttempt(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusServiceUnavailable, nil)
+
+	var attempts []int
+	client := NewClient(&Config{
+		BaseURL: server.URL,
+		Retry:   fastRetries(),
+		Interceptors: []RequestInterceptor{InterceptorFunc(func(req *http.Request, next Invoker) (*http.Response, error) {
+			resp, err := next(req)
+			if err == nil {
+				attempts = append(attempts, resp.StatusCode)
+			}
+			return resp, err
+		})},
+	})
+
+	if _, err := client.CheckPermission(context.Background(), checkReq); err != nil {
+		t.Fatalf("Expected the retried check to succeed, got %v", err)
+	}
+	if len(attempts) != 2 || attempts[0] != http.StatusServiceUnavailable || attempts[1] != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("Expected the interceptor to see a 503 then a 200, got %v", attempts)
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	authzv1 "github.com/dangerclosesec/supra/api/authz/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// jsonFields returns the JSON names of a struct's fields
+func jsonFields(v interface{}) []string {
+	var names []string
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// protoFields returns the field names of a message, which the REST gateway
+// uses as its JSON names
+func protoFields(m proto.Message) []string {
+	var names []string
+	fields := m.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		names = append(names, fields.Get(i).TextName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestProtoParity keeps the client's request and response structs in step
+// with the messages in api/authz/v1, which the gateway and the generated
+// clients are built from. Error is the HTTP API's error field, which the
+// gateway returns in the same shape.
+func TestProtoParity(t *testing.T) {
+	tests := []struct {
+		sdk   interface{}
+		proto proto.Message
+	}{
+		{CheckPermissionRequest{}, &authzv1.CheckRequest{}},
+		{CheckPermissionResponse{}, &authzv1.CheckResponse{}},
+		{CreateEntityRequest{}, &authzv1.CreateEntityRequest{}},
+		{EntityResponse{}, &authzv1.Entity{}},
+		{CreateRelationRequest{}, &authzv1.CreateRelationRequest{}},
+		{RelationResponse{}, &authzv1.Relation{}},
+		{CreatePermissionRequest{}, &authzv1.WritePermissionRequest{}},
+		{PermissionResponse{}, &authzv1.PermissionDefinition{}},
+	}
+	for _, tt := range tests {
+		name := reflect.TypeOf(tt.sdk).Name()
+		t.Run(name, func(t *testing.T) {
+			var fields []string
+			for _, field := range jsonFields(tt.sdk) {
+				if field != "error" {
+					fields = append(fields, field)
+				}
+			}
+			assert.Equal(t, protoFields(tt.proto), fields,
+				"%s has drifted from %s", name, tt.proto.ProtoReflect().Descriptor().FullName())
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how requests that fail on a transport error, a 429
+// or a 5xx response are retried. Only requests that are safe to repeat are
+// retried: GETs, DELETEs, and POSTs that read, like checks and lookups, or
+// upsert. Creates are never retried, since a create that reached the
+// service before the connection dropped would fail the second time.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a request is sent, counting the first;
+	// defaults to 3, and 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the pause before the first retry; defaults to 100ms
+	InitialBackoff time.Duration
+	// MaxBackoff caps the pause between attempts; defaults to 2s. A
+	// Retry-After longer than this isn't waited for.
+	MaxBackoff time.Duration
+	// Multiplier grows the pause after each attempt; defaults to 2
+	Multiplier float64
+}
+
+// DefaultRetryPolicy returns the settings used for fields left zero
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+func (p *RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	cfg := *p
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaults.MaxAttempts
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = defaults.InitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaults.MaxBackoff
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = defaults.Multiplier
+	}
+	return cfg
+}
+
+// backoff is the pause after the given attempt: exponential, with jitter
+// so clients that failed together don't retry together, or the response's
+// Retry-After. It returns false when the server asked for a longer pause
+// than MaxBackoff.
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait := time.Duration(seconds) * time.Second
+			return wait, wait <= p.MaxBackoff
+		}
+	}
+
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		wait *= p.Multiplier
+	}
+	d := min(time.Duration(wait), p.MaxBackoff)
+	// Wait between half and all of the backoff
+	return d/2 + time.Duration(rand.Int64N(int64(d/2)+1)), true
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// send makes the request newRequest builds, rebuilding and resending it as
+// the retry policy allows when idempotent is set. The last response is
+// returned whatever its status; an error is returned only when no response
+// was received.
+func (c *Client) send(ctx context.Context, idempotent bool, newRequest func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	attempts := 1
+	var policy RetryPolicy
+	if idempotent && c.config.Retry != nil {
+		policy = c.config.Retry.withDefaults()
+		attempts = policy.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		httpReq, err := newRequest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		injectTraceContext(httpReq)
+
+		httpResp, err := c.invoke(httpReq)
+
+		retry := attempt < attempts && ctx.Err() == nil && (err != nil || retryableStatus(httpResp.StatusCode))
+		var wait time.Duration
+		if retry {
+			wait, retry = policy.backoff(attempt, httpResp)
+		}
+		// Don't wait for an attempt the deadline leaves no time for
+		if deadline, ok := ctx.Deadline(); retry && ok && time.Until(deadline) <= wait {
+			retry = false
+		}
+		if !retry {
+			if err != nil {
+				return nil, fmt.Errorf("failed to send request: %w", err)
+			}
+			return httpResp, nil
+		}
+
+		if httpResp != nil {
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(httpResp.Body, 64<<10))
+			httpResp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("failed to send request: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
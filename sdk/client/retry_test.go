@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with status
+func flakyServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message":"unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"allowed":true,"subject_type":"user","subject_id":"alice","relation":"owner","object_type":"document","object_id":"doc1"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func fastRetries() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+var checkReq = &CheckPermissionRequest{SubjectType: "user", SubjectID: "alice", Permission: "read", ObjectType: "document", ObjectID: "doc1"}
+
+func TestRetryIdempotentRequests(t *testing.T) {
+	server, calls := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	client := NewClient(&Config{BaseURL: server.URL, Retry: fastRetries()})
+
+	resp, err := client.CheckPermission(context.Background(), checkReq)
+	if err != nil {
+		t.Fatalf("Expected the check to succeed on the third attempt, got %v", err)
+	}
+	if !resp.Allowed || calls.Load() != 3 {
+		t.Errorf("Expected an allowed check after 3 attempts, got %+v after %d", resp, calls.Load())
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	server, calls := flakyServer(t, 5, http.StatusTooManyRequests, nil)
+	client := NewClient(&Config{BaseURL: server.URL, Retry: fastRetries()})
+
+	_, err := client.CheckPermission(context.Background(), checkReq)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected the last attempt's 429, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestRetrySkipsCreates(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusBadGateway, nil)
+	client := NewClient(&Config{BaseURL: server.URL, Retry: fastRetries()})
+
+	_, err := client.CreateRelation(context.Background(), &CreateRelationRequest{
+		SubjectType: "user", SubjectID: "alice", Relation: "owner", ObjectType: "document", ObjectID: "doc1",
+	})
+	if err == nil || calls.Load() != 1 {
+		t.Errorf("Expected a create to fail without retrying, got %v after %d attempts", err, calls.Load())
+	}
+
+	// Upserts are safe to repeat
+	calls.Store(0)
+	if _, err := client.UpsertRelation(context.Background(), &CreateRelationRequest{
+		SubjectType: "user", SubjectID: "alice", Relation: "owner", ObjectType: "document", ObjectID: "doc1",
+	}); err != nil || calls.Load() != 2 {
+		t.Errorf("Expected an upsert to succeed on a retry, got %v after %d attempts", err, calls.Load())
+	}
+}
+
+func TestRetryDisabled(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusServiceUnavailable, nil)
+	client := NewClient(&Config{BaseURL: server.URL})
+
+	if _, err := client.CheckPermission(context.Background(), checkReq); err == nil || calls.Load() != 1 {
+		t.Errorf("Expected no retries without a policy, got %v after %d attempts", err, calls.Load())
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	// A server asking for a longer pause than MaxBackoff gets its answer
+	server, calls := flakyServer(t, 1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"60"}})
+	client := NewClient(&Config{BaseURL: server.URL, Retry: fastRetries()})
+	if _, err := client.CheckPermission(context.Background(), checkReq); err == nil || calls.Load() != 1 {
+		t.Errorf("Expected no retry after a long Retry-After, got %v after %d attempts", err, calls.Load())
+	}
+
+	server, calls = flakyServer(t, 1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"0"}})
+	client = NewClient(&Config{BaseURL: server.URL, Retry: fastRetries()})
+	if _, err := client.CheckPermission(context.Background(), checkReq); err != nil || calls.Load() != 2 {
+		t.Errorf("Expected a retry after Retry-After, got %v after %d attempts", err, calls.Load())
+	}
+}
+
+// failingTransport fails the first failures requests as a dropped
+// connection would
+type failingTransport struct {
+	failures atomic.Int32
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.failures.Add(-1) >= 0 {
+		return nil, errors.New("connection reset by peer")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRetryTransportErrors(t *testing.T) {
+	server, calls := flakyServer(t, 0, http.StatusOK, nil)
+	transport := &failingTransport{}
+	transport.failures.Store(2)
+	client := NewClient(&Config{
+		BaseURL:    server.URL,
+		HTTPClient: &http.Client{Transport: transport},
+		Retry:      fastRetries(),
+	})
+
+	if _, err := client.GetEntity(context.Background(), "document", "doc1"); err != nil {
+		t.Fatalf("Expected the request to succeed after transport errors, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the server to see 1 request, got %d", calls.Load())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := (&RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}).withDefaults()
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 6: time.Second} {
+		wait, ok := policy.backoff(attempt, nil)
+		if !ok || wait < want/2 || wait > want {
+			t.Errorf("attempt %d: expected a pause between %v and %v, got %v", attempt, want/2, want, wait)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSchemaMismatch is returned by Connect when the server's schema has
+// dropped or retyped context fields the application was built against
+var ErrSchemaMismatch = errors.New("server schema doesn't match the application")
+
+// Connect creates a client and fetches the server's schema version and
+// context fields, so SchemaVersion and ContextSchema answer without a
+// round trip. With RequiredContextFields configured it fails fast on a
+// server whose schema has broken them. Adding permissions or fields is
+// compatible; removing or retyping a required field is not.
+func Connect(ctx context.Context, config *Config) (*Client, error) {
+	c := NewClient(config)
+	if c.configErr != nil {
+		return nil, c.configErr
+	}
+	schema, err := c.RefreshSchema(ctx)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to fetch the server schema: %w", err)
+	}
+	if err := checkRequiredFields(schema, c.config.RequiredContextFields); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// RefreshSchema fetches the server's current schema version and context
+// fields and caches them
+func (c *Client) RefreshSchema(ctx context.Context) (*ContextSchema, error) {
+	schema, err := c.GetContextSchema(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.schemaMu.Lock()
+	c.schema = schema
+	c.schemaMu.Unlock()
+	return schema, nil
+}
+
+// SchemaVersion returns the server's schema version as of Connect or the
+// last RefreshSchema, or zero if it was never fetched. Set it as
+// CheckPermissionRequest.SchemaVersion to evaluate a burst of checks
+// against the same schema.
+func (c *Client) SchemaVersion() int {
+	c.schemaMu.RLock()
+	defer c.schemaMu.RUnlock()
+	if c.schema == nil {
+		return 0
+	}
+	return c.schema.SchemaVersion
+}
+
+// ContextSchema returns the context fields cached by Connect or the last
+// RefreshSchema, or nil if they were never fetched
+func (c *Client) ContextSchema() *ContextSchema {
+	c.schemaMu.RLock()
+	defer c.schemaMu.RUnlock()
+	return c.schema
+}
+
+// checkRequiredFields reports the required fields the schema lacks or
+// types differently
+func checkRequiredFields(schema *ContextSchema, required []ContextField) error {
+	var problems []string
+	for _, want := range required {
+		got, ok := schema.PermissionFields(want.EntityType, want.Permission)[want.Name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s.%s no longer reads request.%s", want.EntityType, want.Permission, want.Name))
+		case got != want.DataType:
+			problems = append(problems, fmt.Sprintf("request.%s of %s.%s is %s, not %s", want.Name, want.EntityType, want.Permission, got, want.DataType))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w at schema version %d: %s", ErrSchemaMismatch, schema.SchemaVersion, strings.Join(problems, "; "))
+	}
+	return nil
+}
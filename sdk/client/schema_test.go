@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func contextSchemaServer(t *testing.T, schema *ContextSchema) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/schema/context" {
+			t.Errorf("Expected path /api/schema/context, got %s", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(schema)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestConnect(t *testing.T) {
+	server := contextSchemaServer(t, invoiceSchema)
+
+	client, err := Connect(context.Background(), &Config{
+		BaseURL:               server.URL,
+		RequiredContextFields: invoiceSchema.Fields[:2],
+	})
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	if got := client.SchemaVersion(); got != 3 {
+		t.Errorf("SchemaVersion = %d, want 3", got)
+	}
+	if got := client.ContextSchema(); got == nil || len(got.Fields) != 3 {
+		t.Errorf("ContextSchema = %+v", got)
+	}
+
+	unfetched := NewClient(&Config{BaseURL: server.URL})
+	if got := unfetched.SchemaVersion(); got != 0 {
+		t.Errorf("SchemaVersion before fetching = %d, want 0", got)
+	}
+	if _, err := unfetched.RefreshSchema(context.Background()); err != nil {
+		t.Fatalf("RefreshSchema returned error: %v", err)
+	}
+	if got := unfetched.SchemaVersion(); got != 3 {
+		t.Errorf("SchemaVersion after RefreshSchema = %d, want 3", got)
+	}
+}
+
+func TestConnectSchemaMismatch(t *testing.T) {
+	server := contextSchemaServer(t, &ContextSchema{
+		SchemaVersion: 4,
+		Fields: []ContextField{
+			{EntityType: "invoice", Permission: "approve", Name: "amount", DataType: ContextDouble},
+		},
+	})
+
+	_, err := Connect(context.Background(), &Config{
+		BaseURL:               server.URL,
+		RequiredContextFields: invoiceSchema.Fields[:2],
+	})
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("Expected ErrSchemaMismatch, got %v", err)
+	}
+	for _, want := range []string{"schema version 4", "request.amount of invoice.approve is double, not integer", "invoice.approve no longer reads request.currencies"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+
+	// A field the application doesn't use may change freely
+	if _, err := Connect(context.Background(), &Config{BaseURL: server.URL}); err != nil {
+		t.Errorf("Connect without required fields returned error: %v", err)
+	}
+}
+
+func TestConnectUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if _, err := Connect(context.Background(), &Config{BaseURL: server.URL}); err == nil {
+		t.Error("Expected an error when the schema can't be fetched")
+	}
+}
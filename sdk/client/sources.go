@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// RelationSource counts the relations one source wrote
+type RelationSource struct {
+	Source    string    `json:"source"`
+	Relations int64     `json:"relations"`
+	FirstAt   time.Time `json:"first_at"`
+	LastAt    time.Time `json:"last_at"`
+}
+
+// ListRelationSources lists the sources relations were written by, such
+// as manual, scim or import:batch-42, with how many relations each has
+func (c *Client) ListRelationSources(ctx context.Context) ([]RelationSource, error) {
+	var resp struct {
+		Sources []RelationSource `json:"sources"`
+	}
+	if err := c.get(ctx, c.endpointURL("/api/relations/sources", nil), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Sources, nil
+}
+
+// RevokeRelationSource deletes every relation source wrote, for instance
+// to roll back a bad import or a decommissioned integration. The service
+// deletes them in a background revoke_source job, so relations may still
+// be found for a while after it returns. It needs a global admin.
+func (c *Client) RevokeRelationSource(ctx context.Context, source string) error {
+	if source == "" {
+		return errors.New("source is required")
+	}
+	return c.delete(ctx, c.endpointURL("/api/relations/sources/"+url.PathEscape(source), nil))
+}
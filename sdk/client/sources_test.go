@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRelationSources(t *testing.T) {
+	var revoked string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/relations/sources":
+			json.NewEncoder(w).Encode(map[string]interface{}{"sources": []RelationSource{
+				{Source: "import:batch-42", Relations: 1200},
+				{Source: "manual", Relations: 3},
+			}})
+		case r.Method == http.MethodDelete:
+			revoked = r.URL.Path
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]string{"kind": "revoke_source", "status": "queued"})
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL})
+	ctx := context.Background()
+
+	sources, err := client.ListRelationSources(ctx)
+	if err != nil {
+		t.Fatalf("ListRelationSources returned error: %v", err)
+	}
+	if len(sources) != 2 || sources[0].Source != "import:batch-42" || sources[0].Relations != 1200 {
+		t.Errorf("Expected import:batch-42 with 1200 relations first, got %+v", sources)
+	}
+
+	if err := client.RevokeRelationSource(ctx, "import:batch-42"); err != nil {
+		t.Fatalf("RevokeRelationSource returned error: %v", err)
+	}
+	if revoked != "/api/relations/sources/import:batch-42" {
+		t.Errorf("Expected the source in the path, got %q", revoked)
+	}
+
+	if err := client.RevokeRelationSource(ctx, ""); err == nil {
+		t.Error("Expected error for an empty source")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/dangerclosesec/supra/sdk/client"
+	"github.com/dangerclosesec/supra/sdk/middleware"
+)
+
+// relationSource tags the relations the app writes, so they can be listed
+// and revoked apart from other writers'
+const relationSource = "docs-app"
+
+// document is what the app stores; who may do what with it lives in the
+// permission service
+type document struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// shareRequest grants a user read access, or a team's members
+type shareRequest struct {
+	User string `json:"user,omitempty"`
+	Team string `json:"team,omitempty"`
+}
+
+type app struct {
+	authz *client.Client
+	guard *middleware.Authorizer
+
+	mu   sync.RWMutex
+	docs map[string]document
+}
+
+func newApp(c *client.Client) *app {
+	return &app{authz: c, guard: middleware.New(c), docs: make(map[string]document)}
+}
+
+func (a *app) routes() http.Handler {
+	doc := middleware.PathValueObject("document", "id")
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /documents", a.createDocument)
+	mux.Handle("GET /documents/{id}", a.guard.RequirePermission("read", doc)(http.HandlerFunc(a.getDocument)))
+	mux.Handle("PUT /documents/{id}", a.guard.RequirePermission("edit", doc)(http.HandlerFunc(a.updateDocument)))
+	mux.Handle("POST /documents/{id}/share", a.guard.RequirePermission("share", doc)(http.HandlerFunc(a.shareDocument)))
+	return authenticate(mux)
+}
+
+// authenticate takes the caller from X-User; requests without one reach
+// only handlers that don't check permissions, which turn them away
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := r.Header.Get("X-User"); user != "" {
+			r = r.WithContext(middleware.WithSubject(r.Context(), middleware.Subject{Type: "user", ID: user}))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// createDocument stores a document and makes its creator the owner
+func (a *app) createDocument(w http.ResponseWriter, r *http.Request) {
+	subject, ok := middleware.SubjectFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, middleware.ErrNoSubject)
+		return
+	}
+	var doc document
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc.ID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("a document needs an id"))
+		return
+	}
+
+	a.mu.Lock()
+	_, exists := a.docs[doc.ID]
+	if !exists {
+		a.docs[doc.ID] = doc
+	}
+	a.mu.Unlock()
+	if exists {
+		writeError(w, http.StatusConflict, errors.New("document already exists"))
+		return
+	}
+
+	if err := a.grant(r.Context(), client.RelationWrite{
+		SubjectType: subject.Type, SubjectID: subject.ID, Relation: "owner",
+		ObjectType: "document", ObjectID: doc.ID,
+	}); err != nil {
+		a.mu.Lock()
+		delete(a.docs, doc.ID)
+		a.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, doc)
+}
+
+func (a *app) getDocument(w http.ResponseWriter, r *http.Request) {
+	a.mu.RLock()
+	doc, ok := a.docs[r.PathValue("id")]
+	a.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("document not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+func (a *app) updateDocument(w http.ResponseWriter, r *http.Request) {
+	var update document
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid document"))
+		return
+	}
+
+	a.mu.Lock()
+	doc, ok := a.docs[r.PathValue("id")]
+	if ok {
+		doc.Title, doc.Body = update.Title, update.Body
+		a.docs[doc.ID] = doc
+	}
+	a.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("document not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// shareDocument makes a user a viewer, or shares the document with a team
+func (a *app) shareDocument(w http.ResponseWriter, r *http.Request) {
+	var req shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.User == "") == (req.Team == "") {
+		writeError(w, http.StatusBadRequest, errors.New("share with either a user or a team"))
+		return
+	}
+
+	write := client.RelationWrite{
+		SubjectType: "user", SubjectID: req.User, Relation: "viewer",
+		ObjectType: "document", ObjectID: r.PathValue("id"),
+	}
+	if req.Team != "" {
+		// document.team links the document to the team, whose members read
+		// it through team.member
+		write = client.RelationWrite{
+			SubjectType: "document", SubjectID: r.PathValue("id"), Relation: "team",
+			ObjectType: "team", ObjectID: req.Team,
+		}
+	}
+	if err := a.grant(r.Context(), write); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// grant writes a relation, counting one that already exists as written
+func (a *app) grant(ctx context.Context, write client.RelationWrite) error {
+	write.Op = client.RelationshipCreate
+	write.Source = relationSource
+	resp, err := a.authz.WriteRelations(ctx, []client.RelationWrite{write})
+	if err != nil {
+		return err
+	}
+	if result := resp.Results[0]; result.Error != "" && result.Code != "relation_exists" {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
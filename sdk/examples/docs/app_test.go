@@ -0,0 +1,79 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/sdk/testkit"
+)
+
+// TestSharing drives the app over HTTP against the permission service at
+// SUPRA_TEST_AUTHZ_URL, loaded with ../schema.perm
+func TestSharing(t *testing.T) {
+	c := testkit.Client(t)
+	testkit.NewFixture().
+		Entity("user:docs-alice", nil).
+		Entity("user:docs-bob", nil).
+		Entity("user:docs-carol", nil).
+		Entity("team:docs-eng", nil).
+		Relations("user:docs-carol member team:docs-eng").
+		Apply(t, c)
+
+	a := newApp(c)
+	srv := httptest.NewServer(a.routes())
+	t.Cleanup(srv.Close)
+
+	do := func(method, path, user, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	expect := func(want, got int, what string) {
+		t.Helper()
+		if got != want {
+			t.Fatalf("%s: got status %d, want %d", what, got, want)
+		}
+	}
+
+	expect(http.StatusCreated, do("POST", "/documents", "docs-alice", `{"id":"docs-plan","title":"Plan"}`), "create")
+	// the app writes the owner relation itself, so it's removed here rather
+	// than by the fixture
+	t.Cleanup(func() { removeDocument(t, a, "docs-plan") })
+
+	expect(http.StatusOK, do("GET", "/documents/docs-plan", "docs-alice", ""), "owner reads")
+	expect(http.StatusForbidden, do("GET", "/documents/docs-plan", "docs-bob", ""), "stranger reads")
+	expect(http.StatusUnauthorized, do("GET", "/documents/docs-plan", "", ""), "anonymous reads")
+
+	expect(http.StatusNoContent, do("POST", "/documents/docs-plan/share", "docs-alice", `{"user":"docs-bob"}`), "share with bob")
+	expect(http.StatusForbidden, do("POST", "/documents/docs-plan/share", "docs-bob", `{"user":"docs-carol"}`), "viewer shares")
+	expect(http.StatusOK, do("GET", "/documents/docs-plan", "docs-bob", ""), "viewer reads")
+	expect(http.StatusForbidden, do("PUT", "/documents/docs-plan", "docs-bob", `{"title":"Mine"}`), "viewer edits")
+
+	expect(http.StatusNoContent, do("POST", "/documents/docs-plan/share", "docs-alice", `{"team":"docs-eng"}`), "share with team")
+	testkit.RequirePermission(t, c, "user:docs-carol", "read", "document:docs-plan")
+	testkit.RequireNoPermission(t, c, "user:docs-carol", "edit", "document:docs-plan")
+}
+
+// removeDocument deletes the document and every relation on it
+func removeDocument(t *testing.T, a *app, id string) {
+	t.Helper()
+	if err := a.authz.DeleteEntityCascade(context.Background(), "document", id); err != nil {
+		t.Errorf("removing document:%s: %v", id, err)
+	}
+}
@@ -0,0 +1,38 @@
+// Command docs is a small document service that authorizes every request
+// with the SDK: owners create documents and share them with users or
+// teams, and reads, edits and shares are checked against the permission
+// service at SUPRA_AUTHZ_URL. Callers name themselves in X-User, standing
+// in for real authentication.
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dangerclosesec/supra/sdk/client"
+)
+
+func main() {
+	serviceURL := os.Getenv("SUPRA_AUTHZ_URL")
+	if serviceURL == "" {
+		serviceURL = "http://localhost:4780"
+	}
+	addr := os.Getenv("LISTEN_ADDR")
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	c := client.NewClient(&client.Config{
+		BaseURL: serviceURL,
+		Timeout: 5 * time.Second,
+		Retry:   &client.RetryPolicy{},
+	})
+	defer c.Close()
+
+	log.Printf("docs listening on %s, authorizing with %s", addr, serviceURL)
+	if err := http.ListenAndServe(addr, newApp(c).routes()); err != nil {
+		log.Fatal(err)
+	}
+}
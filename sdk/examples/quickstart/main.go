@@ -1,3 +1,7 @@
+// Command quickstart walks through the SDK against a running permission
+// service: it defines a permission, writes entities and relations, and
+// checks them. SUPRA_AUTHZ_URL points it at the service, by default
+// http://localhost:4780.
 package main
 
 import (
@@ -5,17 +9,18 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/dangerclosesec/supra/sdk/client"
 )
 
-const (
-	// Change these values to match your environment
-	serviceURL = "http://localhost:4780"
-)
-
 func main() {
+	serviceURL := os.Getenv("SUPRA_AUTHZ_URL")
+	if serviceURL == "" {
+		serviceURL = "http://localhost:4780"
+	}
+
 	// Initialize the client
 	config := &client.Config{
 		BaseURL: serviceURL,
@@ -36,19 +41,33 @@ func main() {
 func runExample(ctx context.Context, c *client.Client) error {
 	fmt.Println("Running permission SDK example...")
 
-	// Step 1: Create document permission definition
+	// Step 1: Create document permission definition, unless an earlier run
+	// or the schema already did
 	fmt.Println("\n1. Creating permission definition...")
 	permReq := &client.CreatePermissionRequest{
 		EntityType:          "document",
-		PermissionName:      "read",
-		ConditionExpression: "owner OR viewer",
-		Description:         "Can read the document when user is an owner or viewer",
+		PermissionName:      "comment",
+		ConditionExpression: "owner or viewer",
+		Description:         "Can comment on the document when user is an owner or viewer",
 	}
-	perm, err := c.CreatePermission(ctx, permReq)
+	defined, err := c.ListPermissionDefinitions(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create permission: %w", err)
+		return fmt.Errorf("failed to list permission definitions: %w", err)
+	}
+	exists := false
+	for _, p := range defined {
+		if p.EntityType == permReq.EntityType && p.PermissionName == permReq.PermissionName {
+			exists = true
+			fmt.Printf("Permission already defined: %s.%s = %s\n", p.EntityType, p.PermissionName, p.ConditionExpression)
+		}
+	}
+	if !exists {
+		perm, createErr := c.CreatePermission(ctx, permReq)
+		if createErr != nil {
+			return fmt.Errorf("failed to create permission: %w", createErr)
+		}
+		fmt.Printf("Permission created: %s.%s\n", perm.EntityType, perm.PermissionName)
 	}
-	fmt.Printf("Permission created: %s.%s\n", perm.EntityType, perm.PermissionName)
 
 	// Step 2: Create entities
 	fmt.Println("\n2. Creating entities...")
@@ -129,20 +148,28 @@ func runExample(ctx context.Context, c *client.Client) error {
 	// Step 3: Create relations
 	fmt.Println("\n3. Creating relations...")
 
-	// Make user the owner of the document
-	relReq := &client.CreateRelationRequest{
-		SubjectType: "user",
-		SubjectID:   "alice",
-		Relation:    "owner",
-		ObjectType:  "document",
-		ObjectID:    "doc1",
-	}
-	rel, err := c.CreateRelation(ctx, relReq)
+	// Make user the owner and a viewer of the document in one request. Each
+	// write succeeds or fails on its own, so rerunning the example reports
+	// the relations that already exist instead of failing.
+	writes, err := c.WriteRelations(ctx, []client.RelationWrite{
+		{Op: client.RelationshipCreate, SubjectType: "user", SubjectID: "alice", Relation: "owner", ObjectType: "document", ObjectID: "doc1"},
+		{Op: client.RelationshipCreate, SubjectType: "user", SubjectID: "alice", Relation: "viewer", ObjectType: "document", ObjectID: "doc1"},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create relation: %w", err)
+		return fmt.Errorf("failed to write relations: %w", err)
+	}
+	for _, result := range writes.Results {
+		switch {
+		case result.Code == "relation_exists":
+			fmt.Println("Relation already exists (continuing)")
+		case result.Error != "":
+			return fmt.Errorf("failed to create relation: [%s] %s", result.Code, result.Error)
+		default:
+			rel := result.Relation
+			fmt.Printf("Relation created: %s:%s --%s--> %s:%s\n",
+				rel.SubjectType, rel.SubjectID, rel.Relation, rel.ObjectType, rel.ObjectID)
+		}
 	}
-	fmt.Printf("Relation created: %s:%s --%s--> %s:%s\n",
-		rel.SubjectType, rel.SubjectID, rel.Relation, rel.ObjectType, rel.ObjectID)
 
 	// Step 4: Test the relation exists
 	fmt.Println("\n4. Testing relation...")
@@ -163,20 +190,21 @@ func runExample(ctx context.Context, c *client.Client) error {
 	// Step 5: Check permissions
 	fmt.Println("\n5. Checking permissions...")
 
-	// Check if Alice can read the document
-	checkReq := &client.CheckPermissionRequest{
-		SubjectType: "user",
-		SubjectID:   "alice",
-		Permission:  "read",
-		ObjectType:  "document",
-		ObjectID:    "doc1",
-		Context:     map[string]interface{}{}, // No additional context needed
+	// Check whether Alice and Bob can comment on the document in one request
+	checks := []client.CheckPermissionRequest{
+		{SubjectType: "user", SubjectID: "alice", Permission: "comment", ObjectType: "document", ObjectID: "doc1"},
+		{SubjectType: "user", SubjectID: "bob", Permission: "comment", ObjectType: "document", ObjectID: "doc1"},
 	}
-	checkResp, err := c.CheckPermission(ctx, checkReq)
+	checkResp, err := c.CheckPermissions(ctx, checks)
 	if err != nil {
-		return fmt.Errorf("failed to check permission: %w", err)
+		return fmt.Errorf("failed to check permissions: %w", err)
+	}
+	if err := checkResp.Err(); err != nil {
+		return fmt.Errorf("failed to check permissions: %w", err)
+	}
+	for i, result := range checkResp.Results {
+		fmt.Printf("Permission check result: %s allowed=%v\n", checks[i].SubjectID, result.Allowed)
 	}
-	fmt.Printf("Permission check result: allowed=%v\n", checkResp.Allowed)
 
 	// Step 6: Create and test a rule
 	fmt.Println("\n6. Creating and testing a rule...")
@@ -207,9 +235,9 @@ func runExample(ctx context.Context, c *client.Client) error {
 				"document_id": "doc1",
 			},
 		}
-		testRuleResp, err := c.TestRule(ctx, testRuleReq)
-		if err != nil {
-			return fmt.Errorf("failed to test rule: %w", err)
+		testRuleResp, ruleErr := c.TestRule(ctx, testRuleReq)
+		if ruleErr != nil {
+			return fmt.Errorf("failed to test rule: %w", ruleErr)
 		}
 		fmt.Printf("Rule test result: result=%v\n", testRuleResp.Result)
 	}
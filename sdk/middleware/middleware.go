@@ -0,0 +1,214 @@
+// Package middleware guards net/http handlers, including chi routes, with
+// permission checks against the Supra permission service.
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dangerclosesec/supra/sdk/client"
+)
+
+// Checker checks permissions; *client.Client is one
+type Checker interface {
+	CheckPermission(ctx context.Context, req *client.CheckPermissionRequest) (*client.CheckPermissionResponse, error)
+}
+
+// Subject is who a request is made by
+type Subject struct {
+	Type string
+	ID   string
+}
+
+// Object is what a request acts on
+type Object struct {
+	Type string
+	ID   string
+}
+
+// SubjectResolver finds the subject of a request, reporting false for
+// unauthenticated requests
+type SubjectResolver func(r *http.Request) (Subject, bool)
+
+// ObjectResolver finds the object a request acts on, e.g. the document
+// named in the URL
+type ObjectResolver func(r *http.Request) (Object, error)
+
+// ErrorHandler writes the response for a request that isn't allowed
+// through. status is 401 without a subject, 400 when the object can't be
+// resolved, 403 when the permission is denied and 503 when the check
+// fails.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// ErrDenied is passed to the ErrorHandler when the permission is denied
+var ErrDenied = errors.New("forbidden")
+
+// ErrNoSubject is passed to the ErrorHandler when a request has no subject
+var ErrNoSubject = errors.New("authentication required")
+
+type subjectKey struct{}
+
+// WithSubject records the subject of a request, usually in the
+// application's authentication middleware, for ContextSubject to find
+func WithSubject(ctx context.Context, subject Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext returns the subject WithSubject recorded
+func SubjectFromContext(ctx context.Context) (Subject, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(Subject)
+	return subject, ok && subject.ID != ""
+}
+
+// ContextSubject resolves the subject WithSubject recorded; it's the
+// default SubjectResolver
+func ContextSubject(r *http.Request) (Subject, bool) {
+	return SubjectFromContext(r.Context())
+}
+
+// Authorizer builds middleware that checks permissions
+type Authorizer struct {
+	checker Checker
+	subject SubjectResolver
+	context func(r *http.Request) map[string]interface{}
+	onError ErrorHandler
+}
+
+// Option configures an Authorizer
+type Option func(*Authorizer)
+
+// WithSubjectResolver finds subjects with resolve instead of ContextSubject
+func WithSubjectResolver(resolve SubjectResolver) Option {
+	return func(a *Authorizer) {
+		a.subject = resolve
+	}
+}
+
+// WithCheckContext sends the values build returns with each check, for
+// rules that read request context such as the client's IP
+func WithCheckContext(build func(r *http.Request) map[string]interface{}) Option {
+	return func(a *Authorizer) {
+		a.context = build
+	}
+}
+
+// WithErrorHandler writes refusals with handle instead of a JSON error
+func WithErrorHandler(handle ErrorHandler) Option {
+	return func(a *Authorizer) {
+		a.onError = handle
+	}
+}
+
+// New creates an Authorizer that checks permissions with checker
+func New(checker Checker, opts ...Option) *Authorizer {
+	a := &Authorizer{
+		checker: checker,
+		subject: ContextSubject,
+		onError: writeError,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Allowed checks whether the request's subject holds permission on object,
+// for handlers that decide for themselves what to do on denial. It returns
+// ErrNoSubject for unauthenticated requests.
+func (a *Authorizer) Allowed(r *http.Request, permission string, object Object) (bool, error) {
+	subject, ok := a.subject(r)
+	if !ok {
+		return false, ErrNoSubject
+	}
+
+	req := &client.CheckPermissionRequest{
+		SubjectType: subject.Type,
+		SubjectID:   subject.ID,
+		Permission:  permission,
+		ObjectType:  object.Type,
+		ObjectID:    object.ID,
+	}
+	if a.context != nil {
+		req.Context = a.context(r)
+	}
+
+	resp, err := a.checker.CheckPermission(r.Context(), req)
+	if err != nil {
+		return false, fmt.Errorf("checking %s on %s:%s: %w", permission, object.Type, object.ID, err)
+	}
+	return resp.Allowed, nil
+}
+
+// RequirePermission passes requests on only when their subject holds
+// permission on the object resolve returns
+func (a *Authorizer) RequirePermission(permission string, resolve ObjectResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := a.subject(r); !ok {
+				a.onError(w, r, http.StatusUnauthorized, ErrNoSubject)
+				return
+			}
+
+			object, err := resolve(r)
+			if err != nil {
+				a.onError(w, r, http.StatusBadRequest, err)
+				return
+			}
+
+			allowed, err := a.Allowed(r, permission, object)
+			switch {
+			case err != nil:
+				a.onError(w, r, http.StatusServiceUnavailable, err)
+			case !allowed:
+				a.onError(w, r, http.StatusForbidden, ErrDenied)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// PathValueObject resolves the object from a path wildcard, e.g. {id} in a
+// net/http ServeMux or chi pattern
+func PathValueObject(objectType, name string) ObjectResolver {
+	return func(r *http.Request) (Object, error) {
+		id := r.PathValue(name)
+		if id == "" {
+			return Object{}, fmt.Errorf("missing %s", name)
+		}
+		return Object{Type: objectType, ID: id}, nil
+	}
+}
+
+// QueryObject resolves the object from a query parameter
+func QueryObject(objectType, param string) ObjectResolver {
+	return func(r *http.Request) (Object, error) {
+		id := r.URL.Query().Get(param)
+		if id == "" {
+			return Object{}, fmt.Errorf("missing %s", param)
+		}
+		return Object{Type: objectType, ID: id}, nil
+	}
+}
+
+// StaticObject resolves every request to the same object, e.g. the
+// application itself for admin routes
+func StaticObject(objectType, id string) ObjectResolver {
+	return func(r *http.Request) (Object, error) {
+		return Object{Type: objectType, ID: id}, nil
+	}
+}
+
+// writeError writes {"error": "..."}, hiding why a check failed
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	message := err.Error()
+	if status == http.StatusServiceUnavailable {
+		message = "authorization service unavailable"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangerclosesec/supra/sdk/client"
+)
+
+// fakeChecker allows what's in allowed, keyed subject_id:permission:object_id
+type fakeChecker struct {
+	allowed map[string]bool
+	err     error
+	last    *client.CheckPermissionRequest
+}
+
+func (f *fakeChecker) CheckPermission(ctx context.Context, req *client.CheckPermissionRequest) (*client.CheckPermissionResponse, error) {
+	f.last = req
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &client.CheckPermissionResponse{Allowed: f.allowed[req.SubjectID+":"+req.Permission+":"+req.ObjectID]}, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	checker := &fakeChecker{allowed: map[string]bool{"alice:view:doc1": true}}
+	authz := New(checker, WithCheckContext(func(r *http.Request) map[string]interface{} {
+		return map[string]interface{}{"ip": "10.0.0.1"}
+	}))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /documents/{id}", authz.RequirePermission("view", PathValueObject("document", "id"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }),
+	))
+
+	serve := func(user, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != "" {
+			r = r.WithContext(WithSubject(r.Context(), Subject{Type: "user", ID: user}))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := serve("alice", "/documents/doc1"); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected alice to view doc1, got %d", rec.Code)
+	}
+	if checker.last.ObjectType != "document" || checker.last.Context["ip"] != "10.0.0.1" {
+		t.Errorf("Expected a check on the document with the request context, got %+v", checker.last)
+	}
+
+	if rec := serve("alice", "/documents/doc2"); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"error":"forbidden"`) {
+		t.Errorf("Expected a 403 for doc2, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve("", "/documents/doc1"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 without a subject, got %d", rec.Code)
+	}
+
+	checker.err = errors.New("connection refused")
+	rec := serve("alice", "/documents/doc1")
+	if rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "refused") {
+		t.Errorf("Expected a 503 that hides the cause, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRequirePermissionOptions(t *testing.T) {
+	checker := &fakeChecker{allowed: map[string]bool{"svc-1:admin:app": true}}
+	var refused int
+	authz := New(checker,
+		WithSubjectResolver(func(r *http.Request) (Subject, bool) {
+			id := r.Header.Get("X-Service")
+			return Subject{Type: "service", ID: id}, id != ""
+		}),
+		WithErrorHandler(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			refused = status
+			http.Error(w, "nope", status)
+		}),
+	)
+	handler := authz.RequirePermission("admin", StaticObject("application", "app"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	r.Header.Set("X-Service", "svc-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || checker.last.SubjectType != "service" {
+		t.Errorf("Expected the service to be allowed, got %d for %+v", rec.Code, checker.last)
+	}
+
+	r.Header.Set("X-Service", "svc-2")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if refused != http.StatusForbidden {
+		t.Errorf("Expected the error handler to see a 403, got %d", refused)
+	}
+
+	bad := authz.RequirePermission("view", QueryObject("document", "id"))(http.NotFoundHandler())
+	bad.ServeHTTP(httptest.NewRecorder(), r)
+	if refused != http.StatusBadRequest {
+		t.Errorf("Expected a 400 without the query parameter, got %d", refused)
+	}
+}
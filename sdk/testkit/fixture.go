@@ -0,0 +1,196 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangerclosesec/supra/sdk/client"
+)
+
+// fixtureTimeout bounds writing a fixture, and removing it
+const fixtureTimeout = 30 * time.Second
+
+// Fixture builds the graph a test runs against. Entities it names,
+// including the ends of its relations, are deleted with all their
+// relations when the test ends, so give them IDs no other test uses.
+// Permissions it defines are removed too, unless the schema already had
+// them.
+type Fixture struct {
+	entities    []fixtureEntity
+	relations   []string
+	permissions []client.CreatePermissionRequest
+}
+
+type fixtureEntity struct {
+	ref        string
+	properties map[string]interface{}
+}
+
+// NewFixture returns an empty fixture
+func NewFixture() *Fixture {
+	return &Fixture{}
+}
+
+// Entity adds an entity, such as document:plan, with its properties.
+// Entities at the ends of relations are created without properties when
+// they aren't added.
+func (f *Fixture) Entity(ref string, properties map[string]interface{}) *Fixture {
+	f.entities = append(f.entities, fixtureEntity{ref: ref, properties: properties})
+	return f
+}
+
+// Relations adds relations written as "subject relation object", e.g.
+// "user:alice owner document:plan"
+func (f *Fixture) Relations(tuples ...string) *Fixture {
+	f.relations = append(f.relations, tuples...)
+	return f
+}
+
+// Permission defines a permission on entityType, e.g. document, read and
+// "owner or viewer". A permission the schema already defines must have the
+// same condition.
+func (f *Fixture) Permission(entityType, name, condition string) *Fixture {
+	f.permissions = append(f.permissions, client.CreatePermissionRequest{
+		EntityType:          entityType,
+		PermissionName:      name,
+		ConditionExpression: condition,
+	})
+	return f
+}
+
+// Apply writes the fixture through c, stopping the test if any of it
+// fails, and removes it when the test ends. Relations are tagged with a
+// testkit: source, so any a crashed test leaves behind can be revoked
+// together.
+func (f *Fixture) Apply(t testing.TB, c *client.Client) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), fixtureTimeout)
+	defer cancel()
+
+	// Cleanups run last in first out, so removal is registered before
+	// anything is written and sees all of it
+	var created []client.CreatePermissionRequest
+	refs := make(map[string]bool)
+	var cleanup []string
+	t.Cleanup(func() { f.remove(t, c, cleanup, created) })
+
+	remember := func(ref string) {
+		if !refs[ref] {
+			refs[ref] = true
+			cleanup = append(cleanup, ref)
+		}
+	}
+
+	if len(f.permissions) > 0 {
+		existing, err := c.ListPermissionDefinitions(ctx)
+		if err != nil {
+			t.Fatalf("fixture: failed to list permissions: %v", err)
+		}
+		defined := make(map[string]string, len(existing))
+		for _, p := range existing {
+			defined[p.EntityType+"."+p.PermissionName] = p.ConditionExpression
+		}
+		for _, p := range f.permissions {
+			name := p.EntityType + "." + p.PermissionName
+			if condition, ok := defined[name]; ok {
+				if condition != p.ConditionExpression {
+					t.Fatalf("fixture: %s is already defined as %q, not %q", name, condition, p.ConditionExpression)
+				}
+				continue
+			}
+			if _, err := c.CreatePermission(ctx, &p); err != nil {
+				t.Fatalf("fixture: failed to define %s: %v", name, err)
+			}
+			created = append(created, p)
+		}
+	}
+
+	for _, e := range f.entities {
+		entityType, id := splitRef(t, e.ref)
+		remember(e.ref)
+		if _, err := c.UpsertEntity(ctx, &client.CreateEntityRequest{Type: entityType, ExternalID: id, Properties: e.properties}); err != nil {
+			t.Fatalf("fixture: failed to write %s: %v", e.ref, err)
+		}
+	}
+
+	if len(f.relations) == 0 {
+		return
+	}
+	source := relationSource(t.Name())
+	writes := make([]client.RelationWrite, len(f.relations))
+	for i, tuple := range f.relations {
+		fields := strings.Fields(tuple)
+		if len(fields) != 3 {
+			t.Fatalf("fixture: relation %q: want \"subject relation object\", e.g. \"user:alice owner document:plan\"", tuple)
+		}
+		subjectType, subjectID := splitRef(t, fields[0])
+		objectType, objectID := splitRef(t, fields[2])
+		remember(fields[0])
+		remember(fields[2])
+		writes[i] = client.RelationWrite{
+			Op:          client.RelationshipCreate,
+			SubjectType: subjectType,
+			SubjectID:   subjectID,
+			Relation:    fields[1],
+			ObjectType:  objectType,
+			ObjectID:    objectID,
+			Source:      source,
+		}
+	}
+	resp, err := c.WriteRelations(ctx, writes)
+	if err != nil {
+		t.Fatalf("fixture: failed to write relations: %v", err)
+	}
+	for i, result := range resp.Results {
+		if result.Error != "" && result.Code != "relation_exists" {
+			t.Fatalf("fixture: failed to write %q: [%s] %s", f.relations[i], result.Code, result.Error)
+		}
+	}
+}
+
+// remove deletes the entities a fixture wrote, with their relations, and
+// the permissions it defined
+func (f *Fixture) remove(t testing.TB, c *client.Client, refs []string, permissions []client.CreatePermissionRequest) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), fixtureTimeout)
+	defer cancel()
+
+	for _, ref := range refs {
+		entityType, id, _ := strings.Cut(ref, ":")
+		if err := c.DeleteEntityCascade(ctx, entityType, id); err != nil && !notFound(err) {
+			t.Errorf("fixture: failed to remove %s: %v", ref, err)
+		}
+	}
+	for _, p := range permissions {
+		if err := c.DeletePermission(ctx, p.EntityType, p.PermissionName); err != nil {
+			t.Errorf("fixture: failed to remove %s.%s: %v", p.EntityType, p.PermissionName, err)
+		}
+	}
+}
+
+// notFound reports whether err is the service answering 404, as for an
+// entity the test already deleted
+func notFound(err error) bool {
+	var apiErr *client.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// relationSource tags the relations of a test's fixture, e.g.
+// testkit:TestSharing_nested for TestSharing/nested. Sources allow only
+// letters, digits and - _ . : @, and at most 128 characters.
+func relationSource(testName string) string {
+	source := []byte("testkit:" + testName)
+	for i, c := range source {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '@':
+		default:
+			source[i] = '_'
+		}
+	}
+	return string(source[:min(len(source), 128)])
+}
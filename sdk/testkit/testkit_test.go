@@ -0,0 +1,210 @@
+package testkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dangerclosesec/supra/sdk/client"
+)
+
+// fakeService keeps what a fixture writes and allows the checks in allowed,
+// keyed subject permission object as in "user:alice read document:plan"
+type fakeService struct {
+	mu          sync.Mutex
+	permissions map[string]string
+	entities    map[string]bool
+	relations   []client.RelationWrite
+	deleted     []string
+	allowed     map[string]bool
+}
+
+func newFakeService(t *testing.T) (*fakeService, *client.Client) {
+	t.Helper()
+	f := &fakeService{
+		permissions: map[string]string{"document.read": "owner or viewer"},
+		entities:    make(map[string]bool),
+		allowed:     make(map[string]bool),
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, client.NewClient(&client.Config{BaseURL: server.URL})
+}
+
+func (f *fakeService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+
+	switch r.Method + " " + r.URL.Path {
+	case "GET /api/permission-definitions":
+		var defs []client.PermissionDefinition
+		for name, condition := range f.permissions {
+			entityType, permission, _ := strings.Cut(name, ".")
+			defs = append(defs, client.PermissionDefinition{EntityType: entityType, PermissionName: permission, ConditionExpression: condition})
+		}
+		json.NewEncoder(w).Encode(defs)
+	case "POST /permission":
+		var req client.CreatePermissionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.permissions[req.EntityType+"."+req.PermissionName] = req.ConditionExpression
+		json.NewEncoder(w).Encode(client.PermissionResponse{EntityType: req.EntityType, PermissionName: req.PermissionName})
+	case "DELETE /permission":
+		delete(f.permissions, q.Get("entity_type")+"."+q.Get("permission_name"))
+	case "POST /entity":
+		var req client.CreateEntityRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.entities[req.Type+":"+req.ExternalID] = true
+		json.NewEncoder(w).Encode(client.EntityResponse{Type: req.Type, ExternalID: req.ExternalID})
+	case "DELETE /entity":
+		f.deleted = append(f.deleted, q.Get("type")+":"+q.Get("id"))
+	case "POST /relations/batch":
+		var req struct {
+			Operations []client.RelationWrite `json:"operations"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.relations = append(f.relations, req.Operations...)
+		resp := client.WriteRelationshipsResponse{Created: len(req.Operations)}
+		for _, op := range req.Operations {
+			resp.Results = append(resp.Results, client.RelationshipResult{Op: op.Op, Relation: &client.RelationResponse{}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	case "POST /check":
+		var req client.CheckPermissionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		allowed := f.allowed[describe(&req)]
+		reason := client.ReasonDeniedNoPath
+		if allowed {
+			reason = client.ReasonMatchedRelation
+		}
+		json.NewEncoder(w).Encode(client.CheckPermissionResponse{Allowed: allowed, Reason: reason})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fatalRecorder notes the first failure of an assertion, which stops it
+// like a failed test would stop
+type fatalRecorder struct {
+	testing.TB
+	failure string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// failure runs assert and returns how it failed, or "" if it passed
+func failure(t *testing.T, assert func(t testing.TB)) string {
+	r := &fatalRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert(r)
+	}()
+	<-done
+	return r.failure
+}
+
+func TestFixture(t *testing.T) {
+	f, c := newFakeService(t)
+
+	t.Run("sharing", func(t *testing.T) {
+		NewFixture().
+			Entity("document:plan", map[string]interface{}{"title": "Plan"}).
+			Permission("document", "read", "owner or viewer").
+			Permission("document", "share", "owner").
+			Relations("user:alice owner document:plan", "document:plan team team:eng").
+			Apply(t, c)
+
+		if !f.entities["document:plan"] {
+			t.Error("document:plan wasn't written")
+		}
+		if len(f.relations) != 2 {
+			t.Fatalf("wrote %d relations, want 2", len(f.relations))
+		}
+		rel := f.relations[1]
+		if rel.SubjectType != "document" || rel.SubjectID != "plan" || rel.Relation != "team" ||
+			rel.ObjectType != "team" || rel.ObjectID != "eng" {
+			t.Errorf("second relation = %+v, want document:plan team team:eng", rel)
+		}
+		if rel.Source != "testkit:TestFixture_sharing" {
+			t.Errorf("source = %q, want testkit:TestFixture_sharing", rel.Source)
+		}
+		if f.permissions["document.share"] != "owner" {
+			t.Error("document.share wasn't defined")
+		}
+	})
+
+	// Removed when the subtest ended, except the permission it didn't add
+	want := []string{"document:plan", "user:alice", "team:eng"}
+	if strings.Join(f.deleted, ",") != strings.Join(want, ",") {
+		t.Errorf("deleted %v, want %v", f.deleted, want)
+	}
+	if _, ok := f.permissions["document.share"]; ok {
+		t.Error("document.share was left defined")
+	}
+	if _, ok := f.permissions["document.read"]; !ok {
+		t.Error("document.read, defined before the fixture, was removed")
+	}
+}
+
+func TestFixtureRejectsConflicts(t *testing.T) {
+	_, c := newFakeService(t)
+
+	msg := failure(t, func(t testing.TB) {
+		NewFixture().Permission("document", "read", "owner").Apply(t, c)
+	})
+	if !strings.Contains(msg, `document.read is already defined as "owner or viewer"`) {
+		t.Errorf("conflicting permission: got failure %q", msg)
+	}
+
+	msg = failure(t, func(t testing.TB) {
+		NewFixture().Relations("user:alice owner").Apply(t, c)
+	})
+	if !strings.Contains(msg, `relation "user:alice owner"`) {
+		t.Errorf("malformed relation: got failure %q", msg)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	f, c := newFakeService(t)
+	f.allowed["user:alice read document:plan"] = true
+
+	if msg := failure(t, func(t testing.TB) { RequirePermission(t, c, "user:alice", "read", "document:plan") }); msg != "" {
+		t.Errorf("allowed check failed: %s", msg)
+	}
+	if msg := failure(t, func(t testing.TB) { RequireNoPermission(t, c, "user:bob", "read", "document:plan") }); msg != "" {
+		t.Errorf("denied check failed: %s", msg)
+	}
+
+	msg := failure(t, func(t testing.TB) { RequirePermission(t, c, "user:bob", "read", "document:plan") })
+	if want := "check user:bob read document:plan: want allowed, got denied (denied_no_path)"; msg != want {
+		t.Errorf("failure = %q, want %q", msg, want)
+	}
+	msg = failure(t, func(t testing.TB) { RequireNoPermission(t, c, "user:alice", "read", "document:plan") })
+	if !strings.Contains(msg, "want denied, got allowed") {
+		t.Errorf("failure = %q, want one saying the check was allowed", msg)
+	}
+	msg = failure(t, func(t testing.TB) { RequirePermission(t, c, "alice", "read", "document:plan") })
+	if !strings.Contains(msg, `entity reference "alice"`) {
+		t.Errorf("failure = %q, want one about the malformed reference", msg)
+	}
+}
+
+func TestRelationSource(t *testing.T) {
+	if got := relationSource("TestSharing/team members"); got != "testkit:TestSharing_team_members" {
+		t.Errorf("relationSource() = %q", got)
+	}
+	if got := relationSource(strings.Repeat("x", 200)); len(got) != 128 {
+		t.Errorf("relationSource() has %d characters, want 128", len(got))
+	}
+}
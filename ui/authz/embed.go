@@ -0,0 +1,20 @@
+// Package authzui embeds the statically exported authz dashboard. Run
+// `make ui` to rebuild dist/ before building the service.
+package authzui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// FS returns the dashboard's static files rooted at dist/
+func FS() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
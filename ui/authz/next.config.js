@@ -1,11 +1,24 @@
+const isDev = process.env.NODE_ENV === "development";
+
 module.exports = {
   reactStrictMode: true,
-  async rewrites() {
-    return [
-      {
-        source: "/api/:path*",
-        destination: "http://localhost:4780/api/:path*", // Proxy API requests to the Go backend
-      },
-    ];
-  },
+  // Production builds are exported as static files into dist/ and embedded
+  // into the authz service, which serves them under /dashboard
+  ...(isDev
+    ? {
+        async rewrites() {
+          return [
+            {
+              source: "/api/:path*",
+              destination: "http://localhost:4780/api/:path*", // Proxy API requests to the Go backend
+            },
+          ];
+        },
+      }
+    : {
+        output: "export",
+        distDir: "dist",
+        basePath: "/dashboard",
+        images: { unoptimized: true },
+      }),
 };
@@ -71,6 +71,7 @@ type AuditLogResponse = {
 const actionTypeOptions = [
   { value: "permission_check", label: "Permission Check" },
   { value: "entity_create", label: "Entity Create" },
+  { value: "entity_update", label: "Entity Update" },
   { value: "entity_delete", label: "Entity Delete" },
   { value: "relation_create", label: "Relation Create" },
   { value: "relation_delete", label: "Relation Delete" },
@@ -195,6 +196,8 @@ export default function AuditLogViewer() {
         return "bg-blue-500/10 text-blue-500 border-blue-500/20";
       case "entity_create":
         return "bg-green-500/10 text-green-500 border-green-500/20";
+      case "entity_update":
+        return "bg-teal-500/10 text-teal-500 border-teal-500/20";
       case "entity_delete":
         return "bg-red-500/10 text-red-500 border-red-500/20";
       case "relation_create":
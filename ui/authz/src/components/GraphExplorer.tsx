@@ -38,6 +38,8 @@ const GraphExplorer: React.FC<GraphExplorerProps> = ({ className }) => {
   const [entityId, setEntityId] = useState<string>("");
   const [relationType, setRelationType] = useState<string>("");
   const [depth, setDepth] = useState<string>("2");
+  const [overlaySubject, setOverlaySubject] = useState<string>("");
+  const [overlayPermission, setOverlayPermission] = useState<string>("");
   const [graphData, setGraphData] = useState<GraphData>({
     nodes: [],
     links: [],
@@ -46,7 +48,7 @@ const GraphExplorer: React.FC<GraphExplorerProps> = ({ className }) => {
   const [error, setError] = useState<string | null>(null);
   const [selectedNode, setSelectedNode] = useState<Node | null>(null);
 
-  const fetchGraphData = async () => {
+  const fetchGraphData = async (cursor?: string) => {
     setLoading(true);
     setError(null);
     try {
@@ -55,6 +57,11 @@ const GraphExplorer: React.FC<GraphExplorerProps> = ({ className }) => {
       if (entityId) params.append("entity_id", entityId);
       if (relationType) params.append("relation_type", relationType);
       params.append("depth", depth);
+      if (cursor) params.append("cursor", cursor);
+      if (overlaySubject && overlayPermission) {
+        params.append("subject", overlaySubject);
+        params.append("permission", overlayPermission);
+      }
 
       const response = await fetch(`/api/graph?${params.toString()}`);
       if (!response.ok) {
@@ -90,7 +97,7 @@ const GraphExplorer: React.FC<GraphExplorerProps> = ({ className }) => {
           </CardDescription>
         </CardHeader>
         <CardContent>
-          <div className="grid grid-cols-1 md:grid-cols-5 gap-4">
+          <div className="grid grid-cols-1 md:grid-cols-7 gap-4">
             <div className="md:col-span-1">
               <label className="block text-sm font-medium mb-1 text-muted-foreground">
                 Entity Type
@@ -154,9 +161,35 @@ const GraphExplorer: React.FC<GraphExplorerProps> = ({ className }) => {
               </Select>
             </div>
 
+            <div className="md:col-span-1">
+              <label className="block text-sm font-medium mb-1 text-muted-foreground">
+                Overlay Subject
+              </label>
+              <Input
+                type="text"
+                placeholder="e.g. user:alice"
+                value={overlaySubject}
+                onChange={(e) => setOverlaySubject(e.target.value)}
+                className="bg-secondary/50 border-border/60"
+              />
+            </div>
+
+            <div className="md:col-span-1">
+              <label className="block text-sm font-medium mb-1 text-muted-foreground">
+                Overlay Permission
+              </label>
+              <Input
+                type="text"
+                placeholder="e.g. view"
+                value={overlayPermission}
+                onChange={(e) => setOverlayPermission(e.target.value)}
+                className="bg-secondary/50 border-border/60"
+              />
+            </div>
+
             <div className="md:col-span-1 flex items-end">
               <Button
-                onClick={fetchGraphData}
+                onClick={() => fetchGraphData()}
                 className="w-full gap-2"
                 disabled={loading}
               >
@@ -177,6 +210,35 @@ const GraphExplorer: React.FC<GraphExplorerProps> = ({ className }) => {
         </CardContent>
       </Card>
 
+      {graphData.overlay && (
+        <div className="bg-secondary/30 p-4 rounded-md border border-border/40 text-sm">
+          <span className="font-medium">{graphData.overlay.subject}</span>{" "}
+          {graphData.overlay.allowed ? "has" : "does not have"}{" "}
+          <span className="font-medium">{graphData.overlay.permission}</span> on{" "}
+          <span className="font-medium">{graphData.overlay.object}</span>{" "}
+          <span className="text-muted-foreground">({graphData.overlay.reason})</span>
+        </div>
+      )}
+
+      {graphData.warnings && graphData.warnings.length > 0 && (
+        <div className="bg-secondary/30 p-4 rounded-md border border-border/40 text-sm flex items-center justify-between gap-4">
+          <ul className="list-disc pl-4">
+            {graphData.warnings.map((warning) => (
+              <li key={warning}>{warning}</li>
+            ))}
+          </ul>
+          {graphData.next_cursor && (
+            <Button
+              variant="outline"
+              onClick={() => fetchGraphData(graphData.next_cursor)}
+              disabled={loading}
+            >
+              Next page
+            </Button>
+          )}
+        </div>
+      )}
+
       {error && (
         <div className="bg-destructive/10 text-destructive p-4 rounded-md border border-destructive/20">
           {error}
@@ -206,6 +268,7 @@ const GraphExplorer: React.FC<GraphExplorerProps> = ({ className }) => {
             <GraphVisualization
               data={graphData}
               onNodeClick={handleNodeClick}
+              highlightPath={graphData.links.filter((link) => link.access)}
             />
           )}
         </div>
@@ -256,7 +319,7 @@ const GraphExplorer: React.FC<GraphExplorerProps> = ({ className }) => {
                   setEntityType(selectedNode.type);
                   setEntityId(selectedNode.id.split(":")[1]);
                   setSelectedNode(null);
-                  setTimeout(fetchGraphData, 100);
+                  setTimeout(() => fetchGraphData(), 100);
                 }}
               >
                 <Zap className="h-3 w-3" />
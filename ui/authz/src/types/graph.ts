@@ -4,6 +4,7 @@ export interface Node {
   type: string;
   label: string;
   group: string;
+  access?: boolean;
 }
 
 export interface Link {
@@ -11,11 +12,25 @@ export interface Link {
   target: string;
   type: string;
   label: string;
+  access?: boolean;
+}
+
+export interface PermissionOverlay {
+  subject: string;
+  permission: string;
+  object: string;
+  expression?: string;
+  allowed: boolean;
+  reason: string;
 }
 
 export interface GraphData {
   nodes: Node[];
   links: Link[];
+  overlay?: PermissionOverlay;
+  next_cursor?: string;
+  truncated?: boolean;
+  warnings?: string[];
 }
 
 export interface PermissionPathResponse {